@@ -8,13 +8,16 @@ from fastapi.middleware.cors import CORSMiddleware
 from fastapi.security import HTTPBearer
 import uvicorn
 import logging
-from typing import List, Dict, Any
+import json
+from typing import List, Dict, Any, Optional
+from pydantic import BaseModel
 import asyncio
 from datetime import datetime
 from PIL import Image, ImageEnhance, ImageFilter
 import io
 from contextlib import asynccontextmanager
 from config import config
+import page_ocr
 
 # Configure logging
 logging.basicConfig(level=logging.INFO)
@@ -103,6 +106,10 @@ async def lifespan(app: FastAPI):
     # Cleanup on shutdown
     logger.info("Shutting down AI Service...")
 
+# Version of the request/response contract shared with the Go backend.
+# Bump it whenever an endpoint's fields change.
+SCHEMA_VERSION = "5"
+
 # Initialize FastAPI app with lifespan
 app = FastAPI(
     title="FraudDocAI AI Service",
@@ -128,6 +135,7 @@ async def root():
         "service": "FraudDocAI AI Service",
         "status": "running",
         "version": "1.0.0",
+        "schema_version": SCHEMA_VERSION,
         "config": {
             "server": config.get_server_config(),
             "ai_models": config.get_ai_config()
@@ -218,6 +226,54 @@ async def process_document(
         logger.error(f"Error processing document: {e}")
         raise HTTPException(status_code=500, detail=str(e))
 
+@app.post("/extract-text")
+async def extract_text(
+    file: UploadFile = File(...),
+    pages: Optional[str] = Form(None),
+    thorough: bool = Form(False),
+    token: str = Depends(security)
+):
+    """
+    Extract the full text of a document without analyzing it, page by page.
+    pages, such as "3,7,12", limits extraction to those pages, and thorough
+    OCRs them again more carefully.
+    """
+    page_numbers = None
+    if pages:
+        try:
+            page_numbers = sorted({int(page) for page in pages.split(",") if page.strip()})
+        except ValueError:
+            raise HTTPException(status_code=400, detail="pages must be comma separated page numbers")
+        if any(page < 1 for page in page_numbers):
+            raise HTTPException(status_code=400, detail="page numbers start at 1")
+
+    content = await file.read()
+    ocr_result = await extract_text_with_quality_enhancement(
+        content, file.content_type, page_numbers=page_numbers, thorough=thorough
+    )
+
+    if ocr_result["file_type"] == "unsupported":
+        raise HTTPException(
+            status_code=415,
+            detail=f"Unsupported file type: {file.content_type}"
+        )
+    if ocr_result["file_type"] == "error":
+        raise HTTPException(status_code=422, detail=ocr_result["processing_notes"])
+
+    return {
+        "filename": file.filename,
+        "file_type": ocr_result["file_type"],
+        "extracted_text": ocr_result["extracted_text"],
+        "confidence_score": ocr_result["confidence_score"],
+        "quality_level": ocr_result["quality_level"],
+        "preprocessing_applied": ocr_result["preprocessing_applied"],
+        "text_blocks": ocr_result["text_blocks"],
+        "processing_notes": ocr_result["processing_notes"],
+        "page_count": ocr_result.get("page_count", 0),
+        "pages": ocr_result.get("pages", []),
+        "timestamp": datetime.utcnow().isoformat()
+    }
+
 @app.post("/analyze-text")
 async def analyze_text(
     text: str,
@@ -231,17 +287,7 @@ async def analyze_text(
         
         # Analyze text for fraud patterns
         fraud_analysis = await analyze_text_for_fraud(text)
-        
-        result = {
-            "text_length": len(text),
-            "fraud_score": fraud_analysis["fraud_score"],
-            "risk_level": fraud_analysis["risk_level"],
-            "patterns": fraud_analysis["patterns"],
-            "emotion_analysis": fraud_analysis.get("emotion_analysis", {}),
-            "pattern_analysis": fraud_analysis.get("pattern_analysis", {}),
-            "processing_time_ms": fraud_analysis["processing_time"],
-            "timestamp": datetime.utcnow().isoformat()
-        }
+        result = text_analysis_result(text, fraud_analysis)
         
         logger.info(f"Text analysis completed: {fraud_analysis['risk_level']} risk")
         return result
@@ -250,6 +296,53 @@ async def analyze_text(
         logger.error(f"Error analyzing text: {e}")
         raise HTTPException(status_code=500, detail=str(e))
 
+# Largest number of texts accepted by /analyze-batch
+MAX_BATCH_SIZE = 100
+
+class AnalyzeBatchRequest(BaseModel):
+    texts: List[str]
+
+@app.post("/analyze-batch")
+async def analyze_batch(
+    request: AnalyzeBatchRequest,
+    token: str = Depends(security)
+):
+    """
+    Analyze several texts in one call. Results are returned in request order.
+    """
+    if len(request.texts) > MAX_BATCH_SIZE:
+        raise HTTPException(
+            status_code=413,
+            detail=f"Batch of {len(request.texts)} texts exceeds the limit of {MAX_BATCH_SIZE}"
+        )
+    
+    try:
+        logger.info(f"Analyzing batch of {len(request.texts)} texts")
+        
+        results = []
+        for text in request.texts:
+            fraud_analysis = await analyze_text_for_fraud(text)
+            results.append(text_analysis_result(text, fraud_analysis))
+        
+        return {"results": results, "count": len(results)}
+        
+    except Exception as e:
+        logger.error(f"Error analyzing batch: {e}")
+        raise HTTPException(status_code=500, detail=str(e))
+
+def text_analysis_result(text: str, fraud_analysis: dict) -> dict:
+    """Shape an analyze_text_for_fraud result as returned by /analyze-text"""
+    return {
+        "text_length": len(text),
+        "fraud_score": fraud_analysis["fraud_score"],
+        "risk_level": fraud_analysis["risk_level"],
+        "patterns": fraud_analysis["patterns"],
+        "emotion_analysis": fraud_analysis.get("emotion_analysis", {}),
+        "pattern_analysis": fraud_analysis.get("pattern_analysis", {}),
+        "processing_time_ms": fraud_analysis["processing_time"],
+        "timestamp": datetime.utcnow().isoformat()
+    }
+
 @app.post("/generate-embeddings")
 async def generate_embeddings(
     text: str,
@@ -278,6 +371,7 @@ async def generate_embeddings(
                 "text": text[:100] + "..." if len(text) > 100 else text,
                 "embeddings": embeddings.tolist(),
                 "embedding_dimension": len(embeddings),
+                "model": config.get_ai_config()['embedding_model'],
                 "generation_time_ms": round(generation_time, 2),
                 "timestamp": datetime.utcnow().isoformat()
             }
@@ -343,6 +437,7 @@ async def get_fraud_patterns(token: str = Depends(security)):
         raise HTTPException(status_code=500, detail=str(e))
 
 @app.post("/document-qa")
+@app.post("/ask-document")
 async def document_qa(
     question: str = Form(...),
     document_text: str = Form(...),
@@ -367,8 +462,8 @@ async def document_qa(
             "question": question,
             "answer": answer["answer"],
             "confidence": answer["confidence"],
-            "context_used": answer["context_used"],
-            "processing_time_ms": answer["processing_time_ms"],
+            "context_used": answer.get("context_used", ""),
+            "model_used": answer.get("model_used", "unknown"),
             "timestamp": datetime.utcnow().isoformat()
         }
         
@@ -382,11 +477,31 @@ async def document_qa(
 @app.post("/analyze-document-fraud")
 async def analyze_document_fraud(
     document_text: str = Form(...),
+    questions: Optional[str] = Form(None),
+    prompt_template: Optional[str] = Form(None),
     token: str = Depends(security)
 ):
     """
-    Comprehensive fraud analysis of a document
+    Comprehensive fraud analysis of a document. questions, a JSON list of
+    {question, category, risk_weight}, replaces the default questions, and
+    prompt_template, containing {question}, rewords each one.
     """
+    fraud_questions = None
+    if questions:
+        try:
+            fraud_questions = json.loads(questions)
+            if not isinstance(fraud_questions, list) or not all(
+                isinstance(q, dict) and isinstance(q.get("question"), str)
+                and isinstance(q.get("category"), str)
+                and isinstance(q.get("risk_weight"), (int, float))
+                for q in fraud_questions
+            ):
+                raise ValueError("expected a list of {question, category, risk_weight}")
+        except ValueError as e:
+            raise HTTPException(status_code=422, detail=f"Invalid questions: {e}")
+    if prompt_template and "{question}" not in prompt_template:
+        raise HTTPException(status_code=422, detail="prompt_template must contain {question}")
+
     try:
         logger.info(f"Analyzing document for fraud: {len(document_text)} characters")
         
@@ -397,19 +512,21 @@ async def analyze_document_fraud(
             )
         
         # Analyze the document
-        analysis = document_qa_service.analyze_document_fraud(document_text)
+        analysis = document_qa_service.analyze_document_for_fraud_questions(
+            document_text, fraud_questions, prompt_template
+        )
         
         result = {
             "document_length": len(document_text),
-            "fraud_risk_score": analysis["fraud_risk_score"],
-            "risk_level": analysis["risk_level"],
-            "key_indicators": analysis["key_indicators"],
-            "recommendations": analysis["recommendations"],
-            "processing_time_ms": analysis["processing_time_ms"],
+            "fraud_analysis": analysis["fraud_analysis"],
+            "overall_risk": analysis["overall_risk"],
+            "total_risk_score": analysis["total_risk_score"],
+            "questions_analyzed": analysis["questions_analyzed"],
+            "model_used": analysis["model_used"],
             "timestamp": datetime.utcnow().isoformat()
         }
         
-        logger.info(f"Document fraud analysis completed: {analysis['risk_level']} risk")
+        logger.info(f"Document fraud analysis completed: {analysis['overall_risk']} risk")
         return result
         
     except Exception as e:
@@ -424,19 +541,14 @@ async def get_qa_model_info(token: str = Depends(security)):
     try:
         if document_qa_service == "limited" or document_qa_service is None:
             return {
-                "model_loaded": False,
-                "model_name": "Not available",
-                "status": "limited"
+                "model_available": False,
+                "error": "Document QA service not available"
             }
         
-        model_info = document_qa_service.get_model_info()
-        
         return {
-            "model_loaded": True,
-            "model_name": model_info["model_name"],
-            "model_type": model_info["model_type"],
-            "max_length": model_info["max_length"],
-            "status": "ready"
+            "model_available": True,
+            "model_info": document_qa_service.get_model_info(),
+            "timestamp": datetime.utcnow().isoformat()
         }
         
     except Exception as e:
@@ -480,58 +592,51 @@ async def extract_text_from_document(content: bytes, content_type: str) -> str:
         logger.error(f"Error extracting text: {e}")
         return "Error extracting text from document"
 
-async def extract_text_with_quality_enhancement(content: bytes, content_type: str) -> dict:
-    """Extract text with quality enhancements and confidence scoring"""
+async def extract_text_with_quality_enhancement(content: bytes, content_type: str,
+                                                page_numbers: Optional[List[int]] = None,
+                                                thorough: bool = False) -> dict:
+    """
+    Extract text with quality enhancements and confidence scoring. PDFs and
+    images are extracted page by page, OCRing pages concurrently; only the
+    pages in page_numbers when given.
+    """
     try:
-        if content_type == "application/pdf":
-            import PyPDF2
-            import io
-            pdf_reader = PyPDF2.PdfReader(io.BytesIO(content))
-            text = ""
-            page_count = len(pdf_reader.pages)
-            for page in pdf_reader.pages:
-                text += page.extract_text() + "\n"
-            
-            return {
-                "extracted_text": text.strip(),
-                "confidence_score": 95.0,  # PDF text extraction is typically very reliable
-                "quality_level": "excellent",
-                "preprocessing_applied": False,
-                "text_blocks": page_count,
-                "processing_notes": "PDF text extraction - high reliability",
-                "file_type": "pdf"
-            }
-        
-        elif content_type in ["image/jpeg", "image/png", "image/tiff"]:
-            import pytesseract
-            from PIL import Image, ImageEnhance, ImageFilter
-            import io
-            
-            # Preprocess image for better OCR
-            processed_image = preprocess_image_for_ocr(content)
-            
-            # Extract text with confidence data
-            ocr_data = pytesseract.image_to_data(
-                processed_image, 
-                output_type=pytesseract.Output.DICT,
-                config='--psm 6'  # Assume single text block
+        if content_type in ["application/pdf", "image/jpeg", "image/png", "image/tiff"]:
+            ocr_config = config.get_ocr_config()
+            dpi = ocr_config["thorough_dpi"] if thorough else ocr_config["dpi"]
+            if content_type == "application/pdf":
+                sources = page_ocr.pdf_pages(content, dpi, ocr_config["page_timeout"])
+                file_type = "pdf"
+            else:
+                sources = page_ocr.image_pages(content)
+                file_type = "image"
+            page_count = len(sources)
+            if page_numbers is not None:
+                sources = [source for source in sources if source.number in page_numbers]
+
+            # OCR blocks on tesseract, so it runs off the event loop
+            results = await asyncio.to_thread(
+                page_ocr.extract_pages, sources, ocr_config["workers"],
+                ocr_config["page_timeout"], thorough
             )
-            
-            # Calculate confidence scores
-            confidences = [int(conf) for conf in ocr_data['conf'] if int(conf) > 0]
-            avg_confidence = sum(confidences) / len(confidences) if confidences else 0
-            
-            # Extract text
-            text = pytesseract.image_to_string(processed_image)
-            
+            document = page_ocr.assemble(results)
+
+            if document["ocr_pages"] == 0:
+                notes = "PDF text extraction - high reliability"
+            else:
+                notes = f"{document['ocr_pages']} of {len(results)} pages OCR'd. " + get_processing_notes(document["confidence"])
+            if document["failed_pages"]:
+                notes += f" {document['failed_pages']} pages could not be read."
             return {
-                "extracted_text": text.strip(),
-                "confidence_score": round(avg_confidence, 1),
-                "quality_level": get_quality_level(avg_confidence),
-                "preprocessing_applied": True,
-                "text_blocks": len(confidences),
-                "processing_notes": get_processing_notes(avg_confidence),
-                "file_type": "image"
+                "extracted_text": document["text"],
+                "confidence_score": document["confidence"],
+                "quality_level": get_quality_level(document["confidence"]),
+                "preprocessing_applied": document["ocr_pages"] > 0,
+                "text_blocks": len(results),
+                "processing_notes": notes,
+                "file_type": file_type,
+                "page_count": page_count,
+                "pages": document["pages"]
             }
         
         elif content_type == "application/vnd.openxmlformats-officedocument.wordprocessingml.document":
@@ -35,6 +35,13 @@ class Config:
             'embedding_model': 'all-MiniLM-L6-v2'
         }
         
+        self.config['ocr'] = {
+            'workers': str(os.cpu_count() or 2),
+            'page_timeout': '60',
+            'dpi': '300',
+            'thorough_dpi': '400'
+        }
+        
         # Try to load from config file
         config_file = os.getenv('FRAUDDOCAI_CONFIG', 'config.ini')
         if os.path.exists(config_file):
@@ -68,6 +75,16 @@ class Config:
             self.config['ai']['qa_model'] = os.getenv('FRAUDDOCAI_QA_MODEL')
         if os.getenv('FRAUDDOCAI_EMBEDDING_MODEL'):
             self.config['ai']['embedding_model'] = os.getenv('FRAUDDOCAI_EMBEDDING_MODEL')
+        
+        # OCR configuration
+        if os.getenv('FRAUDDOCAI_OCR_WORKERS'):
+            self.config['ocr']['workers'] = os.getenv('FRAUDDOCAI_OCR_WORKERS')
+        if os.getenv('FRAUDDOCAI_OCR_PAGE_TIMEOUT'):
+            self.config['ocr']['page_timeout'] = os.getenv('FRAUDDOCAI_OCR_PAGE_TIMEOUT')
+        if os.getenv('FRAUDDOCAI_OCR_DPI'):
+            self.config['ocr']['dpi'] = os.getenv('FRAUDDOCAI_OCR_DPI')
+        if os.getenv('FRAUDDOCAI_OCR_THOROUGH_DPI'):
+            self.config['ocr']['thorough_dpi'] = os.getenv('FRAUDDOCAI_OCR_THOROUGH_DPI')
     
     def get_server_config(self) -> Dict[str, Any]:
         """Get server configuration"""
@@ -96,6 +113,15 @@ class Config:
             'embedding_model': self.config['ai']['embedding_model']
         }
     
+    def get_ocr_config(self) -> Dict[str, Any]:
+        """Get OCR configuration"""
+        return {
+            'workers': max(1, int(self.config['ocr']['workers'])),
+            'page_timeout': float(self.config['ocr']['page_timeout']),
+            'dpi': int(self.config['ocr']['dpi']),
+            'thorough_dpi': int(self.config['ocr']['thorough_dpi'])
+        }
+    
     def save_config(self, filename: str = 'config.ini'):
         """Save current configuration to file"""
         with open(filename, 'w') as f:
@@ -106,7 +132,8 @@ class Config:
         return {
             'server': self.get_server_config(),
             'cors': self.get_cors_config(),
-            'ai': self.get_ai_config()
+            'ai': self.get_ai_config(),
+            'ocr': self.get_ocr_config()
         }
     
     def get_base_url(self, protocol: str = "http") -> str:
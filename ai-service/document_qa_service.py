@@ -11,6 +11,40 @@ import re
 
 logger = logging.getLogger(__name__)
 
+# Fraud detection questions asked when a request brings none of its own
+DEFAULT_FRAUD_QUESTIONS = [
+    {
+        "question": "What is the total amount mentioned in this document?",
+        "category": "amount_verification",
+        "risk_weight": 0.3
+    },
+    {
+        "question": "Are there any urgent or immediate payment requests?",
+        "category": "urgency_indicators",
+        "risk_weight": 0.4
+    },
+    {
+        "question": "What contact information is provided in this document?",
+        "category": "contact_verification",
+        "risk_weight": 0.2
+    },
+    {
+        "question": "Are there any mentions of wire transfers or cryptocurrency?",
+        "category": "payment_methods",
+        "risk_weight": 0.5
+    },
+    {
+        "question": "What is the purpose or reason for this transaction?",
+        "category": "transaction_purpose",
+        "risk_weight": 0.3
+    },
+    {
+        "question": "Are there any confidentiality or secrecy requirements mentioned?",
+        "category": "secrecy_indicators",
+        "risk_weight": 0.6
+    }
+]
+
 class DocumentQuestionAnsweringService:
     """Document Question Answering service for fraud detection queries"""
     
@@ -100,8 +134,17 @@ class DocumentQuestionAnsweringService:
             logger.warning(f"Error extracting relevant context: {e}")
             return context[:max_length]
     
-    def analyze_document_for_fraud_questions(self, document_text: str) -> Dict[str, Any]:
-        """Analyze document using predefined fraud detection questions"""
+    def analyze_document_for_fraud_questions(
+        self,
+        document_text: str,
+        questions: Optional[List[Dict[str, Any]]] = None,
+        prompt_template: Optional[str] = None
+    ) -> Dict[str, Any]:
+        """Analyze document using fraud detection questions
+
+        questions replaces the predefined questions, and prompt_template, which
+        contains {question}, rewords each question before it is asked.
+        """
         if not self.model_loaded:
             return {
                 "fraud_analysis": [],
@@ -109,46 +152,17 @@ class DocumentQuestionAnsweringService:
                 "error": "QA model not loaded"
             }
         
-        # Predefined fraud detection questions
-        fraud_questions = [
-            {
-                "question": "What is the total amount mentioned in this document?",
-                "category": "amount_verification",
-                "risk_weight": 0.3
-            },
-            {
-                "question": "Are there any urgent or immediate payment requests?",
-                "category": "urgency_indicators",
-                "risk_weight": 0.4
-            },
-            {
-                "question": "What contact information is provided in this document?",
-                "category": "contact_verification",
-                "risk_weight": 0.2
-            },
-            {
-                "question": "Are there any mentions of wire transfers or cryptocurrency?",
-                "category": "payment_methods",
-                "risk_weight": 0.5
-            },
-            {
-                "question": "What is the purpose or reason for this transaction?",
-                "category": "transaction_purpose",
-                "risk_weight": 0.3
-            },
-            {
-                "question": "Are there any confidentiality or secrecy requirements mentioned?",
-                "category": "secrecy_indicators",
-                "risk_weight": 0.6
-            }
-        ]
+        fraud_questions = questions or DEFAULT_FRAUD_QUESTIONS
         
         fraud_analysis = []
         total_risk_score = 0.0
         
         for qa_item in fraud_questions:
             try:
-                result = self.answer_question(qa_item["question"], document_text)
+                prompt = qa_item["question"]
+                if prompt_template:
+                    prompt = prompt_template.replace("{question}", prompt)
+                result = self.answer_question(prompt, document_text)
                 
                 # Analyze the answer for fraud indicators
                 fraud_indicators = self._analyze_answer_for_fraud(
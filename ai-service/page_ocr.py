@@ -0,0 +1,209 @@
+"""
+FraudDocAI - Page-level text extraction
+Extracts documents page by page, running OCR on the pages that need it
+concurrently with a bounded pool of workers
+"""
+
+import io
+import logging
+import time
+from concurrent.futures import ThreadPoolExecutor
+from typing import Callable, Dict, List, Optional
+
+from PIL import Image, ImageEnhance, ImageFilter, ImageSequence
+
+logger = logging.getLogger(__name__)
+
+# Confidence given to text read from a PDF's text layer rather than by OCR
+TEXT_LAYER_CONFIDENCE = 95.0
+
+# A PDF page whose text layer has fewer characters than this is taken for a
+# scan and run through OCR
+MIN_TEXT_LAYER_CHARS = 20
+
+
+def ocr_image(image: Image.Image, timeout: float, thorough: bool = False) -> Dict:
+    """
+    OCR one page image with tesseract, giving up after timeout seconds.
+    Thorough OCR, for re-OCR of low-confidence pages, also tries automatic
+    page segmentation and keeps the more confident reading.
+    """
+    import pytesseract
+
+    attempts = ["--psm 6"]  # Assume a single block of text
+    if thorough:
+        attempts.append("--psm 3")
+
+    processed = preprocess_page(image)
+    best = None
+    for tesseract_config in attempts:
+        data = pytesseract.image_to_data(
+            processed,
+            output_type=pytesseract.Output.DICT,
+            config=tesseract_config,
+            timeout=timeout,
+        )
+        reading = reading_from_data(data)
+        if best is None or reading["confidence"] > best["confidence"]:
+            best = reading
+    return best
+
+
+def reading_from_data(data: Dict) -> Dict:
+    """Rebuild the text of a page, line by line, from tesseract's word data"""
+    lines = []
+    current_key = None
+    confidences = []
+    for i, word in enumerate(data["text"]):
+        confidence = float(data["conf"][i])
+        if confidence < 0 or not word.strip():
+            continue
+        confidences.append(confidence)
+        key = (data["block_num"][i], data["par_num"][i], data["line_num"][i])
+        if key != current_key:
+            if current_key is not None and key[:2] != current_key[:2]:
+                lines.append("")  # Paragraph break
+            lines.append(word)
+            current_key = key
+        else:
+            lines[-1] += " " + word
+
+    return {
+        "text": "\n".join(lines),
+        "confidence": round(sum(confidences) / len(confidences), 1) if confidences else 0.0,
+        "words": len(confidences),
+    }
+
+
+def preprocess_page(image: Image.Image) -> Image.Image:
+    """Enhance a page image for OCR: grayscale, contrast, denoise and sharpen"""
+    try:
+        if image.mode != 'L':
+            image = image.convert('L')
+        image = ImageEnhance.Contrast(image).enhance(1.5)
+        image = image.filter(ImageFilter.MedianFilter(size=3))
+        return image.filter(ImageFilter.SHARPEN)
+    except Exception as e:
+        logger.error(f"Page preprocessing failed: {e}")
+        return image
+
+
+class PageSource:
+    """A page to extract: its text layer if it has one, else a way to render it"""
+
+    def __init__(self, number: int, text: Optional[str] = None,
+                 render: Optional[Callable[[], Image.Image]] = None):
+        self.number = number
+        self.text = text
+        self.render = render
+
+
+def pdf_pages(content: bytes, dpi: int, timeout: float) -> List[PageSource]:
+    """Pages of a PDF, with the text layer of those that have one"""
+    import PyPDF2
+
+    reader = PyPDF2.PdfReader(io.BytesIO(content))
+    try:
+        from pdf2image import convert_from_bytes
+    except ImportError:
+        convert_from_bytes = None
+        logger.warning("pdf2image is not installed; scanned PDF pages cannot be OCR'd")
+
+    pages = []
+    for index, page in enumerate(reader.pages):
+        number = index + 1
+        text = page.extract_text() or ""
+        if len(text.strip()) >= MIN_TEXT_LAYER_CHARS or convert_from_bytes is None:
+            pages.append(PageSource(number, text=text))
+            continue
+
+        def render(number=number):
+            images = convert_from_bytes(content, dpi=dpi, first_page=number,
+                                        last_page=number, timeout=timeout)
+            return images[0]
+        pages.append(PageSource(number, render=render))
+    return pages
+
+
+def image_pages(content: bytes) -> List[PageSource]:
+    """Pages of an image, one per frame of a multi-page TIFF"""
+    image = Image.open(io.BytesIO(content))
+    frames = getattr(image, "n_frames", 1)
+    if frames == 1:
+        return [PageSource(1, render=lambda: image)]
+
+    def render(number):
+        # Frames are read from their own copy of the file, as seeking a
+        # shared image from several workers is not safe
+        frame = Image.open(io.BytesIO(content))
+        frame.seek(number - 1)
+        return frame.copy()
+    return [PageSource(i + 1, render=lambda i=i: render(i + 1)) for i in range(frames)]
+
+
+def extract_page(source: PageSource, timeout: float, thorough: bool) -> Dict:
+    """Extract one page, reporting a failure or timeout in its result"""
+    started = time.monotonic()
+    result = {"page": source.number, "source": "text", "status": "ok"}
+    if source.render is None:
+        result["text"] = (source.text or "").strip()
+        result["confidence"] = TEXT_LAYER_CONFIDENCE
+    else:
+        result["source"] = "ocr"
+        try:
+            reading = ocr_image(source.render(), timeout, thorough)
+            result["text"] = reading["text"].strip()
+            result["confidence"] = reading["confidence"]
+        except Exception as e:
+            # pytesseract and pdf2image raise RuntimeError and
+            # PDFPopplerTimeoutError on their timeouts
+            timed_out = "timeout" in str(e).lower() or "Timeout" in type(e).__name__
+            result["status"] = "timeout" if timed_out else "error"
+            result["error"] = str(e)
+            result["text"] = ""
+            result["confidence"] = 0.0
+            logger.warning(f"OCR of page {source.number} failed: {e}")
+    result["duration_ms"] = int((time.monotonic() - started) * 1000)
+    return result
+
+
+def extract_pages(sources: List[PageSource], workers: int, timeout: float,
+                  thorough: bool = False) -> List[Dict]:
+    """
+    Extract the pages, running OCR on up to workers pages at once, and return
+    their results in page order. Pages are rendered by the worker that OCRs
+    them, so no more than workers page images are held at once.
+    """
+    if not sources:
+        return []
+    with ThreadPoolExecutor(max_workers=max(1, min(workers, len(sources)))) as pool:
+        return list(pool.map(lambda source: extract_page(source, timeout, thorough), sources))
+
+
+def assemble(results: List[Dict]) -> Dict:
+    """
+    Join the texts of the pages in order, noting where each page's text
+    starts and ends in the joined text, in UTF-8 bytes
+    """
+    texts = []
+    pages = []
+    offset = 0
+    for result in results:
+        text = result.pop("text")
+        if texts:
+            offset += 1  # The newline joining the pages
+        size = len(text.encode("utf-8"))
+        result["text_start"] = offset
+        result["text_end"] = offset + size
+        offset += size
+        texts.append(text)
+        pages.append(result)
+
+    ocr_confidences = [p["confidence"] for p in pages]
+    return {
+        "text": "\n".join(texts),
+        "pages": pages,
+        "confidence": round(sum(ocr_confidences) / len(ocr_confidences), 1) if ocr_confidences else 0.0,
+        "ocr_pages": sum(1 for p in pages if p["source"] == "ocr"),
+        "failed_pages": sum(1 for p in pages if p["status"] != "ok"),
+    }
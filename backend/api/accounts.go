@@ -0,0 +1,132 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAccountEvidence adds the analysis of a document to the risk of the
+// accounts it is related to, in place of any earlier analysis of it. A
+// failure is only logged: the document is analyzed, and its accounts catch
+// up when it is analyzed again.
+func (s *Server) recordAccountEvidence(documentID services.DocumentID, text string) {
+	document, err := s.store.GetDocument(documentID)
+	if err != nil || document.FraudScore == nil {
+		return
+	}
+	for _, key := range services.DocumentAccounts(document, text) {
+		account, err := s.store.GetOrCreateAccount(document.TenantID, key.Kind, key.Identifier)
+		if err == nil {
+			err = s.store.RecordAccountEvidence(&services.AccountEvidence{
+				AccountID:    account.ID,
+				DocumentID:   document.ID,
+				FraudScore:   *document.FraudScore,
+				RiskLevel:    document.FraudRiskLevel,
+				PatternCount: document.PatternCount,
+				ObservedAt:   document.CreatedAt,
+			}, s.accounts.RiskHalfLife)
+		}
+		if err != nil {
+			log.Printf("Failed to add document %s to the risk of %s account %s: %v",
+				document.ID, key.Kind, key.Identifier, err)
+		}
+	}
+}
+
+// getAccountRisk returns the risk of an account as of now, with the
+// documents that make it up, those weighing most first. limit caps the
+// evidence listed; the score always counts all of it.
+func (s *Server) getAccountRisk(c *gin.Context) {
+	var req struct {
+		Limit int `form:"limit" binding:"omitempty,min=1,max=500"`
+	}
+	if !bindQuery(c, &req) {
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	account, err := s.store.GetAccount(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Account not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get account %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve account",
+			"status": "error",
+		})
+		return
+	}
+	evidence, err := s.store.ListAccountEvidence(account.ID)
+	if err != nil {
+		log.Printf("Failed to list the evidence of account %s: %v", account.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve account evidence",
+			"status": "error",
+		})
+		return
+	}
+	var tenant *services.Tenant
+	if account.TenantID != nil {
+		if tenant, err = s.store.GetTenant(*account.TenantID); err != nil {
+			log.Printf("Failed to load tenant %s: %v", *account.TenantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to retrieve account",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	score := services.AccountRisk(evidence, s.accounts.RiskHalfLife, time.Now())
+	total := len(evidence)
+	if total > req.Limit {
+		evidence = evidence[:req.Limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"account":        account,
+		"risk_score":     score,
+		"risk_level":     riskTaxonomyFor(tenant).LevelForScore(score).Name,
+		"half_life":      s.accounts.RiskHalfLife.String(),
+		"evidence":       evidence,
+		"total_evidence": total,
+		"status":         "success",
+	})
+}
+
+// getDocumentAccounts lists the accounts a document added evidence to
+func (s *Server) getDocumentAccounts(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	accounts, err := s.store.ListDocumentAccounts(documentID)
+	if err != nil {
+		log.Printf("Failed to list the accounts of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document accounts",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"accounts":    accounts,
+		"total":       len(accounts),
+		"status":      "success",
+	})
+}
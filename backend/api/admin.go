@@ -0,0 +1,64 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireAdmin only lets through requests bearing the configured admin token
+func (s *Server) requireAdmin(c *gin.Context) {
+	if s.adminToken == "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":  "Admin API is disabled",
+			"status": "error",
+		})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":  "Invalid admin token",
+			"status": "error",
+		})
+		return
+	}
+	c.Next()
+}
+
+// checkAIContract probes the AI service and reports whether it speaks the
+// schema version this backend expects
+func (s *Server) checkAIContract(c *gin.Context) {
+	report, err := s.ai.CheckContract(c.Request.Context())
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+
+	if !report.Compatible {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "AI service does not match the expected schema",
+			"report": report,
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report": report,
+		"status": "success",
+	})
+}
+
+// invalidateQAModelInfo drops this replica's cached QA model info, so a
+// newly deployed model is reported at once
+func (s *Server) invalidateQAModelInfo(c *gin.Context) {
+	s.modelInfo.Invalidate()
+	c.JSON(http.StatusOK, gin.H{
+		"message": "QA model info cache invalidated",
+		"status":  "success",
+	})
+}
@@ -0,0 +1,120 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"frauddocai-backend/api"
+	"frauddocai-backend/api/apitest"
+	"frauddocai-backend/config"
+	"frauddocai-backend/services"
+)
+
+var replayDocuments = map[string]string{
+	"invoice.txt":  "INVOICE #1001\nAmount due: $1,250.00\nPay within 24 hours to avoid penalties.",
+	"receipt.txt":  "Receipt for order 5521\nTotal: $18.40",
+	"letter.txt":   "Dear customer, your account has been suspended. Verify your password now.",
+	"contract.txt": "This agreement is made between the parties named below.",
+}
+
+// runReplayPipeline uploads every replay document through a harness whose AI
+// client is wrapped for replay in mode, and returns the score each was given
+func runReplayPipeline(t *testing.T, mode, dir string, batchSize int, setup func(*apitest.Harness)) map[string]float64 {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h := apitest.NewWith(func(deps *api.Dependencies) {
+		replay, err := services.NewReplayAIClient(config.AIReplayConfig{Mode: mode, Dir: dir}, deps.AI)
+		if err != nil {
+			t.Fatalf("NewReplayAIClient: %v", err)
+		}
+		deps.AI = replay
+		deps.Batcher = services.NewBatchCoordinator(batchSize, time.Second, 1)
+		go deps.Batcher.Run(ctx)
+	})
+	if setup != nil {
+		setup(h)
+	}
+
+	ids := map[string]services.DocumentID{}
+	for name, text := range replayDocuments {
+		rec := h.Upload("/api/v1/documents/upload", name, "text/plain", []byte(text), nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("upload %s: status %d: %s", name, rec.Code, rec.Body.String())
+		}
+		body, err := apitest.DecodeJSON(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = services.DocumentID(body["file_id"].(string))
+	}
+
+	scores := map[string]float64{}
+	for name, id := range ids {
+		doc, err := h.WaitForStatus(id, services.DocumentProcessed, 5*time.Second)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if doc.AnalysisFallback {
+			t.Errorf("%s was scored by the fallback analyzer", name)
+		}
+		if doc.FraudScore == nil {
+			t.Fatalf("%s has no fraud score", name)
+		}
+		scores[name] = *doc.FraudScore
+	}
+	return scores
+}
+
+func TestAIReplayScoresThePipelineAsRecorded(t *testing.T) {
+	dir := t.TempDir()
+
+	// Recorded in one batch
+	var recorder *apitest.Harness
+	recorded := runReplayPipeline(t, services.AIReplayRecord, dir, len(replayDocuments), func(h *apitest.Harness) {
+		recorder = h
+		h.AI.AnalyzeTextFunc = func(ctx context.Context, req services.AnalyzeTextRequest) (*services.AnalyzeTextResponse, error) {
+			score := float64(len(req.Text)%90) / 100
+			return &services.AnalyzeTextResponse{
+				TextLength:      len(req.Text),
+				FraudScore:      &score,
+				RiskLevel:       "LOW",
+				Patterns:        []string{},
+				EmotionAnalysis: []byte(`{"emotions":[]}`),
+				PatternAnalysis: []byte(`{"patterns":[]}`),
+			}, nil
+		}
+	})
+
+	batches := 0
+	for _, call := range recorder.AI.Calls() {
+		switch call {
+		case "AnalyzeBatch":
+			batches++
+		case "AnalyzeText":
+			t.Fatalf("recorded with AnalyzeText, want every text in one batch")
+		}
+	}
+	if batches != 1 {
+		t.Fatalf("recorded in %d batches, want 1", batches)
+	}
+
+	// Batched differently, and with the AI service down: every text must be
+	// answered from its recording whichever batch it lands in
+	for _, batchSize := range []int{1, 3} {
+		replayed := runReplayPipeline(t, services.AIReplayReplay, dir, batchSize, func(h *apitest.Harness) {
+			h.AI.AnalyzeTextFunc = func(ctx context.Context, req services.AnalyzeTextRequest) (*services.AnalyzeTextResponse, error) {
+				return nil, errors.New("AI service called while replaying")
+			}
+		})
+		for name, score := range recorded {
+			if replayed[name] != score {
+				t.Errorf("batch size %d: %s scored %v, recorded %v", batchSize, name, replayed[name], score)
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authenticateAPIKey runs requests bearing an API key for the key's tenant:
+// X-Tenant is replaced with the tenant's slug, whatever the client sent.
+// Revoked and unknown keys are refused.
+func (s *Server) authenticateAPIKey(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, services.APIKeyPrefix) {
+		c.Next()
+		return
+	}
+	key, err := s.store.GetAPIKeyByDigest(services.TokenDigest(token))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to look up API key: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to verify API key",
+			"status": "error",
+		})
+		return
+	}
+	if key == nil || key.RevokedAt != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":  "Invalid or revoked API key",
+			"status": "error",
+		})
+		return
+	}
+	tenant, err := s.store.GetTenant(key.TenantID)
+	if err != nil {
+		log.Printf("Failed to load tenant of API key %s: %v", key.ID, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to verify API key",
+			"status": "error",
+		})
+		return
+	}
+	if err := s.store.MarkAPIKeyUsed(key.ID, time.Now()); err != nil {
+		log.Printf("Failed to mark API key %s used: %v", key.ID, err)
+	}
+
+	c.Request.Header.Set(TenantHeader, tenant.Slug)
+	c.Next()
+}
+
+// getAPIKeys lists a tenant's API keys, newest first
+func (s *Server) getAPIKeys(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	var keys []*services.APIKey
+	if err == nil {
+		keys, err = s.store.GetAPIKeys(tenant.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to list API keys of tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve API keys",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+		"total":    len(keys),
+		"status":   "success",
+	})
+}
+
+// revokeAPIKey ends an API key at once
+func (s *Server) revokeAPIKey(c *gin.Context) {
+	key, err := s.store.RevokeAPIKey(c.Param("id"), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "API key not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke API key %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to revoke API key",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Revoked API key %s of tenant %s", key.ID, key.TenantID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_key": key,
+		"status":  "success",
+	})
+}
@@ -0,0 +1,165 @@
+// Package apitest spins up the API router against in-memory services so
+// handlers can be exercised with net/http/httptest, without Postgres, MinIO
+// or the AI service.
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"time"
+
+	"frauddocai-backend/api"
+	"frauddocai-backend/services"
+	"frauddocai-backend/services/servicesmock"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Harness is a configured router plus the mocks behind it
+type Harness struct {
+	Router  *gin.Engine
+	Store   *servicesmock.Store
+	Storage *servicesmock.Storage
+	AI      *servicesmock.AIClient
+}
+
+// New builds a router wired to fresh in-memory services. Each harness has its
+// own server, so tests using separate harnesses can run in parallel.
+func New() *Harness {
+	return NewWith(nil)
+}
+
+// NewWith is New with the dependencies adjusted by configure before the
+// server is built, such as to wrap the mocks or add a batcher
+func NewWith(configure func(*api.Dependencies)) *Harness {
+	gin.SetMode(gin.TestMode)
+
+	h := &Harness{
+		Router:  gin.New(),
+		Store:   servicesmock.NewStore(),
+		Storage: servicesmock.NewStorage(),
+		AI:      servicesmock.NewAIClient(),
+	}
+	deps := api.Dependencies{
+		Store:   h.Store,
+		Storage: h.Storage,
+		AI:      h.AI,
+	}
+	if configure != nil {
+		configure(&deps)
+	}
+	server := api.NewServer(deps)
+	server.Routes(h.Router)
+	go server.RunPipelineWorker(context.Background())
+	return h
+}
+
+// Do sends a request with an optional JSON body and records the response
+func (h *Harness) Do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			panic(fmt.Sprintf("apitest: failed to encode request body: %v", err))
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return h.Serve(req)
+}
+
+// Serve records the response to an arbitrary request
+func (h *Harness) Serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.Router.ServeHTTP(rec, req)
+	return rec
+}
+
+// Upload posts a multipart upload with the file in the "file" field plus any
+// extra form fields
+func (h *Harness) Upload(path, filename, contentType string, content []byte, fields map[string]string) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+
+	part := textproto.MIMEHeader{}
+	part.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, filename))
+	part.Set("Content-Type", contentType)
+	fw, err := w.CreatePart(part)
+	if err != nil {
+		panic(fmt.Sprintf("apitest: failed to build upload: %v", err))
+	}
+	fw.Write(content)
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return h.Serve(req)
+}
+
+// SeedDocument stores a processed document with sensible defaults. Options
+// can adjust any field before it is saved.
+func (h *Harness) SeedDocument(options ...func(*services.Document)) *services.Document {
+	text := "INVOICE #TEST-1\nAmount: $100.00"
+	score := 0.1
+	doc := &services.Document{
+		Filename:         "test_invoice.txt",
+		OriginalFilename: "test_invoice.txt",
+		FilePath:         "test_invoice.txt",
+		FileSize:         int64(len(text)),
+		MimeType:         "text/plain",
+		Status:           services.DocumentProcessed,
+		FraudScore:       &score,
+		FraudRiskLevel:   "low",
+		ExtractedText:    &text,
+	}
+	for _, option := range options {
+		option(doc)
+	}
+	if err := h.Store.CreateDocument(doc); err != nil {
+		panic(fmt.Sprintf("apitest: failed to seed document: %v", err))
+	}
+	return doc
+}
+
+// WaitForStatus polls until the document reaches status, for asserting on
+// work the handlers start in the background
+func (h *Harness) WaitForStatus(documentID services.DocumentID, status string, timeout time.Duration) (*services.Document, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		doc, err := h.Store.GetDocument(documentID)
+		if err == nil && doc.Status == status {
+			return doc, nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, err
+			}
+			return doc, fmt.Errorf("document %s still %q after %v", documentID, doc.Status, timeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// DecodeJSON decodes a recorded JSON response body
+func DecodeJSON(rec *httptest.ResponseRecorder) (map[string]interface{}, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		return nil, fmt.Errorf("response is not JSON (status %d): %s", rec.Code, rec.Body.String())
+	}
+	return body, nil
+}
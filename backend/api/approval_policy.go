@@ -0,0 +1,107 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkApprovalPolicy records an approval_outside_policy detection when the
+// document's approval, as its metadata reports it, breaks its tenant's
+// approval policy
+func (s *Server) checkApprovalPolicy(document *services.Document, tenant *services.Tenant) {
+	if tenant == nil || tenant.ApprovalPolicy == nil {
+		return
+	}
+	if factor := tenant.ApprovalPolicy.Check(document.DocumentType, document.Metadata); factor != nil {
+		s.recordRiskFactors(document, []services.RiskFactor{*factor})
+	}
+}
+
+// getApprovalPolicy returns the approval policy of the X-Tenant tenant
+func (s *Server) getApprovalPolicy(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	if tenant == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  TenantHeader + " header is required",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":          tenant.Slug,
+		"approval_policy": tenant.ApprovalPolicy,
+		"status":          "success",
+	})
+}
+
+// putApprovalPolicy replaces a tenant's approval policy. Documents are
+// checked against it when analyzed and when their metadata changes.
+func (s *Server) putApprovalPolicy(c *gin.Context) {
+	var policy services.ApprovalPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be an approval policy",
+			"status": "error",
+		})
+		return
+	}
+	s.updateApprovalPolicy(c, &policy)
+}
+
+// deleteApprovalPolicy stops checking a tenant's approvals
+func (s *Server) deleteApprovalPolicy(c *gin.Context) {
+	s.updateApprovalPolicy(c, nil)
+}
+
+func (s *Server) updateApprovalPolicy(c *gin.Context, policy *services.ApprovalPolicy) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	err = s.store.UpdateTenantApprovalPolicy(tenant.ID, policy)
+	var policyErr *services.ApprovalPolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid approval policy",
+			"problems": policyErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update approval policy for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update approval policy",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":          tenant.Slug,
+		"approval_policy": policy,
+		"status":          "success",
+	})
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondApprovalError writes the response for a failed four-eyes check,
+// disposition or approval operation
+func respondApprovalError(c *gin.Context, err error, notFound string) {
+	var dispositionErr *services.DispositionError
+	switch {
+	case errors.As(err, &dispositionErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid disposition",
+			"problems": dispositionErr.Problems,
+			"status":   "error",
+		})
+	case errors.Is(err, services.ErrDispositionConflict):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  notFound,
+			"status": "error",
+		})
+	case errors.Is(err, services.ErrApprovalRequired):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "A second reviewer must approve this; request it with POST /approvals",
+			"status": "error",
+		})
+	case errors.Is(err, services.ErrApprovalPending),
+		errors.Is(err, services.ErrApprovalNotNeeded),
+		errors.Is(err, services.ErrApprovalDecided):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+	case errors.Is(err, services.ErrNotApprover):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+	default:
+		log.Printf("Approval operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Approval operation failed",
+			"status": "error",
+		})
+	}
+}
+
+// requestApproval asks a second reviewer to approve closing a critical alert
+// or overriding a critical detection on behalf of the X-User reviewer
+func (s *Server) requestApproval(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Action      string  `json:"action" binding:"required,oneof=close_alert override_detection"`
+		TargetID    string  `json:"target_id" binding:"required,uuid"`
+		ApproverID  *string `json:"approver_id" binding:"omitempty,uuid"`
+		Reason      *string `json:"reason" binding:"omitempty,max=2000"`
+		Disposition string  `json:"disposition" binding:"required,max=50"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.ApproverID != nil && *req.ApproverID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "The approver must be another reviewer",
+			"status": "error",
+		})
+		return
+	}
+
+	approval := &services.Approval{
+		Action:      req.Action,
+		TargetID:    req.TargetID,
+		RequestedBy: user.ID,
+		ApproverID:  req.ApproverID,
+		Reason:      req.Reason,
+		Disposition: &req.Disposition,
+	}
+	if err := s.store.RequestApproval(approval); err != nil {
+		respondApprovalError(c, err, "Approval target not found")
+		return
+	}
+	log.Printf("User %s requested approval %s to %s %s", user.ID, approval.ID, approval.Action, approval.TargetID)
+
+	// Without a named approver any reviewer of the tenant may decide
+	notify := []string{}
+	if approval.ApproverID != nil {
+		notify = append(notify, *approval.ApproverID)
+	}
+	s.emitApprovalWebhook(services.WebhookApprovalNeeded, approval, gin.H{
+		"approval": approval,
+		"notify":   notify,
+		"links":    s.approvalLinks(approval),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"approval": approval,
+		"status":   "success",
+	})
+}
+
+// getApprovals lists the approvals of the X-Tenant tenant, pending ones by
+// default. approver narrows them to those the user may decide.
+func (s *Server) getApprovals(c *gin.Context) {
+	var query struct {
+		Status   string `form:"status" binding:"omitempty,oneof=pending approved rejected all"`
+		Approver string `form:"approver" binding:"omitempty,uuid"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+
+	filter := services.ApprovalFilter{Status: query.Status, ApproverID: query.Approver, Limit: limit}
+	switch filter.Status {
+	case "":
+		filter.Status = services.ApprovalPending
+	case "all":
+		filter.Status = ""
+	}
+	if tenant != nil {
+		filter.TenantID = &tenant.ID
+	}
+
+	approvals, err := s.store.GetApprovals(filter)
+	if err != nil {
+		respondApprovalError(c, err, "")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"approvals": approvals,
+		"total":     len(approvals),
+		"status":    "success",
+	})
+}
+
+// emitApprovalWebhook emits an event about an approval. Those about closing
+// an alert are listed on the timeline of the alert's case.
+func (s *Server) emitApprovalWebhook(eventType string, approval *services.Approval, data interface{}) {
+	if approval.Action == services.ApprovalCloseAlert {
+		s.emitAlertWebhook(eventType, approval.TargetID, approval.TenantID, data)
+		return
+	}
+	s.emitWebhook(eventType, approval.TenantID, data)
+}
+
+func (s *Server) approveApproval(c *gin.Context) {
+	s.decideApproval(c, true)
+}
+
+func (s *Server) rejectApproval(c *gin.Context) {
+	s.decideApproval(c, false)
+}
+
+// decideApproval records the X-User reviewer's decision. The requester is
+// notified through the approval.decided webhook.
+func (s *Server) decideApproval(c *gin.Context, approve bool) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+
+	approval, err := s.store.DecideApproval(c.Param("id"), user, approve)
+	if err != nil {
+		respondApprovalError(c, err, "Approval not found")
+		return
+	}
+	log.Printf("User %s %s approval %s", user.ID, approval.Status, approval.ID)
+	s.emitApprovalWebhook(services.WebhookApprovalDecided, approval, gin.H{
+		"approval": approval,
+		"notify":   []string{approval.RequestedBy},
+		"links":    s.approvalLinks(approval),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"approval": approval,
+		"status":   "success",
+	})
+}
+
+// reviewDetection records the X-User reviewer's verdict on a detection with a
+// disposition code. false_positive follows from the code's outcome and is
+// only needed for inconclusive codes. Overriding a detection of a critical
+// pattern needs an approval instead.
+func (s *Server) reviewDetection(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		FalsePositive *bool  `json:"false_positive"`
+		Disposition   string `json:"disposition" binding:"required,max=50"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	detection, err := s.store.ReviewDetection(c.Param("id"), user.ID, req.FalsePositive, req.Disposition)
+	if err != nil {
+		respondApprovalError(c, err, "Detection not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"detection": detection,
+		"status":    "success",
+	})
+}
@@ -0,0 +1,504 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditorGrantTTL bounds how long an auditor grant may last
+const maxAuditorGrantTTL = 90 * 24 * time.Hour
+
+// Context keys of the auditor routes
+const (
+	auditorGrantKey     = "auditor_grant"
+	auditorWatermarkKey = "auditor_watermark"
+)
+
+// createAuditorGrant gives an external auditor read-only access to some of
+// a tenant's cases and team collections until expires_at. The token is in
+// the response only; it cannot be retrieved later.
+func (s *Server) createAuditorGrant(c *gin.Context) {
+	var req struct {
+		Auditor   string    `json:"auditor" binding:"required,notblank,max=255"`
+		CaseIDs   []string  `json:"case_ids" binding:"omitempty,max=500,dive,uuid"`
+		TeamIDs   []string  `json:"team_ids" binding:"omitempty,max=100,dive,uuid"`
+		ExpiresAt time.Time `json:"expires_at" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if len(req.CaseIDs) == 0 && len(req.TeamIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "A grant must name at least one case or team",
+			"status": "error",
+		})
+		return
+	}
+	now := time.Now()
+	if !req.ExpiresAt.After(now) || req.ExpiresAt.Sub(now) > maxAuditorGrantTTL {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "expires_at must be in the future and at most 90 days away",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create auditor grant",
+			"status": "error",
+		})
+		return
+	}
+
+	// Everything granted must be the tenant's
+	for _, id := range req.CaseIDs {
+		alert, err := s.store.GetAlert(id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to load case %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to create auditor grant",
+				"status": "error",
+			})
+			return
+		}
+		if alert == nil || alert.TenantID == nil || *alert.TenantID != tenant.ID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Case not found in the tenant",
+				"case_id": id,
+				"status":  "error",
+			})
+			return
+		}
+	}
+	for _, id := range req.TeamIDs {
+		team, err := s.store.GetTeam(id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to load team %s: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to create auditor grant",
+				"status": "error",
+			})
+			return
+		}
+		if team == nil || team.TenantID != tenant.ID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Team not found in the tenant",
+				"team_id": id,
+				"status":  "error",
+			})
+			return
+		}
+	}
+
+	token, digest, err := services.NewAuditorToken()
+	grant := &services.AuditorGrant{
+		TenantID:  tenant.ID,
+		Auditor:   req.Auditor,
+		Scope:     services.AuditorScope{CaseIDs: req.CaseIDs, TeamIDs: req.TeamIDs},
+		ExpiresAt: req.ExpiresAt.UTC(),
+	}
+	if grant.Scope.CaseIDs == nil {
+		grant.Scope.CaseIDs = []string{}
+	}
+	if grant.Scope.TeamIDs == nil {
+		grant.Scope.TeamIDs = []string{}
+	}
+	if err == nil {
+		err = s.store.CreateAuditorGrant(grant, digest)
+	}
+	if err != nil {
+		log.Printf("Failed to create auditor grant for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create auditor grant",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Granted auditor %s access to %d cases and %d teams of tenant %s until %s (grant %s)",
+		grant.Auditor, len(grant.Scope.CaseIDs), len(grant.Scope.TeamIDs), tenant.Slug, grant.ExpiresAt.Format(time.RFC3339), grant.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"grant":  grant,
+		"token":  token,
+		"status": "success",
+	})
+}
+
+// getAuditorGrants lists a tenant's auditor grants, newest first
+func (s *Server) getAuditorGrants(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	var grants []*services.AuditorGrant
+	if err == nil {
+		grants, err = s.store.GetAuditorGrants(tenant.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to list auditor grants of tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve auditor grants",
+			"status": "error",
+		})
+		return
+	}
+
+	now := time.Now()
+	active := 0
+	for _, grant := range grants {
+		if grant.Active(now) {
+			active++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"grants": grants,
+		"total":  len(grants),
+		"active": active,
+		"status": "success",
+	})
+}
+
+// revokeAuditorGrant ends an auditor grant at once
+func (s *Server) revokeAuditorGrant(c *gin.Context) {
+	grant, err := s.store.RevokeAuditorGrant(c.Param("id"), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Auditor grant not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to revoke auditor grant %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to revoke auditor grant",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Revoked auditor grant %s of %s", grant.ID, grant.Auditor)
+
+	c.JSON(http.StatusOK, gin.H{
+		"grant":  grant,
+		"status": "success",
+	})
+}
+
+// requireAuditorGrant only lets through requests bearing the token of an
+// active auditor grant, and adds every request, refused ones included, to
+// the audit log
+func (s *Server) requireAuditorGrant(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	var grant *services.AuditorGrant
+	if strings.HasPrefix(token, services.AuditorTokenPrefix) {
+		var err error
+		grant, err = s.store.GetAuditorGrantByToken(services.TokenDigest(token))
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to look up auditor grant: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to verify auditor token",
+				"status": "error",
+			})
+			return
+		}
+	}
+	if grant == nil || !grant.Active(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":  "Invalid, expired or revoked auditor token",
+			"status": "error",
+		})
+		s.recordAuditorAccess(c, grant)
+		return
+	}
+
+	c.Set(auditorGrantKey, grant)
+	c.Next()
+	s.recordAuditorAccess(c, grant)
+}
+
+// recordAuditorAccess adds an auditor request to the audit log. Requests
+// answered with an error are recorded as denied.
+func (s *Server) recordAuditorAccess(c *gin.Context, grant *services.AuditorGrant) {
+	access := &services.AuditorAccess{
+		Action:       services.AuditActionAuditorAccess,
+		ResourceType: "auditor_grant",
+		At:           time.Now(),
+		Details: services.Metadata{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": c.Writer.Status(),
+		},
+	}
+	if c.Writer.Status() >= http.StatusBadRequest {
+		access.Action = services.AuditActionAuditorDenied
+	}
+	if ip := c.ClientIP(); ip != "" {
+		access.IPAddress = &ip
+	}
+	if grant != nil {
+		access.GrantID = grant.ID
+		access.ResourceID = &grant.ID
+		access.Details["grant_id"] = grant.ID
+		access.Details["tenant_id"] = grant.TenantID
+		access.Details["auditor"] = grant.Auditor
+	}
+	// The resource the request was about, when its ID is well formed
+	route := c.FullPath()
+	switch {
+	case services.IsUUID(c.Param("evidence_id")):
+		access.ResourceType, access.ResourceID = "evidence", stringPtr(c.Param("evidence_id"))
+	case strings.Contains(route, "/cases/") && services.IsUUID(c.Param("id")):
+		access.ResourceType, access.ResourceID = "case", stringPtr(c.Param("id"))
+	case strings.Contains(route, "/documents/") && services.IsUUID(c.Param("id")):
+		access.ResourceType, access.ResourceID = "document", stringPtr(c.Param("id"))
+	}
+	if watermark, ok := c.Get(auditorWatermarkKey); ok {
+		access.Details["watermark"] = watermark
+	}
+
+	if err := s.store.RecordAuditorAccess(access); err != nil {
+		log.Printf("Failed to audit auditor request %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+// requestGrant is the auditor grant of a request that passed
+// requireAuditorGrant
+func requestGrant(c *gin.Context) *services.AuditorGrant {
+	return c.MustGet(auditorGrantKey).(*services.AuditorGrant)
+}
+
+// getAuditorGrant describes the requesting auditor's grant
+func (s *Server) getAuditorGrant(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"grant":  requestGrant(c),
+		"status": "success",
+	})
+}
+
+// getAuditorCases lists the cases of the auditor's grant
+func (s *Server) getAuditorCases(c *gin.Context) {
+	grant := requestGrant(c)
+	cases := []*services.Alert{}
+	for _, id := range grant.Scope.CaseIDs {
+		alert, err := s.store.GetAlert(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to load case %s for auditor grant %s: %v", id, grant.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to retrieve cases",
+				"status": "error",
+			})
+			return
+		}
+		cases = append(cases, alert)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cases":  cases,
+		"total":  len(cases),
+		"status": "success",
+	})
+}
+
+// auditorCase wraps a case handler so it only serves the cases of the
+// auditor's grant. Other cases are reported missing, so their IDs reveal
+// nothing.
+func (s *Server) auditorCase(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requestGrant(c).HasCase(c.Param("id")) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Case not found",
+				"status": "error",
+			})
+			return
+		}
+		handler(c)
+	}
+}
+
+// getAuditorEvidenceFile downloads a file attached to a granted case, with
+// the watermark of the download
+func (s *Server) getAuditorEvidenceFile(c *gin.Context) {
+	var params caseEvidenceParams
+	if !bindURI(c, &params) {
+		return
+	}
+	evidence, err := s.store.GetCaseEvidence(params.ID, params.EvidenceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Evidence not found",
+			"status": "error",
+		})
+		return
+	}
+	var reader io.ReadCloser
+	if err == nil {
+		reader, err = s.openEvidenceFile(c.Request.Context(), evidence)
+	}
+	if err != nil {
+		log.Printf("Failed to fetch evidence %s of case %s: %v", params.EvidenceID, params.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Failed to fetch evidence from storage",
+			"status": "error",
+		})
+		return
+	}
+	defer reader.Close()
+	s.sendWatermarked(c, reader, evidence.MimeType, evidence.Filename)
+}
+
+// getAuditorDocuments lists the documents of the grant's team collections.
+// The documents of granted cases are named by the cases.
+func (s *Server) getAuditorDocuments(c *gin.Context) {
+	var page struct {
+		Limit  int `form:"limit" binding:"omitempty,min=1,max=100"`
+		Offset int `form:"offset" binding:"omitempty,min=0"`
+	}
+	if !bindQuery(c, &page) {
+		return
+	}
+	if page.Limit == 0 {
+		page.Limit = 10
+	}
+
+	grant := requestGrant(c)
+	documents, err := s.store.GetDocuments(page.Limit, page.Offset, nil, services.SubmissionFilter{}, grant.DocumentScope())
+	if err != nil {
+		log.Printf("Failed to list documents for auditor grant %s: %v", grant.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve documents",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents": documents,
+		"total":     len(documents),
+		"status":    "success",
+	})
+}
+
+// auditorDocument loads the document named by the :id parameter when the
+// auditor's grant covers it, through a granted team or a granted case it
+// is linked to, responding otherwise
+func (s *Server) auditorDocument(c *gin.Context) (*services.Document, bool) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return nil, false
+	}
+	grant := requestGrant(c)
+	document, err := s.store.GetDocument(documentID)
+	allowed := err == nil && grant.DocumentScope().Allows(document)
+	for _, id := range grant.Scope.CaseIDs {
+		if allowed || err != nil {
+			break
+		}
+		allowed, err = s.caseLinksDocument(id, document)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to check document %s for auditor grant %s: %v", documentID, grant.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document",
+			"status": "error",
+		})
+		return nil, false
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return nil, false
+	}
+	return document, true
+}
+
+// getAuditorDocument returns a document the auditor's grant covers
+func (s *Server) getAuditorDocument(c *gin.Context) {
+	document, ok := s.auditorDocument(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"document": document,
+		"status":   "success",
+	})
+}
+
+// getAuditorDocumentFile downloads the file of a document the auditor's
+// grant covers, with the watermark of the download
+func (s *Server) getAuditorDocumentFile(c *gin.Context) {
+	document, ok := s.auditorDocument(c)
+	if !ok {
+		return
+	}
+	reader, err := s.openDocumentFile(c.Request.Context(), document)
+	if err != nil {
+		log.Printf("Failed to fetch document %s for an auditor: %v", document.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Failed to fetch document from storage",
+			"status": "error",
+		})
+		return
+	}
+	defer reader.Close()
+	s.sendWatermarked(c, reader, document.MimeType, document.OriginalFilename)
+}
+
+// sendWatermarked sends a file to the requesting auditor with a new
+// watermark. X-FraudDocAI-Watermark names it on every download, and
+// X-FraudDocAI-Watermark-Embedded tells whether it is in the file too.
+func (s *Server) sendWatermarked(c *gin.Context, reader io.Reader, mimeType, filename string) {
+	watermark, err := services.NewWatermark(requestGrant(c), time.Now())
+	var content []byte
+	if err == nil {
+		content, err = io.ReadAll(reader)
+	}
+	if err != nil {
+		log.Printf("Failed to watermark %s: %v", filename, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to prepare file",
+			"status": "error",
+		})
+		return
+	}
+	content, embedded := watermark.Apply(mimeType, content)
+	c.Set(auditorWatermarkKey, watermark.ID)
+
+	c.Header("X-FraudDocAI-Watermark", watermark.Text())
+	c.Header("X-FraudDocAI-Watermark-Embedded", strconv.FormatBool(embedded))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, mimeType, content)
+}
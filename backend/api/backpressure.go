@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+const (
+	// etaWindow is how far back finished pipelines are counted to measure
+	// how fast the queue drains
+	etaWindow = 5 * time.Minute
+
+	// assumedPipelineDuration stands in for the measured rate when no
+	// pipeline finished within etaWindow
+	assumedPipelineDuration = 10 * time.Second
+)
+
+// queueETA estimates when the document's queued pipeline finishes: the
+// jobs ahead of it, the running ones included, and its own, at the rate
+// pipelines finished within etaWindow across all replicas. ok is false when
+// the document has no queued job or the queue cannot be read.
+func (s *Server) queueETA(documentID services.DocumentID) (eta time.Duration, backlog *services.PipelineBacklog, ok bool) {
+	ahead, queued, err := s.store.GetPipelineQueuePosition(documentID)
+	if err == nil && queued {
+		backlog, err = s.store.GetPipelineBacklog(etaWindow)
+	}
+	if err != nil {
+		log.Printf("Failed to estimate the analysis time of document %s: %v", documentID, err)
+		return 0, nil, false
+	}
+	if !queued {
+		return 0, nil, false
+	}
+
+	perSecond := float64(backlog.Finished) / etaWindow.Seconds()
+	if backlog.Finished == 0 {
+		perSecond = float64(max(s.pipeline.Workers, 1)) / assumedPipelineDuration.Seconds()
+	}
+	pending := float64(ahead + backlog.Running + 1)
+	return time.Duration(pending / perSecond * float64(time.Second)), backlog, true
+}
+
+// etaSeconds rounds an ETA up to whole seconds for responses and
+// Retry-After headers
+func etaSeconds(eta time.Duration) int {
+	return max(1, int(math.Ceil(eta.Seconds())))
+}
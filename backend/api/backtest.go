@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults of a backtest that does not set them
+const (
+	defaultBacktestDays      = 90
+	defaultBacktestFlagLevel = "high"
+)
+
+// backtestRequest is the body of POST /tenants/:slug/backtest. The
+// provider, taxonomy and channel weights left out are the tenant's own; an
+// empty channel_weights object backtests without any.
+type backtestRequest struct {
+	Provider       *string                 `json:"provider" binding:"omitempty,notblank"`
+	RiskTaxonomy   *services.RiskTaxonomy  `json:"risk_taxonomy"`
+	ChannelWeights services.ChannelWeights `json:"channel_weights"`
+	FlagLevel      string                  `json:"flag_level" binding:"omitempty,notblank"`
+	Days           int                     `json:"days" binding:"omitempty,min=1,max=365"`
+	Sample         int                     `json:"sample" binding:"omitempty,min=1,max=500"`
+	Seed           int64                   `json:"seed"`
+}
+
+// backtestTenantScoring re-scores a sample of the tenant's reviewed
+// documents of the last days with a proposed analyzer provider and scoring,
+// and reports the precision and recall of its flags against reviewers'
+// outcomes, next to those of the documents' stored scores. Stored scores
+// and risk levels are left as they are. The seed in the response draws the
+// same sample again, so that proposals can be compared.
+func (s *Server) backtestTenantScoring(c *gin.Context) {
+	var req backtestRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Days == 0 {
+		req.Days = defaultBacktestDays
+	}
+	if req.Sample == 0 {
+		req.Sample = services.DefaultBacktestSample
+	}
+	if req.Seed == 0 {
+		req.Seed = time.Now().UnixNano()
+	}
+	if req.FlagLevel == "" {
+		req.FlagLevel = defaultBacktestFlagLevel
+	}
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	current := &services.BacktestScoring{RiskTaxonomy: tenant.Taxonomy(), FlagLevel: req.FlagLevel}
+	proposed := &services.BacktestScoring{
+		RiskTaxonomy:   req.RiskTaxonomy,
+		ChannelWeights: req.ChannelWeights,
+		FlagLevel:      req.FlagLevel,
+	}
+	if proposed.RiskTaxonomy == nil {
+		proposed.RiskTaxonomy = current.RiskTaxonomy
+	}
+	if proposed.ChannelWeights == nil {
+		proposed.ChannelWeights = tenant.ChannelWeights
+	}
+	var problems []string
+	// Without a proposed taxonomy the two only differ in channel weights
+	if err := current.Validate(); err != nil && req.RiskTaxonomy != nil {
+		for _, problem := range err.(*services.BacktestError).Problems {
+			problems = append(problems, "current "+problem)
+		}
+	}
+	if err := proposed.Validate(); err != nil {
+		problems = append(problems, err.(*services.BacktestError).Problems...)
+	}
+	currentAnalyzer := s.analyzers.ForTenant(tenant.Slug)
+	analyzer := currentAnalyzer
+	if req.Provider != nil {
+		if analyzer, err = s.analyzers.Named(*req.Provider); err != nil {
+			problems = append(problems, "provider: "+err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid backtest",
+			"problems": problems,
+			"status":   "error",
+		})
+		return
+	}
+
+	until := time.Now().UTC()
+	since := until.AddDate(0, 0, -req.Days)
+	corpus, err := s.store.GetBacktestCorpus(tenant.ID, since, req.Sample, req.Seed)
+	if err != nil {
+		log.Printf("Failed to sample documents of tenant %s to backtest: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to run backtest",
+			"status": "error",
+		})
+		return
+	}
+
+	baseline := services.NewBacktestMetrics(current.RiskTaxonomy)
+	candidate := services.NewBacktestMetrics(proposed.RiskTaxonomy)
+	failed := 0
+	for _, sampled := range corpus.Documents {
+		text := *sampled.Document.ExtractedText
+		analysis, err := s.backtestAnalysis(c.Request.Context(), analyzer, text)
+		if errors.Is(err, services.ErrAIServiceUnavailable) || err == nil && analysis.Fallback {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":  "The analyzer provider is unavailable; backtests do not use fallback scores",
+				"status": "error",
+			})
+			return
+		}
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Backtest scoring of document %s failed: %v", sampled.Document.ID, err)
+			failed++
+			continue
+		}
+
+		score := services.NewFraudAnalysis(text, analysis, proposed.RiskTaxonomy).FraudScore
+		level, flagged := proposed.Classify(score, sampled.Channel)
+		candidate.Add(level.Name, flagged, sampled.Fraud)
+
+		// Stored scores are already weighted by the channel
+		stored := 0.0
+		if sampled.Document.FraudScore != nil {
+			stored = *sampled.Document.FraudScore
+		}
+		level, flagged = current.Classify(stored, "")
+		baseline.Add(level.Name, flagged, sampled.Fraud)
+	}
+	log.Printf("Backtested %s on %d documents of tenant %s (seed %d)", analyzer.Name(), len(corpus.Documents), tenant.Slug, corpus.Seed)
+
+	confirmed := 0
+	for _, sampled := range corpus.Documents {
+		if sampled.Fraud {
+			confirmed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":   tenant.Slug,
+		"since":    since,
+		"until":    until,
+		"reviewed": corpus.Reviewed,
+		"sample":   len(corpus.Documents),
+		"seed":     corpus.Seed,
+		"fraud":    confirmed,
+		"failed":   failed,
+		"current": gin.H{
+			"provider":      currentAnalyzer.Name(),
+			"model_version": currentAnalyzer.ModelVersion(),
+			"metrics":       baseline,
+		},
+		"candidate": gin.H{
+			"provider":      analyzer.Name(),
+			"model_version": analyzer.ModelVersion(),
+			"metrics":       candidate,
+		},
+		"flag_level": req.FlagLevel,
+		"status":     "success",
+	})
+}
+
+// backtestAnalysis scores text with analyzer, reusing and filling the
+// analysis cache as the pipeline does
+func (s *Server) backtestAnalysis(ctx context.Context, analyzer services.Analyzer, text string) (*services.AnalyzeTextResponse, error) {
+	cacheKey := ""
+	if ttl := s.analyzers.CacheTTL(); ttl > 0 {
+		cacheKey = services.AnalysisCacheKey(analyzer, text)
+		cached, err := s.store.GetCachedAnalysis(cacheKey, time.Now().Add(-ttl))
+		if err != nil {
+			log.Printf("Failed to look up cached analysis: %v", err)
+		}
+		if cached != nil {
+			metrics.AnalysisCache.WithLabelValues("hit").Inc()
+			return cached, nil
+		}
+		metrics.AnalysisCache.WithLabelValues("miss").Inc()
+	}
+
+	analysis, err := analyzer.Analyze(ctx, services.AnalyzeTextRequest{Text: text})
+	if err != nil {
+		return nil, err
+	}
+	s.cacheAnalysis(cacheKey, analyzer, analysis)
+	return analysis, nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createBackup backs up the database rows and stored files of the listed
+// tenants
+func (s *Server) createBackup(c *gin.Context) {
+	var req struct {
+		Tenants []string `json:"tenants" binding:"required,min=1,dive,notblank"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	for _, slug := range req.Tenants {
+		if _, err := s.store.GetTenantBySlug(slug); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Unknown tenant " + slug,
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	manifest, err := s.backups.Create(c.Request.Context(), req.Tenants)
+	if err != nil {
+		log.Printf("Backup of tenants %v failed: %v", req.Tenants, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Backup failed",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Created backup %s of tenants %v", manifest.ID, manifest.Tenants)
+	c.JSON(http.StatusCreated, gin.H{
+		"backup": manifest,
+		"status": "success",
+	})
+}
+
+func (s *Server) getBackups(c *gin.Context) {
+	manifests, err := s.backups.List()
+	if err != nil {
+		log.Printf("Failed to list backups: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to list backups",
+			"status": "error",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"backups": manifests,
+		"count":   len(manifests),
+		"status":  "success",
+	})
+}
+
+// verifyBackup checks a backup's files against its manifest
+func (s *Server) verifyBackup(c *gin.Context) {
+	manifest, err := s.backups.Verify(c.Param("id"))
+	if err != nil {
+		respondBackupError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"backup": manifest,
+		"valid":  true,
+		"status": "success",
+	})
+}
+
+// restoreBackup restores a verified backup into this environment. The
+// backup's tenants must not exist yet.
+func (s *Server) restoreBackup(c *gin.Context) {
+	restore, err := s.backups.Restore(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondBackupError(c, err)
+		return
+	}
+	log.Printf("Restored backup %s of tenants %v", restore.ID, restore.Tenants)
+	c.JSON(http.StatusOK, gin.H{
+		"restore": restore,
+		"status":  "success",
+	})
+}
+
+func respondBackupError(c *gin.Context, err error) {
+	var verifyErr *services.BackupVerificationError
+	switch {
+	case errors.Is(err, services.ErrBackupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Backup not found",
+			"status": "error",
+		})
+	case errors.As(err, &verifyErr):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "Backup failed verification",
+			"problems": verifyErr.Problems,
+			"valid":    false,
+			"status":   "error",
+		})
+	case errors.Is(err, services.ErrSnapshotConflict), errors.Is(err, services.ErrUnknownStorageRegion):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+	default:
+		log.Printf("Backup request failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Backup request failed",
+			"status": "error",
+		})
+	}
+}
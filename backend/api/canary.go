@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCanaryReportDays is how far back canary reports look by default
+const defaultCanaryReportDays = 7
+
+// compareWithCanary scores a sampled document with the canary AI service in
+// the background and records how its result compares with the stable
+// result stored on the document. Only analyses by the AI service are
+// compared; fallback results say nothing about the stable version.
+func (s *Server) compareWithCanary(document *services.Document, text string, stable *services.FraudAnalysis) {
+	if s.canary == nil || stable.Provider != services.ProviderFastAPI || stable.Fallback || !s.canary.Sampled() {
+		return
+	}
+	if !s.canary.Acquire() {
+		metrics.CanaryComparisons.WithLabelValues("skipped").Inc()
+		return
+	}
+
+	go func() {
+		defer s.canary.Release()
+		comparison := &services.CanaryComparison{
+			DocumentID:      document.ID,
+			StableVersion:   stable.ModelVersion,
+			CanaryVersion:   s.canary.ModelVersion(),
+			StableScore:     stable.FraudScore,
+			StableRiskLevel: stable.RiskLevel,
+		}
+		analysis, latency, err := s.canary.Analyze(context.Background(), text)
+		comparison.CanaryLatency = latency
+		var result *services.FraudAnalysis
+		if err == nil {
+			result, err = s.newFraudAnalysis(document, text, analysis)
+		}
+		outcome := "failed"
+		if err != nil {
+			log.Printf("Canary analysis of document %s failed: %v", document.ID, err)
+			message := err.Error()
+			comparison.Error = &message
+		} else {
+			comparison.CanaryScore = &result.FraudScore
+			comparison.CanaryRiskLevel = &result.RiskLevel
+			outcome = "disagreed"
+			if result.RiskLevel == stable.RiskLevel {
+				outcome = "agreed"
+			}
+		}
+		metrics.CanaryComparisons.WithLabelValues(outcome).Inc()
+		if err := s.store.RecordCanaryComparison(comparison); err != nil {
+			log.Printf("Failed to record canary comparison of document %s: %v", document.ID, err)
+		}
+	}()
+}
+
+// getCanaryReport compares the canary and stable scores of the documents
+// compared over the last days, by pair of versions, and whether each
+// canary version is ready for cutover. Reports are kept for canary versions
+// no longer deployed, so that a rollout can be reviewed after cutover.
+func (s *Server) getCanaryReport(c *gin.Context) {
+	var query struct {
+		Days int `form:"days" binding:"omitempty,min=1,max=365"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	if query.Days == 0 {
+		query.Days = defaultCanaryReportDays
+	}
+
+	cfg := config.GetCanaryConfig()
+	canary := gin.H{"enabled": false}
+	if s.canary != nil {
+		cfg = s.canary.Config()
+		canary = gin.H{
+			"enabled":       true,
+			"model_version": s.canary.ModelVersion(),
+			"percent":       cfg.Percent,
+		}
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -query.Days)
+	reports, err := s.store.GetCanaryReports(since, cfg.ScoreTolerance)
+	if err != nil {
+		log.Printf("Failed to compute canary reports: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute canary reports",
+			"status": "error",
+		})
+		return
+	}
+	if reports == nil {
+		reports = []*services.CanaryReport{}
+	}
+	for _, report := range reports {
+		report.Assess(cfg)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":   since,
+		"canary":  canary,
+		"reports": reports,
+		"thresholds": gin.H{
+			"score_tolerance": cfg.ScoreTolerance,
+			"min_comparisons": cfg.MinComparisons,
+			"min_agreement":   cfg.MinAgreement,
+			"max_error_rate":  cfg.MaxErrorRate,
+		},
+		"status": "success",
+	})
+}
@@ -0,0 +1,522 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxEvidenceDescription bounds the description of attached evidence
+const maxEvidenceDescription = 2000
+
+// maxThumbnailSource bounds the images read to show as thumbnails in case
+// summaries
+const maxThumbnailSource = 20 << 20
+
+// caseAlert loads the alert of the case named by the :id parameter,
+// responding when there is none, and returns the scope of the documents the
+// request may see. A case is an alert with the documents linked to it: the
+// one it was raised on and the known-fraud exemplar it matched. Cases of
+// another tenant than the request's are reported missing.
+func (s *Server) caseAlert(c *gin.Context) (*services.Alert, services.DocumentScope, bool) {
+	_, scope, err := s.requestScope(c)
+	if err != nil {
+		respondScopeError(c, err)
+		return nil, scope, false
+	}
+
+	alert, err := s.store.GetAlert(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !scope.AllowsTenant(alert.TenantID)) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Case not found",
+			"status": "error",
+		})
+		return nil, scope, false
+	}
+	if err != nil {
+		log.Printf("Failed to retrieve case %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve case",
+			"status": "error",
+		})
+		return nil, scope, false
+	}
+	return alert, scope, true
+}
+
+// caseDocuments are the IDs of the documents linked to the case
+func caseDocuments(src services.SARSources) []services.DocumentID {
+	documents := []services.DocumentID{}
+	for _, doc := range []*services.Document{src.Document, src.Exemplar} {
+		if doc != nil {
+			documents = append(documents, doc.ID)
+		}
+	}
+	return documents
+}
+
+// caseLinksDocument reports whether the document is linked to the case: it
+// is the one the alert was raised on or the exemplar it matched
+func (s *Server) caseLinksDocument(alertID string, document *services.Document) (bool, error) {
+	alert, err := s.store.GetAlert(alertID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (alert.TenantID == nil || document.TenantID == nil || *alert.TenantID != *document.TenantID)) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if alert.DocumentID != nil && *alert.DocumentID == document.ID {
+		return true, nil
+	}
+	if alert.ExemplarID == nil {
+		return false, nil
+	}
+	exemplar, err := s.store.GetExemplar(*alert.ExemplarID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return exemplar.DocumentID != nil && *exemplar.DocumentID == document.ID, nil
+}
+
+// getCaseTimeline returns the chronological timeline of an investigation.
+// The SAR draft of a confirmed fraud case is drafted from the same events.
+// Events of linked documents outside the request's scope are left out.
+func (s *Server) getCaseTimeline(c *gin.Context) {
+	alert, scope, ok := s.caseAlert(c)
+	if !ok {
+		return
+	}
+	src, err := s.sarSources(alert, scope)
+	if err != nil {
+		log.Printf("Failed to build timeline of case %s: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to build case timeline",
+			"status": "error",
+		})
+		return
+	}
+	timeline := services.CaseTimeline(src)
+
+	c.JSON(http.StatusOK, gin.H{
+		"case_id":   alert.ID,
+		"alert":     alert,
+		"documents": caseDocuments(src),
+		"timeline":  timeline,
+		"total":     len(timeline),
+		"status":    "success",
+	})
+}
+
+// getCaseSummaryPDF exports a print-ready summary of an investigation for
+// managers: the case, its documents with thumbnails of those that are
+// images, the explanations of their fraud scores, the reviewers' decisions
+// and the timeline. Linked documents outside the request's scope are left
+// out with their thumbnails. A thumbnail that cannot be read is left out
+// rather than failing the summary.
+func (s *Server) getCaseSummaryPDF(c *gin.Context) {
+	alert, scope, ok := s.caseAlert(c)
+	if !ok {
+		return
+	}
+	src, err := s.sarSources(alert, scope)
+	if err != nil {
+		log.Printf("Failed to build summary of case %s: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to build case summary",
+			"status": "error",
+		})
+		return
+	}
+
+	summary := &services.CaseSummary{
+		SARSources: src,
+		Analyses:   map[services.DocumentID]*services.DocumentAnalysis{},
+		Thumbnails: map[services.DocumentID][]byte{},
+	}
+	for _, document := range []*services.Document{src.Document, src.Exemplar} {
+		if document == nil {
+			continue
+		}
+		analysis, err := s.store.GetDocumentAnalysis(document.ID)
+		if err != nil {
+			log.Printf("Failed to build summary of case %s: %v", alert.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to build case summary",
+				"status": "error",
+			})
+			return
+		}
+		summary.Analyses[document.ID] = analysis
+		if !services.CanThumbnail(document.MimeType) || document.FileSize > maxThumbnailSource {
+			continue
+		}
+		content, err := s.readThumbnailSource(c.Request.Context(), document)
+		if err != nil {
+			log.Printf("Failed to read thumbnail of document %s for case %s: %v", document.ID, alert.ID, err)
+			continue
+		}
+		summary.Thumbnails[document.ID] = content
+	}
+
+	localizer := s.requestLocalizer(c)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="case-%s-summary.pdf"`, alert.ID))
+	c.Header("Content-Language", localizer.Language)
+	c.Data(http.StatusOK, "application/pdf", summary.PDF(time.Now(), localizer))
+}
+
+// readThumbnailSource reads the original file of an image document, from
+// the archive when it was archived
+func (s *Server) readThumbnailSource(ctx context.Context, document *services.Document) ([]byte, error) {
+	reader, err := s.openDocumentFile(ctx, document)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(io.LimitReader(reader, maxThumbnailSource))
+}
+
+// attachCaseEvidence attaches a file that is not a document to analyze,
+// such as a screenshot, a bank's confirmation or an email, to a case for the
+// X-User analyst. The file is stored under the case in the storage region
+// of the alert's tenant.
+func (s *Server) attachCaseEvidence(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+
+	file, header, ok := s.uploadedFile(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	var description *string
+	if value := strings.TrimSpace(c.PostForm("description")); value != "" {
+		if len(value) > maxEvidenceDescription {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  fmt.Sprintf("description must be at most %d characters", maxEvidenceDescription),
+				"status": "error",
+			})
+			return
+		}
+		description = &value
+	}
+	filename := bundleFilename(header.Filename)
+	if len(filename) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "File name must be at most 255 characters",
+			"status": "error",
+		})
+		return
+	}
+
+	alert, _, ok := s.caseAlert(c)
+	if !ok {
+		return
+	}
+	var tenant *services.Tenant
+	if alert.TenantID != nil {
+		var err error
+		if tenant, err = s.store.GetTenant(*alert.TenantID); err != nil {
+			log.Printf("Failed to load tenant of case %s: %v", alert.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to retrieve case",
+				"status": "error",
+			})
+			return
+		}
+	}
+	region, storage, err := s.tenantStorage(tenant)
+	if err != nil {
+		log.Printf("Failed to select storage region: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Storage region unavailable",
+			"status": "error",
+		})
+		return
+	}
+
+	contentSHA256, err := hashReader(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to read uploaded file",
+			"status": "error",
+		})
+		return
+	}
+	contentType := header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = "application/octet-stream"
+		if byExtension := mime.TypeByExtension(path.Ext(filename)); byExtension != "" {
+			contentType = byExtension
+		}
+	}
+
+	// The record comes first: a file stored without one would be taken for
+	// a document by the bucket reconciler
+	evidence := &services.CaseEvidence{
+		TenantID:      alert.TenantID,
+		AlertID:       alert.ID,
+		Filename:      filename,
+		ObjectName:    services.CaseEvidenceObjectName(alert.ID, contentSHA256),
+		StorageRegion: &region,
+		MimeType:      contentType,
+		FileSize:      header.Size,
+		SHA256:        contentSHA256,
+		Description:   description,
+		UploadedBy:    &user.ID,
+	}
+	err = s.store.CreateCaseEvidence(evidence)
+	if errors.Is(err, services.ErrEvidenceExists) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "The file is already attached to the case",
+			"sha256": contentSHA256,
+			"status": "error",
+		})
+		return
+	}
+	if err == nil {
+		err = storage.UploadFile(context.Background(), evidence.ObjectName, file, header.Size, contentType)
+		if err != nil {
+			if deleteErr := s.store.DeleteCaseEvidence(evidence.ID); deleteErr != nil {
+				log.Printf("Failed to remove record of unstored evidence %s: %v", evidence.ID, deleteErr)
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to attach evidence to case %s: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to attach evidence",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("User %s attached evidence %s to case %s", user.ID, evidence.ID, alert.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"evidence": evidence,
+		"status":   "success",
+	})
+}
+
+// getCaseEvidence lists the files attached to a case with who attached them
+func (s *Server) getCaseEvidence(c *gin.Context) {
+	alert, _, ok := s.caseAlert(c)
+	if !ok {
+		return
+	}
+	evidence, err := s.store.GetCaseEvidenceList(alert.ID)
+	if err != nil {
+		log.Printf("Failed to list evidence of case %s: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to list case evidence",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"evidence": evidence,
+		"total":    len(evidence),
+		"status":   "success",
+	})
+}
+
+type caseEvidenceParams struct {
+	ID         string `uri:"id" binding:"required,uuid"`
+	EvidenceID string `uri:"evidence_id" binding:"required,uuid"`
+}
+
+// getCaseEvidenceFile downloads a file attached to a case
+func (s *Server) getCaseEvidenceFile(c *gin.Context) {
+	var params caseEvidenceParams
+	if !bindURI(c, &params) {
+		return
+	}
+	alert, _, ok := s.caseAlert(c)
+	if !ok {
+		return
+	}
+	evidence, err := s.store.GetCaseEvidence(alert.ID, params.EvidenceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Evidence not found",
+			"status": "error",
+		})
+		return
+	}
+	var reader io.ReadCloser
+	if err == nil {
+		reader, err = s.openEvidenceFile(c.Request.Context(), evidence)
+	}
+	if err != nil {
+		log.Printf("Failed to fetch evidence %s of case %s: %v", params.EvidenceID, alert.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Failed to fetch evidence from storage",
+			"status": "error",
+		})
+		return
+	}
+	defer reader.Close()
+
+	c.DataFromReader(http.StatusOK, evidence.FileSize, evidence.MimeType, reader, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": evidence.Filename}),
+	})
+}
+
+// openEvidenceFile reads an attached file from the region it was stored in
+func (s *Server) openEvidenceFile(ctx context.Context, evidence *services.CaseEvidence) (io.ReadCloser, error) {
+	region := ""
+	if evidence.StorageRegion != nil {
+		region = *evidence.StorageRegion
+	}
+	store, err := s.storage.ForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetFile(ctx, evidence.ObjectName)
+}
+
+// exportCaseBundle streams a zip bundle of everything on a case, for
+// investigators, law enforcement or a SAR filing: the alert, its timeline,
+// the latest SAR draft if there is one, each linked document with its
+// analysis, detections, entities, events and file, and the attached
+// evidence. Linked documents outside the request's scope are left out.
+// manifest.json, written last, lists the files with their SHA-256
+// and any part that could not be exported.
+func (s *Server) exportCaseBundle(c *gin.Context) {
+	alert, scope, ok := s.caseAlert(c)
+	if !ok {
+		return
+	}
+	src, err := s.sarSources(alert, scope)
+	var draft *services.SARDraft
+	if err == nil {
+		draft, err = s.store.GetSARDraft(alert.ID, 0)
+		if errors.Is(err, sql.ErrNoRows) {
+			draft, err = nil, nil
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to gather case %s for its bundle: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to export case",
+			"status": "error",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="case-%s.zip"`, alert.ID))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	bundle := zip.NewWriter(c.Writer)
+	var problems []string
+	problem := func(part string, err error) {
+		log.Printf("Bundle of case %s: %s: %v", alert.ID, part, err)
+		problems = append(problems, fmt.Sprintf("%s: %v", part, err))
+	}
+
+	if err := writeBundleJSON(bundle, "case.json", alert); err != nil {
+		problem("case", err)
+	}
+	if err := writeBundleJSON(bundle, "timeline.json", services.CaseTimeline(src)); err != nil {
+		problem("timeline", err)
+	}
+	if draft != nil {
+		if err := writeBundleJSON(bundle, "sar.json", draft); err != nil {
+			problem("SAR draft", err)
+		}
+	}
+
+	documents := []gin.H{}
+	for _, doc := range []*services.Document{src.Document, src.Exemplar} {
+		if doc == nil {
+			continue
+		}
+		file, err := s.exportBundleDocument(c.Request.Context(), bundle, doc)
+		if err != nil {
+			problem("document "+doc.ID.String(), err)
+		}
+		documents = append(documents, gin.H{
+			"id":                doc.ID,
+			"original_filename": doc.OriginalFilename,
+			"sha256":            doc.ContentSHA256,
+			"file":              file,
+		})
+	}
+
+	evidence := []gin.H{}
+	for _, item := range src.Evidence {
+		file := "evidence/" + item.ID + "/" + item.Filename
+		if err := s.exportBundleEvidence(c.Request.Context(), bundle, item, file); err != nil {
+			problem("evidence "+item.ID, err)
+			file = ""
+		}
+		evidence = append(evidence, gin.H{
+			"id":          item.ID,
+			"filename":    item.Filename,
+			"description": item.Description,
+			"uploaded_by": item.UploadedBy,
+			"created_at":  item.CreatedAt,
+			"sha256":      item.SHA256,
+			"file":        file,
+		})
+	}
+
+	manifest := gin.H{
+		"case_id":      alert.ID,
+		"tenant_id":    alert.TenantID,
+		"generated_at": time.Now().UTC(),
+		"documents":    documents,
+		"evidence":     evidence,
+		"problems":     problems,
+	}
+	if draft != nil {
+		manifest["sar_version"] = draft.Version
+	}
+	if err := writeBundleJSON(bundle, "manifest.json", manifest); err != nil {
+		log.Printf("Bundle of case %s: failed to write manifest: %v", alert.ID, err)
+	}
+	if err := bundle.Close(); err != nil {
+		log.Printf("Bundle of case %s: failed to finish bundle: %v", alert.ID, err)
+	}
+	log.Printf("Exported case %s with %d documents and %d evidence files", alert.ID, len(documents), len(evidence))
+}
+
+// exportBundleEvidence copies an attached file into a bundle
+func (s *Server) exportBundleEvidence(ctx context.Context, bundle *zip.Writer, evidence *services.CaseEvidence, name string) error {
+	reader, err := s.openEvidenceFile(ctx, evidence)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %v", err)
+	}
+	defer reader.Close()
+	w, err := bundle.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return fmt.Errorf("failed to copy file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frauddocai-backend/api"
+	"frauddocai-backend/api/apitest"
+	"frauddocai-backend/services"
+)
+
+func TestCaseRoutesAreScopedToTheTenant(t *testing.T) {
+	h := apitest.New()
+	alpha := &services.Tenant{Slug: "alpha", Name: "Alpha"}
+	beta := &services.Tenant{Slug: "beta", Name: "Beta"}
+	for _, tenant := range []*services.Tenant{alpha, beta} {
+		if err := h.Store.CreateTenant(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := h.SeedDocument(func(d *services.Document) { d.TenantID = &beta.ID })
+	alert := &services.Alert{TenantID: &beta.ID, DocumentID: &doc.ID, Kind: "exemplar_match", Severity: "high"}
+	if err := h.Store.CreateAlert(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{
+		"/api/v1/cases/" + alert.ID + "/timeline",
+		"/api/v1/cases/" + alert.ID + "/summary.pdf",
+		"/api/v1/cases/" + alert.ID + "/evidence",
+		"/api/v1/cases/" + alert.ID + "/evidence/00000000-0000-4000-8000-000000000099/file",
+		"/api/v1/cases/" + alert.ID + "/bundle",
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(api.TenantHeader, "alpha")
+		if rec := h.Serve(req); rec.Code != http.StatusNotFound {
+			t.Errorf("%s by another tenant: status %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxChanges bounds the changes returned per change feed request
+const maxChanges = 1000
+
+// getChanges returns the documents and detections created, updated or
+// deleted after the since cursor, oldest first. The response's cursor is
+// passed as since to get the next changes; it is unchanged when there were
+// none. Requests with X-Tenant only see that tenant's changes.
+func (s *Server) getChanges(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	var cursor services.ChangeCursor
+	if value := c.Query("since"); value != "" {
+		if cursor, err = services.ParseChangeCursor(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a cursor returned by the change feed",
+				"status": "error",
+			})
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > maxChanges {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "limit must be between 1 and " + strconv.Itoa(maxChanges),
+			"status": "error",
+		})
+		return
+	}
+
+	changes, err := s.store.GetChanges(cursor, tenantID, limit)
+	if err != nil {
+		log.Printf("Failed to retrieve changes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve changes",
+			"status": "error",
+		})
+		return
+	}
+	if len(changes) > 0 {
+		cursor = changes[len(changes)-1].Cursor()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changes": changes,
+		"cursor":  cursor.String(),
+		"more":    len(changes) == limit,
+		"status":  "success",
+	})
+}
+
+// RunChangeFeedPurge periodically deletes the changes recorded longer than
+// retention ago. It returns when ctx is cancelled.
+func (s *Server) RunChangeFeedPurge(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			before := time.Now().Add(-retention)
+			n, err := s.store.PurgeChanges(before)
+			if err != nil {
+				log.Printf("Failed to purge change feed: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d changes from the change feed", n)
+				s.emitWebhook(services.WebhookRetentionPurged, nil, gin.H{
+					"target":  "changes",
+					"before":  before.UTC(),
+					"deleted": n,
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// putChannelWeights replaces the weights a tenant's fraud scores are
+// multiplied by per submission channel. They apply to documents analyzed or
+// re-scored from now on.
+func (s *Server) putChannelWeights(c *gin.Context) {
+	var weights services.ChannelWeights
+	if err := c.ShouldBindJSON(&weights); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must map channels to weights",
+			"status": "error",
+		})
+		return
+	}
+	s.updateChannelWeights(c, weights)
+}
+
+// deleteChannelWeights stops weighting a tenant's fraud scores by channel
+func (s *Server) deleteChannelWeights(c *gin.Context) {
+	s.updateChannelWeights(c, nil)
+}
+
+func (s *Server) updateChannelWeights(c *gin.Context, weights services.ChannelWeights) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	err = s.store.UpdateTenantChannelWeights(tenant.ID, weights)
+	var weightsErr *services.ChannelWeightsError
+	switch {
+	case errors.As(err, &weightsErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid channel weights",
+			"problems": weightsErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update channel weights for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update channel weights",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":          tenant.Slug,
+		"channel_weights": weights,
+		"status":          "success",
+	})
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reviewerFor resolves the X-User header of a request acting for a reviewer,
+// responding when it names no user
+func (s *Server) reviewerFor(c *gin.Context) (*services.User, bool) {
+	user, err := s.requestUser(c)
+	if err != nil {
+		respondScopeError(c, err)
+		return nil, false
+	}
+	if user == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  UserHeader + " header is required",
+			"status": "error",
+		})
+		return nil, false
+	}
+	return user, true
+}
+
+// createDelegation hands the requesting reviewer's queue to a colleague for
+// a period. Both are notified through the review.delegated webhook.
+func (s *Server) createDelegation(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		DelegateID string    `json:"delegate_id" binding:"required,uuid"`
+		StartsAt   time.Time `json:"starts_at" binding:"required"`
+		EndsAt     time.Time `json:"ends_at" binding:"required"`
+		Reason     *string   `json:"reason" binding:"omitempty,max=500"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !req.EndsAt.After(req.StartsAt) || !req.EndsAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "ends_at must be in the future and after starts_at",
+			"status": "error",
+		})
+		return
+	}
+	if req.DelegateID == user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "A reviewer cannot delegate to themselves",
+			"status": "error",
+		})
+		return
+	}
+
+	delegate, err := s.store.GetUser(req.DelegateID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to look up user %s: %v", req.DelegateID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create delegation",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil || !sameTenant(delegate.TenantID, user.TenantID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Unknown delegate",
+			"status": "error",
+		})
+		return
+	}
+
+	delegation := &services.Delegation{
+		DelegatorID: user.ID,
+		DelegateID:  delegate.ID,
+		StartsAt:    req.StartsAt.UTC(),
+		EndsAt:      req.EndsAt.UTC(),
+		Reason:      req.Reason,
+	}
+	if err := s.store.CreateDelegation(delegation); err != nil {
+		log.Printf("Failed to create delegation from %s to %s: %v", user.ID, delegate.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create delegation",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("User %s delegated their review queue to %s until %s", user.ID, delegate.ID, delegation.EndsAt.Format(time.RFC3339))
+	s.emitWebhook(services.WebhookReviewDelegated, user.TenantID, gin.H{
+		"delegation": delegation,
+		"delegator":  user,
+		"delegate":   delegate,
+		"notify":     []string{user.ID, delegate.ID},
+		"links":      gin.H{"delegations": s.link("/delegations")},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"delegation": delegation,
+		"status":     "success",
+	})
+}
+
+func sameTenant(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// getDelegations lists the current and upcoming delegations the requesting
+// reviewer gave or received
+func (s *Server) getDelegations(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+
+	delegations, err := s.store.GetDelegations(user.ID, time.Now())
+	if err != nil {
+		log.Printf("Failed to retrieve delegations of %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve delegations",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"delegations": delegations,
+		"total":       len(delegations),
+		"status":      "success",
+	})
+}
+
+// deleteDelegation ends one of the requesting reviewer's delegations.
+// Alerts already assigned through it stay with the delegate.
+func (s *Server) deleteDelegation(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+
+	delegation, err := s.store.GetDelegation(c.Param("id"))
+	if err == nil && delegation.DelegatorID != user.ID {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = s.store.DeleteDelegation(delegation.ID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Delegation not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to delete delegation %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to delete delegation",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Delegation deleted",
+		"status":  "success",
+	})
+}
+
+// assignAlert assigns an alert to a reviewer, or to their delegate while
+// they are away. The alert keeps who it was meant for, and the
+// alert.assigned webhook notifies both.
+func (s *Server) assignAlert(c *gin.Context) {
+	var req struct {
+		UserID string `json:"user_id" binding:"required,uuid"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if _, err := s.store.GetUser(req.UserID); errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Unknown user",
+			"status": "error",
+		})
+		return
+	} else if err != nil {
+		log.Printf("Failed to look up user %s: %v", req.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to assign alert",
+			"status": "error",
+		})
+		return
+	}
+
+	assignee, delegation, err := s.store.ResolveAssignee(req.UserID, time.Now())
+	var alert *services.Alert
+	if err == nil {
+		var original *string
+		if assignee != req.UserID {
+			original = &req.UserID
+		}
+		alert, err = s.store.AssignAlert(scopedAlert(c).ID, assignee, original)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Alert not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to assign alert %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to assign alert",
+			"status": "error",
+		})
+		return
+	}
+
+	notify := []string{assignee}
+	if alert.OriginalAssignee != nil {
+		log.Printf("Assigned alert %s to %s on behalf of %s", alert.ID, assignee, req.UserID)
+		notify = append(notify, req.UserID)
+	}
+	s.emitAlertWebhook(services.WebhookAlertAssigned, alert.ID, alert.TenantID, gin.H{
+		"alert":      alert,
+		"delegation": delegation,
+		"notify":     notify,
+		"links":      s.alertLinks(alert),
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"alert":      alert,
+		"delegation": delegation,
+		"status":     "success",
+	})
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deletedDocumentsBatch bounds the deleted documents purged per query
+const deletedDocumentsBatch = 200
+
+// deleteDocument deletes a document on behalf of the X-User user, if given.
+// The document is hidden at once and its fraud detections deleted, and its
+// file is released, which removes it from storage unless another document
+// has the same file. The purge task deletes the document for good after
+// DELETED_DOCUMENT_RETENTION. A document that must be kept, as under legal
+// hold, is refused with 409. Like every document route it answers 404 for
+// documents outside the request's scope.
+func (s *Server) deleteDocument(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	var deletedBy *string
+	if id := c.GetHeader(UserHeader); services.IsUUID(id) {
+		deletedBy = &id
+	}
+
+	document, err := s.store.DeleteDocument(documentID, deletedBy)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	case errors.Is(err, services.ErrLegalHold):
+		reasons, err := s.store.GetRetentionReasons([]services.DocumentID{documentID})
+		if err != nil {
+			log.Printf("Failed to check retention of document %s: %v", documentID, err)
+		}
+		c.JSON(http.StatusConflict, gin.H{
+			"error":            "Document must be kept and cannot be deleted",
+			"retained_because": reasons[documentID],
+			"status":           "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to delete document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to delete document",
+			"status": "error",
+		})
+		return
+	}
+	metrics.DeletedDocuments.WithLabelValues("deleted").Inc()
+
+	// The file is released even if the client disconnects, so that its
+	// reference is not leaked
+	file := "shared"
+	deleted, err := s.deleteUnreferencedObject(context.Background(), documentRegion(document), document.StorageTier, document.FilePath)
+	if err != nil {
+		// A leftover file is harmless, and is no longer served
+		log.Printf("Failed to delete file of document %s: %v", documentID, err)
+		file = "failed"
+	} else if deleted {
+		file = "deleted"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Document deleted",
+		"document_id": documentID,
+		"file":        file,
+		"purge_after": time.Now().Add(s.deletion.Retention).UTC(),
+		"status":      "success",
+	})
+}
+
+// RunDeletedDocumentPurge deletes for good, every cfg.PurgeInterval, the
+// documents deleted longer than cfg.Retention ago. It returns when ctx is
+// cancelled.
+func (s *Server) RunDeletedDocumentPurge(ctx context.Context, cfg config.DeletionConfig) {
+	ticker := time.NewTicker(cfg.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeDeletedDocuments(ctx, cfg.Retention)
+		}
+	}
+}
+
+func (s *Server) purgeDeletedDocuments(ctx context.Context, retention time.Duration) {
+	before := time.Now().Add(-retention)
+	purged := 0
+	for ctx.Err() == nil {
+		ids, err := s.store.PurgeDeletedDocuments(before, deletedDocumentsBatch)
+		purged += len(ids)
+		metrics.DeletedDocuments.WithLabelValues("purged").Add(float64(len(ids)))
+		if err != nil {
+			log.Printf("Failed to purge deleted documents: %v", err)
+			break
+		}
+		if len(ids) < deletedDocumentsBatch {
+			break
+		}
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted documents", purged)
+		s.emitWebhook(services.WebhookRetentionPurged, nil, gin.H{
+			"target":  "deleted_documents",
+			"before":  before.UTC(),
+			"deleted": purged,
+		})
+	}
+}
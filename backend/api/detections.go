@@ -0,0 +1,176 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDetectionResults caps the limit accepted by the detection listings
+const maxDetectionResults = 200
+
+// Fraud detection listing handlers
+func (s *Server) getFraudDetections(c *gin.Context) {
+	filter, err := detectionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+		return
+	}
+
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	if tenant != nil {
+		filter.TenantID = tenant.ID
+	}
+
+	s.listDetections(c, filter)
+}
+
+func (s *Server) getDocumentDetections(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	filter, err := detectionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+		return
+	}
+	filter.DocumentID = documentID
+
+	s.listDetections(c, filter)
+}
+
+// getDocumentEntities lists the URLs, emails, account numbers and other
+// entities recorded from a document's text
+func (s *Server) getDocumentEntities(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+
+	entities, err := s.store.GetDocumentEntities(documentID)
+	if err != nil {
+		log.Printf("Failed to list entities of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document entities",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"entities":    entities,
+		"total":       len(entities),
+		"status":      "success",
+	})
+}
+
+func (s *Server) listDetections(c *gin.Context, filter services.DetectionFilter) {
+	detections, err := s.store.GetFraudDetections(filter)
+	if err != nil {
+		log.Printf("Failed to list fraud detections: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve fraud detections",
+			"status": "error",
+		})
+		return
+	}
+	if detections == nil {
+		detections = []*services.DetectionRecord{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"detections": detections,
+		"total":      len(detections),
+		"limit":      filter.Limit,
+		"offset":     filter.Offset,
+		"status":     "success",
+	})
+}
+
+// detectionFilter reads the listing filters from the query string
+func detectionFilter(c *gin.Context) (services.DetectionFilter, error) {
+	filter := services.DetectionFilter{
+		PatternID:   c.Query("pattern_id"),
+		PatternType: c.Query("pattern"),
+	}
+
+	var err error
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "50")); err != nil || filter.Limit < 1 || filter.Limit > maxDetectionResults {
+		return filter, fmt.Errorf("limit must be between 1 and %d", maxDetectionResults)
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		return filter, fmt.Errorf("offset must be a non-negative integer")
+	}
+
+	for param, target := range map[string]**float64{
+		"min_confidence": &filter.MinConfidence,
+		"max_confidence": &filter.MaxConfidence,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || f > 1 {
+			return filter, fmt.Errorf("%s must be between 0 and 1", param)
+		}
+		*target = &f
+	}
+
+	if value := c.Query("reviewed"); value != "" {
+		reviewed, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("reviewed must be true or false")
+		}
+		filter.Reviewed = &reviewed
+	}
+
+	for param, target := range map[string]**time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be a date (YYYY-MM-DD) or RFC 3339 time", param)
+		}
+		*target = &t
+	}
+	return filter, nil
+}
+
+// parseQueryTime accepts an RFC 3339 timestamp or a plain date, taken as
+// midnight UTC
+func parseQueryTime(value string) (time.Time, error) {
+	return parseQueryTimeIn(value, time.UTC)
+}
+
+// parseQueryTimeIn accepts an RFC 3339 timestamp or a plain date, taken as
+// midnight in loc
+func parseQueryTimeIn(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFeedbackLabels bounds a page of the feedback label feed
+const maxFeedbackLabels = 1000
+
+// getDispositions returns the disposition codes reviewers of the X-Tenant
+// tenant choose from when closing alerts and detections
+func (s *Server) getDispositions(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	taxonomy := services.DefaultDispositionTaxonomy()
+	if tenant != nil {
+		taxonomy = tenant.Dispositions()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"codes":   taxonomy.Codes,
+		"default": tenant == nil || tenant.DispositionTaxonomy == nil,
+		"status":  "success",
+	})
+}
+
+// putDispositionTaxonomy replaces a tenant's disposition codes. Alerts and
+// detections already closed keep the code and outcome they were closed with.
+func (s *Server) putDispositionTaxonomy(c *gin.Context) {
+	var taxonomy services.DispositionTaxonomy
+	if err := c.ShouldBindJSON(&taxonomy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a disposition taxonomy",
+			"status": "error",
+		})
+		return
+	}
+	s.updateDispositionTaxonomy(c, &taxonomy)
+}
+
+// deleteDispositionTaxonomy restores the default disposition codes for a
+// tenant
+func (s *Server) deleteDispositionTaxonomy(c *gin.Context) {
+	s.updateDispositionTaxonomy(c, nil)
+}
+
+func (s *Server) updateDispositionTaxonomy(c *gin.Context, taxonomy *services.DispositionTaxonomy) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	err = s.store.UpdateTenantDispositionTaxonomy(tenant.ID, taxonomy)
+	var dispositionErr *services.DispositionError
+	switch {
+	case errors.As(err, &dispositionErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid disposition taxonomy",
+			"problems": dispositionErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update disposition taxonomy for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update disposition taxonomy",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant.DispositionTaxonomy = taxonomy
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":               tenant.Slug,
+		"disposition_taxonomy": tenant.Dispositions(),
+		"status":               "success",
+	})
+}
+
+// getDispositionReport counts the X-Tenant tenant's alerts and detections
+// closed since since (default 90 days ago) by disposition. A since date
+// starts at midnight in tz, or else the tenant's time zone, or else UTC.
+func (s *Server) getDispositionReport(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	loc, ok := statsLocation(c, tenant)
+	if !ok {
+		return
+	}
+	since := services.StartOfDay(time.Now().Add(-defaultStatsWindow), loc)
+	if value := c.Query("since"); value != "" {
+		if since, err = parseQueryTimeIn(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	counts, err := s.store.GetDispositionReport(tenantID, since)
+	if err != nil {
+		log.Printf("Failed to compute disposition report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute disposition report",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":        since,
+		"dispositions": counts,
+		"status":       "success",
+	})
+}
+
+// getFeedbackLabels feeds detections reviewed after since, labelled fraud or
+// not_fraud by their disposition, to the AI feedback loop. Without X-Tenant
+// it covers every tenant. The response's next since and after are passed
+// back to get the following page.
+func (s *Server) getFeedbackLabels(c *gin.Context) {
+	var query struct {
+		After string `form:"after" binding:"omitempty,uuid"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var since time.Time
+	if value := c.Query("since"); value != "" {
+		if since, err = parseQueryTime(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if err != nil || limit < 1 || limit > maxFeedbackLabels {
+		limit = 500
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	labels, err := s.store.GetFeedbackLabels(tenantID, since, query.After, limit)
+	if err != nil {
+		log.Printf("Failed to retrieve feedback labels: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve feedback labels",
+			"status": "error",
+		})
+		return
+	}
+	next := gin.H{"since": since.UTC().Format(time.RFC3339Nano), "after": query.After}
+	if len(labels) > 0 {
+		last := labels[len(labels)-1]
+		next = gin.H{"since": last.ReviewedAt.UTC().Format(time.RFC3339Nano), "after": last.DetectionID}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"labels": labels,
+		"total":  len(labels),
+		"next":   next,
+		"status": "success",
+	})
+}
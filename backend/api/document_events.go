@@ -0,0 +1,75 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getDocumentEvents returns a document's lifecycle events with the result
+// of verifying their hash chain. Events outlive the document, so the history
+// of an expired document is still returned to callers of its tenant.
+func (s *Server) getDocumentEvents(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	_, scope, err := s.requestScope(c)
+	if err != nil {
+		respondScopeError(c, err)
+		return
+	}
+
+	document, err := s.store.GetDocument(documentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to load document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document",
+			"status": "error",
+		})
+		return
+	}
+	events, err := s.store.GetDocumentEvents(documentID)
+	if err != nil {
+		log.Printf("Failed to list events of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document events",
+			"status": "error",
+		})
+		return
+	}
+
+	// A deleted document is scoped by the tenant and last team its events
+	// record. As elsewhere, documents outside the scope are reported missing.
+	if document == nil && len(events) > 0 {
+		document = &services.Document{ID: documentID, TenantID: events[0].TenantID}
+		for _, event := range events {
+			if teamID, ok := event.Data["team_id"]; ok {
+				document.TeamID = nil
+				if id, ok := teamID.(string); ok {
+					document.TeamID = &id
+				}
+			}
+		}
+	}
+	if document == nil || !scope.Allows(document) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id":  documentID,
+		"events":       events,
+		"total":        len(events),
+		"verification": services.VerifyEventChain(events),
+		"status":       "success",
+	})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// documentFieldsFor returns the fields the tenant adds to document types, or
+// nil for documents without a tenant
+func documentFieldsFor(tenant *services.Tenant) services.DocumentFields {
+	if tenant == nil {
+		return nil
+	}
+	return tenant.DocumentFields
+}
+
+// getDocumentFields returns the metadata fields of each document type for
+// the X-Tenant tenant: the built-in fields with those the tenant added
+func (s *Server) getDocumentFields(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	fields := documentFieldsFor(tenant)
+
+	types := map[string]map[string]services.MetadataField{}
+	for documentType := range services.MetadataSchemas {
+		documentType := documentType
+		types[documentType] = services.MetadataSchema(&documentType, fields)
+	}
+	for documentType := range fields {
+		documentType := documentType
+		types[documentType] = services.MetadataSchema(&documentType, fields)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_types": types,
+		"tenant_fields":  fields,
+		"status":         "success",
+	})
+}
+
+// putDocumentFields replaces the metadata fields a tenant adds to document
+// types
+func (s *Server) putDocumentFields(c *gin.Context) {
+	var fields services.DocumentFields
+	if err := c.ShouldBindJSON(&fields); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must map document types to their fields",
+			"status": "error",
+		})
+		return
+	}
+	s.updateDocumentFields(c, fields)
+}
+
+// deleteDocumentFields leaves a tenant with the built-in fields only
+func (s *Server) deleteDocumentFields(c *gin.Context) {
+	s.updateDocumentFields(c, nil)
+}
+
+func (s *Server) updateDocumentFields(c *gin.Context, fields services.DocumentFields) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	err = s.store.UpdateTenantDocumentFields(tenant.ID, fields)
+	var fieldsErr *services.DocumentFieldsError
+	switch {
+	case errors.As(err, &fieldsErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid document fields",
+			"problems": fieldsErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update document fields for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update document fields",
+			"status": "error",
+		})
+		return
+	}
+
+	if len(fields) == 0 {
+		fields = nil
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":          tenant.Slug,
+		"document_fields": fields,
+		"status":          "success",
+	})
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// storeDocumentPages records the pages of a new extraction of the document,
+// dropping those of the one before. A failure is only logged: the pages
+// serve re-OCR, which the extracted text does not depend on.
+func (s *Server) storeDocumentPages(document *services.Document, extraction *services.Extraction) {
+	pages := services.NewDocumentPages(document.ID, extraction.Pages)
+	if err := s.store.ReplaceDocumentPages(document.ID, pages); err != nil {
+		log.Printf("Failed to store the pages of document %s: %v", document.ID, err)
+	}
+}
+
+// getDocumentPages lists the pages of a document's extracted text with the
+// confidence each was read with, flagging those below the re-OCR threshold
+func (s *Server) getDocumentPages(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+
+	pages, err := s.store.GetDocumentPages(documentID)
+	if err != nil {
+		log.Printf("Failed to list pages of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document pages",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id":          documentID,
+		"pages":                pages,
+		"total":                len(pages),
+		"reocr_below":          s.ocr.ReOCRBelow,
+		"low_confidence_pages": services.LowConfidencePages(pages, s.ocr.ReOCRBelow),
+		"status":               "success",
+	})
+}
+
+// reOCRDocument runs thorough OCR again on some pages of a document, by
+// default those read with a confidence below the threshold, and puts each
+// page read with more confidence than before in place of its old text. The
+// document is then analyzed again, unless analyze=false is passed or no
+// page improved.
+func (s *Server) reOCRDocument(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Pages   string   `form:"pages" binding:"omitempty,max=1000"`
+		Below   *float64 `form:"below" binding:"omitempty,min=0,max=100"`
+		Analyze *bool    `form:"analyze"`
+	}
+	if !bindQuery(c, &req) {
+		return
+	}
+	below := s.ocr.ReOCRBelow
+	if req.Below != nil {
+		below = *req.Below
+	}
+	analyze := req.Analyze == nil || *req.Analyze
+
+	document := scopedDocument(c)
+	stored, err := s.store.GetDocumentPages(documentID)
+	if err != nil {
+		log.Printf("Failed to list pages of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document pages",
+			"status": "error",
+		})
+		return
+	}
+	if document.ExtractedText == nil || len(stored) == 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Document has no pages to re-OCR; extract its text again first",
+			"status": "error",
+		})
+		return
+	}
+
+	byNumber := map[int]*services.DocumentPage{}
+	for _, page := range stored {
+		byNumber[page.Page] = page
+	}
+	targets := services.LowConfidencePages(stored, below)
+	if req.Pages != "" {
+		targets = nil
+		for _, field := range strings.Split(req.Pages, ",") {
+			number, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || byNumber[number] == nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":  "pages must be a comma-separated list of the document's page numbers",
+					"page":   field,
+					"status": "error",
+				})
+				return
+			}
+			targets = append(targets, number)
+		}
+	}
+	if len(targets) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"document_id":     documentID,
+			"pages":           []gin.H{},
+			"improved":        0,
+			"analysis_queued": false,
+			"status":          "success",
+		})
+		return
+	}
+
+	reader, err := s.openDocumentFile(c.Request.Context(), document)
+	if err != nil {
+		log.Printf("Failed to fetch document %s from storage: %v", document.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Failed to fetch document from storage",
+			"status": "error",
+		})
+		return
+	}
+	resp, err := s.ai.ExtractText(c.Request.Context(), services.ExtractTextRequest{
+		Filename:    document.OriginalFilename,
+		ContentType: document.MimeType,
+		Content:     reader,
+		Pages:       targets,
+		Thorough:    true,
+	})
+	reader.Close()
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+
+	// Every page tried counts as a re-OCR; only those read better replace
+	// their text
+	texts := map[int]string{}
+	results := []gin.H{}
+	for _, read := range resp.Pages {
+		page := byNumber[read.Page]
+		if page == nil {
+			continue
+		}
+		page.ReOCRCount++
+		improved := read.Status == services.PageStatusOK &&
+			(page.Status != services.PageStatusOK || read.Confidence > page.Confidence)
+		results = append(results, gin.H{
+			"page":                read.Page,
+			"previous_confidence": page.Confidence,
+			"confidence":          read.Confidence,
+			"status":              read.Status,
+			"improved":            improved,
+		})
+		if !improved {
+			continue
+		}
+		texts[read.Page] = (*resp.ExtractedText)[read.TextStart:read.TextEnd]
+		page.Source, page.Confidence, page.Status, page.Error = read.Source, read.Confidence, read.Status, ""
+		page.DurationMS = read.DurationMS
+	}
+
+	text, pages, err := services.ReplacePageTexts(*document.ExtractedText, stored, texts)
+	if err != nil {
+		log.Printf("Failed to re-OCR document %s: %v", document.ID, err)
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Document pages do not match its extracted text; extract its text again first",
+			"status": "error",
+		})
+		return
+	}
+	if len(texts) > 0 {
+		if err := s.store.UpdateDocumentExtractedText(document.ID, text); err != nil {
+			log.Printf("Failed to store extracted text for document %s: %v", document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to store extracted text",
+				"status": "error",
+			})
+			return
+		}
+	}
+	if err := s.store.ReplaceDocumentPages(document.ID, pages); err != nil {
+		log.Printf("Failed to store the pages of document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to store document pages",
+			"status": "error",
+		})
+		return
+	}
+
+	queued := analyze && len(texts) > 0
+	if queued {
+		document.ExtractedText = &text
+		s.enqueuePipeline(document, true)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"document_id":     documentID,
+		"pages":           results,
+		"improved":        len(texts),
+		"text_length":     len(text),
+		"analysis_queued": queued,
+		"status":          "success",
+	})
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getDocumentStats reports how many documents there are by status, risk
+// level, upload day and, across tenants, tenant. Requests with X-Tenant only
+// count that tenant's documents; since limits the count to documents
+// uploaded on or after that day. Days are those of tz, or else the tenant's
+// time zone, or else UTC.
+func (s *Server) getDocumentStats(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+	loc, ok := statsLocation(c, tenant)
+	if !ok {
+		return
+	}
+
+	var since *time.Time
+	if value := c.Query("since"); value != "" {
+		t, err := parseQueryTimeIn(value, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+		since = &t
+	}
+
+	stats, err := s.store.GetDocumentStats(tenantID, since, loc)
+	if err != nil {
+		log.Printf("Failed to compute document stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute document statistics",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stats":  stats,
+		"status": "success",
+	})
+}
@@ -0,0 +1,759 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Document handlers
+func (s *Server) uploadDocument(c *gin.Context) {
+	// Get the file from the form
+	file, header, ok := s.uploadedFile(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	// Optional document type and metadata supplied with the upload
+	var documentType *string
+	if value := c.PostForm("document_type"); value != "" {
+		documentType = &value
+	}
+
+	var metadata services.Metadata
+	if value := c.PostForm("metadata"); value != "" {
+		if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Metadata must be a JSON object",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	// Optional SHA-256 of the file computed by the client
+	expected := strings.ToLower(strings.TrimSpace(c.PostForm("sha256")))
+	if expected != "" && !sha256Pattern.MatchString(expected) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "sha256 must be 64 hexadecimal characters",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant, scope, err := s.requestScope(c)
+	if err != nil {
+		respondScopeError(c, err)
+		return
+	}
+	teamID, ok := s.teamForUpload(c, tenant, scope)
+	if !ok {
+		return
+	}
+	user, err := s.requestUser(c)
+	if err != nil {
+		respondScopeError(c, err)
+		return
+	}
+
+	var validationErr *services.MetadataValidationError
+	if err := services.ValidateMetadata(documentType, metadata, documentFieldsFor(tenant)); errors.As(err, &validationErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid metadata",
+			"problems": validationErr.Problems,
+			"status":   "error",
+		})
+		return
+	}
+
+	// The file is kept in the tenant's data residency region
+	region, storage, err := s.tenantStorage(tenant)
+	if err != nil {
+		log.Printf("Failed to select storage region: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Storage region unavailable",
+			"status": "error",
+		})
+		return
+	}
+
+	// Hash the content first: files are stored under their hash, so that
+	// identical uploads share one object. The hash is also used for exemplar
+	// matching.
+	contentSHA256, err := hashReader(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to read uploaded file",
+			"status": "error",
+		})
+		return
+	}
+	if expected != "" && expected != contentSHA256 {
+		metrics.UploadChecksumFailures.WithLabelValues("received").Inc()
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Uploaded file does not match the sha256 checksum; it was corrupted in transit",
+			"expected": expected,
+			"received": contentSHA256,
+			"status":   "error",
+		})
+		return
+	}
+	objectName := services.ContentObjectName(contentSHA256)
+
+	// Upload to MinIO unless another document already stored the same file.
+	// Objects are named after their content, so writing one again is
+	// harmless: a later upload reuses the object only once it verifies, and
+	// otherwise writes it itself, as the upload that came first may still
+	// be writing it or may have failed.
+	ctx := context.Background()
+	verified := false
+	first, err := s.acquireObject(region, services.StorageTierHot, objectName)
+	if err == nil && !first {
+		verified = verifyStoredObject(ctx, storage, objectName, contentSHA256) == nil
+	}
+	if err == nil && !verified {
+		err = storage.UploadFile(ctx, objectName, file, header.Size, header.Header.Get("Content-Type"))
+		if err != nil {
+			s.releaseObject(ctx, region, services.StorageTierHot, objectName)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to store uploaded file: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to upload file",
+			"status": "error",
+		})
+		return
+	}
+
+	// Read the stored copy back so that a file corrupted on its way into
+	// storage is rejected now rather than failing analysis later
+	if !verified {
+		if err := verifyStoredObject(ctx, storage, objectName, contentSHA256); err != nil {
+			log.Printf("Stored file %s failed verification: %v", objectName, err)
+			s.releaseObject(ctx, region, services.StorageTierHot, objectName)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":  "Stored file failed checksum verification",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	// Save document metadata to database
+	document := &services.Document{
+		Filename:         fmt.Sprintf("%d_%s", time.Now().Unix(), header.Filename),
+		OriginalFilename: header.Filename,
+		FilePath:         objectName,
+		FileSize:         header.Size,
+		MimeType:         header.Header.Get("Content-Type"),
+		DocumentType:     documentType,
+		Status:           services.DocumentUploaded,
+		FraudRiskLevel:   riskTaxonomyFor(tenant).Lowest().Name,
+		StorageRegion:    &region,
+		Metadata:         metadata,
+	}
+	if tenant != nil {
+		document.TenantID = &tenant.ID
+	}
+	document.TeamID = teamID
+	if user != nil {
+		document.UserID = &user.ID
+	}
+	document.ContentSHA256 = &contentSHA256
+
+	err = s.store.CreateDocument(document)
+	if err != nil {
+		log.Printf("Failed to save document to database: %v", err)
+		s.releaseObject(ctx, region, services.StorageTierHot, objectName)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  fmt.Sprintf("Failed to save document to database: %v", err),
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Document saved to database with ID: %s", document.ID)
+	s.recordSubmission(c, document)
+
+	// Queue the pipeline that extracts the text from the stored copy and
+	// analyzes it; OCR can take far longer than the client should wait
+	s.enqueuePipeline(document, false)
+
+	response := gin.H{
+		"message":   "File uploaded successfully",
+		"file_id":   document.ID,
+		"file_name": header.Filename,
+		"file_size": header.Size,
+		"file_url":  storage.GetFileURL(objectName),
+		"status":    "success",
+	}
+	status := http.StatusOK
+	if eta, backlog, ok := s.queueETA(document.ID); ok {
+		response["eta_seconds"] = etaSeconds(eta)
+		// A long queue is announced so clients poll less rather than wait
+		// for analyses bound to time out
+		if s.pipeline.QueueHighWater > 0 && backlog.Queued >= s.pipeline.QueueHighWater {
+			status = http.StatusAccepted
+			response["message"] = "File uploaded; analysis is delayed by a long queue"
+			c.Header("Retry-After", strconv.Itoa(etaSeconds(eta)))
+		}
+	}
+	c.JSON(status, response)
+}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// verifyStoredObject checks that the stored object hashes to contentSHA256
+func verifyStoredObject(ctx context.Context, storage services.ObjectStorage, objectName, contentSHA256 string) error {
+	reader, err := storage.GetFile(ctx, objectName)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	stored, err := hashReader(reader)
+	if err != nil {
+		return err
+	}
+	if stored != contentSHA256 {
+		metrics.UploadChecksumFailures.WithLabelValues("stored").Inc()
+		return fmt.Errorf("stored object hashes to %s, expected %s", stored, contentSHA256)
+	}
+	return nil
+}
+
+func (s *Server) getDocuments(c *gin.Context) {
+	// Get pagination parameters
+	limitStr := c.DefaultQuery("limit", "10")
+	offsetStr := c.DefaultQuery("offset", "0")
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 10
+	}
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+
+	filters, err := services.ParseMetadataFilters(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+		return
+	}
+	var source struct {
+		Channel     string `form:"channel" binding:"omitempty,oneof=web api sftp email"`
+		Fingerprint string `form:"fingerprint" binding:"omitempty,max=64"`
+	}
+	if !bindQuery(c, &source) {
+		return
+	}
+
+	_, scope, err := s.requestScope(c)
+	if err != nil {
+		respondScopeError(c, err)
+		return
+	}
+
+	// Get documents from database
+	documents, err := s.store.GetDocuments(limit, offset, filters, services.SubmissionFilter(source), scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve documents",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"documents": documents,
+		"total":     len(documents),
+		"status":    "success",
+	})
+}
+
+// documentWait are the query parameters of a GET /documents/:id that waits
+// for the document to reach a status
+type documentWait struct {
+	WaitFor string `form:"wait_for" binding:"omitempty,oneof=uploaded processed"`
+	Timeout string `form:"timeout"`
+}
+
+// defaultWait is how long a request waits when it gives no timeout
+const defaultWait = 30 * time.Second
+
+// waitPollInterval is how often a waiting request re-reads the document, to
+// notice analyses finished by another instance, whose events it does not see
+const waitPollInterval = 2 * time.Second
+
+func (s *Server) getDocument(c *gin.Context) {
+	var wait documentWait
+	if !bindQuery(c, &wait) {
+		return
+	}
+	timeout := defaultWait
+	if wait.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(wait.Timeout); err != nil || timeout < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Request validation failed",
+				"fields": []FieldError{{
+					Field:   "timeout",
+					Rule:    "duration",
+					Message: "timeout must be a duration such as 30s",
+				}},
+				"status": "error",
+			})
+			return
+		}
+	}
+	if s.http.MaxWait > 0 && timeout > s.http.MaxWait {
+		timeout = s.http.MaxWait
+	}
+
+	document := scopedDocument(c)
+	var events <-chan services.DocumentEvent
+	if wait.WaitFor != "" {
+		// Subscribe, then read the document again, so a change since it was
+		// first read is not missed
+		var cancel func()
+		events, cancel = s.events.SubscribeDocument(document.ID)
+		defer cancel()
+		current, err := s.store.GetDocument(document.ID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Document not found",
+				"status": "error",
+			})
+			return
+		}
+		document = current
+	}
+
+	if wait.WaitFor == services.DocumentProcessed && !services.StatusReached(document.Status, wait.WaitFor) {
+		// Holding the request is pointless when the queue will not reach
+		// the document before the timeout
+		if eta, _, ok := s.queueETA(document.ID); ok && eta > timeout {
+			respondPending(c, document, eta)
+			return
+		}
+	}
+	if wait.WaitFor != "" && !services.StatusReached(document.Status, wait.WaitFor) {
+		current, err := s.waitForDocument(c.Request.Context(), document, wait.WaitFor, timeout, events)
+		if errors.Is(err, sql.ErrNoRows) {
+			// Deleted while the request waited
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Document not found",
+				"status": "error",
+			})
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to wait for document %s: %v", document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to read document",
+				"status": "error",
+			})
+			return
+		}
+		document = current
+		if !services.StatusReached(document.Status, wait.WaitFor) {
+			// Still in progress; the client may ask again
+			eta, _, _ := s.queueETA(document.ID)
+			respondPending(c, document, eta)
+			return
+		}
+	}
+
+	analysis, err := s.store.GetDocumentAnalysis(document.ID)
+	if err != nil {
+		log.Printf("Failed to load analysis of document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document analysis",
+			"status": "error",
+		})
+		return
+	}
+	if analysis != nil {
+		document.EmotionAnalysis, document.PatternAnalysis = analysis.EmotionAnalysis, analysis.PatternAnalysis
+	}
+
+	if document.PipelineStages, err = s.store.GetPipelineStageRuns(document.ID); err != nil {
+		// The document is still worth returning without its timings
+		log.Printf("Failed to load pipeline stages of document %s: %v", document.ID, err)
+	}
+	if document.Amounts, err = s.store.GetDocumentAmounts(document.ID); err != nil {
+		log.Printf("Failed to load amounts of document %s: %v", document.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document": document,
+		"status":   "success",
+	})
+}
+
+// respondPending answers a wait that has not been met yet with the document
+// as it is. A positive eta is added as eta_seconds and Retry-After.
+func respondPending(c *gin.Context, document *services.Document, eta time.Duration) {
+	response := gin.H{
+		"document": document,
+		"status":   "pending",
+	}
+	if eta > 0 {
+		response["eta_seconds"] = etaSeconds(eta)
+		c.Header("Retry-After", strconv.Itoa(etaSeconds(eta)))
+	}
+	c.JSON(http.StatusAccepted, response)
+}
+
+// waitForDocument re-reads document whenever an event arrives for it, and
+// every waitPollInterval, until it reaches status or a later one, timeout
+// elapses or the client goes away. It returns the last version read, and
+// sql.ErrNoRows when the document is deleted meanwhile.
+func (s *Server) waitForDocument(ctx context.Context, document *services.Document, status string, timeout time.Duration, events <-chan services.DocumentEvent) (*services.Document, error) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(waitPollInterval)
+	defer poll.Stop()
+
+	for !services.StatusReached(document.Status, status) {
+		select {
+		case <-events:
+		case <-poll.C:
+		case <-deadline.C:
+			return document, nil
+		case <-ctx.Done():
+			return document, nil
+		}
+		current, err := s.store.GetDocument(document.ID)
+		if err != nil {
+			return nil, err
+		}
+		document = current
+	}
+	return document, nil
+}
+
+func (s *Server) patchDocumentMetadata(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+
+	// Keys set to null are removed, all other keys are merged into the existing metadata
+	var patch map[string]interface{}
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a JSON object",
+			"status": "error",
+		})
+		return
+	}
+
+	set := services.Metadata{}
+	var remove []string
+	for key, value := range patch {
+		if value == nil {
+			remove = append(remove, key)
+		} else {
+			set[key] = value
+		}
+	}
+
+	metadata, err := s.store.PatchDocumentMetadata(documentID, set, remove)
+	if err != nil {
+		var validationErr *services.MetadataValidationError
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Document not found",
+				"status": "error",
+			})
+		case errors.As(err, &validationErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":    "Invalid metadata",
+				"problems": validationErr.Problems,
+				"status":   "error",
+			})
+		default:
+			log.Printf("Failed to update metadata for document %s: %v", documentID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to update document metadata",
+				"status": "error",
+			})
+		}
+		return
+	}
+
+	// The ERP connector reports approvals by patching the metadata, and
+	// reviewers correct amounts the reports sum
+	if document, err := s.store.GetDocument(documentID); err != nil {
+		log.Printf("Failed to check approval of document %s: %v", documentID, err)
+	} else if tenant, err := s.tenantFor(document); err != nil {
+		log.Printf("Failed to check approval of document %s: %v", documentID, err)
+	} else {
+		s.checkApprovalPolicy(document, tenant)
+		s.convertAmounts(c.Request.Context(), document, tenant)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"metadata":    metadata,
+		"status":      "success",
+	})
+}
+
+// extractDocumentText re-runs text extraction on the stored original, for
+// documents uploaded before their format was supported. The document is then
+// analyzed again unless analyze=false is passed.
+func (s *Server) extractDocumentText(c *gin.Context) {
+	analyze, err := strconv.ParseBool(c.DefaultQuery("analyze", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "analyze must be true or false",
+			"status": "error",
+		})
+		return
+	}
+
+	document := scopedDocument(c)
+	reader, err := s.openDocumentFile(c.Request.Context(), document)
+	if err != nil {
+		log.Printf("Failed to fetch document %s from storage: %v", document.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Failed to fetch document from storage",
+			"status": "error",
+		})
+		return
+	}
+	defer reader.Close()
+
+	extraction, err := s.extractors.Extract(c.Request.Context(), document.MimeType, reader)
+	if errors.Is(err, services.ErrExtractionUnsupported) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":     "Text extraction is not supported for this content type",
+			"mime_type": document.MimeType,
+			"status":    "error",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrExtractionTimeout) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":  "Text extraction timed out",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to extract text from document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to extract text",
+			"status": "error",
+		})
+		return
+	}
+	text := extraction.Text
+
+	if err := s.store.UpdateDocumentExtractedText(document.ID, text); err != nil {
+		log.Printf("Failed to store extracted text for document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to store extracted text",
+			"status": "error",
+		})
+		return
+	}
+
+	s.storeDocumentPages(document, extraction)
+	s.recordRiskFactors(document, extraction.RiskFactors)
+	if analyze {
+		document.ExtractedText = &text
+		s.enqueuePipeline(document, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id":     document.ID,
+		"text_length":     len(text),
+		"details":         extraction.Details,
+		"risk_factors":    extraction.RiskFactors,
+		"analysis_queued": analyze,
+		"status":          "success",
+	})
+}
+
+// getExtractionFormats lists the content types text can be extracted from
+func (s *Server) getExtractionFormats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"formats": s.extractors.MediaTypes(),
+		"status":  "success",
+	})
+}
+
+// recordRiskFactors stores the risk factors found during extraction as fraud
+// detections. A pattern already detected on the document is not recorded
+// again, so re-extraction does not duplicate them.
+func (s *Server) recordRiskFactors(document *services.Document, factors []services.RiskFactor) {
+	if len(factors) == 0 {
+		return
+	}
+	patterns, err := s.store.GetFraudPatterns()
+	if err != nil {
+		log.Printf("Failed to load fraud patterns for document %s: %v", document.ID, err)
+		return
+	}
+
+	for _, factor := range factors {
+		var pattern *services.FraudPattern
+		for _, p := range patterns {
+			if p.PatternType == factor.PatternType {
+				pattern = p
+				break
+			}
+		}
+		if pattern == nil {
+			log.Printf("Document %s has risk factor %s but no active pattern records it", document.ID, factor.PatternType)
+			continue
+		}
+
+		existing, err := s.store.GetFraudDetections(services.DetectionFilter{DocumentID: document.ID, PatternID: pattern.ID, Limit: 1})
+		if err != nil {
+			log.Printf("Failed to check detections of document %s: %v", document.ID, err)
+			continue
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		details, err := json.Marshal(factor.Details)
+		if err != nil {
+			log.Printf("Failed to encode %s details for document %s: %v", factor.PatternType, document.ID, err)
+			continue
+		}
+		detailsJSON := string(details)
+		detection := &services.FraudDetection{
+			DocumentID:       document.ID,
+			FraudPatternID:   &pattern.ID,
+			ConfidenceScore:  factor.Confidence,
+			DetectionDetails: &detailsJSON,
+		}
+		if err := s.store.CreateFraudDetection(detection); err != nil {
+			log.Printf("Failed to record %s for document %s: %v", factor.PatternType, document.ID, err)
+			continue
+		}
+		log.Printf("Document %s flagged: %s", document.ID, pattern.PatternName)
+	}
+}
+
+// analyzeDocumentForFraud scores analyzed, the document's text or the part
+// of it that is new to the document's account, with the tenant's analyzer
+// and stores the result with text. With a batch coordinator configured the
+// document is queued and stored when its batch completes. Debug replays
+// skip both the cache and the batch, so that the call to the provider is
+// captured.
+func (s *Server) analyzeDocumentForFraud(ctx context.Context, document *services.Document, text, analyzed string) error {
+	analyzer, err := s.analyzerFor(document)
+	if err != nil {
+		return err
+	}
+	request := services.AnalyzeTextRequest{Text: analyzed}
+	debug := services.DiagnosticsFrom(ctx) != nil
+
+	cacheKey := ""
+	if ttl := s.analyzers.CacheTTL(); ttl > 0 && !debug {
+		cacheKey = services.AnalysisCacheKey(analyzer, analyzed)
+		cached, err := s.store.GetCachedAnalysis(cacheKey, time.Now().Add(-ttl))
+		if err != nil {
+			log.Printf("Failed to look up cached analysis for document %s: %v", document.ID, err)
+		}
+		if cached != nil {
+			metrics.AnalysisCache.WithLabelValues("hit").Inc()
+			return s.storeFraudAnalysis(document, text, analyzed, cached)
+		}
+		metrics.AnalysisCache.WithLabelValues("miss").Inc()
+	}
+
+	if s.batcher != nil && !debug {
+		done := make(chan error, 1)
+		s.batcher.Submit(&services.AnalysisJob{
+			Analyzer: analyzer,
+			Request:  request,
+			Done: func(analysis *services.AnalyzeTextResponse, err error) {
+				if err == nil {
+					s.cacheAnalysis(cacheKey, analyzer, analysis)
+					err = s.storeFraudAnalysis(document, text, analyzed, analysis)
+				}
+				done <- err
+			},
+		})
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	analysis, err := analyzer.Analyze(ctx, request)
+	if err != nil {
+		return err
+	}
+	s.cacheAnalysis(cacheKey, analyzer, analysis)
+	return s.storeFraudAnalysis(document, text, analyzed, analysis)
+}
+
+// cacheAnalysis keeps a result for reuse on identical text. Fallback results
+// are not kept, so the text is scored by the primary provider next time.
+func (s *Server) cacheAnalysis(key string, analyzer services.Analyzer, analysis *services.AnalyzeTextResponse) {
+	if key == "" || analysis.Fallback {
+		return
+	}
+	if err := s.store.CacheAnalysis(key, analyzer, analysis); err != nil {
+		log.Printf("Failed to cache analysis: %v", err)
+	}
+}
+
+func (s *Server) storeFraudAnalysis(document *services.Document, text, analyzed string, analysis *services.AnalyzeTextResponse) error {
+	// Update document in database with fraud analysis results
+	result, err := s.newFraudAnalysis(document, text, analysis)
+	if err != nil {
+		return err
+	}
+	if err := s.store.UpdateDocumentFraudAnalysis(document.ID, result); err != nil {
+		return fmt.Errorf("failed to update document with fraud analysis: %v", err)
+	}
+	s.events.Publish(services.DocumentEvent{DocumentID: document.ID, Status: services.DocumentProcessed})
+
+	provider := result.Provider
+	if result.Fallback {
+		provider += " (fallback)"
+	}
+	if result.Cached {
+		provider += " (cached)"
+	}
+	log.Printf("Fraud analysis completed for document %s by %s: score=%.3f, risk=%s",
+		document.ID, provider, result.FraudScore, result.RiskLevel)
+	s.recordAccountEvidence(document.ID, text)
+	s.compareWithCanary(document, analyzed, result)
+	return nil
+}
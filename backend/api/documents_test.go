@@ -0,0 +1,106 @@
+package api_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"frauddocai-backend/api"
+	"frauddocai-backend/api/apitest"
+	"frauddocai-backend/services"
+)
+
+func TestUploadIsAnalyzedInTheBackground(t *testing.T) {
+	h := apitest.New()
+
+	text := "URGENT: wire $9,800.00 to account 12345678 today or your account will be closed."
+	rec := h.Upload("/api/v1/documents/upload", "notice.txt", "text/plain", []byte(text), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload: status %d: %s", rec.Code, rec.Body.String())
+	}
+	body, err := apitest.DecodeJSON(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := services.DocumentID(body["file_id"].(string))
+
+	doc, err := h.WaitForStatus(id, services.DocumentProcessed, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.ExtractedText == nil || *doc.ExtractedText != text {
+		t.Errorf("extracted text = %v, want %q", doc.ExtractedText, text)
+	}
+	if doc.FraudScore == nil {
+		t.Error("processed document has no fraud score")
+	}
+	if _, ok := h.Storage.Object(doc.FilePath); !ok {
+		t.Errorf("uploaded file not stored at %s", doc.FilePath)
+	}
+
+	rec = h.Do(http.MethodGet, "/api/v1/documents/"+string(id), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get: status %d: %s", rec.Code, rec.Body.String())
+	}
+	body, err = apitest.DecodeJSON(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, _ := body["document"].(map[string]interface{})
+	if document["status"] != services.DocumentProcessed {
+		t.Errorf("get: document %v, want it processed", document)
+	}
+}
+
+func TestUploadWithoutFile(t *testing.T) {
+	h := apitest.New()
+
+	rec := h.Do(http.MethodPost, "/api/v1/documents/upload", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	if calls := h.AI.Calls(); len(calls) > 0 {
+		t.Errorf("AI service called with %v", calls)
+	}
+}
+
+func TestDocumentRoutesAreScopedToTheTenant(t *testing.T) {
+	h := apitest.New()
+	alpha := &services.Tenant{Slug: "alpha", Name: "Alpha"}
+	beta := &services.Tenant{Slug: "beta", Name: "Beta"}
+	for _, tenant := range []*services.Tenant{alpha, beta} {
+		if err := h.Store.CreateTenant(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := h.SeedDocument(func(d *services.Document) { d.TenantID = &beta.ID })
+
+	get := func(tenant string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/documents/"+string(doc.ID), nil)
+		req.Header.Set(api.TenantHeader, tenant)
+		return h.Serve(req)
+	}
+	if rec := get("alpha"); rec.Code != http.StatusNotFound {
+		t.Errorf("another tenant: status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := get("beta"); rec.Code != http.StatusOK {
+		t.Errorf("its tenant: status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := get("gamma"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown tenant: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestGetDocumentNotFound(t *testing.T) {
+	h := apitest.New()
+
+	for path, want := range map[string]int{
+		"/api/v1/documents/00000000-0000-4000-8000-000000000099": http.StatusNotFound,
+		"/api/v1/documents/not-an-id":                            http.StatusBadRequest,
+	} {
+		if rec := h.Do(http.MethodGet, path, nil); rec.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", path, rec.Code, want, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// escalationBatchSize bounds the alerts checked per escalation pass
+const escalationBatchSize = 500
+
+// RunAlertEscalation moves alerts that lingered at their level up their
+// tenant's escalation chain every interval. It returns when ctx is
+// cancelled.
+func (s *Server) RunAlertEscalation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.escalateAlerts(ctx)
+		}
+	}
+}
+
+func (s *Server) escalateAlerts(ctx context.Context) {
+	candidates, err := s.store.GetEscalationCandidates(escalationBatchSize)
+	if err != nil {
+		log.Printf("Failed to find alerts to escalate: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, candidate := range candidates {
+		if ctx.Err() != nil {
+			return
+		}
+		step, due := candidate.Due(now)
+		if !due {
+			continue
+		}
+		alert := candidate.Alert
+
+		// A step's reviewer who is away has their delegate take the alert
+		assignee, _, err := s.store.ResolveAssignee(step.UserID, now)
+		if err != nil {
+			log.Printf("Failed to resolve escalation assignee of alert %s: %v", alert.ID, err)
+			continue
+		}
+		var original *string
+		if assignee != step.UserID {
+			original = &step.UserID
+		}
+		escalated, err := s.store.EscalateAlert(alert.ID, alert.EscalationLevel, step, assignee, original)
+		if err != nil {
+			log.Printf("Failed to escalate alert %s: %v", alert.ID, err)
+			continue
+		}
+		if !escalated {
+			continue
+		}
+		level := alert.EscalationLevel + 1
+		metrics.AlertEscalations.WithLabelValues(strconv.Itoa(level)).Inc()
+		log.Printf("Escalated alert %s to %s (%s, level %d)", alert.ID, assignee, step.Name, level)
+
+		notify := []string{assignee}
+		if original != nil {
+			notify = append(notify, *original)
+		}
+		if alert.AssignedTo != nil {
+			notify = append(notify, *alert.AssignedTo)
+		}
+		s.emitAlertWebhook(services.WebhookAlertEscalated, alert.ID, alert.TenantID, gin.H{
+			"alert_id":    alert.ID,
+			"level":       level,
+			"step":        step,
+			"assigned_to": assignee,
+			"previous":    alert.AssignedTo,
+			"notify":      notify,
+			"links":       s.alertLinks(alert),
+		})
+	}
+}
+
+// putEscalationChain sets the escalation chain of a tenant
+func (s *Server) putEscalationChain(c *gin.Context) {
+	var chain services.EscalationChain
+	if err := c.ShouldBindJSON(&chain); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be an escalation chain",
+			"status": "error",
+		})
+		return
+	}
+	s.updateEscalationChain(c, &chain)
+}
+
+// deleteEscalationChain turns escalation off for a tenant
+func (s *Server) deleteEscalationChain(c *gin.Context) {
+	s.updateEscalationChain(c, nil)
+}
+
+func (s *Server) updateEscalationChain(c *gin.Context, chain *services.EscalationChain) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err == nil {
+		err = s.store.UpdateTenantEscalationChain(tenant.ID, chain)
+	}
+	var chainErr *services.EscalationChainError
+	switch {
+	case errors.As(err, &chainErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid escalation chain",
+			"problems": chainErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update escalation chain for tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update escalation chain",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":           tenant.Slug,
+		"escalation_chain": chain,
+		"status":           "success",
+	})
+}
+
+// getAlertEscalations lists the escalations of an alert in order
+func (s *Server) getAlertEscalations(c *gin.Context) {
+	alert := scopedAlert(c)
+	escalations, err := s.store.GetAlertEscalations(alert.ID)
+	if err != nil {
+		log.Printf("Failed to retrieve escalations of alert %s: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve alert escalations",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alert_id":         alert.ID,
+		"escalation_level": alert.EscalationLevel,
+		"escalations":      escalations,
+		"status":           "success",
+	})
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type promoteExemplarRequest struct {
+	DocumentID services.DocumentID `json:"document_id" binding:"required,uuid"`
+	Label      string              `json:"label" binding:"required,notblank,max=100"`
+	Notes      *string             `json:"notes" binding:"omitempty,max=2000"`
+	PromotedBy *string             `json:"promoted_by" binding:"omitempty,max=100"`
+}
+
+// Exemplar handlers
+func (s *Server) promoteExemplar(c *gin.Context) {
+	var req promoteExemplarRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	document, err := s.store.GetDocument(req.DocumentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+	if document.ExtractedText == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Document has not been analyzed yet",
+			"status": "error",
+		})
+		return
+	}
+
+	existing, err := s.store.GetExemplars(document.TenantID)
+	if err != nil {
+		respondExemplarError(c, err)
+		return
+	}
+	for _, exemplar := range existing {
+		if exemplar.DocumentID != nil && *exemplar.DocumentID == document.ID {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":       "Document is already an exemplar",
+				"exemplar_id": exemplar.ID,
+				"status":      "error",
+			})
+			return
+		}
+	}
+
+	hash := document.ContentSHA256
+	if hash == nil {
+		// Documents uploaded before hashes were recorded
+		sum, err := s.hashStoredFile(c.Request.Context(), document)
+		if err != nil {
+			log.Printf("Failed to hash document %s: %v", document.ID, err)
+		} else {
+			hash = &sum
+		}
+	}
+
+	embedding, err := s.store.GetDocumentEmbedding(document.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, services.ErrSemanticSearchUnavailable) {
+		respondExemplarError(c, err)
+		return
+	}
+
+	exemplar := &services.Exemplar{
+		TenantID:      document.TenantID,
+		DocumentID:    &document.ID,
+		Label:         req.Label,
+		Notes:         req.Notes,
+		ContentSHA256: hash,
+		Entities:      services.ExtractEntities(*document.ExtractedText),
+		Embedding:     embedding,
+		PromotedBy:    req.PromotedBy,
+	}
+	if err := s.store.CreateExemplar(exemplar); err != nil {
+		respondExemplarError(c, err)
+		return
+	}
+	log.Printf("Document %s promoted to fraud exemplar %s (%s)", document.ID, exemplar.ID, exemplar.Label)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"exemplar": exemplar,
+		"status":   "success",
+	})
+}
+
+func (s *Server) getExemplars(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	exemplars, err := s.store.GetExemplars(tenantID)
+	if err != nil {
+		respondExemplarError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"exemplars": exemplars,
+		"total":     len(exemplars),
+		"status":    "success",
+	})
+}
+
+func (s *Server) getExemplar(c *gin.Context) {
+	exemplar, err := s.store.GetExemplar(c.Param("id"))
+	if err != nil {
+		respondExemplarError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"exemplar": exemplar,
+		"status":   "success",
+	})
+}
+
+func (s *Server) deleteExemplar(c *gin.Context) {
+	exemplarID := c.Param("id")
+	if err := s.store.DeleteExemplar(exemplarID); err != nil {
+		respondExemplarError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Exemplar deleted",
+		"exemplar_id": exemplarID,
+		"status":      "success",
+	})
+}
+
+func respondExemplarError(c *gin.Context, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Exemplar not found",
+			"status": "error",
+		})
+		return
+	}
+
+	log.Printf("Exemplar request failed: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":  "Failed to access exemplar library",
+		"status": "error",
+	})
+}
+
+// hashStoredFile returns the hex SHA-256 of the document's file in storage
+func (s *Server) hashStoredFile(ctx context.Context, document *services.Document) (string, error) {
+	reader, err := s.openDocumentFile(ctx, document)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	return hashReader(reader)
+}
+
+// hashReader returns the hex SHA-256 of everything read from reader
+func hashReader(reader io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkExemplars compares a new upload with the tenant's exemplar library and
+// raises a critical alert for every exemplar it matches. entities and
+// embedding are empty when no text could be extracted, leaving only the hash
+// check.
+func (s *Server) checkExemplars(document *services.Document, entities []string, embedding []float32) {
+	exemplars, err := s.store.GetExemplars(document.TenantID)
+	if err != nil {
+		log.Printf("Failed to load fraud exemplars for document %s: %v", document.ID, err)
+		return
+	}
+	if len(exemplars) == 0 {
+		return
+	}
+
+	hash := ""
+	if document.ContentSHA256 != nil {
+		hash = *document.ContentSHA256
+	}
+
+	for _, exemplar := range exemplars {
+		if exemplar.DocumentID != nil && *exemplar.DocumentID == document.ID {
+			continue
+		}
+		match := services.MatchExemplar(exemplar, hash, entities, embedding, s.exemplars)
+		if match == nil {
+			continue
+		}
+
+		score := match.Score
+		alert := &services.Alert{
+			TenantID:   document.TenantID,
+			DocumentID: &document.ID,
+			ExemplarID: &exemplar.ID,
+			Kind:       services.AlertKindExemplarMatch,
+			Severity:   services.AlertSeverityCritical,
+			Score:      &score,
+			Details: services.Metadata{
+				"exemplar_label":       exemplar.Label,
+				"reasons":              match.Reasons,
+				"hash_match":           match.HashMatch,
+				"shared_entities":      match.SharedEntities,
+				"entity_score":         match.EntityScore,
+				"embedding_similarity": match.EmbeddingSimilarity,
+				"exemplar_url":         "/api/v1/exemplars/" + exemplar.ID,
+				"document_url":         "/api/v1/documents/" + document.ID,
+			},
+		}
+		if err := s.store.CreateAlert(alert); err != nil {
+			log.Printf("Failed to raise exemplar alert for document %s: %v", document.ID, err)
+			continue
+		}
+		metrics.ExemplarAlerts.Inc()
+		log.Printf("CRITICAL: document %s matches fraud exemplar %s (%s): %v",
+			document.ID, exemplar.ID, exemplar.Label, match.Reasons)
+	}
+}
+
+// scopedAlertKey is the context key of the alert of a request that passed
+// requireAlertInScope
+const scopedAlertKey = "scoped_alert"
+
+// requireAlertInScope resolves the :id alert of a route before the handler
+// runs. Alerts of another tenant than the request's are reported missing, as
+// requireDocumentInScope does for documents.
+func (s *Server) requireAlertInScope(c *gin.Context) {
+	_, scope, err := s.requestScope(c)
+	if err != nil {
+		respondScopeError(c, err)
+		c.Abort()
+		return
+	}
+
+	alert, err := s.store.GetAlert(c.Param("id"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to retrieve alert %s: %v", c.Param("id"), err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve alert",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil || !scope.AllowsTenant(alert.TenantID) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error":  "Alert not found",
+			"status": "error",
+		})
+		return
+	}
+
+	c.Set(scopedAlertKey, alert)
+	c.Next()
+}
+
+// scopedAlert is the alert of a request that passed requireAlertInScope
+func scopedAlert(c *gin.Context) *services.Alert {
+	return c.MustGet(scopedAlertKey).(*services.Alert)
+}
+
+// Alert handlers
+func (s *Server) getAlerts(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	unacknowledged := c.Query("unacknowledged") == "true"
+
+	alerts, err := s.store.GetAlerts(limit, offset, unacknowledged, tenantID)
+	if err != nil {
+		log.Printf("Failed to retrieve alerts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve alerts",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"total":  len(alerts),
+		"status": "success",
+	})
+}
+
+// getAlert returns one alert, the target of the links in alert webhooks
+func (s *Server) getAlert(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"alert":  scopedAlert(c),
+		"status": "success",
+	})
+}
+
+func (s *Server) acknowledgeAlert(c *gin.Context) {
+	var req struct {
+		AcknowledgedBy string `json:"acknowledged_by" binding:"required,notblank,max=100"`
+		Disposition    string `json:"disposition" binding:"required,max=50"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	alert, err := s.store.AcknowledgeAlert(scopedAlert(c).ID, req.AcknowledgedBy, req.Disposition)
+	var dispositionErr *services.DispositionError
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, services.ErrApprovalRequired) || errors.As(err, &dispositionErr) {
+		respondApprovalError(c, err, "Alert not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to acknowledge alert %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  fmt.Sprintf("Failed to acknowledge alert: %v", err),
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alert":  alert,
+		"status": "success",
+	})
+}
@@ -0,0 +1,76 @@
+package api_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"frauddocai-backend/api"
+	"frauddocai-backend/api/apitest"
+	"frauddocai-backend/services"
+)
+
+func TestAlertRoutesAreScopedToTheTenant(t *testing.T) {
+	h := apitest.New()
+	alpha := &services.Tenant{Slug: "alpha", Name: "Alpha"}
+	beta := &services.Tenant{Slug: "beta", Name: "Beta"}
+	for _, tenant := range []*services.Tenant{alpha, beta} {
+		if err := h.Store.CreateTenant(tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alert := &services.Alert{TenantID: &beta.ID, Kind: "exemplar_match", Severity: "high"}
+	if err := h.Store.CreateAlert(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, path, tenant string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(api.TenantHeader, tenant)
+		return h.Serve(req)
+	}
+	listed := func(tenant string) int {
+		rec := do(http.MethodGet, "/api/v1/alerts/", tenant, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list: status %d: %s", rec.Code, rec.Body.String())
+		}
+		body, err := apitest.DecodeJSON(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return int(body["total"].(float64))
+	}
+
+	if n := listed("alpha"); n != 0 {
+		t.Errorf("another tenant lists %d alerts, want 0", n)
+	}
+	if n := listed("beta"); n != 1 {
+		t.Errorf("its tenant lists %d alerts, want 1", n)
+	}
+
+	acknowledge := []byte(`{"acknowledged_by": "reviewer", "disposition": "confirmed_fraud"}`)
+	for _, route := range []struct{ method, path string }{
+		{http.MethodGet, "/api/v1/alerts/" + alert.ID},
+		{http.MethodGet, "/api/v1/alerts/" + alert.ID + "/escalations"},
+		{http.MethodPost, "/api/v1/alerts/" + alert.ID + "/acknowledge"},
+		{http.MethodGet, "/api/v1/alerts/" + alert.ID + "/sar"},
+		{http.MethodGet, "/api/v1/alerts/" + alert.ID + "/sar/pdf"},
+	} {
+		if rec := do(route.method, route.path, "alpha", acknowledge); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s by another tenant: status %d, want %d", route.method, route.path, rec.Code, http.StatusNotFound)
+		}
+	}
+	stored, err := h.Store.GetAlert(alert.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.AcknowledgedAt != nil {
+		t.Error("alert acknowledged by another tenant")
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/alerts/"+alert.ID, "beta", nil); rec.Code != http.StatusOK {
+		t.Errorf("its tenant: status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportPageSize is how many documents are read from the database at a time
+// while an export streams
+const exportPageSize = 500
+
+// exportDocuments streams the documents changed since a watermark as
+// newline-delimited JSON, one document with its entities and detections per
+// line, ordered by update time. Every line carries the cursor to resume
+// after it; the last line is a summary whose cursor is the watermark for the
+// next export. Requests with X-Tenant only export that tenant's documents.
+//
+// With mode=anonymized each line holds the document's anonymized form
+// instead, and the pseudonyms used are saved to the vault before the page
+// is sent.
+func (s *Server) exportDocuments(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	var cursor services.ExportCursor
+	if value := c.Query("cursor"); value != "" {
+		cursor, err = services.ParseExportCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid cursor",
+				"status": "error",
+			})
+			return
+		}
+	} else if value := c.Query("since"); value != "" {
+		since, err := parseQueryTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+		// Without an ID the cursor sorts before every document updated at since
+		cursor.UpdatedAt = since
+	}
+
+	anonymized := false
+	switch c.DefaultQuery("mode", "full") {
+	case "full":
+	case "anonymized":
+		if s.pseudonyms == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "Anonymized exports require ANONYMIZATION_KEY",
+				"status": "error",
+			})
+			return
+		}
+		anonymized = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "mode must be full or anonymized",
+			"status": "error",
+		})
+		return
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "limit must be a positive integer",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+
+	count := 0
+	more := false
+	for {
+		pageSize := exportPageSize
+		if limit > 0 && limit-count < pageSize {
+			pageSize = limit - count
+		}
+		exports, err := s.store.ExportDocuments(cursor, tenantID, pageSize)
+		if err != nil {
+			// The status has been sent, so report the failure in the stream;
+			// the client resumes from the cursor of the last line it received
+			log.Printf("Document export failed after %d documents: %v", count, err)
+			encoder.Encode(gin.H{
+				"error":  "Document export failed",
+				"cursor": cursor.String(),
+				"status": "error",
+			})
+			return
+		}
+
+		lines := make([]gin.H, len(exports))
+		pseudonyms := map[string]services.Pseudonym{}
+		for i, export := range exports {
+			pageCursor := services.ExportCursor{UpdatedAt: export.Document.UpdatedAt, ID: export.Document.ID}
+			if anonymized {
+				lines[i] = gin.H{
+					"cursor":   pageCursor.String(),
+					"document": s.pseudonyms.AnonymizeExport(export, pseudonyms),
+				}
+			} else {
+				lines[i] = gin.H{
+					"cursor":     pageCursor.String(),
+					"document":   export.Document,
+					"entities":   export.Entities,
+					"detections": export.Detections,
+				}
+			}
+		}
+		if len(pseudonyms) > 0 {
+			// A token is only sent once the vault can map it back
+			saved := make([]services.Pseudonym, 0, len(pseudonyms))
+			for _, pseudonym := range pseudonyms {
+				saved = append(saved, pseudonym)
+			}
+			if err := s.store.SavePseudonyms(saved); err != nil {
+				log.Printf("Document export failed after %d documents: %v", count, err)
+				encoder.Encode(gin.H{
+					"error":  "Document export failed",
+					"cursor": cursor.String(),
+					"status": "error",
+				})
+				return
+			}
+		}
+
+		for i, line := range lines {
+			if err := encoder.Encode(line); err != nil {
+				log.Printf("Document export interrupted after %d documents: %v", count, err)
+				return
+			}
+			cursor = services.ExportCursor{UpdatedAt: exports[i].Document.UpdatedAt, ID: exports[i].Document.ID}
+			count++
+		}
+		c.Writer.Flush()
+
+		if len(exports) < pageSize {
+			break
+		}
+		if limit > 0 && count >= limit {
+			more = true
+			break
+		}
+		if c.Request.Context().Err() != nil {
+			log.Printf("Document export cancelled after %d documents", count)
+			return
+		}
+	}
+
+	if anonymized {
+		log.Printf("Exported %d anonymized documents", count)
+	} else {
+		log.Printf("Exported %d documents", count)
+	}
+	encoder.Encode(gin.H{
+		"cursor": cursor.String(),
+		"count":  count,
+		"more":   more,
+		"status": "success",
+	})
+}
+
+// getPseudonym looks up the value a token of an anonymized export stands for
+func (s *Server) getPseudonym(c *gin.Context) {
+	pseudonym, err := s.store.GetPseudonym(c.Param("token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Pseudonym not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to look up pseudonym %s: %v", c.Param("token"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to look up pseudonym",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Pseudonym %s looked up", pseudonym.Token)
+
+	c.JSON(http.StatusOK, gin.H{
+		"pseudonym": pseudonym,
+		"status":    "success",
+	})
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fraud detection handlers
+func (s *Server) analyzeDocument(c *gin.Context) {
+	var request struct {
+		FileID services.DocumentID `json:"file_id" binding:"required,uuid"`
+	}
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	// Get document from database
+	document, err := s.store.GetDocument(request.FileID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+
+	// Use the extracted text for analysis
+	var text string
+	if document.ExtractedText != nil {
+		text = *document.ExtractedText
+	} else {
+		text = "No text extracted from document"
+	}
+
+	analyzer, err := s.analyzerFor(document)
+	if err != nil {
+		log.Printf("Failed to select analyzer for document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to select fraud analyzer",
+			"status": "error",
+		})
+		return
+	}
+
+	// Run fraud analysis with the tenant's provider
+	analysis, err := analyzer.Analyze(c.Request.Context(), services.AnalyzeTextRequest{Text: text})
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+
+	// Update document in database with fraud analysis results
+	result, err := s.newFraudAnalysis(document, text, analysis)
+	if err != nil {
+		log.Printf("Failed to classify fraud analysis for document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to load tenant risk levels",
+			"status": "error",
+		})
+		return
+	}
+	if err := s.store.UpdateDocumentFraudAnalysis(document.ID, result); err != nil {
+		log.Printf("Failed to update document with fraud analysis: %v", err)
+	} else {
+		s.events.Publish(services.DocumentEvent{DocumentID: document.ID, Status: services.DocumentProcessed})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"fraud_score":   result.FraudScore,
+		"risk_level":    result.RiskLevel,
+		"patterns":      analysis.Patterns,
+		"provider":      result.Provider,
+		"fallback":      result.Fallback,
+		"status":        "success",
+		"document_id":   request.FileID,
+		"analysis_time": analysis.ProcessingTimeMs,
+	})
+}
+
+func (s *Server) getFraudPatterns(c *gin.Context) {
+	patterns, err := s.store.GetFraudPatterns()
+	if err != nil {
+		log.Printf("Failed to load fraud patterns: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve fraud patterns",
+			"status": "error",
+		})
+		return
+	}
+
+	result := make([]gin.H, 0, len(patterns))
+	for _, pattern := range patterns {
+		result = append(result, gin.H{
+			"id":           pattern.ID,
+			"pattern_type": pattern.PatternType,
+			"name":         pattern.PatternName,
+			"description":  pattern.Description,
+			"severity":     pattern.Severity,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patterns": result,
+		"total":    len(result),
+		"status":   "success",
+	})
+}
+
+// defaultStatsWindow is how far back pattern statistics look by default
+const defaultStatsWindow = 90 * 24 * time.Hour
+
+// getFraudPatternStats reports how often a pattern fires and how often
+// reviewers mark its detections as false positives. The trend is bucketed in
+// tz, or else the X-Tenant tenant's time zone, or else UTC.
+func (s *Server) getFraudPatternStats(c *gin.Context) {
+	pattern, err := s.store.GetFraudPattern(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Fraud pattern not found",
+			"status": "error",
+		})
+		return
+	}
+
+	interval := c.DefaultQuery("interval", services.StatsIntervalWeek)
+	if interval != services.StatsIntervalDay && interval != services.StatsIntervalWeek {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "interval must be day or week",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	loc, ok := statsLocation(c, tenant)
+	if !ok {
+		return
+	}
+
+	since := services.StartOfDay(time.Now().Add(-defaultStatsWindow), loc)
+	if value := c.Query("since"); value != "" {
+		if since, err = parseQueryTimeIn(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	stats, err := s.store.GetFraudPatternStats(pattern.ID, since, interval, loc)
+	if err != nil {
+		log.Printf("Failed to compute stats for fraud pattern %s: %v", pattern.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute pattern statistics",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pattern": gin.H{
+			"id":           pattern.ID,
+			"pattern_type": pattern.PatternType,
+			"name":         pattern.PatternName,
+			"severity":     pattern.Severity,
+			"is_active":    pattern.IsActive,
+		},
+		"stats":  stats,
+		"status": "success",
+	})
+}
+
+func (s *Server) getFraudReports(c *gin.Context) {
+	// TODO: Implement get fraud reports
+	c.JSON(http.StatusOK, gin.H{
+		"reports": []gin.H{},
+		"total":   0,
+		"status":  "success",
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// convertAmounts converts the document's amounts into its tenant's base
+// currency and stores them with the originals. The converted amounts are
+// returned even when they could not be stored.
+func (s *Server) convertAmounts(ctx context.Context, document *services.Document, tenant *services.Tenant) services.DocumentAmounts {
+	amounts := s.fx.ConvertAmounts(ctx, document, tenant)
+	if err := s.store.ReplaceDocumentAmounts(document.ID, amounts); err != nil {
+		log.Printf("Failed to store converted amounts of document %s: %v", document.ID, err)
+	}
+	return amounts
+}
+
+// getSpendReport sums the amounts of the X-Tenant tenant's documents
+// uploaded since since (default 90 days ago) in its base currency, by day,
+// submitted currency and risk level. Days are those of tz, or else the
+// tenant's time zone, or else UTC.
+func (s *Server) getSpendReport(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	if tenant == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  TenantHeader + " header is required",
+			"status": "error",
+		})
+		return
+	}
+	loc, ok := statsLocation(c, tenant)
+	if !ok {
+		return
+	}
+	since := services.StartOfDay(time.Now().Add(-defaultStatsWindow), loc)
+	if value := c.Query("since"); value != "" {
+		if since, err = parseQueryTimeIn(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	report, err := s.store.GetSpendReport(tenant.ID, s.fx.BaseCurrency(tenant), since, loc)
+	if err != nil {
+		log.Printf("Failed to compute spend report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute spend report",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"spend":  report,
+		"status": "success",
+	})
+}
+
+// putTenantBaseCurrency sets the ISO 4217 currency a tenant's amounts are
+// converted into, or with {"base_currency": null} returns the tenant to the
+// server's. Amounts already converted keep their currency until their
+// documents are analyzed again.
+func (s *Server) putTenantBaseCurrency(c *gin.Context) {
+	var req struct {
+		BaseCurrency *string `json:"base_currency"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.BaseCurrency != nil {
+		currency := services.NormalizeCurrency(*req.BaseCurrency)
+		if currency == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "base_currency must be an ISO 4217 currency code such as EUR",
+				"status": "error",
+			})
+			return
+		}
+		req.BaseCurrency = &currency
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err == nil {
+		err = s.store.UpdateTenantBaseCurrency(tenant.ID, req.BaseCurrency)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update base currency for tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update base currency",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant.BaseCurrency = req.BaseCurrency
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":        tenant.Slug,
+		"base_currency": s.fx.BaseCurrency(tenant),
+		"default":       req.BaseCurrency == nil,
+		"status":        "success",
+	})
+}
@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportGraph streams the document–entity–vendor graph of the documents
+// changed since a watermark as GraphML. Like the document export it takes
+// since or a cursor and a limit, and the graph's cursor data is the
+// watermark for the next, incremental export. Requests with X-Tenant only
+// export that tenant's documents.
+func (s *Server) exportGraph(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	if format := c.DefaultQuery("format", "graphml"); format != "graphml" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "format must be graphml",
+			"status": "error",
+		})
+		return
+	}
+
+	var cursor services.ExportCursor
+	if value := c.Query("cursor"); value != "" {
+		cursor, err = services.ParseExportCursor(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Invalid cursor",
+				"status": "error",
+			})
+			return
+		}
+	} else if value := c.Query("since"); value != "" {
+		since, err := parseQueryTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+		cursor.UpdatedAt = since
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "limit must be a positive integer",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/graphml+xml")
+	c.Header("Content-Disposition", `attachment; filename="documents.graphml"`)
+	c.Status(http.StatusOK)
+	graph := services.NewGraphMLWriter(c.Writer)
+
+	count := 0
+	more := false
+	for {
+		pageSize := exportPageSize
+		if limit > 0 && limit-count < pageSize {
+			pageSize = limit - count
+		}
+		exports, err := s.store.ExportDocuments(cursor, tenantID, pageSize)
+		if err != nil {
+			// The status has been sent; the graph ends early with the
+			// cursor of the last document written, to resume from
+			log.Printf("Graph export failed after %d documents: %v", count, err)
+			more = true
+			break
+		}
+		for _, export := range exports {
+			if err := graph.WriteDocument(services.NewDocumentGraph(export)); err != nil {
+				log.Printf("Graph export interrupted after %d documents: %v", count, err)
+				return
+			}
+			cursor = services.ExportCursor{UpdatedAt: export.Document.UpdatedAt, ID: export.Document.ID}
+			count++
+		}
+		c.Writer.Flush()
+
+		if len(exports) < pageSize {
+			break
+		}
+		if limit > 0 && count >= limit {
+			more = true
+			break
+		}
+		if c.Request.Context().Err() != nil {
+			log.Printf("Graph export cancelled after %d documents", count)
+			return
+		}
+	}
+
+	log.Printf("Exported the graph of %d documents", count)
+	graph.Close(cursor.String(), count, more)
+}
+
+// RunGraphSync periodically writes the graph of the documents changed since
+// the last sync to Neo4j. It returns when ctx is cancelled.
+func (s *Server) RunGraphSync(ctx context.Context) {
+	if err := s.graph.EnsureSchema(ctx); err != nil {
+		log.Printf("Failed to create Neo4j constraints: %v", err)
+	}
+
+	ticker := time.NewTicker(s.graph.Interval())
+	defer ticker.Stop()
+
+	for {
+		s.syncGraph(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncGraph writes every document to Neo4j when no full sync finished yet,
+// then follows the change feed, writing the documents that changed and
+// removing those deleted. The cursor is saved after every batch, so a sync
+// interrupted by an error or a new leader resumes where it stopped.
+func (s *Server) syncGraph(ctx context.Context) {
+	state, err := s.store.GetGraphSyncState()
+	if err != nil {
+		log.Printf("Failed to read graph sync state: %v", err)
+		return
+	}
+
+	if state.Cursor == nil {
+		// Changes made while the full sync runs are in the feed, which is
+		// then followed from its start; writing a document twice is harmless
+		written, err := s.syncAllDocuments(ctx)
+		state.Documents += int64(written)
+		if err != nil {
+			s.saveGraphSyncError(state, err)
+			return
+		}
+		now := time.Now()
+		state.Cursor = &services.ChangeCursor{}
+		state.FullSyncedAt = &now
+		state.SyncedAt = &now
+		state.LastError = nil
+		if err := s.store.SaveGraphSyncState(state); err != nil {
+			log.Printf("Failed to save graph sync state: %v", err)
+			return
+		}
+		log.Printf("Synced the graph of %d documents to Neo4j", written)
+	}
+
+	batch := s.graph.BatchSize()
+	for ctx.Err() == nil {
+		changes, err := s.store.GetChanges(*state.Cursor, nil, batch)
+		if err != nil {
+			log.Printf("Failed to read changes for the graph sync: %v", err)
+			return
+		}
+		if len(changes) == 0 {
+			return
+		}
+
+		var ids []services.DocumentID
+		seen := map[services.DocumentID]bool{}
+		for _, change := range changes {
+			if change.DocumentID != nil && !seen[*change.DocumentID] {
+				seen[*change.DocumentID] = true
+				ids = append(ids, *change.DocumentID)
+			}
+		}
+		written, err := s.writeGraph(ctx, ids)
+		if err != nil {
+			s.saveGraphSyncError(state, err)
+			return
+		}
+
+		now := time.Now()
+		cursor := changes[len(changes)-1].Cursor()
+		state.Cursor = &cursor
+		state.SyncedAt = &now
+		state.Documents += int64(written)
+		state.LastError = nil
+		if err := s.store.SaveGraphSyncState(state); err != nil {
+			log.Printf("Failed to save graph sync state: %v", err)
+			return
+		}
+		if len(changes) < batch {
+			return
+		}
+	}
+}
+
+// syncAllDocuments writes the graph of every document, in batches
+func (s *Server) syncAllDocuments(ctx context.Context) (int, error) {
+	var cursor services.ExportCursor
+	written := 0
+	for ctx.Err() == nil {
+		exports, err := s.store.ExportDocuments(cursor, nil, s.graph.BatchSize())
+		if err != nil {
+			return written, err
+		}
+		if len(exports) == 0 {
+			break
+		}
+		graphs := make([]*services.DocumentGraph, len(exports))
+		for i, export := range exports {
+			graphs[i] = services.NewDocumentGraph(export)
+		}
+		if err := s.graph.WriteDocuments(ctx, graphs, nil); err != nil {
+			return written, err
+		}
+		written += len(exports)
+		last := exports[len(exports)-1].Document
+		cursor = services.ExportCursor{UpdatedAt: last.UpdatedAt, ID: last.ID}
+	}
+	return written, ctx.Err()
+}
+
+// writeGraph writes the documents that still exist and removes the others
+func (s *Server) writeGraph(ctx context.Context, ids []services.DocumentID) (int, error) {
+	exports, err := s.store.ExportDocumentsByID(ids)
+	if err != nil {
+		return 0, err
+	}
+	graphs := make([]*services.DocumentGraph, len(exports))
+	present := map[services.DocumentID]bool{}
+	for i, export := range exports {
+		graphs[i] = services.NewDocumentGraph(export)
+		present[export.Document.ID] = true
+	}
+	var deleted []services.DocumentID
+	for _, id := range ids {
+		if !present[id] {
+			deleted = append(deleted, id)
+		}
+	}
+	return len(exports), s.graph.WriteDocuments(ctx, graphs, deleted)
+}
+
+func (s *Server) saveGraphSyncError(state *services.GraphSyncState, err error) {
+	log.Printf("Graph sync to Neo4j failed: %v", err)
+	message := err.Error()
+	state.LastError = &message
+	if err := s.store.SaveGraphSyncState(state); err != nil {
+		log.Printf("Failed to save graph sync state: %v", err)
+	}
+}
+
+// getGraphSync reports how far the sync to Neo4j got
+func (s *Server) getGraphSync(c *gin.Context) {
+	state, err := s.store.GetGraphSyncState()
+	if err != nil {
+		log.Printf("Failed to read graph sync state: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to read graph sync state",
+			"status": "error",
+		})
+		return
+	}
+	response := gin.H{
+		"enabled":    s.graph.Enabled(),
+		"graph_sync": state,
+		"status":     "success",
+	}
+	if state.Cursor != nil {
+		response["cursor"] = state.Cursor.String()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// resetGraphSync makes the next sync write every document again, for a new
+// or emptied Neo4j database, or after the sync fell further behind than the
+// change feed's retention
+func (s *Server) resetGraphSync(c *gin.Context) {
+	if !s.graph.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Graph sync requires NEO4J_URL",
+			"status": "error",
+		})
+		return
+	}
+	state, err := s.store.GetGraphSyncState()
+	if err == nil {
+		state.Cursor = nil
+		err = s.store.SaveGraphSyncState(state)
+	}
+	if err != nil {
+		log.Printf("Failed to reset graph sync: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to reset graph sync",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Graph sync reset; the next sync writes every document")
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "The next sync writes every document",
+		"status":  "success",
+	})
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkBusinessDays records a non_business_day_date detection when the
+// document is dated on a weekend or holiday of its tenant's calendar
+func (s *Server) checkBusinessDays(document *services.Document, tenant *services.Tenant) {
+	if tenant == nil || tenant.HolidayCalendar == nil {
+		return
+	}
+	calendar, err := s.store.GetHolidayCalendar(*tenant.HolidayCalendar, 0)
+	if err != nil {
+		log.Printf("Failed to load holiday calendar %s of document %s: %v", *tenant.HolidayCalendar, document.ID, err)
+		return
+	}
+	if factor := services.NonBusinessDayDates(document, tenant.DocumentFields, calendar); factor != nil {
+		s.recordRiskFactors(document, []services.RiskFactor{*factor})
+	}
+}
+
+// getHolidayCalendars lists the holiday calendars without their holidays
+func (s *Server) getHolidayCalendars(c *gin.Context) {
+	calendars, err := s.store.GetHolidayCalendars()
+	if err != nil {
+		log.Printf("Failed to get holiday calendars: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to get holiday calendars",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holiday_calendars": calendars,
+		"status":            "success",
+	})
+}
+
+// getHolidayCalendar returns a holiday calendar with its holidays, only
+// those of year when it is given
+func (s *Server) getHolidayCalendar(c *gin.Context) {
+	var req struct {
+		Year int `form:"year" binding:"omitempty,min=1900,max=9999"`
+	}
+	if !bindQuery(c, &req) {
+		return
+	}
+	calendar, err := s.store.GetHolidayCalendar(services.NormalizeHolidayCalendarCode(c.Param("code")), req.Year)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Holiday calendar not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get holiday calendar %s: %v", c.Param("code"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to get holiday calendar",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holiday_calendar": calendar,
+		"status":           "success",
+	})
+}
+
+// putHolidayCalendar creates or replaces a holiday calendar. Holidays, when
+// given, replace the calendar's; left out they are kept.
+func (s *Server) putHolidayCalendar(c *gin.Context) {
+	var calendar services.HolidayCalendar
+	if err := c.ShouldBindJSON(&calendar); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a holiday calendar",
+			"status": "error",
+		})
+		return
+	}
+	calendar.Code = c.Param("code")
+
+	err := s.store.SaveHolidayCalendar(&calendar)
+	if respondHolidayCalendarError(c, err) {
+		return
+	}
+	saved, err := s.store.GetHolidayCalendar(calendar.Code, 0)
+	if err != nil {
+		log.Printf("Failed to get holiday calendar %s: %v", calendar.Code, err)
+		saved = &calendar
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holiday_calendar": saved,
+		"status":           "success",
+	})
+}
+
+// putHoliday adds a holiday on :date to a calendar, or renames it
+func (s *Server) putHoliday(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	holiday := &services.Holiday{Date: c.Param("date"), Name: req.Name}
+	err := s.store.SaveHoliday(services.NormalizeHolidayCalendarCode(c.Param("code")), holiday)
+	if respondHolidayCalendarError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holiday_calendar": services.NormalizeHolidayCalendarCode(c.Param("code")),
+		"holiday":          holiday,
+		"status":           "success",
+	})
+}
+
+// deleteHoliday removes the holiday on :date from a calendar
+func (s *Server) deleteHoliday(c *gin.Context) {
+	err := s.store.DeleteHoliday(services.NormalizeHolidayCalendarCode(c.Param("code")), c.Param("date"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Holiday not found",
+			"status": "error",
+		})
+		return
+	}
+	if respondHolidayCalendarError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Holiday deleted",
+		"status":  "success",
+	})
+}
+
+// deleteHolidayCalendar deletes a calendar no tenant uses
+func (s *Server) deleteHolidayCalendar(c *gin.Context) {
+	err := s.store.DeleteHolidayCalendar(services.NormalizeHolidayCalendarCode(c.Param("code")))
+	if errors.Is(err, services.ErrHolidayCalendarInUse) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Holiday calendar is used by tenants",
+			"status": "error",
+		})
+		return
+	}
+	if respondHolidayCalendarError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Holiday calendar deleted",
+		"status":  "success",
+	})
+}
+
+// respondHolidayCalendarError responds to a failed change of a holiday
+// calendar and reports whether it did
+func respondHolidayCalendarError(c *gin.Context, err error) bool {
+	var calendarErr *services.HolidayCalendarError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &calendarErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid holiday calendar",
+			"problems": calendarErr.Problems,
+			"status":   "error",
+		})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Holiday calendar not found",
+			"status": "error",
+		})
+	default:
+		log.Printf("Failed to update holiday calendar %s: %v", c.Param("code"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update holiday calendar",
+			"status": "error",
+		})
+	}
+	return true
+}
+
+// putTenantHolidayCalendar sets the calendar of a tenant's business days, or
+// with {"holiday_calendar": null} leaves it without one
+func (s *Server) putTenantHolidayCalendar(c *gin.Context) {
+	var req struct {
+		HolidayCalendar *string `json:"holiday_calendar"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.HolidayCalendar != nil {
+		code := services.NormalizeHolidayCalendarCode(*req.HolidayCalendar)
+		req.HolidayCalendar = &code
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err == nil {
+		err = s.store.UpdateTenantHolidayCalendar(tenant.ID, req.HolidayCalendar)
+	}
+	switch {
+	case errors.Is(err, services.ErrUnknownHolidayCalendar):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "holiday_calendar must be the code of a holiday calendar",
+			"status": "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update holiday calendar for tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update holiday calendar",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":           tenant.Slug,
+		"holiday_calendar": req.HolidayCalendar,
+		"default":          req.HolidayCalendar == nil,
+		"status":           "success",
+	})
+}
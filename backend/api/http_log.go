@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logHTTP writes a sample of requests and their responses to the HTTP log,
+// with their bodies scrubbed. Bodies are captured as the handler reads and
+// writes them, so a request body the handler never reads is not logged.
+func (s *Server) logHTTP(c *gin.Context) {
+	if !s.httpLog.Sample(c.FullPath()) {
+		c.Next()
+		return
+	}
+	start := time.Now()
+	maxBody := s.httpLog.MaxBodyBytes()
+	var request *capturingBody
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		request = &capturingBody{ReadCloser: c.Request.Body, max: maxBody}
+		c.Request.Body = request
+	}
+	response := &capturingWriter{ResponseWriter: c.Writer, max: maxBody}
+	c.Writer = response
+	c.Next()
+	c.Writer = response.ResponseWriter
+
+	entry := &services.HTTPLogEntry{
+		Time:         start.UTC(),
+		Method:       c.Request.Method,
+		Route:        c.FullPath(),
+		Path:         c.Request.URL.Path,
+		Query:        services.ScrubQuery(c.Request.URL.Query()),
+		Tenant:       c.GetHeader(TenantHeader),
+		Status:       c.Writer.Status(),
+		DurationMS:   float64(time.Since(start).Microseconds()) / 1000,
+		ResponseBody: services.ScrubBody(c.Writer.Header().Get("Content-Type"), response.body.Bytes(), response.size),
+	}
+	if request != nil {
+		entry.RequestBody = services.ScrubBody(c.ContentType(), request.body.Bytes(), request.size)
+	}
+	if err := s.httpLog.Write(entry); err != nil {
+		logging.HTTP.Errorf("Failed to write HTTP log: %v", err)
+	}
+}
+
+// capturingBody keeps the first max bytes read from a request body
+type capturingBody struct {
+	io.ReadCloser
+	max  int
+	size int64
+	body bytes.Buffer
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	if room := b.max - b.body.Len(); room > 0 {
+		b.body.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// capturingWriter keeps the first max bytes of a response body
+type capturingWriter struct {
+	gin.ResponseWriter
+	max  int
+	size int64
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(data)
+	w.size += int64(n)
+	if room := w.max - w.body.Len(); room > 0 {
+		w.body.Write(data[:min(n, room)])
+	}
+	return n, err
+}
+
+func (w *capturingWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
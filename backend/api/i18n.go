@@ -0,0 +1,295 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// localizerKey caches the localizer of a request in its context
+const localizerKey = "localizer"
+
+// requestLocalizer translates into the language of the request: the X-User
+// user's, or else the tenant's of the user, auditor grant or X-Tenant, or
+// else the first of Accept-Language that can be shown, or else the
+// server's default. Languages without a bundle any more are skipped.
+func (s *Server) requestLocalizer(c *gin.Context) services.Localizer {
+	if cached, ok := c.Get(localizerKey); ok {
+		return cached.(services.Localizer)
+	}
+
+	var candidates []string
+	var tenantID *string
+	if id := c.GetHeader(UserHeader); services.IsUUID(id) {
+		if user, err := s.store.GetUser(id); err == nil {
+			if user.Language != nil {
+				candidates = append(candidates, *user.Language)
+			}
+			tenantID = user.TenantID
+		}
+	}
+	if grant, ok := c.Get(auditorGrantKey); ok && tenantID == nil {
+		tenantID = &grant.(*services.AuditorGrant).TenantID
+	}
+	var tenant *services.Tenant
+	if tenantID != nil {
+		tenant, _ = s.store.GetTenant(*tenantID)
+	} else if slug := c.GetHeader(TenantHeader); slug != "" {
+		tenant, _ = s.store.GetTenantBySlug(slug)
+	}
+	if tenant != nil && tenant.Language != nil {
+		candidates = append(candidates, *tenant.Language)
+	}
+	candidates = append(candidates, acceptedLanguages(c.GetHeader("Accept-Language"))...)
+
+	language := s.i18n.DefaultLanguage()
+	for _, candidate := range candidates {
+		if supported := s.i18n.Supported(candidate); supported != "" {
+			language = supported
+			break
+		}
+	}
+	localizer := s.i18n.Localizer(language)
+	c.Set(localizerKey, localizer)
+	return localizer
+}
+
+// acceptedLanguages lists the languages of an Accept-Language header, most
+// preferred first, leaving out the wildcard and those refused with q=0
+func acceptedLanguages(header string) []string {
+	type accepted struct {
+		language string
+		quality  float64
+	}
+	var languages []accepted
+	for _, part := range strings.Split(header, ",") {
+		language, params, _ := strings.Cut(part, ";")
+		language = strings.TrimSpace(language)
+		if language == "" || language == "*" {
+			continue
+		}
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		if quality > 0 {
+			languages = append(languages, accepted{language, quality})
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].quality > languages[j].quality })
+
+	names := make([]string, len(languages))
+	for i, accepted := range languages {
+		names[i] = accepted.language
+	}
+	return names
+}
+
+// localizeErrors translates the error of JSON error responses into the
+// language of the request. Handlers write errors in English as usual; the
+// responses are held back until the handler returns, and only when bundles
+// are loaded.
+func (s *Server) localizeErrors(c *gin.Context) {
+	if !s.i18n.Translating() {
+		c.Next()
+		return
+	}
+	writer := &localizingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+	c.Writer = writer.ResponseWriter
+	if !writer.holding {
+		return
+	}
+
+	body := writer.body.Bytes()
+	var response map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&response) == nil {
+		if message, ok := response["error"].(string); ok {
+			localizer := s.requestLocalizer(c)
+			if translated := localizer.T(message); translated != message {
+				response["error"] = translated
+				if encoded, err := json.Marshal(response); err == nil {
+					body = encoded
+					c.Header("Content-Language", localizer.Language)
+				}
+			}
+		}
+	}
+	if _, err := c.Writer.Write(body); err != nil {
+		log.Printf("Failed to write error response: %v", err)
+	}
+}
+
+// localizingWriter holds back the body of a JSON error response
+type localizingWriter struct {
+	gin.ResponseWriter
+	holding bool
+	body    bytes.Buffer
+}
+
+func (w *localizingWriter) Write(data []byte) (int, error) {
+	if !w.holding && !w.ResponseWriter.Written() && w.Status() >= http.StatusBadRequest &&
+		strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		w.holding = true
+	}
+	if w.holding {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *localizingWriter) WriteString(data string) (int, error) {
+	return w.Write([]byte(data))
+}
+
+// Written reports a held-back response as written, so it is not written
+// twice
+func (w *localizingWriter) Written() bool {
+	return w.holding || w.ResponseWriter.Written()
+}
+
+// Flush sends what was written, unless it is held back
+func (w *localizingWriter) Flush() {
+	if !w.holding {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// respondUnsupportedLanguage refuses a language no message can be shown in
+func (s *Server) respondUnsupportedLanguage(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":     "Unsupported language",
+		"languages": s.i18n.Languages(),
+		"status":    "error",
+	})
+}
+
+// getLanguages lists the languages messages can be shown in
+func (s *Server) getLanguages(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"languages": s.i18n.Languages(),
+		"default":   s.i18n.DefaultLanguage(),
+		"status":    "success",
+	})
+}
+
+// reloadLanguages reads the translation bundles again, so translations are
+// added and corrected without a restart. Bundles that do not load leave
+// the ones in use.
+func (s *Server) reloadLanguages(c *gin.Context) {
+	languages, err := s.i18n.Reload()
+	if err != nil {
+		log.Printf("Failed to reload translation bundles: %v", err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":  "Failed to reload translation bundles",
+			"detail": err.Error(),
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Reloaded translation bundles: %s", strings.Join(languages, ", "))
+	c.JSON(http.StatusOK, gin.H{
+		"languages": languages,
+		"default":   s.i18n.DefaultLanguage(),
+		"status":    "success",
+	})
+}
+
+// putTenantLanguage sets the language a tenant's users read messages in,
+// or with {"language": null} returns the tenant to the server's default
+func (s *Server) putTenantLanguage(c *gin.Context) {
+	var req struct {
+		Language *string `json:"language"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Language != nil {
+		if s.i18n.Supported(*req.Language) == "" {
+			s.respondUnsupportedLanguage(c)
+			return
+		}
+		*req.Language = services.NormalizeLanguage(*req.Language)
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err == nil {
+		err = s.store.UpdateTenantLanguage(tenant.ID, req.Language)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update language for tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update language",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":   tenant.Slug,
+		"language": req.Language,
+		"status":   "success",
+	})
+}
+
+// putUserLanguage sets the language a user reads messages in, or with
+// {"language": null} leaves it to their tenant
+func (s *Server) putUserLanguage(c *gin.Context) {
+	var req struct {
+		Language *string `json:"language"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Language != nil {
+		if s.i18n.Supported(*req.Language) == "" {
+			s.respondUnsupportedLanguage(c)
+			return
+		}
+		*req.Language = services.NormalizeLanguage(*req.Language)
+	}
+
+	user, err := s.store.UpdateUserLanguage(c.Param("id"), req.Language)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "User not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update language of user %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update language",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":   user,
+		"status": "success",
+	})
+}
@@ -0,0 +1,404 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultImpersonationTTL is how long an impersonation session lasts unless
+// the admin asks for up to eight hours
+const defaultImpersonationTTL = time.Hour
+
+// Response headers of impersonated requests, so clients can show a banner
+// on every page
+const (
+	ImpersonationHeader  = "X-Impersonation"
+	ImpersonatedByHeader = "X-Impersonated-By"
+)
+
+// impersonationKey is the context key of a request's impersonation session
+const impersonationKey = "impersonation"
+
+// startImpersonation starts a session in which the X-User admin acts as a
+// tenant's user. Only admins may start one, only for the users of tenants
+// that consent to it, and never for another admin. The token is in the
+// response only; it cannot be retrieved later.
+func (s *Server) startImpersonation(c *gin.Context) {
+	var req struct {
+		UserID  string `json:"user_id" binding:"required,uuid"`
+		Reason  string `json:"reason" binding:"required,notblank,max=500"`
+		Minutes int    `json:"minutes" binding:"omitempty,min=1,max=480"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	admin, err := s.requestUser(c)
+	if err != nil && !errors.Is(err, errUnknownUser) {
+		log.Printf("Failed to load user %s: %v", c.GetHeader(UserHeader), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to start impersonation",
+			"status": "error",
+		})
+		return
+	}
+	if admin == nil || admin.Role != services.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  UserHeader + " must be an admin to impersonate users",
+			"status": "error",
+		})
+		return
+	}
+
+	user, err := s.store.GetUser(req.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "User not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load user %s: %v", req.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to start impersonation",
+			"status": "error",
+		})
+		return
+	}
+	switch {
+	case user.TenantID == nil:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Only users of a tenant can be impersonated",
+			"status": "error",
+		})
+		return
+	case user.Role == services.RoleAdmin:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "Admins cannot be impersonated",
+			"status": "error",
+		})
+		return
+	case admin.TenantID != nil && *admin.TenantID != *user.TenantID:
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "Admins of a tenant can only impersonate its users",
+			"status": "error",
+		})
+		return
+	}
+
+	ttl := defaultImpersonationTTL
+	if req.Minutes > 0 {
+		ttl = time.Duration(req.Minutes) * time.Minute
+	}
+	session := &services.Impersonation{
+		TenantID:   *user.TenantID,
+		AdminID:    admin.ID,
+		AdminEmail: admin.Email,
+		UserID:     user.ID,
+		UserEmail:  user.Email,
+		Reason:     strings.TrimSpace(req.Reason),
+		ExpiresAt:  time.Now().Add(ttl).UTC(),
+	}
+	token, digest, err := services.NewImpersonationToken()
+	if err == nil {
+		err = s.store.StartImpersonation(session, digest, clientIP(c))
+	}
+	if errors.Is(err, services.ErrImpersonationNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "Tenant does not allow impersonation",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to start impersonation of user %s: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to start impersonation",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Admin %s started impersonating user %s until %s (session %s)",
+		admin.ID, user.ID, session.ExpiresAt.Format(time.RFC3339), session.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"impersonation": session,
+		"banner":        session.Banner(),
+		"token":         token,
+		"status":        "success",
+	})
+}
+
+// getImpersonations lists a tenant's impersonation sessions, newest first
+func (s *Server) getImpersonations(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	var sessions []*services.Impersonation
+	if err == nil {
+		sessions, err = s.store.GetImpersonations(tenant.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to list impersonation sessions of tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve impersonation sessions",
+			"status": "error",
+		})
+		return
+	}
+
+	now := time.Now()
+	active := 0
+	for _, session := range sessions {
+		if session.Active(now) {
+			active++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"impersonations":      sessions,
+		"allow_impersonation": tenant.AllowImpersonation,
+		"total":               len(sessions),
+		"active":              active,
+		"status":              "success",
+	})
+}
+
+// stopImpersonation ends an impersonation session at once
+func (s *Server) stopImpersonation(c *gin.Context) {
+	s.endImpersonation(c, c.Param("id"))
+}
+
+// stopOwnImpersonation ends the impersonation session the request is made
+// in, so the admin can stop without the admin token
+func (s *Server) stopOwnImpersonation(c *gin.Context) {
+	session := requestImpersonation(c)
+	if session == nil {
+		respondNotImpersonating(c)
+		return
+	}
+	s.endImpersonation(c, session.ID)
+}
+
+func (s *Server) endImpersonation(c *gin.Context, id string) {
+	session, err := s.store.EndImpersonation(id, time.Now(), clientIP(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Impersonation session not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to end impersonation %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to end impersonation",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Ended impersonation %s of user %s by admin %s", session.ID, session.UserID, session.AdminID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"impersonation": session,
+		"status":        "success",
+	})
+}
+
+// getOwnImpersonation describes the impersonation session the request is
+// made in, with the banner to show
+func (s *Server) getOwnImpersonation(c *gin.Context) {
+	session := requestImpersonation(c)
+	if session == nil {
+		respondNotImpersonating(c)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"impersonation": session,
+		"banner":        session.Banner(),
+		"status":        "success",
+	})
+}
+
+func respondNotImpersonating(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "Request is not made in an impersonation session",
+		"status": "error",
+	})
+}
+
+// impersonate runs requests bearing an impersonation token as the session's
+// user: X-User and X-Tenant are replaced with the user's, the response is
+// marked with the session and its admin, and every request, refused ones
+// included, is added to the audit log under both the admin and the user
+func (s *Server) impersonate(c *gin.Context) {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, services.ImpersonationTokenPrefix) {
+		c.Next()
+		return
+	}
+	session, err := s.store.GetImpersonationByToken(services.TokenDigest(token))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to look up impersonation session: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to verify impersonation token",
+			"status": "error",
+		})
+		return
+	}
+	if session == nil || !session.Active(time.Now()) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error":  "Invalid, expired or ended impersonation token",
+			"status": "error",
+		})
+		if session != nil {
+			s.recordImpersonatedRequest(c, session)
+		}
+		return
+	}
+	tenant, err := s.store.GetTenant(session.TenantID)
+	if err != nil {
+		log.Printf("Failed to load tenant of impersonation %s: %v", session.ID, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to verify impersonation token",
+			"status": "error",
+		})
+		return
+	}
+
+	c.Request.Header.Set(UserHeader, session.UserID)
+	c.Request.Header.Set(TenantHeader, tenant.Slug)
+	c.Header(ImpersonationHeader, session.ID)
+	c.Header(ImpersonatedByHeader, session.AdminEmail)
+	c.Set(impersonationKey, session)
+	c.Next()
+	s.recordImpersonatedRequest(c, session)
+}
+
+// recordImpersonatedRequest adds a request made in an impersonation session
+// to the audit log
+func (s *Server) recordImpersonatedRequest(c *gin.Context, session *services.Impersonation) {
+	details := session.AuditDetails()
+	details["method"] = c.Request.Method
+	details["path"] = c.Request.URL.Path
+	details["status"] = c.Writer.Status()
+	if err := s.store.RecordImpersonatedRequest(session, details, clientIP(c)); err != nil {
+		log.Printf("Failed to audit impersonated request %s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+}
+
+// requestImpersonation is the impersonation session of a request, or nil
+// for requests made without one
+func requestImpersonation(c *gin.Context) *services.Impersonation {
+	if session, ok := c.Get(impersonationKey); ok {
+		return session.(*services.Impersonation)
+	}
+	return nil
+}
+
+// clientIP is the request's client address for the audit log
+func clientIP(c *gin.Context) *string {
+	if ip := c.ClientIP(); ip != "" {
+		return &ip
+	}
+	return nil
+}
+
+// getTenantImpersonationConsent reports whether a tenant allows support
+// staff to impersonate its users. Only the tenant's admin changes it.
+func (s *Server) getTenantImpersonationConsent(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve impersonation consent",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":              tenant.Slug,
+		"allow_impersonation": tenant.AllowImpersonation,
+		"status":              "success",
+	})
+}
+
+// putImpersonationConsent records whether the X-Tenant tenant allows support
+// staff to impersonate its users, for the X-User admin of the tenant.
+// Withdrawing consent ends the sessions still open.
+func (s *Server) putImpersonationConsent(c *gin.Context) {
+	var req struct {
+		AllowImpersonation *bool `json:"allow_impersonation" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	if tenant == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  TenantHeader + " header is required",
+			"status": "error",
+		})
+		return
+	}
+	admin, err := s.requestUser(c)
+	if err != nil && !errors.Is(err, errUnknownUser) {
+		log.Printf("Failed to load user %s: %v", c.GetHeader(UserHeader), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update impersonation consent",
+			"status": "error",
+		})
+		return
+	}
+	if admin == nil || admin.Role != services.RoleAdmin || admin.TenantID == nil || *admin.TenantID != tenant.ID {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  UserHeader + " must be an admin of the tenant to change its impersonation consent",
+			"status": "error",
+		})
+		return
+	}
+
+	ended, err := s.store.UpdateTenantImpersonationConsent(tenant.ID, *req.AllowImpersonation, time.Now())
+	if err != nil {
+		log.Printf("Failed to update impersonation consent for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update impersonation consent",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Admin %s set impersonation consent of tenant %s to %t, ending %d sessions", admin.ID, tenant.Slug, *req.AllowImpersonation, ended)
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":              tenant.Slug,
+		"allow_impersonation": *req.AllowImpersonation,
+		"sessions_ended":      ended,
+		"status":              "success",
+	})
+}
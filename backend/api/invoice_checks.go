@@ -0,0 +1,82 @@
+package api
+
+import (
+	"log"
+
+	"frauddocai-backend/services"
+)
+
+// vendorHistoryLimit is how many of a vendor's earlier documents their bank
+// details are taken from
+const vendorHistoryLimit = 20
+
+// checkInvoiceConsistency records the invoice checks of a document's text
+// and entities: totals that do not add up, an invoice number the tenant
+// already received from the vendor, and IBANs the vendor did not use
+// before. Documents without a tenant are only checked for their totals, so
+// that documents of different customers are never compared.
+func (s *Server) checkInvoiceConsistency(document *services.Document, text string, entities []string) {
+	var factors []services.RiskFactor
+	if factor := services.TotalMismatch(text); factor != nil {
+		factors = append(factors, *factor)
+	}
+	if document.TenantID != nil {
+		scope := services.DocumentScope{TenantID: document.TenantID}
+		if filters := services.InvoiceNumberFilters(document); filters != nil {
+			others, err := s.store.GetDocuments(vendorHistoryLimit, 0, filters, services.SubmissionFilter{}, scope)
+			if err != nil {
+				log.Printf("Failed to look up invoice number of document %s: %v", document.ID, err)
+			} else if factor := services.DuplicateInvoiceNumber(document, others); factor != nil {
+				factors = append(factors, *factor)
+			}
+		}
+		if factor := s.checkBankDetails(document, entities, scope); factor != nil {
+			factors = append(factors, *factor)
+		}
+	}
+	s.recordRiskFactors(document, factors)
+}
+
+// checkBankDetails compares the IBANs of a document with those of its
+// vendor's earlier documents in scope
+func (s *Server) checkBankDetails(document *services.Document, entities []string, scope services.DocumentScope) *services.RiskFactor {
+	vendor, _ := document.Metadata["vendor"].(string)
+	if vendor == "" {
+		return nil
+	}
+	var ibans []string
+	for _, entity := range entities {
+		if kind, value, ok := services.ParseEntity(entity); ok && kind == "iban" {
+			ibans = append(ibans, value)
+		}
+	}
+	if len(ibans) == 0 {
+		return nil
+	}
+
+	earlier, err := s.store.GetDocuments(vendorHistoryLimit, 0,
+		[]services.MetadataFilter{{Key: "vendor", Value: vendor}}, services.SubmissionFilter{}, scope)
+	if err != nil {
+		log.Printf("Failed to look up vendor documents of document %s: %v", document.ID, err)
+		return nil
+	}
+	var known []string
+	seen := map[string]bool{}
+	for _, other := range earlier {
+		if other.ID == document.ID || other.CreatedAt.After(document.CreatedAt) {
+			continue
+		}
+		otherEntities, err := s.store.GetDocumentEntities(other.ID)
+		if err != nil {
+			log.Printf("Failed to get entities of document %s: %v", other.ID, err)
+			return nil
+		}
+		for _, entity := range otherEntities {
+			if entity.Kind == "iban" && !seen[entity.Value] {
+				seen[entity.Value] = true
+				known = append(known, entity.Value)
+			}
+		}
+	}
+	return services.BankDetailsChange(vendor, ibans, known)
+}
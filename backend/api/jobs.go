@@ -0,0 +1,239 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+)
+
+// workerID names this process as the owner of the pipeline jobs it claims
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// enqueuePipeline queues a pipeline run of the document for the workers of
+// any replica. If the queue cannot be written the run happens here instead,
+// so the document is still processed.
+func (s *Server) enqueuePipeline(document *services.Document, reuseText bool) {
+	if err := s.store.EnqueuePipelineJob(document.ID, reuseText); err != nil {
+		logging.Pipeline.Warnf("Processing document %s without the job queue: %v", document.ID, err)
+		go s.runPipeline(context.Background(), s.newPipelineRun(document, reuseText))
+		return
+	}
+	s.wakePipelineWorker()
+}
+
+func (s *Server) wakePipelineWorker() {
+	select {
+	case s.jobsQueued <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Server) newPipelineRun(document *services.Document, reuseText bool) *pipelineRun {
+	run := &pipelineRun{document: document}
+	if reuseText && document.ExtractedText != nil {
+		run.text, run.extracted = *document.ExtractedText, true
+	}
+	return run
+}
+
+// RunPipelineWorker claims queued pipeline jobs, shared with the workers of
+// every other replica, and runs up to PIPELINE_WORKERS of them at once. On
+// start it first queues documents whose pipeline was lost. When ctx is
+// cancelled it stops claiming and gives the running pipelines
+// PIPELINE_SHUTDOWN_GRACE to finish; those still running then are stopped
+// and returned to the queue, for another replica to resume.
+func (s *Server) RunPipelineWorker(ctx context.Context) {
+	owner := workerID()
+	s.queueStalledDocuments()
+
+	// Jobs outlive ctx by the shutdown grace, so they get their own context
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	var running sync.WaitGroup
+	slots := make(chan struct{}, s.pipeline.Workers)
+	ticker := time.NewTicker(s.pipeline.PollInterval)
+	defer ticker.Stop()
+
+claim:
+	for {
+		// During maintenance running pipelines finish but no more are claimed
+		if free := cap(slots) - len(slots); free > 0 && !s.InMaintenance() {
+			jobs, err := s.store.ClaimPipelineJobs(owner, s.pipeline.LeaseDuration, free)
+			if err != nil {
+				logging.Pipeline.Errorf("Failed to claim pipeline jobs: %v", err)
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				running.Add(1)
+				go func(job *services.PipelineJob) {
+					defer func() {
+						<-slots
+						running.Done()
+						// Claim the next job without waiting for the ticker
+						s.wakePipelineWorker()
+					}()
+					s.runPipelineJob(jobsCtx, owner, job)
+				}(job)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			break claim
+		case <-ticker.C:
+		case <-s.jobsQueued:
+		}
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(s.pipeline.ShutdownGrace):
+		logging.Pipeline.Infof("Returning %d running pipelines to the queue", len(slots))
+		stopJobs()
+		<-finished
+	}
+}
+
+// queueStalledDocuments queues the pipelines of documents left uploaded for
+// longer than PIPELINE_STALE_AFTER without a job
+func (s *Server) queueStalledDocuments() {
+	jobs, err := s.store.QueueStalledDocuments(time.Now().Add(-s.pipeline.StaleAfter))
+	if err != nil {
+		logging.Pipeline.Errorf("Failed to queue stalled documents: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		metrics.PipelineRecovered.WithLabelValues("stale_document", recoveryMode(job)).Inc()
+	}
+	if len(jobs) > 0 {
+		logging.Pipeline.Infof("Queued the pipelines of %d stalled documents", len(jobs))
+	}
+}
+
+// recoveryMode tells whether a recovered job resumes from stored text or
+// restarts with extraction
+func recoveryMode(job *services.PipelineJob) string {
+	if job.ReuseText {
+		return "resumed"
+	}
+	return "restarted"
+}
+
+// runPipelineJob runs a claimed job, renewing its lease until the pipeline
+// finishes. If the lease is lost the pipeline is cancelled and the job left
+// to the worker that claimed it next; if ctx is cancelled the job is
+// returned to the queue. A job whose analysis did not succeed is kept as
+// failed, so it is not recovered again.
+func (s *Server) runPipelineJob(ctx context.Context, owner string, job *services.PipelineJob) {
+	if job.Attempts > 1 {
+		metrics.PipelineJobs.WithLabelValues("reclaimed").Inc()
+		metrics.PipelineRecovered.WithLabelValues("lease_expired", recoveryMode(job)).Inc()
+		logging.Pipeline.Infof("Resuming pipeline of document %s, attempt %d", job.DocumentID, job.Attempts)
+	} else {
+		metrics.PipelineJobs.WithLabelValues("claimed").Inc()
+	}
+	if job.Attempts > s.pipeline.MaxAttempts {
+		s.failPipelineJob(owner, job, "worker stopped before finishing too often")
+		logging.Pipeline.Errorf("Giving up on the pipeline of document %s after %d unfinished attempts", job.DocumentID, job.Attempts-1)
+		return
+	}
+
+	document, err := s.store.GetDocument(job.DocumentID)
+	if err != nil {
+		s.failPipelineJob(owner, job, err.Error())
+		logging.Pipeline.Errorf("Failed to load document %s for its pipeline: %v", job.DocumentID, err)
+		return
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	leaseLost := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(s.pipeline.LeaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			renewed, err := s.store.RenewPipelineJobLease(job.ID, owner, s.pipeline.LeaseDuration)
+			if err != nil {
+				// Try again at the next tick; the lease is still valid
+				logging.Pipeline.Warnf("Failed to renew the pipeline lease of document %s: %v", job.DocumentID, err)
+				continue
+			}
+			if !renewed {
+				metrics.PipelineJobs.WithLabelValues("lease_lost").Inc()
+				logging.Pipeline.Warnf("Lost the pipeline lease of document %s; stopping its pipeline", job.DocumentID)
+				close(leaseLost)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	run := s.newPipelineRun(document, job.ReuseText)
+	run.checkpoint = func() {
+		// The job may only resume from text that is stored
+		if err := s.store.UpdateDocumentExtractedText(document.ID, run.text); err != nil {
+			logging.Pipeline.Errorf("Failed to store the extracted text of document %s: %v", document.ID, err)
+			return
+		}
+		if err := s.store.CheckpointPipelineJob(job.ID, owner); err != nil {
+			logging.Pipeline.Errorf("Failed to checkpoint the pipeline job of document %s: %v", document.ID, err)
+		}
+	}
+	results := s.runPipeline(jobCtx, run)
+
+	select {
+	case <-leaseLost:
+		return
+	default:
+	}
+	if ctx.Err() != nil {
+		metrics.PipelineJobs.WithLabelValues("released").Inc()
+		if err := s.store.ReleasePipelineJob(job.ID, owner); err != nil {
+			logging.Pipeline.Errorf("Failed to return the pipeline job of document %s to the queue: %v", job.DocumentID, err)
+		}
+		return
+	}
+	for _, result := range results {
+		if result.Stage != services.StageAIAnalysis || result.Outcome == services.StageSucceeded {
+			continue
+		}
+		reason := result.Error
+		if reason == "" {
+			reason = "analysis " + result.Outcome + " after a failed dependency"
+		}
+		s.failPipelineJob(owner, job, reason)
+		return
+	}
+	if err := s.store.CompletePipelineJob(job.ID, owner); err != nil {
+		logging.Pipeline.Errorf("Failed to complete the pipeline job of document %s: %v", job.DocumentID, err)
+	}
+}
+
+func (s *Server) failPipelineJob(owner string, job *services.PipelineJob, reason string) {
+	metrics.PipelineJobs.WithLabelValues("failed").Inc()
+	if err := s.store.FailPipelineJob(job.ID, owner, reason); err != nil {
+		logging.Pipeline.Errorf("Failed to record failed pipeline job of document %s: %v", job.DocumentID, err)
+	}
+}
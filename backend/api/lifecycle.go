@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// archiveBatchSize bounds the documents archived per pass
+const archiveBatchSize = 50
+
+// RunStorageLifecycle periodically moves documents that have not been
+// uploaded or restored within the archive period to the archive tier. It
+// returns when ctx is cancelled.
+func (s *Server) RunStorageLifecycle(ctx context.Context) {
+	ticker := time.NewTicker(s.lifecycle.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.archiveDueDocuments(ctx); n > 0 {
+				log.Printf("Archived %d documents", n)
+			}
+		}
+	}
+}
+
+// archiveDueDocuments runs one pass and returns the number of documents
+// archived
+func (s *Server) archiveDueDocuments(ctx context.Context) int {
+	documents, err := s.store.GetDocumentsToArchive(time.Now().Add(-s.lifecycle.ArchiveAfter), archiveBatchSize)
+	if err != nil {
+		log.Printf("Failed to load documents to archive: %v", err)
+		return 0
+	}
+
+	archived := 0
+	for _, document := range documents {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.moveDocumentFile(ctx, document, services.StorageTierHot, services.StorageTierArchived, services.StorageTierHot); err != nil {
+			log.Printf("Failed to archive document %s: %v", document.ID, err)
+			continue
+		}
+		archived++
+	}
+	return archived
+}
+
+// moveDocumentFile copies the document's file from the store of tier from to
+// the store of tier to, records the document as being in tier to and then
+// releases the original, which is deleted unless other documents share it.
+// source is the tier the document must still be in for the move to be
+// recorded. The original is kept if anything fails, so a file is never
+// without a copy.
+func (s *Server) moveDocumentFile(ctx context.Context, document *services.Document, from, to, source string) error {
+	region := documentRegion(document)
+	src, err := s.storage.ForTier(region, from)
+	if err != nil {
+		return err
+	}
+	dst, err := s.storage.ForTier(region, to)
+	if err != nil {
+		return err
+	}
+
+	// The file is only copied when no other document has it in tier to
+	first, err := s.acquireObject(region, to, document.FilePath)
+	if err != nil {
+		return err
+	}
+	if first {
+		if err := copyFile(ctx, src, dst, document); err != nil {
+			s.releaseObject(ctx, region, to, document.FilePath)
+			return fmt.Errorf("failed to copy file from %s to %s: %v", from, to, err)
+		}
+	}
+
+	changed, err := s.store.UpdateDocumentStorageTier(document.ID, source, to)
+	if err == nil && !changed {
+		err = fmt.Errorf("document left the %s tier during the move", source)
+	}
+	if err != nil {
+		s.releaseObject(ctx, region, to, document.FilePath)
+		return fmt.Errorf("failed to record storage tier: %v", err)
+	}
+	metrics.StorageTierTransitions.WithLabelValues(to).Inc()
+
+	s.releaseObject(ctx, region, from, document.FilePath)
+	return nil
+}
+
+func copyFile(ctx context.Context, src, dst services.ObjectStorage, document *services.Document) error {
+	reader, err := src.GetFile(ctx, document.FilePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return dst.UploadFile(ctx, document.FilePath, reader, document.FileSize, document.MimeType)
+}
+
+// restoreDocument copies an archived document back to the hot tier in the
+// background. Nothing is done when the document is no longer archived, for
+// example because another request already started the restore.
+func (s *Server) restoreDocument(document *services.Document) error {
+	started, err := s.store.UpdateDocumentStorageTier(document.ID, services.StorageTierArchived, services.StorageTierRestoring)
+	if err != nil || !started {
+		return err
+	}
+
+	go func() {
+		ctx := context.Background()
+		err := s.moveDocumentFile(ctx, document, services.StorageTierArchived, services.StorageTierHot, services.StorageTierRestoring)
+		if err == nil {
+			log.Printf("Restored document %s from the archive tier", document.ID)
+			return
+		}
+		log.Printf("Failed to restore document %s: %v", document.ID, err)
+		// Leave it archived so the next download request retries
+		if _, err := s.store.UpdateDocumentStorageTier(document.ID, services.StorageTierRestoring, services.StorageTierArchived); err != nil {
+			log.Printf("Failed to reset storage tier of document %s: %v", document.ID, err)
+		}
+	}()
+	return nil
+}
+
+// getDocumentDownloadURL returns the URL of a document's file. Archived
+// documents are restored first: the response is 202 with a Retry-After
+// estimate until the file is back in the hot tier.
+func (s *Server) getDocumentDownloadURL(c *gin.Context) {
+	document := scopedDocument(c)
+	switch document.StorageTier {
+	case services.StorageTierArchived:
+		if err := s.restoreDocument(document); err != nil {
+			log.Printf("Failed to start restoring document %s: %v", document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to restore document from archive",
+				"status": "error",
+			})
+			return
+		}
+		s.respondRestoring(c, document, s.lifecycle.RestoreLatency)
+
+	case services.StorageTierRestoring:
+		remaining := s.lifecycle.RestoreLatency
+		if document.TierChangedAt != nil {
+			remaining -= time.Since(*document.TierChangedAt)
+		}
+		s.respondRestoring(c, document, remaining)
+
+	default:
+		store, err := s.storage.ForRegion(documentRegion(document))
+		if err != nil {
+			log.Printf("Failed to select storage for document %s: %v", document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Storage region unavailable",
+				"status": "error",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"document_id":  document.ID,
+			"url":          store.GetFileURL(document.FilePath),
+			"storage_tier": services.StorageTierHot,
+			"status":       "success",
+		})
+	}
+}
+
+func (s *Server) respondRestoring(c *gin.Context, document *services.Document, wait time.Duration) {
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusAccepted, gin.H{
+		"document_id":  document.ID,
+		"storage_tier": services.StorageTierRestoring,
+		"retry_after":  retryAfter,
+		"message":      "Document is being restored from the archive tier",
+		"status":       "success",
+	})
+}
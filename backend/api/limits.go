@@ -0,0 +1,81 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadRoutes accept file uploads. Every other route takes small JSON
+// bodies and gets the much lower limits.
+var uploadRoutes = map[string]bool{
+	"/api/v1/documents/upload":   true,
+	"/api/v2/documents/upload":   true,
+	"/api/v1/cases/:id/evidence": true,
+	"/api/v2/cases/:id/evidence": true,
+}
+
+// limitRequestBody caps the size of the request body and the time the
+// client has to send it, so that a client trickling or streaming an endless
+// body cannot hold a connection and a handler goroutine indefinitely
+func (s *Server) limitRequestBody(c *gin.Context) {
+	limit, timeout := s.http.MaxBodyBytes, s.http.BodyTimeout
+	if uploadRoutes[c.FullPath()] {
+		limit, timeout = s.http.MaxUploadBytes, s.http.UploadTimeout
+	}
+
+	if c.Request.ContentLength > limit {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":     "Request body too large",
+			"max_bytes": limit,
+			"status":    "error",
+		})
+		return
+	}
+	if c.Request.Body == nil || c.Request.Body == http.NoBody {
+		c.Next()
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	if timeout > 0 {
+		// The deadline is lifted once the body has been read: net/http
+		// cancels the request context when a read deadline passes, which
+		// must not cut off a handler that is still working. It stays when
+		// the body is left unread, so that net/http gives up discarding
+		// the rest of a slow body after the response.
+		rc := http.NewResponseController(c.Writer)
+		if err := rc.SetReadDeadline(time.Now().Add(timeout)); err == nil {
+			body = &deadlineBody{ReadCloser: body, rc: rc}
+		}
+	}
+	c.Request.Body = body
+	c.Next()
+}
+
+// deadlineBody lifts the read deadline when the body has been read to the
+// end
+type deadlineBody struct {
+	io.ReadCloser
+	rc *http.ResponseController
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.rc.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
+
+// respondBodyTooLarge reports a body cut off by limitRequestBody. Clients
+// sending chunked bodies only find out once the limit is reached.
+func respondBodyTooLarge(c *gin.Context, err *http.MaxBytesError) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":     "Request body too large",
+		"max_bytes": err.Limit,
+		"status":    "error",
+	})
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// link is the absolute URL of an API path, built on PUBLIC_BASE_URL so that
+// it works for whoever receives it outside the request, such as a reviewer
+// following a link in a notification email
+func (s *Server) link(path string) string {
+	return s.http.PublicBaseURL + "/api/v1" + path
+}
+
+// alertLinks are the links of webhooks about an alert
+func (s *Server) alertLinks(alert *services.Alert) gin.H {
+	links := gin.H{
+		"alert":       s.link("/alerts/" + alert.ID),
+		"escalations": s.link("/alerts/" + alert.ID + "/escalations"),
+	}
+	if alert.DocumentID != nil {
+		links["document"] = s.link("/documents/" + string(*alert.DocumentID))
+	}
+	return links
+}
+
+// approvalLinks are the links of webhooks about an approval: the endpoints
+// deciding it and, for alerts, its target
+func (s *Server) approvalLinks(approval *services.Approval) gin.H {
+	links := gin.H{
+		"approve": s.link("/approvals/" + approval.ID + "/approve"),
+		"reject":  s.link("/approvals/" + approval.ID + "/reject"),
+	}
+	if approval.Action == services.ApprovalCloseAlert {
+		links["alert"] = s.link("/alerts/" + approval.TargetID)
+	}
+	return links
+}
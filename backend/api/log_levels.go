@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// logLevelRefresh is how often a replica reads the log level overrides, so
+// that a change made on another replica applies within it
+const logLevelRefresh = 5 * time.Second
+
+// RunLogLevelSync applies the log level overrides stored for every replica
+// until ctx is done, returning components whose override expired or was
+// removed to their configured level
+func (s *Server) RunLogLevelSync(ctx context.Context) {
+	ticker := time.NewTicker(logLevelRefresh)
+	defer ticker.Stop()
+	for {
+		if _, err := s.syncLogLevels(); err != nil {
+			log.Printf("Keeping the current log levels: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncLogLevels applies the stored overrides and returns them by component
+func (s *Server) syncLogLevels() (map[string]*services.LogLevelOverride, error) {
+	overrides, err := s.store.GetLogLevelOverrides(time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	byComponent := make(map[string]*services.LogLevelOverride, len(overrides))
+	levels := make(map[string]logging.Level, len(overrides))
+	for _, override := range overrides {
+		level, err := logging.ParseLevel(override.Level)
+		if _, known := logging.Lookup(override.Component); err != nil || !known {
+			// Left by another version of the backend
+			continue
+		}
+		byComponent[override.Component] = override
+		levels[override.Component] = level
+	}
+
+	before := currentLogLevels()
+	logging.Apply(levels)
+	for component, level := range currentLogLevels() {
+		if level != before[component] {
+			log.Printf("Log level of %s changed from %s to %s", component, before[component], level)
+		}
+	}
+	return byComponent, nil
+}
+
+func currentLogLevels() map[string]logging.Level {
+	levels := map[string]logging.Level{}
+	for _, component := range logging.Components() {
+		l, _ := logging.Lookup(component)
+		levels[component] = l.Level()
+	}
+	return levels
+}
+
+// getLogLevels lists the level of each component: the one in force, the one
+// configured and any override
+func (s *Server) getLogLevels(c *gin.Context) {
+	overrides, err := s.syncLogLevels()
+	if err != nil {
+		log.Printf("Failed to retrieve log level overrides: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve log levels",
+			"status": "error",
+		})
+		return
+	}
+
+	components := []gin.H{}
+	for _, component := range logging.Components() {
+		l, _ := logging.Lookup(component)
+		components = append(components, gin.H{
+			"component":  component,
+			"level":      l.Level().String(),
+			"configured": l.Configured().String(),
+			"override":   overrides[component],
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"components": components,
+		"status":     "success",
+	})
+}
+
+// putLogLevel overrides the log level of a component on every replica,
+// for expires_in seconds when given
+func (s *Server) putLogLevel(c *gin.Context) {
+	l, ok := logging.Lookup(c.Param("component"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":      "Unknown log component",
+			"components": logging.Components(),
+			"status":     "error",
+		})
+		return
+	}
+	var req struct {
+		Level     string `json:"level" binding:"required,notblank"`
+		ExpiresIn *int   `json:"expires_in" binding:"omitempty,min=60,max=604800"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	level, err := logging.ParseLevel(req.Level)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  err.Error(),
+			"status": "error",
+		})
+		return
+	}
+
+	override := &services.LogLevelOverride{Component: l.Name(), Level: level.String()}
+	if req.ExpiresIn != nil {
+		expiresAt := time.Now().UTC().Add(time.Duration(*req.ExpiresIn) * time.Second)
+		override.ExpiresAt = &expiresAt
+	}
+	if err := s.store.SetLogLevelOverride(override); err != nil {
+		log.Printf("Failed to set log level of %s: %v", l.Name(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to set log level",
+			"status": "error",
+		})
+		return
+	}
+
+	// This replica applies the change at once; the others within
+	// logLevelRefresh
+	if _, err := s.syncLogLevels(); err != nil {
+		log.Printf("Log level of %s stored but not yet applied: %v", l.Name(), err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"component":  l.Name(),
+		"level":      l.Level().String(),
+		"configured": l.Configured().String(),
+		"override":   override,
+		"status":     "success",
+	})
+}
+
+// deleteLogLevel returns a component to its configured log level on every
+// replica
+func (s *Server) deleteLogLevel(c *gin.Context) {
+	l, ok := logging.Lookup(c.Param("component"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":      "Unknown log component",
+			"components": logging.Components(),
+			"status":     "error",
+		})
+		return
+	}
+	if _, err := s.store.DeleteLogLevelOverride(l.Name()); err != nil {
+		log.Printf("Failed to reset log level of %s: %v", l.Name(), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to reset log level",
+			"status": "error",
+		})
+		return
+	}
+	if _, err := s.syncLogLevels(); err != nil {
+		log.Printf("Log level of %s reset but not yet applied: %v", l.Name(), err)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"component":  l.Name(),
+		"level":      l.Level().String(),
+		"configured": l.Configured().String(),
+		"override":   nil,
+		"status":     "success",
+	})
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maintenanceRefresh is how long a replica relies on the maintenance mode it
+// read last, so that a change made on another replica applies within it
+const maintenanceRefresh = 5 * time.Second
+
+// defaultMaintenanceMessage is shown to refused writes without a message
+const defaultMaintenanceMessage = "The service is undergoing maintenance; changes are paused. Please try again later."
+
+// maintenanceState caches the shared maintenance mode
+type maintenanceState struct {
+	mu     sync.Mutex
+	mode   services.Maintenance
+	readAt time.Time
+}
+
+// currentMaintenance returns the maintenance mode, read again from the
+// store once maintenanceRefresh has passed. When it cannot be read the last
+// known mode stays in force.
+func (s *Server) currentMaintenance() services.Maintenance {
+	s.maintenance.mu.Lock()
+	defer s.maintenance.mu.Unlock()
+
+	if time.Since(s.maintenance.readAt) >= maintenanceRefresh {
+		mode, err := s.store.GetMaintenance()
+		if err != nil {
+			log.Printf("Keeping maintenance mode %t: %v", s.maintenance.mode.Enabled, err)
+		} else {
+			s.maintenance.mode = *mode
+		}
+		s.maintenance.readAt = time.Now()
+	}
+	return s.maintenance.mode
+}
+
+// InMaintenance reports whether maintenance mode is enabled. Background
+// work pauses while it is.
+func (s *Server) InMaintenance() bool {
+	return s.currentMaintenance().Enabled
+}
+
+// maintenanceRoutes may change data during maintenance: the mode itself, to
+// end it, and logging in, so an operator can still sign in to do so
+var maintenanceRoutes = map[string]bool{
+	"/api/v1/admin/maintenance": true,
+	"/api/v2/admin/maintenance": true,
+	"/api/v1/users/login":       true,
+	"/api/v2/users/login":       true,
+}
+
+// refuseWritesInMaintenance answers every request but reads with 503 while
+// maintenance mode is enabled
+func (s *Server) refuseWritesInMaintenance(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if maintenanceRoutes[c.FullPath()] {
+		c.Next()
+		return
+	}
+
+	mode := s.currentMaintenance()
+	if !mode.Enabled {
+		c.Next()
+		return
+	}
+	message := defaultMaintenanceMessage
+	if mode.Message != nil {
+		message = *mode.Message
+	}
+	c.Header("Retry-After", strconv.Itoa(mode.RetryAfter))
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+		"error":       message,
+		"maintenance": true,
+		"retry_after": mode.RetryAfter,
+		"status":      "error",
+	})
+}
+
+// getMaintenance returns the maintenance mode with the pipelines still
+// running on any replica, which a migration waits for
+func (s *Server) getMaintenance(c *gin.Context) {
+	mode, err := s.store.GetMaintenance()
+	var backlog *services.PipelineBacklog
+	if err == nil {
+		backlog, err = s.store.GetPipelineBacklog(etaWindow)
+	}
+	if err != nil {
+		log.Printf("Failed to retrieve maintenance mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve maintenance mode",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"maintenance": mode,
+		"pipelines": gin.H{
+			"queued":  backlog.Queued,
+			"running": backlog.Running,
+		},
+		"status": "success",
+	})
+}
+
+// putMaintenance enables or disables maintenance mode on every replica
+func (s *Server) putMaintenance(c *gin.Context) {
+	var req struct {
+		Enabled    *bool   `json:"enabled" binding:"required"`
+		Message    *string `json:"message" binding:"omitempty,max=500"`
+		RetryAfter *int    `json:"retry_after" binding:"omitempty,min=1,max=86400"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	mode := &services.Maintenance{Enabled: *req.Enabled, RetryAfter: 300}
+	if req.Message != nil && strings.TrimSpace(*req.Message) != "" {
+		mode.Message = req.Message
+	}
+	if req.RetryAfter != nil {
+		mode.RetryAfter = *req.RetryAfter
+	}
+	if err := s.store.SetMaintenance(mode); err != nil {
+		log.Printf("Failed to set maintenance mode: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to set maintenance mode",
+			"status": "error",
+		})
+		return
+	}
+
+	// This replica applies the change at once; the others within
+	// maintenanceRefresh
+	s.maintenance.mu.Lock()
+	s.maintenance.mode, s.maintenance.readAt = *mode, time.Now()
+	s.maintenance.mu.Unlock()
+	if mode.Enabled {
+		log.Printf("Maintenance mode enabled; writes are refused and background work pauses")
+	} else {
+		log.Printf("Maintenance mode disabled")
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"maintenance": mode,
+		"status":      "success",
+	})
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultModelPerformanceDays is how far back model performance trends look
+// by default
+const defaultModelPerformanceDays = 30
+
+// RunModelDriftMonitor periodically compares each model version's recent
+// analyses with its baseline, exporting the comparison as metrics. A
+// measure that starts drifting raises the model.drift_detected webhook once,
+// until it settles again. Analyses past the retention are deleted. It
+// returns when ctx is cancelled.
+func (s *Server) RunModelDriftMonitor(ctx context.Context) {
+	ticker := time.NewTicker(s.drift.Interval)
+	defer ticker.Stop()
+
+	drifting := map[services.ModelKey]map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.checkModelDrift(drifting)
+			n, err := s.store.PurgeAnalysisObservations(time.Now().Add(-s.drift.Retention))
+			if err != nil {
+				log.Printf("Failed to purge analysis observations: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d analysis observations", n)
+			}
+		}
+	}
+}
+
+// checkModelDrift runs one drift check. drifting holds the measures of each
+// model version that drifted at the last check, and is updated.
+func (s *Server) checkModelDrift(drifting map[services.ModelKey]map[string]bool) {
+	drifts, err := s.modelDrift(time.Now())
+	if err != nil {
+		log.Printf("Failed to check model drift: %v", err)
+		return
+	}
+
+	metrics.ModelDriftScorePSI.Reset()
+	metrics.ModelDriftConfidenceChange.Reset()
+	metrics.ModelDriftDetectionRateChange.Reset()
+	metrics.ModelDrifted.Reset()
+	checked := map[services.ModelKey]bool{}
+	for _, drift := range drifts {
+		checked[drift.ModelKey] = true
+		labels := []string{drift.Provider, drift.ModelVersion}
+		metrics.ModelDriftScorePSI.WithLabelValues(labels...).Set(drift.ScorePSI)
+		if drift.ConfidenceChange != nil {
+			metrics.ModelDriftConfidenceChange.WithLabelValues(labels...).Set(*drift.ConfidenceChange)
+		}
+		metrics.ModelDriftDetectionRateChange.WithLabelValues(labels...).Set(drift.DetectionRateChange)
+
+		was := drifting[drift.ModelKey]
+		now := map[string]bool{}
+		var started []string
+		for _, measure := range []string{services.DriftScore, services.DriftConfidence, services.DriftDetectionRate} {
+			metrics.ModelDrifted.WithLabelValues(drift.Provider, drift.ModelVersion, measure).Set(0)
+		}
+		for _, measure := range drift.Drifted {
+			now[measure] = true
+			metrics.ModelDrifted.WithLabelValues(drift.Provider, drift.ModelVersion, measure).Set(1)
+			if !was[measure] {
+				started = append(started, measure)
+				metrics.ModelDriftAlerts.WithLabelValues(drift.Provider, drift.ModelVersion, measure).Inc()
+			}
+		}
+		drifting[drift.ModelKey] = now
+
+		if len(started) > 0 {
+			log.Printf("Model %s %q drifted: %s (score PSI %.3f, detection rate change %+.3f)",
+				drift.Provider, drift.ModelVersion, strings.Join(started, ", "), drift.ScorePSI, drift.DetectionRateChange)
+			s.emitWebhook(services.WebhookModelDrifted, nil, gin.H{"measures": started, "drift": drift})
+		}
+	}
+	// Model versions no longer compared, such as retired ones, start afresh
+	for key := range drifting {
+		if !checked[key] {
+			delete(drifting, key)
+		}
+	}
+}
+
+// modelDrift compares the analyses of the drift window ending at now with
+// those of the baseline period before it
+func (s *Server) modelDrift(now time.Time) ([]*services.ModelDrift, error) {
+	windowStart := now.Add(-s.drift.Window)
+	recent, err := s.store.GetModelStats(windowStart, now)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := s.store.GetModelStats(windowStart.Add(-s.drift.Baseline), windowStart)
+	if err != nil {
+		return nil, err
+	}
+	return services.CompareModelStats(recent, baseline, s.drift), nil
+}
+
+// getModelPerformance reports each model version's fraud score
+// distribution, mean pattern confidence and detection rate by UTC day over
+// the last days, and how its analyses of the drift window compare with its
+// baseline
+func (s *Server) getModelPerformance(c *gin.Context) {
+	var query struct {
+		Days int `form:"days" binding:"omitempty,min=1,max=365"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	if query.Days == 0 {
+		query.Days = defaultModelPerformanceDays
+	}
+
+	now := time.Now().UTC()
+	since := now.AddDate(0, 0, -query.Days)
+	performance, err := s.store.GetModelPerformance(since)
+	var drifts []*services.ModelDrift
+	if err == nil {
+		drifts, err = s.modelDrift(now)
+	}
+	if err != nil {
+		log.Printf("Failed to compute model performance: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute model performance",
+			"status": "error",
+		})
+		return
+	}
+	if performance == nil {
+		performance = []*services.ModelPerformance{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"since":  since,
+		"models": performance,
+		"drift": gin.H{
+			"window_hours":   s.drift.Window.Hours(),
+			"baseline_hours": s.drift.Baseline.Hours(),
+			"thresholds":     driftThresholds(s.drift),
+			"models":         drifts,
+		},
+		"status": "success",
+	})
+}
+
+func driftThresholds(cfg config.DriftConfig) gin.H {
+	return gin.H{
+		"min_documents":  cfg.MinDocuments,
+		"score_psi":      cfg.ScorePSI,
+		"confidence":     cfg.Confidence,
+		"detection_rate": cfg.DetectionRate,
+	}
+}
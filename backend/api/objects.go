@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"frauddocai-backend/services"
+)
+
+// objectKey names the bucket an object is in for reference counting: the
+// region, with "" resolved to the default, and the hot or archive tier. A
+// document being restored still references its archived copy.
+func (s *Server) objectKey(region, tier string) (string, string) {
+	if region == "" {
+		region = s.storage.DefaultRegion()
+	}
+	if tier != services.StorageTierHot {
+		tier = services.StorageTierArchived
+	}
+	return region, tier
+}
+
+// acquireObject adds a reference to an object and reports whether it is the
+// first, in which case the caller stores the file
+func (s *Server) acquireObject(region, tier, name string) (bool, error) {
+	region, tier = s.objectKey(region, tier)
+	refs, err := s.store.AcquireStoredObject(region, tier, name)
+	if err != nil {
+		return false, err
+	}
+	return refs == 1, nil
+}
+
+// releaseObject drops a reference to an object and deletes the file once no
+// document references it. Failures are logged: a leftover file is harmless.
+func (s *Server) releaseObject(ctx context.Context, region, tier, name string) {
+	if _, err := s.deleteUnreferencedObject(ctx, region, tier, name); err != nil {
+		log.Printf("Failed to release object %s: %v", name, err)
+	}
+}
+
+// deleteUnreferencedObject drops a reference to an object and deletes the
+// file once no document references it. It reports whether the file was
+// deleted.
+func (s *Server) deleteUnreferencedObject(ctx context.Context, region, tier, name string) (bool, error) {
+	region, tier = s.objectKey(region, tier)
+	refs, err := s.store.ReleaseStoredObject(region, tier, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to release it in %s/%s: %v", region, tier, err)
+	}
+	if refs > 0 {
+		return false, nil
+	}
+	store, err := s.storage.ForTier(region, tier)
+	if err == nil {
+		err = store.DeleteFile(ctx, name)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete it from %s/%s: %v", region, tier, err)
+	}
+	return true, nil
+}
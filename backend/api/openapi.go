@@ -0,0 +1,20 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec describes the endpoints used by integrating services. The Go
+// client in client/ is generated from it.
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// getOpenAPISpec serves the OpenAPI spec, for generating clients in other
+// languages
+func getOpenAPISpec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml", openAPISpec)
+}
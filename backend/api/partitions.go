@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// expiredDocumentsBatch bounds the expired documents deleted per query
+const expiredDocumentsBatch = 200
+
+// RunPartitionMaintenance keeps the monthly partitions of the documents
+// table ahead of the calendar and, with a retention period, drops the
+// months that have expired after releasing their documents' files. It runs
+// at once and then every cfg.Interval, and returns when ctx is cancelled.
+func (s *Server) RunPartitionMaintenance(ctx context.Context, cfg config.PartitionConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.maintainPartitions(ctx, cfg)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) maintainPartitions(ctx context.Context, cfg config.PartitionConfig) {
+	now := time.Now()
+	created, err := s.store.CreateDocumentPartitions(now, cfg.Ahead, cfg.TenantPartitions)
+	if err != nil {
+		log.Printf("Failed to create document partitions: %v", err)
+	}
+	if len(created) > 0 {
+		metrics.DocumentPartitions.WithLabelValues("created").Add(float64(len(created)))
+		log.Printf("Created document partitions %s", strings.Join(created, ", "))
+	}
+	if cfg.RetentionMonths <= 0 {
+		return
+	}
+
+	expired, err := s.store.ExpireDocumentPartitions(now.AddDate(0, -cfg.RetentionMonths, 0))
+	if err != nil {
+		log.Printf("Failed to expire document partitions: %v", err)
+	}
+	if len(expired) > 0 {
+		metrics.DocumentPartitions.WithLabelValues("expired").Add(float64(len(expired)))
+		log.Printf("Expired document partitions %s", strings.Join(expired, ", "))
+	}
+
+	// Also finishes partitions expired by an earlier run that was stopped
+	deleted := 0
+	finished := false
+	for ctx.Err() == nil {
+		documents, err := s.store.DeleteExpiredDocuments(expiredDocumentsBatch)
+		if err != nil {
+			log.Printf("Failed to delete expired documents: %v", err)
+			break
+		}
+		if len(documents) == 0 {
+			finished = true
+			break
+		}
+		for _, document := range documents {
+			// A restoring file is still read from the archive tier
+			tier := document.StorageTier
+			if tier == services.StorageTierRestoring {
+				tier = services.StorageTierArchived
+			}
+			s.releaseObject(ctx, documentRegion(document), tier, document.FilePath)
+		}
+		metrics.ExpiredDocuments.Add(float64(len(documents)))
+		deleted += len(documents)
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d documents of expired partitions", deleted)
+	}
+	if finished && (len(expired) > 0 || deleted > 0) {
+		s.emitWebhook(services.WebhookRetentionPurged, nil, gin.H{
+			"target":            "documents",
+			"retention_months":  cfg.RetentionMonths,
+			"partitions":        expired,
+			"documents_deleted": deleted,
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadMemoryKey holds the bytes of the payload memory budget reserved for
+// the multipart form of an upload
+const uploadMemoryKey = "upload_memory"
+
+// trackPayloadMemory reports the most payload memory a request held at
+// once. Uploads are given a reservation of the budget for their file, up to
+// the spill size; a file that does not fit it is written to a temporary
+// file as the form is parsed.
+func (s *Server) trackPayloadMemory(c *gin.Context) {
+	ctx, tracker := services.WithMemoryTracker(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+
+	if uploadRoutes[c.FullPath()] {
+		reserved := s.spooler.SpillBytes()
+		if length := c.Request.ContentLength; length >= 0 && length < reserved {
+			reserved = length
+		}
+		if s.spooler.Budget().Reserve(ctx, reserved) {
+			defer s.spooler.Budget().Release(ctx, reserved)
+		} else {
+			metrics.PayloadSpills.WithLabelValues("budget").Inc()
+			reserved = 0
+		}
+		c.Set(uploadMemoryKey, reserved)
+	}
+
+	c.Next()
+
+	if peak := tracker.Peak(); peak > 0 {
+		metrics.RequestPayloadMemoryPeak.WithLabelValues(c.FullPath()).Observe(float64(peak))
+	}
+}
+
+// uploadedFile parses the multipart form of an upload within its memory
+// reservation and returns its file. It responds to c and returns false
+// when the body is too large or has no file.
+func (s *Server) uploadedFile(c *gin.Context) (multipart.File, *multipart.FileHeader, bool) {
+	// Without a reservation every file goes to disk
+	reserved := c.GetInt64(uploadMemoryKey)
+	err := c.Request.ParseMultipartForm(reserved)
+	var file multipart.File
+	var header *multipart.FileHeader
+	if err == nil {
+		file, header, err = c.Request.FormFile("file")
+	}
+	if err == nil && reserved > 0 && header.Size > reserved {
+		metrics.PayloadSpills.WithLabelValues("size").Inc()
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondBodyTooLarge(c, tooLarge)
+		return nil, nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "No file uploaded",
+			"status": "error",
+		})
+		return nil, nil, false
+	}
+	return file, header, true
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+)
+
+// pipelineRun is what the stages of one document's pipeline run hand each
+// other. Each field is written by one stage and only read by the stages
+// depending on it, so the fields need no locking.
+type pipelineRun struct {
+	document *services.Document
+	tenant   *services.Tenant
+
+	// text is analyzed; when extracted is false it is a placeholder, which
+	// is analyzed but not parsed, embedded or compared with exemplars, where
+	// it would match every other document of the same type
+	text        string
+	extracted   bool
+	riskFactors []services.RiskFactor
+	entities    []string
+	embedding   []float32
+
+	// checkpoint, when set, is called once the text is extracted
+	checkpoint func()
+}
+
+// runPipeline runs the processing pipeline configured for the document's
+// type and tenant, starting from text already extracted when run has it,
+// and returns the results of its stages.
+func (s *Server) runPipeline(ctx context.Context, run *pipelineRun) []services.StageResult {
+	document := run.document
+	tenantSlug := ""
+	tenant, err := s.tenantFor(document)
+	if err != nil {
+		// Run every stage rather than leave the document unprocessed
+		logging.Pipeline.Warnf("Running the full pipeline for document %s: %v", document.ID, err)
+	} else if tenant != nil {
+		run.tenant, tenantSlug = tenant, tenant.Slug
+	}
+
+	// Runs in the background report their payload memory on their own;
+	// those of a request count toward the request's
+	if services.MemoryTrackerFrom(ctx) == nil {
+		var tracker *services.MemoryTracker
+		ctx, tracker = services.WithMemoryTracker(ctx)
+		defer func() {
+			if peak := tracker.Peak(); peak > 0 {
+				metrics.RequestPayloadMemoryPeak.WithLabelValues("pipeline").Observe(float64(peak))
+			}
+		}()
+	}
+
+	started := time.Now()
+	results := s.pipelines.Run(ctx, document.DocumentType, tenantSlug, map[string]services.StageFunc{
+		services.StageExtraction:       run.extract(s),
+		services.StageFieldParsing:     run.parseFields(s),
+		services.StageRules:            run.applyRules(s),
+		services.StageAIAnalysis:       run.analyze(s),
+		services.StageEmbedding:        run.embed(s),
+		services.StageExemplarMatching: run.matchExemplars(s),
+	})
+
+	timings := make([]string, 0, len(results))
+	for _, result := range results {
+		switch result.Outcome {
+		case services.StageSucceeded:
+			timings = append(timings, result.Stage+"="+result.Duration.Round(time.Millisecond).String())
+		case services.StageFailed:
+			logging.Pipeline.Errorf("Pipeline stage %s failed for document %s after %d attempts: %s",
+				result.Stage, document.ID, result.Attempts, result.Error)
+			timings = append(timings, result.Stage+"=failed")
+		case services.StageSkipped:
+			metrics.PipelineStagesSkipped.WithLabelValues(result.Stage).Inc()
+			timings = append(timings, result.Stage+"=skipped")
+			continue
+		}
+		metrics.PipelineStageDuration.WithLabelValues(result.Stage, result.Outcome).Observe(result.Duration.Seconds())
+		if result.Attempts > 1 {
+			metrics.PipelineStageRetries.WithLabelValues(result.Stage).Add(float64(result.Attempts - 1))
+		}
+	}
+	logging.Pipeline.Infof("Pipeline for document %s finished in %v: %s",
+		document.ID, time.Since(started).Round(time.Millisecond), strings.Join(timings, " "))
+
+	if err := s.store.RecordPipelineRun(document.ID, services.NewPipelineStageRuns(started, results)); err != nil {
+		logging.Pipeline.Errorf("Failed to record pipeline run of document %s: %v", document.ID, err)
+	}
+	return results
+}
+
+// extract reads the text of the stored file unless it was extracted already.
+// Without text a placeholder is left for analysis.
+func (run *pipelineRun) extract(s *Server) services.StageFunc {
+	return func(ctx context.Context) error {
+		if run.extracted {
+			return nil
+		}
+		reader, err := s.openDocumentFile(ctx, run.document)
+		var extraction *services.Extraction
+		if err == nil {
+			extraction, err = s.extractors.Extract(ctx, run.document.MimeType, reader)
+			reader.Close()
+		}
+
+		if d := services.DiagnosticsFrom(ctx); d != nil && err == nil {
+			d.SetArtifact("extraction", extraction)
+		}
+
+		switch {
+		case err == nil:
+			run.text, run.extracted, run.riskFactors = extraction.Text, true, extraction.RiskFactors
+			s.storeDocumentPages(run.document, extraction)
+			if run.checkpoint != nil {
+				run.checkpoint()
+			}
+			return nil
+		case errors.Is(err, services.ErrExtractionUnsupported):
+			run.text = "Document content extraction not implemented for " + run.document.MimeType
+			return nil
+		default:
+			run.text = "Text extraction failed"
+			return err
+		}
+	}
+}
+
+func (run *pipelineRun) parseFields(s *Server) services.StageFunc {
+	return func(ctx context.Context) error {
+		if !run.extracted {
+			return nil
+		}
+		run.entities = services.ExtractEntities(run.text)
+		if err := s.store.ReplaceDocumentEntities(run.document.ID, run.entities); err != nil {
+			return err
+		}
+
+		// Fields the tenant added with an extract pattern are parsed into
+		// the metadata, unless the uploader supplied them
+		parsed := documentFieldsFor(run.tenant).Extract(run.document.DocumentType, run.text, run.document.Metadata)
+		if len(parsed) == 0 {
+			return nil
+		}
+		metadata, err := s.store.PatchDocumentMetadata(run.document.ID, parsed, nil)
+		var validationErr *services.MetadataValidationError
+		if errors.As(err, &validationErr) {
+			// The stored metadata no longer satisfies fields the tenant
+			// changed since the upload; a reviewer has to fix it first
+			logging.Pipeline.Warnf("Parsed fields of document %s not stored: %v", run.document.ID, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		run.document.Metadata = metadata
+		return nil
+	}
+}
+
+func (run *pipelineRun) applyRules(s *Server) services.StageFunc {
+	return func(ctx context.Context) error {
+		s.recordRiskFactors(run.document, run.riskFactors)
+		if run.extracted {
+			s.recordRiskFactors(run.document, s.reputation.Check(run.entities))
+			s.checkInvoiceConsistency(run.document, run.text, run.entities)
+		}
+		s.checkApprovalPolicy(run.document, run.tenant)
+		s.checkSubmissionVelocity(run.document)
+		s.checkBusinessDays(run.document, run.tenant)
+		amounts := s.convertAmounts(ctx, run.document, run.tenant)
+		s.checkVelocityRules(run.document, run.tenant, amounts)
+		return nil
+	}
+}
+
+// analyze scores the text, or only the new content of a bank statement of
+// a known account
+func (run *pipelineRun) analyze(s *Server) services.StageFunc {
+	return func(ctx context.Context) error {
+		plan, err := s.planStatementAnalysis(run)
+		if err != nil {
+			logging.Pipeline.Warnf("Analyzing statement %s whole: %v", run.document.ID, err)
+		}
+		if plan != nil {
+			return s.analyzeStatement(ctx, run, plan)
+		}
+		return s.analyzeDocumentForFraud(ctx, run.document, run.text, run.text)
+	}
+}
+
+func (run *pipelineRun) embed(s *Server) services.StageFunc {
+	return func(ctx context.Context) error {
+		if !run.extracted {
+			return nil
+		}
+		embedding, err := s.embedDocument(ctx, run.document.ID, run.text)
+		if err != nil {
+			return err
+		}
+		run.embedding = embedding
+		return nil
+	}
+}
+
+func (run *pipelineRun) matchExemplars(s *Server) services.StageFunc {
+	return func(ctx context.Context) error {
+		// Placeholder text can still match an exemplar by file hash
+		s.checkExemplars(run.document, run.entities, run.embedding)
+		return nil
+	}
+}
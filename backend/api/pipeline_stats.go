@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultPipelineStatsWindow is how far back pipeline statistics look by
+// default
+const defaultPipelineStatsWindow = 24 * time.Hour
+
+// getPipelineStats reports the p50 and p95 duration and the failure rate of
+// each pipeline stage, and the slowest stage. A since date starts at
+// midnight in tz, or else UTC.
+func (s *Server) getPipelineStats(c *gin.Context) {
+	loc, ok := statsLocation(c, nil)
+	if !ok {
+		return
+	}
+	since := time.Now().UTC().Add(-defaultPipelineStatsWindow)
+	if value := c.Query("since"); value != "" {
+		var err error
+		if since, err = parseQueryTimeIn(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	stats, err := s.store.GetPipelineStats(since)
+	if err != nil {
+		log.Printf("Failed to compute pipeline stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute pipeline statistics",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"stats":  stats,
+		"status": "success",
+	})
+}
@@ -0,0 +1,565 @@
+package api
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPrivacyListing bounds a page of legal holds or privacy requests
+const maxPrivacyListing = 500
+
+// dataSubjectRequest names the data subject of an export or erasure. The
+// subject is sent in the body rather than the URL so it stays out of access
+// logs.
+type dataSubjectRequest struct {
+	Kind   string `json:"kind" binding:"omitempty,max=20"`
+	Value  string `json:"value" binding:"required,notblank,max=500"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// bindDataSubject reads the request's subject and the X-User making it
+func (s *Server) bindDataSubject(c *gin.Context) (services.DataSubject, *dataSubjectRequest, *services.User, bool) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return services.DataSubject{}, nil, nil, false
+	}
+	var req dataSubjectRequest
+	if !bindJSON(c, &req) {
+		return services.DataSubject{}, nil, nil, false
+	}
+	subject := services.DataSubject{Kind: req.Kind, Value: req.Value}
+	if err := subject.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Invalid data subject: " + err.Error(),
+			"status": "error",
+		})
+		return subject, nil, nil, false
+	}
+	return subject, &req, user, true
+}
+
+// subjectDocuments finds the documents of the X-Tenant tenant, or of every
+// tenant, that mention the subject
+func (s *Server) subjectDocuments(c *gin.Context, subject services.DataSubject) (*string, []*services.Document, bool) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return nil, nil, false
+	}
+	var scope services.DocumentScope
+	if tenant != nil {
+		scope.TenantID = &tenant.ID
+	}
+
+	documents, err := s.store.FindSubjectDocuments(subject, scope)
+	if err != nil {
+		log.Printf("Failed to find documents of data subject: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to find the subject's documents",
+			"status": "error",
+		})
+		return nil, nil, false
+	}
+	return scope.TenantID, documents, true
+}
+
+// exportDataSubject streams a zip bundle of everything held on the documents
+// that mention a data subject: each document's record and extracted text,
+// its analysis, detections, entities and lifecycle events, and the original
+// file. manifest.json, written last, lists the documents and any part that
+// could not be exported.
+func (s *Server) exportDataSubject(c *gin.Context) {
+	subject, _, user, ok := s.bindDataSubject(c)
+	if !ok {
+		return
+	}
+	tenantID, documents, ok := s.subjectDocuments(c, subject)
+	if !ok {
+		return
+	}
+
+	request := &services.PrivacyRequest{
+		TenantID:      tenantID,
+		Kind:          services.PrivacyExport,
+		SubjectSHA256: subject.Digest(),
+		RequestedBy:   &user.ID,
+	}
+	if err := s.store.CreatePrivacyRequest(request); err != nil {
+		log.Printf("Failed to record privacy export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to record privacy request",
+			"status": "error",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="privacy-export-%s.zip"`, request.ID))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	bundle := zip.NewWriter(c.Writer)
+	var problems []string
+	listed := make([]gin.H, 0, len(documents))
+	for _, document := range documents {
+		file, err := s.exportBundleDocument(c.Request.Context(), bundle, document)
+		if err != nil {
+			log.Printf("Privacy export %s: document %s: %v", request.ID, document.ID, err)
+			problems = append(problems, fmt.Sprintf("document %s: %v", document.ID, err))
+		}
+		listed = append(listed, gin.H{
+			"id":                document.ID,
+			"original_filename": document.OriginalFilename,
+			"created_at":        document.CreatedAt,
+			"file":              file,
+		})
+	}
+
+	manifest := gin.H{
+		"request_id":   request.ID,
+		"subject":      subject,
+		"tenant_id":    tenantID,
+		"generated_at": time.Now().UTC(),
+		"documents":    listed,
+		"problems":     problems,
+	}
+	if err := writeBundleJSON(bundle, "manifest.json", manifest); err != nil {
+		log.Printf("Privacy export %s: failed to write manifest: %v", request.ID, err)
+	}
+	if err := bundle.Close(); err != nil {
+		log.Printf("Privacy export %s: failed to finish bundle: %v", request.ID, err)
+	}
+
+	request.Documents = len(documents)
+	request.Details = services.Metadata{"problems": len(problems)}
+	if err := s.store.CompletePrivacyRequest(request); err != nil {
+		log.Printf("Failed to record completion of privacy export %s: %v", request.ID, err)
+	}
+	log.Printf("User %s exported %d documents for privacy request %s", user.ID, len(documents), request.ID)
+}
+
+// exportBundleDocument writes one document's part of an export bundle and
+// returns the bundle path of its file, or "" when the file is missing
+func (s *Server) exportBundleDocument(ctx context.Context, bundle *zip.Writer, document *services.Document) (string, error) {
+	dir := "documents/" + document.ID.String() + "/"
+	if err := writeBundleJSON(bundle, dir+"document.json", document); err != nil {
+		return "", err
+	}
+
+	analysis, err := s.store.GetDocumentAnalysis(document.ID)
+	if err != nil {
+		return "", err
+	}
+	if analysis != nil {
+		err := writeBundleJSON(bundle, dir+"analysis.json", gin.H{
+			"emotion_analysis": rawAnalysis(analysis.EmotionAnalysis),
+			"pattern_analysis": rawAnalysis(analysis.PatternAnalysis),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	detections, err := s.store.GetFraudDetections(services.DetectionFilter{DocumentID: document.ID, Limit: 1000})
+	if err != nil {
+		return "", err
+	}
+	if err := writeBundleJSON(bundle, dir+"detections.json", detections); err != nil {
+		return "", err
+	}
+	entities, err := s.store.GetDocumentEntities(document.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := writeBundleJSON(bundle, dir+"entities.json", entities); err != nil {
+		return "", err
+	}
+	events, err := s.store.GetDocumentEvents(document.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := writeBundleJSON(bundle, dir+"events.json", events); err != nil {
+		return "", err
+	}
+
+	reader, err := s.openDocumentFile(ctx, document)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %v", err)
+	}
+	defer reader.Close()
+	filePath := dir + "file/" + bundleFilename(document.OriginalFilename)
+	w, err := bundle.Create(filePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(w, reader); err != nil {
+		return "", fmt.Errorf("failed to copy file: %v", err)
+	}
+	return filePath, nil
+}
+
+// bundleFilename is the base name of a client's file name, safe to use as a
+// path inside a bundle
+func bundleFilename(filename string) string {
+	name := path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if name == "." || name == ".." || name == "/" {
+		name = "original"
+	}
+	return name
+}
+
+func writeBundleJSON(bundle *zip.Writer, name string, value interface{}) error {
+	w, err := bundle.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// rawAnalysis embeds a stored analysis as JSON, or as a string if it is not
+// valid JSON
+func rawAnalysis(analysis *string) interface{} {
+	if analysis == nil {
+		return nil
+	}
+	if json.Valid([]byte(*analysis)) {
+		return json.RawMessage(*analysis)
+	}
+	return *analysis
+}
+
+// erasureResult is what became of one document of an erasure
+type erasureResult struct {
+	DocumentID      services.DocumentID `json:"document_id"`
+	Erased          bool                `json:"erased"`
+	RetainedBecause string              `json:"retained_because,omitempty"`
+	// File is "deleted", "shared" when another document still references
+	// the same stored file, or "failed"
+	File  string `json:"file,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// eraseDataSubject erases the documents that mention a data subject, with
+// their extracted text, analyses, detections, entities and files, and
+// redacts the data of their lifecycle events. Documents under legal hold,
+// or with a SAR draft, are retained. The erasure is then verified by
+// searching for the subject again. dry_run lists what would be erased.
+func (s *Server) eraseDataSubject(c *gin.Context) {
+	subject, req, user, ok := s.bindDataSubject(c)
+	if !ok {
+		return
+	}
+	tenantID, documents, ok := s.subjectDocuments(c, subject)
+	if !ok {
+		return
+	}
+	ids := make([]services.DocumentID, len(documents))
+	for i, document := range documents {
+		ids[i] = document.ID
+	}
+	retained, err := s.store.GetRetentionReasons(ids)
+	if err != nil {
+		log.Printf("Failed to check legal holds: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to check legal holds",
+			"status": "error",
+		})
+		return
+	}
+
+	if req.DryRun {
+		results := make([]erasureResult, len(documents))
+		for i, document := range documents {
+			reason := retained[document.ID]
+			results[i] = erasureResult{DocumentID: document.ID, Erased: reason == "", RetainedBecause: reason}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"dry_run":   true,
+			"documents": results,
+			"status":    "success",
+		})
+		return
+	}
+
+	request := &services.PrivacyRequest{
+		TenantID:      tenantID,
+		Kind:          services.PrivacyErase,
+		SubjectSHA256: subject.Digest(),
+		RequestedBy:   &user.ID,
+	}
+	if err := s.store.CreatePrivacyRequest(request); err != nil {
+		log.Printf("Failed to record privacy erasure: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to record privacy request",
+			"status": "error",
+		})
+		return
+	}
+
+	// Erasure goes on when the client disconnects, so that it is not left
+	// half done
+	ctx := context.Background()
+	results := make([]erasureResult, 0, len(documents))
+	var erased []services.DocumentID
+	failed := false
+	for _, document := range documents {
+		result := erasureResult{DocumentID: document.ID, RetainedBecause: retained[document.ID]}
+		if result.RetainedBecause == "" {
+			deleted, err := s.store.EraseDocument(document.ID, request.ID)
+			switch {
+			case errors.Is(err, services.ErrLegalHold):
+				// Held since the check above
+				result.RetainedBecause = "legal_hold"
+				retained[document.ID] = result.RetainedBecause
+			case errors.Is(err, sql.ErrNoRows):
+				// Deleted since it was found
+				result.Erased = true
+			case err != nil:
+				log.Printf("Privacy erasure %s: failed to erase document %s: %v", request.ID, document.ID, err)
+				result.Error = "failed to erase document"
+				failed = true
+			default:
+				result.Erased = true
+				erased = append(erased, document.ID)
+				result.File = "shared"
+				fileDeleted, err := s.deleteUnreferencedObject(ctx, documentRegion(deleted), deleted.StorageTier, deleted.FilePath)
+				if err != nil {
+					log.Printf("Privacy erasure %s: failed to delete file of document %s: %v", request.ID, document.ID, err)
+					result.File = "failed"
+					failed = true
+				} else if fileDeleted {
+					result.File = "deleted"
+				}
+			}
+		}
+		results = append(results, result)
+	}
+
+	problems := s.verifyErasure(subject, tenantID, erased, retained)
+	// Tokens of the subject in anonymized exports are untraceable once its
+	// vault entries go, unless documents naming it are kept
+	var pseudonymsDeleted int64
+	if len(retained) == 0 && !failed {
+		var err error
+		if pseudonymsDeleted, err = s.store.DeleteSubjectPseudonyms(subject); err != nil {
+			log.Printf("Privacy erasure %s: failed to delete pseudonyms: %v", request.ID, err)
+			problems = append(problems, "pseudonyms of the subject could not be deleted")
+		}
+	}
+	verified := !failed && len(problems) == 0
+	request.Documents = len(documents)
+	request.Erased = len(erased)
+	request.Held = len(retained)
+	request.Verified = &verified
+	request.Details = services.Metadata{"problems": problems, "pseudonyms_deleted": pseudonymsDeleted}
+	if err := s.store.CompletePrivacyRequest(request); err != nil {
+		log.Printf("Failed to record completion of privacy erasure %s: %v", request.ID, err)
+	}
+	log.Printf("User %s erased %d documents for privacy request %s (%d retained, verified %t)",
+		user.ID, len(erased), request.ID, len(retained), verified)
+
+	c.JSON(http.StatusOK, gin.H{
+		"request":   request,
+		"documents": results,
+		"verified":  verified,
+		"problems":  problems,
+		"status":    "success",
+	})
+}
+
+// verifyErasure checks that the erased documents are gone and that the
+// subject is now found only in retained documents
+func (s *Server) verifyErasure(subject services.DataSubject, tenantID *string, erased []services.DocumentID, retained map[services.DocumentID]string) []string {
+	problems := []string{}
+	for _, id := range erased {
+		if _, err := s.store.GetDocument(id); !errors.Is(err, sql.ErrNoRows) {
+			problems = append(problems, fmt.Sprintf("document %s is still present", id))
+		}
+	}
+	remaining, err := s.store.FindSubjectDocuments(subject, services.DocumentScope{TenantID: tenantID})
+	if err != nil {
+		log.Printf("Failed to verify erasure: %v", err)
+		return append(problems, "the subject could not be searched for again")
+	}
+	for _, document := range remaining {
+		if retained[document.ID] == "" {
+			problems = append(problems, fmt.Sprintf("document %s still mentions the subject", document.ID))
+		}
+	}
+	return problems
+}
+
+// placeLegalHold keeps a document from erasure and expiry until released
+func (s *Server) placeLegalHold(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		DocumentID string `json:"document_id" binding:"required,uuid"`
+		Reason     string `json:"reason" binding:"required,notblank,max=500"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	document, err := s.store.GetDocument(services.DocumentID(req.DocumentID))
+	if err != nil || (tenant != nil && (document.TenantID == nil || *document.TenantID != tenant.ID)) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+
+	hold := &services.LegalHold{DocumentID: document.ID, Reason: req.Reason, PlacedBy: &user.ID}
+	err = s.store.PlaceLegalHold(hold)
+	switch {
+	case errors.Is(err, services.ErrHoldExists):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Document is already under legal hold",
+			"status": "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to place legal hold on document %s: %v", document.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to place legal hold",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("User %s placed legal hold %s on document %s", user.ID, hold.ID, document.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"hold":   hold,
+		"status": "success",
+	})
+}
+
+// getLegalHolds lists the active legal holds of the X-Tenant tenant, or of
+// every tenant; all=true includes released holds
+func (s *Server) getLegalHolds(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	all, _ := strconv.ParseBool(c.Query("all"))
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > maxPrivacyListing {
+		limit = 100
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	holds, err := s.store.GetLegalHolds(tenantID, all, limit)
+	if err != nil {
+		log.Printf("Failed to list legal holds: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve legal holds",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"holds":  holds,
+		"total":  len(holds),
+		"status": "success",
+	})
+}
+
+// releaseLegalHold releases a hold; the document may be erased or expire
+// again
+func (s *Server) releaseLegalHold(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+
+	hold, err := s.store.ReleaseLegalHold(c.Param("id"), user.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Active legal hold not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to release legal hold %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to release legal hold",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("User %s released legal hold %s on document %s", user.ID, hold.ID, hold.DocumentID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"hold":   hold,
+		"status": "success",
+	})
+}
+
+// getPrivacyRequests lists the data subject requests of the X-Tenant
+// tenant, or of every tenant, newest first
+func (s *Server) getPrivacyRequests(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > maxPrivacyListing {
+		limit = 100
+	}
+	var tenantID *string
+	if tenant != nil {
+		tenantID = &tenant.ID
+	}
+
+	requests, err := s.store.GetPrivacyRequests(tenantID, limit)
+	if err != nil {
+		log.Printf("Failed to list privacy requests: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve privacy requests",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"total":    len(requests),
+		"status":   "success",
+	})
+}
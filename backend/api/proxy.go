@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/netip"
+	"strings"
+
+	"frauddocai-backend/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTrustedProxies reads the IP addresses and CIDR ranges of trusted
+// proxies, ignoring invalid entries, which the router rejects at startup
+func parseTrustedProxies(proxies []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			addr, err := netip.ParseAddr(proxy)
+			if err != nil {
+				logging.HTTP.Warnf("Ignoring trusted proxy %q: %v", proxy, err)
+				continue
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			logging.HTTP.Warnf("Ignoring trusted proxy %q: %v", proxy, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+// fromTrustedProxy reports whether the request came straight from a trusted
+// proxy, whose forwarding headers may be believed
+func (s *Server) fromTrustedProxy(c *gin.Context) bool {
+	addr, err := netip.ParseAddr(c.RemoteIP())
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestScheme is the scheme the client used: https when the request came
+// over TLS, or through a trusted proxy that says it terminated TLS
+func (s *Server) requestScheme(c *gin.Context) string {
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	if s.fromTrustedProxy(c) {
+		// A chain of proxies appends to the header; the first is the
+		// client's side
+		proto, _, _ := strings.Cut(c.GetHeader("X-Forwarded-Proto"), ",")
+		if proto = strings.ToLower(strings.TrimSpace(proto)); proto == "https" || proto == "http" {
+			return proto
+		}
+	}
+	return "http"
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Document Question Answering handlers
+func (s *Server) askDocument(c *gin.Context) {
+	var request struct {
+		Question     string `json:"question" binding:"required,notblank,max=1000"`
+		DocumentText string `json:"document_text" binding:"required,notblank,max=100000"`
+	}
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	// Call AI service for document question answering
+	answer, err := s.ai.AskDocument(c.Request.Context(), services.AskDocumentRequest{
+		Question:     request.Question,
+		DocumentText: request.DocumentText,
+	})
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"question":   answer.Question,
+		"answer":     *answer.Answer,
+		"confidence": *answer.Confidence,
+		"model_used": answer.ModelUsed,
+		"timestamp":  answer.Timestamp,
+		"status":     "success",
+	})
+}
+
+// analyzeDocumentFraud asks the AI service the fraud questions of the tenant,
+// named by the document when one is given and by X-Tenant otherwise, and
+// records the analysis with the question set version asked
+func (s *Server) analyzeDocumentFraud(c *gin.Context) {
+	var request struct {
+		DocumentText       string               `json:"document_text" binding:"required,notblank,max=100000"`
+		DocumentID         *services.DocumentID `json:"document_id" binding:"omitempty,uuid"`
+		QuestionSetVersion int                  `json:"question_set_version" binding:"omitempty,min=1"`
+	}
+	if !bindJSON(c, &request) {
+		return
+	}
+
+	var tenant *services.Tenant
+	var err error
+	if request.DocumentID != nil {
+		document, err := s.store.GetDocument(*request.DocumentID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Document not found",
+				"status": "error",
+			})
+			return
+		}
+		if tenant, err = s.tenantFor(document); err != nil {
+			respondTenantError(c, err)
+			return
+		}
+	} else if tenant, err = s.requestTenant(c); err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	set, ok := s.questionSetFor(c, tenant, request.QuestionSetVersion)
+	if !ok {
+		return
+	}
+
+	fraudRequest := services.DocumentFraudRequest{DocumentText: request.DocumentText}
+	if set != nil {
+		fraudRequest.Questions = set.Questions
+		fraudRequest.PromptTemplate = set.PromptTemplate
+	}
+
+	// Call AI service for fraud analysis using QA
+	analysis, err := s.ai.AnalyzeDocumentFraud(c.Request.Context(), fraudRequest)
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(request.DocumentText))
+	record := &services.FraudQAAnalysis{
+		DocumentID:     request.DocumentID,
+		TextSHA256:     hex.EncodeToString(sum[:]),
+		OverallRisk:    analysis.OverallRisk,
+		TotalRiskScore: *analysis.TotalRiskScore,
+		ModelUsed:      analysis.ModelUsed,
+		FraudAnalysis:  analysis.FraudAnalysis,
+	}
+	var questionSet gin.H
+	if tenant != nil {
+		record.TenantID = &tenant.ID
+	}
+	if set != nil {
+		record.QuestionSetID, record.QuestionSetVersion = &set.ID, &set.Version
+		questionSet = gin.H{"id": set.ID, "version": set.Version}
+	}
+	var analysisID *string
+	if err := s.store.CreateFraudQAAnalysis(record); err != nil {
+		// The analysis is still returned; it just cannot be looked up later
+		log.Printf("Failed to record fraud analysis: %v", err)
+	} else {
+		analysisID = &record.ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"analysis_id":        analysisID,
+		"question_set":       questionSet,
+		"fraud_analysis":     analysis.FraudAnalysis,
+		"overall_risk":       analysis.OverallRisk,
+		"total_risk_score":   *analysis.TotalRiskScore,
+		"questions_analyzed": analysis.QuestionsAnalyzed,
+		"model_used":         analysis.ModelUsed,
+		"timestamp":          analysis.Timestamp,
+		"status":             "success",
+	})
+}
+
+func (s *Server) getQAModelInfo(c *gin.Context) {
+	info, age, err := s.modelInfo.Get(c.Request.Context())
+	if err != nil {
+		respondAIError(c, err)
+		return
+	}
+	c.Header("Age", strconv.Itoa(int(age.Seconds())))
+
+	c.JSON(http.StatusOK, gin.H{
+		"model_available": *info.ModelAvailable,
+		"model_info":      info.ModelInfo,
+		"timestamp":       info.Timestamp,
+		"status":          "success",
+	})
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// putQuestionSet saves a tenant's fraud questions and prompt template as its
+// next question set version, which fraud analyses of the tenant ask from
+// then on. Earlier versions are kept for analyses that recorded them.
+func (s *Server) putQuestionSet(c *gin.Context) {
+	var req struct {
+		Questions      services.FraudQuestions `json:"questions" binding:"required"`
+		PromptTemplate *string                 `json:"prompt_template"`
+		CreatedBy      *string                 `json:"created_by" binding:"omitempty,max=255"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	set := &services.QuestionSet{
+		TenantID:       tenant.ID,
+		Questions:      req.Questions,
+		PromptTemplate: req.PromptTemplate,
+		CreatedBy:      req.CreatedBy,
+	}
+	err = s.store.CreateQuestionSet(set)
+	var setErr *services.QuestionSetError
+	if errors.As(err, &setErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid question set",
+			"problems": setErr.Problems,
+			"status":   "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save question set for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to save question set",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Tenant %s question set version %d saved (%d questions)", tenant.Slug, set.Version, len(set.Questions))
+
+	c.JSON(http.StatusCreated, gin.H{
+		"tenant":       tenant.Slug,
+		"question_set": set,
+		"status":       "success",
+	})
+}
+
+// getQuestionSets lists every version of a tenant's question set, newest
+// first; the first is the one in use
+func (s *Server) getQuestionSets(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	sets, err := s.store.GetQuestionSets(tenant.ID)
+	if err != nil {
+		log.Printf("Failed to retrieve question sets of tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve question sets",
+			"status": "error",
+		})
+		return
+	}
+	if sets == nil {
+		sets = []*services.QuestionSet{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":        tenant.Slug,
+		"question_sets": sets,
+		"default":       len(sets) == 0,
+		"status":        "success",
+	})
+}
+
+// questionSetFor returns the version of the tenant's question set an
+// analysis asks, the latest when version is 0, or nil when the tenant has
+// none and the AI service's default questions are asked. It responds itself
+// when the set cannot be used.
+func (s *Server) questionSetFor(c *gin.Context, tenant *services.Tenant, version int) (*services.QuestionSet, bool) {
+	if tenant == nil {
+		if version != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "question_set_version requires a tenant",
+				"status": "error",
+			})
+			return nil, false
+		}
+		return nil, true
+	}
+
+	set, err := s.store.GetQuestionSet(tenant.ID, version)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && version == 0:
+		return nil, true
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Question set version not found",
+			"status": "error",
+		})
+		return nil, false
+	case err != nil:
+		log.Printf("Failed to retrieve question set of tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve question set",
+			"status": "error",
+		})
+		return nil, false
+	}
+	return set, true
+}
+
+// getFraudQAAnalysis returns a recorded question answering fraud analysis
+// with the question set version it asked
+func (s *Server) getFraudQAAnalysis(c *gin.Context) {
+	analysis, err := s.store.GetFraudQAAnalysis(c.Param("id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Analysis not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to retrieve fraud analysis %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve analysis",
+			"status": "error",
+		})
+		return
+	}
+
+	response := gin.H{
+		"analysis": analysis,
+		"status":   "success",
+	}
+	if analysis.QuestionSetID != nil && analysis.TenantID != nil {
+		set, err := s.store.GetQuestionSet(*analysis.TenantID, *analysis.QuestionSetVersion)
+		if err == nil {
+			response["question_set"] = set
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to retrieve question set of fraud analysis %s: %v", analysis.ID, err)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
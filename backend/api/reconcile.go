@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+)
+
+// reconcilePageSize bounds the object names looked up per query
+const reconcilePageSize = 200
+
+// RunBucketReconciler periodically scans every region's bucket for files
+// that were written there directly instead of through the upload API, and
+// registers and analyzes them like uploads. It returns when ctx is
+// cancelled.
+func (s *Server) RunBucketReconciler(ctx context.Context, cfg config.ReconcileConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.reconcileBuckets(ctx, cfg.Grace); n > 0 {
+				log.Printf("Registered %d documents found in storage buckets", n)
+			}
+		}
+	}
+}
+
+// reconcileBuckets runs one scan and returns the number of documents
+// registered. Objects modified within grace are skipped: the upload API
+// stores the file before it saves the document.
+func (s *Server) reconcileBuckets(ctx context.Context, grace time.Duration) int {
+	registered := 0
+	for _, region := range s.storage.Regions() {
+		objects, err := s.unregisteredObjects(ctx, region, time.Now().Add(-grace))
+		if err != nil {
+			log.Printf("Failed to scan storage region %s: %v", region, err)
+			continue
+		}
+		tenants := map[string]*services.Tenant{}
+		for _, object := range objects {
+			if ctx.Err() != nil {
+				return registered
+			}
+			if err := s.registerStoredObject(ctx, region, object, tenants); err != nil {
+				log.Printf("Failed to register object %s in storage region %s: %v", object.Name, region, err)
+				continue
+			}
+			registered++
+		}
+	}
+	return registered
+}
+
+// unregisteredObjects lists the objects in the region's hot bucket, last
+// modified before cutoff, that are not the file of any document
+func (s *Server) unregisteredObjects(ctx context.Context, region string, cutoff time.Time) ([]services.StoredObject, error) {
+	store, err := s.storage.ForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown, page []services.StoredObject
+	flush := func() error {
+		names := make([]string, len(page))
+		for i, object := range page {
+			names[i] = object.Name
+		}
+		known, err := s.store.GetKnownFilePaths(names)
+		if err != nil {
+			return err
+		}
+		for _, object := range page {
+			if !known[object.Name] {
+				unknown = append(unknown, object)
+			}
+		}
+		page = page[:0]
+		return nil
+	}
+
+	err = store.ListFiles(ctx, func(object services.StoredObject) error {
+		if strings.HasSuffix(object.Name, "/") || !object.LastModified.Before(cutoff) {
+			return nil
+		}
+		page = append(page, object)
+		if len(page) < reconcilePageSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil && len(page) > 0 {
+		err = flush()
+	}
+	return unknown, err
+}
+
+// registerStoredObject creates the document for an object found in a bucket
+// and analyzes it. An object under a folder named after a tenant's slug,
+// such as acme/invoice.pdf, belongs to that tenant. tenants caches the
+// lookups by slug for the scan.
+func (s *Server) registerStoredObject(ctx context.Context, region string, object services.StoredObject, tenants map[string]*services.Tenant) error {
+	var tenant *services.Tenant
+	if slug, _, ok := strings.Cut(object.Name, "/"); ok {
+		cached, seen := tenants[slug]
+		if !seen {
+			// An unknown slug is an ordinary folder
+			cached, _ = s.store.GetTenantBySlug(slug)
+			tenants[slug] = cached
+		}
+		tenant = cached
+	}
+
+	contentType := object.ContentType
+	if contentType == "" || contentType == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(path.Ext(object.Name)); byExtension != "" {
+			contentType = byExtension
+		}
+	}
+
+	document := &services.Document{
+		Filename:         object.Name,
+		OriginalFilename: path.Base(object.Name),
+		FilePath:         object.Name,
+		FileSize:         object.Size,
+		MimeType:         contentType,
+		Status:           services.DocumentUploaded,
+		FraudRiskLevel:   riskTaxonomyFor(tenant).Lowest().Name,
+		StorageRegion:    &region,
+		Metadata:         services.Metadata{"source": "bucket_scan"},
+	}
+	if tenant != nil {
+		document.TenantID = &tenant.ID
+	}
+	contentSHA256, err := s.hashStoredFile(ctx, document)
+	if err != nil {
+		return err
+	}
+	document.ContentSHA256 = &contentSHA256
+
+	if err := s.store.CreateDocument(document); err != nil {
+		return err
+	}
+	metrics.BucketObjectsRegistered.WithLabelValues(region).Inc()
+	log.Printf("Registered object %s in storage region %s as document %s", object.Name, region, document.ID)
+
+	s.enqueuePipeline(document, false)
+	return nil
+}
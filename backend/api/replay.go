@@ -0,0 +1,139 @@
+package api
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// replayDocument reruns a document's pipeline in debug mode, re-extracting
+// its text from the stored file, and streams a zip bundle of what the run
+// went through for engineers to look into:
+//
+//   - manifest.json: the run, its stages and the files of the bundle
+//   - document-before.json and document-after.json: the document's record
+//   - extraction.json: the raw output of the extractor
+//   - text.txt: the text the later stages were given
+//   - chunks.json: the parts of the text sent to each AI endpoint
+//   - ai-exchanges.json: the requests to AI providers and their responses
+//   - entities.json, risk-factors.json and embedding.json: what the stages
+//     handed each other
+//   - detections.json: the document's detections after the run
+//
+// The run is a real one: its results are stored as those of a reprocessing
+// would be.
+func (s *Server) replayDocument(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	document, err := s.store.GetDocument(documentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+	before := *document
+
+	diagnostics := services.NewDiagnostics()
+	ctx := services.WithDiagnostics(c.Request.Context(), diagnostics)
+	run := &pipelineRun{document: document}
+	started := time.Now()
+	results := s.runPipeline(ctx, run)
+	duration := time.Since(started)
+	log.Printf("Replayed the pipeline of document %s in debug mode in %v", document.ID, duration.Round(time.Millisecond))
+
+	var problems []string
+	after, err := s.store.GetDocument(documentID)
+	if err != nil {
+		problems = append(problems, "document after the run: "+err.Error())
+		after = nil
+	}
+	detections, err := s.store.GetFraudDetections(services.DetectionFilter{DocumentID: documentID, Limit: 1000})
+	if err != nil {
+		problems = append(problems, "detections: "+err.Error())
+	}
+
+	stages := make([]gin.H, 0, len(results))
+	for _, result := range results {
+		stage := gin.H{
+			"stage":       result.Stage,
+			"outcome":     result.Outcome,
+			"attempts":    result.Attempts,
+			"duration_ms": result.Duration.Milliseconds(),
+		}
+		if result.Error != "" {
+			stage["error"] = result.Error
+		}
+		stages = append(stages, stage)
+	}
+
+	parts := []replayBundlePart{
+		{"document-before.json", &before},
+		{"document-after.json", after},
+	}
+	diagnostics.Artifacts(func(name string, value interface{}) {
+		parts = append(parts, replayBundlePart{name + ".json", value})
+	})
+	parts = append(parts,
+		replayBundlePart{"chunks.json", diagnostics.Chunks()},
+		replayBundlePart{"ai-exchanges.json", diagnostics.Exchanges()},
+		replayBundlePart{"entities.json", run.entities},
+		replayBundlePart{"risk-factors.json", run.riskFactors},
+		replayBundlePart{"embedding.json", gin.H{"dimensions": len(run.embedding), "embedding": run.embedding}},
+		replayBundlePart{"detections.json", detections},
+	)
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="replay-%s-%s.zip"`, document.ID, started.UTC().Format("20060102T150405Z")))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	bundle := zip.NewWriter(c.Writer)
+	files := []string{}
+	w, err := bundle.Create("text.txt")
+	if err == nil {
+		_, err = w.Write([]byte(run.text))
+	}
+	if err != nil {
+		problems = append(problems, "text.txt: "+err.Error())
+	} else {
+		files = append(files, "text.txt")
+	}
+	for _, part := range parts {
+		if err := writeBundleJSON(bundle, part.name, part.value); err != nil {
+			problems = append(problems, part.name+": "+err.Error())
+			continue
+		}
+		files = append(files, part.name)
+	}
+
+	manifest := gin.H{
+		"document_id": document.ID,
+		"replayed_at": started.UTC(),
+		"duration_ms": duration.Milliseconds(),
+		"extracted":   run.extracted,
+		"stages":      stages,
+		"files":       files,
+		"problems":    problems,
+	}
+	if err := writeBundleJSON(bundle, "manifest.json", manifest); err != nil {
+		log.Printf("Replay of document %s: failed to write manifest: %v", document.ID, err)
+	}
+	if err := bundle.Close(); err != nil {
+		log.Printf("Replay of document %s: failed to finish bundle: %v", document.ID, err)
+	}
+}
+
+// replayBundlePart is a JSON file of a replay bundle
+type replayBundlePart struct {
+	name  string
+	value interface{}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+)
+
+// rescoreBatchSize bounds the documents re-scored per pass
+const rescoreBatchSize = 25
+
+// RunFallbackRescorer periodically re-scores documents that were analyzed by
+// a fallback analyzer, replacing the degraded score once the primary provider
+// answers again. It returns when ctx is cancelled.
+func (s *Server) RunFallbackRescorer(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.rescoreFallbackAnalyses(ctx); n > 0 {
+				log.Printf("Re-scored %d fallback analyses", n)
+			}
+		}
+	}
+}
+
+// rescoreFallbackAnalyses runs one pass and returns the number of documents
+// re-scored. The pass stops as soon as a provider is still degraded.
+func (s *Server) rescoreFallbackAnalyses(ctx context.Context) int {
+	documents, err := s.store.GetFallbackAnalyzedDocuments(rescoreBatchSize)
+	if err != nil {
+		log.Printf("Failed to load fallback analyses: %v", err)
+		return 0
+	}
+
+	rescored := 0
+	for _, document := range documents {
+		if document.ExtractedText == nil {
+			continue
+		}
+
+		analyzer, err := s.analyzerFor(document)
+		if err != nil {
+			log.Printf("Failed to select analyzer for document %s: %v", document.ID, err)
+			continue
+		}
+		analysis, err := analyzer.Analyze(ctx, services.AnalyzeTextRequest{Text: *document.ExtractedText})
+		if errors.Is(err, services.ErrAIServiceUnavailable) {
+			return rescored
+		}
+		if err != nil {
+			log.Printf("Re-scoring document %s failed: %v", document.ID, err)
+			continue
+		}
+		if analysis.Fallback {
+			return rescored
+		}
+
+		result, err := s.newFraudAnalysis(document, *document.ExtractedText, analysis)
+		if err == nil {
+			err = s.store.UpdateDocumentFraudAnalysis(document.ID, result)
+		}
+		if err != nil {
+			log.Printf("Failed to store re-scored analysis for document %s: %v", document.ID, err)
+			continue
+		}
+		metrics.AnalyzerRescored.Inc()
+		rescored++
+	}
+	return rescored
+}
+
+// RunAnalysisCachePurge periodically deletes cached analyses older than the
+// cache TTL. It returns when ctx is cancelled.
+func (s *Server) RunAnalysisCachePurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := s.store.PurgeAnalysisCache(time.Now().Add(-s.analyzers.CacheTTL()))
+			if err != nil {
+				log.Printf("Failed to purge analysis cache: %v", err)
+			} else if n > 0 {
+				log.Printf("Purged %d cached analyses", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getRiskLevels returns the risk levels of the X-Tenant tenant with their
+// score ranges and colors, most severe last
+func (s *Server) getRiskLevels(c *gin.Context) {
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	taxonomy := riskTaxonomyFor(tenant)
+
+	levels := make([]gin.H, 0, len(taxonomy.Levels))
+	for i, level := range taxonomy.Levels {
+		maxScore := 1.0
+		if i+1 < len(taxonomy.Levels) {
+			maxScore = taxonomy.Levels[i+1].MinScore
+		}
+		levels = append(levels, gin.H{
+			"name":      level.Name,
+			"label":     level.Label,
+			"rank":      i,
+			"min_score": level.MinScore,
+			"max_score": maxScore,
+			"color":     level.Color,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"levels":  levels,
+		"default": tenant == nil || tenant.RiskTaxonomy == nil,
+		"status":  "success",
+	})
+}
+
+// putRiskTaxonomy replaces a tenant's risk levels. Existing documents keep the
+// level they were stored with until they are analyzed again.
+func (s *Server) putRiskTaxonomy(c *gin.Context) {
+	var taxonomy services.RiskTaxonomy
+	if err := c.ShouldBindJSON(&taxonomy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a risk taxonomy",
+			"status": "error",
+		})
+		return
+	}
+	s.updateRiskTaxonomy(c, &taxonomy)
+}
+
+// deleteRiskTaxonomy restores the default risk levels for a tenant
+func (s *Server) deleteRiskTaxonomy(c *gin.Context) {
+	s.updateRiskTaxonomy(c, nil)
+}
+
+func (s *Server) updateRiskTaxonomy(c *gin.Context, taxonomy *services.RiskTaxonomy) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	err = s.store.UpdateTenantRiskTaxonomy(tenant.ID, taxonomy)
+	var taxonomyErr *services.RiskTaxonomyError
+	switch {
+	case errors.As(err, &taxonomyErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid risk taxonomy",
+			"problems": taxonomyErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update risk taxonomy for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update risk taxonomy",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant.RiskTaxonomy = taxonomy
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":        tenant.Slug,
+		"risk_taxonomy": tenant.Taxonomy(),
+		"status":        "success",
+	})
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getCredentialRotations lists the recorded credential rotations, newest
+// first
+func (s *Server) getCredentialRotations(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+
+	rotations, err := s.store.GetCredentialRotations(limit)
+	if err != nil {
+		log.Printf("Failed to retrieve credential rotations: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve credential rotations",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rotations": rotations,
+		"total":     len(rotations),
+		"status":    "success",
+	})
+}
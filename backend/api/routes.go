@@ -0,0 +1,745 @@
+// Package api contains the HTTP handlers and routes of the backend.
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Dependencies are the services the handlers use
+type Dependencies struct {
+	Store   services.Store
+	Storage services.ObjectStorage
+	AI      services.AIClient
+
+	// StorageRegions holds the object store of each data residency region.
+	// When nil every file is kept in Storage.
+	StorageRegions *services.RegionalStorage
+
+	// Analyzers picks the fraud analysis provider per tenant. When nil every
+	// tenant uses the AI service.
+	Analyzers *services.AnalyzerSet
+
+	// Canary scores a share of analyses with a canary version of the AI
+	// service for comparison. When nil no analyses are compared.
+	Canary *services.Canary
+
+	// Batcher groups background analyses into batches. When nil each
+	// document is analyzed with its own call.
+	Batcher *services.BatchCoordinator
+
+	// Extractors turn uploads into text by content type. When nil the
+	// default extractors are used with timeouts from the environment.
+	Extractors *services.ExtractorRegistry
+
+	// Spooler holds uploads and the files being extracted within the
+	// payload memory budget. When nil it is configured from the
+	// environment; it should be the one the extractors were given.
+	Spooler *services.Spooler
+
+	// OCR sets the confidence below which pages are re-OCR'd. The zero
+	// value uses the environment.
+	OCR config.OCRConfig
+
+	// Accounts sets how bank statements are analyzed against the earlier
+	// statements of their account, and how fast the risk documents add to
+	// their accounts decays. The zero value uses the environment.
+	Accounts config.AccountConfig
+
+	// Deletion sets how long deleted documents are kept before they are
+	// purged. The zero value uses the environment.
+	Deletion config.DeletionConfig
+
+	// URLReputation flags links to blocklisted and lookalike domains. When
+	// nil it is configured from the environment.
+	URLReputation *services.URLReputation
+
+	// GeoIP locates the clients submitting documents. When nil it is
+	// loaded from GEOIP_FILE.
+	GeoIP *services.GeoIP
+
+	// Geo sets the country velocity rule. The zero value uses the
+	// environment.
+	Geo config.GeoIPConfig
+
+	// ModelInfo caches the AI service's QA model info. When nil it is
+	// cached with the TTLs from the environment.
+	ModelInfo *services.ModelInfoCache
+
+	// Lifecycle is the archival policy for stored files. The zero value
+	// uses the environment.
+	Lifecycle config.LifecycleConfig
+
+	// Events carries document status changes to the requests waiting for
+	// them. When nil the server creates its own bus.
+	Events *services.EventBus
+
+	// Pipelines are the processing stages run on each upload, per document
+	// type. When nil they are loaded from PIPELINE_CONFIG_FILE.
+	Pipelines *services.PipelineSet
+
+	// Pipeline sizes the workers running the pipelines. The zero value uses
+	// the environment.
+	Pipeline config.PipelineConfig
+
+	// Leader elects the replica running each singleton background task.
+	// When nil the health check reports no leadership.
+	Leader *services.LeaderElector
+
+	// Backups writes and restores tenant backups. When nil backups go to
+	// BACKUP_DIR.
+	Backups *services.BackupService
+
+	// Exemplars sets the thresholds for matching uploads against the
+	// known-fraud exemplar library. The zero value uses the environment.
+	Exemplars config.ExemplarConfig
+
+	// HTTP sets the request body limits. The zero value uses the
+	// environment.
+	HTTP config.ServerConfig
+
+	// Security sets the security headers of every response. The zero value
+	// uses the environment.
+	Security config.SecurityConfig
+
+	// API sets the deprecation dates announced on /api/v1 responses. The
+	// zero value uses the environment.
+	API config.APIConfig
+
+	// Webhooks delivers administrative events. When nil they are configured
+	// from the environment.
+	Webhooks *services.Webhooks
+
+	// Graph syncs the document graph to Neo4j. When nil it is configured
+	// from the environment, with NEO4J_PASSWORD taken literally.
+	Graph *services.Neo4j
+
+	// Watermark limits the watermarked copies of documents and sizes their
+	// cache. The zero value uses the environment.
+	Watermark config.WatermarkConfig
+
+	// Translations localize API errors and generated reports. When nil
+	// they are loaded from I18N_BUNDLES_DIR.
+	Translations *services.Translations
+
+	// FX converts document amounts into tenants' base currencies. When nil
+	// it is configured from the environment.
+	FX *services.FXRates
+
+	// HTTPLog logs sampled requests and responses, with their bodies
+	// scrubbed, for debugging integrations. When nil it is opened from the
+	// environment, and off unless HTTP_LOG_FILE is set.
+	HTTPLog *services.HTTPLogger
+
+	// Signup opens self-service tenant signup. The zero value uses the
+	// environment.
+	Signup config.SignupConfig
+
+	// Drift sets the periods and thresholds of the model drift monitor.
+	// The zero value uses the environment.
+	Drift config.DriftConfig
+
+	// Proxy names the reverse proxies whose forwarding headers are
+	// believed. The zero value trusts none.
+	Proxy config.ProxyConfig
+
+	// Pseudonymizer tokenizes personal data in anonymized exports. When nil
+	// it is keyed by ANONYMIZATION_KEY, and without a key anonymized exports
+	// are refused.
+	Pseudonymizer *services.Pseudonymizer
+
+	// AdminToken guards /api/v1/admin and /api/v2/admin. Admin routes are disabled when empty.
+	AdminToken string
+}
+
+// Server holds the services used by the HTTP handlers. Handlers are methods
+// on Server so alternate implementations can be injected through NewServer.
+type Server struct {
+	store   services.Store
+	storage *services.RegionalStorage
+	ai      services.AIClient
+
+	modelInfo  *services.ModelInfoCache
+	analyzers  *services.AnalyzerSet
+	canary     *services.Canary
+	batcher    *services.BatchCoordinator
+	extractors *services.ExtractorRegistry
+	spooler    *services.Spooler
+	ocr        config.OCRConfig
+	accounts   config.AccountConfig
+	deletion   config.DeletionConfig
+	reputation *services.URLReputation
+	geoIP      *services.GeoIP
+	geo        config.GeoIPConfig
+	pipelines  *services.PipelineSet
+	pipeline   config.PipelineConfig
+	jobsQueued chan struct{}
+	leader     *services.LeaderElector
+	backups    *services.BackupService
+	events     *services.EventBus
+	webhooks   *services.Webhooks
+	graph      *services.Neo4j
+	pseudonyms *services.Pseudonymizer
+	watermarks *services.WatermarkCache
+	i18n       *services.Translations
+	fx         *services.FXRates
+	httpLog    *services.HTTPLogger
+	exemplars  config.ExemplarConfig
+	lifecycle  config.LifecycleConfig
+	watermark  config.WatermarkConfig
+	http       config.ServerConfig
+	security   config.SecurityConfig
+	api        config.APIConfig
+	signup     config.SignupConfig
+	drift      config.DriftConfig
+	adminToken string
+
+	trustedProxies []netip.Prefix
+	maintenance    maintenanceState
+}
+
+func NewServer(deps Dependencies) *Server {
+	storage := deps.StorageRegions
+	if storage == nil {
+		storage = services.NewSingleRegionStorage(config.GetStorageConfig().DefaultRegion, deps.Storage)
+	}
+	modelInfo := deps.ModelInfo
+	if modelInfo == nil {
+		cfg := config.GetAIConfig()
+		modelInfo = services.NewModelInfoCache(deps.AI, cfg.ModelInfoTTL, cfg.ModelInfoMaxStale)
+	}
+	analyzers := deps.Analyzers
+	if analyzers == nil {
+		analyzers = services.DefaultAnalyzerSet(deps.AI)
+	}
+	spooler := deps.Spooler
+	if spooler == nil {
+		spooler = services.NewSpooler(config.GetPayloadConfig())
+	}
+	extractors := deps.Extractors
+	if extractors == nil {
+		extractors = services.DefaultExtractorRegistry(config.GetExtractionConfig(), deps.AI, spooler)
+	}
+	ocr := deps.OCR
+	if ocr == (config.OCRConfig{}) {
+		ocr = config.GetOCRConfig()
+	}
+	accounts := deps.Accounts
+	if accounts == (config.AccountConfig{}) {
+		accounts = config.GetAccountConfig()
+	}
+	deletion := deps.Deletion
+	if deletion == (config.DeletionConfig{}) {
+		deletion = config.GetDeletionConfig()
+	}
+	reputation := deps.URLReputation
+	if reputation == nil {
+		cfg := config.GetURLReputationConfig()
+		var err error
+		if reputation, err = services.NewURLReputation(cfg); err != nil {
+			log.Printf("Ignoring URL blocklist file: %v", err)
+			cfg.BlocklistFile = ""
+			reputation, _ = services.NewURLReputation(cfg)
+		}
+	}
+	geo := deps.Geo
+	if geo == (config.GeoIPConfig{}) {
+		geo = config.GetGeoIPConfig()
+	}
+	geoIP := deps.GeoIP
+	if geoIP == nil {
+		var err error
+		if geoIP, err = services.NewGeoIP(geo.File); err != nil {
+			log.Printf("Ignoring GeoIP file: %v", err)
+			geoIP, _ = services.NewGeoIP("")
+		}
+	}
+	pipelines := deps.Pipelines
+	if pipelines == nil {
+		cfg := config.GetPipelineConfig()
+		var err error
+		if pipelines, err = services.NewPipelineSet(cfg); err != nil {
+			log.Printf("Using the default pipeline: %v", err)
+			cfg.File = ""
+			pipelines, _ = services.NewPipelineSet(cfg)
+		}
+	}
+	pipelineConfig := deps.Pipeline
+	if pipelineConfig == (config.PipelineConfig{}) {
+		pipelineConfig = config.GetPipelineConfig()
+	}
+	exemplars := deps.Exemplars
+	if exemplars == (config.ExemplarConfig{}) {
+		exemplars = config.GetExemplarConfig()
+	}
+	backups := deps.Backups
+	if backups == nil {
+		backups = services.NewBackupService(deps.Store, storage, config.GetBackupConfig().Dir)
+	}
+	events := deps.Events
+	if events == nil {
+		events = services.NewEventBus()
+	}
+	webhooks := deps.Webhooks
+	if webhooks == nil {
+		webhooks = services.NewWebhooks(config.GetWebhookConfig())
+	}
+	graph := deps.Graph
+	if graph == nil {
+		cfg := config.GetGraphConfig()
+		graph = services.NewNeo4j(cfg, cfg.Neo4jPassword)
+	}
+	pseudonyms := deps.Pseudonymizer
+	if pseudonyms == nil {
+		pseudonyms = services.NewPseudonymizer(config.GetAdminConfig().AnonymizationKey)
+	}
+	translations := deps.Translations
+	if translations == nil {
+		cfg := config.GetI18nConfig()
+		var err error
+		if translations, err = services.NewTranslations(cfg.BundlesDir, cfg.DefaultLanguage); err != nil {
+			log.Printf("Showing messages in English: %v", err)
+			translations, _ = services.NewTranslations("", "")
+		}
+	}
+	fx := deps.FX
+	if fx == nil {
+		fx = services.NewFXRates(deps.Store, config.GetFXConfig())
+	}
+	httpLog := deps.HTTPLog
+	if httpLog == nil {
+		var err error
+		if httpLog, err = services.NewHTTPLogger(config.GetHTTPLogConfig()); err != nil {
+			log.Printf("Not logging HTTP bodies: %v", err)
+		}
+	}
+	lifecycle := deps.Lifecycle
+	if lifecycle == (config.LifecycleConfig{}) {
+		lifecycle = config.GetLifecycleConfig()
+	}
+	watermark := deps.Watermark
+	if watermark == (config.WatermarkConfig{}) {
+		watermark = config.GetWatermarkConfig()
+	}
+	httpConfig := deps.HTTP
+	if httpConfig == (config.ServerConfig{}) {
+		httpConfig = config.GetServerConfig()
+	}
+	security := deps.Security
+	if security == (config.SecurityConfig{}) {
+		security = config.GetSecurityConfig()
+	}
+	apiConfig := deps.API
+	if apiConfig == (config.APIConfig{}) {
+		apiConfig = config.GetAPIConfig()
+	}
+	signup := deps.Signup
+	if signup == (config.SignupConfig{}) {
+		signup = config.GetSignupConfig()
+	}
+	drift := deps.Drift
+	if drift == (config.DriftConfig{}) {
+		drift = config.GetDriftConfig()
+	}
+	return &Server{
+		store:   deps.Store,
+		storage: storage,
+		ai:      deps.AI,
+
+		modelInfo:  modelInfo,
+		analyzers:  analyzers,
+		canary:     deps.Canary,
+		batcher:    deps.Batcher,
+		extractors: extractors,
+		spooler:    spooler,
+		ocr:        ocr,
+		accounts:   accounts,
+		deletion:   deletion,
+		reputation: reputation,
+		geoIP:      geoIP,
+		geo:        geo,
+		pipelines:  pipelines,
+		pipeline:   pipelineConfig,
+		jobsQueued: make(chan struct{}, 1),
+		leader:     deps.Leader,
+		backups:    backups,
+		events:     events,
+		webhooks:   webhooks,
+		graph:      graph,
+		pseudonyms: pseudonyms,
+		watermarks: services.NewWatermarkCache(int64(watermark.CacheBytes), watermark.CacheTTL),
+		i18n:       translations,
+		fx:         fx,
+		httpLog:    httpLog,
+		exemplars:  exemplars,
+		lifecycle:  lifecycle,
+		watermark:  watermark,
+		http:       httpConfig,
+		security:   security,
+		api:        apiConfig,
+		signup:     signup,
+		drift:      drift,
+		adminToken: deps.AdminToken,
+
+		trustedProxies: parseTrustedProxies(deps.Proxy.TrustedProxies),
+	}
+}
+
+// Routes registers every endpoint on r
+func (s *Server) Routes(r *gin.Engine) {
+	r.Use(s.securityHeaders, s.logHTTP, s.localizeErrors, s.limitRequestBody, s.trackPayloadMemory, s.refuseWritesInMaintenance)
+
+	// Health check
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"service": "FraudDocAI Backend",
+			"status":  "running",
+			"version": "1.0.0",
+		})
+	})
+
+	r.GET("/health", func(c *gin.Context) {
+		health := gin.H{
+			"status":    "healthy",
+			"timestamp": "2024-01-01T00:00:00Z",
+		}
+		if s.leader != nil {
+			health["leadership"] = s.leader.Status()
+		}
+		health["maintenance"] = s.InMaintenance()
+		c.JSON(http.StatusOK, health)
+	})
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	// Profiling and runtime diagnostics, behind the admin token
+	debugRoutes := r.Group("/debug", s.requireAdmin)
+	debugRoutes.GET("/pprof/*profile", servePprof)
+	debugRoutes.POST("/pprof/*profile", servePprof)
+	debugRoutes.GET("/goroutines", getGoroutineDump)
+	debugRoutes.GET("/buildinfo", getBuildInfo)
+
+	// OpenAPI spec of the client-facing endpoints
+	r.GET("/api/openapi.yaml", getOpenAPISpec)
+
+	// Both API versions serve the same handlers until a breaking change
+	// gives v2 its own
+	s.apiRoutes(r.Group("/api/v1", s.apiVersion(apiV1), s.authenticateAPIKey, s.impersonate))
+	s.apiRoutes(r.Group("/api/v2", s.apiVersion(apiV2), s.authenticateAPIKey, s.impersonate))
+}
+
+// apiRoutes registers the versioned API endpoints under api
+func (s *Server) apiRoutes(api *gin.RouterGroup) {
+	// Document routes
+	documents := api.Group("/documents")
+	{
+		documents.POST("/upload", s.uploadDocument)
+		documents.GET("/", s.getDocuments)
+		documents.GET("/search", s.searchDocuments)
+		documents.GET("/stats", s.getDocumentStats)
+		documents.GET("/spend", s.getSpendReport)
+		documents.GET("/formats", s.getExtractionFormats)
+		// Events outlive their document, so they are scoped by the
+		// tenant their events record rather than by the document
+		documents.GET("/:id/events", s.getDocumentEvents)
+
+		// Routes addressing one document answer 404 for documents outside
+		// the request's scope
+		document := documents.Group("/:id", s.requireDocumentInScope)
+		{
+			document.GET("", s.getDocument)
+			document.GET("/download-url", s.getDocumentDownloadURL)
+			document.GET("/watermarked", s.getWatermarkedDocument)
+			document.GET("/semantically-similar", s.getSimilarDocuments)
+			document.GET("/detections", s.getDocumentDetections)
+			document.GET("/entities", s.getDocumentEntities)
+			document.GET("/submission", s.getDocumentSubmission)
+			document.PATCH("/metadata", s.patchDocumentMetadata)
+			document.POST("/extract-text", s.extractDocumentText)
+			document.GET("/pages", s.getDocumentPages)
+			document.POST("/reocr", s.reOCRDocument)
+			document.GET("/statement", s.getDocumentStatement)
+			document.GET("/accounts", s.getDocumentAccounts)
+			document.DELETE("", s.deleteDocument)
+		}
+	}
+
+	// Account routes
+	accounts := api.Group("/accounts", requireUUIDParam)
+	{
+		accounts.GET("/:id/risk", s.getAccountRisk)
+	}
+
+	// Fraud detection routes
+	fraud := api.Group("/fraud", requireUUIDParam)
+	{
+		fraud.POST("/analyze", s.analyzeDocument)
+		fraud.GET("/patterns", s.getFraudPatterns)
+		fraud.GET("/patterns/:id/stats", s.getFraudPatternStats)
+		fraud.GET("/detections", s.getFraudDetections)
+		fraud.POST("/detections/:id/review", s.reviewDetection)
+		fraud.GET("/feedback", s.getFeedbackLabels)
+		fraud.GET("/reports", s.getFraudReports)
+	}
+
+	// Known-fraud exemplar library
+	exemplars := api.Group("/exemplars", requireUUIDParam)
+	{
+		exemplars.POST("/", s.promoteExemplar)
+		exemplars.GET("/", s.getExemplars)
+		exemplars.GET("/:id", s.getExemplar)
+		exemplars.DELETE("/:id", s.deleteExemplar)
+	}
+
+	// Alert routes
+	alerts := api.Group("/alerts", requireUUIDParam)
+	{
+		alerts.GET("/", s.getAlerts)
+		alerts.GET("/sla", s.getAlertSLAReport)
+
+		// Routes addressing one alert answer 404 for alerts of another
+		// tenant than the request's
+		alert := alerts.Group("/:id", s.requireAlertInScope)
+		{
+			alert.GET("", s.getAlert)
+			alert.POST("/acknowledge", s.acknowledgeAlert)
+			alert.POST("/assign", s.assignAlert)
+			alert.GET("/escalations", s.getAlertEscalations)
+			alert.POST("/sar", s.createSARDraft)
+			alert.GET("/sar", s.getSARDraft)
+			alert.GET("/sar/pdf", s.getSARDraftPDF)
+		}
+	}
+
+	// Investigation cases, one per alert
+	cases := api.Group("/cases", requireUUIDParam)
+	{
+		cases.GET("/:id/timeline", s.getCaseTimeline)
+		cases.GET("/:id/summary.pdf", s.getCaseSummaryPDF)
+		cases.POST("/:id/evidence", s.attachCaseEvidence)
+		cases.GET("/:id/evidence", s.getCaseEvidence)
+		cases.GET("/:id/evidence/:evidence_id/file", s.getCaseEvidenceFile)
+		cases.GET("/:id/bundle", s.exportCaseBundle)
+	}
+
+	// Read-only access of external auditors to the cases and team
+	// collections of their grant; every request is audited
+	auditor := api.Group("/auditor", s.requireAuditorGrant, requireUUIDParam)
+	{
+		auditor.GET("/grant", s.getAuditorGrant)
+		auditor.GET("/cases", s.getAuditorCases)
+		auditor.GET("/cases/:id/timeline", s.auditorCase(s.getCaseTimeline))
+		auditor.GET("/cases/:id/evidence", s.auditorCase(s.getCaseEvidence))
+		auditor.GET("/cases/:id/evidence/:evidence_id/file", s.auditorCase(s.getAuditorEvidenceFile))
+		auditor.GET("/documents", s.getAuditorDocuments)
+		auditor.GET("/documents/:id", s.getAuditorDocument)
+		auditor.GET("/documents/:id/file", s.getAuditorDocumentFile)
+	}
+
+	// Four-eyes approval of closing critical alerts and overriding critical
+	// detections
+	approvals := api.Group("/approvals", requireUUIDParam)
+	{
+		approvals.POST("/", s.requestApproval)
+		approvals.GET("/", s.getApprovals)
+		approvals.POST("/:id/approve", s.approveApproval)
+		approvals.POST("/:id/reject", s.rejectApproval)
+	}
+
+	// Out-of-office delegation of the X-User reviewer's queue
+	delegations := api.Group("/delegations", requireUUIDParam)
+	{
+		delegations.POST("/", s.createDelegation)
+		delegations.GET("/", s.getDelegations)
+		delegations.DELETE("/:id", s.deleteDelegation)
+	}
+
+	// Data subject export and erasure, and the legal holds erasure respects;
+	// operator only
+	privacy := api.Group("/privacy", s.requireAdmin, requireUUIDParam)
+	{
+		privacy.POST("/export", s.exportDataSubject)
+		privacy.POST("/erase", s.eraseDataSubject)
+		privacy.GET("/requests", s.getPrivacyRequests)
+		privacy.POST("/holds", s.placeLegalHold)
+		privacy.GET("/holds", s.getLegalHolds)
+		privacy.DELETE("/holds/:id", s.releaseLegalHold)
+	}
+
+	// Document Question Answering routes
+	qa := api.Group("/qa")
+	{
+		qa.POST("/ask", s.askDocument)
+		qa.POST("/analyze-fraud", s.analyzeDocumentFraud)
+		qa.GET("/analyses/:id", s.getFraudQAAnalysis)
+		qa.GET("/model-info", s.getQAModelInfo)
+	}
+
+	// The impersonation session a request is made in, for the banner, and
+	// its end
+	api.GET("/impersonation", s.getOwnImpersonation)
+	api.POST("/impersonation/stop", s.stopOwnImpersonation)
+
+	// Whether support staff may impersonate the requesting tenant's users,
+	// set by the tenant's admin
+	api.PUT("/impersonation-consent", s.putImpersonationConsent)
+
+	// Self-service provisioning of a tenant, its admin and an API key
+	api.POST("/tenants/signup", s.signUpTenant)
+
+	// Risk levels of the requesting tenant
+	api.GET("/risk-levels", s.getRiskLevels)
+
+	// Disposition codes of the requesting tenant and how often each was used
+	api.GET("/dispositions", s.getDispositions)
+	api.GET("/dispositions/report", s.getDispositionReport)
+
+	// Metadata fields of each document type for the requesting tenant
+	api.GET("/document-fields", s.getDocumentFields)
+
+	// Who may approve what amount at the requesting tenant
+	api.GET("/approval-policy", s.getApprovalPolicy)
+
+	// Feed of document and detection changes for downstream sync
+	api.GET("/changes", s.getChanges)
+
+	// User routes
+	users := api.Group("/users")
+	{
+		users.POST("/register", s.registerUser)
+		users.POST("/login", s.loginUser)
+		users.GET("/profile", s.getUserProfile)
+	}
+
+	// Operator routes
+	admin := api.Group("/admin", s.requireAdmin)
+	{
+		admin.GET("/ai-contract-check", s.checkAIContract)
+		admin.POST("/qa-model-info/invalidate", s.invalidateQAModelInfo)
+		admin.PUT("/tenants/:slug/risk-taxonomy", s.putRiskTaxonomy)
+		admin.DELETE("/tenants/:slug/risk-taxonomy", s.deleteRiskTaxonomy)
+		admin.PUT("/tenants/:slug/escalation-chain", s.putEscalationChain)
+		admin.DELETE("/tenants/:slug/escalation-chain", s.deleteEscalationChain)
+		admin.PUT("/tenants/:slug/dispositions", s.putDispositionTaxonomy)
+		admin.DELETE("/tenants/:slug/dispositions", s.deleteDispositionTaxonomy)
+		admin.PUT("/tenants/:slug/document-fields", s.putDocumentFields)
+		admin.DELETE("/tenants/:slug/document-fields", s.deleteDocumentFields)
+		admin.PUT("/tenants/:slug/approval-policy", s.putApprovalPolicy)
+		admin.DELETE("/tenants/:slug/approval-policy", s.deleteApprovalPolicy)
+		admin.PUT("/tenants/:slug/channel-weights", s.putChannelWeights)
+		admin.DELETE("/tenants/:slug/channel-weights", s.deleteChannelWeights)
+		admin.PUT("/tenants/:slug/velocity-rules", s.putVelocityRules)
+		admin.DELETE("/tenants/:slug/velocity-rules", s.deleteVelocityRules)
+		admin.PUT("/tenants/:slug/question-set", s.putQuestionSet)
+		admin.GET("/tenants/:slug/question-sets", s.getQuestionSets)
+		admin.GET("/tenants/:slug/config", s.exportTenantConfig)
+		admin.POST("/tenants/:slug/config/import", s.importTenantConfig)
+		admin.POST("/tenants/:slug/config/what-if", s.whatIfTenantConfig)
+		admin.POST("/tenants/:slug/backtest", s.backtestTenantScoring)
+		admin.GET("/storage-regions", s.getStorageRegions)
+		admin.PUT("/tenants/:slug/storage-region", s.putTenantStorageRegion)
+		admin.PUT("/tenants/:slug/language", s.putTenantLanguage)
+		admin.PUT("/tenants/:slug/time-zone", s.putTenantTimeZone)
+		admin.PUT("/tenants/:slug/base-currency", s.putTenantBaseCurrency)
+		admin.PUT("/tenants/:slug/holiday-calendar", s.putTenantHolidayCalendar)
+		admin.GET("/holiday-calendars", s.getHolidayCalendars)
+		admin.GET("/holiday-calendars/:code", s.getHolidayCalendar)
+		admin.PUT("/holiday-calendars/:code", s.putHolidayCalendar)
+		admin.DELETE("/holiday-calendars/:code", s.deleteHolidayCalendar)
+		admin.PUT("/holiday-calendars/:code/holidays/:date", s.putHoliday)
+		admin.DELETE("/holiday-calendars/:code/holidays/:date", s.deleteHoliday)
+		admin.GET("/languages", s.getLanguages)
+		admin.POST("/languages/reload", s.reloadLanguages)
+		admin.POST("/backups", s.createBackup)
+		admin.GET("/backups", s.getBackups)
+		admin.GET("/backups/:id/verify", s.verifyBackup)
+		admin.POST("/backups/:id/restore", s.restoreBackup)
+		admin.GET("/credential-rotations", s.getCredentialRotations)
+		admin.GET("/audit-log", s.getAuditLog)
+		admin.GET("/pipeline-stats", s.getPipelineStats)
+		admin.GET("/model-performance", s.getModelPerformance)
+		admin.GET("/canary", s.getCanaryReport)
+		admin.POST("/synthetic-runs", s.runSyntheticDocuments)
+		admin.POST("/selftest", s.runSelfTest)
+		admin.GET("/exports/documents", s.exportDocuments)
+		admin.GET("/exports/graph", s.exportGraph)
+		admin.GET("/graph-sync", s.getGraphSync)
+		admin.POST("/graph-sync/reset", s.resetGraphSync)
+		admin.GET("/pseudonyms/:token", s.getPseudonym)
+		admin.GET("/maintenance", s.getMaintenance)
+		admin.PUT("/maintenance", s.putMaintenance)
+		admin.POST("/users", s.createUser)
+		admin.PUT("/users/:id/role", requireUUIDParam, s.updateUserRole)
+		admin.PUT("/users/:id/language", requireUUIDParam, s.putUserLanguage)
+		admin.POST("/tenants/:slug/teams", s.createTeam)
+		admin.GET("/tenants/:slug/teams", s.getTeams)
+		admin.PUT("/teams/:id/members/:user_id", s.addTeamMember)
+		admin.DELETE("/teams/:id/members/:user_id", s.removeTeamMember)
+		admin.PUT("/documents/:id/team", s.putDocumentTeam)
+		admin.POST("/documents/:id/replay", s.replayDocument)
+		admin.GET("/log-levels", s.getLogLevels)
+		admin.PUT("/log-levels/:component", s.putLogLevel)
+		admin.DELETE("/log-levels/:component", s.deleteLogLevel)
+		admin.GET("/runtime", s.getRuntime)
+		admin.POST("/tenants/:slug/auditor-grants", s.createAuditorGrant)
+		admin.GET("/tenants/:slug/auditor-grants", s.getAuditorGrants)
+		admin.DELETE("/auditor-grants/:id", requireUUIDParam, s.revokeAuditorGrant)
+		admin.GET("/tenants/:slug/api-keys", s.getAPIKeys)
+		admin.DELETE("/api-keys/:id", requireUUIDParam, s.revokeAPIKey)
+		admin.GET("/tenants/:slug/impersonation-consent", s.getTenantImpersonationConsent)
+		admin.GET("/tenants/:slug/impersonations", s.getImpersonations)
+		admin.POST("/impersonations", s.startImpersonation)
+		admin.POST("/impersonations/:id/stop", requireUUIDParam, s.stopImpersonation)
+	}
+}
+
+// overloadRetryAfter is the Retry-After, in seconds, of calls refused
+// because the AI service is overloaded
+const overloadRetryAfter = 5
+
+// respondAIError writes the error response for a failed AI service call
+func respondAIError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrAIOverloaded) {
+		// Shed rather than queue: the caller is better off retrying later
+		// than waiting behind every call already in line
+		c.Header("Retry-After", strconv.Itoa(overloadRetryAfter))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "AI service overloaded",
+			"status": "error",
+		})
+		return
+	}
+	if errors.Is(err, services.ErrAIServiceUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":  "AI service unavailable",
+			"status": "error",
+		})
+		return
+	}
+
+	var statusErr *services.AIStatusError
+	if errors.Is(err, services.ErrInvalidAIResponse) || errors.As(err, &statusErr) {
+		log.Printf("AI service returned a bad response: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error":  "Invalid AI service response",
+			"status": "error",
+		})
+		return
+	}
+
+	log.Printf("AI service request failed: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":  "AI service request failed",
+		"status": "error",
+	})
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// processStarted is when the backend started, for the uptime of runtime
+// snapshots
+var processStarted = time.Now()
+
+// getRuntime returns a snapshot of the process: goroutines, heap, garbage
+// collection and the database connection pool. Reading it stops the world
+// for a moment, so it is meant for diagnosing, not for polling; /metrics
+// has the same figures as time series.
+func (s *Server) getRuntime(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var lastGC *time.Time
+	var lastPause time.Duration
+	if mem.NumGC > 0 {
+		at := time.Unix(0, int64(mem.LastGC)).UTC()
+		lastGC = &at
+		lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	pool := s.store.PoolStats()
+	c.JSON(http.StatusOK, gin.H{
+		"started_at":     processStarted.UTC(),
+		"uptime_seconds": int64(time.Since(processStarted).Seconds()),
+		"go_version":     runtime.Version(),
+		"num_cpu":        runtime.NumCPU(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"goroutines":     runtime.NumGoroutine(),
+		"heap": gin.H{
+			"alloc_bytes":    mem.HeapAlloc,
+			"inuse_bytes":    mem.HeapInuse,
+			"idle_bytes":     mem.HeapIdle,
+			"released_bytes": mem.HeapReleased,
+			"sys_bytes":      mem.HeapSys,
+			"objects":        mem.HeapObjects,
+			"total_alloc":    mem.TotalAlloc,
+			"mallocs":        mem.Mallocs,
+			"frees":          mem.Frees,
+		},
+		"sys_bytes": mem.Sys,
+		"gc": gin.H{
+			"count":             mem.NumGC,
+			"forced":            mem.NumForcedGC,
+			"last_at":           lastGC,
+			"last_pause_ms":     float64(lastPause.Microseconds()) / 1000,
+			"pause_total_ms":    float64(time.Duration(mem.PauseTotalNs).Microseconds()) / 1000,
+			"next_target_bytes": mem.NextGC,
+			"cpu_fraction":      mem.GCCPUFraction,
+			"memory_limit":      debug.SetMemoryLimit(-1),
+		},
+		"db": gin.H{
+			"max_open":             pool.MaxOpenConnections,
+			"open":                 pool.OpenConnections,
+			"in_use":               pool.InUse,
+			"idle":                 pool.Idle,
+			"wait_count":           pool.WaitCount,
+			"wait_duration_ms":     pool.WaitDuration.Milliseconds(),
+			"max_idle_closed":      pool.MaxIdleClosed,
+			"max_idle_time_closed": pool.MaxIdleTimeClosed,
+			"max_lifetime_closed":  pool.MaxLifetimeClosed,
+		},
+		"status": "success",
+	})
+}
+
+// getBuildInfo returns the module, dependencies and VCS settings the binary
+// was built from
+func getBuildInfo(c *gin.Context) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Build information is not available",
+			"status": "error",
+		})
+		return
+	}
+
+	settings := map[string]string{}
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	deps := make([]gin.H, 0, len(info.Deps))
+	for _, dep := range info.Deps {
+		d := gin.H{"path": dep.Path, "version": dep.Version}
+		if dep.Replace != nil {
+			d["replaced_by"] = dep.Replace.Path + " " + dep.Replace.Version
+		}
+		deps = append(deps, d)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"go_version":   info.GoVersion,
+		"path":         info.Path,
+		"main":         gin.H{"path": info.Main.Path, "version": info.Main.Version},
+		"settings":     settings,
+		"dependencies": deps,
+		"status":       "success",
+	})
+}
+
+// getGoroutineDump writes the stack of every goroutine as plain text, as a
+// crashing Go program prints them
+func getGoroutineDump(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	rpprof.Lookup("goroutine").WriteTo(c.Writer, 2)
+}
+
+// servePprof serves net/http/pprof under /debug/pprof. Index serves the
+// named profiles, such as heap and goroutine, by the rest of the path.
+func servePprof(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sarSources gathers what a Suspicious Activity Report of the alert, and the
+// timeline of its case, is drafted from. Linked documents outside the scope
+// are left out, as if the case had none.
+func (s *Server) sarSources(alert *services.Alert, scope services.DocumentScope) (services.SARSources, error) {
+	src := services.SARSources{Alert: alert}
+	var err error
+	if alert.TenantID != nil {
+		if src.Tenant, err = s.store.GetTenant(*alert.TenantID); err != nil {
+			return src, fmt.Errorf("failed to load tenant %s: %v", *alert.TenantID, err)
+		}
+	}
+
+	var documents []services.DocumentID
+	if alert.DocumentID != nil {
+		src.Document, err = s.store.GetDocument(*alert.DocumentID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return src, fmt.Errorf("failed to load document %s: %v", *alert.DocumentID, err)
+		}
+		if src.Document != nil && !scope.Allows(src.Document) {
+			src.Document = nil
+		}
+		if src.Document != nil {
+			documents = append(documents, src.Document.ID)
+			src.Detections, err = s.store.GetFraudDetections(services.DetectionFilter{DocumentID: src.Document.ID, Limit: 1000})
+			if err != nil {
+				return src, err
+			}
+		}
+	}
+	if alert.ExemplarID != nil {
+		exemplar, err := s.store.GetExemplar(*alert.ExemplarID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return src, fmt.Errorf("failed to load exemplar %s: %v", *alert.ExemplarID, err)
+		}
+		if exemplar != nil && exemplar.DocumentID != nil {
+			src.Exemplar, err = s.store.GetDocument(*exemplar.DocumentID)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return src, fmt.Errorf("failed to load document %s: %v", *exemplar.DocumentID, err)
+			}
+			if src.Exemplar != nil && !scope.Allows(src.Exemplar) {
+				src.Exemplar = nil
+			}
+			if src.Exemplar != nil {
+				documents = append(documents, src.Exemplar.ID)
+			}
+		}
+	}
+	for _, id := range documents {
+		entities, err := s.store.GetDocumentEntities(id)
+		if err != nil {
+			return src, err
+		}
+		src.Entities = append(src.Entities, entities...)
+		events, err := s.store.GetDocumentEvents(id)
+		if err != nil {
+			return src, err
+		}
+		src.Events = append(src.Events, events...)
+	}
+
+	if src.Escalations, err = s.store.GetAlertEscalations(alert.ID); err != nil {
+		return src, err
+	}
+	if src.Approvals, err = s.store.GetApprovals(services.ApprovalFilter{TargetID: alert.ID, Limit: 100}); err != nil {
+		return src, err
+	}
+	if src.Evidence, err = s.store.GetCaseEvidenceList(alert.ID); err != nil {
+		return src, err
+	}
+	src.Notifications, err = s.store.GetAlertWebhookEvents(alert.ID)
+	return src, err
+}
+
+// createSARDraft drafts a Suspicious Activity Report of a confirmed fraud
+// alert for the X-User reviewer and stores it as the alert's next version
+func (s *Server) createSARDraft(c *gin.Context) {
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+
+	alert := scopedAlert(c)
+	// The draft is the case's for every reviewer, so it covers all of it
+	src, err := s.sarSources(alert, services.DocumentScope{})
+	var report *services.SARReport
+	var draft *services.SARDraft
+	if err == nil {
+		report, err = services.DraftSAR(src, time.Now())
+	}
+	if err == nil {
+		draft = &services.SARDraft{TenantID: alert.TenantID, AlertID: alert.ID, Report: report, GeneratedBy: &user.ID}
+		err = s.store.CreateSARDraft(draft)
+	}
+	if errors.Is(err, services.ErrNotConfirmedFraud) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Only alerts closed as confirmed fraud get a SAR draft",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to draft SAR of alert %s: %v", alert.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to draft SAR",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("User %s drafted SAR version %d of alert %s", user.ID, draft.Version, alert.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"sar":    draft,
+		"status": "success",
+	})
+}
+
+// sarDraft loads the alert's draft version named by the version query
+// parameter, the latest by default, responding when there is none
+func (s *Server) sarDraft(c *gin.Context) (*services.SARDraft, bool) {
+	version, err := strconv.Atoi(c.DefaultQuery("version", "0"))
+	if err != nil || version < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "version must be a positive integer",
+			"status": "error",
+		})
+		return nil, false
+	}
+
+	draft, err := s.store.GetSARDraft(scopedAlert(c).ID, version)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "SAR draft not found",
+			"status": "error",
+		})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Failed to retrieve SAR of alert %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve SAR draft",
+			"status": "error",
+		})
+		return nil, false
+	}
+	return draft, true
+}
+
+// getSARDraft returns an alert's SAR draft as structured JSON
+func (s *Server) getSARDraft(c *gin.Context) {
+	draft, ok := s.sarDraft(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sar":    draft,
+		"status": "success",
+	})
+}
+
+// getSARDraftPDF exports an alert's SAR draft as a PDF, in the language
+// of the request
+func (s *Server) getSARDraftPDF(c *gin.Context) {
+	draft, ok := s.sarDraft(c)
+	if !ok {
+		return
+	}
+
+	localizer := s.requestLocalizer(c)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="sar-%s-v%d.pdf"`, draft.AlertID, draft.Version))
+	c.Header("Content-Language", localizer.Language)
+	c.Data(http.StatusOK, "application/pdf", draft.Report.PDF(localizer))
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSearchResults caps the limit accepted by the search endpoints
+const maxSearchResults = 100
+
+// Search handlers
+func (s *Server) getSimilarDocuments(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	limit, minSimilarity, ok := searchParams(c)
+	if !ok {
+		return
+	}
+
+	embedding, err := s.store.GetDocumentEmbedding(documentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "Document has not been embedded yet",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	similar, err := s.store.FindSimilarDocuments(embedding, limit, documentID)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+	similar = aboveSimilarity(similar, minSimilarity)
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"similar":     similar,
+		"total":       len(similar),
+		"status":      "success",
+	})
+}
+
+func (s *Server) searchDocuments(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Query parameter q is required",
+			"status": "error",
+		})
+		return
+	}
+	limit, minSimilarity, ok := searchParams(c)
+	if !ok {
+		return
+	}
+
+	switch mode := c.DefaultQuery("mode", "keyword"); mode {
+	case "keyword":
+		_, scope, err := s.requestScope(c)
+		if err != nil {
+			respondScopeError(c, err)
+			return
+		}
+		documents, err := s.store.SearchDocuments(query, limit, scope)
+		if err != nil {
+			respondSearchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mode":      mode,
+			"documents": documents,
+			"total":     len(documents),
+			"status":    "success",
+		})
+
+	case "semantic":
+		embedding, err := s.ai.GenerateEmbedding(c.Request.Context(), services.EmbeddingRequest{Text: query})
+		if err != nil {
+			respondAIError(c, err)
+			return
+		}
+		similar, err := s.store.FindSimilarDocuments(embedding.Embeddings, limit, "")
+		if err != nil {
+			respondSearchError(c, err)
+			return
+		}
+		similar = aboveSimilarity(similar, minSimilarity)
+		c.JSON(http.StatusOK, gin.H{
+			"mode":    mode,
+			"results": similar,
+			"total":   len(similar),
+			"status":  "success",
+		})
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "mode must be keyword or semantic",
+			"status": "error",
+		})
+	}
+}
+
+// searchParams reads limit and min_similarity, writing a 400 response and
+// returning false when either is malformed
+func searchParams(c *gin.Context) (int, float64, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxSearchResults {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "limit must be between 1 and 100",
+			"status": "error",
+		})
+		return 0, 0, false
+	}
+
+	minSimilarity, err := strconv.ParseFloat(c.DefaultQuery("min_similarity", "0"), 64)
+	if err != nil || minSimilarity < -1 || minSimilarity > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "min_similarity must be between -1 and 1",
+			"status": "error",
+		})
+		return 0, 0, false
+	}
+	return limit, minSimilarity, true
+}
+
+func aboveSimilarity(results []*services.SimilarDocument, min float64) []*services.SimilarDocument {
+	filtered := make([]*services.SimilarDocument, 0, len(results))
+	for _, result := range results {
+		if result.Similarity >= min {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+func respondSearchError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrSemanticSearchUnavailable) {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error":  "Semantic search requires the pgvector extension",
+			"status": "error",
+		})
+		return
+	}
+
+	log.Printf("Document search failed: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":  "Failed to search documents",
+		"status": "error",
+	})
+}
+
+// embedDocument generates an embedding of the document text, stores it for
+// semantic search and returns it. Failing to store it is only logged: the
+// embedding can still be compared with exemplars, and the document stays
+// searchable by keyword.
+func (s *Server) embedDocument(ctx context.Context, documentID services.DocumentID, text string) ([]float32, error) {
+	embedding, err := s.ai.GenerateEmbedding(ctx, services.EmbeddingRequest{Text: text})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embedding: %v", err)
+	}
+
+	err = s.store.SaveDocumentEmbedding(documentID, embedding.Model, embedding.Embeddings)
+	if err != nil && !errors.Is(err, services.ErrSemanticSearchUnavailable) {
+		log.Printf("Failed to store embedding for document %s: %v", documentID, err)
+	}
+	return embedding.Embeddings, nil
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// selfTestStage is how one stage of a self test went. Stages after a failed
+// one are skipped, as they have nothing to work on.
+type selfTestStage struct {
+	Stage      string `json:"stage"`
+	Outcome    string `json:"outcome"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	Details    gin.H  `json:"details,omitempty"`
+}
+
+// runSelfTest sends the canned self-test invoice through storage,
+// extraction, analysis and scoring with the server's own dependencies, as
+// the pipeline of an upload would, and reports each stage. Nothing is kept:
+// the stored object is deleted and no document is created. It answers 503
+// when a stage fails, so that deploy pipelines and uptime checks can go by
+// the status code alone.
+func (s *Server) runSelfTest(c *gin.Context) {
+	var query struct {
+		Tenant string `form:"tenant"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	var tenant *services.Tenant
+	if query.Tenant != "" {
+		var err error
+		if tenant, err = s.store.GetTenantBySlug(query.Tenant); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Tenant not found",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	started := time.Now()
+	var stages []*selfTestStage
+	failed := false
+	run := func(name string, fn func(stage *selfTestStage) error) {
+		stage := &selfTestStage{Stage: name, Outcome: services.StageSkipped, Details: gin.H{}}
+		stages = append(stages, stage)
+		if failed {
+			return
+		}
+		stageStarted := time.Now()
+		err := fn(stage)
+		stage.DurationMS = time.Since(stageStarted).Milliseconds()
+		if err != nil {
+			stage.Outcome, stage.Error = services.StageFailed, err.Error()
+			failed = true
+			return
+		}
+		stage.Outcome = services.StageSucceeded
+	}
+
+	document := services.SelfTestDocument()
+	var content []byte
+	run("storage", func(stage *selfTestStage) error {
+		var err error
+		content, err = s.selfTestStorage(ctx, tenant, document, stage)
+		return err
+	})
+
+	var text string
+	run(services.StageExtraction, func(stage *selfTestStage) error {
+		const mimeType = "application/pdf"
+		stage.Details["extractor"] = s.extractors.MediaTypes()[mimeType]
+		extraction, err := s.extractors.Extract(ctx, mimeType, bytes.NewReader(content))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(extraction.Text, services.SelfTestMarker) {
+			return fmt.Errorf("extracted text does not contain the invoice number %s", services.SelfTestMarker)
+		}
+		text = extraction.Text
+		stage.Details["text_length"] = len(text)
+		return nil
+	})
+
+	var analysis *services.AnalyzeTextResponse
+	run(services.StageAIAnalysis, func(stage *selfTestStage) error {
+		// The analyzer is called directly, past the analysis cache and the
+		// batch coordinator, so that every self test reaches the provider
+		tenantSlug := ""
+		if tenant != nil {
+			tenantSlug = tenant.Slug
+		}
+		analyzer := s.analyzers.ForTenant(tenantSlug)
+		stage.Details["provider"] = analyzer.Name()
+		stage.Details["model_version"] = analyzer.ModelVersion()
+		var err error
+		if analysis, err = analyzer.Analyze(ctx, services.AnalyzeTextRequest{Text: text}); err != nil {
+			return err
+		}
+		if analysis.Fallback {
+			return errors.New("the text was scored by the fallback provider, so the configured provider failed")
+		}
+		return nil
+	})
+
+	run("scoring", func(stage *selfTestStage) error {
+		taxonomy := riskTaxonomyFor(tenant)
+		result := services.NewFraudAnalysis(text, analysis, taxonomy)
+		stage.Details["fraud_score"] = result.FraudScore
+		stage.Details["risk_level"] = result.RiskLevel
+		if result.FraudScore < 0 || result.FraudScore > 1 {
+			return fmt.Errorf("fraud score %v is outside 0 to 1", result.FraudScore)
+		}
+		return taxonomy.CheckLevel(result.RiskLevel)
+	})
+
+	response := gin.H{
+		"passed":      !failed,
+		"duration_ms": time.Since(started).Milliseconds(),
+		"stages":      stages,
+		"status":      "success",
+	}
+	if failed {
+		failure := selfTestFailure(stages)
+		log.Printf("Self test failed: %s", failure)
+		response["error"], response["status"] = "Self test failed at "+failure, "error"
+		c.JSON(http.StatusServiceUnavailable, response)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// selfTestStorage uploads the self-test document to the storage region of
+// the tenant, or the default one, reads it back and deletes it, returning
+// what was read
+func (s *Server) selfTestStorage(ctx context.Context, tenant *services.Tenant, document []byte, stage *selfTestStage) ([]byte, error) {
+	region, storage, err := s.tenantStorage(tenant)
+	if err != nil {
+		return nil, err
+	}
+	stage.Details["region"] = region
+
+	objectName := fmt.Sprintf("selftest/%d.pdf", time.Now().UnixNano())
+	if err := storage.UploadFile(ctx, objectName, bytes.NewReader(document), int64(len(document)), "application/pdf"); err != nil {
+		return nil, fmt.Errorf("upload failed: %v", err)
+	}
+	defer func() {
+		// Deleted even when the request was cancelled, so that no self-test
+		// objects are left behind
+		if err := storage.DeleteFile(context.Background(), objectName); err != nil {
+			log.Printf("Failed to delete self-test object %s: %v", objectName, err)
+		}
+	}()
+
+	reader, err := storage.GetFile(ctx, objectName)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %v", err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %v", err)
+	}
+	if !bytes.Equal(content, document) {
+		return nil, fmt.Errorf("downloaded %d bytes differ from the %d uploaded", len(content), len(document))
+	}
+	return content, nil
+}
+
+func selfTestFailure(stages []*selfTestStage) string {
+	for _, stage := range stages {
+		if stage.Outcome == services.StageFailed {
+			return stage.Stage + ": " + stage.Error
+		}
+	}
+	return ""
+}
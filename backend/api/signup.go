@@ -0,0 +1,227 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tenantSlugPattern is what a tenant slug may be: lower-case letters,
+// digits and inner hyphens
+var tenantSlugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]*[a-z0-9])?$`)
+
+// signupRequest is the body of POST /tenants/signup
+type signupRequest struct {
+	Slug          string  `json:"slug" binding:"required,min=3,max=63"`
+	Name          string  `json:"name" binding:"required,notblank,max=255"`
+	StorageRegion *string `json:"storage_region" binding:"omitempty,notblank"`
+	Language      *string `json:"language" binding:"omitempty,notblank"`
+	TimeZone      *string `json:"time_zone" binding:"omitempty,notblank"`
+	Admin         struct {
+		Email     string `json:"email" binding:"required,email,max=255"`
+		Password  string `json:"password" binding:"required,min=8,max=72"`
+		FirstName string `json:"first_name" binding:"omitempty,max=100"`
+		LastName  string `json:"last_name" binding:"omitempty,max=100"`
+	} `json:"admin" binding:"required"`
+}
+
+// signUpTenant provisions a tenant end to end: the tenant, pinned to a
+// storage region and with its own copy of the default risk levels, its
+// first admin and a welcome API key. The key is in the response only; it
+// cannot be retrieved later. Posting the same signup again, with the same
+// admin password, replaces the welcome key until one of the tenant's keys
+// is used, so a client that lost the response can retry.
+func (s *Server) signUpTenant(c *gin.Context) {
+	if !s.signup.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "Self-service signup is disabled",
+			"status": "error",
+		})
+		return
+	}
+	var req signupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !tenantSlugPattern.MatchString(req.Slug) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "slug must be lower-case letters, digits and hyphens, starting and ending with a letter or digit",
+			"status": "error",
+		})
+		return
+	}
+
+	tenant := &services.Tenant{Slug: req.Slug, Name: strings.TrimSpace(req.Name)}
+	region := s.storage.DefaultRegion()
+	if req.StorageRegion != nil {
+		region = *req.StorageRegion
+	}
+	if _, err := s.storage.ForRegion(region); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Unknown storage region",
+			"regions": s.storage.Regions(),
+			"status":  "error",
+		})
+		return
+	}
+	if req.StorageRegion != nil {
+		tenant.StorageRegion = &region
+	}
+	if req.Language != nil {
+		if s.i18n.Supported(*req.Language) == "" {
+			s.respondUnsupportedLanguage(c)
+			return
+		}
+		language := services.NormalizeLanguage(*req.Language)
+		tenant.Language = &language
+	}
+	if req.TimeZone != nil {
+		loc, err := services.LoadTimeZone(*req.TimeZone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "time_zone must be an IANA time zone such as Europe/Berlin",
+				"status": "error",
+			})
+			return
+		}
+		name := loc.String()
+		tenant.TimeZone = &name
+	}
+
+	existing, err := s.store.GetTenantBySlug(req.Slug)
+	if err == nil {
+		s.retrySignup(c, existing, &req)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to look up tenant %s: %v", req.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to sign up tenant",
+			"status": "error",
+		})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Admin.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to sign up tenant",
+			"status": "error",
+		})
+		return
+	}
+	admin := &services.User{
+		Email:        req.Admin.Email,
+		PasswordHash: string(hash),
+		FirstName:    req.Admin.FirstName,
+		LastName:     req.Admin.LastName,
+	}
+	key, digest, err := services.NewAPIKey()
+	var signup *services.TenantSignup
+	if err == nil {
+		signup, err = s.store.SignUpTenant(tenant, admin, digest, clientIP(c))
+	}
+	switch {
+	case errors.Is(err, services.ErrTenantExists):
+		respondTenantExists(c)
+		return
+	case errors.Is(err, services.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "A user with this email already exists",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to sign up tenant %s: %v", req.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to sign up tenant",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Signed up tenant %s (%s) with admin %s in region %s", tenant.Slug, tenant.ID, admin.ID, region)
+	s.emitWebhook(services.WebhookTenantSignedUp, &tenant.ID, gin.H{"tenant": tenant, "user": admin})
+
+	s.respondSignup(c, http.StatusCreated, signup, region, key)
+}
+
+// retrySignup answers a signup for a tenant that exists. When it repeats
+// the tenant's own signup, a new welcome key replaces the one whose
+// response was lost.
+func (s *Server) retrySignup(c *gin.Context, tenant *services.Tenant, req *signupRequest) {
+	admin, err := s.store.GetUserByEmail(req.Admin.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to look up user %s: %v", req.Admin.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to sign up tenant",
+			"status": "error",
+		})
+		return
+	}
+	if admin == nil || admin.Role != services.RoleAdmin || admin.TenantID == nil || *admin.TenantID != tenant.ID ||
+		bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(req.Admin.Password)) != nil {
+		respondTenantExists(c)
+		return
+	}
+
+	key, digest, err := services.NewAPIKey()
+	var apiKey *services.APIKey
+	if err == nil {
+		apiKey, err = s.store.ReplaceWelcomeAPIKey(tenant, admin, digest, clientIP(c))
+	}
+	if errors.Is(err, services.ErrTenantExists) {
+		respondTenantExists(c)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to replace welcome key of tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to sign up tenant",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Replaced welcome key of tenant %s on a repeated signup", tenant.Slug)
+
+	region := s.storage.DefaultRegion()
+	if tenant.StorageRegion != nil {
+		region = *tenant.StorageRegion
+	}
+	s.respondSignup(c, http.StatusOK, &services.TenantSignup{Tenant: tenant, Admin: admin, APIKey: apiKey}, region, key)
+}
+
+// respondSignup describes what a signup provisioned. Fraud patterns are
+// shared by every tenant; the response counts those screening its
+// documents.
+func (s *Server) respondSignup(c *gin.Context, status int, signup *services.TenantSignup, region, key string) {
+	patterns, err := s.store.GetFraudPatterns()
+	if err != nil {
+		log.Printf("Failed to count fraud patterns: %v", err)
+	}
+	c.JSON(status, gin.H{
+		"tenant":         signup.Tenant,
+		"admin":          signup.Admin,
+		"storage_region": region,
+		"risk_levels":    signup.Tenant.Taxonomy().Levels,
+		"fraud_patterns": len(patterns),
+		"api_key":        signup.APIKey,
+		"key":            key,
+		"status":         "success",
+	})
+}
+
+func respondTenantExists(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{
+		"error":  "A tenant with this slug already exists",
+		"status": "error",
+	})
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slaClock returns the clock a tenant's alerts are measured with: the
+// business hours of its holiday calendar in its time zone, or every hour
+// when it has no calendar
+func (s *Server) slaClock(tenant *services.Tenant) (services.SLAClock, error) {
+	clock := services.SLAClock{Location: tenant.Location()}
+	if tenant.HolidayCalendar == nil {
+		return clock, nil
+	}
+	calendar, err := s.store.GetHolidayCalendar(*tenant.HolidayCalendar, 0)
+	if errors.Is(err, sql.ErrNoRows) {
+		return clock, nil
+	}
+	if err != nil {
+		return clock, err
+	}
+	clock.Calendar = calendar
+	return clock, nil
+}
+
+// getAlertSLAReport measures how quickly the X-Tenant tenant's alerts raised
+// since since (default 90 days ago) were acknowledged, in business hours
+// when the tenant has a holiday calendar. clock=wall counts every hour
+// instead.
+func (s *Server) getAlertSLAReport(c *gin.Context) {
+	var query struct {
+		Clock string `form:"clock" binding:"omitempty,oneof=business wall"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		respondTenantError(c, err)
+		return
+	}
+	if tenant == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  TenantHeader + " header is required",
+			"status": "error",
+		})
+		return
+	}
+	loc, ok := statsLocation(c, tenant)
+	if !ok {
+		return
+	}
+	since := services.StartOfDay(time.Now().Add(-defaultStatsWindow), loc)
+	if value := c.Query("since"); value != "" {
+		if since, err = parseQueryTimeIn(value, loc); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	clock, err := s.slaClock(tenant)
+	if err != nil {
+		log.Printf("Failed to load holiday calendar of tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute SLA report",
+			"status": "error",
+		})
+		return
+	}
+	switch {
+	case query.Clock == "wall":
+		clock.Calendar = nil
+	case query.Clock == "business" && !clock.BusinessHours():
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "clock=business needs the tenant to have a holiday calendar",
+			"status": "error",
+		})
+		return
+	}
+
+	records, err := s.store.GetAlertSLARecords(tenant.ID, since)
+	if err != nil {
+		log.Printf("Failed to compute SLA report: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to compute SLA report",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sla":    services.NewAlertSLAReport(records, clock, since, time.Now()),
+		"status": "success",
+	})
+}
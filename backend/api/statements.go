@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statementPlan is the incremental analysis of a bank statement: the
+// content its account's earlier statements did not have, and the record of
+// the statement to store once it is analyzed
+type statementPlan struct {
+	statement *services.AccountStatement
+	digests   []string
+	content   string
+	// repeats are the statements the repeated content was first seen in
+	repeats []services.DocumentID
+}
+
+// planStatementAnalysis returns how to analyze the document as a statement
+// of its bank account, or nil when it is to be analyzed whole: it is not a
+// bank statement of a known account, its text was not extracted or
+// incremental analysis is off
+func (s *Server) planStatementAnalysis(run *pipelineRun) (*statementPlan, error) {
+	if !s.accounts.Incremental || !run.extracted {
+		return nil, nil
+	}
+	document := run.document
+	identifier := services.StatementAccountIdentifier(document, run.text)
+	if identifier == "" {
+		return nil, nil
+	}
+
+	account, err := s.store.GetOrCreateAccount(document.TenantID, services.AccountKindBank, identifier)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.store.GetPreviousAccountStatement(account.ID, document.ID)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := s.store.GetDocumentPages(document.ID)
+	if err != nil {
+		return nil, err
+	}
+	segments := services.StatementSegments(run.text, pages)
+	digests := make([]string, len(segments))
+	for i, segment := range segments {
+		digests[i] = segment.Digest
+	}
+	seen, err := s.store.GetSeenAccountSegments(account.ID, document.ID, digests)
+	if err != nil {
+		return nil, err
+	}
+
+	content, count, appended := services.NewStatementContent(run.text, segments, seen)
+	statement := services.NewAccountStatement(document, account.ID)
+	statement.Segments, statement.NewSegments, statement.AnalyzedBytes = len(segments), count, len(content)
+	if previous != nil {
+		statement.PreviousDocumentID = &previous.DocumentID
+	}
+	plan := &statementPlan{statement: statement, digests: digests, content: content}
+	repeated := 0
+	for _, segment := range segments {
+		if first, ok := seen[segment.Digest]; ok {
+			repeated++
+			if !slices.Contains(plan.repeats, first) {
+				plan.repeats = append(plan.repeats, first)
+			}
+		}
+	}
+	statement.Continuity = services.StatementContinuity(statement, previous, repeated, appended)
+	return plan, nil
+}
+
+// analyzeStatement analyzes only the new content of a bank statement. A
+// statement with nothing new takes the analysis of the riskiest statement
+// it repeats.
+// The statement is then recorded under its account.
+func (s *Server) analyzeStatement(ctx context.Context, run *pipelineRun, plan *statementPlan) error {
+	document, statement := run.document, plan.statement
+	reused := false
+	if plan.content == "" {
+		var err error
+		if reused, err = s.reuseStatementAnalysis(document, run.text, plan.repeats); err != nil {
+			return err
+		}
+	}
+	if !reused {
+		analyzed := plan.content
+		if analyzed == "" {
+			// The statements it repeats were never analyzed themselves
+			analyzed = run.text
+		}
+		if err := s.analyzeDocumentForFraud(ctx, document, run.text, analyzed); err != nil {
+			return err
+		}
+		statement.AnalyzedBytes = len(analyzed)
+		if analyzedDocument, err := s.store.GetDocument(document.ID); err == nil {
+			statement.FraudScore, statement.PatternCount = analyzedDocument.FraudScore, analyzedDocument.PatternCount
+		}
+	}
+
+	metrics.StatementAnalyses.WithLabelValues(statement.Continuity).Inc()
+	metrics.StatementBytesSkipped.Add(float64(len(run.text) - statement.AnalyzedBytes))
+	logging.Pipeline.Infof("Statement %s of account %s is %s: analyzed %d of %d segments (%d of %d bytes)",
+		document.ID, statement.AccountID, statement.Continuity, statement.NewSegments, statement.Segments,
+		statement.AnalyzedBytes, len(run.text))
+	if err := s.store.RecordAccountStatement(statement, plan.digests); err != nil {
+		// The document is analyzed; only the roll-up is missing until the
+		// statement is processed again
+		logging.Pipeline.Errorf("Failed to record statement %s of account %s: %v", document.ID, statement.AccountID, err)
+	}
+	return nil
+}
+
+// reuseStatementAnalysis stores on a statement that only repeats earlier
+// ones the analysis of the riskiest of them. It adds no evidence to the
+// account's risk, which has that of the statements repeated. It reports
+// false when none has an analysis to take.
+func (s *Server) reuseStatementAnalysis(document *services.Document, text string, repeats []services.DocumentID) (bool, error) {
+	var source *services.Document
+	for _, id := range repeats {
+		candidate, err := s.store.GetDocument(id)
+		if err != nil || candidate.FraudScore == nil || candidate.AnalysisProvider == nil {
+			continue
+		}
+		if source == nil || *candidate.FraudScore > *source.FraudScore {
+			source = candidate
+		}
+	}
+	if source == nil {
+		return false, nil
+	}
+
+	result := &services.FraudAnalysis{
+		FraudScore: *source.FraudScore,
+		RiskLevel:  source.FraudRiskLevel,
+		// The document keeps only the score weighted for its channel,
+		// which stands in for the analyzer's
+		ModelScore:    *source.FraudScore,
+		ExtractedText: text,
+		Provider:      *source.AnalysisProvider,
+		Fallback:      source.AnalysisFallback,
+		Cached:        true,
+	}
+	if source.EmotionAnalysis != nil {
+		result.EmotionAnalysis = *source.EmotionAnalysis
+	}
+	if source.PatternAnalysis != nil {
+		result.PatternAnalysis = *source.PatternAnalysis
+	}
+	if err := s.store.UpdateDocumentFraudAnalysis(document.ID, result); err != nil {
+		return false, fmt.Errorf("failed to update document with fraud analysis: %v", err)
+	}
+	s.events.Publish(services.DocumentEvent{DocumentID: document.ID, Status: services.DocumentProcessed})
+	log.Printf("Fraud analysis of statement %s taken from statement %s, which it repeats: score=%.3f, risk=%s",
+		document.ID, source.ID, result.FraudScore, result.RiskLevel)
+	return true, nil
+}
+
+// getDocumentStatement returns the statement record of a bank statement:
+// its account, how it continues the statement before it and how much of it
+// was new and analyzed
+func (s *Server) getDocumentStatement(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	statement, err := s.store.GetAccountStatement(documentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document is not the statement of a known account",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get the statement record of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve statement",
+			"status": "error",
+		})
+		return
+	}
+	account, err := s.store.GetAccount(statement.AccountID)
+	if err != nil {
+		log.Printf("Failed to get account %s: %v", statement.AccountID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve account",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"statement":   statement,
+		"account":     account,
+		"status":      "success",
+	})
+}
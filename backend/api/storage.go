@@ -0,0 +1,72 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getStorageRegions lists the data residency regions tenants can be pinned to
+func (s *Server) getStorageRegions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"regions":        s.storage.Regions(),
+		"default_region": s.storage.DefaultRegion(),
+		"status":         "success",
+	})
+}
+
+// putTenantStorageRegion pins a tenant's uploads to a region. A null region
+// returns the tenant to the default region. Files already uploaded are not
+// moved and keep being read from the region they were stored in.
+func (s *Server) putTenantStorageRegion(c *gin.Context) {
+	var req struct {
+		Region *string `json:"region"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Region != nil {
+		if _, err := s.storage.ForRegion(*req.Region); err != nil || *req.Region == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Unknown storage region",
+				"regions": s.storage.Regions(),
+				"status":  "error",
+			})
+			return
+		}
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err == nil {
+		err = s.store.UpdateTenantStorageRegion(tenant.ID, req.Region)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update storage region for tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update storage region",
+			"status": "error",
+		})
+		return
+	}
+
+	region := s.storage.DefaultRegion()
+	if req.Region != nil {
+		region = *req.Region
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":         tenant.Slug,
+		"storage_region": region,
+		"default":        req.Region == nil,
+		"status":         "success",
+	})
+}
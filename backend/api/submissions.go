@@ -0,0 +1,219 @@
+package api
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditLogResults caps the limit accepted by the audit log listing
+const maxAuditLogResults = 500
+
+// ChannelHeader names the channel of uploads relayed by the SFTP and email
+// gateways. It is only believed from trusted proxies.
+const ChannelHeader = "X-Submission-Channel"
+
+// FingerprintHeader carries a device fingerprint computed by the client,
+// such as the web UI's
+const FingerprintHeader = "X-Client-Fingerprint"
+
+var fingerprintPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// submissionChannel returns the channel of an upload: the one a gateway
+// behind a trusted proxy names, web for browsers, which send an Origin, and
+// api for every other client
+func (s *Server) submissionChannel(c *gin.Context) string {
+	if channel := c.GetHeader(ChannelHeader); channel != "" && s.fromTrustedProxy(c) && services.IsChannel(channel) {
+		return channel
+	}
+	if c.GetHeader("Origin") != "" {
+		return services.ChannelWeb
+	}
+	return services.ChannelAPI
+}
+
+// clientFingerprint returns the fingerprint the client sent, or else a hash
+// of the headers that tell clients apart. It is nil for requests without
+// any of them.
+func clientFingerprint(c *gin.Context) *string {
+	if fingerprint := c.GetHeader(FingerprintHeader); fingerprintPattern.MatchString(fingerprint) {
+		return &fingerprint
+	}
+	userAgent := c.GetHeader("User-Agent")
+	language := c.GetHeader("Accept-Language")
+	encoding := c.GetHeader("Accept-Encoding")
+	if userAgent == "" && language == "" && encoding == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(userAgent + "\n" + language + "\n" + encoding))
+	fingerprint := hex.EncodeToString(sum[:])
+	return &fingerprint
+}
+
+// clientCountry returns the country of the request's client: the one a
+// trusted geolocating proxy reports, or else the one its address maps to
+func (s *Server) clientCountry(c *gin.Context, ip string) *string {
+	country := ""
+	if s.geo.CountryHeader != "" && s.fromTrustedProxy(c) {
+		country = services.NormalizeCountry(c.GetHeader(s.geo.CountryHeader))
+	}
+	if country == "" {
+		country = s.geoIP.Country(ip)
+	}
+	if country == "" {
+		return nil
+	}
+	return &country
+}
+
+// recordSubmission records the address, country, channel and client the
+// document was uploaded from, for the velocity rules, channel weighting and
+// the audit log. A failure is logged rather than failing an upload already
+// stored.
+func (s *Server) recordSubmission(c *gin.Context, document *services.Document) {
+	ip := c.ClientIP()
+	if ip == "" {
+		return
+	}
+	submission := &services.Submission{
+		DocumentID:  document.ID,
+		TenantID:    document.TenantID,
+		UserID:      document.UserID,
+		IPAddress:   ip,
+		Country:     s.clientCountry(c, ip),
+		Channel:     s.submissionChannel(c),
+		Fingerprint: clientFingerprint(c),
+	}
+	if userAgent := c.GetHeader("User-Agent"); userAgent != "" {
+		submission.UserAgent = &userAgent
+	}
+	if err := s.store.RecordSubmission(submission); err != nil {
+		log.Printf("Failed to record submission of document %s: %v", document.ID, err)
+	}
+}
+
+// checkSubmissionVelocity records a multi_country_submission detection when
+// the user who submitted the document submitted from more countries than
+// allowed within the velocity window
+func (s *Server) checkSubmissionVelocity(document *services.Document) {
+	if document.UserID == nil {
+		return
+	}
+	submission, err := s.store.GetSubmission(document.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to load submission of document %s: %v", document.ID, err)
+		return
+	}
+	if submission.Country == nil {
+		return
+	}
+
+	// The window reaches back from the submission, so a document analyzed
+	// late is compared with the submissions around its own
+	recent, err := s.store.GetUserSubmissions(*document.UserID, submission.CreatedAt.Add(-s.geo.VelocityWindow))
+	if err != nil {
+		log.Printf("Failed to load submissions of user %s: %v", *document.UserID, err)
+		return
+	}
+	if factor := services.CountryVelocity(submission, recent, s.geo.VelocityMaxCountries, s.geo.VelocityWindow); factor != nil {
+		s.recordRiskFactors(document, []services.RiskFactor{*factor})
+	}
+}
+
+// getDocumentSubmission returns where a document was submitted from
+func (s *Server) getDocumentSubmission(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+
+	submission, err := s.store.GetSubmission(documentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "No submission recorded for the document",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to retrieve submission of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve submission",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"submission": submission,
+		"status":     "success",
+	})
+}
+
+// getAuditLog lists audit log entries, newest first, narrowed by action,
+// resource, user and client address
+func (s *Server) getAuditLog(c *gin.Context) {
+	var query struct {
+		Action       string `form:"action"`
+		ResourceType string `form:"resource_type"`
+		ResourceID   string `form:"resource_id" binding:"omitempty,uuid"`
+		UserID       string `form:"user_id" binding:"omitempty,uuid"`
+		IPAddress    string `form:"ip_address" binding:"omitempty,ip"`
+		Since        string `form:"since"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > maxAuditLogResults {
+		limit = 100
+	}
+
+	filter := services.AuditLogFilter{
+		Action:       query.Action,
+		ResourceType: query.ResourceType,
+		ResourceID:   query.ResourceID,
+		UserID:       query.UserID,
+		IPAddress:    query.IPAddress,
+		Limit:        limit,
+	}
+	if query.Since != "" {
+		since, err := parseQueryTime(query.Since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "since must be a date (YYYY-MM-DD) or RFC 3339 time",
+				"status": "error",
+			})
+			return
+		}
+		filter.Since = &since
+	}
+
+	entries, err := s.store.GetAuditLog(filter)
+	if err != nil {
+		log.Printf("Failed to retrieve audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve audit log",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   len(entries),
+		"status":  "success",
+	})
+}
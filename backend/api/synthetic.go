@@ -0,0 +1,184 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+	"frauddocai-backend/synthetic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syntheticRunRequest is the body of POST /admin/synthetic-runs. A seed of
+// zero draws one; the response carries it to repeat the run.
+type syntheticRunRequest struct {
+	Seed int64 `json:"seed"`
+	Sets int   `json:"sets" binding:"omitempty,min=1,max=10"`
+}
+
+// syntheticResult is how a fixture fared: Detected lists the checked
+// pattern types found on it, Missing those planted but not found and
+// Unexpected those found but not planted
+type syntheticResult struct {
+	Name       string              `json:"name"`
+	DocumentID services.DocumentID `json:"document_id"`
+	Injected   []string            `json:"injected"`
+	Detected   []string            `json:"detected"`
+	Missing    []string            `json:"missing"`
+	Unexpected []string            `json:"unexpected"`
+	Passed     bool                `json:"passed"`
+	Error      string              `json:"error,omitempty"`
+}
+
+// runSyntheticDocuments submits generated invoices and receipts with known
+// fraud patterns planted in them to a tenant created for the run, runs each
+// through the pipeline in turn, and checks that exactly the planted
+// patterns were detected. The tenant and its documents are kept so that
+// failures can be looked into.
+func (s *Server) runSyntheticDocuments(c *gin.Context) {
+	var req syntheticRunRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Seed == 0 {
+		req.Seed = time.Now().UnixNano()
+	}
+	if req.Sets == 0 {
+		req.Sets = 1
+	}
+
+	started := time.Now().UTC()
+	tenant := &services.Tenant{
+		Slug: fmt.Sprintf("synthetic-%d", started.UnixNano()),
+		Name: fmt.Sprintf("Synthetic run %s (seed %d)", started.Format(time.RFC3339), req.Seed),
+	}
+	if err := s.store.CreateTenant(tenant); err != nil {
+		log.Printf("Failed to create tenant for synthetic run: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create the tenant of the run",
+			"status": "error",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	results := []*syntheticResult{}
+	failed := 0
+	for _, fixture := range synthetic.Generate(req.Seed, req.Sets) {
+		result := s.runSyntheticFixture(ctx, tenant, fixture)
+		if ctx.Err() != nil {
+			return
+		}
+		if !result.Passed {
+			failed++
+		}
+		results = append(results, result)
+	}
+	log.Printf("Synthetic run %s (seed %d): %d of %d fixtures passed",
+		tenant.Slug, req.Seed, len(results)-failed, len(results))
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":   tenant.Slug,
+		"seed":     req.Seed,
+		"sets":     req.Sets,
+		"checked":  synthetic.Checked,
+		"fixtures": results,
+		"passed":   failed == 0,
+		"failures": failed,
+		"status":   "success",
+	})
+}
+
+// runSyntheticFixture stores a fixture as an upload of the tenant, runs its
+// pipeline and compares the detections with those planted
+func (s *Server) runSyntheticFixture(ctx context.Context, tenant *services.Tenant, fixture *synthetic.Fixture) *syntheticResult {
+	result := &syntheticResult{Name: fixture.Name, Injected: fixture.Injected, Detected: []string{}, Missing: []string{}, Unexpected: []string{}}
+	document, err := s.storeSyntheticDocument(ctx, tenant, fixture)
+	if err != nil {
+		log.Printf("Failed to store synthetic document %s: %v", fixture.Name, err)
+		result.Error = "failed to store the document"
+		return result
+	}
+	result.DocumentID = document.ID
+
+	s.runPipeline(ctx, &pipelineRun{document: document, text: fixture.Text, extracted: true})
+	detections, err := s.store.GetFraudDetections(services.DetectionFilter{DocumentID: document.ID, Limit: 1000})
+	if err != nil {
+		log.Printf("Failed to get detections of synthetic document %s: %v", document.ID, err)
+		result.Error = "failed to get the detections"
+		return result
+	}
+
+	found := map[string]bool{}
+	for _, detection := range detections {
+		if detection.Pattern != nil {
+			found[detection.Pattern.Type] = true
+		}
+	}
+	planted := map[string]bool{}
+	for _, patternType := range fixture.Injected {
+		planted[patternType] = true
+	}
+	for _, patternType := range synthetic.Checked {
+		if found[patternType] {
+			result.Detected = append(result.Detected, patternType)
+			if !planted[patternType] {
+				result.Unexpected = append(result.Unexpected, patternType)
+			}
+		} else if planted[patternType] {
+			result.Missing = append(result.Missing, patternType)
+		}
+	}
+	result.Passed = len(result.Missing) == 0 && len(result.Unexpected) == 0
+	return result
+}
+
+// storeSyntheticDocument stores the text of a fixture and creates its
+// document, as an upload would
+func (s *Server) storeSyntheticDocument(ctx context.Context, tenant *services.Tenant, fixture *synthetic.Fixture) (*services.Document, error) {
+	region, storage, err := s.tenantStorage(tenant)
+	if err != nil {
+		return nil, err
+	}
+	content := []byte(fixture.Text)
+	contentSHA256, err := hashReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	objectName := services.ContentObjectName(contentSHA256)
+	first, err := s.acquireObject(region, services.StorageTierHot, objectName)
+	if err == nil && first {
+		if err = storage.UploadFile(ctx, objectName, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			s.releaseObject(ctx, region, services.StorageTierHot, objectName)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	documentType := fixture.DocumentType
+	document := &services.Document{
+		TenantID:         &tenant.ID,
+		Filename:         fmt.Sprintf("%d_%s", time.Now().Unix(), fixture.File),
+		OriginalFilename: fixture.File,
+		FilePath:         objectName,
+		FileSize:         int64(len(content)),
+		MimeType:         "text/plain",
+		DocumentType:     &documentType,
+		Status:           services.DocumentUploaded,
+		FraudRiskLevel:   riskTaxonomyFor(tenant).Lowest().Name,
+		StorageRegion:    &region,
+		ContentSHA256:    &contentSHA256,
+		Metadata:         fixture.Metadata,
+	}
+	if err := s.store.CreateDocument(document); err != nil {
+		s.releaseObject(ctx, region, services.StorageTierHot, objectName)
+		return nil, err
+	}
+	return document, nil
+}
@@ -0,0 +1,393 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errForeignUser = errors.New("user belongs to another tenant")
+
+// requestScope returns the documents a request may see. It is limited to the
+// X-Tenant tenant, and for a user named by X-User who is not an admin, to
+// their teams' documents and those without a team. Requests without X-User
+// are not limited to teams.
+func (s *Server) requestScope(c *gin.Context) (*services.Tenant, services.DocumentScope, error) {
+	var scope services.DocumentScope
+	tenant, err := s.requestTenant(c)
+	if err != nil {
+		return nil, scope, err
+	}
+	if tenant != nil {
+		scope.TenantID = &tenant.ID
+	}
+
+	user, err := s.requestUser(c)
+	if err != nil {
+		return nil, scope, err
+	}
+	if user == nil {
+		return tenant, scope, nil
+	}
+	if (user.TenantID == nil) != (tenant == nil) || (tenant != nil && *user.TenantID != tenant.ID) {
+		return nil, scope, errForeignUser
+	}
+	// Tenant admins see every document of the tenant
+	if user.Role == services.RoleAdmin {
+		return tenant, scope, nil
+	}
+
+	if scope.TeamIDs, err = s.store.GetUserTeamIDs(user.ID); err != nil {
+		return nil, scope, err
+	}
+	scope.TeamRestricted = true
+	return tenant, scope, nil
+}
+
+// scopedDocumentKey is the context key of the document of a request that
+// passed requireDocumentInScope
+const scopedDocumentKey = "scoped_document"
+
+// requireDocumentInScope resolves the :id document of a route before the
+// handler runs. Documents that do not exist, are deleted or are outside the
+// request's scope are all reported missing rather than forbidden, so their
+// IDs reveal nothing. Registering a document route under it is what keeps
+// the route from skipping the check.
+func (s *Server) requireDocumentInScope(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		c.Abort()
+		return
+	}
+	_, scope, err := s.requestScope(c)
+	if err != nil {
+		respondScopeError(c, err)
+		c.Abort()
+		return
+	}
+
+	document, err := s.store.GetDocument(documentID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to load document %s: %v", documentID, err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve document",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil || !scope.Allows(document) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+
+	c.Set(scopedDocumentKey, document)
+	c.Next()
+}
+
+// scopedDocument is the document of a request that passed
+// requireDocumentInScope
+func scopedDocument(c *gin.Context) *services.Document {
+	return c.MustGet(scopedDocumentKey).(*services.Document)
+}
+
+func respondScopeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownTenant):
+		respondTenantError(c, err)
+	case errors.Is(err, errUnknownUser):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Unknown user",
+			"status": "error",
+		})
+	case errors.Is(err, errForeignUser):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "User does not belong to the tenant",
+			"status": "error",
+		})
+	default:
+		log.Printf("Failed to resolve document scope: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to resolve user",
+			"status": "error",
+		})
+	}
+}
+
+// teamForUpload resolves the team_id form field of an upload. The team must
+// belong to the tenant and, for users limited to their teams, be one of them.
+func (s *Server) teamForUpload(c *gin.Context, tenant *services.Tenant, scope services.DocumentScope) (*string, bool) {
+	teamID := c.PostForm("team_id")
+	if teamID == "" {
+		return nil, true
+	}
+	team, err := (*services.Team)(nil), sql.ErrNoRows
+	if services.IsUUID(teamID) {
+		team, err = s.store.GetTeam(teamID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to load team %s: %v", teamID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to load team",
+			"status": "error",
+		})
+		return nil, false
+	}
+	if err != nil || tenant == nil || team.TenantID != tenant.ID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Unknown team",
+			"status": "error",
+		})
+		return nil, false
+	}
+	if !scope.Allows(&services.Document{TenantID: &tenant.ID, TeamID: &team.ID}) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":  "User is not a member of the team",
+			"status": "error",
+		})
+		return nil, false
+	}
+	return &team.ID, true
+}
+
+// createTeam adds a team to a tenant
+func (s *Server) createTeam(c *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required,notblank,max=100"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	var existing []*services.Team
+	if err == nil {
+		existing, err = s.store.GetTeams(tenant.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to list teams of tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create team",
+			"status": "error",
+		})
+		return
+	}
+	for _, team := range existing {
+		if team.Name == req.Name {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "A team with this name already exists",
+				"team_id": team.ID,
+				"status":  "error",
+			})
+			return
+		}
+	}
+
+	team := &services.Team{TenantID: tenant.ID, Name: req.Name}
+	if err := s.store.CreateTeam(team); err != nil {
+		log.Printf("Failed to create team %s for tenant %s: %v", req.Name, tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create team",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Created team %s (%s) for tenant %s", team.Name, team.ID, tenant.Slug)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"team":   team,
+		"status": "success",
+	})
+}
+
+// getTeams lists a tenant's teams with their members
+func (s *Server) getTeams(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	var teams []*services.Team
+	if err == nil {
+		teams, err = s.store.GetTeams(tenant.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to list teams of tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to retrieve teams",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"teams":  teams,
+		"total":  len(teams),
+		"status": "success",
+	})
+}
+
+// teamMemberParams are the path parameters of the team membership routes
+type teamMemberParams struct {
+	ID     string `uri:"id" binding:"required,uuid"`
+	UserID string `uri:"user_id" binding:"required,uuid"`
+}
+
+// addTeamMember adds a user of the team's tenant to the team
+func (s *Server) addTeamMember(c *gin.Context) {
+	var params teamMemberParams
+	if !bindURI(c, &params) {
+		return
+	}
+
+	team, err := s.store.GetTeam(params.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Team not found",
+			"status": "error",
+		})
+		return
+	}
+	var user *services.User
+	if err == nil {
+		user, err = s.store.GetUser(params.UserID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "User not found",
+				"status": "error",
+			})
+			return
+		}
+	}
+	if err == nil && (user.TenantID == nil || *user.TenantID != team.TenantID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "User does not belong to the team's tenant",
+			"status": "error",
+		})
+		return
+	}
+	if err == nil {
+		err = s.store.AddTeamMember(team.ID, user.ID)
+	}
+	if err == nil {
+		team, err = s.store.GetTeam(team.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to add user %s to team %s: %v", params.UserID, params.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to add team member",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"team":   team,
+		"status": "success",
+	})
+}
+
+// removeTeamMember removes a user from a team
+func (s *Server) removeTeamMember(c *gin.Context) {
+	var params teamMemberParams
+	if !bindURI(c, &params) {
+		return
+	}
+
+	removed, err := s.store.RemoveTeamMember(params.ID, params.UserID)
+	if err != nil {
+		log.Printf("Failed to remove user %s from team %s: %v", params.UserID, params.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to remove team member",
+			"status": "error",
+		})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "User is not a member of the team",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"team_id": params.ID,
+		"user_id": params.UserID,
+		"status":  "success",
+	})
+}
+
+// putDocumentTeam moves a document to a team of its tenant, or out of any
+// team when team_id is null
+func (s *Server) putDocumentTeam(c *gin.Context) {
+	documentID, ok := documentIDParam(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		TeamID *string `json:"team_id" binding:"omitempty,uuid"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	document, err := s.store.GetDocument(documentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Document not found",
+			"status": "error",
+		})
+		return
+	}
+	if req.TeamID != nil {
+		team, err := s.store.GetTeam(*req.TeamID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to load team %s: %v", *req.TeamID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to load team",
+				"status": "error",
+			})
+			return
+		}
+		if err != nil || document.TenantID == nil || team.TenantID != *document.TenantID {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Team does not belong to the document's tenant",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	if err := s.store.UpdateDocumentTeam(documentID, req.TeamID); err != nil {
+		log.Printf("Failed to update team of document %s: %v", documentID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update document team",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"document_id": documentID,
+		"team_id":     req.TeamID,
+		"status":      "success",
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportTenantConfig downloads a tenant's configuration as a bundle that
+// POST /tenants/:slug/config/import takes in another environment
+func (s *Server) exportTenantConfig(c *gin.Context) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+	config, err := s.store.ExportTenantConfig(tenant)
+	if err != nil {
+		log.Printf("Failed to export configuration of tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to export tenant configuration",
+			"status": "error",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-config.json"`, tenant.Slug))
+	c.IndentedJSON(http.StatusOK, config)
+}
+
+// importTenantConfig applies a configuration bundle to a tenant. The whole
+// bundle is validated first and nothing is applied when any of it is
+// invalid. With dry_run the changes are only listed, along with the base
+// the preview was made against; passing that base when applying refuses
+// the import if the tenant's configuration changed in between.
+func (s *Server) importTenantConfig(c *gin.Context) {
+	var query struct {
+		DryRun bool   `form:"dry_run"`
+		Base   string `form:"base" binding:"omitempty,len=64,hexadecimal"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	var config services.TenantConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a tenant configuration bundle",
+			"status": "error",
+		})
+		return
+	}
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	var problems []string
+	if config.Language != nil && s.i18n.Supported(*config.Language) == "" {
+		problems = append(problems, fmt.Sprintf("language: %q has no messages in this environment", *config.Language))
+	}
+	plan, err := s.store.PlanTenantConfig(tenant, &config)
+	var configErr *services.TenantConfigError
+	if errors.As(err, &configErr) {
+		problems = append(problems, configErr.Problems...)
+	} else if err != nil {
+		log.Printf("Failed to plan configuration import of tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to import tenant configuration",
+			"status": "error",
+		})
+		return
+	}
+	if len(problems) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid tenant configuration",
+			"problems": problems,
+			"status":   "error",
+		})
+		return
+	}
+	if query.Base != "" && query.Base != plan.Base {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "The tenant's configuration changed since the preview",
+			"base":   plan.Base,
+			"status": "error",
+		})
+		return
+	}
+
+	if !query.DryRun {
+		if err := s.store.ApplyTenantConfig(plan, clientIP(c)); err != nil {
+			log.Printf("Failed to import configuration of tenant %s: %v", tenant.Slug, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to import tenant configuration",
+				"status": "error",
+			})
+			return
+		}
+		log.Printf("Imported configuration of tenant %s into tenant %s (%d sections changed)", config.Tenant, tenant.Slug, len(plan.Changes))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":   tenant.Slug,
+		"dry_run":  query.DryRun,
+		"base":     plan.Base,
+		"changes":  plan.Changes,
+		"warnings": plan.Warnings,
+		"status":   "success",
+	})
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TenantHeader carries the slug of the tenant a request acts for
+const TenantHeader = "X-Tenant"
+
+var errUnknownTenant = errors.New("unknown tenant")
+
+// requestTenant resolves the X-Tenant header. Requests without the header are
+// not scoped to a tenant and get a nil tenant.
+func (s *Server) requestTenant(c *gin.Context) (*services.Tenant, error) {
+	slug := c.GetHeader(TenantHeader)
+	if slug == "" {
+		return nil, nil
+	}
+	tenant, err := s.store.GetTenantBySlug(slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w %q", errUnknownTenant, slug)
+	}
+	return tenant, err
+}
+
+func respondTenantError(c *gin.Context, err error) {
+	if errors.Is(err, errUnknownTenant) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Unknown tenant",
+			"status": "error",
+		})
+		return
+	}
+
+	log.Printf("Failed to resolve tenant: %v", err)
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":  "Failed to resolve tenant",
+		"status": "error",
+	})
+}
+
+// tenantFor loads the tenant owning the document, or nil for documents
+// without one
+func (s *Server) tenantFor(document *services.Document) (*services.Tenant, error) {
+	if document.TenantID == nil {
+		return nil, nil
+	}
+	tenant, err := s.store.GetTenant(*document.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant %s: %v", *document.TenantID, err)
+	}
+	return tenant, nil
+}
+
+// analyzerFor returns the analyzer configured for the document's tenant. A
+// failed tenant lookup is an error rather than a fallback to the default, so
+// a tenant that opted out of external models is never sent to one.
+func (s *Server) analyzerFor(document *services.Document) (services.Analyzer, error) {
+	tenant, err := s.tenantFor(document)
+	if err != nil {
+		return nil, err
+	}
+	if tenant == nil {
+		return s.analyzers.ForTenant(""), nil
+	}
+	return s.analyzers.ForTenant(tenant.Slug), nil
+}
+
+// riskTaxonomyFor returns the risk levels documents of the tenant are
+// classified into
+func riskTaxonomyFor(tenant *services.Tenant) *services.RiskTaxonomy {
+	if tenant == nil {
+		return services.DefaultRiskTaxonomy()
+	}
+	return tenant.Taxonomy()
+}
+
+// newFraudAnalysis classifies an analyzer result with the taxonomy of the
+// document's tenant, after weighting its score by the channel the document
+// was submitted through
+func (s *Server) newFraudAnalysis(document *services.Document, text string, analysis *services.AnalyzeTextResponse) (*services.FraudAnalysis, error) {
+	tenant, err := s.tenantFor(document)
+	if err != nil {
+		return nil, err
+	}
+	taxonomy := riskTaxonomyFor(tenant)
+	result := services.NewFraudAnalysis(text, analysis, taxonomy)
+	if tenant == nil || len(tenant.ChannelWeights) == 0 {
+		return result, nil
+	}
+
+	submission, err := s.store.GetSubmission(document.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.FraudScore = tenant.ChannelWeights.Apply(result.FraudScore, submission.Channel)
+	result.RiskLevel = taxonomy.LevelForScore(result.FraudScore).Name
+	return result, nil
+}
+
+// tenantStorage returns the region uploads of the tenant are kept in and its
+// store. A tenant pinned to a region that is no longer configured is an
+// error, so its files never fall back to another region.
+func (s *Server) tenantStorage(tenant *services.Tenant) (string, services.ObjectStorage, error) {
+	region := s.storage.DefaultRegion()
+	if tenant != nil && tenant.StorageRegion != nil {
+		region = *tenant.StorageRegion
+	}
+	store, err := s.storage.ForRegion(region)
+	if err != nil {
+		return "", nil, err
+	}
+	return region, store, nil
+}
+
+// openDocumentFile reads the document's file from the region it was uploaded
+// to, and from the archive bucket once archived. Documents without a region
+// predate regional storage and are in the default region.
+func (s *Server) openDocumentFile(ctx context.Context, document *services.Document) (io.ReadCloser, error) {
+	store, err := s.storage.ForTier(documentRegion(document), document.StorageTier)
+	if err != nil {
+		return nil, err
+	}
+	return store.GetFile(ctx, document.FilePath)
+}
+
+func documentRegion(document *services.Document) string {
+	if document.StorageRegion == nil {
+		return ""
+	}
+	return *document.StorageRegion
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// statsLocation returns the time zone a stats request is bucketed in: the
+// tz parameter, or else the tenant's, or else UTC. It responds with 400 and
+// returns false for a tz that is not an IANA time zone.
+func statsLocation(c *gin.Context, tenant *services.Tenant) (*time.Location, bool) {
+	if name := c.Query("tz"); name != "" {
+		loc, err := services.LoadTimeZone(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "tz must be an IANA time zone such as Europe/Berlin",
+				"status": "error",
+			})
+			return nil, false
+		}
+		return loc, true
+	}
+	if tenant != nil {
+		return tenant.Location(), true
+	}
+	return time.UTC, true
+}
+
+// putTenantTimeZone sets the IANA time zone a tenant's reports are bucketed
+// in, or with {"time_zone": null} returns the tenant to UTC
+func (s *Server) putTenantTimeZone(c *gin.Context) {
+	var req struct {
+		TimeZone *string `json:"time_zone"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.TimeZone != nil {
+		loc, err := services.LoadTimeZone(*req.TimeZone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "time_zone must be an IANA time zone such as Europe/Berlin",
+				"status": "error",
+			})
+			return
+		}
+		name := loc.String()
+		req.TimeZone = &name
+	}
+
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err == nil {
+		err = s.store.UpdateTenantTimeZone(tenant.ID, req.TimeZone)
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update time zone for tenant %s: %v", c.Param("slug"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update time zone",
+			"status": "error",
+		})
+		return
+	}
+
+	timeZone := time.UTC.String()
+	if req.TimeZone != nil {
+		timeZone = *req.TimeZone
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":    tenant.Slug,
+		"time_zone": timeZone,
+		"default":   req.TimeZone == nil,
+		"status":    "success",
+	})
+}
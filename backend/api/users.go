@@ -0,0 +1,176 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserHeader carries the ID of the user a request acts for
+const UserHeader = "X-User"
+
+var errUnknownUser = errors.New("unknown user")
+
+// requestUser resolves the X-User header. Requests without the header get a
+// nil user.
+func (s *Server) requestUser(c *gin.Context) (*services.User, error) {
+	id := c.GetHeader(UserHeader)
+	if id == "" {
+		return nil, nil
+	}
+	if !services.IsUUID(id) {
+		return nil, errUnknownUser
+	}
+	user, err := s.store.GetUser(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUnknownUser
+	}
+	return user, err
+}
+
+// User handlers
+func (s *Server) registerUser(c *gin.Context) {
+	// TODO: Implement user registration
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User registration endpoint - TODO: implement",
+		"status":  "success",
+	})
+}
+
+func (s *Server) loginUser(c *gin.Context) {
+	// TODO: Implement user login
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User login endpoint - TODO: implement",
+		"status":  "success",
+	})
+}
+
+func (s *Server) getUserProfile(c *gin.Context) {
+	// TODO: Implement get user profile
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User profile endpoint - TODO: implement",
+		"status":  "success",
+	})
+}
+
+// createUser creates a user of the tenant named in the request, or of no
+// tenant
+func (s *Server) createUser(c *gin.Context) {
+	var req struct {
+		Email     string `json:"email" binding:"required,email,max=255"`
+		Password  string `json:"password" binding:"required,min=8,max=72"`
+		FirstName string `json:"first_name" binding:"omitempty,max=100"`
+		LastName  string `json:"last_name" binding:"omitempty,max=100"`
+		Role      string `json:"role" binding:"required,oneof=user analyst admin"`
+		Tenant    string `json:"tenant" binding:"omitempty,notblank"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user := &services.User{
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      req.Role,
+	}
+	if req.Tenant != "" {
+		tenant, err := s.store.GetTenantBySlug(req.Tenant)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Unknown tenant " + req.Tenant,
+				"status": "error",
+			})
+			return
+		}
+		user.TenantID = &tenant.ID
+	}
+
+	if _, err := s.store.GetUserByEmail(req.Email); err == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":  "A user with this email already exists",
+			"status": "error",
+		})
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Failed to look up user %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create user",
+			"status": "error",
+		})
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Failed to hash password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create user",
+			"status": "error",
+		})
+		return
+	}
+	user.PasswordHash = string(hash)
+
+	if err := s.store.CreateUser(user); err != nil {
+		log.Printf("Failed to create user %s: %v", req.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to create user",
+			"status": "error",
+		})
+		return
+	}
+	log.Printf("Created user %s with role %s", user.ID, user.Role)
+	s.emitWebhook(services.WebhookUserCreated, user.TenantID, gin.H{"user": user})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"user":   user,
+		"status": "success",
+	})
+}
+
+// updateUserRole changes a user's role
+func (s *Server) updateUserRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required,oneof=user analyst admin"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, previous, err := s.store.UpdateUserRole(c.Param("id"), req.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "User not found",
+			"status": "error",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update role of user %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update user role",
+			"status": "error",
+		})
+		return
+	}
+	if previous != user.Role {
+		log.Printf("Changed role of user %s from %s to %s", user.ID, previous, user.Role)
+		s.emitWebhook(services.WebhookUserRoleChanged, user.TenantID, gin.H{
+			"user":          user,
+			"previous_role": previous,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":          user,
+		"previous_role": previous,
+		"status":        "success",
+	})
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError reports one request field that failed validation. Rule is the
+// validation rule, such as required, max or uuid, and Param its argument.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Report fields by the names clients send them under
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "uri", "form"} {
+			name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	engine.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	// Accept the same UUIDs as the typed IDs, in either case
+	engine.RegisterValidation("uuid", func(fl validator.FieldLevel) bool {
+		return services.IsUUID(fl.Field().String())
+	})
+}
+
+// bindJSON decodes and validates the request body into req. It responds
+// with 400 and the failing fields and returns false when the body is
+// invalid.
+func bindJSON(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		respondInvalidRequest(c, req, err, "Request body must be a JSON object")
+		return false
+	}
+	return true
+}
+
+// bindURI validates the path parameters into req, like bindJSON
+func bindURI(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindUri(req); err != nil {
+		respondInvalidRequest(c, req, err, "Invalid path parameters")
+		return false
+	}
+	return true
+}
+
+// bindQuery validates the query parameters into req, like bindJSON
+func bindQuery(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindQuery(req); err != nil {
+		respondInvalidRequest(c, req, err, "Invalid query parameters")
+		return false
+	}
+	return true
+}
+
+// respondInvalidRequest reports a binding error. Errors that do not concern
+// a single field, such as malformed JSON, are reported as message.
+func respondInvalidRequest(c *gin.Context, req interface{}, err error, message string) {
+	fields := fieldErrors(req, err)
+	if len(fields) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  message,
+			"status": "error",
+		})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "Request validation failed",
+		"fields": fields,
+		"status": "error",
+	})
+}
+
+func fieldErrors(req interface{}, err error) []FieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type),
+		}}
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return nil
+	}
+	// Namespaces start with the name of the request struct unless it is
+	// anonymous
+	prefix := reflect.Indirect(reflect.ValueOf(req)).Type().Name()
+	if prefix != "" {
+		prefix += "."
+	}
+	fields := make([]FieldError, len(validationErrs))
+	for i, fe := range validationErrs {
+		field := strings.TrimPrefix(fe.Namespace(), prefix)
+		fields[i] = FieldError{
+			Field:   field,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldErrorMessage(field, fe),
+		}
+	}
+	return fields
+}
+
+func fieldErrorMessage(field string, fe validator.FieldError) string {
+	unit := "characters"
+	if kind := fe.Kind(); kind == reflect.Slice || kind == reflect.Map || kind == reflect.Array {
+		unit = "items"
+	}
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "notblank":
+		return field + " must not be blank"
+	case "uuid":
+		return field + " must be a UUID"
+	case "email":
+		return field + " must be an email address"
+	case "max":
+		return fmt.Sprintf("%s must be at most %s %s", field, fe.Param(), unit)
+	case "min":
+		return fmt.Sprintf("%s must be at least %s %s", field, fe.Param(), unit)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	default:
+		return fmt.Sprintf("%s failed the %s rule", field, fe.Tag())
+	}
+}
+
+// documentIDParam parses the :id path parameter of a document route. It
+// responds with 400 and returns false when the ID is not a UUID.
+func documentIDParam(c *gin.Context) (services.DocumentID, bool) {
+	id, err := services.ParseDocumentID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Request validation failed",
+			"fields": []FieldError{{
+				Field:   "id",
+				Rule:    "uuid",
+				Message: "id must be a UUID",
+			}},
+			"status": "error",
+		})
+		return "", false
+	}
+	return id, true
+}
+
+// idParams is the :id path parameter of routes addressing an exemplar,
+// alert or fraud pattern
+type idParams struct {
+	ID string `uri:"id" binding:"required,uuid"`
+}
+
+// requireUUIDParam rejects requests whose :id path parameter is not a UUID
+// before they reach the handler, where the ID would reach the database
+// unchecked. Routes without the parameter pass through.
+func requireUUIDParam(c *gin.Context) {
+	if _, ok := c.Params.Get("id"); !ok {
+		c.Next()
+		return
+	}
+	var params idParams
+	if !bindURI(c, &params) {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
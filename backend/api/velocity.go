@@ -0,0 +1,102 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkVelocityRules counts the document against its tenant's velocity
+// rules and records a velocity_spike detection listing the windows of the
+// rules it took over their limits. Amounts are summed as converted into the
+// tenant's base currency.
+func (s *Server) checkVelocityRules(document *services.Document, tenant *services.Tenant, amounts services.DocumentAmounts) {
+	if tenant == nil || len(tenant.VelocityRules) == 0 {
+		return
+	}
+
+	var factors []*services.RiskFactor
+	for _, rule := range tenant.VelocityRules {
+		count := services.NewVelocityCount(rule, document, amounts)
+		if count == nil {
+			continue
+		}
+		window, err := s.store.CountVelocity(rule, count)
+		if err != nil {
+			log.Printf("Failed to count document %s for velocity rule %q: %v", document.ID, rule.Name, err)
+			continue
+		}
+		if factor := rule.Check(window, count.Group); factor != nil {
+			factors = append(factors, factor)
+		}
+	}
+	if factor := services.CombineVelocityFactors(factors); factor != nil {
+		s.recordRiskFactors(document, []services.RiskFactor{*factor})
+	}
+}
+
+// putVelocityRules replaces a tenant's velocity rules. Rules that are new or
+// changed count documents analyzed from now on.
+func (s *Server) putVelocityRules(c *gin.Context) {
+	var rules services.VelocityRules
+	if err := c.ShouldBindJSON(&rules); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a list of velocity rules",
+			"status": "error",
+		})
+		return
+	}
+	s.updateVelocityRules(c, rules)
+}
+
+// deleteVelocityRules stops counting a tenant's documents
+func (s *Server) deleteVelocityRules(c *gin.Context) {
+	s.updateVelocityRules(c, nil)
+}
+
+func (s *Server) updateVelocityRules(c *gin.Context, rules services.VelocityRules) {
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	err = s.store.UpdateTenantVelocityRules(tenant.ID, rules)
+	var rulesErr *services.VelocityRulesError
+	switch {
+	case errors.As(err, &rulesErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid velocity rules",
+			"problems": rulesErr.Problems,
+			"status":   "error",
+		})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	case err != nil:
+		log.Printf("Failed to update velocity rules for tenant %s: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to update velocity rules",
+			"status": "error",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":         tenant.Slug,
+		"velocity_rules": rules,
+		"status":         "success",
+	})
+}
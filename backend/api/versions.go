@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"frauddocai-backend/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API versions, as they appear in the route prefix
+const (
+	apiV1 = "v1"
+	apiV2 = "v2"
+)
+
+// apiVersion counts the requests of an API version by route and status, so
+// the migration of clients between versions can be followed, and announces
+// the deprecation of v1 on its responses: Deprecation (RFC 9745) with the
+// date it was deprecated, Sunset (RFC 8594) with the date it will be
+// removed once one is set, and a Link to the same resource in v2.
+func (s *Server) apiVersion(version string) gin.HandlerFunc {
+	prefix := "/api/" + version
+	return func(c *gin.Context) {
+		if version == apiV1 && !s.api.V1DeprecatedAt.IsZero() {
+			header := c.Writer.Header()
+			header.Set("Deprecation", fmt.Sprintf("@%d", s.api.V1DeprecatedAt.Unix()))
+			if !s.api.V1Sunset.IsZero() {
+				header.Set("Sunset", s.api.V1Sunset.UTC().Format(http.TimeFormat))
+			}
+			successor := "/api/" + apiV2 + strings.TrimPrefix(c.Request.URL.Path, prefix)
+			header.Add("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+
+		c.Next()
+
+		route := strings.TrimPrefix(c.FullPath(), prefix)
+		metrics.APIRequests.WithLabelValues(version, c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
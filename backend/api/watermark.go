@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getWatermarkedDocument sends the X-User reviewer a PDF copy of a
+// document's original stamped "Downloaded by <reviewer> on <date> for case
+// <case_id>", to deter leaks. case_id, optional, must name a case the
+// document is linked to. Copies are cached, so downloading again the same
+// day for the same case is served without stamping again.
+func (s *Server) getWatermarkedDocument(c *gin.Context) {
+	var query struct {
+		CaseID string `form:"case_id" binding:"omitempty,uuid"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	user, ok := s.reviewerFor(c)
+	if !ok {
+		return
+	}
+	document := scopedDocument(c)
+	if query.CaseID != "" {
+		linked, err := s.caseLinksDocument(query.CaseID, document)
+		if err != nil {
+			log.Printf("Failed to check case %s of document %s: %v", query.CaseID, document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to retrieve case",
+				"status": "error",
+			})
+			return
+		}
+		if !linked {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":  "Case not found for the document",
+				"status": "error",
+			})
+			return
+		}
+	}
+
+	switch document.StorageTier {
+	case services.StorageTierArchived:
+		if err := s.restoreDocument(document); err != nil {
+			log.Printf("Failed to start restoring document %s: %v", document.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":  "Failed to restore document from archive",
+				"status": "error",
+			})
+			return
+		}
+		s.respondRestoring(c, document, s.lifecycle.RestoreLatency)
+		return
+	case services.StorageTierRestoring:
+		remaining := s.lifecycle.RestoreLatency
+		if document.TierChangedAt != nil {
+			remaining -= time.Since(*document.TierChangedAt)
+		}
+		s.respondRestoring(c, document, remaining)
+		return
+	}
+	if document.FileSize > int64(s.watermark.MaxSourceBytes) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":     "Document is too large to watermark",
+			"max_bytes": s.watermark.MaxSourceBytes,
+			"status":    "error",
+		})
+		return
+	}
+
+	text := services.DownloadWatermarkText(user, time.Now(), query.CaseID)
+	contentKey := document.ID.String() + "/" + document.FilePath
+	if document.ContentSHA256 != nil {
+		contentKey = *document.ContentSHA256
+	}
+	key := services.WatermarkCacheKey(contentKey, text)
+	stamped, cached := s.watermarks.Get(key)
+	if !cached {
+		var err error
+		if stamped, err = s.watermarkDocument(c, document, text); err != nil {
+			if errors.Is(err, services.ErrCannotWatermark) || errors.Is(err, services.ErrUnsupportedPDF) {
+				c.JSON(http.StatusUnsupportedMediaType, gin.H{
+					"error":     "No watermarked copy can be made of this document",
+					"mime_type": document.MimeType,
+					"status":    "error",
+				})
+				return
+			}
+			log.Printf("Failed to watermark document %s: %v", document.ID, err)
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error":  "Failed to fetch document from storage",
+				"status": "error",
+			})
+			return
+		}
+		s.watermarks.Put(key, stamped)
+	}
+	log.Printf("User %s downloaded a watermarked copy of document %s (cached: %t)", user.ID, document.ID, cached)
+
+	filename := strings.TrimSuffix(document.OriginalFilename, path.Ext(document.OriginalFilename)) + "-watermarked.pdf"
+	c.Header("X-FraudDocAI-Watermark", text)
+	cache := "miss"
+	if cached {
+		cache = "hit"
+	}
+	c.Header("X-FraudDocAI-Watermark-Cache", cache)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Data(http.StatusOK, "application/pdf", stamped)
+}
+
+// watermarkDocument reads a document's original and makes its watermarked
+// copy
+func (s *Server) watermarkDocument(c *gin.Context, document *services.Document, text string) ([]byte, error) {
+	reader, err := s.openDocumentFile(c.Request.Context(), document)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(io.LimitReader(reader, int64(s.watermark.MaxSourceBytes)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > s.watermark.MaxSourceBytes {
+		return nil, fmt.Errorf("stored file is larger than the %d bytes recorded", document.FileSize)
+	}
+
+	src := services.WatermarkSource{
+		Filename: document.OriginalFilename,
+		MimeType: document.MimeType,
+		Content:  content,
+	}
+	if document.ExtractedText != nil {
+		src.ExtractedText = *document.ExtractedText
+	}
+	return services.WatermarkedPDF(src, text)
+}
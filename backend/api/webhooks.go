@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"frauddocai-backend/metrics"
+	"frauddocai-backend/services"
+)
+
+const (
+	// webhookBatchSize bounds the events delivered per pass
+	webhookBatchSize = 50
+	// The wait before retrying an event doubles from webhookBaseBackoff after
+	// each failed attempt, up to webhookMaxBackoff
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = time.Hour
+)
+
+// emitWebhook adds an event to the webhook outbox when webhooks are
+// configured for its type. The action that caused it has already happened,
+// so a failure is logged rather than returned.
+func (s *Server) emitWebhook(eventType string, tenantID *string, data interface{}) {
+	s.queueWebhook(&services.WebhookEvent{Type: eventType, TenantID: tenantID}, data)
+}
+
+// emitAlertWebhook emits an event notifying about an alert, which is listed
+// on the timeline of the alert's case
+func (s *Server) emitAlertWebhook(eventType, alertID string, tenantID *string, data interface{}) {
+	s.queueWebhook(&services.WebhookEvent{Type: eventType, TenantID: tenantID, AlertID: &alertID}, data)
+}
+
+func (s *Server) queueWebhook(event *services.WebhookEvent, data interface{}) {
+	if !s.webhooks.Wants(event.Type) {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s webhook: %v", event.Type, err)
+		return
+	}
+	event.Data = raw
+	if err := s.store.CreateWebhookEvent(event); err != nil {
+		log.Printf("Failed to queue %s webhook: %v", event.Type, err)
+	}
+}
+
+// RunWebhookDelivery periodically sends the events waiting in the webhook
+// outbox. It returns when ctx is cancelled.
+func (s *Server) RunWebhookDelivery(ctx context.Context) {
+	ticker := time.NewTicker(s.webhooks.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.deliverWebhooks(ctx)
+		}
+	}
+}
+
+func (s *Server) deliverWebhooks(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := s.store.GetPendingWebhookEvents(time.Now(), webhookBatchSize)
+		if err != nil {
+			log.Printf("Failed to read webhook outbox: %v", err)
+			return
+		}
+		for _, event := range events {
+			if ctx.Err() != nil {
+				return
+			}
+			s.deliverWebhook(ctx, event)
+		}
+		if len(events) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func (s *Server) deliverWebhook(ctx context.Context, event *services.WebhookEvent) {
+	err := s.webhooks.Deliver(ctx, event)
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues(event.Type, "delivered").Inc()
+		if err := s.store.MarkWebhookEventDelivered(event.ID); err != nil {
+			// It will be sent again; receivers dedupe by the delivery ID
+			log.Printf("Failed to mark webhook %d delivered: %v", event.ID, err)
+		}
+		return
+	}
+
+	attempts := event.Attempts + 1
+	if attempts >= s.webhooks.MaxAttempts() {
+		metrics.WebhookDeliveries.WithLabelValues(event.Type, "failed").Inc()
+		log.Printf("Giving up on %s webhook %d after %d attempts: %v", event.Type, event.ID, attempts, err)
+		if err := s.store.FailWebhookEvent(event.ID, err.Error()); err != nil {
+			log.Printf("Failed to record webhook %d as failed: %v", event.ID, err)
+		}
+		return
+	}
+
+	metrics.WebhookDeliveries.WithLabelValues(event.Type, "retried").Inc()
+	backoff := webhookMaxBackoff
+	if attempts < 8 {
+		backoff = min(webhookBaseBackoff<<(attempts-1), webhookMaxBackoff)
+	}
+	if err := s.store.RetryWebhookEvent(event.ID, time.Now().Add(backoff), err.Error()); err != nil {
+		log.Printf("Failed to reschedule webhook %d: %v", event.ID, err)
+	}
+}
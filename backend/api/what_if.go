@@ -0,0 +1,102 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"frauddocai-backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultWhatIfDays is how far back a what-if replays by default
+const defaultWhatIfDays = 30
+
+// whatIfTenantConfig replays the tenant's documents of the last days
+// against the rules of a configuration bundle and against its current
+// rules, and compares the detections, flagged documents and risk levels
+// each produced. Nothing is recorded, so a bundle can be checked before it
+// is imported.
+func (s *Server) whatIfTenantConfig(c *gin.Context) {
+	var query struct {
+		Days int `form:"days" binding:"omitempty,min=1,max=365"`
+	}
+	if !bindQuery(c, &query) {
+		return
+	}
+	if query.Days == 0 {
+		query.Days = defaultWhatIfDays
+	}
+	var config services.TenantConfig
+	if err := c.ShouldBindJSON(&config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Request body must be a tenant configuration bundle",
+			"status": "error",
+		})
+		return
+	}
+	tenant, err := s.store.GetTenantBySlug(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":  "Tenant not found",
+			"status": "error",
+		})
+		return
+	}
+
+	patterns, err := s.store.GetFraudPatterns()
+	if err != nil {
+		log.Printf("Failed to load fraud patterns: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to replay documents",
+			"status": "error",
+		})
+		return
+	}
+	active := services.ActivePatternTypes(patterns)
+	candidate, warnings, err := config.Rules(active)
+	var configErr *services.TenantConfigError
+	if errors.As(err, &configErr) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid tenant configuration",
+			"problems": configErr.Problems,
+			"status":   "error",
+		})
+		return
+	}
+
+	until := time.Now().UTC()
+	since := until.AddDate(0, 0, -query.Days)
+	documents, err := s.store.GetReplayDocuments(tenant.ID, since, services.MaxReplayDocuments)
+	if err != nil {
+		log.Printf("Failed to load documents of tenant %s to replay: %v", tenant.Slug, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":  "Failed to replay documents",
+			"status": "error",
+		})
+		return
+	}
+	truncated := len(documents) == services.MaxReplayDocuments
+	if truncated {
+		warnings = append(warnings, fmt.Sprintf("only the first %d documents since %s were replayed", services.MaxReplayDocuments, since.Format(time.RFC3339)))
+	}
+	report := services.ReplayRules(documents, tenant.Rules(active), candidate)
+
+	c.JSON(http.StatusOK, gin.H{
+		"tenant":            tenant.Slug,
+		"since":             since,
+		"until":             until,
+		"documents":         report.Documents,
+		"truncated":         truncated,
+		"current":           report.Current,
+		"candidate":         report.Candidate,
+		"difference":        report.Difference,
+		"newly_flagged":     report.NewlyFlagged,
+		"no_longer_flagged": report.NoLongerFlagged,
+		"warnings":          warnings,
+		"status":            "success",
+	})
+}
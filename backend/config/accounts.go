@@ -0,0 +1,22 @@
+package config
+
+import "time"
+
+// AccountConfig sets how the statements of a bank account are analyzed and
+// how the risk of an account is gathered from its documents
+type AccountConfig struct {
+	// Incremental analyzes only the content of a statement its account's
+	// earlier statements did not have; when false every statement is
+	// analyzed whole
+	Incremental bool
+	// RiskHalfLife is how long it takes a document's weight in its
+	// account's risk to halve; 0 keeps every document at full weight
+	RiskHalfLife time.Duration
+}
+
+func GetAccountConfig() AccountConfig {
+	return AccountConfig{
+		Incremental:  getEnvBool("STATEMENT_INCREMENTAL_ANALYSIS", true),
+		RiskHalfLife: getEnvDuration("ACCOUNT_RISK_HALF_LIFE", 90*24*time.Hour),
+	}
+}
@@ -0,0 +1,27 @@
+package config
+
+type AdminConfig struct {
+	Token string
+	// AnonymizationKey keys the pseudonyms of anonymized exports. It may be
+	// a secret reference. Anonymized exports are disabled when empty.
+	AnonymizationKey string
+}
+
+func GetAdminConfig() AdminConfig {
+	return AdminConfig{
+		Token:            getEnv("ADMIN_API_TOKEN", ""),
+		AnonymizationKey: getEnv("ANONYMIZATION_KEY", ""),
+	}
+}
+
+// SignupConfig opens POST /tenants/signup, which anyone can call to
+// provision a tenant, so it is off unless enabled
+type SignupConfig struct {
+	Enabled bool
+}
+
+func GetSignupConfig() SignupConfig {
+	return SignupConfig{
+		Enabled: getEnvBool("SIGNUP_ENABLED", false),
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import "time"
+
+type AIConfig struct {
+	BaseURL string
+	Token   string
+	Timeout time.Duration
+
+	// CAFile verifies the AI service's certificate instead of the system
+	// roots. CertFile and KeyFile are the client certificate presented for
+	// mutual TLS.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+
+	// MaxConcurrency caps the AI service calls in flight from this
+	// replica; zero removes the cap. Within it the limit adapts between
+	// MinConcurrency and MaxConcurrency to keep calls answered within
+	// LatencyTarget. Beyond MaxQueued waiting calls, further calls are
+	// refused.
+	MaxConcurrency int
+	MinConcurrency int
+	LatencyTarget  time.Duration
+	MaxQueued      int
+
+	// ModelInfoTTL is how long QA model info is served from the cache
+	// before it is refreshed in the background; ModelInfoMaxStale how long
+	// it is served at most while refreshing fails
+	ModelInfoTTL      time.Duration
+	ModelInfoMaxStale time.Duration
+}
+
+func GetAIConfig() AIConfig {
+	return AIConfig{
+		BaseURL:  getEnv("AI_SERVICE_URL", "http://localhost:8001"),
+		Token:    getEnv("AI_SERVICE_TOKEN", ""),
+		Timeout:  getEnvDuration("AI_SERVICE_TIMEOUT", 60*time.Second),
+		CAFile:   getEnv("AI_SERVICE_CA_FILE", ""),
+		CertFile: getEnv("AI_SERVICE_CERT_FILE", ""),
+		KeyFile:  getEnv("AI_SERVICE_KEY_FILE", ""),
+
+		MaxConcurrency: getEnvInt("AI_SERVICE_MAX_CONCURRENCY", 16),
+		MinConcurrency: getEnvInt("AI_SERVICE_MIN_CONCURRENCY", 2),
+		LatencyTarget:  getEnvDuration("AI_SERVICE_LATENCY_TARGET", 10*time.Second),
+		MaxQueued:      getEnvInt("AI_SERVICE_MAX_QUEUED", 100),
+
+		ModelInfoTTL:      getEnvDuration("AI_MODEL_INFO_TTL", time.Minute),
+		ModelInfoMaxStale: getEnvDuration("AI_MODEL_INFO_MAX_STALE", 15*time.Minute),
+	}
+}
+
+// AIReplayConfig records the AI service's responses, or serves recorded
+// responses instead of calling it, for deterministic tests and demos
+type AIReplayConfig struct {
+	// Mode is off, record or replay
+	Mode string
+	// Dir holds the recordings, one file per request
+	Dir string
+}
+
+func GetAIReplayConfig() AIReplayConfig {
+	return AIReplayConfig{
+		Mode: getEnv("AI_REPLAY_MODE", "off"),
+		Dir:  getEnv("AI_REPLAY_DIR", "ai-recordings"),
+	}
+}
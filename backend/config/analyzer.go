@@ -0,0 +1,75 @@
+package config
+
+import "time"
+
+// AnalyzerConfig selects the fraud analysis provider. Tenants maps a tenant
+// slug to a provider name and overrides Provider for that tenant.
+type AnalyzerConfig struct {
+	Provider string
+	Tenants  map[string]string
+	OpenAI   OpenAIConfig
+
+	// Fallback names the analyzer ("onnx" or "rules") used while a remote
+	// provider is unavailable; empty disables the fallback
+	Fallback        string
+	RescoreInterval time.Duration
+	ONNX            ONNXConfig
+
+	// FastAPIModelVersion names the AI service's fraud model; change it
+	// when deploying another model so cached results are not reused.
+	// CacheTTL is how long results are reused for the same text; zero
+	// disables the cache.
+	FastAPIModelVersion string
+	CacheTTL            time.Duration
+
+	// Background analyses are sent in batches of up to BatchSize texts,
+	// waiting at most BatchWait to fill one. BatchSize 1 disables batching.
+	BatchSize        int
+	BatchWait        time.Duration
+	BatchConcurrency int
+}
+
+// OpenAIConfig points at an OpenAI-compatible chat completions API
+type OpenAIConfig struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Timeout time.Duration
+}
+
+// ONNXConfig describes the in-process fallback classifier
+type ONNXConfig struct {
+	ModelPath   string
+	LibraryPath string
+	InputName   string
+	OutputName  string
+	Features    int
+}
+
+func GetAnalyzerConfig() AnalyzerConfig {
+	return AnalyzerConfig{
+		Provider: getEnv("ANALYZER_PROVIDER", "fastapi"),
+		Tenants:  getEnvMap("ANALYZER_TENANT_PROVIDERS"),
+		OpenAI: OpenAIConfig{
+			BaseURL: getEnv("OPENAI_BASE_URL", ""),
+			APIKey:  getEnv("OPENAI_API_KEY", ""),
+			Model:   getEnv("OPENAI_MODEL", "gpt-4o-mini"),
+			Timeout: getEnvDuration("OPENAI_TIMEOUT", 60*time.Second),
+		},
+		Fallback:        getEnv("ANALYZER_FALLBACK", ""),
+		RescoreInterval: getEnvDuration("ANALYZER_RESCORE_INTERVAL", 5*time.Minute),
+
+		FastAPIModelVersion: getEnv("AI_SERVICE_MODEL_VERSION", ""),
+		CacheTTL:            getEnvDuration("ANALYSIS_CACHE_TTL", 30*24*time.Hour),
+		ONNX: ONNXConfig{
+			ModelPath:   getEnv("ONNX_MODEL_PATH", ""),
+			LibraryPath: getEnv("ONNX_RUNTIME_LIB", ""),
+			InputName:   getEnv("ONNX_INPUT_NAME", "input"),
+			OutputName:  getEnv("ONNX_OUTPUT_NAME", "probabilities"),
+			Features:    getEnvInt("ONNX_FEATURES", 4096),
+		},
+		BatchSize:        getEnvInt("ANALYZER_BATCH_SIZE", 16),
+		BatchWait:        getEnvDuration("ANALYZER_BATCH_WAIT", 200*time.Millisecond),
+		BatchConcurrency: getEnvInt("ANALYZER_BATCH_CONCURRENCY", 2),
+	}
+}
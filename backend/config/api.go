@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+// v2Released is when /api/v2 became available and /api/v1 deprecated
+var v2Released = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// APIConfig sets the lifecycle of the API versions announced to clients.
+// V1Sunset is when /api/v1 will be removed; the zero time announces no
+// date yet.
+type APIConfig struct {
+	V1DeprecatedAt time.Time
+	V1Sunset       time.Time
+}
+
+func GetAPIConfig() APIConfig {
+	return APIConfig{
+		V1DeprecatedAt: getEnvTime("API_V1_DEPRECATED_AT", v2Released),
+		V1Sunset:       getEnvTime("API_V1_SUNSET", time.Time{}),
+	}
+}
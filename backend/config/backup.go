@@ -0,0 +1,12 @@
+package config
+
+// BackupConfig sets where tenant backups are written and restored from
+type BackupConfig struct {
+	Dir string
+}
+
+func GetBackupConfig() BackupConfig {
+	return BackupConfig{
+		Dir: getEnv("BACKUP_DIR", "backups"),
+	}
+}
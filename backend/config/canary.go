@@ -0,0 +1,50 @@
+package config
+
+import "time"
+
+// CanaryConfig points at a new version of the AI service deployed next to
+// the stable one. A share of the documents the stable version scores are
+// scored by the canary as well, and the results are compared before
+// cutover.
+type CanaryConfig struct {
+	// URL of the canary AI service; empty turns canary analysis off.
+	// Token defaults to AI_SERVICE_TOKEN and may be a secret reference.
+	URL   string
+	Token string
+
+	// ModelVersion identifies the canary's fraud model in comparisons, as
+	// FASTAPI_MODEL_VERSION does for the stable version
+	ModelVersion string
+
+	// Percent of analyses also scored by the canary, at most Concurrency
+	// at a time; analyses beyond that are not compared. Timeout bounds
+	// each canary call.
+	Percent     float64
+	Concurrency int
+	Timeout     time.Duration
+
+	// ScoreTolerance is the largest score difference counted as agreement.
+	// The canary is ready for cutover after MinComparisons comparisons
+	// when at least MinAgreement of them agree on the risk level and at
+	// most MaxErrorRate of its calls failed.
+	ScoreTolerance float64
+	MinComparisons int
+	MinAgreement   float64
+	MaxErrorRate   float64
+}
+
+func GetCanaryConfig() CanaryConfig {
+	return CanaryConfig{
+		URL:          getEnv("AI_CANARY_URL", ""),
+		Token:        getEnv("AI_CANARY_TOKEN", getEnv("AI_SERVICE_TOKEN", "")),
+		ModelVersion: getEnv("AI_CANARY_MODEL_VERSION", ""),
+		Percent:      getEnvFloat("AI_CANARY_PERCENT", 5),
+		Concurrency:  getEnvInt("AI_CANARY_CONCURRENCY", 2),
+		Timeout:      getEnvDuration("AI_CANARY_TIMEOUT", 60*time.Second),
+
+		ScoreTolerance: getEnvFloat("AI_CANARY_SCORE_TOLERANCE", 0.1),
+		MinComparisons: getEnvInt("AI_CANARY_MIN_COMPARISONS", 100),
+		MinAgreement:   getEnvFloat("AI_CANARY_MIN_AGREEMENT", 0.95),
+		MaxErrorRate:   getEnvFloat("AI_CANARY_MAX_ERROR_RATE", 0.01),
+	}
+}
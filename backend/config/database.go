@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+type DatabaseConfig struct {
+	// Driver selects the store implementation: "postgres" or "sqlite"
+	Driver     string
+	SQLitePath string
+
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Name     string
+	SSLMode  string
+
+	// Connection pool settings
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// RotationDrain is how long the previous pool is kept open after the
+	// password is rotated, for the queries still running on it
+	RotationDrain time.Duration
+}
+
+func GetDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		Driver:          getEnv("DB_DRIVER", "postgres"),
+		SQLitePath:      getEnv("DB_SQLITE_PATH", "frauddocai.db"),
+		Host:            getEnv("DB_HOST", "localhost"),
+		Port:            getEnv("DB_PORT", "5432"),
+		User:            getEnv("DB_USER", "frauddocai"),
+		Password:        getEnv("DB_PASSWORD", "frauddocai123"),
+		Name:            getEnv("DB_NAME", "frauddocai"),
+		SSLMode:         getEnv("DB_SSLMODE", "disable"),
+		MaxOpenConns:    getEnvInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    getEnvInt("DB_MAX_IDLE_CONNS", 25),
+		ConnMaxLifetime: getEnvDuration("DB_CONN_MAX_LIFETIME", 5*time.Minute),
+		ConnMaxIdleTime: getEnvDuration("DB_CONN_MAX_IDLE_TIME", 0),
+		RotationDrain:   getEnvDuration("DB_ROTATION_DRAIN", 30*time.Second),
+	}
+}
+
+// ConnectionString returns the lib/pq connection string
+func (c DatabaseConfig) ConnectionString() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
+}
+
+// PartitionConfig is the maintenance of the monthly partitions of the
+// documents table on Postgres
+type PartitionConfig struct {
+	// Interval between maintenance runs; zero disables them
+	Interval time.Duration
+	// Ahead is how many months after the current one have a partition ready
+	Ahead int
+	// RetentionMonths is how many full months before the current one are
+	// kept; older months are dropped with their documents. Zero keeps all.
+	RetentionMonths int
+	// TenantPartitions splits each new month into this many partitions by
+	// hash of the tenant; zero leaves months whole
+	TenantPartitions int
+}
+
+func GetPartitionConfig() PartitionConfig {
+	return PartitionConfig{
+		Interval:         getEnvDuration("DOCUMENT_PARTITION_INTERVAL", 6*time.Hour),
+		Ahead:            getEnvInt("DOCUMENT_PARTITIONS_AHEAD", 3),
+		RetentionMonths:  getEnvInt("DOCUMENT_RETENTION_MONTHS", 0),
+		TenantPartitions: getEnvInt("DOCUMENT_TENANT_PARTITIONS", 0),
+	}
+}
+
+// ChangeFeedConfig is the retention of the change feed
+type ChangeFeedConfig struct {
+	// Retention is how long recorded changes are kept; zero keeps them all
+	Retention time.Duration
+}
+
+func GetChangeFeedConfig() ChangeFeedConfig {
+	return ChangeFeedConfig{
+		Retention: getEnvDuration("CHANGE_FEED_RETENTION", 30*24*time.Hour),
+	}
+}
+
+// DeletionConfig is the purge of deleted documents
+type DeletionConfig struct {
+	// Retention is how long a deleted document is kept before it is purged;
+	// zero purges it at the next run
+	Retention time.Duration
+	// PurgeInterval between purge runs; zero disables them
+	PurgeInterval time.Duration
+}
+
+func GetDeletionConfig() DeletionConfig {
+	return DeletionConfig{
+		Retention:     getEnvDuration("DELETED_DOCUMENT_RETENTION", 30*24*time.Hour),
+		PurgeInterval: getEnvDuration("DELETED_DOCUMENT_PURGE_INTERVAL", time.Hour),
+	}
+}
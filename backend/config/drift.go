@@ -0,0 +1,41 @@
+package config
+
+import "time"
+
+// DriftConfig paces the model drift monitor and sets how far a model
+// version's recent analyses may move from its baseline before it alerts
+type DriftConfig struct {
+	// Interval between drift checks; zero turns the monitor off
+	Interval time.Duration
+
+	// Window is the recent period checked, compared with the Baseline
+	// period before it. Model versions with fewer than MinDocuments
+	// analyses in either period are not compared.
+	Window       time.Duration
+	Baseline     time.Duration
+	MinDocuments int
+
+	// ScorePSI is the population stability index of the fraud score
+	// distribution beyond which it has drifted; Confidence and
+	// DetectionRate are the largest changes of the mean pattern confidence
+	// and of the share of documents with patterns found
+	ScorePSI      float64
+	Confidence    float64
+	DetectionRate float64
+
+	// Retention is how long analyses are kept for drift checks and trends
+	Retention time.Duration
+}
+
+func GetDriftConfig() DriftConfig {
+	return DriftConfig{
+		Interval:      getEnvDuration("MODEL_DRIFT_INTERVAL", time.Hour),
+		Window:        getEnvDuration("MODEL_DRIFT_WINDOW", 24*time.Hour),
+		Baseline:      getEnvDuration("MODEL_DRIFT_BASELINE", 7*24*time.Hour),
+		MinDocuments:  getEnvInt("MODEL_DRIFT_MIN_DOCUMENTS", 50),
+		ScorePSI:      getEnvFloat("MODEL_DRIFT_SCORE_PSI", 0.2),
+		Confidence:    getEnvFloat("MODEL_DRIFT_CONFIDENCE", 0.1),
+		DetectionRate: getEnvFloat("MODEL_DRIFT_DETECTION_RATE", 0.1),
+		Retention:     getEnvDuration("MODEL_DRIFT_RETENTION", 90*24*time.Hour),
+	}
+}
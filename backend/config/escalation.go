@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// EscalationConfig paces the escalation of alerts nobody closed
+type EscalationConfig struct {
+	// Interval between scans for alerts due to escalate; zero turns
+	// escalation off
+	Interval time.Duration
+}
+
+func GetEscalationConfig() EscalationConfig {
+	return EscalationConfig{
+		Interval: getEnvDuration("ESCALATION_INTERVAL", time.Minute),
+	}
+}
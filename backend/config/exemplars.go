@@ -0,0 +1,22 @@
+package config
+
+// ExemplarConfig sets how closely an upload must resemble a known-fraud
+// exemplar before an alert is raised. Identical file hashes always match.
+type ExemplarConfig struct {
+	// EmbeddingThreshold is the minimum cosine similarity of the text embeddings
+	EmbeddingThreshold float64
+
+	// EntityThreshold is the minimum share of the smaller entity set (URLs,
+	// domains, emails, account numbers, IBANs, phone numbers) found in both
+	// documents, counted only when at least MinSharedEntities are shared
+	EntityThreshold   float64
+	MinSharedEntities int
+}
+
+func GetExemplarConfig() ExemplarConfig {
+	return ExemplarConfig{
+		EmbeddingThreshold: getEnvFloat("EXEMPLAR_EMBEDDING_THRESHOLD", 0.92),
+		EntityThreshold:    getEnvFloat("EXEMPLAR_ENTITY_THRESHOLD", 0.6),
+		MinSharedEntities:  getEnvInt("EXEMPLAR_MIN_SHARED_ENTITIES", 2),
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// ExtractionConfig bounds how long text extraction may take. Extractors are
+// identified by name: text, html, email, office and ai-service (PDF and
+// OCR).
+type ExtractionConfig struct {
+	// Timeout applies to extractors without an entry in Timeouts
+	Timeout  time.Duration
+	Timeouts map[string]time.Duration
+}
+
+func GetExtractionConfig() ExtractionConfig {
+	cfg := ExtractionConfig{
+		Timeout: getEnvDuration("EXTRACTION_TIMEOUT", 30*time.Second),
+		// OCR of a multi-page scan is much slower than parsing text
+		Timeouts: map[string]time.Duration{"ai-service": 2 * time.Minute},
+	}
+	for name, value := range getEnvMap("EXTRACTOR_TIMEOUTS") {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			log.Printf("Ignoring invalid timeout %q for extractor %s in EXTRACTOR_TIMEOUTS", value, name)
+			continue
+		}
+		cfg.Timeouts[name] = d
+	}
+	return cfg
+}
+
+// TimeoutFor returns the timeout of the named extractor
+func (c ExtractionConfig) TimeoutFor(name string) time.Duration {
+	if d, ok := c.Timeouts[name]; ok {
+		return d
+	}
+	return c.Timeout
+}
+
+// OCRConfig sets which pages are read again by OCR
+type OCRConfig struct {
+	// ReOCRBelow is the OCR confidence, 0 to 100, below which a page is
+	// taken for poorly read and offered for re-OCR
+	ReOCRBelow float64
+}
+
+func GetOCRConfig() OCRConfig {
+	return OCRConfig{ReOCRBelow: getEnvFloat("OCR_REOCR_BELOW", 60)}
+}
@@ -0,0 +1,25 @@
+package config
+
+import "time"
+
+// FXConfig is the provider of the daily exchange rates document amounts are
+// converted to tenants' base currencies at
+type FXConfig struct {
+	// RatesURL returns one day's rates from one currency as JSON, with
+	// {date} (YYYY-MM-DD) and {base} (an ISO 4217 code) filled in, such as
+	// https://api.frankfurter.app/{date}?from={base}; empty only converts
+	// amounts between currencies whose rates are already cached
+	RatesURL string
+	// BaseCurrency is the currency of tenants that did not choose one
+	BaseCurrency string
+	// Timeout bounds each request to the provider
+	Timeout time.Duration
+}
+
+func GetFXConfig() FXConfig {
+	return FXConfig{
+		RatesURL:     getEnv("FX_RATES_URL", ""),
+		BaseCurrency: getEnv("FX_BASE_CURRENCY", "USD"),
+		Timeout:      getEnvDuration("FX_TIMEOUT", 10*time.Second),
+	}
+}
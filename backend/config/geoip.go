@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+// GeoIPConfig locates submissions and sets the velocity rule comparing the
+// countries a user submits from
+type GeoIPConfig struct {
+	// File is a CSV of network,country lines, such as 203.0.113.0/24,AU,
+	// mapping CIDR ranges to ISO 3166 country codes. Without it, and
+	// without CountryHeader, submissions are recorded without a country.
+	File string
+	// CountryHeader is read for the client's country on requests from a
+	// trusted proxy that geolocates them, such as CF-IPCountry
+	CountryHeader string
+
+	// VelocityWindow is how far back a user's submissions are compared
+	VelocityWindow time.Duration
+	// VelocityMaxCountries is the number of countries a user may submit
+	// from within the window before their documents are flagged
+	VelocityMaxCountries int
+}
+
+func GetGeoIPConfig() GeoIPConfig {
+	return GeoIPConfig{
+		File:                 getEnv("GEOIP_FILE", ""),
+		CountryHeader:        getEnv("GEOIP_COUNTRY_HEADER", ""),
+		VelocityWindow:       getEnvDuration("GEO_VELOCITY_WINDOW", 6*time.Hour),
+		VelocityMaxCountries: getEnvInt("GEO_VELOCITY_MAX_COUNTRIES", 1),
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import "time"
+
+// GraphConfig is the Neo4j instance the document graph is synced to
+type GraphConfig struct {
+	// Neo4jURL is the base URL of Neo4j's HTTP API, such as
+	// http://neo4j:7474; empty disables the sync
+	Neo4jURL string
+	// Neo4jDatabase is the database the graph is written to
+	Neo4jDatabase string
+	Neo4jUser     string
+	// Neo4jPassword may be a secret reference
+	Neo4jPassword string
+	// Timeout bounds each request to Neo4j
+	Timeout time.Duration
+	// Interval between syncs of the documents changed since the last one
+	Interval time.Duration
+	// BatchSize is how many documents are written per request
+	BatchSize int
+}
+
+func GetGraphConfig() GraphConfig {
+	return GraphConfig{
+		Neo4jURL:      getEnv("NEO4J_URL", ""),
+		Neo4jDatabase: getEnv("NEO4J_DATABASE", "neo4j"),
+		Neo4jUser:     getEnv("NEO4J_USER", "neo4j"),
+		Neo4jPassword: getEnv("NEO4J_PASSWORD", ""),
+		Timeout:       getEnvDuration("NEO4J_TIMEOUT", 30*time.Second),
+		Interval:      getEnvDuration("GRAPH_SYNC_INTERVAL", time.Minute),
+		BatchSize:     getEnvInt("GRAPH_SYNC_BATCH_SIZE", 200),
+	}
+}
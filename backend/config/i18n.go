@@ -0,0 +1,18 @@
+package config
+
+// I18nConfig locates the translation bundles of user-facing messages
+type I18nConfig struct {
+	// BundlesDir holds a <language>.json bundle per language. Without it
+	// every message is in English.
+	BundlesDir string
+	// DefaultLanguage is used for requests from users and tenants that
+	// have not chosen a language, and that send no Accept-Language
+	DefaultLanguage string
+}
+
+func GetI18nConfig() I18nConfig {
+	return I18nConfig{
+		BundlesDir:      getEnv("I18N_BUNDLES_DIR", ""),
+		DefaultLanguage: getEnv("I18N_DEFAULT_LANGUAGE", "en"),
+	}
+}
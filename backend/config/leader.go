@@ -0,0 +1,16 @@
+package config
+
+import "time"
+
+// LeaderConfig paces the election of the replica that runs each singleton
+// background task. A replica that loses its database connection is replaced
+// as leader after about one ElectionInterval.
+type LeaderConfig struct {
+	ElectionInterval time.Duration
+}
+
+func GetLeaderConfig() LeaderConfig {
+	return LeaderConfig{
+		ElectionInterval: getEnvDuration("LEADER_ELECTION_INTERVAL", 15*time.Second),
+	}
+}
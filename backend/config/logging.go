@@ -0,0 +1,29 @@
+package config
+
+import (
+	"log"
+	"strings"
+)
+
+// LoggingConfig sets how much each component logs: debug, info, warn or
+// error. Level applies to the components Levels does not name.
+type LoggingConfig struct {
+	Level  string
+	Levels map[string]string
+}
+
+func GetLoggingConfig() LoggingConfig {
+	cfg := LoggingConfig{
+		Level:  getEnv("LOG_LEVEL", "info"),
+		Levels: map[string]string{},
+	}
+	for _, entry := range getEnvList("LOG_LEVELS", nil) {
+		component, level, ok := strings.Cut(entry, "=")
+		if !ok {
+			log.Printf("Ignoring %q in LOG_LEVELS, which takes component=level", entry)
+			continue
+		}
+		cfg.Levels[strings.TrimSpace(component)] = strings.TrimSpace(level)
+	}
+	return cfg
+}
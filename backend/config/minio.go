@@ -10,6 +10,9 @@ type MinIOConfig struct {
     SecretAccessKey string
     UseSSL          bool
     BucketName      string
+    // PublicURL is where clients reach the store, such as through a proxy
+    // or CDN; file links are built on it. Empty uses the endpoint.
+    PublicURL string
 }
 
 func GetMinIOConfig() MinIOConfig {
@@ -19,6 +22,7 @@ func GetMinIOConfig() MinIOConfig {
         SecretAccessKey: getEnv("MINIO_SECRET_KEY", "frauddocai123"),
         UseSSL:          false,
         BucketName:      getEnv("MINIO_BUCKET", "documents"),
+        PublicURL:       getEnv("STORAGE_PUBLIC_URL", ""),
     }
 }
 
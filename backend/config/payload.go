@@ -0,0 +1,20 @@
+package config
+
+// PayloadConfig bounds the memory taken by the documents the backend holds
+// while receiving and extracting them
+type PayloadConfig struct {
+	// SpillBytes is the largest payload kept in memory; larger ones are
+	// written to temporary files under TMPDIR
+	SpillBytes int64
+	// MemoryBudget bounds the payload bytes held in memory by all requests
+	// and pipeline runs of the process together; payloads beyond it are
+	// written to temporary files whatever their size. Zero means no budget.
+	MemoryBudget int64
+}
+
+func GetPayloadConfig() PayloadConfig {
+	return PayloadConfig{
+		SpillBytes:   int64(getEnvInt("PAYLOAD_SPILL_BYTES", 4<<20)),
+		MemoryBudget: int64(getEnvInt("PAYLOAD_MEMORY_BUDGET_BYTES", 256<<20)),
+	}
+}
@@ -0,0 +1,49 @@
+package config
+
+import "time"
+
+// PipelineConfig locates the processing pipeline definitions and sizes the
+// workers that run them. Without File every document runs the default
+// pipeline.
+type PipelineConfig struct {
+	File string
+	// RetryDelay is the wait before a failed stage is retried, doubling for
+	// each further retry
+	RetryDelay time.Duration
+
+	// Workers is how many pipelines each replica runs at once. Replicas
+	// claim queued documents every PollInterval, or as soon as one is queued
+	// locally, and hold them for LeaseDuration at a time, renewing the lease
+	// while the pipeline runs. A document whose worker stopped is claimed
+	// again once its lease expires, up to MaxAttempts times.
+	Workers       int
+	PollInterval  time.Duration
+	LeaseDuration time.Duration
+	MaxAttempts   int
+
+	// StaleAfter is how long a document may stay uploaded without a job
+	// before a starting worker queues its pipeline again. ShutdownGrace is
+	// how long a stopping worker lets running pipelines finish before it
+	// returns them to the queue.
+	StaleAfter    time.Duration
+	ShutdownGrace time.Duration
+
+	// QueueHighWater is the number of queued jobs from which uploads are
+	// answered with 202 and the expected wait; zero never does
+	QueueHighWater int
+}
+
+func GetPipelineConfig() PipelineConfig {
+	return PipelineConfig{
+		File:          getEnv("PIPELINE_CONFIG_FILE", ""),
+		RetryDelay:    getEnvDuration("PIPELINE_RETRY_DELAY", 2*time.Second),
+		Workers:       getEnvInt("PIPELINE_WORKERS", 4),
+		PollInterval:  getEnvDuration("PIPELINE_POLL_INTERVAL", 2*time.Second),
+		LeaseDuration: getEnvDuration("PIPELINE_LEASE_DURATION", time.Minute),
+		MaxAttempts:   getEnvInt("PIPELINE_MAX_ATTEMPTS", 3),
+		StaleAfter:    getEnvDuration("PIPELINE_STALE_AFTER", 10*time.Minute),
+		ShutdownGrace: getEnvDuration("PIPELINE_SHUTDOWN_GRACE", 30*time.Second),
+
+		QueueHighWater: getEnvInt("PIPELINE_QUEUE_HIGH_WATER", 100),
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+// URLReputationConfig lists the domains links in documents are checked
+// against
+type URLReputationConfig struct {
+	// Blocklist domains, and their subdomains, are known phishing hosts
+	Blocklist []string
+	// BlocklistFile adds one domain per line; # starts a comment
+	BlocklistFile string
+
+	// ProtectedDomains are frequently imitated payment, banking and
+	// document-signing sites. Links to them are trusted; links to domains
+	// resembling them are flagged.
+	ProtectedDomains []string
+	// LookalikeDistance is the largest number of edits between a domain name
+	// and a protected one for it to count as a lookalike
+	LookalikeDistance int
+}
+
+var defaultProtectedDomains = []string{
+	"paypal.com", "stripe.com", "squareup.com", "wise.com", "payoneer.com",
+	"bill.com", "intuit.com", "quickbooks.com", "docusign.com", "docusign.net",
+	"americanexpress.com", "chase.com", "wellsfargo.com", "bankofamerica.com",
+	"citi.com", "hsbc.com", "barclays.co.uk", "microsoft.com", "office.com",
+	"apple.com", "amazon.com", "google.com",
+}
+
+func GetURLReputationConfig() URLReputationConfig {
+	return URLReputationConfig{
+		Blocklist:         getEnvList("URL_BLOCKLIST", nil),
+		BlocklistFile:     getEnv("URL_BLOCKLIST_FILE", ""),
+		ProtectedDomains:  getEnvList("URL_PROTECTED_DOMAINS", defaultProtectedDomains),
+		LookalikeDistance: getEnvInt("URL_LOOKALIKE_DISTANCE", 1),
+	}
+}
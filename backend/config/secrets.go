@@ -0,0 +1,38 @@
+package config
+
+import "time"
+
+// SecretsConfig configures the secrets managers that secret references in
+// other settings are resolved from. A setting such as DB_PASSWORD may hold
+// vault:<path>#<key> or aws-sm:<secret id>#<key> instead of the value.
+type SecretsConfig struct {
+	// CacheTTL is how long a fetched secret is used before it is fetched
+	// again, and so how long a rotated secret takes to be picked up
+	CacheTTL time.Duration
+
+	// WatchInterval is how often every secret in use is fetched to detect
+	// rotation, so that connections using it are rebuilt. Zero disables
+	// watching.
+	WatchInterval time.Duration
+
+	VaultAddr      string
+	VaultToken     string
+	VaultMount     string
+	VaultNamespace string
+
+	// AWSRegion defaults to the region of the AWS SDK's default
+	// configuration
+	AWSRegion string
+}
+
+func GetSecretsConfig() SecretsConfig {
+	return SecretsConfig{
+		CacheTTL:       getEnvDuration("SECRETS_CACHE_TTL", 5*time.Minute),
+		WatchInterval:  getEnvDuration("SECRETS_WATCH_INTERVAL", time.Minute),
+		VaultAddr:      getEnv("VAULT_ADDR", ""),
+		VaultToken:     getEnv("VAULT_TOKEN", ""),
+		VaultMount:     getEnv("VAULT_KV_MOUNT", "secret"),
+		VaultNamespace: getEnv("VAULT_NAMESPACE", ""),
+		AWSRegion:      getEnv("AWS_SECRETS_REGION", ""),
+	}
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServerConfig holds the HTTP listener settings and the limits that keep a
+// single slow or oversized client from tying up the server
+type ServerConfig struct {
+	Port string
+	// ReadHeaderTimeout bounds how long a client may take to send the
+	// request line and headers
+	ReadHeaderTimeout time.Duration
+	// IdleTimeout closes keep-alive connections with no request in flight
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+
+	// MaxBodyBytes and BodyTimeout limit the request bodies of JSON
+	// endpoints; MaxUploadBytes and UploadTimeout those of file uploads
+	MaxBodyBytes   int64
+	BodyTimeout    time.Duration
+	MaxUploadBytes int64
+	UploadTimeout  time.Duration
+
+	// MaxWait caps how long GET /documents/:id?wait_for= holds a request
+	MaxWait time.Duration
+
+	// ShutdownTimeout is how long a stopping server waits for requests in
+	// flight
+	ShutdownTimeout time.Duration
+
+	// PublicBaseURL is where clients reach the API, such as through a proxy
+	// or gateway. Links sent to people and systems outside a request, in
+	// webhooks for instance, are built on it.
+	PublicBaseURL string
+}
+
+// HTTPLogConfig enables a verbose log of the requests and responses of
+// selected routes, for debugging integrations. Bodies are logged with
+// document text and personal data scrubbed, to a sink apart from the
+// service log.
+type HTTPLogConfig struct {
+	// File receives a JSON line per logged request, "-" meaning standard
+	// output; the log is off without it
+	File string
+	// SampleRate is the fraction of requests logged, from 0 to 1
+	SampleRate float64
+	// Routes are the route patterns logged, such as
+	// /api/v2/documents/:id, each with its own sample rate; empty logs
+	// every route at SampleRate
+	Routes map[string]float64
+	// MaxBodyBytes is the largest body logged; larger ones are left out
+	MaxBodyBytes int
+}
+
+func GetHTTPLogConfig() HTTPLogConfig {
+	cfg := HTTPLogConfig{
+		File:         getEnv("HTTP_LOG_FILE", ""),
+		SampleRate:   getEnvFloat("HTTP_LOG_SAMPLE_RATE", 1),
+		Routes:       map[string]float64{},
+		MaxBodyBytes: getEnvInt("HTTP_LOG_MAX_BODY_BYTES", 64<<10),
+	}
+	for _, route := range getEnvList("HTTP_LOG_ROUTES", nil) {
+		rate := cfg.SampleRate
+		if pattern, value, ok := strings.Cut(route, "="); ok {
+			route = strings.TrimSpace(pattern)
+			r, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				log.Printf("Invalid sample rate for %s in HTTP_LOG_ROUTES, using %v", route, rate)
+			} else {
+				rate = r
+			}
+		}
+		cfg.Routes[route] = rate
+	}
+	return cfg
+}
+
+// TLSConfig enables HTTPS on the listener. CertFile and KeyFile serve a
+// fixed certificate; alternatively AutocertDomains obtains certificates from
+// Let's Encrypt, cached in AutocertCacheDir. Without either the backend
+// serves plain HTTP, for deployments behind a TLS-terminating proxy.
+type TLSConfig struct {
+	CertFile         string
+	KeyFile          string
+	AutocertDomains  []string
+	AutocertCacheDir string
+	AutocertEmail    string
+	// AutocertHTTPAddr also answers HTTP-01 challenges, and redirects other
+	// requests to HTTPS, on this address; TLS-ALPN-01 challenges are always
+	// answered by the HTTPS listener
+	AutocertHTTPAddr string
+}
+
+func GetServerConfig() ServerConfig {
+	return ServerConfig{
+		Port:              getEnv("PORT", "8080"),
+		ReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		IdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		MaxHeaderBytes:    getEnvInt("HTTP_MAX_HEADER_BYTES", 64<<10),
+		MaxBodyBytes:      int64(getEnvInt("HTTP_MAX_BODY_BYTES", 1<<20)),
+		BodyTimeout:       getEnvDuration("HTTP_BODY_TIMEOUT", 30*time.Second),
+		MaxUploadBytes:    int64(getEnvInt("HTTP_MAX_UPLOAD_BYTES", 50<<20)),
+		UploadTimeout:     getEnvDuration("HTTP_UPLOAD_TIMEOUT", 10*time.Minute),
+		MaxWait:           getEnvDuration("HTTP_MAX_WAIT", time.Minute),
+		ShutdownTimeout:   getEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 30*time.Second),
+		PublicBaseURL:     strings.TrimSuffix(getEnv("PUBLIC_BASE_URL", "http://localhost:"+getEnv("PORT", "8080")), "/"),
+	}
+}
+
+// ValidatePublicURL checks that a base URL for links is an absolute http or
+// https URL without a query or fragment, which links could not be appended
+// to
+func ValidatePublicURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%q must start with http:// or https://", value)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", value)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("%q must not have credentials, a query or a fragment", value)
+	}
+	return nil
+}
+
+func GetTLSConfig() TLSConfig {
+	return TLSConfig{
+		CertFile:         getEnv("TLS_CERT_FILE", ""),
+		KeyFile:          getEnv("TLS_KEY_FILE", ""),
+		AutocertDomains:  getEnvList("TLS_AUTOCERT_DOMAINS", nil),
+		AutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "autocert"),
+		AutocertEmail:    getEnv("TLS_AUTOCERT_EMAIL", ""),
+		AutocertHTTPAddr: getEnv("TLS_AUTOCERT_HTTP_ADDR", ""),
+	}
+}
+
+// CORSConfig lists what browser clients on other origins may call. The
+// defaults suit local development; deployments set their own origins.
+type CORSConfig struct {
+	AllowOrigins     []string
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func GetCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowOrigins:     getEnvList("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000", "http://localhost:8080"}),
+		AllowMethods:     getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		AllowHeaders:     getEnvList("CORS_ALLOWED_HEADERS", []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Tenant", "X-User", "X-Client-Fingerprint"}),
+		ExposeHeaders:    getEnvList("CORS_EXPOSED_HEADERS", []string{"Deprecation", "Sunset", "Link", "Retry-After", "Content-Disposition", "X-Impersonation", "X-Impersonated-By"}),
+		AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		MaxAge:           getEnvDuration("CORS_MAX_AGE", 12*time.Hour),
+	}
+}
+
+// ProxyConfig names the reverse proxies and API gateways in front of the
+// backend. Only requests arriving from them may set the client address and
+// scheme through forwarding headers; from anyone else the headers are
+// ignored, since clients could otherwise claim any address.
+type ProxyConfig struct {
+	// TrustedProxies are IP addresses and CIDR ranges; empty trusts none
+	TrustedProxies []string
+	// ClientIPHeaders are read in order for the client address, each from
+	// the right, skipping the addresses of trusted proxies
+	ClientIPHeaders []string
+}
+
+func GetProxyConfig() ProxyConfig {
+	return ProxyConfig{
+		TrustedProxies:  getEnvList("TRUSTED_PROXIES", nil),
+		ClientIPHeaders: getEnvList("PROXY_CLIENT_IP_HEADERS", []string{"X-Forwarded-For", "X-Real-IP"}),
+	}
+}
+
+// SecurityConfig sets the security headers sent with every response
+type SecurityConfig struct {
+	// HSTSMaxAge is sent in Strict-Transport-Security on HTTPS requests;
+	// zero disables the header
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	ContentSecurityPolicy string
+}
+
+func GetSecurityConfig() SecurityConfig {
+	return SecurityConfig{
+		HSTSMaxAge:            getEnvDuration("SECURITY_HSTS_MAX_AGE", 365*24*time.Hour),
+		HSTSIncludeSubdomains: getEnvBool("SECURITY_HSTS_INCLUDE_SUBDOMAINS", false),
+		ContentSecurityPolicy: getEnv("SECURITY_CSP", "default-src 'none'; frame-ancestors 'none'"),
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// StorageConfig lists the object stores uploaded files are kept in. Default
+// is the MINIO_* store and is named DefaultRegion; Regions adds a store for
+// each data residency region tenants can be pinned to.
+type StorageConfig struct {
+	DefaultRegion string
+	Default       MinIOConfig
+	Regions       map[string]MinIOConfig
+
+	// ArchiveBucket is the bucket, on each region's endpoint, that documents
+	// are moved to once they age out. Empty disables archival.
+	ArchiveBucket string
+}
+
+// LifecycleConfig is the policy for moving documents to the archive tier
+type LifecycleConfig struct {
+	// ArchiveAfter is how long a document stays in the hot tier after upload
+	// or its last restore; zero disables archival
+	ArchiveAfter time.Duration
+	Interval     time.Duration
+	// RestoreLatency is how long clients are told to wait for an archived
+	// document to be restored before retrying its download URL
+	RestoreLatency time.Duration
+}
+
+// ReconcileConfig schedules the scan that registers files written to the
+// buckets directly rather than through the upload API
+type ReconcileConfig struct {
+	// Interval between scans; zero disables them
+	Interval time.Duration
+	// Grace is how old an unregistered object must be before the scan picks
+	// it up, so that uploads still being saved are left alone
+	Grace time.Duration
+}
+
+// GetStorageConfig reads the regions named in STORAGE_REGIONS. A region eu
+// is configured with MINIO_EU_ENDPOINT, MINIO_EU_ACCESS_KEY,
+// MINIO_EU_SECRET_KEY, MINIO_EU_BUCKET and MINIO_EU_PUBLIC_URL; the keys and
+// bucket default to the values of the default store.
+func GetStorageConfig() StorageConfig {
+	cfg := StorageConfig{
+		DefaultRegion: getEnv("STORAGE_DEFAULT_REGION", "default"),
+		Default:       GetMinIOConfig(),
+		Regions:       map[string]MinIOConfig{},
+		ArchiveBucket: getEnv("STORAGE_ARCHIVE_BUCKET", ""),
+	}
+	for _, region := range getEnvList("STORAGE_REGIONS", nil) {
+		prefix := "MINIO_" + strings.ToUpper(strings.ReplaceAll(region, "-", "_")) + "_"
+		cfg.Regions[region] = MinIOConfig{
+			Endpoint:        getEnv(prefix+"ENDPOINT", ""),
+			AccessKeyID:     getEnv(prefix+"ACCESS_KEY", cfg.Default.AccessKeyID),
+			SecretAccessKey: getEnv(prefix+"SECRET_KEY", cfg.Default.SecretAccessKey),
+			UseSSL:          cfg.Default.UseSSL,
+			BucketName:      getEnv(prefix+"BUCKET", cfg.Default.BucketName),
+			PublicURL:       getEnv(prefix+"PUBLIC_URL", ""),
+		}
+	}
+	return cfg
+}
+
+func GetLifecycleConfig() LifecycleConfig {
+	return LifecycleConfig{
+		ArchiveAfter:   time.Duration(getEnvInt("STORAGE_ARCHIVE_AFTER_DAYS", 0)) * 24 * time.Hour,
+		Interval:       getEnvDuration("STORAGE_LIFECYCLE_INTERVAL", time.Hour),
+		RestoreLatency: getEnvDuration("STORAGE_RESTORE_LATENCY", 30*time.Second),
+	}
+}
+
+func GetReconcileConfig() ReconcileConfig {
+	return ReconcileConfig{
+		Interval: getEnvDuration("BUCKET_SCAN_INTERVAL", 15*time.Minute),
+		Grace:    getEnvDuration("BUCKET_SCAN_GRACE", 5*time.Minute),
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import "time"
+
+// WatermarkConfig sets how watermarked copies of documents are made
+type WatermarkConfig struct {
+	// MaxSourceBytes bounds the originals copies are made of, as each is
+	// stamped in memory
+	MaxSourceBytes int
+	// CacheBytes bounds the copies each replica keeps for repeated
+	// downloads; zero disables the cache. CacheTTL is how long a copy is
+	// served before it is made anew.
+	CacheBytes int
+	CacheTTL   time.Duration
+}
+
+func GetWatermarkConfig() WatermarkConfig {
+	return WatermarkConfig{
+		MaxSourceBytes: getEnvInt("WATERMARK_MAX_SOURCE_BYTES", 50<<20),
+		CacheBytes:     getEnvInt("WATERMARK_CACHE_BYTES", 64<<20),
+		CacheTTL:       getEnvDuration("WATERMARK_CACHE_TTL", time.Hour),
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+// WebhookConfig is where administrative events are delivered
+type WebhookConfig struct {
+	// URL receives every event as a POST; empty disables webhooks
+	URL string
+	// Secret signs each body with HMAC-SHA256 when set
+	Secret string
+	// Events limits delivery to these event types; empty delivers all
+	Events []string
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+	// Interval between scans for events to deliver
+	Interval time.Duration
+	// MaxAttempts is how often an event is tried before it is given up
+	MaxAttempts int
+}
+
+func GetWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		URL:         getEnv("WEBHOOK_URL", ""),
+		Secret:      getEnv("WEBHOOK_SECRET", ""),
+		Events:      getEnvList("WEBHOOK_EVENTS", nil),
+		Timeout:     getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		Interval:    getEnvDuration("WEBHOOK_DELIVERY_INTERVAL", 10*time.Second),
+		MaxAttempts: getEnvInt("WEBHOOK_MAX_ATTEMPTS", 10),
+	}
+}
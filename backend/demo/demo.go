@@ -0,0 +1,209 @@
+// Package demo seeds a database with sample tenants, users, fraud patterns and
+// pre-analyzed documents for sales demos and frontend development.
+package demo
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"frauddocai-backend/services"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password shared by every seeded demo user
+const Password = "demo123"
+
+//go:embed fixtures/demo.json fixtures/documents/*.txt
+var fixtures embed.FS
+
+type fixtureSet struct {
+	Tenants []struct {
+		Slug string `json:"slug"`
+		Name string `json:"name"`
+	} `json:"tenants"`
+	Users []struct {
+		Tenant    string `json:"tenant"`
+		Email     string `json:"email"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Role      string `json:"role"`
+	} `json:"users"`
+	Patterns []struct {
+		PatternName    string            `json:"pattern_name"`
+		PatternType    string            `json:"pattern_type"`
+		Description    string            `json:"description"`
+		DetectionRules services.Metadata `json:"detection_rules"`
+		Severity       string            `json:"severity"`
+	} `json:"patterns"`
+	Documents []struct {
+		Tenant          string            `json:"tenant"`
+		User            string            `json:"user"`
+		File            string            `json:"file"`
+		DocumentType    *string           `json:"document_type"`
+		FraudScore      float64           `json:"fraud_score"`
+		RiskLevel       string            `json:"risk_level"`
+		Metadata        services.Metadata `json:"metadata"`
+		EmotionAnalysis json.RawMessage   `json:"emotion_analysis"`
+		PatternAnalysis json.RawMessage   `json:"pattern_analysis"`
+	} `json:"documents"`
+}
+
+// Seed loads the embedded fixtures. It is a no-op for tenants that already
+// exist, so starting with -demo repeatedly does not duplicate data.
+func Seed(store services.Store, storage services.ObjectStorage) error {
+	raw, err := fixtures.ReadFile("fixtures/demo.json")
+	if err != nil {
+		return err
+	}
+	var set fixtureSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("failed to parse demo fixtures: %v", err)
+	}
+
+	tenantIDs := map[string]string{}
+	seeded := map[string]bool{}
+	for _, t := range set.Tenants {
+		existing, err := store.GetTenantBySlug(t.Slug)
+		if err == nil {
+			tenantIDs[t.Slug] = existing.ID
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to look up tenant %s: %v", t.Slug, err)
+		}
+
+		tenant := &services.Tenant{Slug: t.Slug, Name: t.Name}
+		if err := store.CreateTenant(tenant); err != nil {
+			return fmt.Errorf("failed to create tenant %s: %v", t.Slug, err)
+		}
+		tenantIDs[t.Slug] = tenant.ID
+		seeded[t.Slug] = true
+	}
+
+	if len(seeded) == 0 {
+		log.Println("Demo data already present, skipping seed")
+		return nil
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	userIDs := map[string]string{}
+	for _, u := range set.Users {
+		if !seeded[u.Tenant] {
+			continue
+		}
+		tenantID := tenantIDs[u.Tenant]
+		user := &services.User{
+			TenantID:     &tenantID,
+			Email:        u.Email,
+			PasswordHash: string(passwordHash),
+			FirstName:    u.FirstName,
+			LastName:     u.LastName,
+			Role:         u.Role,
+		}
+		if err := store.CreateUser(user); err != nil {
+			return fmt.Errorf("failed to create user %s: %v", u.Email, err)
+		}
+		userIDs[u.Email] = user.ID
+	}
+
+	if err := seedPatterns(store, set); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	documents := 0
+	for _, d := range set.Documents {
+		if !seeded[d.Tenant] {
+			continue
+		}
+
+		content, err := fixtures.ReadFile("fixtures/documents/" + d.File)
+		if err != nil {
+			return err
+		}
+
+		objectName := fmt.Sprintf("demo/%s/%s", d.Tenant, d.File)
+		if err := storage.UploadFile(ctx, objectName, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+			return fmt.Errorf("failed to upload demo document %s: %v", d.File, err)
+		}
+
+		if err := services.DefaultRiskTaxonomy().CheckLevel(d.RiskLevel); err != nil {
+			return fmt.Errorf("demo document %s: %v", d.File, err)
+		}
+
+		tenantID := tenantIDs[d.Tenant]
+		text := string(content)
+		emotionAnalysis := string(d.EmotionAnalysis)
+		patternAnalysis := string(d.PatternAnalysis)
+		fraudScore := d.FraudScore
+		document := &services.Document{
+			TenantID:         &tenantID,
+			Filename:         objectName,
+			OriginalFilename: d.File,
+			FilePath:         objectName,
+			FileSize:         int64(len(content)),
+			MimeType:         "text/plain",
+			DocumentType:     d.DocumentType,
+			Status:           "processed",
+			FraudScore:       &fraudScore,
+			FraudRiskLevel:   d.RiskLevel,
+			ExtractedText:    &text,
+			EmotionAnalysis:  &emotionAnalysis,
+			PatternAnalysis:  &patternAnalysis,
+			Metadata:         d.Metadata,
+		}
+		if userID, ok := userIDs[d.User]; ok {
+			document.UserID = &userID
+		}
+		if err := store.CreateDocument(document); err != nil {
+			return fmt.Errorf("failed to create demo document %s: %v", d.File, err)
+		}
+		documents++
+	}
+
+	log.Printf("Seeded demo data: %d tenants, %d users, %d documents (user password: %s)",
+		len(seeded), len(userIDs), documents, Password)
+	return nil
+}
+
+// seedPatterns adds fixture patterns whose type is not already defined
+func seedPatterns(store services.Store, set fixtureSet) error {
+	existing, err := store.GetFraudPatterns()
+	if err != nil {
+		return fmt.Errorf("failed to load fraud patterns: %v", err)
+	}
+	known := map[string]bool{}
+	for _, p := range existing {
+		known[p.PatternType] = true
+	}
+
+	for _, p := range set.Patterns {
+		if known[p.PatternType] {
+			continue
+		}
+		description := p.Description
+		pattern := &services.FraudPattern{
+			PatternName:    p.PatternName,
+			PatternType:    p.PatternType,
+			Description:    &description,
+			DetectionRules: p.DetectionRules,
+			Severity:       p.Severity,
+			IsActive:       true,
+		}
+		if err := store.CreateFraudPattern(pattern); err != nil {
+			return fmt.Errorf("failed to create fraud pattern %s: %v", p.PatternType, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+// Package logging writes the log lines of the backend's components at a
+// level set per component, which can be changed while the server runs
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is how severe a log line is. A component logs the lines at or above
+// its level.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = map[Level]string{
+	LevelDebug: "debug",
+	LevelInfo:  "info",
+	LevelWarn:  "warn",
+	LevelError: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel reads a level name, in any case; "warning" is taken for warn
+func ParseLevel(s string) (Level, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "warning" {
+		name = "warn"
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (available: debug, info, warn, error)", s)
+}
+
+// Logger writes the lines of one component through the standard logger,
+// prefixed with their level and the component's name
+type Logger struct {
+	component string
+	// configured is the level from the environment and level the one in
+	// force, which differs while an override is applied
+	configured atomic.Int32
+	level      atomic.Int32
+}
+
+func newLogger(component string) *Logger {
+	l := &Logger{component: component}
+	l.configured.Store(int32(LevelInfo))
+	l.level.Store(int32(LevelInfo))
+	return l
+}
+
+// The components whose levels can be set
+var (
+	HTTP     = newLogger("http")
+	DB       = newLogger("db")
+	Storage  = newLogger("storage")
+	AI       = newLogger("ai")
+	Pipeline = newLogger("pipeline")
+)
+
+var loggers = map[string]*Logger{
+	HTTP.component:     HTTP,
+	DB.component:       DB,
+	Storage.component:  Storage,
+	AI.component:       AI,
+	Pipeline.component: Pipeline,
+}
+
+// Components lists the names of the components, sorted
+func Components() []string {
+	names := make([]string, 0, len(loggers))
+	for name := range loggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the logger of the named component
+func Lookup(component string) (*Logger, bool) {
+	l, ok := loggers[component]
+	return l, ok
+}
+
+// Configure sets the level of every component to level, or to the one
+// levels gives it, and drops any override. It fails on an unknown
+// component or level without changing anything.
+func Configure(level string, levels map[string]string) error {
+	defaultLevel, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	configured := make(map[string]Level, len(loggers))
+	for name := range loggers {
+		configured[name] = defaultLevel
+	}
+	for name, value := range levels {
+		if _, ok := loggers[name]; !ok {
+			return fmt.Errorf("unknown log component %q (available: %s)", name, strings.Join(Components(), ", "))
+		}
+		if configured[name], err = ParseLevel(value); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	for name, l := range loggers {
+		l.configured.Store(int32(configured[name]))
+		l.level.Store(int32(configured[name]))
+	}
+	return nil
+}
+
+// Apply puts the overrides in force, by component, and returns the other
+// components to their configured level
+func Apply(overrides map[string]Level) {
+	for name, l := range loggers {
+		if level, ok := overrides[name]; ok {
+			l.level.Store(int32(level))
+		} else {
+			l.level.Store(l.configured.Load())
+		}
+	}
+}
+
+// Name is the component the logger writes for
+func (l *Logger) Name() string {
+	return l.component
+}
+
+// Level is the level in force
+func (l *Logger) Level() Level {
+	return Level(l.level.Load())
+}
+
+// Configured is the level set by the environment
+func (l *Logger) Configured() Level {
+	return Level(l.configured.Load())
+}
+
+// Enabled reports whether lines of level are written, so that callers can
+// skip building costly debug output
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.output(LevelDebug, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.output(LevelInfo, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.output(LevelWarn, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.output(LevelError, format, args...)
+}
+
+// Writer returns a writer passing what is written to w while lines of level
+// are enabled, for libraries that log to a writer of their own
+func (l *Logger) Writer(level Level, w io.Writer) io.Writer {
+	return &levelWriter{logger: l, level: level, w: w}
+}
+
+type levelWriter struct {
+	logger *Logger
+	level  Level
+	w      io.Writer
+}
+
+func (lw *levelWriter) Write(p []byte) (int, error) {
+	if !lw.logger.Enabled(lw.level) {
+		return len(p), nil
+	}
+	return lw.w.Write(p)
+}
+
+func (l *Logger) output(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	prefix := strings.ToUpper(level.String()) + " [" + l.component + "] "
+	log.Output(3, prefix+fmt.Sprintf(format, args...))
+}
@@ -1,690 +1,462 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
-
+	// Tenants report in IANA time zones, also on hosts without a zoneinfo
+	// database
+	_ "time/tzdata"
+
+	"frauddocai-backend/api"
+	"frauddocai-backend/config"
+	"frauddocai-backend/demo"
+	"frauddocai-backend/logging"
 	"frauddocai-backend/services"
+	"frauddocai-backend/synthetic"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme/autocert"
 )
 
-// Global service instances
-var minioService *services.MinIOService
-var dbService *services.DatabaseService
+// analysisCachePurgeInterval is how often expired cached analyses are deleted
+const analysisCachePurgeInterval = time.Hour
 
-func main() {
-	// Initialize MinIO service
-	var err error
-	minioService, err = services.NewMinIOService()
-	if err != nil {
-		log.Fatalf("Failed to initialize MinIO service: %v", err)
-	}
-	log.Println("MinIO service initialized successfully")
+// changeFeedPurgeInterval is how often changes past their retention are
+// deleted
+const changeFeedPurgeInterval = time.Hour
 
-	// Initialize Database service
-	dbService, err = services.NewDatabaseService()
-	if err != nil {
-		log.Fatalf("Failed to initialize database service: %v", err)
+func main() {
+	demoMode := flag.Bool("demo", false, "seed demo tenants, users, fraud patterns and analyzed documents on startup")
+	backupTenants := flag.String("backup", "", "back up the comma separated tenant slugs to BACKUP_DIR and exit")
+	verifyBackup := flag.String("verify-backup", "", "verify the backup with this ID against its manifest and exit")
+	restoreBackup := flag.String("restore-backup", "", "restore the backup with this ID and exit")
+	syntheticFixtures := flag.String("synthetic-fixtures", "", "write synthetic invoices and receipts with known fraud patterns, and their manifest, to this directory and exit")
+	syntheticSeed := flag.Int64("synthetic-seed", 1, "seed of the synthetic fixtures")
+	syntheticSets := flag.Int("synthetic-sets", 1, "sets of synthetic fixtures to write")
+	flag.Parse()
+
+	if *syntheticFixtures != "" {
+		fixtures := synthetic.Generate(*syntheticSeed, *syntheticSets)
+		if err := synthetic.Write(*syntheticFixtures, *syntheticSeed, *syntheticSets, fixtures); err != nil {
+			log.Fatalf("Failed to write synthetic fixtures: %v", err)
+		}
+		log.Printf("Wrote %d synthetic fixtures to %s", len(fixtures), *syntheticFixtures)
+		return
 	}
-	log.Println("Database service initialized successfully")
-
-	// Initialize Gin router
-	r := gin.Default()
 
-	// CORS middleware
-	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:3000", "http://localhost:8080"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	r.Use(cors.New(config))
-
-	// Routes
-	setupRoutes(r)
-
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	loggingConfig := config.GetLoggingConfig()
+	if err := logging.Configure(loggingConfig.Level, loggingConfig.Levels); err != nil {
+		log.Fatalf("Invalid LOG_LEVEL or LOG_LEVELS: %v", err)
 	}
 
-	log.Printf("Starting FraudDocAI Backend on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
-}
-
-func setupRoutes(r *gin.Engine) {
-	// Health check
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"service": "FraudDocAI Backend",
-			"status":  "running",
-			"version": "1.0.0",
-		})
-	})
-
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":    "healthy",
-			"timestamp": "2024-01-01T00:00:00Z",
-		})
-	})
-
-	// API v1 routes
-	v1 := r.Group("/api/v1")
-	{
-		// Document routes
-		documents := v1.Group("/documents")
-		{
-			documents.POST("/upload", uploadDocument)
-			documents.GET("/", getDocuments)
-			documents.GET("/:id", getDocument)
-			documents.DELETE("/:id", deleteDocument)
-		}
-
-		// Fraud detection routes
-		fraud := v1.Group("/fraud")
-		{
-			fraud.POST("/analyze", analyzeDocument)
-			fraud.GET("/patterns", getFraudPatterns)
-			fraud.GET("/reports", getFraudReports)
-		}
+	// SIGTERM, sent on deploys, stops the backend gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		// Document Question Answering routes
-		qa := v1.Group("/qa")
-		{
-			qa.POST("/ask", askDocument)
-			qa.POST("/analyze-fraud", analyzeDocumentFraud)
-			qa.GET("/model-info", getQAModelInfo)
-		}
+	// Credentials in the configuration may reference secrets managers
+	secretsConfig := config.GetSecretsConfig()
+	secrets := services.NewSecrets(secretsConfig)
 
-		// User routes
-		users := v1.Group("/users")
-		{
-			users.POST("/register", registerUser)
-			users.POST("/login", loginUser)
-			users.GET("/profile", getUserProfile)
-		}
+	if err := validatePublicURLs(config.GetServerConfig(), config.GetStorageConfig()); err != nil {
+		log.Fatal(err)
 	}
-}
 
-// Document handlers
-func uploadDocument(c *gin.Context) {
-	// Get the file from the form
-	file, header, err := c.Request.FormFile("file")
+	// Initialize MinIO, with a store per data residency region
+	storage, err := services.NewRegionalStorage(config.GetStorageConfig(), secrets)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":  "No file uploaded",
-			"status": "error",
-		})
-		return
+		log.Fatalf("Failed to initialize MinIO service: %v", err)
 	}
-	defer file.Close()
+	log.Printf("MinIO service initialized successfully (regions: %v)", storage.Regions())
 
-	// Generate unique filename
-	objectName := fmt.Sprintf("%d_%s", time.Now().Unix(), header.Filename)
-
-	// Upload to MinIO
-	ctx := context.Background()
-	err = minioService.UploadFile(ctx, objectName, file, header.Size, header.Header.Get("Content-Type"))
+	// Initialize Database service
+	dbService, err := services.NewDatabaseService(config.GetDatabaseConfig(), secrets)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to upload file",
-			"status": "error",
-		})
-		return
-	}
-
-	// Save document metadata to database
-	document := &services.Document{
-		Filename:         objectName,
-		OriginalFilename: header.Filename,
-		FilePath:         objectName,
-		FileSize:         header.Size,
-		MimeType:         header.Header.Get("Content-Type"),
-		Status:           "uploaded",
-		FraudRiskLevel:   "low",
+		log.Fatalf("Failed to initialize database service: %v", err)
 	}
+	log.Println("Database service initialized successfully")
+	secrets.RecordRotations(dbService)
 
-	err = dbService.CreateDocument(document)
-	if err != nil {
-		log.Printf("Failed to save document to database: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  fmt.Sprintf("Failed to save document to database: %v", err),
-			"status": "error",
-		})
+	if *backupTenants != "" || *verifyBackup != "" || *restoreBackup != "" {
+		backups := services.NewBackupService(dbService, storage, config.GetBackupConfig().Dir)
+		runBackupCommand(backups, *backupTenants, *verifyBackup, *restoreBackup)
 		return
 	}
-	log.Printf("Document saved to database with ID: %s", document.ID)
 
-	// Extract text from document for analysis
-	extractedText, err := extractTextFromFile(file, header.Header.Get("Content-Type"))
-	if err != nil {
-		log.Printf("Failed to extract text from document: %v", err)
-		extractedText = "Text extraction failed"
-	}
-
-	// Trigger fraud analysis in background
-	go func() {
-		err := analyzeDocumentForFraud(document.ID, extractedText)
-		if err != nil {
-			log.Printf("Fraud analysis failed for document %s: %v", document.ID, err)
+	if *demoMode {
+		if err := demo.Seed(dbService, storage.Default()); err != nil {
+			log.Fatalf("Failed to seed demo data: %v", err)
 		}
-	}()
-
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "File uploaded successfully",
-		"file_id":   document.ID,
-		"file_name": header.Filename,
-		"file_size": header.Size,
-		"file_url":  minioService.GetFileURL(objectName),
-		"status":    "success",
-	})
-}
-
-func getDocuments(c *gin.Context) {
-	// Get pagination parameters
-	limitStr := c.DefaultQuery("limit", "10")
-	offsetStr := c.DefaultQuery("offset", "0")
-
-	limit, err := strconv.Atoi(limitStr)
-	if err != nil {
-		limit = 10
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
+	aiConfig := config.GetAIConfig()
+	aiService, err := services.NewAIService(aiConfig, secrets)
 	if err != nil {
-		offset = 0
+		log.Fatalf("Failed to configure the AI service client: %v", err)
 	}
-
-	// Get documents from database
-	documents, err := dbService.GetDocuments(limit, offset)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to retrieve documents",
-			"status": "error",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"documents": documents,
-		"total":     len(documents),
-		"status":    "success",
-	})
-}
-
-func getDocument(c *gin.Context) {
-	documentID := c.Param("id")
-
-	document, err := dbService.GetDocument(documentID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":  "Document not found",
-			"status": "error",
-		})
-		return
+	if !strings.HasPrefix(aiConfig.BaseURL, "https://") {
+		log.Printf("Warning: AI service %s is called without TLS; document text is sent in cleartext", aiConfig.BaseURL)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"document": document,
-		"status":   "success",
-	})
-}
-
-func deleteDocument(c *gin.Context) {
-	// TODO: Implement delete document
-	documentID := c.Param("id")
-	c.JSON(http.StatusOK, gin.H{
-		"message":     "Document deleted",
-		"document_id": documentID,
-		"status":      "success",
-	})
-}
-
-// Fraud detection handlers
-func analyzeDocument(c *gin.Context) {
-	var request struct {
-		FileID string `json:"file_id" binding:"required"`
+	if aiConfig.Token == "" && aiConfig.CertFile == "" {
+		log.Println("Warning: neither AI_SERVICE_TOKEN nor AI_SERVICE_CERT_FILE is set; AI service requests are unauthenticated")
 	}
-
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Invalid request format",
-			"status": "error",
-		})
-		return
+	var ai services.AIClient = aiService
+	if replayConfig := config.GetAIReplayConfig(); replayConfig.Mode != services.AIReplayOff {
+		if ai, err = services.NewReplayAIClient(replayConfig, aiService); err != nil {
+			log.Fatalf("Failed to configure AI replay: %v", err)
+		}
+		log.Printf("AI replay mode %s with recordings in %s", replayConfig.Mode, replayConfig.Dir)
 	}
-
-	// Get document from database
-	document, err := dbService.GetDocument(request.FileID)
+	analyzerConfig := config.GetAnalyzerConfig()
+	analyzers, err := services.NewAnalyzerSet(analyzerConfig, ai)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":  "Document not found",
-			"status": "error",
-		})
-		return
+		log.Fatalf("Failed to configure fraud analyzers: %v", err)
 	}
 
-	// Use the extracted text for analysis
-	var text string
-	if document.ExtractedText != nil {
-		text = *document.ExtractedText
-	} else {
-		text = "No text extracted from document"
+	var canary *services.Canary
+	if canaryConfig := config.GetCanaryConfig(); canaryConfig.URL != "" {
+		canaryAIConfig := aiConfig
+		canaryAIConfig.BaseURL = canaryConfig.URL
+		canaryAIConfig.Token = canaryConfig.Token
+		canaryAI, err := services.NewAIService(canaryAIConfig, secrets)
+		if err != nil {
+			log.Fatalf("Failed to configure the canary AI service client: %v", err)
+		}
+		if canary, err = services.NewCanary(canaryConfig, canaryAI); err != nil {
+			log.Fatalf("Failed to configure canary analysis: %v", err)
+		}
+		log.Printf("Comparing %.1f%% of analyses with canary AI service %s (model %s)",
+			canaryConfig.Percent, canaryConfig.URL, canaryConfig.ModelVersion)
 	}
 
-	// Call AI service for fraud analysis
-	// Send text as query parameter instead of JSON body
-	url := fmt.Sprintf("http://localhost:8001/analyze-text?text=%s", url.QueryEscape(text))
-
-	// Call AI service
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to create request",
-			"status": "error",
-		})
-		return
+	var batcher *services.BatchCoordinator
+	if analyzerConfig.BatchSize > 1 {
+		batcher = services.NewBatchCoordinator(analyzerConfig.BatchSize, analyzerConfig.BatchWait, analyzerConfig.BatchConcurrency)
+		go batcher.Run(context.Background())
 	}
-	req.Header.Set("Authorization", "Bearer test-token")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	urlReputation, err := services.NewURLReputation(config.GetURLReputationConfig())
 	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":  "AI service unavailable",
-			"status": "error",
-		})
-		return
+		log.Fatalf("Failed to configure URL reputation checks: %v", err)
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	geoConfig := config.GetGeoIPConfig()
+	geoIP, err := services.NewGeoIP(geoConfig.File)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to read AI service response",
-			"status": "error",
-		})
-		return
+		log.Fatalf("Failed to load GeoIP networks: %v", err)
 	}
-
-	// Parse response
-	var aiResponse map[string]interface{}
-	if err := json.Unmarshal(body, &aiResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to parse AI service response",
-			"status": "error",
-		})
-		return
+	if geoConfig.File != "" {
+		log.Printf("Loaded %d GeoIP networks", geoIP.Networks())
 	}
 
-	// Extract fraud score and risk level
-	fraudScore, ok := aiResponse["fraud_score"].(float64)
-	if !ok {
-		fraudScore = 0.0
+	i18nConfig := config.GetI18nConfig()
+	translations, err := services.NewTranslations(i18nConfig.BundlesDir, i18nConfig.DefaultLanguage)
+	if err != nil {
+		log.Fatalf("Failed to load translation bundles: %v", err)
 	}
-
-	riskLevel, ok := aiResponse["fraud_risk_level"].(string)
-	if !ok {
-		riskLevel = "unknown"
+	if i18nConfig.BundlesDir != "" {
+		log.Printf("Messages available in: %s", strings.Join(translations.Languages(), ", "))
 	}
 
-	// Update document in database with fraud analysis results
-	err = dbService.UpdateDocumentFraudAnalysis(request.FileID, fraudScore, riskLevel, text, "", "")
+	pipelines, err := services.NewPipelineSet(config.GetPipelineConfig())
 	if err != nil {
-		log.Printf("Failed to update document with fraud analysis: %v", err)
+		log.Fatalf("Failed to configure processing pipelines: %v", err)
+	}
+	if types := pipelines.DocumentTypes(); len(types) > 0 {
+		log.Printf("Processing pipelines configured for document types: %s", strings.Join(types, ", "))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"fraud_score":   fraudScore,
-		"risk_level":    riskLevel,
-		"patterns":      aiResponse["patterns"],
-		"confidence":    aiResponse["confidence"],
-		"status":        "success",
-		"document_id":   request.FileID,
-		"analysis_time": aiResponse["processing_time"],
-	})
-}
-
-func getFraudPatterns(c *gin.Context) {
-	// TODO: Implement get fraud patterns
-	patterns := []gin.H{
-		{
-			"id":          "signature_forgery",
-			"name":        "Signature Forgery",
-			"description": "Detects potentially forged signatures",
-			"severity":    "high",
-		},
-		{
-			"id":          "amount_tampering",
-			"name":        "Amount Tampering",
-			"description": "Detects altered monetary amounts",
-			"severity":    "critical",
-		},
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"patterns": patterns,
-		"total":    len(patterns),
-		"status":   "success",
-	})
-}
-
-func getFraudReports(c *gin.Context) {
-	// TODO: Implement get fraud reports
-	c.JSON(http.StatusOK, gin.H{
-		"reports": []gin.H{},
-		"total":   0,
-		"status":  "success",
-	})
-}
-
-// User handlers
-func registerUser(c *gin.Context) {
-	// TODO: Implement user registration
-	c.JSON(http.StatusOK, gin.H{
-		"message": "User registration endpoint - TODO: implement",
-		"status":  "success",
-	})
-}
-
-func loginUser(c *gin.Context) {
-	// TODO: Implement user login
-	c.JSON(http.StatusOK, gin.H{
-		"message": "User login endpoint - TODO: implement",
-		"status":  "success",
-	})
-}
-
-func getUserProfile(c *gin.Context) {
-	// TODO: Implement get user profile
-	c.JSON(http.StatusOK, gin.H{
-		"message": "User profile endpoint - TODO: implement",
-		"status":  "success",
-	})
-}
-
-// Helper function to extract text from uploaded file
-func extractTextFromFile(file io.Reader, contentType string) (string, error) {
-	// For now, handle text files only
-	if contentType == "text/plain" {
-		var buf bytes.Buffer
-		_, err := buf.ReadFrom(file)
-		if err != nil {
-			return "", err
-		}
-		return buf.String(), nil
+	lifecycle := config.GetLifecycleConfig()
+	if lifecycle.ArchiveAfter > 0 && !storage.HasArchive() {
+		log.Fatalf("STORAGE_ARCHIVE_AFTER_DAYS requires STORAGE_ARCHIVE_BUCKET")
 	}
 
-	// For other file types, return placeholder text
-	return "Document content extraction not implemented for " + contentType, nil
-}
+	leader := services.NewLeaderElector(dbService, config.GetLeaderConfig().ElectionInterval)
 
-// Fraud analysis function that calls AI service
-func analyzeDocumentForFraud(documentID, text string) error {
-	// Send text as query parameter instead of JSON body
-	url := fmt.Sprintf("http://localhost:8001/analyze-text?text=%s", url.QueryEscape(text))
+	webhooks := services.NewWebhooks(config.GetWebhookConfig())
 
-	// Call AI service
-	req, err := http.NewRequest("POST", url, nil)
+	// Anonymized exports are keyed by a secret so their tokens cannot be
+	// reversed by hashing guesses
+	adminConfig := config.GetAdminConfig()
+	anonymizationKey, err := secrets.Resolve(ctx, adminConfig.AnonymizationKey)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		log.Fatalf("Failed to resolve ANONYMIZATION_KEY: %v", err)
 	}
-	req.Header.Set("Authorization", "Bearer test-token")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	graphConfig := config.GetGraphConfig()
+	neo4jPassword, err := secrets.Resolve(ctx, graphConfig.Neo4jPassword)
 	if err != nil {
-		return fmt.Errorf("failed to call AI service: %v", err)
-	}
-	defer resp.Body.Close()
+		log.Fatalf("Failed to resolve NEO4J_PASSWORD: %v", err)
+	}
+	graph := services.NewNeo4j(graphConfig, neo4jPassword)
+
+	httpConfig := config.GetServerConfig()
+	proxyConfig := config.GetProxyConfig()
+	spooler := services.NewSpooler(config.GetPayloadConfig())
+	server := api.NewServer(api.Dependencies{
+		Store:          dbService,
+		Storage:        storage.Default(),
+		StorageRegions: storage,
+		AI:             ai,
+		Analyzers:      analyzers,
+		Canary:         canary,
+		Batcher:        batcher,
+		Extractors:     services.DefaultExtractorRegistry(config.GetExtractionConfig(), ai, spooler),
+		Spooler:        spooler,
+		Exemplars:      config.GetExemplarConfig(),
+		URLReputation:  urlReputation,
+		GeoIP:          geoIP,
+		Geo:            geoConfig,
+		Pipelines:      pipelines,
+		Leader:         leader,
+		Lifecycle:      lifecycle,
+		HTTP:           httpConfig,
+		Security:       config.GetSecurityConfig(),
+		API:            config.GetAPIConfig(),
+		Proxy:          proxyConfig,
+		Webhooks:       webhooks,
+		Graph:          graph,
+		Pseudonymizer:  services.NewPseudonymizer(anonymizationKey),
+		Watermark:      config.GetWatermarkConfig(),
+		Translations:   translations,
+
+		AdminToken: adminConfig.Token,
+	})
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read AI service response: %v", err)
-	}
+	// Every replica applies the log levels changed through the admin API
+	go server.RunLogLevelSync(ctx)
 
-	// Parse response
-	var analysisResult map[string]interface{}
-	if err := json.Unmarshal(body, &analysisResult); err != nil {
-		return fmt.Errorf("failed to parse AI service response: %v", err)
-	}
+	workerStopped := make(chan struct{})
+	go func() {
+		server.RunPipelineWorker(ctx)
+		close(workerStopped)
+	}()
 
-	// Extract fraud score and risk level
-	fraudScore, ok := analysisResult["fraud_score"].(float64)
-	if !ok {
-		fraudScore = 0.0
+	// Tasks that scan or change shared data run on one replica at a time
+	if lifecycle.ArchiveAfter > 0 {
+		leader.Register("storage_lifecycle", server.RunStorageLifecycle)
 	}
 
-	riskLevel, ok := analysisResult["fraud_risk_level"].(string)
-	if !ok {
-		riskLevel = "unknown"
+	if reconcile := config.GetReconcileConfig(); reconcile.Interval > 0 {
+		leader.Register("bucket_reconciler", func(ctx context.Context) {
+			server.RunBucketReconciler(ctx, reconcile)
+		})
 	}
 
-	// Extract emotion analysis data
-	emotionAnalysis, err := json.Marshal(analysisResult["emotion_analysis"])
-	if err != nil {
-		emotionAnalysis = []byte("{}")
+	if analyzers.HasFallback() {
+		leader.Register("fallback_rescorer", func(ctx context.Context) {
+			server.RunFallbackRescorer(ctx, analyzerConfig.RescoreInterval)
+		})
 	}
 
-	// Extract pattern analysis data
-	patternAnalysis, err := json.Marshal(analysisResult["pattern_analysis"])
-	if err != nil {
-		patternAnalysis = []byte("{}")
+	if partitions := config.GetPartitionConfig(); partitions.Interval > 0 {
+		leader.Register("document_partitions", func(ctx context.Context) {
+			server.RunPartitionMaintenance(ctx, partitions)
+		})
 	}
 
-	// Update document in database with fraud analysis results
-	err = dbService.UpdateDocumentFraudAnalysis(documentID, fraudScore, riskLevel, text, string(emotionAnalysis), string(patternAnalysis))
-	if err != nil {
-		return fmt.Errorf("failed to update document with fraud analysis: %v", err)
+	if analyzers.CacheTTL() > 0 {
+		leader.Register("analysis_cache_purge", func(ctx context.Context) {
+			server.RunAnalysisCachePurge(ctx, analysisCachePurgeInterval)
+		})
 	}
 
-	log.Printf("Fraud analysis completed for document %s: score=%.3f, risk=%s", documentID, fraudScore, riskLevel)
-	return nil
-}
-
-// Document Question Answering handlers
-func askDocument(c *gin.Context) {
-	var request struct {
-		Question     string `json:"question" binding:"required"`
-		DocumentText string `json:"document_text" binding:"required"`
+	if drift := config.GetDriftConfig(); drift.Interval > 0 {
+		leader.Register("model_drift", server.RunModelDriftMonitor)
 	}
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Invalid request format",
-			"status": "error",
+	if changeFeed := config.GetChangeFeedConfig(); changeFeed.Retention > 0 {
+		leader.Register("change_feed_purge", func(ctx context.Context) {
+			server.RunChangeFeedPurge(ctx, changeFeedPurgeInterval, changeFeed.Retention)
 		})
-		return
 	}
 
-	// Call AI service for document question answering
-	formData := fmt.Sprintf("question=%s&document_text=%s",
-		request.Question,
-		request.DocumentText)
-
-	// Call AI service
-	req, err := http.NewRequest("POST", "http://localhost:8001/ask-document", bytes.NewBufferString(formData))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to create request",
-			"status": "error",
+	if deletion := config.GetDeletionConfig(); deletion.PurgeInterval > 0 {
+		leader.Register("deleted_document_purge", func(ctx context.Context) {
+			server.RunDeletedDocumentPurge(ctx, deletion)
 		})
-		return
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "Bearer test-token")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":  "AI service unavailable",
-			"status": "error",
+	if escalation := config.GetEscalationConfig(); escalation.Interval > 0 {
+		leader.Register("alert_escalation", func(ctx context.Context) {
+			server.RunAlertEscalation(ctx, escalation.Interval)
 		})
-		return
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to read AI service response",
-			"status": "error",
-		})
-		return
+	if webhooks.Enabled() {
+		leader.Register("webhook_delivery", server.RunWebhookDelivery)
 	}
 
-	// Parse and return response
-	var aiResponse map[string]interface{}
-	if err := json.Unmarshal(body, &aiResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to parse AI service response",
-			"status": "error",
-		})
-		return
+	if graph.Enabled() {
+		leader.Register("graph_sync", server.RunGraphSync)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"question":   aiResponse["question"],
-		"answer":     aiResponse["answer"],
-		"confidence": aiResponse["confidence"],
-		"model_used": aiResponse["model_used"],
-		"timestamp":  aiResponse["timestamp"],
-		"status":     "success",
-	})
-}
+	leader.PauseWhile(server.InMaintenance)
 
-func analyzeDocumentFraud(c *gin.Context) {
-	var request struct {
-		DocumentText string `json:"document_text" binding:"required"`
-	}
+	leaderStopped := make(chan struct{})
+	go func() {
+		leader.Run(ctx)
+		close(leaderStopped)
+	}()
 
-	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Invalid request format",
-			"status": "error",
-		})
-		return
+	if secretsConfig.WatchInterval > 0 {
+		go secrets.Watch(context.Background(), secretsConfig.WatchInterval)
+	}
+
+	// Initialize Gin router; the access log is written at the http
+	// component's info level
+	r := gin.New()
+	r.Use(gin.LoggerWithWriter(logging.HTTP.Writer(logging.LevelInfo, gin.DefaultWriter)), gin.Recovery())
+
+	// Client addresses in the access log come from forwarding headers only
+	// when a trusted proxy sent them; gin trusts every peer by default
+	if err := r.SetTrustedProxies(proxyConfig.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	r.RemoteIPHeaders = proxyConfig.ClientIPHeaders
+
+	// CORS middleware; an empty origin list only serves same-origin clients
+	if corsSettings := config.GetCORSConfig(); len(corsSettings.AllowOrigins) > 0 {
+		corsConfig := cors.DefaultConfig()
+		corsConfig.AllowOrigins = corsSettings.AllowOrigins
+		corsConfig.AllowWildcard = true
+		corsConfig.AllowMethods = corsSettings.AllowMethods
+		corsConfig.AllowHeaders = corsSettings.AllowHeaders
+		corsConfig.AllowCredentials = corsSettings.AllowCredentials
+		corsConfig.ExposeHeaders = corsSettings.ExposeHeaders
+		corsConfig.MaxAge = corsSettings.MaxAge
+		if err := corsConfig.Validate(); err != nil {
+			log.Fatalf("Invalid CORS configuration: %v", err)
+		}
+		r.Use(cors.New(corsConfig))
 	}
 
-	// Call AI service for fraud analysis using QA
-	formData := fmt.Sprintf("document_text=%s", request.DocumentText)
+	// Routes
+	server.Routes(r)
 
-	// Call AI service
-	req, err := http.NewRequest("POST", "http://localhost:8001/analyze-document-fraud", bytes.NewBufferString(formData))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to create request",
-			"status": "error",
-		})
-		return
+	// Header and idle timeouts stop clients that open connections and send
+	// nothing, or trickle their headers, from exhausting the server; request
+	// bodies are limited per route by the API
+	httpServer := &http.Server{
+		Addr:              ":" + httpConfig.Port,
+		Handler:           r,
+		ReadHeaderTimeout: httpConfig.ReadHeaderTimeout,
+		IdleTimeout:       httpConfig.IdleTimeout,
+		MaxHeaderBytes:    httpConfig.MaxHeaderBytes,
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Authorization", "Bearer test-token")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":  "AI service unavailable",
-			"status": "error",
-		})
-		return
-	}
-	defer resp.Body.Close()
+	httpStopped := make(chan struct{})
+	go func() {
+		defer close(httpStopped)
+		<-ctx.Done()
+		log.Println("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), httpConfig.ShutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Failed to finish requests in flight: %v", err)
+		}
+	}()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to read AI service response",
-			"status": "error",
-		})
-		return
+	if err := listen(httpServer, config.GetTLSConfig()); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
 	}
+	<-httpStopped
+	<-workerStopped
+	<-leaderStopped
+	log.Println("FraudDocAI Backend stopped")
+}
 
-	// Parse and return response
-	var aiResponse map[string]interface{}
-	if err := json.Unmarshal(body, &aiResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to parse AI service response",
-			"status": "error",
-		})
-		return
+// validatePublicURLs checks the base URLs links are built on, so that a
+// mistyped one stops the backend rather than surfacing as broken links in
+// webhooks and downloads
+func validatePublicURLs(server config.ServerConfig, storage config.StorageConfig) error {
+	if err := config.ValidatePublicURL(server.PublicBaseURL); err != nil {
+		return fmt.Errorf("invalid PUBLIC_BASE_URL: %v", err)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"fraud_analysis":     aiResponse["fraud_analysis"],
-		"overall_risk":       aiResponse["overall_risk"],
-		"total_risk_score":   aiResponse["total_risk_score"],
-		"questions_analyzed": aiResponse["questions_analyzed"],
-		"model_used":         aiResponse["model_used"],
-		"timestamp":          aiResponse["timestamp"],
-		"status":             "success",
-	})
+	if storage.Default.PublicURL != "" {
+		if err := config.ValidatePublicURL(storage.Default.PublicURL); err != nil {
+			return fmt.Errorf("invalid STORAGE_PUBLIC_URL: %v", err)
+		}
+	}
+	for region, store := range storage.Regions {
+		if store.PublicURL == "" {
+			continue
+		}
+		if err := config.ValidatePublicURL(store.PublicURL); err != nil {
+			return fmt.Errorf("invalid public URL of storage region %s: %v", region, err)
+		}
+	}
+	return nil
 }
 
-func getQAModelInfo(c *gin.Context) {
-	// Call AI service for model info
-	req, err := http.NewRequest("GET", "http://localhost:8001/qa-model-info", nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to create request",
-			"status": "error",
-		})
-		return
-	}
-	req.Header.Set("Authorization", "Bearer test-token")
+// listen serves HTTPS when a certificate or autocert domains are
+// configured, and plain HTTP otherwise
+func listen(httpServer *http.Server, tlsConfig config.TLSConfig) error {
+	switch {
+	case len(tlsConfig.AutocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsConfig.AutocertDomains...),
+			Cache:      autocert.DirCache(tlsConfig.AutocertCacheDir),
+			Email:      tlsConfig.AutocertEmail,
+		}
+		httpServer.TLSConfig = manager.TLSConfig()
+		httpServer.TLSConfig.MinVersion = tls.VersionTLS12
+		if tlsConfig.AutocertHTTPAddr != "" {
+			go func() {
+				challenges := &http.Server{
+					Addr:              tlsConfig.AutocertHTTPAddr,
+					Handler:           manager.HTTPHandler(nil),
+					ReadHeaderTimeout: httpServer.ReadHeaderTimeout,
+				}
+				log.Fatal(challenges.ListenAndServe())
+			}()
+		}
+		log.Printf("Starting FraudDocAI Backend on %s with HTTPS for %v", httpServer.Addr, tlsConfig.AutocertDomains)
+		return httpServer.ListenAndServeTLS("", "")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"error":  "AI service unavailable",
-			"status": "error",
-		})
-		return
-	}
-	defer resp.Body.Close()
+	case tlsConfig.CertFile != "" || tlsConfig.KeyFile != "":
+		httpServer.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		log.Printf("Starting FraudDocAI Backend on %s with HTTPS", httpServer.Addr)
+		return httpServer.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to read AI service response",
-			"status": "error",
-		})
-		return
+	default:
+		log.Printf("Starting FraudDocAI Backend on %s", httpServer.Addr)
+		return httpServer.ListenAndServe()
 	}
+}
 
-	// Parse and return response
-	var aiResponse map[string]interface{}
-	if err := json.Unmarshal(body, &aiResponse); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Failed to parse AI service response",
-			"status": "error",
-		})
-		return
+// runBackupCommand runs the -backup, -verify-backup or -restore-backup
+// command line operation
+func runBackupCommand(backups *services.BackupService, tenants, verifyID, restoreID string) {
+	ctx := context.Background()
+	switch {
+	case tenants != "":
+		manifest, err := backups.Create(ctx, strings.Split(tenants, ","))
+		if err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+		log.Printf("Created backup %s: %d tables, %d files", manifest.ID, len(manifest.Tables), len(manifest.Objects))
+	case verifyID != "":
+		if _, err := backups.Verify(verifyID); err != nil {
+			log.Fatalf("Backup %s is not valid: %v", verifyID, err)
+		}
+		log.Printf("Backup %s matches its manifest", verifyID)
+	case restoreID != "":
+		restore, err := backups.Restore(ctx, restoreID)
+		if err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+		log.Printf("Restored backup %s: tenants %v, rows %v, %d files", restore.ID, restore.Tenants, restore.Rows, restore.Objects)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"model_available": aiResponse["model_available"],
-		"model_info":      aiResponse["model_info"],
-		"timestamp":       aiResponse["timestamp"],
-		"status":          "success",
-	})
 }
@@ -0,0 +1,287 @@
+package metrics
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// API metrics
+var (
+	APIRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_api_requests_total",
+		Help: "API requests by API version, method, route and response status",
+	}, []string{"version", "method", "route", "status"})
+)
+
+// Database metrics
+var (
+	DBRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_db_retries_total",
+		Help: "Database operations retried after a retryable Postgres error",
+	}, []string{"operation", "code"})
+
+	DBRetriesExhausted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_db_retries_exhausted_total",
+		Help: "Database operations that still failed after the final retry",
+	}, []string{"operation"})
+
+	CredentialRotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_credential_rotations_total",
+		Help: "Consumers switched to a rotated secret, by outcome",
+	}, []string{"consumer", "outcome"})
+)
+
+// Analyzer metrics
+var (
+	AnalyzerFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_analyzer_fallbacks_total",
+		Help: "Analyses served by the fallback analyzer because the primary provider was unavailable",
+	}, []string{"primary", "fallback"})
+
+	AnalyzerRescored = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frauddocai_analyzer_rescored_total",
+		Help: "Fallback analyses re-scored by the primary provider after it recovered",
+	})
+
+	AnalyzerBatchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "frauddocai_analyzer_batch_size",
+		Help:    "Number of texts sent to an analyzer in one batch",
+		Buckets: []float64{1, 2, 4, 8, 16, 32, 64, 100},
+	}, []string{"provider"})
+
+	AnalysisCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_analysis_cache_total",
+		Help: "Analysis cache lookups by result (hit, miss)",
+	}, []string{"result"})
+
+	CanaryComparisons = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_canary_comparisons_total",
+		Help: "Analyses sampled for the canary AI service by outcome (agreed, disagreed, failed, skipped)",
+	}, []string{"outcome"})
+)
+
+// Model drift metrics, set by the replica running the drift monitor
+var (
+	ModelDriftScorePSI = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "frauddocai_model_drift_score_psi",
+		Help: "Population stability index of a model version's recent fraud scores against its baseline",
+	}, []string{"provider", "model_version"})
+
+	ModelDriftConfidenceChange = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "frauddocai_model_drift_confidence_change",
+		Help: "Change of a model version's mean pattern confidence from its baseline",
+	}, []string{"provider", "model_version"})
+
+	ModelDriftDetectionRateChange = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "frauddocai_model_drift_detection_rate_change",
+		Help: "Change of the share of documents a model version found patterns in from its baseline",
+	}, []string{"provider", "model_version"})
+
+	ModelDrifted = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "frauddocai_model_drifted",
+		Help: "Whether a measure of a model version drifted beyond its threshold: 1 when it did, 0 otherwise",
+	}, []string{"provider", "model_version", "measure"})
+
+	ModelDriftAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_model_drift_alerts_total",
+		Help: "Alerts raised when a measure of a model version started drifting",
+	}, []string{"provider", "model_version", "measure"})
+)
+
+// AI service metrics
+var (
+	AIConcurrencyLimit = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "frauddocai_ai_concurrency_limit",
+		Help: "Current adaptive limit of AI service calls in flight",
+	})
+
+	AIRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "frauddocai_ai_requests_in_flight",
+		Help: "AI service calls in flight",
+	})
+
+	AIQueueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "frauddocai_ai_queue_wait_seconds",
+		Help:    "Time AI service calls waited for the concurrency limit",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+
+	AIRequestsShed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frauddocai_ai_requests_shed_total",
+		Help: "AI service calls refused because too many were waiting",
+	})
+
+	AIReplays = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_ai_replays_total",
+		Help: "AI responses recorded, or served from a recording (hit) or missing from the recordings (miss), by endpoint",
+	}, []string{"endpoint", "result"})
+)
+
+// Extraction metrics
+var (
+	ExtractionDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "frauddocai_extraction_duration_seconds",
+		Help:    "Time spent extracting document text, by extractor and outcome (success, error, timeout)",
+		Buckets: []float64{0.01, 0.05, 0.25, 1, 5, 15, 30, 60, 120},
+	}, []string{"extractor", "outcome"})
+)
+
+// Statement metrics
+var (
+	StatementAnalyses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_statement_analyses_total",
+		Help: "Bank statements analyzed against their account's earlier statements, by continuity (first, appended, next_period, gap, overlap, balance_mismatch, duplicate, unverified)",
+	}, []string{"continuity"})
+
+	StatementBytesSkipped = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frauddocai_statement_bytes_skipped_total",
+		Help: "Bytes of bank statement text not analyzed because earlier statements of the account had them",
+	})
+)
+
+// Payload memory metrics
+var (
+	PayloadMemoryBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "frauddocai_payload_memory_bytes",
+		Help: "Bytes of document payloads held in memory, out of PAYLOAD_MEMORY_BUDGET_BYTES",
+	})
+
+	PayloadSpills = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_payload_spills_total",
+		Help: "Payloads written to temporary files by reason (size, budget)",
+	}, []string{"reason"})
+
+	RequestPayloadMemoryPeak = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "frauddocai_request_payload_memory_peak_bytes",
+		Help:    "Most payload bytes a request held in memory at once, by route; background pipeline runs are reported as pipeline",
+		Buckets: prometheus.ExponentialBuckets(64<<10, 4, 8),
+	}, []string{"route"})
+)
+
+// Pipeline metrics
+var (
+	PipelineStageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "frauddocai_pipeline_stage_duration_seconds",
+		Help:    "Time spent in a processing pipeline stage, including retries, by stage and outcome (succeeded, failed)",
+		Buckets: []float64{0.01, 0.05, 0.25, 1, 5, 15, 30, 60, 120, 300},
+	}, []string{"stage", "outcome"})
+
+	PipelineStageRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_pipeline_stage_retries_total",
+		Help: "Pipeline stage attempts retried after failing, by stage",
+	}, []string{"stage"})
+
+	PipelineJobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_pipeline_jobs_total",
+		Help: "Pipeline jobs by event: claimed, reclaimed after their worker stopped, lease_lost to another worker, released at shutdown, or failed",
+	}, []string{"event"})
+
+	PipelineRecovered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_pipeline_recovered_total",
+		Help: "Pipelines recovered after their backend stopped, by source and whether they resumed from stored text or restarted",
+	}, []string{"source", "mode"})
+
+	PipelineStagesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_pipeline_stages_skipped_total",
+		Help: "Pipeline stages not run because the tenant skips them or a stage they depend on failed, by stage",
+	}, []string{"stage"})
+)
+
+// Leader election metrics
+var (
+	Leader = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "frauddocai_leader",
+		Help: "Whether this replica leads the singleton task: 1 when it does, 0 otherwise",
+	}, []string{"task"})
+
+	LeadershipChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_leadership_changes_total",
+		Help: "Leadership of singleton tasks acquired or released by this replica",
+	}, []string{"task", "change"})
+)
+
+// Storage metrics
+var (
+	StorageTierTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_storage_tier_transitions_total",
+		Help: "Document files moved between storage tiers, by the tier moved to (archived, hot)",
+	}, []string{"tier"})
+
+	BucketObjectsRegistered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_bucket_objects_registered_total",
+		Help: "Files written to a bucket without the upload API and registered as documents by the bucket scan, by region",
+	}, []string{"region"})
+
+	DocumentPartitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_document_partitions_total",
+		Help: "Monthly partitions of the documents table created ahead of time or expired by the retention period, by event (created, expired)",
+	}, []string{"event"})
+
+	ExpiredDocuments = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frauddocai_expired_documents_total",
+		Help: "Documents deleted, and their files released, because their partition expired",
+	})
+
+	DeletedDocuments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_deleted_documents_total",
+		Help: "Documents deleted through the API, and deleted documents purged after their retention, by stage (deleted, purged)",
+	}, []string{"stage"})
+
+	UploadChecksumFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_upload_checksum_failures_total",
+		Help: "Uploads rejected because a SHA-256 did not match, by the copy that differed (received, stored)",
+	}, []string{"copy"})
+)
+
+// Alert metrics
+var (
+	ExemplarAlerts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "frauddocai_exemplar_alerts_total",
+		Help: "Critical alerts raised because an upload matched a known-fraud exemplar",
+	})
+)
+
+// Webhook metrics
+var (
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_webhook_deliveries_total",
+		Help: "Webhook delivery attempts, by event type and result (delivered, retried, failed)",
+	}, []string{"event", "result"})
+)
+
+// Escalation metrics
+var (
+	AlertEscalations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "frauddocai_alert_escalations_total",
+		Help: "Alerts moved up their tenant's escalation chain, by step level",
+	}, []string{"level"})
+)
+
+// dbStats holds the pool collector registered for each database name
+var (
+	dbStatsMu sync.Mutex
+	dbStats   = map[string]prometheus.Collector{}
+)
+
+// RegisterDBStats exposes sql.DBStats for the connection pool. A pool
+// registered under the name of an earlier one, after the earlier pool was
+// replaced, takes over its metrics.
+func RegisterDBStats(db *sql.DB, dbName string) {
+	dbStatsMu.Lock()
+	defer dbStatsMu.Unlock()
+
+	if previous, ok := dbStats[dbName]; ok {
+		prometheus.Unregister(previous)
+	}
+	collector := collectors.NewDBStatsCollector(db, dbName)
+	if err := prometheus.Register(collector); err != nil {
+		log.Printf("Failed to register database pool metrics: %v", err)
+		return
+	}
+	dbStats[dbName] = collector
+}
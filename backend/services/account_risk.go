@@ -0,0 +1,182 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AccountKey names an account a document is related to
+type AccountKey struct {
+	Kind       string
+	Identifier string
+}
+
+// maxAccountIdentifier is the length of the accounts.identifier column
+const maxAccountIdentifier = 64
+
+// DocumentAccounts returns the accounts a document is related to: the bank
+// account of a bank statement or of its account_number metadata, and the
+// customer account of its customer_id metadata
+func DocumentAccounts(document *Document, text string) []AccountKey {
+	var keys []AccountKey
+	bank := StatementAccountIdentifier(document, text)
+	if number, ok := document.Metadata["account_number"].(string); ok && bank == "" {
+		bank = digitsAndLetters(number)
+	}
+	if bank != "" && len(bank) <= maxAccountIdentifier {
+		keys = append(keys, AccountKey{Kind: AccountKindBank, Identifier: bank})
+	}
+	if customer, ok := document.Metadata["customer_id"].(string); ok {
+		customer = strings.TrimSpace(customer)
+		if customer != "" && len(customer) <= maxAccountIdentifier {
+			keys = append(keys, AccountKey{Kind: AccountKindCustomer, Identifier: customer})
+		}
+	}
+	return keys
+}
+
+// AccountEvidence is the finding of a document on its account: the score
+// and level it was analyzed with and the fraud patterns it matched.
+// ObservedAt, when the document was uploaded, dates it for decay; Weight
+// and Contribution are its share of the account's risk at the time it is
+// read.
+type AccountEvidence struct {
+	AccountID    string     `json:"account_id"`
+	DocumentID   DocumentID `json:"document_id"`
+	Filename     string     `json:"filename"`
+	DocumentType *string    `json:"document_type"`
+	FraudScore   float64    `json:"fraud_score"`
+	RiskLevel    string     `json:"risk_level"`
+	PatternCount int        `json:"pattern_count"`
+	ObservedAt   time.Time  `json:"observed_at"`
+	AnalyzedAt   time.Time  `json:"analyzed_at"`
+	Weight       float64    `json:"weight"`
+	Contribution float64    `json:"contribution"`
+}
+
+// AccountRisk weighs the evidence of an account as of now, halving the
+// weight of a document every halfLife since it was observed, and returns
+// the account's risk: the chance that at least one of its documents is
+// fraudulent, taking each weighted score as an independent chance. A
+// halfLife of 0 keeps every document at full weight. The evidence is
+// sorted by contribution, largest first.
+func AccountRisk(evidence []*AccountEvidence, halfLife time.Duration, now time.Time) float64 {
+	none := 1.0
+	for _, e := range evidence {
+		e.Weight = 1
+		if age := now.Sub(e.ObservedAt); halfLife > 0 && age > 0 {
+			e.Weight = math.Pow(0.5, float64(age)/float64(halfLife))
+		}
+		e.Contribution = e.Weight * math.Min(math.Max(e.FraudScore, 0), 1)
+		none *= 1 - e.Contribution
+	}
+	sort.SliceStable(evidence, func(i, j int) bool { return evidence[i].Contribution > evidence[j].Contribution })
+	return 1 - none
+}
+
+const accountEvidenceColumns = `e.account_id, e.document_id, d.original_filename, d.document_type, e.fraud_score,
+	e.risk_level, e.pattern_count, e.observed_at, e.analyzed_at`
+
+// RecordAccountEvidence stores the finding of a document on an account, in
+// place of any earlier finding of the same document, and gathers the
+// account's evidence into its risk as of now
+func (d *DatabaseService) RecordAccountEvidence(evidence *AccountEvidence, halfLife time.Duration) error {
+	return withRetry("record_account_evidence", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`
+			INSERT INTO account_documents (account_id, document_id, fraud_score, risk_level, pattern_count, observed_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (account_id, document_id) DO UPDATE SET fraud_score = excluded.fraud_score,
+				risk_level = excluded.risk_level, pattern_count = excluded.pattern_count,
+				observed_at = excluded.observed_at, analyzed_at = CURRENT_TIMESTAMP`,
+			evidence.AccountID, evidence.DocumentID, evidence.FraudScore, evidence.RiskLevel,
+			evidence.PatternCount, evidence.ObservedAt)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(`SELECT fraud_score, pattern_count, observed_at FROM account_documents WHERE account_id = $1`,
+			evidence.AccountID)
+		if err != nil {
+			return err
+		}
+		var all []*AccountEvidence
+		findings := 0
+		for rows.Next() {
+			e := &AccountEvidence{}
+			if err := rows.Scan(&e.FraudScore, &e.PatternCount, &e.ObservedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			findings += e.PatternCount
+			all = append(all, e)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+			UPDATE accounts SET documents = $2, risk_score = $3, findings = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`, evidence.AccountID, len(all), AccountRisk(all, halfLife, time.Now()), findings)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// ListAccountEvidence returns the findings of the documents of an account,
+// latest first
+func (d *DatabaseService) ListAccountEvidence(accountID string) ([]*AccountEvidence, error) {
+	rows, err := d.db.Query(`
+		SELECT `+accountEvidenceColumns+`
+		FROM account_documents e JOIN documents d ON d.id = e.document_id
+		WHERE e.account_id = $1 AND d.deleted_at IS NULL
+		ORDER BY e.observed_at DESC, e.document_id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account evidence: %v", err)
+	}
+	defer rows.Close()
+
+	evidence := []*AccountEvidence{}
+	for rows.Next() {
+		e := &AccountEvidence{}
+		if err := rows.Scan(&e.AccountID, &e.DocumentID, &e.Filename, &e.DocumentType, &e.FraudScore,
+			&e.RiskLevel, &e.PatternCount, &e.ObservedAt, &e.AnalyzedAt); err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+	return evidence, rows.Err()
+}
+
+// ListDocumentAccounts returns the accounts a document added evidence to
+func (d *DatabaseService) ListDocumentAccounts(documentID DocumentID) ([]*Account, error) {
+	rows, err := d.db.Query(`
+		SELECT `+accountColumns+` FROM accounts
+		WHERE id IN (SELECT account_id FROM account_documents WHERE document_id = $1)
+		ORDER BY kind, identifier`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document accounts: %v", err)
+	}
+	defer rows.Close()
+
+	accounts := []*Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of account
+const (
+	// AccountKindBank is a bank account, which statements are for and other
+	// documents name in their account_number metadata
+	AccountKindBank = "bank"
+	// AccountKindCustomer is a customer account, which documents name in
+	// their customer_id metadata
+	AccountKindCustomer = "customer"
+)
+
+// Continuity of a statement with the statement of its account before it
+const (
+	// StatementFirst is the first statement of its account
+	StatementFirst = "first"
+	// StatementAppended repeats the previous statement and adds to it, as
+	// statements reissued to date do
+	StatementAppended = "appended"
+	// StatementNextPeriod starts where the previous statement ended, by its
+	// period or its opening balance
+	StatementNextPeriod = "next_period"
+	// StatementGap starts after the day following the previous statement's
+	// period, leaving days no statement covers
+	StatementGap = "gap"
+	// StatementOverlap starts before the previous statement's period ended
+	// without repeating it
+	StatementOverlap = "overlap"
+	// StatementBalanceMismatch opens with a balance other than the previous
+	// statement's closing balance
+	StatementBalanceMismatch = "balance_mismatch"
+	// StatementDuplicate has nothing its account's statements did not have
+	StatementDuplicate = "duplicate"
+	// StatementUnverified has new content but neither a period nor balances
+	// to place it after the previous statement
+	StatementUnverified = "unverified"
+)
+
+// Account is a bank or customer account known from the documents related
+// to it. Statements counts the bank statements filed under it and Documents
+// every document whose findings it gathered; RiskScore is the decayed
+// score of those findings as of UpdatedAt, and Findings the fraud patterns
+// they matched.
+type Account struct {
+	ID             string      `json:"id"`
+	TenantID       *string     `json:"tenant_id"`
+	Kind           string      `json:"kind"`
+	Identifier     string      `json:"identifier"`
+	Statements     int         `json:"statements"`
+	Documents      int         `json:"documents"`
+	LastDocumentID *DocumentID `json:"last_document_id"`
+	RiskScore      *float64    `json:"risk_score"`
+	Findings       int         `json:"findings"`
+	CreatedAt      time.Time   `json:"created_at"`
+	UpdatedAt      time.Time   `json:"updated_at"`
+}
+
+// AccountStatement is a statement of an account: how it continues the
+// statement before it, and how many of its segments were new and analyzed.
+// FraudScore and PatternCount are those of its new content, and are unset
+// for duplicates.
+type AccountStatement struct {
+	DocumentID         DocumentID  `json:"document_id"`
+	AccountID          string      `json:"account_id"`
+	PreviousDocumentID *DocumentID `json:"previous_document_id"`
+	Continuity         string      `json:"continuity"`
+	Segments           int         `json:"segments"`
+	NewSegments        int         `json:"new_segments"`
+	AnalyzedBytes      int         `json:"analyzed_bytes"`
+	PeriodStart        *string     `json:"period_start"`
+	PeriodEnd          *string     `json:"period_end"`
+	OpeningAmount      *float64    `json:"opening_amount"`
+	ClosingAmount      *float64    `json:"closing_amount"`
+	FraudScore         *float64    `json:"fraud_score"`
+	PatternCount       int         `json:"pattern_count"`
+	CreatedAt          time.Time   `json:"created_at"`
+}
+
+// NewAccountStatement returns the statement of document, with its period
+// and balances taken from the bank_statement metadata
+func NewAccountStatement(document *Document, accountID string) *AccountStatement {
+	return &AccountStatement{
+		DocumentID:    document.ID,
+		AccountID:     accountID,
+		PeriodStart:   metadataDate(document.Metadata, "period_start"),
+		PeriodEnd:     metadataDate(document.Metadata, "period_end"),
+		OpeningAmount: metadataNumber(document.Metadata, "opening_amount"),
+		ClosingAmount: metadataNumber(document.Metadata, "closing_amount"),
+	}
+}
+
+func metadataDate(metadata Metadata, key string) *string {
+	value, ok := metadata[key].(string)
+	if _, err := time.Parse("2006-01-02", value); !ok || err != nil {
+		return nil
+	}
+	return &value
+}
+
+func metadataNumber(metadata Metadata, key string) *float64 {
+	value, ok := metadata[key].(float64)
+	if !ok {
+		return nil
+	}
+	return &value
+}
+
+// StatementAccountIdentifier returns the normalized number of the bank
+// account a bank statement is for: its account_number metadata, or else the
+// only IBAN in its text. It is empty for other documents and when the
+// account cannot be told.
+func StatementAccountIdentifier(document *Document, text string) string {
+	if document.DocumentType == nil || *document.DocumentType != "bank_statement" {
+		return ""
+	}
+	if number, ok := document.Metadata["account_number"].(string); ok {
+		if identifier := digitsAndLetters(number); identifier != "" {
+			return identifier
+		}
+	}
+
+	var ibans []string
+	for _, entity := range ExtractEntities(text) {
+		if kind, value, _ := ParseEntity(entity); kind == "iban" {
+			ibans = append(ibans, value)
+		}
+	}
+	if len(ibans) != 1 {
+		return ""
+	}
+	return ibans[0]
+}
+
+// StatementSegment is a page or paragraph of a statement's text, located by
+// byte offsets, with the digest of its text
+type StatementSegment struct {
+	Digest string
+	Start  int
+	End    int
+}
+
+var paragraphBreak = regexp.MustCompile(`\n[ \t\r\f]*\n|\f`)
+
+// StatementSegments splits text into its pages, when they are known, or
+// else its paragraphs. Digests ignore differences of whitespace; blank
+// segments are left out.
+func StatementSegments(text string, pages []*DocumentPage) []StatementSegment {
+	var bounds [][2]int
+	if len(pages) > 0 {
+		for _, page := range pages {
+			if page.TextStart >= 0 && page.TextStart <= page.TextEnd && page.TextEnd <= len(text) {
+				bounds = append(bounds, [2]int{page.TextStart, page.TextEnd})
+			}
+		}
+	} else {
+		start := 0
+		for _, brk := range paragraphBreak.FindAllStringIndex(text, -1) {
+			bounds = append(bounds, [2]int{start, brk[0]})
+			start = brk[1]
+		}
+		bounds = append(bounds, [2]int{start, len(text)})
+	}
+
+	segments := []StatementSegment{}
+	for _, b := range bounds {
+		normalized := strings.Join(strings.Fields(text[b[0]:b[1]]), " ")
+		if normalized == "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(normalized))
+		segments = append(segments, StatementSegment{Digest: hex.EncodeToString(sum[:]), Start: b[0], End: b[1]})
+	}
+	return segments
+}
+
+// NewStatementContent returns the text of the segments neither in seen nor
+// earlier in the statement, joined by blank lines, and how many they are.
+// appended reports whether every seen segment comes before the first new
+// one, as in a statement that repeats an earlier one and adds to it.
+func NewStatementContent(text string, segments []StatementSegment, seen map[string]DocumentID) (content string, count int, appended bool) {
+	var parts []string
+	inStatement := map[string]bool{}
+	appended = true
+	for _, segment := range segments {
+		if _, ok := seen[segment.Digest]; ok {
+			if len(parts) > 0 {
+				appended = false
+			}
+			continue
+		}
+		if inStatement[segment.Digest] {
+			continue
+		}
+		inStatement[segment.Digest] = true
+		parts = append(parts, strings.TrimSpace(text[segment.Start:segment.End]))
+	}
+	return strings.Join(parts, "\n\n"), len(parts), appended
+}
+
+// StatementContinuity tells how statement continues previous, the statement
+// of its account before it; repeated is how many of its segments previous
+// or earlier statements had, and appended is from NewStatementContent
+func StatementContinuity(statement, previous *AccountStatement, repeated int, appended bool) string {
+	switch {
+	case previous == nil:
+		return StatementFirst
+	case statement.NewSegments == 0:
+		return StatementDuplicate
+	case appended && repeated >= previous.Segments:
+		return StatementAppended
+	}
+
+	if statement.OpeningAmount != nil && previous.ClosingAmount != nil &&
+		math.Abs(*statement.OpeningAmount-*previous.ClosingAmount) >= 0.005 {
+		return StatementBalanceMismatch
+	}
+	if statement.PeriodStart != nil && previous.PeriodEnd != nil {
+		start, _ := time.Parse("2006-01-02", *statement.PeriodStart)
+		end, _ := time.Parse("2006-01-02", *previous.PeriodEnd)
+		switch {
+		case start.After(end.AddDate(0, 0, 1)):
+			return StatementGap
+		case start.Before(end):
+			return StatementOverlap
+		}
+		return StatementNextPeriod
+	}
+	if statement.OpeningAmount != nil && previous.ClosingAmount != nil {
+		return StatementNextPeriod
+	}
+	return StatementUnverified
+}
+
+// GetOrCreateAccount returns the account of a tenant with the kind and
+// identifier, creating it the first time. A nil tenant has the accounts of
+// documents without a tenant.
+func (d *DatabaseService) GetOrCreateAccount(tenantID *string, kind, identifier string) (*Account, error) {
+	account, err := d.findAccount(tenantID, kind, identifier)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return account, err
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO accounts (tenant_id, kind, identifier) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, tenantID, kind, identifier)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create account: %v", err)
+	}
+	return d.findAccount(tenantID, kind, identifier)
+}
+
+const accountColumns = `id, tenant_id, kind, identifier, statements, documents, last_document_id, risk_score, findings,
+	created_at, updated_at`
+
+func scanAccount(row interface{ Scan(...interface{}) error }) (*Account, error) {
+	account := &Account{}
+	err := row.Scan(&account.ID, &account.TenantID, &account.Kind, &account.Identifier, &account.Statements,
+		&account.Documents, &account.LastDocumentID, &account.RiskScore, &account.Findings, &account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// findAccount returns the oldest matching account: without a tenant the
+// unique constraint does not hold, and concurrent uploads may each create one
+func (d *DatabaseService) findAccount(tenantID *string, kind, identifier string) (*Account, error) {
+	args := []interface{}{kind, identifier}
+	tenant := `tenant_id IS NULL`
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		tenant = `tenant_id = $3`
+	}
+	return scanAccount(d.db.QueryRow(`
+		SELECT `+accountColumns+` FROM accounts
+		WHERE kind = $1 AND identifier = $2 AND `+tenant+`
+		ORDER BY created_at, id LIMIT 1`, args...))
+}
+
+// GetAccount returns an account by ID, or sql.ErrNoRows
+func (d *DatabaseService) GetAccount(id string) (*Account, error) {
+	return scanAccount(d.db.QueryRow(`SELECT `+accountColumns+` FROM accounts WHERE id = $1`, id))
+}
+
+const accountStatementColumns = `document_id, account_id, previous_document_id, continuity, segments, new_segments,
+	analyzed_bytes, CAST(period_start AS TEXT), CAST(period_end AS TEXT), opening_amount, closing_amount,
+	fraud_score, pattern_count, created_at`
+
+func scanAccountStatement(row interface{ Scan(...interface{}) error }) (*AccountStatement, error) {
+	statement := &AccountStatement{}
+	err := row.Scan(&statement.DocumentID, &statement.AccountID, &statement.PreviousDocumentID, &statement.Continuity,
+		&statement.Segments, &statement.NewSegments, &statement.AnalyzedBytes, &statement.PeriodStart, &statement.PeriodEnd,
+		&statement.OpeningAmount, &statement.ClosingAmount, &statement.FraudScore, &statement.PatternCount, &statement.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// GetAccountStatement returns the statement record of a document, or
+// sql.ErrNoRows when it is not the statement of a known account
+func (d *DatabaseService) GetAccountStatement(documentID DocumentID) (*AccountStatement, error) {
+	return scanAccountStatement(d.db.QueryRow(`
+		SELECT `+accountStatementColumns+` FROM account_statements WHERE document_id = $1`, documentID))
+}
+
+// GetPreviousAccountStatement returns the latest statement of an account
+// other than the document's, or nil when there is none
+func (d *DatabaseService) GetPreviousAccountStatement(accountID string, documentID DocumentID) (*AccountStatement, error) {
+	statement, err := scanAccountStatement(d.db.QueryRow(`
+		SELECT `+accountStatementColumns+` FROM account_statements
+		WHERE account_id = $1 AND document_id <> $2
+		ORDER BY created_at DESC LIMIT 1`, accountID, documentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return statement, err
+}
+
+// GetSeenAccountSegments returns which of digests the account's statements
+// other than the document had, with the statement each was first seen in
+func (d *DatabaseService) GetSeenAccountSegments(accountID string, documentID DocumentID, digests []string) (map[string]DocumentID, error) {
+	seen := map[string]DocumentID{}
+	if len(digests) == 0 {
+		return seen, nil
+	}
+	args := []interface{}{accountID, documentID}
+	placeholders := make([]string, len(digests))
+	for i, digest := range digests {
+		args = append(args, digest)
+		placeholders[i] = fmt.Sprintf("$%d", i+3)
+	}
+	rows, err := d.db.Query(`
+		SELECT digest, document_id FROM account_segments
+		WHERE account_id = $1 AND document_id <> $2 AND digest IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query account segments: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var digest string
+		var first DocumentID
+		if err := rows.Scan(&digest, &first); err != nil {
+			return nil, err
+		}
+		seen[digest] = first
+	}
+	return seen, rows.Err()
+}
+
+// RecordAccountStatement stores a statement of an account, in place of any
+// earlier record of the same document, and notes the digests of its
+// segments. Its findings reach the account as evidence, with those of the
+// account's other documents.
+func (d *DatabaseService) RecordAccountStatement(statement *AccountStatement, digests []string) error {
+	return withRetry("record_account_statement", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`
+			INSERT INTO account_statements (document_id, account_id, previous_document_id, continuity, segments,
+				new_segments, analyzed_bytes, period_start, period_end, opening_amount, closing_amount, fraud_score,
+				pattern_count)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			ON CONFLICT (document_id) DO UPDATE SET account_id = excluded.account_id,
+				previous_document_id = excluded.previous_document_id, continuity = excluded.continuity,
+				segments = excluded.segments, new_segments = excluded.new_segments,
+				analyzed_bytes = excluded.analyzed_bytes, period_start = excluded.period_start,
+				period_end = excluded.period_end, opening_amount = excluded.opening_amount,
+				closing_amount = excluded.closing_amount, fraud_score = excluded.fraud_score,
+				pattern_count = excluded.pattern_count`,
+			statement.DocumentID, statement.AccountID, statement.PreviousDocumentID, statement.Continuity,
+			statement.Segments, statement.NewSegments, statement.AnalyzedBytes, statement.PeriodStart,
+			statement.PeriodEnd, statement.OpeningAmount, statement.ClosingAmount, statement.FraudScore,
+			statement.PatternCount)
+		if err != nil {
+			return err
+		}
+		for _, digest := range digests {
+			_, err := tx.Exec(`
+				INSERT INTO account_segments (account_id, digest, document_id) VALUES ($1, $2, $3)
+				ON CONFLICT DO NOTHING`, statement.AccountID, digest, statement.DocumentID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`
+			UPDATE accounts SET
+				statements = (SELECT COUNT(*) FROM account_statements WHERE account_id = $1),
+				last_document_id = (SELECT document_id FROM account_statements WHERE account_id = $1
+					ORDER BY created_at DESC LIMIT 1),
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`, statement.AccountID)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
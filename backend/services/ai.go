@@ -0,0 +1,342 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/logging"
+)
+
+// ErrAIServiceUnavailable is returned when the AI service cannot be reached
+var ErrAIServiceUnavailable = errors.New("AI service unavailable")
+
+// AIClient is the interface to the Python AI service. Responses are checked
+// against the AISchemaVersion contract; a response that fails validation is
+// returned as an *AIContractError.
+type AIClient interface {
+	AnalyzeText(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error)
+	AskDocument(ctx context.Context, req AskDocumentRequest) (*AskDocumentResponse, error)
+	AnalyzeDocumentFraud(ctx context.Context, req DocumentFraudRequest) (*DocumentFraudResponse, error)
+	GetQAModelInfo(ctx context.Context) (*QAModelInfoResponse, error)
+	AnalyzeBatch(ctx context.Context, req AnalyzeBatchRequest) (*AnalyzeBatchResponse, error)
+	GenerateEmbedding(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error)
+	ExtractText(ctx context.Context, req ExtractTextRequest) (*ExtractTextResponse, error)
+	CheckContract(ctx context.Context) (*AIContractReport, error)
+}
+
+// AIService calls the FastAPI AI service over HTTP
+type AIService struct {
+	baseURL string
+	token   string
+	secrets *Secrets
+	client  *http.Client
+	limiter *AILimiter
+}
+
+// NewAIService fails when the configured certificates cannot be loaded.
+// Requests carry the bearer token only when one is configured; with mutual
+// TLS the client certificate identifies the backend. The token may be a
+// secret reference, resolved through secrets for each request.
+func NewAIService(cfg config.AIConfig, secrets *Secrets) (*AIService, error) {
+	tlsConfig, err := ClientTLSConfig(cfg.CAFile, cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	secrets.Subscribe("ai service", nil, cfg.Token)
+
+	return &AIService{
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		token:   cfg.Token,
+		secrets: secrets,
+		client:  &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		limiter: NewAILimiter(cfg.MinConcurrency, cfg.MaxConcurrency, cfg.LatencyTarget, cfg.MaxQueued),
+	}, nil
+}
+
+func (a *AIService) AnalyzeText(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	if d := DiagnosticsFrom(ctx); d != nil {
+		d.RecordChunk("/analyze-text", 0, len(req.Text), len(req.Text))
+	}
+	// The AI service reads text from the query string rather than a JSON body
+	var resp AnalyzeTextResponse
+	if err := a.do(ctx, http.MethodPost, "/analyze-text?"+req.Query().Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *AIService) AskDocument(ctx context.Context, req AskDocumentRequest) (*AskDocumentResponse, error) {
+	var resp AskDocumentResponse
+	if err := a.do(ctx, http.MethodPost, "/ask-document", req.Form(), &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *AIService) AnalyzeDocumentFraud(ctx context.Context, req DocumentFraudRequest) (*DocumentFraudResponse, error) {
+	var resp DocumentFraudResponse
+	if err := a.do(ctx, http.MethodPost, "/analyze-document-fraud", req.Form(), &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *AIService) GetQAModelInfo(ctx context.Context) (*QAModelInfoResponse, error) {
+	var resp QAModelInfoResponse
+	if err := a.do(ctx, http.MethodGet, "/qa-model-info", nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *AIService) AnalyzeBatch(ctx context.Context, req AnalyzeBatchRequest) (*AnalyzeBatchResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := a.newRequest(ctx, http.MethodPost, "/analyze-batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var resp AnalyzeBatchResponse
+	if err := a.send(httpReq, "/analyze-batch", &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(len(req.Texts)); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *AIService) GenerateEmbedding(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	if d := DiagnosticsFrom(ctx); d != nil {
+		d.RecordChunk("/generate-embeddings", 0, len(req.Text), len(req.Text))
+	}
+	var resp EmbeddingResponse
+	if err := a.do(ctx, http.MethodPost, "/generate-embeddings?"+req.Query().Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (a *AIService) ExtractText(ctx context.Context, req ExtractTextRequest) (*ExtractTextResponse, error) {
+	// The document is streamed into the request as it is sent rather than
+	// held in memory, so the body has no length and is sent chunked
+	content := &recordingReader{r: req.Content}
+	body, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		pw.CloseWithError(writeExtractTextForm(form, req, content))
+	}()
+	finish := func() {
+		// Stops the copy when the request ended before reading it all
+		body.Close()
+		<-written
+	}
+	defer finish()
+
+	httpReq, err := a.newRequest(ctx, http.MethodPost, "/extract-text", body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+
+	var resp ExtractTextResponse
+	if err := a.send(httpReq, "/extract-text", &resp); err != nil {
+		finish()
+		if content.err != nil {
+			return nil, fmt.Errorf("failed to read document: %v", content.err)
+		}
+		return nil, err
+	}
+	if err := resp.Validate(); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// writeExtractTextForm writes the multipart form of an /extract-text request
+// with content as the file
+func writeExtractTextForm(form *multipart.Writer, req ExtractTextRequest, content io.Reader) error {
+	if len(req.Pages) > 0 {
+		pages := make([]string, len(req.Pages))
+		for i, page := range req.Pages {
+			pages[i] = strconv.Itoa(page)
+		}
+		if err := form.WriteField("pages", strings.Join(pages, ",")); err != nil {
+			return err
+		}
+	}
+	if req.Thorough {
+		if err := form.WriteField("thorough", "true"); err != nil {
+			return err
+		}
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename=%q`, req.Filename))
+	header.Set("Content-Type", req.ContentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// recordingReader keeps the error r failed with, to tell it from the
+// failures of what reads it
+type recordingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// AIStatusError is returned when the AI service answers with a non-2xx status
+type AIStatusError struct {
+	StatusCode int
+	Detail     string
+}
+
+func (e *AIStatusError) Error() string {
+	return fmt.Sprintf("AI service returned %d: %s", e.StatusCode, e.Detail)
+}
+
+func (a *AIService) do(ctx context.Context, method, endpoint string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := a.newRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return a.send(req, strings.SplitN(endpoint, "?", 2)[0], out)
+}
+
+func (a *AIService) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	token, err := a.secrets.Resolve(ctx, a.token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve AI service token: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// send performs req and decodes a successful JSON response into out. It
+// waits for a slot of the limiter first; text extraction takes long by
+// nature, so its latency does not adapt the limit.
+func (a *AIService) send(req *http.Request, endpoint string, out interface{}) error {
+	release, err := a.limiter.Acquire(req.Context())
+	if err != nil {
+		return err
+	}
+	exchange := beginExchange(req.Context(), "ai-service", req)
+	started := time.Now()
+	respBody, resp, err := a.roundTrip(req)
+	if resp != nil {
+		exchange.finish(resp.StatusCode, respBody, nil)
+		logging.AI.Debugf("%s %s: %d, %d bytes in %v", req.Method, endpoint, resp.StatusCode, len(respBody), time.Since(started).Round(time.Millisecond))
+	} else {
+		exchange.finish(0, nil, err)
+		logging.AI.Debugf("%s %s failed after %v: %v", req.Method, endpoint, time.Since(started).Round(time.Millisecond), err)
+	}
+	observed := err
+	if err == nil && resp.StatusCode == http.StatusServiceUnavailable {
+		observed = ErrAIServiceUnavailable
+	}
+	release(time.Since(started), observed, endpoint != "/extract-text")
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// FastAPI reports errors as {"detail": "..."}
+		var failure struct {
+			Detail interface{} `json:"detail"`
+		}
+		detail := strings.TrimSpace(string(respBody))
+		if json.Unmarshal(respBody, &failure) == nil && failure.Detail != nil {
+			detail = fmt.Sprint(failure.Detail)
+		}
+		statusErr := &AIStatusError{StatusCode: resp.StatusCode, Detail: detail}
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			return fmt.Errorf("%w: %v", ErrAIServiceUnavailable, statusErr)
+		}
+		return statusErr
+	}
+
+	// Parse response
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return &AIContractError{Endpoint: endpoint, Problems: []string{err.Error()}}
+	}
+	return nil
+}
+
+// roundTrip performs req and reads the whole response
+func (a *AIService) roundTrip(req *http.Request) ([]byte, *http.Response, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrAIServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read AI service response: %v", err)
+	}
+	return respBody, resp, nil
+}
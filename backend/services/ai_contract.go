@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// contractProbeText is analyzed during a contract check. It contains a few
+// keywords so the pattern analysis has something to report.
+const contractProbeText = "URGENT: wire transfer the total amount to the offshore account immediately."
+
+// AIContractCheck is the outcome of probing one AI service endpoint
+type AIContractCheck struct {
+	Endpoint  string   `json:"endpoint"`
+	Passed    bool     `json:"passed"`
+	Problems  []string `json:"problems,omitempty"`
+	LatencyMs int64    `json:"latency_ms"`
+}
+
+// AIContractReport describes whether the deployed AI service speaks the
+// schema version this backend expects
+type AIContractReport struct {
+	ExpectedSchemaVersion string            `json:"expected_schema_version"`
+	ServiceSchemaVersion  string            `json:"service_schema_version"`
+	ServiceVersion        string            `json:"service_version"`
+	Compatible            bool              `json:"compatible"`
+	Checks                []AIContractCheck `json:"checks"`
+	CheckedAt             time.Time         `json:"checked_at"`
+}
+
+// CheckContract reads the schema version reported by the AI service and
+// exercises the cheap endpoints, validating each response. The QA endpoints
+// are skipped because they run the language model. An error is only returned
+// when the service cannot be reached at all.
+func (a *AIService) CheckContract(ctx context.Context) (*AIContractReport, error) {
+	report := &AIContractReport{
+		ExpectedSchemaVersion: AISchemaVersion,
+		CheckedAt:             time.Now().UTC(),
+	}
+
+	var info AIServiceInfo
+	start := time.Now()
+	infoErr := a.do(ctx, http.MethodGet, "/", nil, &info)
+	if errors.Is(infoErr, ErrAIServiceUnavailable) {
+		return nil, infoErr
+	}
+	check := runContractCheck("/", func() error {
+		if infoErr != nil {
+			return infoErr
+		}
+		if info.SchemaVersion == "" {
+			return &AIContractError{Endpoint: "/", Problems: []string{"schema_version is not reported"}}
+		}
+		if info.SchemaVersion != AISchemaVersion {
+			return &AIContractError{Endpoint: "/", Problems: []string{
+				"schema_version " + info.SchemaVersion + " does not match expected " + AISchemaVersion,
+			}}
+		}
+		return nil
+	})
+	check.LatencyMs = time.Since(start).Milliseconds()
+	report.ServiceSchemaVersion = info.SchemaVersion
+	report.ServiceVersion = info.Version
+	report.Checks = append(report.Checks, check)
+
+	report.Checks = append(report.Checks, runContractCheck("/analyze-text", func() error {
+		_, err := a.AnalyzeText(ctx, AnalyzeTextRequest{Text: contractProbeText})
+		return err
+	}))
+	report.Checks = append(report.Checks, runContractCheck("/analyze-batch", func() error {
+		_, err := a.AnalyzeBatch(ctx, AnalyzeBatchRequest{Texts: []string{contractProbeText, "Invoice total: $120.00"}})
+		return err
+	}))
+	report.Checks = append(report.Checks, runContractCheck("/generate-embeddings", func() error {
+		_, err := a.GenerateEmbedding(ctx, EmbeddingRequest{Text: contractProbeText})
+		return err
+	}))
+	report.Checks = append(report.Checks, runContractCheck("/qa-model-info", func() error {
+		_, err := a.GetQAModelInfo(ctx)
+		return err
+	}))
+
+	report.Compatible = true
+	for _, c := range report.Checks {
+		if !c.Passed {
+			report.Compatible = false
+		}
+	}
+	return report, nil
+}
+
+func runContractCheck(endpoint string, probe func() error) AIContractCheck {
+	start := time.Now()
+	err := probe()
+	check := AIContractCheck{
+		Endpoint:  endpoint,
+		Passed:    err == nil,
+		LatencyMs: time.Since(start).Milliseconds(),
+	}
+	if contractErr, ok := err.(*AIContractError); ok {
+		check.Problems = contractErr.Problems
+	} else if err != nil {
+		check.Problems = []string{err.Error()}
+	}
+	return check
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"frauddocai-backend/metrics"
+)
+
+// ErrAIOverloaded is returned without calling the AI service when too many
+// calls are already waiting for it. It wraps ErrAIServiceUnavailable, so
+// callers fall back as they do when the service is down.
+var ErrAIOverloaded = fmt.Errorf("%w: too many requests waiting", ErrAIServiceUnavailable)
+
+// decreaseFactor is what the concurrency limit is multiplied by when the AI
+// service slows down
+const decreaseFactor = 0.7
+
+// AILimiter bounds the AI service calls in flight. The limit adapts to the
+// service's latency: it grows by about one for every limit calls answered
+// within the target latency, and shrinks by decreaseFactor when a call is
+// slower or the service is unavailable, at most once per target latency so
+// that one burst of slow calls counts once. Calls beyond the limit wait in
+// line; once maxQueued are waiting further calls fail with ErrAIOverloaded.
+type AILimiter struct {
+	min, max  int
+	target    time.Duration
+	maxQueued int
+
+	mu           sync.Mutex
+	limit        float64
+	inFlight     int
+	waiting      []chan struct{}
+	lastDecrease time.Time
+}
+
+// NewAILimiter starts at the max limit. It returns nil, which limits
+// nothing, when max is not positive.
+func NewAILimiter(minLimit, maxLimit int, target time.Duration, maxQueued int) *AILimiter {
+	if maxLimit <= 0 {
+		return nil
+	}
+	minLimit = min(max(minLimit, 1), maxLimit)
+	metrics.AIConcurrencyLimit.Set(float64(maxLimit))
+	return &AILimiter{min: minLimit, max: maxLimit, target: target, maxQueued: maxQueued, limit: float64(maxLimit)}
+}
+
+// Acquire waits for a slot. The returned release frees it; latency is
+// only observed when adapt is set, for calls whose duration reflects how
+// loaded the service is.
+func (l *AILimiter) Acquire(ctx context.Context) (release func(latency time.Duration, err error, adapt bool), err error) {
+	if l == nil {
+		return func(time.Duration, error, bool) {}, nil
+	}
+
+	l.mu.Lock()
+	if l.inFlight < int(l.limit) && len(l.waiting) == 0 {
+		l.inFlight++
+		metrics.AIRequestsInFlight.Set(float64(l.inFlight))
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if len(l.waiting) >= l.maxQueued {
+		l.mu.Unlock()
+		metrics.AIRequestsShed.Inc()
+		return nil, ErrAIOverloaded
+	}
+	granted := make(chan struct{})
+	l.waiting = append(l.waiting, granted)
+	l.mu.Unlock()
+
+	started := time.Now()
+	select {
+	case <-granted:
+		metrics.AIQueueWait.Observe(time.Since(started).Seconds())
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for i, w := range l.waiting {
+			if w == granted {
+				l.waiting = append(l.waiting[:i], l.waiting[i+1:]...)
+				return nil, ctx.Err()
+			}
+		}
+		// Granted while giving up; pass the slot on
+		l.inFlight--
+		l.grant()
+		return nil, ctx.Err()
+	}
+}
+
+func (l *AILimiter) release(latency time.Duration, err error, adapt bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	if adapt {
+		switch {
+		case latency > l.target || errors.Is(err, ErrAIServiceUnavailable):
+			if time.Since(l.lastDecrease) >= l.target {
+				l.limit = max(float64(l.min), l.limit*decreaseFactor)
+				l.lastDecrease = time.Now()
+			}
+		case err == nil:
+			l.limit = min(float64(l.max), l.limit+1/l.limit)
+		}
+		metrics.AIConcurrencyLimit.Set(float64(int(l.limit)))
+	}
+	l.grant()
+}
+
+// grant hands free slots to the longest waiting calls
+func (l *AILimiter) grant() {
+	for len(l.waiting) > 0 && l.inFlight < int(l.limit) {
+		close(l.waiting[0])
+		l.waiting = l.waiting[1:]
+		l.inFlight++
+	}
+	metrics.AIRequestsInFlight.Set(float64(l.inFlight))
+}
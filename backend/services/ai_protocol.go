@@ -0,0 +1,371 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// AISchemaVersion is the AI service contract version this backend is built
+// against. The AI service reports its own version as schema_version on GET /.
+// Version 2 added /analyze-batch, version 3 /extract-text, version 4 the
+// questions and prompt_template of /analyze-document-fraud and version 5 the
+// pages of /extract-text.
+const AISchemaVersion = "5"
+
+// ErrInvalidAIResponse is returned when the AI service answers with a body
+// that does not match the expected schema
+var ErrInvalidAIResponse = errors.New("invalid AI service response")
+
+// AIContractError lists the schema violations found in one AI response
+type AIContractError struct {
+	Endpoint string
+	Problems []string
+}
+
+func (e *AIContractError) Error() string {
+	return fmt.Sprintf("%s response violates schema v%s: %s", e.Endpoint, AISchemaVersion, strings.Join(e.Problems, "; "))
+}
+
+func (e *AIContractError) Unwrap() error {
+	return ErrInvalidAIResponse
+}
+
+// Risk levels the AI service may report, upper case as sent on the wire
+var aiRiskLevels = map[string]bool{
+	"LOW":      true,
+	"MEDIUM":   true,
+	"HIGH":     true,
+	"CRITICAL": true,
+}
+
+func checkRiskLevel(problems []string, field, value string) []string {
+	if value == "" {
+		return append(problems, field+" is required")
+	}
+	if !aiRiskLevels[strings.ToUpper(value)] {
+		return append(problems, fmt.Sprintf("%s %q is not a known risk level", field, value))
+	}
+	return problems
+}
+
+func checkScore(problems []string, field string, value *float64) []string {
+	if value == nil {
+		return append(problems, field+" is required")
+	}
+	if *value < 0 || *value > 1 {
+		return append(problems, fmt.Sprintf("%s %v is outside [0, 1]", field, *value))
+	}
+	return problems
+}
+
+func contractError(endpoint string, problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &AIContractError{Endpoint: endpoint, Problems: problems}
+}
+
+// AIServiceInfo is returned by GET /
+type AIServiceInfo struct {
+	Service       string `json:"service"`
+	Status        string `json:"status"`
+	Version       string `json:"version"`
+	SchemaVersion string `json:"schema_version"`
+}
+
+// AnalyzeTextRequest is sent to POST /analyze-text
+type AnalyzeTextRequest struct {
+	Text string
+}
+
+// Query encodes the request; the endpoint takes its input as query parameters
+func (r AnalyzeTextRequest) Query() url.Values {
+	return url.Values{"text": {r.Text}}
+}
+
+// AnalyzeTextResponse is returned by POST /analyze-text
+type AnalyzeTextResponse struct {
+	TextLength       int             `json:"text_length"`
+	FraudScore       *float64        `json:"fraud_score"`
+	RiskLevel        string          `json:"risk_level"`
+	Patterns         []string        `json:"patterns"`
+	EmotionAnalysis  json.RawMessage `json:"emotion_analysis"`
+	PatternAnalysis  json.RawMessage `json:"pattern_analysis"`
+	ProcessingTimeMs float64         `json:"processing_time_ms"`
+	Timestamp        string          `json:"timestamp"`
+
+	// Set by the backend's analyzers, not part of the wire contract.
+	// Cached results were reused from an earlier analysis of the text.
+	Provider     string `json:"-"`
+	ModelVersion string `json:"-"`
+	Fallback     bool   `json:"-"`
+	Cached       bool   `json:"-"`
+}
+
+func (r *AnalyzeTextResponse) Validate() error {
+	var problems []string
+	problems = checkScore(problems, "fraud_score", r.FraudScore)
+	problems = checkRiskLevel(problems, "risk_level", r.RiskLevel)
+	if r.Patterns == nil {
+		problems = append(problems, "patterns is required")
+	}
+	// The AI service sends null when its analysis failed
+	if len(r.PatternAnalysis) == 0 {
+		problems = append(problems, "pattern_analysis is required")
+	} else if r.PatternAnalysis[0] != '{' && string(r.PatternAnalysis) != "null" {
+		problems = append(problems, "pattern_analysis must be an object")
+	}
+	return contractError("/analyze-text", problems)
+}
+
+// AnalysisJSON returns raw as a JSON document suitable for a JSONB column,
+// substituting an empty object when the AI service sent nothing or null
+func AnalysisJSON(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "{}"
+	}
+	return string(raw)
+}
+
+// AnalyzeBatchRequest is sent as JSON to POST /analyze-batch
+type AnalyzeBatchRequest struct {
+	Texts []string `json:"texts"`
+}
+
+// AnalyzeBatchResponse is returned by POST /analyze-batch, one result per
+// text in request order
+type AnalyzeBatchResponse struct {
+	Results []*AnalyzeTextResponse `json:"results"`
+	Count   int                    `json:"count"`
+}
+
+// Validate checks every result and that one was returned per requested text
+func (r *AnalyzeBatchResponse) Validate(expected int) error {
+	var problems []string
+	if len(r.Results) != expected {
+		problems = append(problems, fmt.Sprintf("expected %d results, got %d", expected, len(r.Results)))
+	}
+	for i, result := range r.Results {
+		if result == nil {
+			problems = append(problems, fmt.Sprintf("results[%d] is null", i))
+			continue
+		}
+		var contractErr *AIContractError
+		if errors.As(result.Validate(), &contractErr) {
+			for _, problem := range contractErr.Problems {
+				problems = append(problems, fmt.Sprintf("results[%d].%s", i, problem))
+			}
+		}
+	}
+	return contractError("/analyze-batch", problems)
+}
+
+// EmbeddingRequest is sent to POST /generate-embeddings
+type EmbeddingRequest struct {
+	Text string
+}
+
+func (r EmbeddingRequest) Query() url.Values {
+	return url.Values{"text": {r.Text}}
+}
+
+// EmbeddingResponse is returned by POST /generate-embeddings
+type EmbeddingResponse struct {
+	Embeddings         []float32 `json:"embeddings"`
+	EmbeddingDimension int       `json:"embedding_dimension"`
+	Model              string    `json:"model"`
+	Error              string    `json:"error,omitempty"`
+	GenerationTimeMs   float64   `json:"generation_time_ms"`
+	Timestamp          string    `json:"timestamp"`
+}
+
+func (r *EmbeddingResponse) Validate() error {
+	var problems []string
+	if r.Error != "" {
+		problems = append(problems, "service reported: "+r.Error)
+	}
+	if len(r.Embeddings) == 0 {
+		problems = append(problems, "embeddings is empty")
+	} else if len(r.Embeddings) != r.EmbeddingDimension {
+		problems = append(problems, fmt.Sprintf("embedding_dimension %d does not match %d values", r.EmbeddingDimension, len(r.Embeddings)))
+	}
+	return contractError("/generate-embeddings", problems)
+}
+
+// ExtractTextRequest is sent to POST /extract-text as a multipart upload.
+// Pages limits the extraction to those pages, numbered from 1; Thorough asks
+// for slower, more careful OCR, as used to re-OCR low-confidence pages.
+type ExtractTextRequest struct {
+	Filename    string
+	ContentType string
+	Content     io.Reader
+	Pages       []int
+	Thorough    bool
+}
+
+// Page sources of ExtractedPage
+const (
+	PageSourceText = "text"
+	PageSourceOCR  = "ocr"
+)
+
+// Page statuses of ExtractedPage
+const (
+	PageStatusOK      = "ok"
+	PageStatusTimeout = "timeout"
+	PageStatusError   = "error"
+)
+
+// ExtractedPage is the extraction of one page of a document. TextStart and
+// TextEnd locate its text in the extracted text, in bytes.
+type ExtractedPage struct {
+	Page       int     `json:"page"`
+	Source     string  `json:"source"`
+	Confidence float64 `json:"confidence"`
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	TextStart  int     `json:"text_start"`
+	TextEnd    int     `json:"text_end"`
+	DurationMS int64   `json:"duration_ms"`
+}
+
+// ExtractTextResponse is returned by POST /extract-text. Unlike
+// /process-document the text is not truncated.
+type ExtractTextResponse struct {
+	Filename             string   `json:"filename"`
+	FileType             string   `json:"file_type"`
+	ExtractedText        *string  `json:"extracted_text"`
+	ConfidenceScore      *float64 `json:"confidence_score"`
+	QualityLevel         string   `json:"quality_level"`
+	PreprocessingApplied bool     `json:"preprocessing_applied"`
+	TextBlocks           int      `json:"text_blocks"`
+	ProcessingNotes      string   `json:"processing_notes"`
+	Timestamp            string   `json:"timestamp"`
+	// PageCount is the number of pages of the whole document, and Pages
+	// those extracted, in order; formats without pages have none
+	PageCount int             `json:"page_count"`
+	Pages     []ExtractedPage `json:"pages"`
+}
+
+func (r *ExtractTextResponse) Validate() error {
+	var problems []string
+	if r.ExtractedText == nil {
+		problems = append(problems, "extracted_text is missing")
+	}
+	if r.ConfidenceScore == nil {
+		problems = append(problems, "confidence_score is missing")
+	} else if *r.ConfidenceScore < 0 || *r.ConfidenceScore > 100 {
+		problems = append(problems, fmt.Sprintf("confidence_score %v is outside [0, 100]", *r.ConfidenceScore))
+	}
+	previous := 0
+	for _, page := range r.Pages {
+		if page.Page <= previous {
+			problems = append(problems, fmt.Sprintf("page %d is out of order", page.Page))
+		}
+		previous = page.Page
+		if page.Confidence < 0 || page.Confidence > 100 {
+			problems = append(problems, fmt.Sprintf("confidence %v of page %d is outside [0, 100]", page.Confidence, page.Page))
+		}
+		if r.ExtractedText != nil && (page.TextStart < 0 || page.TextStart > page.TextEnd || page.TextEnd > len(*r.ExtractedText)) {
+			problems = append(problems, fmt.Sprintf("text of page %d is outside the extracted text", page.Page))
+		}
+	}
+	return contractError("/extract-text", problems)
+}
+
+// AskDocumentRequest is sent to POST /ask-document
+type AskDocumentRequest struct {
+	Question     string
+	DocumentText string
+}
+
+func (r AskDocumentRequest) Form() url.Values {
+	return url.Values{"question": {r.Question}, "document_text": {r.DocumentText}}
+}
+
+// AskDocumentResponse is returned by POST /ask-document
+type AskDocumentResponse struct {
+	Question    string   `json:"question"`
+	Answer      *string  `json:"answer"`
+	Confidence  *float64 `json:"confidence"`
+	ContextUsed string   `json:"context_used"`
+	ModelUsed   string   `json:"model_used"`
+	Timestamp   string   `json:"timestamp"`
+}
+
+func (r *AskDocumentResponse) Validate() error {
+	var problems []string
+	if r.Answer == nil {
+		problems = append(problems, "answer is required")
+	}
+	problems = checkScore(problems, "confidence", r.Confidence)
+	return contractError("/ask-document", problems)
+}
+
+// DocumentFraudRequest is sent to POST /analyze-document-fraud. Without
+// Questions the AI service asks its default questions.
+type DocumentFraudRequest struct {
+	DocumentText   string
+	Questions      FraudQuestions
+	PromptTemplate *string
+}
+
+func (r DocumentFraudRequest) Form() url.Values {
+	form := url.Values{"document_text": {r.DocumentText}}
+	if len(r.Questions) > 0 {
+		questions, _ := json.Marshal(r.Questions)
+		form.Set("questions", string(questions))
+	}
+	if r.PromptTemplate != nil {
+		form.Set("prompt_template", *r.PromptTemplate)
+	}
+	return form
+}
+
+// DocumentFraudResponse is returned by POST /analyze-document-fraud
+type DocumentFraudResponse struct {
+	DocumentLength    int             `json:"document_length"`
+	FraudAnalysis     json.RawMessage `json:"fraud_analysis"`
+	OverallRisk       string          `json:"overall_risk"`
+	TotalRiskScore    *float64        `json:"total_risk_score"`
+	QuestionsAnalyzed int             `json:"questions_analyzed"`
+	ModelUsed         string          `json:"model_used"`
+	Timestamp         string          `json:"timestamp"`
+}
+
+func (r *DocumentFraudResponse) Validate() error {
+	var problems []string
+	// The total is a weighted sum over the questions asked, so it may exceed 1
+	if r.TotalRiskScore == nil {
+		problems = append(problems, "total_risk_score is required")
+	} else if *r.TotalRiskScore < 0 {
+		problems = append(problems, fmt.Sprintf("total_risk_score %v is negative", *r.TotalRiskScore))
+	}
+	problems = checkRiskLevel(problems, "overall_risk", r.OverallRisk)
+	if len(r.FraudAnalysis) == 0 || r.FraudAnalysis[0] != '[' {
+		problems = append(problems, "fraud_analysis must be a list")
+	}
+	return contractError("/analyze-document-fraud", problems)
+}
+
+// QAModelInfoResponse is returned by GET /qa-model-info
+type QAModelInfoResponse struct {
+	ModelAvailable *bool           `json:"model_available"`
+	ModelInfo      json.RawMessage `json:"model_info,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Timestamp      string          `json:"timestamp,omitempty"`
+}
+
+func (r *QAModelInfoResponse) Validate() error {
+	var problems []string
+	if r.ModelAvailable == nil {
+		problems = append(problems, "model_available is required")
+	} else if *r.ModelAvailable && len(r.ModelInfo) == 0 {
+		problems = append(problems, "model_info is required when the model is available")
+	}
+	return contractError("/qa-model-info", problems)
+}
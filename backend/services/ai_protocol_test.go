@@ -0,0 +1,254 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/services"
+)
+
+// aiRecordings are responses recorded from the AI service at
+// AISchemaVersion, served by path
+var aiRecordings = map[string]string{
+	"/":                    "root.json",
+	"/analyze-text":        "analyze-text.json",
+	"/analyze-batch":       "analyze-batch.json",
+	"/generate-embeddings": "generate-embeddings.json",
+	"/qa-model-info":       "qa-model-info.json",
+}
+
+// recordedAIService serves the recordings to an AIService, after edit
+// changes the decoded recording of path
+func recordedAIService(t *testing.T, path string, edit func(map[string]interface{})) *services.AIService {
+	t.Helper()
+	bodies := map[string][]byte{}
+	for endpoint, file := range aiRecordings {
+		body, err := os.ReadFile(filepath.Join("testdata", "ai", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if endpoint == path && edit != nil {
+			var recording map[string]interface{}
+			if err := json.Unmarshal(body, &recording); err != nil {
+				t.Fatalf("%s: %v", file, err)
+			}
+			edit(recording)
+			if body, err = json.Marshal(recording); err != nil {
+				t.Fatal(err)
+			}
+		}
+		bodies[endpoint] = body
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+
+	ai, err := services.NewAIService(config.AIConfig{BaseURL: server.URL, Timeout: 5 * time.Second},
+		services.NewSecrets(config.SecretsConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ai
+}
+
+// firstResult edits the first result of a recorded batch
+func firstResult(edit func(map[string]interface{})) func(map[string]interface{}) {
+	return func(recording map[string]interface{}) {
+		edit(recording["results"].([]interface{})[0].(map[string]interface{}))
+	}
+}
+
+func TestAIResponsesDecodeAsRecorded(t *testing.T) {
+	ai := recordedAIService(t, "", nil)
+	ctx := context.Background()
+
+	text, err := ai.AnalyzeText(ctx, services.AnalyzeTextRequest{Text: "URGENT: wire transfer the total amount"})
+	if err != nil {
+		t.Fatalf("AnalyzeText: %v", err)
+	}
+	if text.FraudScore == nil || *text.FraudScore != 0.525 || text.RiskLevel != "MEDIUM" || len(text.Patterns) != 6 {
+		t.Errorf("AnalyzeText decoded %+v", text)
+	}
+	var patternAnalysis struct {
+		Patterns []struct {
+			Pattern    string  `json:"pattern"`
+			Confidence float64 `json:"confidence"`
+		} `json:"patterns"`
+	}
+	if err := json.Unmarshal(text.PatternAnalysis, &patternAnalysis); err != nil || len(patternAnalysis.Patterns) != 3 {
+		t.Errorf("pattern_analysis decoded %+v: %v", patternAnalysis, err)
+	}
+
+	batch, err := ai.AnalyzeBatch(ctx, services.AnalyzeBatchRequest{Texts: []string{"one", "two"}})
+	if err != nil {
+		t.Fatalf("AnalyzeBatch: %v", err)
+	}
+	if batch.Results[1].RiskLevel != "LOW" || batch.Results[1].FraudScore == nil || *batch.Results[1].FraudScore != 0.05 {
+		t.Errorf("AnalyzeBatch decoded %+v", batch.Results[1])
+	}
+
+	report, err := ai.CheckContract(ctx)
+	if err != nil {
+		t.Fatalf("CheckContract: %v", err)
+	}
+	if !report.Compatible {
+		t.Errorf("recordings found incompatible: %+v", report.Checks)
+	}
+}
+
+func TestAIResponsesBreakingTheContract(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		edit    func(map[string]interface{})
+		problem string
+	}{
+		{
+			name:    "missing fraud_score",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { delete(r, "fraud_score") },
+			problem: "fraud_score is required",
+		},
+		{
+			name:    "fraud_score as a string",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { r["fraud_score"] = "0.525" },
+			problem: "fraud_score",
+		},
+		{
+			name:    "fraud_score out of range",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { r["fraud_score"] = 52.5 },
+			problem: "fraud_score 52.5 is outside [0, 1]",
+		},
+		{
+			name:    "missing risk_level",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { delete(r, "risk_level") },
+			problem: "risk_level is required",
+		},
+		{
+			name:    "risk_level as a number",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { r["risk_level"] = 2 },
+			problem: "risk_level",
+		},
+		{
+			name:    "unknown risk_level",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { r["risk_level"] = "UNKNOWN" },
+			problem: `risk_level "UNKNOWN" is not a known risk level`,
+		},
+		{
+			name:    "missing patterns",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { delete(r, "patterns") },
+			problem: "patterns is required",
+		},
+		{
+			name:    "patterns as a string",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { r["patterns"] = "urgent" },
+			problem: "patterns",
+		},
+		{
+			name:    "missing pattern_analysis",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { delete(r, "pattern_analysis") },
+			problem: "pattern_analysis is required",
+		},
+		{
+			name:    "pattern_analysis as a list",
+			path:    "/analyze-text",
+			edit:    func(r map[string]interface{}) { r["pattern_analysis"] = []interface{}{} },
+			problem: "pattern_analysis must be an object",
+		},
+		{
+			name:    "batch result without fraud_score",
+			path:    "/analyze-batch",
+			edit:    firstResult(func(r map[string]interface{}) { delete(r, "fraud_score") }),
+			problem: "results[0].fraud_score is required",
+		},
+		{
+			name:    "batch result with patterns as a string",
+			path:    "/analyze-batch",
+			edit:    firstResult(func(r map[string]interface{}) { r["patterns"] = "total" }),
+			problem: "patterns",
+		},
+		{
+			name:    "batch result without risk_level",
+			path:    "/analyze-batch",
+			edit:    firstResult(func(r map[string]interface{}) { delete(r, "risk_level") }),
+			problem: "results[0].risk_level is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ai := recordedAIService(t, tt.path, tt.edit)
+			var err error
+			if tt.path == "/analyze-batch" {
+				_, err = ai.AnalyzeBatch(context.Background(), services.AnalyzeBatchRequest{Texts: []string{"one", "two"}})
+			} else {
+				_, err = ai.AnalyzeText(context.Background(), services.AnalyzeTextRequest{Text: "one"})
+			}
+
+			var contractErr *services.AIContractError
+			if !errors.As(err, &contractErr) {
+				t.Fatalf("err = %v, want an AIContractError", err)
+			}
+			if !errors.Is(err, services.ErrInvalidAIResponse) {
+				t.Errorf("err = %v, want it to be ErrInvalidAIResponse", err)
+			}
+			if !strings.Contains(strings.Join(contractErr.Problems, "; "), tt.problem) {
+				t.Errorf("problems %q, want one about %q", contractErr.Problems, tt.problem)
+			}
+		})
+	}
+}
+
+func TestAIContractRejectsUnknownVersions(t *testing.T) {
+	for name, version := range map[string]interface{}{
+		"newer":    "6",
+		"older":    "4",
+		"missing":  nil,
+		"a number": 5,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ai := recordedAIService(t, "/", func(r map[string]interface{}) {
+				if version == nil {
+					delete(r, "schema_version")
+				} else {
+					r["schema_version"] = version
+				}
+			})
+			report, err := ai.CheckContract(context.Background())
+			if err != nil {
+				t.Fatalf("CheckContract: %v", err)
+			}
+			if report.Compatible {
+				t.Errorf("schema_version %v found compatible", version)
+			}
+			if len(report.Checks) == 0 || report.Checks[0].Endpoint != "/" || report.Checks[0].Passed {
+				t.Errorf("checks %+v, want the version check of / failed", report.Checks)
+			}
+		})
+	}
+}
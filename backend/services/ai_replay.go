@@ -0,0 +1,334 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+)
+
+// AI replay modes
+const (
+	AIReplayOff    = "off"
+	AIReplayRecord = "record"
+	AIReplayReplay = "replay"
+)
+
+// AIReplayMissError is returned in replay mode for a request that was never
+// recorded. It counts as the AI service being unavailable, so callers fall
+// back as they would without the service.
+type AIReplayMissError struct {
+	Endpoint string
+	Key      string
+}
+
+func (e *AIReplayMissError) Error() string {
+	return fmt.Sprintf("no recorded response of %s for request %s", e.Endpoint, e.Key)
+}
+
+func (e *AIReplayMissError) Unwrap() error {
+	return ErrAIServiceUnavailable
+}
+
+// aiRecording is the file a response is recorded in
+type aiRecording struct {
+	Endpoint   string          `json:"endpoint"`
+	Key        string          `json:"key"`
+	RecordedAt time.Time       `json:"recorded_at"`
+	Response   json.RawMessage `json:"response"`
+}
+
+// ReplayAIClient records the responses of an AI client, or serves the
+// recorded responses without calling it. Responses are keyed by a hash of
+// the endpoint and the request, so the same request is always answered the
+// same way whatever order requests come in. Only successful responses are
+// recorded; recording a request again replaces its response.
+type ReplayAIClient struct {
+	ai   AIClient
+	mode string
+	dir  string
+}
+
+// NewReplayAIClient fails on an unknown mode, and in replay mode when the
+// recordings directory does not exist. ai is only called when recording.
+func NewReplayAIClient(cfg config.AIReplayConfig, ai AIClient) (*ReplayAIClient, error) {
+	switch cfg.Mode {
+	case AIReplayRecord:
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create AI recordings directory: %v", err)
+		}
+	case AIReplayReplay:
+		if info, err := os.Stat(cfg.Dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("AI recordings directory %s not found", cfg.Dir)
+		}
+	default:
+		return nil, fmt.Errorf("unknown AI replay mode %q", cfg.Mode)
+	}
+	return &ReplayAIClient{ai: ai, mode: cfg.Mode, dir: cfg.Dir}, nil
+}
+
+var _ AIClient = (*ReplayAIClient)(nil)
+
+func (r *ReplayAIClient) AnalyzeText(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	var resp *AnalyzeTextResponse
+	err := r.exchange("/analyze-text", req, &resp, func() (err error) {
+		resp, err = r.ai.AnalyzeText(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *ReplayAIClient) AskDocument(ctx context.Context, req AskDocumentRequest) (*AskDocumentResponse, error) {
+	var resp *AskDocumentResponse
+	err := r.exchange("/ask-document", req, &resp, func() (err error) {
+		resp, err = r.ai.AskDocument(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *ReplayAIClient) AnalyzeDocumentFraud(ctx context.Context, req DocumentFraudRequest) (*DocumentFraudResponse, error) {
+	var resp *DocumentFraudResponse
+	err := r.exchange("/analyze-document-fraud", req, &resp, func() (err error) {
+		resp, err = r.ai.AnalyzeDocumentFraud(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *ReplayAIClient) GetQAModelInfo(ctx context.Context) (*QAModelInfoResponse, error) {
+	var resp *QAModelInfoResponse
+	err := r.exchange("/qa-model-info", nil, &resp, func() (err error) {
+		resp, err = r.ai.GetQAModelInfo(ctx)
+		return err
+	})
+	return resp, err
+}
+
+// AnalyzeBatch records each text's result as that of /analyze-text for the
+// text alone. Batches are formed by timing, so the same texts come in
+// different batches from run to run; each text is answered the same way
+// whichever batch it comes in, or whether it comes alone.
+func (r *ReplayAIClient) AnalyzeBatch(ctx context.Context, req AnalyzeBatchRequest) (*AnalyzeBatchResponse, error) {
+	keys := make([]string, len(req.Texts))
+	for i, text := range req.Texts {
+		key, err := r.key("/analyze-text", AnalyzeTextRequest{Text: text})
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = key
+	}
+
+	if r.mode == AIReplayReplay {
+		results := make([]*AnalyzeTextResponse, len(keys))
+		for i, key := range keys {
+			if err := r.replay("/analyze-text", key, &results[i]); err != nil {
+				return nil, err
+			}
+		}
+		return &AnalyzeBatchResponse{Results: results, Count: len(results)}, nil
+	}
+
+	resp, err := r.ai.AnalyzeBatch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Results) != len(keys) {
+		// Results that cannot be matched to their texts are not recorded
+		return resp, nil
+	}
+	for i, result := range resp.Results {
+		r.record("/analyze-text", keys[i], result)
+	}
+	return resp, nil
+}
+
+func (r *ReplayAIClient) GenerateEmbedding(ctx context.Context, req EmbeddingRequest) (*EmbeddingResponse, error) {
+	var resp *EmbeddingResponse
+	err := r.exchange("/generate-embeddings", req, &resp, func() (err error) {
+		resp, err = r.ai.GenerateEmbedding(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (r *ReplayAIClient) CheckContract(ctx context.Context) (*AIContractReport, error) {
+	var resp *AIContractReport
+	err := r.exchange("/ai-contract-check", nil, &resp, func() (err error) {
+		resp, err = r.ai.CheckContract(ctx)
+		return err
+	})
+	return resp, err
+}
+
+// extractTextKey identifies an /extract-text request: the document is
+// keyed by its digest, read as it is sent when recording
+type extractTextKey struct {
+	Filename      string
+	ContentType   string
+	ContentSHA256 string
+	Pages         []int
+	Thorough      bool
+}
+
+func (r *ReplayAIClient) ExtractText(ctx context.Context, req ExtractTextRequest) (*ExtractTextResponse, error) {
+	digest := sha256.New()
+	key := extractTextKey{Filename: req.Filename, ContentType: req.ContentType, Pages: req.Pages, Thorough: req.Thorough}
+	if r.mode == AIReplayReplay {
+		if _, err := io.Copy(digest, req.Content); err != nil {
+			return nil, fmt.Errorf("failed to read document: %v", err)
+		}
+		key.ContentSHA256 = hex.EncodeToString(digest.Sum(nil))
+		hash, err := r.key("/extract-text", key)
+		if err != nil {
+			return nil, err
+		}
+		var resp *ExtractTextResponse
+		if err := r.replay("/extract-text", hash, &resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	content := req.Content
+	req.Content = io.TeeReader(content, digest)
+	resp, err := r.ai.ExtractText(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// The service may answer before reading the whole document
+	if _, err := io.Copy(digest, content); err != nil {
+		log.Printf("Failed to record /extract-text response: %v", err)
+		return resp, nil
+	}
+	key.ContentSHA256 = hex.EncodeToString(digest.Sum(nil))
+	hash, err := r.key("/extract-text", key)
+	if err != nil {
+		return nil, err
+	}
+	r.record("/extract-text", hash, resp)
+	return resp, nil
+}
+
+// exchange serves out from the recording of the request when replaying,
+// and otherwise calls the client and records what it set out to
+func (r *ReplayAIClient) exchange(endpoint string, req interface{}, out interface{}, call func() error) error {
+	key, err := r.key(endpoint, req)
+	if err != nil {
+		return err
+	}
+	if r.mode == AIReplayReplay {
+		return r.replay(endpoint, key, out)
+	}
+	if err := call(); err != nil {
+		return err
+	}
+	r.record(endpoint, key, out)
+	return nil
+}
+
+// key hashes the endpoint with the request encoded as JSON. Go encodes
+// struct fields in declaration order and map keys sorted, so equal requests
+// always hash alike. A request that cannot be encoded, such as one holding
+// a NaN, cannot be keyed and fails the call.
+func (r *ReplayAIClient) key(endpoint string, req interface{}) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(endpoint))
+	h.Write([]byte{0})
+	if err := json.NewEncoder(h).Encode(req); err != nil {
+		return "", fmt.Errorf("failed to encode %s request: %w", endpoint, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// path is the file of a recording, grouped by endpoint
+func (r *ReplayAIClient) path(endpoint, key string) string {
+	return filepath.Join(r.dir, strings.Trim(endpoint, "/"), key+".json")
+}
+
+func (r *ReplayAIClient) replay(endpoint, key string, out interface{}) error {
+	data, err := os.ReadFile(r.path(endpoint, key))
+	if errors.Is(err, os.ErrNotExist) {
+		metrics.AIReplays.WithLabelValues(endpoint, "miss").Inc()
+		err := &AIReplayMissError{Endpoint: endpoint, Key: key}
+		logging.AI.Warnf("%v", err)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read recorded %s response: %v", endpoint, err)
+	}
+	var recording aiRecording
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return fmt.Errorf("failed to decode recorded %s response %s: %v", endpoint, key, err)
+	}
+	if err := json.Unmarshal(recording.Response, out); err != nil {
+		return fmt.Errorf("failed to decode recorded %s response %s: %v", endpoint, key, err)
+	}
+	metrics.AIReplays.WithLabelValues(endpoint, "hit").Inc()
+	return nil
+}
+
+// record writes the response of a request. A failure is only logged: the
+// response was served, and the request is recorded the next time it is made.
+func (r *ReplayAIClient) record(endpoint, key string, out interface{}) {
+	if err := r.write(endpoint, key, out); err != nil {
+		log.Printf("Failed to record %s response: %v", endpoint, err)
+		return
+	}
+	metrics.AIReplays.WithLabelValues(endpoint, "recorded").Inc()
+}
+
+func (r *ReplayAIClient) write(endpoint, key string, out interface{}) error {
+	response, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	// Not indented: that would reformat the raw JSON within responses,
+	// which are replayed byte for byte
+	data, err := json.Marshal(aiRecording{
+		Endpoint:   endpoint,
+		Key:        key,
+		RecordedAt: time.Now().UTC(),
+		Response:   response,
+	})
+	if err != nil {
+		return err
+	}
+
+	path := r.path(endpoint, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Written aside and renamed into place, so a replay never reads half a
+	// recording
+	file, err := os.CreateTemp(filepath.Dir(path), ".recording-")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AnalysisCacheKey identifies the result of analyzer for text. Texts that
+// differ only in whitespace, such as the same document extracted from a
+// scan and from a PDF, share a key.
+func AnalysisCacheKey(analyzer Analyzer, text string) string {
+	hash := sha256.New()
+	hash.Write([]byte(analyzer.Name() + "\x00" + analyzer.ModelVersion() + "\x00"))
+	hash.Write([]byte(strings.Join(strings.Fields(text), " ")))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// GetCachedAnalysis returns the result cached under key since notBefore, or
+// nil when there is none, and counts the hit
+func (d *DatabaseService) GetCachedAnalysis(key string, notBefore time.Time) (*AnalyzeTextResponse, error) {
+	var provider, modelVersion, response string
+	err := d.db.QueryRow(`
+		UPDATE analysis_cache SET hits = hits + 1, last_used_at = CURRENT_TIMESTAMP
+		WHERE cache_key = $1 AND created_at >= $2
+		RETURNING provider, model_version, response`, key, d.db.dialect.timeArg(notBefore)).Scan(&provider, &modelVersion, &response)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached analysis: %v", err)
+	}
+
+	analysis := &AnalyzeTextResponse{}
+	if err := json.Unmarshal([]byte(response), analysis); err != nil {
+		return nil, fmt.Errorf("failed to decode cached analysis: %v", err)
+	}
+	analysis.Provider = provider
+	analysis.ModelVersion = modelVersion
+	analysis.Cached = true
+	return analysis, nil
+}
+
+// CacheAnalysis stores the result of analyzer under key, replacing an
+// expired one
+func (d *DatabaseService) CacheAnalysis(key string, analyzer Analyzer, analysis *AnalyzeTextResponse) error {
+	response, err := json.Marshal(analysis)
+	if err != nil {
+		return err
+	}
+	_, err = d.db.Exec(`
+		INSERT INTO analysis_cache (cache_key, provider, model_version, response) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (cache_key) DO UPDATE SET response = excluded.response, hits = 0,
+			created_at = CURRENT_TIMESTAMP, last_used_at = CURRENT_TIMESTAMP`,
+		key, analysis.Provider, analyzer.ModelVersion(), string(response))
+	if err != nil {
+		return fmt.Errorf("failed to cache analysis: %v", err)
+	}
+	return nil
+}
+
+// PurgeAnalysisCache deletes results cached before before and returns how
+// many were deleted
+func (d *DatabaseService) PurgeAnalysisCache(before time.Time) (int64, error) {
+	result, err := d.db.Exec(`DELETE FROM analysis_cache WHERE created_at < $1`, d.db.dialect.timeArg(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge analysis cache: %v", err)
+	}
+	return result.RowsAffected()
+}
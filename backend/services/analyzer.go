@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// Analyzer providers selectable with ANALYZER_PROVIDER and
+// ANALYZER_TENANT_PROVIDERS
+const (
+	ProviderFastAPI = "fastapi"
+	ProviderOpenAI  = "openai"
+	ProviderRules   = "rules"
+	ProviderONNX    = "onnx"
+)
+
+// Analyzer scores document text for fraud. Every provider returns the
+// AnalyzeTextResponse shape of the AI service contract. ModelVersion
+// identifies the model behind the provider, so that cached results of
+// another model are not reused.
+type Analyzer interface {
+	Name() string
+	ModelVersion() string
+	Analyze(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error)
+}
+
+// AnalyzerSet holds the configured providers and picks one per tenant.
+// Results are cached for cacheTTL; zero disables the cache.
+type AnalyzerSet struct {
+	defaultName string
+	cacheTTL    time.Duration
+	tenants     map[string]string
+	analyzers   map[string]Analyzer
+	hasFallback bool
+}
+
+// NewAnalyzerSet builds the providers named in cfg. The FastAPI provider uses
+// ai; the OpenAI provider is only available when OPENAI_BASE_URL is set. When
+// cfg.Fallback is set the remote providers are wrapped in a FallbackAnalyzer.
+// It fails if the default or a tenant override names an unavailable provider.
+func NewAnalyzerSet(cfg config.AnalyzerConfig, ai AIClient) (*AnalyzerSet, error) {
+	set := &AnalyzerSet{
+		defaultName: cfg.Provider,
+		cacheTTL:    cfg.CacheTTL,
+		tenants:     cfg.Tenants,
+		analyzers: map[string]Analyzer{
+			ProviderFastAPI: NewFastAPIAnalyzer(ai, cfg.FastAPIModelVersion),
+			ProviderRules:   NewRulesAnalyzer(),
+		},
+	}
+	if cfg.OpenAI.BaseURL != "" {
+		set.analyzers[ProviderOpenAI] = NewOpenAIAnalyzer(cfg.OpenAI)
+	}
+
+	if cfg.Fallback != "" {
+		fallback, err := newFallback(cfg)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range []string{ProviderFastAPI, ProviderOpenAI} {
+			if primary, ok := set.analyzers[name]; ok {
+				set.analyzers[name] = NewFallbackAnalyzer(primary, fallback)
+			}
+		}
+		set.hasFallback = true
+	}
+
+	if _, ok := set.analyzers[set.defaultName]; !ok {
+		return nil, fmt.Errorf("unknown analyzer provider %q (available: %s)", set.defaultName, set.available())
+	}
+	for tenant, name := range set.tenants {
+		if _, ok := set.analyzers[name]; !ok {
+			return nil, fmt.Errorf("unknown analyzer provider %q for tenant %s (available: %s)", name, tenant, set.available())
+		}
+	}
+	return set, nil
+}
+
+func newFallback(cfg config.AnalyzerConfig) (Analyzer, error) {
+	switch cfg.Fallback {
+	case ProviderRules:
+		return NewRulesAnalyzer(), nil
+	case ProviderONNX:
+		analyzer, err := NewONNXAnalyzer(cfg.ONNX)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load onnx fallback: %v", err)
+		}
+		return analyzer, nil
+	default:
+		return nil, fmt.Errorf("unknown analyzer fallback %q (expected onnx or rules)", cfg.Fallback)
+	}
+}
+
+// HasFallback reports whether remote providers fall back to a local analyzer
+func (s *AnalyzerSet) HasFallback() bool {
+	return s.hasFallback
+}
+
+// DefaultAnalyzerSet uses the FastAPI provider for every tenant, without
+// caching results
+func DefaultAnalyzerSet(ai AIClient) *AnalyzerSet {
+	return &AnalyzerSet{
+		defaultName: ProviderFastAPI,
+		analyzers:   map[string]Analyzer{ProviderFastAPI: NewFastAPIAnalyzer(ai, "")},
+	}
+}
+
+// CacheTTL is how long analysis results are reused for the same text; zero
+// when they are not
+func (s *AnalyzerSet) CacheTTL() time.Duration {
+	return s.cacheTTL
+}
+
+// ForTenant returns the analyzer configured for the tenant slug. An empty
+// slug (documents not owned by a tenant) gets the default provider.
+func (s *AnalyzerSet) ForTenant(slug string) Analyzer {
+	if name, ok := s.tenants[slug]; ok && slug != "" {
+		return s.analyzers[name]
+	}
+	return s.analyzers[s.defaultName]
+}
+
+// Named returns the provider with the given name, whichever tenants use it
+func (s *AnalyzerSet) Named(name string) (Analyzer, error) {
+	analyzer, ok := s.analyzers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown analyzer provider %q (available: %s)", name, s.available())
+	}
+	return analyzer, nil
+}
+
+func (s *AnalyzerSet) available() string {
+	names := make([]string, 0, len(s.analyzers))
+	for name := range s.analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// FastAPIAnalyzer delegates to the Python AI service. The service does not
+// report its fraud model, so the model version is configured.
+type FastAPIAnalyzer struct {
+	ai           AIClient
+	modelVersion string
+}
+
+func NewFastAPIAnalyzer(ai AIClient, modelVersion string) *FastAPIAnalyzer {
+	return &FastAPIAnalyzer{ai: ai, modelVersion: modelVersion}
+}
+
+func (a *FastAPIAnalyzer) Name() string {
+	return ProviderFastAPI
+}
+
+func (a *FastAPIAnalyzer) ModelVersion() string {
+	return a.modelVersion
+}
+
+func (a *FastAPIAnalyzer) Analyze(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	resp, err := a.ai.AnalyzeText(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Provider = ProviderFastAPI
+	resp.ModelVersion = a.modelVersion
+	return resp, nil
+}
+
+// NewFraudAnalysis converts an analyzer result into the record stored on the
+// document the text was extracted from. The risk level is taken from the
+// tenant's taxonomy by score rather than from the analyzer's own label.
+func NewFraudAnalysis(text string, resp *AnalyzeTextResponse, taxonomy *RiskTaxonomy) *FraudAnalysis {
+	return &FraudAnalysis{
+		FraudScore:      *resp.FraudScore,
+		RiskLevel:       taxonomy.LevelForScore(*resp.FraudScore).Name,
+		ExtractedText:   text,
+		EmotionAnalysis: AnalysisJSON(resp.EmotionAnalysis),
+		PatternAnalysis: AnalysisJSON(resp.PatternAnalysis),
+		Provider:        resp.Provider,
+		ModelVersion:    resp.ModelVersion,
+		ModelScore:      *resp.FraudScore,
+		Fallback:        resp.Fallback,
+		Cached:          resp.Cached,
+	}
+}
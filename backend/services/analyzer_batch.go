@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"frauddocai-backend/metrics"
+)
+
+// BatchAnalyzer is implemented by analyzers that can score several texts in
+// one call. Results are returned in request order.
+type BatchAnalyzer interface {
+	Analyzer
+	AnalyzeBatch(ctx context.Context, reqs []AnalyzeTextRequest) ([]*AnalyzeTextResponse, error)
+}
+
+func (a *FastAPIAnalyzer) AnalyzeBatch(ctx context.Context, reqs []AnalyzeTextRequest) ([]*AnalyzeTextResponse, error) {
+	texts := make([]string, len(reqs))
+	for i, req := range reqs {
+		texts[i] = req.Text
+	}
+	resp, err := a.ai.AnalyzeBatch(ctx, AnalyzeBatchRequest{Texts: texts})
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range resp.Results {
+		result.Provider = ProviderFastAPI
+		result.ModelVersion = a.modelVersion
+	}
+	return resp.Results, nil
+}
+
+// AnalyzeBatch batches through the primary when it supports it. While the
+// primary is unavailable every text is scored by the fallback instead.
+func (a *FallbackAnalyzer) AnalyzeBatch(ctx context.Context, reqs []AnalyzeTextRequest) ([]*AnalyzeTextResponse, error) {
+	primary, ok := a.primary.(BatchAnalyzer)
+	if !ok {
+		return analyzeEach(ctx, a, reqs)
+	}
+
+	results, err := primary.AnalyzeBatch(ctx, reqs)
+	if err == nil || !errors.Is(err, ErrAIServiceUnavailable) {
+		return results, err
+	}
+
+	results, fallbackErr := analyzeEach(ctx, a.fallback, reqs)
+	if fallbackErr != nil {
+		return nil, errors.Join(err, fallbackErr)
+	}
+	for _, result := range results {
+		result.Provider = a.fallback.Name()
+		result.Fallback = true
+	}
+	metrics.AnalyzerFallbacks.WithLabelValues(a.primary.Name(), a.fallback.Name()).Add(float64(len(results)))
+	return results, nil
+}
+
+func analyzeEach(ctx context.Context, analyzer Analyzer, reqs []AnalyzeTextRequest) ([]*AnalyzeTextResponse, error) {
+	results := make([]*AnalyzeTextResponse, len(reqs))
+	for i, req := range reqs {
+		result, err := analyzer.Analyze(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// AnalysisJob is one text queued for scoring. Done is called exactly once
+// with the job's result.
+type AnalysisJob struct {
+	Analyzer Analyzer
+	Request  AnalyzeTextRequest
+	Done     func(*AnalyzeTextResponse, error)
+}
+
+// BatchCoordinator groups queued analysis jobs into batches. A batch is sent
+// when it reaches size jobs or wait has passed since its first job, and its
+// results are handed back to each job's Done callback.
+type BatchCoordinator struct {
+	jobs     chan *AnalysisJob
+	size     int
+	wait     time.Duration
+	inFlight chan struct{}
+}
+
+// NewBatchCoordinator creates a coordinator running at most concurrency
+// batches at a time
+func NewBatchCoordinator(size int, wait time.Duration, concurrency int) *BatchCoordinator {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &BatchCoordinator{
+		jobs:     make(chan *AnalysisJob, size*concurrency*2),
+		size:     size,
+		wait:     wait,
+		inFlight: make(chan struct{}, concurrency),
+	}
+}
+
+// Submit queues a job, blocking while the queue is full
+func (c *BatchCoordinator) Submit(job *AnalysisJob) {
+	c.jobs <- job
+}
+
+// Run collects and dispatches batches until ctx is cancelled
+func (c *BatchCoordinator) Run(ctx context.Context) {
+	for {
+		var batch []*AnalysisJob
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-c.jobs:
+			batch = append(batch, job)
+		}
+
+		timer := time.NewTimer(c.wait)
+	collect:
+		for len(batch) < c.size {
+			select {
+			case job := <-c.jobs:
+				batch = append(batch, job)
+			case <-timer.C:
+				break collect
+			case <-ctx.Done():
+				break collect
+			}
+		}
+		timer.Stop()
+
+		c.inFlight <- struct{}{}
+		go func(batch []*AnalysisJob) {
+			defer func() { <-c.inFlight }()
+			c.dispatch(ctx, batch)
+		}(batch)
+	}
+}
+
+// dispatch sends each analyzer its share of the batch
+func (c *BatchCoordinator) dispatch(ctx context.Context, batch []*AnalysisJob) {
+	groups := map[Analyzer][]*AnalysisJob{}
+	var order []Analyzer
+	for _, job := range batch {
+		if _, ok := groups[job.Analyzer]; !ok {
+			order = append(order, job.Analyzer)
+		}
+		groups[job.Analyzer] = append(groups[job.Analyzer], job)
+	}
+
+	for _, analyzer := range order {
+		jobs := groups[analyzer]
+		metrics.AnalyzerBatchSize.WithLabelValues(analyzer.Name()).Observe(float64(len(jobs)))
+
+		batchAnalyzer, ok := analyzer.(BatchAnalyzer)
+		if !ok || len(jobs) == 1 {
+			for _, job := range jobs {
+				job.Done(analyzer.Analyze(ctx, job.Request))
+			}
+			continue
+		}
+
+		reqs := make([]AnalyzeTextRequest, len(jobs))
+		for i, job := range jobs {
+			reqs[i] = job.Request
+		}
+		results, err := batchAnalyzer.AnalyzeBatch(ctx, reqs)
+		for i, job := range jobs {
+			if err != nil {
+				job.Done(nil, err)
+				continue
+			}
+			job.Done(results[i], nil)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+)
+
+// FallbackAnalyzer uses primary and switches to fallback only while primary
+// is unavailable. Fallback results are flagged so they can be re-scored once
+// the primary provider recovers.
+type FallbackAnalyzer struct {
+	primary  Analyzer
+	fallback Analyzer
+}
+
+func NewFallbackAnalyzer(primary, fallback Analyzer) *FallbackAnalyzer {
+	return &FallbackAnalyzer{primary: primary, fallback: fallback}
+}
+
+func (a *FallbackAnalyzer) Name() string {
+	return a.primary.Name()
+}
+
+func (a *FallbackAnalyzer) ModelVersion() string {
+	return a.primary.ModelVersion()
+}
+
+func (a *FallbackAnalyzer) Analyze(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	resp, err := a.primary.Analyze(ctx, req)
+	if err == nil || !errors.Is(err, ErrAIServiceUnavailable) {
+		return resp, err
+	}
+
+	logging.AI.Warnf("Analyzer %s unavailable, using %s fallback: %v", a.primary.Name(), a.fallback.Name(), err)
+	resp, fallbackErr := a.fallback.Analyze(ctx, req)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("%w; %s fallback failed: %v", err, a.fallback.Name(), fallbackErr)
+	}
+	metrics.AnalyzerFallbacks.WithLabelValues(a.primary.Name(), a.fallback.Name()).Inc()
+	resp.Provider = a.fallback.Name()
+	resp.Fallback = true
+	return resp, nil
+}
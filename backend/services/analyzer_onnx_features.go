@@ -0,0 +1,43 @@
+package services
+
+import (
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// hashedFeatures turns text into the input vector expected by the ONNX
+// classifier: counts of lower-cased word unigrams and bigrams hashed with
+// FNV-1a into dims buckets, L2 normalized. Models must be trained with the
+// same featurization.
+func hashedFeatures(text string, dims int) []float32 {
+	features := make([]float32, dims)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	add := func(token string) {
+		h := fnv.New32a()
+		h.Write([]byte(token))
+		features[h.Sum32()%uint32(dims)]++
+	}
+	for i, word := range words {
+		add(word)
+		if i > 0 {
+			add(words[i-1] + " " + word)
+		}
+	}
+
+	var norm float64
+	for _, f := range features {
+		norm += float64(f) * float64(f)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range features {
+			features[i] *= scale
+		}
+	}
+	return features
+}
@@ -0,0 +1,33 @@
+//go:build !onnx
+
+package services
+
+import (
+	"context"
+	"errors"
+
+	"frauddocai-backend/config"
+)
+
+// ONNXSupported reports whether the binary was built with the onnx tag
+const ONNXSupported = false
+
+// ONNXAnalyzer is unavailable in this build. Rebuild with -tags onnx (cgo and
+// the onnxruntime shared library are required) to enable it.
+type ONNXAnalyzer struct{}
+
+func NewONNXAnalyzer(cfg config.ONNXConfig) (*ONNXAnalyzer, error) {
+	return nil, errors.New("ONNX support is not compiled in, rebuild with -tags onnx")
+}
+
+func (a *ONNXAnalyzer) Name() string {
+	return ProviderONNX
+}
+
+func (a *ONNXAnalyzer) ModelVersion() string {
+	return ""
+}
+
+func (a *ONNXAnalyzer) Analyze(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	return nil, errors.New("ONNX support is not compiled in")
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/logging"
+)
+
+// openAIMaxChars bounds the document text sent in a single prompt
+const openAIMaxChars = 16000
+
+const openAISystemPrompt = `You are a fraud analyst reviewing financial documents.
+Respond with a single JSON object and nothing else, using these fields:
+  "fraud_score": number between 0 and 1
+  "risk_level": one of "LOW", "MEDIUM", "HIGH", "CRITICAL"
+  "patterns": array of short strings naming the fraud indicators found
+  "reasoning": one or two sentences explaining the score`
+
+// OpenAIAnalyzer asks an OpenAI-compatible chat completions endpoint to score
+// the text. Any server implementing /chat/completions works, including
+// self-hosted ones.
+type OpenAIAnalyzer struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+func NewOpenAIAnalyzer(cfg config.OpenAIConfig) *OpenAIAnalyzer {
+	return &OpenAIAnalyzer{
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:  cfg.APIKey,
+		model:   cfg.Model,
+		client:  &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (a *OpenAIAnalyzer) Name() string {
+	return ProviderOpenAI
+}
+
+func (a *OpenAIAnalyzer) ModelVersion() string {
+	return a.model
+}
+
+func (a *OpenAIAnalyzer) Analyze(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	start := time.Now()
+
+	text := req.Text
+	if len(text) > openAIMaxChars {
+		text = text[:openAIMaxChars]
+	}
+	if d := DiagnosticsFrom(ctx); d != nil {
+		d.RecordChunk("/chat/completions", 0, len(text), len(req.Text))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":           a.model,
+		"temperature":     0,
+		"response_format": map[string]string{"type": "json_object"},
+		"messages": []map[string]string{
+			{"role": "system", "content": openAISystemPrompt},
+			{"role": "user", "content": text},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if a.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	exchange := beginExchange(ctx, ProviderOpenAI, httpReq)
+	started := time.Now()
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		exchange.finish(0, nil, err)
+		logging.AI.Debugf("POST %s/chat/completions (%s) failed after %v: %v", a.baseURL, a.model, time.Since(started).Round(time.Millisecond), err)
+		return nil, fmt.Errorf("%w: %v", ErrAIServiceUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	exchange.finish(resp.StatusCode, respBody, err)
+	logging.AI.Debugf("POST %s/chat/completions (%s): %d, %d bytes in %v", a.baseURL, a.model, resp.StatusCode, len(respBody), time.Since(started).Round(time.Millisecond))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAI response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		statusErr := &AIStatusError{StatusCode: resp.StatusCode, Detail: strings.TrimSpace(string(respBody))}
+		if resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %v", ErrAIServiceUnavailable, statusErr)
+		}
+		return nil, statusErr
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(respBody, &completion); err != nil || len(completion.Choices) == 0 {
+		return nil, &AIContractError{Endpoint: "/chat/completions", Problems: []string{"response has no choices"}}
+	}
+
+	var verdict struct {
+		FraudScore *float64 `json:"fraud_score"`
+		RiskLevel  string   `json:"risk_level"`
+		Patterns   []string `json:"patterns"`
+		Reasoning  string   `json:"reasoning"`
+	}
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &verdict); err != nil {
+		return nil, &AIContractError{Endpoint: "/chat/completions", Problems: []string{"model output is not JSON: " + err.Error()}}
+	}
+
+	patternAnalysis, err := json.Marshal(map[string]string{
+		"provider":  ProviderOpenAI,
+		"model":     a.model,
+		"reasoning": verdict.Reasoning,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &AnalyzeTextResponse{
+		TextLength:       len(req.Text),
+		FraudScore:       verdict.FraudScore,
+		RiskLevel:        strings.ToUpper(verdict.RiskLevel),
+		Patterns:         verdict.Patterns,
+		PatternAnalysis:  patternAnalysis,
+		ProcessingTimeMs: float64(time.Since(start).Milliseconds()),
+		Timestamp:        time.Now().UTC().Format(time.RFC3339),
+		Provider:         ProviderOpenAI,
+		ModelVersion:     a.model,
+	}
+	if err := result.Validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
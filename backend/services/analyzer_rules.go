@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rulesVersion is bumped when fraudKeywords or the scoring change
+const rulesVersion = "1"
+
+// fraudKeywords mirrors the keyword categories of the AI service's pattern
+// based detection so rules-only scores are comparable
+var fraudKeywords = map[string][]string{
+	"urgency":         {"urgent", "immediate", "asap", "emergency", "critical", "rush"},
+	"confidentiality": {"confidential", "secret", "do not share", "private", "exclusive"},
+	"payment":         {"wire transfer", "offshore", "bitcoin", "gift cards", "western union"},
+	"amount":          {"amount", "total", "sum", "cost", "price", "payment"},
+}
+
+// RulesAnalyzer scores text with keyword rules only. It never sends document
+// text outside the backend, for tenants that cannot use external models.
+type RulesAnalyzer struct{}
+
+func NewRulesAnalyzer() *RulesAnalyzer {
+	return &RulesAnalyzer{}
+}
+
+func (a *RulesAnalyzer) Name() string {
+	return ProviderRules
+}
+
+// ModelVersion changes whenever the rules do
+func (a *RulesAnalyzer) ModelVersion() string {
+	return rulesVersion
+}
+
+func (a *RulesAnalyzer) Analyze(ctx context.Context, req AnalyzeTextRequest) (*AnalyzeTextResponse, error) {
+	start := time.Now()
+	text := strings.ToLower(req.Text)
+
+	type patternScore struct {
+		Pattern     string  `json:"pattern"`
+		Confidence  float64 `json:"confidence"`
+		Description string  `json:"description"`
+	}
+
+	categories := make([]string, 0, len(fraudKeywords))
+	for category := range fraudKeywords {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	var fraudScore float64
+	patterns := []string{}
+	scores := []patternScore{}
+	for _, category := range categories {
+		keywords := fraudKeywords[category]
+		var matches []string
+		for _, keyword := range keywords {
+			if strings.Contains(text, keyword) {
+				matches = append(matches, keyword)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		score := float64(len(matches)) / float64(len(keywords))
+		scores = append(scores, patternScore{
+			Pattern:     category,
+			Confidence:  score,
+			Description: fmt.Sprintf("Detected %d %s indicators", len(matches), category),
+		})
+		patterns = append(patterns, matches...)
+		fraudScore += score * 0.3
+	}
+	fraudScore = math.Min(fraudScore, 1.0)
+
+	var patternFraudScore float64
+	for _, s := range scores {
+		patternFraudScore += s.Confidence
+	}
+	if len(scores) > 0 {
+		patternFraudScore /= float64(len(scores))
+	}
+	patternAnalysis, err := json.Marshal(map[string]interface{}{
+		"patterns":            scores,
+		"pattern_fraud_score": patternFraudScore,
+		"provider":            ProviderRules,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fraudScore = math.Round(fraudScore*1000) / 1000
+	return &AnalyzeTextResponse{
+		TextLength:       len(req.Text),
+		FraudScore:       &fraudScore,
+		RiskLevel:        riskLevelForScore(fraudScore),
+		Patterns:         patterns,
+		PatternAnalysis:  patternAnalysis,
+		ProcessingTimeMs: float64(time.Since(start).Microseconds()) / 1000,
+		Timestamp:        time.Now().UTC().Format(time.RFC3339),
+		Provider:         ProviderRules,
+		ModelVersion:     rulesVersion,
+	}, nil
+}
+
+// riskLevelForScore uses the same thresholds as the AI service
+func riskLevelForScore(score float64) string {
+	switch {
+	case score >= 0.7:
+		return "HIGH"
+	case score >= 0.4:
+		return "MEDIUM"
+	default:
+		return "LOW"
+	}
+}
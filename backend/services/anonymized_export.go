@@ -0,0 +1,215 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of the identifiers pseudonymized in anonymized exports
+const (
+	PseudonymDocument = "document"
+	PseudonymTenant   = "tenant"
+	PseudonymTeam     = "team"
+)
+
+// AnonymizedDocument is a document of an anonymized export, safe to share
+// with people outside the fraud team such as those training models. IDs are
+// pseudonymized, personal data in text is replaced by tokens, and file
+// names, paths, uploaders and exact times are left out.
+type AnonymizedDocument struct {
+	ID               string                `json:"id"`
+	TenantID         *string               `json:"tenant_id"`
+	TeamID           *string               `json:"team_id"`
+	MimeType         string                `json:"mime_type"`
+	DocumentType     *string               `json:"document_type"`
+	Status           string                `json:"status"`
+	FraudScore       *float64              `json:"fraud_score"`
+	FraudRiskLevel   string                `json:"fraud_risk_level"`
+	ExtractedText    *string               `json:"extracted_text"`
+	PatternCount     int                   `json:"pattern_count"`
+	DominantEmotion  *string               `json:"dominant_emotion"`
+	AnalysisProvider *string               `json:"analysis_provider"`
+	Metadata         Metadata              `json:"metadata"`
+	EmotionAnalysis  *string               `json:"emotion_analysis,omitempty"`
+	PatternAnalysis  *string               `json:"pattern_analysis,omitempty"`
+	CreatedOn        string                `json:"created_on"`
+	Entities         []AnonymizedEntity    `json:"entities"`
+	Detections       []AnonymizedDetection `json:"detections"`
+}
+
+// AnonymizedEntity is an entity of an anonymized document. Values of the
+// kinds that identify a person are tokens.
+type AnonymizedEntity struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// AnonymizedDetection is a fraud detection of an anonymized document,
+// without its reviewer
+type AnonymizedDetection struct {
+	FraudPatternID     *string `json:"fraud_pattern_id"`
+	ConfidenceScore    float64 `json:"confidence_score"`
+	DetectionDetails   *string `json:"detection_details"`
+	IsFalsePositive    bool    `json:"is_false_positive"`
+	DispositionOutcome *string `json:"disposition_outcome"`
+}
+
+// AnonymizeExport turns an exported document into its anonymized form,
+// adding the pseudonyms used to seen, by token
+func (p *Pseudonymizer) AnonymizeExport(export *DocumentExport, seen map[string]Pseudonym) *AnonymizedDocument {
+	doc := export.Document
+	token := func(kind, value string) string {
+		pseudonym := p.Pseudonym(kind, value)
+		seen[pseudonym.Token] = pseudonym
+		return pseudonym.Token
+	}
+	optional := func(kind string, value *string) *string {
+		if value == nil {
+			return nil
+		}
+		t := token(kind, *value)
+		return &t
+	}
+	text := func(value *string) *string {
+		if value == nil {
+			return nil
+		}
+		anonymized := p.Anonymize(*value, seen)
+		return &anonymized
+	}
+
+	anonymized := &AnonymizedDocument{
+		ID:               token(PseudonymDocument, string(doc.ID)),
+		TenantID:         optional(PseudonymTenant, doc.TenantID),
+		TeamID:           optional(PseudonymTeam, doc.TeamID),
+		MimeType:         doc.MimeType,
+		DocumentType:     doc.DocumentType,
+		Status:           doc.Status,
+		FraudScore:       doc.FraudScore,
+		FraudRiskLevel:   doc.FraudRiskLevel,
+		ExtractedText:    text(doc.ExtractedText),
+		PatternCount:     doc.PatternCount,
+		DominantEmotion:  doc.DominantEmotion,
+		AnalysisProvider: doc.AnalysisProvider,
+		Metadata:         p.anonymizeValue(map[string]interface{}(doc.Metadata), seen).(map[string]interface{}),
+		EmotionAnalysis:  text(doc.EmotionAnalysis),
+		PatternAnalysis:  text(doc.PatternAnalysis),
+		CreatedOn:        doc.CreatedAt.UTC().Format("2006-01-02"),
+		Entities:         make([]AnonymizedEntity, 0, len(export.Entities)),
+		Detections:       make([]AnonymizedDetection, 0, len(export.Detections)),
+	}
+	for _, entity := range export.Entities {
+		value := entity.Value
+		if piiEntityKinds[entity.Kind] {
+			value = token(entity.Kind, entity.Value)
+		}
+		anonymized.Entities = append(anonymized.Entities, AnonymizedEntity{Kind: entity.Kind, Value: value})
+	}
+	for _, detection := range export.Detections {
+		anonymized.Detections = append(anonymized.Detections, AnonymizedDetection{
+			FraudPatternID:     detection.FraudPatternID,
+			ConfidenceScore:    detection.ConfidenceScore,
+			DetectionDetails:   text(detection.DetectionDetails),
+			IsFalsePositive:    detection.IsFalsePositive,
+			DispositionOutcome: detection.DispositionOutcome,
+		})
+	}
+	return anonymized
+}
+
+// anonymizeValue anonymizes the strings in a decoded JSON value, copying it
+func (p *Pseudonymizer) anonymizeValue(value interface{}, seen map[string]Pseudonym) interface{} {
+	switch v := value.(type) {
+	case string:
+		return p.Anonymize(v, seen)
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = p.anonymizeValue(item, seen)
+		}
+		return copied
+	case Metadata:
+		return p.anonymizeValue(map[string]interface{}(v), seen)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = p.anonymizeValue(item, seen)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// pseudonymVault is the table of the pseudonym vault. Postgres keeps it in
+// the vault schema, granted apart from the data it pseudonymizes; SQLite has
+// no schemas.
+func (d dialect) pseudonymVault() string {
+	if d == dialectSQLite {
+		return "pseudonym_vault"
+	}
+	return "vault.pseudonym_vault"
+}
+
+// SavePseudonyms adds pseudonyms to the vault. Tokens already there are
+// kept, since a token always stands for the same value.
+func (d *DatabaseService) SavePseudonyms(pseudonyms []Pseudonym) error {
+	if len(pseudonyms) == 0 {
+		return nil
+	}
+	return withRetry("save_pseudonyms", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, pseudonym := range pseudonyms {
+			_, err := tx.Exec(`
+				INSERT INTO `+d.db.dialect.pseudonymVault()+` (token, kind, value) VALUES ($1, $2, $3)
+				ON CONFLICT (token) DO NOTHING`, pseudonym.Token, pseudonym.Kind, pseudonym.Value)
+			if err != nil {
+				return fmt.Errorf("failed to save pseudonym %s: %w", pseudonym.Token, err)
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetPseudonym looks a token up in the vault. It returns sql.ErrNoRows when
+// the token is unknown.
+func (d *DatabaseService) GetPseudonym(token string) (*Pseudonym, error) {
+	pseudonym := &Pseudonym{}
+	err := d.db.QueryRow(`SELECT token, kind, value FROM `+d.db.dialect.pseudonymVault()+` WHERE token = $1`,
+		strings.Trim(token, "[]")).Scan(&pseudonym.Token, &pseudonym.Kind, &pseudonym.Value)
+	if err != nil {
+		return nil, err
+	}
+	return pseudonym, nil
+}
+
+// DeleteSubjectPseudonyms removes the vault entries of a data subject's
+// values, so that tokens shared before the subject was erased can no longer
+// be traced back to them
+func (d *DatabaseService) DeleteSubjectPseudonyms(subject DataSubject) (int64, error) {
+	entities := subject.entities()
+	if len(entities) == 0 {
+		return 0, nil
+	}
+	var args []interface{}
+	var matches []string
+	for _, entity := range entities {
+		args = append(args, entity[0], entity[1])
+		matches = append(matches, fmt.Sprintf("(kind = $%d AND value = $%d)", len(args)-1, len(args)))
+	}
+	var deleted int64
+	err := withRetry("delete_subject_pseudonyms", func() error {
+		result, err := d.db.Exec(`DELETE FROM `+d.db.dialect.pseudonymVault()+` WHERE `+strings.Join(matches, " OR "), args...)
+		if err != nil {
+			return err
+		}
+		deleted, err = result.RowsAffected()
+		return err
+	})
+	return deleted, err
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so a leaked one is easy to recognize
+const APIKeyPrefix = "fda_key_"
+
+// WelcomeAPIKeyName names the key a tenant gets when it signs up
+const WelcomeAPIKeyName = "Welcome key"
+
+// APIKey acts for a tenant, in place of the X-Tenant header, until it is
+// revoked. Only the SHA-256 of the key is kept.
+type APIKey struct {
+	ID         string     `json:"id"`
+	TenantID   string     `json:"tenant_id"`
+	Name       string     `json:"name"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NewAPIKey returns a random API key and the digest it is stored as
+func NewAPIKey() (key, digest string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key = APIKeyPrefix + hex.EncodeToString(b)
+	return key, TokenDigest(key), nil
+}
+
+const apiKeyColumns = `id, tenant_id, name, revoked_at, last_used_at, created_at`
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	key := &APIKey{}
+	if err := row.Scan(&key.ID, &key.TenantID, &key.Name, &key.RevokedAt, &key.LastUsedAt, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func createAPIKey(q rowQuerier, key *APIKey, keyDigest string) error {
+	err := q.QueryRow(`
+		INSERT INTO api_keys (tenant_id, name, key_sha256) VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		key.TenantID, key.Name, keyDigest,
+	).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %v", err)
+	}
+	return nil
+}
+
+// GetAPIKeys returns a tenant's API keys, newest first
+func (d *DatabaseService) GetAPIKeys(tenantID string) ([]*APIKey, error) {
+	rows, err := d.db.Query(`
+		SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE tenant_id = $1 ORDER BY created_at DESC, id`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %v", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKeyByDigest returns the API key of a digest, revoked ones
+// included, or sql.ErrNoRows
+func (d *DatabaseService) GetAPIKeyByDigest(keyDigest string) (*APIKey, error) {
+	return scanAPIKey(d.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE key_sha256 = $1`, keyDigest))
+}
+
+// MarkAPIKeyUsed records when an API key was last used
+func (d *DatabaseService) MarkAPIKeyUsed(id string, at time.Time) error {
+	_, err := d.db.Exec(`UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, d.db.dialect.timeArg(at))
+	return err
+}
+
+// RevokeAPIKey ends an API key at a time, keeping the time of an earlier
+// revocation. It returns sql.ErrNoRows for an unknown key.
+func (d *DatabaseService) RevokeAPIKey(id string, at time.Time) (*APIKey, error) {
+	return scanAPIKey(d.db.QueryRow(`
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2)
+		WHERE id = $1
+		RETURNING `+apiKeyColumns, id, d.db.dialect.timeArg(at)))
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PatternTypeApprovalOutsidePolicy is recorded for documents approved by
+// someone below the level their tenant's approval policy requires
+const PatternTypeApprovalOutsidePolicy = "approval_outside_policy"
+
+// Metadata keys the ERP connector supplies with approved documents. The
+// approver's level is taken from approver_level when set, and looked up in
+// the policy's approvers otherwise.
+const (
+	MetadataApprovedBy    = "approved_by"
+	MetadataApproverLevel = "approver_level"
+	defaultAmountField    = "amount"
+)
+
+// Confidence of approval policy detections: an approver whose level is
+// below the required one is certain, an approver the policy does not list
+// may only be missing from it
+const (
+	approvalBelowLevelConfidence = 0.9
+	approvalUnknownConfidence    = 0.6
+)
+
+// ApprovalRule requires approval by at least Level for documents of
+// DocumentType, or of every type when it is empty, whose amount reaches
+// MinAmount. AmountField names the metadata key holding the amount, amount
+// by default.
+type ApprovalRule struct {
+	DocumentType string  `json:"document_type,omitempty"`
+	AmountField  string  `json:"amount_field,omitempty"`
+	MinAmount    float64 `json:"min_amount"`
+	Level        string  `json:"level"`
+}
+
+// ApprovalPolicy is a customer's approval hierarchy: who may approve what
+// amount. Levels are listed from least to most authority.
+type ApprovalPolicy struct {
+	Levels    []string          `json:"levels"`
+	Approvers map[string]string `json:"approvers,omitempty"`
+	Rules     []ApprovalRule    `json:"rules"`
+}
+
+// ApprovalPolicyError lists the problems found in an approval policy
+type ApprovalPolicyError struct {
+	Problems []string
+}
+
+func (e *ApprovalPolicyError) Error() string {
+	return "invalid approval policy: " + strings.Join(e.Problems, "; ")
+}
+
+// rank returns the position of level among the policy's levels, or -1
+func (p *ApprovalPolicy) rank(level string) int {
+	for i, l := range p.Levels {
+		if strings.EqualFold(l, level) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Validate checks that levels are unique and that approvers and rules name
+// them
+func (p *ApprovalPolicy) Validate() error {
+	var problems []string
+	if len(p.Levels) == 0 {
+		problems = append(problems, "at least one level is required")
+	}
+	seen := map[string]bool{}
+	for i, level := range p.Levels {
+		key := strings.ToLower(strings.TrimSpace(level))
+		switch {
+		case key == "":
+			problems = append(problems, fmt.Sprintf("levels[%d] is required", i))
+		case len(level) > 50:
+			problems = append(problems, fmt.Sprintf("levels[%d] must be at most 50 characters", i))
+		case seen[key]:
+			problems = append(problems, fmt.Sprintf("levels[%d] %q is repeated", i, level))
+		}
+		seen[key] = true
+	}
+
+	approvers := make([]string, 0, len(p.Approvers))
+	for approver := range p.Approvers {
+		approvers = append(approvers, approver)
+	}
+	sort.Strings(approvers)
+	for _, approver := range approvers {
+		if strings.TrimSpace(approver) == "" {
+			problems = append(problems, "approver names must not be blank")
+		} else if p.rank(p.Approvers[approver]) < 0 {
+			problems = append(problems, fmt.Sprintf("approver %q has unknown level %q", approver, p.Approvers[approver]))
+		}
+	}
+
+	if len(p.Rules) == 0 {
+		problems = append(problems, "at least one rule is required")
+	}
+	for i, rule := range p.Rules {
+		if p.rank(rule.Level) < 0 {
+			problems = append(problems, fmt.Sprintf("rules[%d].level %q is not one of the levels", i, rule.Level))
+		}
+		if rule.MinAmount < 0 {
+			problems = append(problems, fmt.Sprintf("rules[%d].min_amount must not be negative", i))
+		}
+		if rule.AmountField != "" && !metadataKeyPattern.MatchString(rule.AmountField) {
+			problems = append(problems, fmt.Sprintf("rules[%d].amount_field %q is not a metadata key", i, rule.AmountField))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ApprovalPolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// Check compares a document's approval, as recorded in its metadata, with
+// the policy. It returns nil when the document was approved within policy,
+// or when no rule applies or it does not say who approved it.
+func (p *ApprovalPolicy) Check(documentType *string, md Metadata) *RiskFactor {
+	required, requiredRank := "", -1
+	var amount float64
+	for _, rule := range p.Rules {
+		if rule.DocumentType != "" && (documentType == nil || *documentType != rule.DocumentType) {
+			continue
+		}
+		field := rule.AmountField
+		if field == "" {
+			field = defaultAmountField
+		}
+		value, ok := md[field].(float64)
+		if !ok || value < rule.MinAmount {
+			continue
+		}
+		if rank := p.rank(rule.Level); rank > requiredRank {
+			required, requiredRank, amount = p.Levels[rank], rank, value
+		}
+	}
+	if requiredRank < 0 {
+		return nil
+	}
+
+	approver, _ := md[MetadataApprovedBy].(string)
+	level, _ := md[MetadataApproverLevel].(string)
+	if level == "" && approver != "" {
+		level = p.Approvers[approver]
+	}
+	if approver == "" && level == "" {
+		return nil
+	}
+
+	details := Metadata{
+		"amount":         amount,
+		"required_level": required,
+		"approved_by":    approver,
+		"approver_level": level,
+	}
+	rank := p.rank(level)
+	switch {
+	case rank < 0:
+		details["reason"] = "approver_level_unknown"
+		return &RiskFactor{PatternType: PatternTypeApprovalOutsidePolicy, Confidence: approvalUnknownConfidence, Details: details}
+	case rank < requiredRank:
+		details["reason"] = "approver_below_required_level"
+		return &RiskFactor{PatternType: PatternTypeApprovalOutsidePolicy, Confidence: approvalBelowLevelConfidence, Details: details}
+	}
+	return nil
+}
+
+func (p ApprovalPolicy) Value() (driver.Value, error) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (p *ApprovalPolicy) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("unsupported approval policy type %T", src)
+	}
+}
+
+// UpdateTenantApprovalPolicy replaces the tenant's approval policy; nil
+// stops checking its documents' approvals. Detections already recorded are
+// kept. It returns sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantApprovalPolicy(id string, policy *ApprovalPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET approval_policy = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, policy)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Actions that need a second reviewer's approval
+const (
+	ApprovalCloseAlert        = "close_alert"
+	ApprovalOverrideDetection = "override_detection"
+)
+
+// Approval states
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+)
+
+// PatternSeverityCritical is the fraud pattern severity whose detections can
+// only be overridden with approval
+const PatternSeverityCritical = "critical"
+
+var (
+	// ErrApprovalRequired is returned for an action that needs a second
+	// reviewer's approval
+	ErrApprovalRequired = errors.New("action requires approval by a second reviewer")
+	// ErrApprovalPending is returned when the target already has a pending
+	// approval
+	ErrApprovalPending = errors.New("an approval is already pending")
+	// ErrApprovalNotNeeded is returned for a target that is not critical or
+	// was already closed
+	ErrApprovalNotNeeded = errors.New("target does not need approval")
+	// ErrApprovalDecided is returned when deciding an approval twice
+	ErrApprovalDecided = errors.New("approval has already been decided")
+	// ErrNotApprover is returned when the user may not decide the approval:
+	// they requested it, are not a reviewer, or it awaits someone else
+	ErrNotApprover = errors.New("user may not decide this approval")
+)
+
+// Approval is a request to close a critical alert or override a critical
+// detection, waiting for or decided by a second reviewer
+type Approval struct {
+	ID          string  `json:"id"`
+	TenantID    *string `json:"tenant_id"`
+	Action      string  `json:"action"`
+	TargetID    string  `json:"target_id"`
+	RequestedBy string  `json:"requested_by"`
+	ApproverID  *string `json:"approver_id"`
+	Reason      *string `json:"reason"`
+	// Disposition is applied to the alert or detection when the approval is
+	// approved
+	Disposition        *string    `json:"disposition"`
+	DispositionOutcome *string    `json:"disposition_outcome"`
+	Status             string     `json:"status"`
+	DecidedBy          *string    `json:"decided_by"`
+	DecidedAt          *time.Time `json:"decided_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// ApprovalFilter narrows an approval listing. Zero values do not filter.
+type ApprovalFilter struct {
+	TenantID   *string
+	Status     string
+	ApproverID string
+	TargetID   string
+	Limit      int
+}
+
+const approvalColumns = `id, tenant_id, action, target_id, requested_by, approver_id, reason, disposition, disposition_outcome,
+	status, decided_by, decided_at, created_at`
+
+func scanApproval(row rowScanner) (*Approval, error) {
+	approval := &Approval{}
+	err := row.Scan(
+		&approval.ID, &approval.TenantID, &approval.Action, &approval.TargetID, &approval.RequestedBy,
+		&approval.ApproverID, &approval.Reason, &approval.Disposition, &approval.DispositionOutcome,
+		&approval.Status, &approval.DecidedBy, &approval.DecidedAt,
+		&approval.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// approvalTarget returns the tenant of an approval's target and whether the
+// target still needs approval: an unacknowledged critical alert, or a
+// detection of a critical pattern not yet marked a false positive. It
+// returns sql.ErrNoRows when there is no such target.
+func approvalTarget(q rowQuerier, action, targetID string) (*string, bool, error) {
+	var tenantID *string
+	var open bool
+	var err error
+	switch action {
+	case ApprovalCloseAlert:
+		var severity string
+		var acknowledgedAt *time.Time
+		err = q.QueryRow(`SELECT tenant_id, severity, acknowledged_at FROM alerts WHERE id = $1`, targetID).
+			Scan(&tenantID, &severity, &acknowledgedAt)
+		open = severity == AlertSeverityCritical && acknowledgedAt == nil
+	case ApprovalOverrideDetection:
+		var severity *string
+		var falsePositive bool
+		err = q.QueryRow(`
+			SELECT d.tenant_id, fp.severity, COALESCE(fd.is_false_positive, FALSE)
+			FROM document_fraud_detections fd
+			JOIN documents d ON d.id = fd.document_id
+			LEFT JOIN fraud_patterns fp ON fp.id = fd.fraud_pattern_id
+			WHERE fd.id = $1`, targetID).Scan(&tenantID, &severity, &falsePositive)
+		open = severity != nil && *severity == PatternSeverityCritical && !falsePositive
+	default:
+		return nil, false, fmt.Errorf("unknown approval action %q", action)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return tenantID, open, nil
+}
+
+// RequestApproval records a pending approval for closing a critical alert or
+// overriding a critical detection with the approval's disposition code. It
+// fills in the approval's tenant and disposition outcome, and returns
+// sql.ErrNoRows when there is no such target, a DispositionError for an
+// unknown code and ErrDispositionConflict for overriding a detection with a
+// fraud outcome.
+func (d *DatabaseService) RequestApproval(approval *Approval) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tenantID, open, err := approvalTarget(tx, approval.Action, approval.TargetID)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return ErrApprovalNotNeeded
+	}
+	if approval.Disposition == nil {
+		return &DispositionError{Problems: []string{"disposition is required"}}
+	}
+	disposition, err := dispositionFor(tx, tenantID, *approval.Disposition)
+	if err != nil {
+		return err
+	}
+	if approval.Action == ApprovalOverrideDetection {
+		override := true
+		if _, err := disposition.FalsePositive(&override); err != nil {
+			return err
+		}
+	}
+	var pending bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM approvals WHERE action = $1 AND target_id = $2 AND status = $3)`,
+		approval.Action, approval.TargetID, ApprovalPending).Scan(&pending)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return ErrApprovalPending
+	}
+
+	approval.TenantID = tenantID
+	approval.DispositionOutcome = &disposition.Outcome
+	approval.Status = ApprovalPending
+	err = tx.QueryRow(`
+		INSERT INTO approvals (tenant_id, action, target_id, requested_by, approver_id, reason, disposition, disposition_outcome, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`,
+		approval.TenantID, approval.Action, approval.TargetID, approval.RequestedBy,
+		approval.ApproverID, approval.Reason, approval.Disposition, approval.DispositionOutcome, approval.Status,
+	).Scan(&approval.ID, &approval.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetApproval returns the approval with the ID. It returns sql.ErrNoRows
+// when there is no such approval.
+func (d *DatabaseService) GetApproval(id string) (*Approval, error) {
+	return scanApproval(d.db.QueryRow(`SELECT `+approvalColumns+` FROM approvals WHERE id = $1`, id))
+}
+
+// GetApprovals lists approvals matching filter, newest first. Filtering by
+// approver also keeps the approvals any reviewer may decide.
+func (d *DatabaseService) GetApprovals(filter ApprovalFilter) ([]*Approval, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.TenantID != nil {
+		args = append(args, *filter.TenantID)
+		conditions = append(conditions, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.ApproverID != "" {
+		args = append(args, filter.ApproverID)
+		conditions = append(conditions, fmt.Sprintf("(approver_id = $%d OR approver_id IS NULL)", len(args)))
+	}
+	if filter.TargetID != "" {
+		args = append(args, filter.TargetID)
+		conditions = append(conditions, fmt.Sprintf("target_id = $%d", len(args)))
+	}
+	query := `SELECT ` + approvalColumns + ` FROM approvals`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY created_at DESC, id LIMIT $%d`, len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query approvals: %v", err)
+	}
+	defer rows.Close()
+
+	approvals := []*Approval{}
+	for rows.Next() {
+		approval, err := scanApproval(rows)
+		if err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, approval)
+	}
+	return approvals, rows.Err()
+}
+
+// DecideApproval approves or rejects a pending approval. Approving it closes
+// the alert, acknowledged by the requester, or marks the detection a false
+// positive reviewed by them, with the approval's disposition. The decider must be an analyst or admin other
+// than the requester, and the approver named on the request if there is
+// one. It returns sql.ErrNoRows when there is no such approval.
+func (d *DatabaseService) DecideApproval(id string, decider *User, approve bool) (*Approval, error) {
+	var approval *Approval
+	err := withRetry("decide_approval", func() error {
+		var err error
+		approval, err = d.decideApproval(id, decider, approve)
+		return err
+	})
+	return approval, err
+}
+
+func (d *DatabaseService) decideApproval(id string, decider *User, approve bool) (*Approval, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + approvalColumns + ` FROM approvals WHERE id = $1`
+	if d.db.dialect != dialectSQLite {
+		query += ` FOR UPDATE`
+	}
+	approval, err := scanApproval(tx.QueryRow(query, id))
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != ApprovalPending {
+		return nil, ErrApprovalDecided
+	}
+	if decider.ID == approval.RequestedBy || decider.Role == RoleUser ||
+		(approval.ApproverID != nil && *approval.ApproverID != decider.ID) {
+		return nil, ErrNotApprover
+	}
+
+	if approve {
+		switch approval.Action {
+		case ApprovalCloseAlert:
+			_, err = tx.Exec(`
+				UPDATE alerts SET acknowledged_by = $2, acknowledged_at = CURRENT_TIMESTAMP, disposition = $3, disposition_outcome = $4
+				WHERE id = $1 AND acknowledged_at IS NULL`,
+				approval.TargetID, approval.RequestedBy, approval.Disposition, approval.DispositionOutcome)
+		case ApprovalOverrideDetection:
+			_, err = tx.Exec(`
+				UPDATE document_fraud_detections SET is_false_positive = TRUE, reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP,
+				       disposition = $3, disposition_outcome = $4
+				WHERE id = $1`,
+				approval.TargetID, approval.RequestedBy, approval.Disposition, approval.DispositionOutcome)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	status := ApprovalRejected
+	if approve {
+		status = ApprovalApproved
+	}
+	approval, err = scanApproval(tx.QueryRow(`
+		UPDATE approvals SET status = $2, decided_by = $3, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+approvalColumns, id, status, decider.ID))
+	if err != nil {
+		return nil, err
+	}
+	return approval, tx.Commit()
+}
+
+// ReviewDetection records a reviewer's verdict on a detection with a code of
+// the tenant's disposition taxonomy. Whether the detection is a false
+// positive follows from the disposition's outcome; falsePositive is only
+// needed for inconclusive ones, and returns ErrDispositionConflict when it
+// contradicts the outcome. Marking a detection of a critical pattern a false
+// positive returns ErrApprovalRequired; it takes an approved
+// override_detection approval. It returns sql.ErrNoRows when there is no
+// such detection and a DispositionError for an unknown code.
+func (d *DatabaseService) ReviewDetection(id, reviewerID string, falsePositive *bool, disposition string) (*FraudDetection, error) {
+	tenantID, critical, err := approvalTarget(d.db, ApprovalOverrideDetection, id)
+	if err != nil {
+		return nil, err
+	}
+	chosen, err := dispositionFor(d.db, tenantID, disposition)
+	if err != nil {
+		return nil, err
+	}
+	verdict, err := chosen.FalsePositive(falsePositive)
+	if err != nil {
+		return nil, err
+	}
+	if verdict && critical {
+		return nil, ErrApprovalRequired
+	}
+
+	detection := &FraudDetection{}
+	err = d.db.QueryRow(`
+		UPDATE document_fraud_detections SET is_false_positive = $2, reviewed_by = $3, reviewed_at = CURRENT_TIMESTAMP,
+		       disposition = $4, disposition_outcome = $5
+		WHERE id = $1
+		RETURNING id, document_id, fraud_pattern_id, confidence_score, detection_details,
+		          is_false_positive, reviewed_by, reviewed_at, disposition, disposition_outcome, created_at`,
+		id, verdict, reviewerID, chosen.Code, chosen.Outcome,
+	).Scan(
+		&detection.ID, &detection.DocumentID, &detection.FraudPatternID, &detection.ConfidenceScore,
+		&detection.DetectionDetails, &detection.IsFalsePositive, &detection.ReviewedBy, &detection.ReviewedAt,
+		&detection.Disposition, &detection.DispositionOutcome, &detection.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return detection, nil
+}
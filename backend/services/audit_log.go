@@ -0,0 +1,90 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditLogEntry is one action recorded in the audit log, with the address
+// of the client that caused it when it came from a request
+type AuditLogEntry struct {
+	ID           string    `json:"id"`
+	UserID       *string   `json:"user_id"`
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   *string   `json:"resource_id"`
+	Details      Metadata  `json:"details"`
+	IPAddress    *string   `json:"ip_address"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AuditLogFilter selects audit log entries; empty fields match all
+type AuditLogFilter struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	UserID       string
+	IPAddress    string
+	Since        *time.Time
+	Limit        int
+}
+
+// GetAuditLog returns the entries matching filter, newest first
+func (d *DatabaseService) GetAuditLog(filter AuditLogFilter) ([]*AuditLogEntry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Action != "" {
+		where("action = $%d", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		where("resource_type = $%d", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		where("resource_id = $%d", filter.ResourceID)
+	}
+	if filter.UserID != "" {
+		where("user_id = $%d", filter.UserID)
+	}
+	if filter.IPAddress != "" {
+		where("ip_address = $%d", filter.IPAddress)
+	}
+	if filter.Since != nil {
+		where("created_at >= $%d", d.db.dialect.timeArg(*filter.Since))
+	}
+
+	// Postgres keeps addresses as inet, whose text form would append the
+	// prefix length to networks
+	address := "ip_address"
+	if d.db.dialect != dialectSQLite {
+		address = "host(ip_address)"
+	}
+	query := `SELECT id, user_id, action, resource_type, resource_id, details, ` + address + `, created_at FROM audit_logs`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id LIMIT $%d", len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []*AuditLogEntry{}
+	for rows.Next() {
+		var entry AuditLogEntry
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.ResourceType, &entry.ResourceID,
+			&entry.Details, &entry.IPAddress, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit log entry: %v", err)
+		}
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
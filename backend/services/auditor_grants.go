@@ -0,0 +1,199 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditorTokenPrefix starts every auditor token, so a leaked one is easy to
+// recognize
+const AuditorTokenPrefix = "fda_audit_"
+
+// Audit log actions of auditor requests: those served, and those refused for
+// a bad token or a resource outside the grant
+const (
+	AuditActionAuditorAccess = "auditor.access"
+	AuditActionAuditorDenied = "auditor.denied"
+)
+
+// AuditorScope is what an auditor grant opens: cases, with their linked
+// documents and evidence, and the document collections of teams
+type AuditorScope struct {
+	CaseIDs []string `json:"case_ids"`
+	TeamIDs []string `json:"team_ids"`
+}
+
+func (scope AuditorScope) Value() (driver.Value, error) {
+	b, err := json.Marshal(scope)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (scope *AuditorScope) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, scope)
+	case string:
+		return json.Unmarshal([]byte(v), scope)
+	default:
+		return fmt.Errorf("unsupported auditor scope type %T", src)
+	}
+}
+
+// AuditorGrant gives an external auditor read-only access to part of a
+// tenant's data until it expires or is revoked. Only the SHA-256 of its
+// token is kept.
+type AuditorGrant struct {
+	ID         string       `json:"id"`
+	TenantID   string       `json:"tenant_id"`
+	Auditor    string       `json:"auditor"`
+	Scope      AuditorScope `json:"scope"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	RevokedAt  *time.Time   `json:"revoked_at"`
+	LastUsedAt *time.Time   `json:"last_used_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+// Active reports whether the grant may be used at now
+func (g *AuditorGrant) Active(now time.Time) bool {
+	return g.RevokedAt == nil && now.Before(g.ExpiresAt)
+}
+
+// HasCase reports whether the grant opens the case
+func (g *AuditorGrant) HasCase(alertID string) bool {
+	for _, id := range g.Scope.CaseIDs {
+		if id == alertID {
+			return true
+		}
+	}
+	return false
+}
+
+// DocumentScope is the grant's team collections: the documents of the
+// granted teams, without those of no team
+func (g *AuditorGrant) DocumentScope() DocumentScope {
+	return DocumentScope{
+		TenantID:       &g.TenantID,
+		TeamRestricted: true,
+		TeamsOnly:      true,
+		TeamIDs:        g.Scope.TeamIDs,
+	}
+}
+
+// NewAuditorToken returns a random auditor token and the digest it is
+// stored as
+func NewAuditorToken() (token, digest string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate auditor token: %v", err)
+	}
+	token = AuditorTokenPrefix + hex.EncodeToString(b)
+	return token, TokenDigest(token), nil
+}
+
+const auditorGrantColumns = `id, tenant_id, auditor, scope, expires_at, revoked_at, last_used_at, created_at`
+
+func scanAuditorGrant(row rowScanner) (*AuditorGrant, error) {
+	grant := &AuditorGrant{}
+	err := row.Scan(&grant.ID, &grant.TenantID, &grant.Auditor, &grant.Scope, &grant.ExpiresAt,
+		&grant.RevokedAt, &grant.LastUsedAt, &grant.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// CreateAuditorGrant stores a grant under the digest of its token
+func (d *DatabaseService) CreateAuditorGrant(grant *AuditorGrant, tokenDigest string) error {
+	err := d.db.QueryRow(`
+		INSERT INTO auditor_grants (tenant_id, auditor, token_sha256, scope, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		grant.TenantID, grant.Auditor, tokenDigest, grant.Scope, d.db.dialect.timeArg(grant.ExpiresAt),
+	).Scan(&grant.ID, &grant.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create auditor grant: %v", err)
+	}
+	return nil
+}
+
+// GetAuditorGrants returns a tenant's auditor grants, newest first
+func (d *DatabaseService) GetAuditorGrants(tenantID string) ([]*AuditorGrant, error) {
+	rows, err := d.db.Query(`
+		SELECT `+auditorGrantColumns+` FROM auditor_grants
+		WHERE tenant_id = $1 ORDER BY created_at DESC, id`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auditor grants: %v", err)
+	}
+	defer rows.Close()
+
+	grants := []*AuditorGrant{}
+	for rows.Next() {
+		grant, err := scanAuditorGrant(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan auditor grant: %v", err)
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// GetAuditorGrantByToken returns the grant of a token digest, expired and
+// revoked ones included, or sql.ErrNoRows
+func (d *DatabaseService) GetAuditorGrantByToken(tokenDigest string) (*AuditorGrant, error) {
+	return scanAuditorGrant(d.db.QueryRow(`
+		SELECT `+auditorGrantColumns+` FROM auditor_grants WHERE token_sha256 = $1`, tokenDigest))
+}
+
+// RevokeAuditorGrant ends a grant at a time, keeping the time of an earlier
+// revocation. It returns sql.ErrNoRows for an unknown grant.
+func (d *DatabaseService) RevokeAuditorGrant(id string, at time.Time) (*AuditorGrant, error) {
+	return scanAuditorGrant(d.db.QueryRow(`
+		UPDATE auditor_grants SET revoked_at = COALESCE(revoked_at, $2)
+		WHERE id = $1
+		RETURNING `+auditorGrantColumns, id, d.db.dialect.timeArg(at)))
+}
+
+// AuditorAccess is one auditor request, as recorded in the audit log.
+// GrantID is empty for requests whose token matched no grant.
+type AuditorAccess struct {
+	GrantID      string
+	Action       string
+	ResourceType string
+	ResourceID   *string
+	Details      Metadata
+	IPAddress    *string
+	At           time.Time
+}
+
+// RecordAuditorAccess adds an auditor request to the audit log and marks
+// the grant used
+func (d *DatabaseService) RecordAuditorAccess(access *AuditorAccess) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO audit_logs (action, resource_type, resource_id, details, ip_address)
+		VALUES ($1, $2, $3, $4, $5)`,
+		access.Action, access.ResourceType, access.ResourceID, access.Details, access.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit auditor access: %v", err)
+	}
+	if access.GrantID != "" && access.Action == AuditActionAuditorAccess {
+		_, err = tx.Exec(`UPDATE auditor_grants SET last_used_at = $2 WHERE id = $1`,
+			access.GrantID, d.db.dialect.timeArg(access.At))
+		if err != nil {
+			return fmt.Errorf("failed to mark auditor grant %s used: %v", access.GrantID, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sizes of the sample a backtest re-scores
+const (
+	DefaultBacktestSample = 100
+	MaxBacktestSample     = 500
+)
+
+// BacktestDocument is a reviewed document of a backtest's sample, with the
+// channel it was submitted through and whether reviewers confirmed it as
+// fraud
+type BacktestDocument struct {
+	Document *Document
+	Channel  string
+	Fraud    bool
+}
+
+// BacktestCorpus is a sample of a tenant's reviewed documents. Reviewed
+// counts the documents it was drawn from.
+type BacktestCorpus struct {
+	Reviewed  int
+	Seed      int64
+	Documents []*BacktestDocument
+}
+
+// BacktestScoring is how a backtest turns analyzer scores into flags: the
+// score is weighted by channel and classified into a risk level, and
+// documents reaching FlagLevel count as flagged
+type BacktestScoring struct {
+	RiskTaxonomy   *RiskTaxonomy
+	ChannelWeights ChannelWeights
+	FlagLevel      string
+}
+
+// BacktestError lists the problems found in a backtest's scoring
+type BacktestError struct {
+	Problems []string
+}
+
+func (e *BacktestError) Error() string {
+	return "invalid backtest: " + strings.Join(e.Problems, "; ")
+}
+
+// BacktestMetrics compares the documents a scoring flagged with reviewers'
+// outcomes. Precision is nil until a document is flagged and recall until
+// one is confirmed as fraud.
+type BacktestMetrics struct {
+	TruePositives  int            `json:"true_positives"`
+	FalsePositives int            `json:"false_positives"`
+	FalseNegatives int            `json:"false_negatives"`
+	TrueNegatives  int            `json:"true_negatives"`
+	Precision      *float64       `json:"precision"`
+	Recall         *float64       `json:"recall"`
+	RiskLevels     map[string]int `json:"risk_levels"`
+}
+
+// Validate checks the taxonomy and channel weights, and that FlagLevel is
+// one of the taxonomy's levels
+func (s *BacktestScoring) Validate() error {
+	problems := sectionProblems("risk_taxonomy", s.RiskTaxonomy.Validate())
+	if len(problems) == 0 {
+		problems = append(problems, sectionProblems("flag_level", s.RiskTaxonomy.CheckLevel(s.FlagLevel))...)
+	}
+	problems = append(problems, sectionProblems("channel_weights", s.ChannelWeights.Validate())...)
+	if len(problems) > 0 {
+		return &BacktestError{Problems: problems}
+	}
+	return nil
+}
+
+// Classify weights a score by channel and returns its risk level, and
+// whether the level reaches FlagLevel
+func (s *BacktestScoring) Classify(score float64, channel string) (RiskLevel, bool) {
+	level := s.RiskTaxonomy.LevelForScore(s.ChannelWeights.Apply(score, channel))
+	for _, l := range s.RiskTaxonomy.Levels {
+		if l.Name == s.FlagLevel {
+			return level, level.MinScore >= l.MinScore
+		}
+	}
+	return level, false
+}
+
+// NewBacktestMetrics starts counting with every level of taxonomy at zero
+func NewBacktestMetrics(taxonomy *RiskTaxonomy) *BacktestMetrics {
+	metrics := &BacktestMetrics{RiskLevels: map[string]int{}}
+	for _, level := range taxonomy.Levels {
+		metrics.RiskLevels[level.Name] = 0
+	}
+	return metrics
+}
+
+// Add counts a document of level, flagged or not, against whether
+// reviewers confirmed it as fraud
+func (m *BacktestMetrics) Add(level string, flagged, fraud bool) {
+	m.RiskLevels[level]++
+	switch {
+	case flagged && fraud:
+		m.TruePositives++
+	case flagged:
+		m.FalsePositives++
+	case fraud:
+		m.FalseNegatives++
+	default:
+		m.TrueNegatives++
+	}
+	m.Precision = backtestRate(m.TruePositives, m.TruePositives+m.FalsePositives)
+	m.Recall = backtestRate(m.TruePositives, m.TruePositives+m.FalseNegatives)
+}
+
+func backtestRate(hits, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	rate := float64(hits) / float64(total)
+	return &rate
+}
+
+// GetBacktestCorpus draws a sample of at most size of the tenant's
+// documents uploaded since a time that have text and a reviewer-confirmed
+// outcome. A document is fraud when any review confirmed a detection on it
+// or closed an alert on it as fraud, and not fraud when its reviews only
+// found false positives. Inconclusive dispositions are not outcomes. The
+// same seed draws the same sample from the same documents.
+func (d *DatabaseService) GetBacktestCorpus(tenantID string, since time.Time, size int, seed int64) (*BacktestCorpus, error) {
+	rows, err := d.db.Query(`
+		SELECT o.document_id, MAX(o.fraud)
+		FROM (
+			SELECT document_id, CASE WHEN is_false_positive THEN 0 ELSE 1 END AS fraud
+			FROM document_fraud_detections
+			WHERE reviewed_at IS NOT NULL AND (disposition_outcome IS NULL OR disposition_outcome <> $3)
+			UNION ALL
+			SELECT document_id, CASE WHEN disposition_outcome = $4 THEN 1 ELSE 0 END
+			FROM alerts
+			WHERE document_id IS NOT NULL AND disposition_outcome IN ($4, $5)
+		) o
+		JOIN documents d ON d.id = o.document_id
+		WHERE d.tenant_id = $1 AND d.created_at >= $2 AND d.extracted_text IS NOT NULL AND d.deleted_at IS NULL
+		GROUP BY o.document_id
+		ORDER BY o.document_id`,
+		tenantID, d.db.dialect.timeArg(since), OutcomeInconclusive, OutcomeFraud, OutcomeNotFraud)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reviewed documents: %v", err)
+	}
+	defer rows.Close()
+
+	var ids []DocumentID
+	fraud := map[DocumentID]bool{}
+	for rows.Next() {
+		var id DocumentID
+		var confirmed int
+		if err := rows.Scan(&id, &confirmed); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		fraud[id] = confirmed == 1
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	corpus := &BacktestCorpus{Reviewed: len(ids), Seed: seed, Documents: []*BacktestDocument{}}
+	if len(ids) > size {
+		sampled := ids[:0:0]
+		for _, i := range rand.New(rand.NewSource(seed)).Perm(len(ids))[:size] {
+			sampled = append(sampled, ids[i])
+		}
+		sort.Slice(sampled, func(i, j int) bool { return sampled[i] < sampled[j] })
+		ids = sampled
+	}
+	if len(ids) == 0 {
+		return corpus, nil
+	}
+
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	rows, err = d.db.Query(`
+		SELECT `+documentColumns+`,
+			(SELECT channel FROM document_submissions s WHERE s.document_id = documents.id)
+		FROM documents
+		WHERE id IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sampled documents: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var channel *string
+		document, err := scanDocument(rows, &channel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %v", err)
+		}
+		sampled := &BacktestDocument{Document: document, Fraud: fraud[document.ID]}
+		if channel != nil {
+			sampled.Channel = *channel
+		}
+		corpus.Documents = append(corpus.Documents, sampled)
+	}
+	return corpus, rows.Err()
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupFormatVersion is bumped when the backup layout changes incompatibly
+const backupFormatVersion = 1
+
+var ErrBackupNotFound = errors.New("backup not found")
+
+var backupID = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// BackupManifest describes a backup and the SHA-256 of every file in it, so
+// a copy can be verified before it is restored. A backup is a directory:
+//
+//	manifest.json
+//	tables/<table>.ndjson   one JSON object per row
+//	objects/<document id>   the document's original file
+//	objects/evidence/<id>   a file attached to a case
+type BackupManifest struct {
+	ID            string                  `json:"id"`
+	FormatVersion int                     `json:"format_version"`
+	CreatedAt     time.Time               `json:"created_at"`
+	Tenants       []string                `json:"tenants"`
+	Snapshot      SnapshotInfo            `json:"snapshot"`
+	Tables        map[string]*BackupTable `json:"tables"`
+	Objects       []*BackupObject         `json:"objects"`
+}
+
+// BackupTable is the row file of one table
+type BackupTable struct {
+	File   string `json:"file"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+	// TimeColumns hold RFC 3339 timestamps
+	TimeColumns []string `json:"time_columns,omitempty"`
+}
+
+// BackupObject is the stored file of one document, or of one file attached
+// to a case when EvidenceID is set
+type BackupObject struct {
+	DocumentID  string `json:"document_id,omitempty"`
+	EvidenceID  string `json:"evidence_id,omitempty"`
+	File        string `json:"file"`
+	FilePath    string `json:"file_path"`
+	Region      string `json:"region,omitempty"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// BackupVerificationError lists the files of a backup that are missing or
+// do not match its manifest
+type BackupVerificationError struct {
+	Problems []string
+}
+
+func (e *BackupVerificationError) Error() string {
+	return "backup failed verification: " + strings.Join(e.Problems, "; ")
+}
+
+// BackupRestore reports what a restore inserted
+type BackupRestore struct {
+	ID      string         `json:"id"`
+	Tenants []string       `json:"tenants"`
+	Rows    map[string]int `json:"rows"`
+	Objects int            `json:"objects"`
+}
+
+// BackupService writes backups of whole tenants, their database rows and
+// their documents' files, to a directory and restores them into another
+// environment
+type BackupService struct {
+	store   Store
+	storage *RegionalStorage
+	dir     string
+}
+
+func NewBackupService(store Store, storage *RegionalStorage, dir string) *BackupService {
+	return &BackupService{store: store, storage: storage, dir: dir}
+}
+
+// Create backs up the tenants with the given slugs. The rows are read in one
+// transaction; the files are copied afterwards, which is safe because stored
+// files are never modified. The backup only appears in List once complete.
+func (b *BackupService) Create(ctx context.Context, tenants []string) (*BackupManifest, error) {
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	manifest := &BackupManifest{
+		FormatVersion: backupFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Tenants:       tenants,
+		Tables:        map[string]*BackupTable{},
+		Objects:       []*BackupObject{},
+	}
+	manifest.ID = manifest.CreatedAt.Format("20060102T150405Z")
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(b.dir, manifest.ID)); os.IsNotExist(err) {
+			break
+		}
+		manifest.ID = fmt.Sprintf("%s-%d", manifest.CreatedAt.Format("20060102T150405Z"), n)
+	}
+
+	work := filepath.Join(b.dir, manifest.ID+".partial")
+	if err := os.MkdirAll(filepath.Join(work, "tables"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(work, "objects", "evidence"), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %v", err)
+	}
+	err := b.create(ctx, manifest, work)
+	if err == nil {
+		err = os.Rename(work, filepath.Join(b.dir, manifest.ID))
+	}
+	if err != nil {
+		os.RemoveAll(work)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (b *BackupService) create(ctx context.Context, manifest *BackupManifest, work string) error {
+	w := &backupWriter{dir: work, manifest: manifest, files: map[string]*backupTableFile{}, tiers: map[string]string{}}
+	info, err := b.store.ExportTenants(manifest.Tenants, w)
+	if closeErr := w.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	manifest.Snapshot = *info
+
+	for _, object := range manifest.Objects {
+		if err := b.backupObject(ctx, work, object, w.tiers[object.DocumentID]); err != nil {
+			return fmt.Errorf("failed to back up %s: %v", object.describe(), err)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(work, "manifest.json"), data, 0o644)
+}
+
+// describe names the object in errors
+func (o *BackupObject) describe() string {
+	if o.EvidenceID != "" {
+		return "case evidence " + o.EvidenceID
+	}
+	return "file of document " + o.DocumentID
+}
+
+func (b *BackupService) backupObject(ctx context.Context, work string, object *BackupObject, tier string) error {
+	store, err := b.storage.ForTier(object.Region, tier)
+	if err != nil {
+		return err
+	}
+	reader, err := store.GetFile(ctx, object.FilePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	f, err := os.Create(filepath.Join(work, object.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, sum), reader)
+	if err != nil {
+		return err
+	}
+	object.Size = size
+	object.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return f.Close()
+}
+
+// backupWriter writes snapshot rows to one NDJSON file per table and
+// collects the documents whose files are backed up
+type backupWriter struct {
+	dir      string
+	manifest *BackupManifest
+	files    map[string]*backupTableFile
+	tiers    map[string]string
+}
+
+type backupTableFile struct {
+	f       *os.File
+	buf     *bufio.Writer
+	sum     hash.Hash
+	encoder *json.Encoder
+	times   map[string]bool
+}
+
+func (w *backupWriter) WriteRow(table string, row SnapshotRow) error {
+	file, ok := w.files[table]
+	if !ok {
+		f, err := os.Create(filepath.Join(w.dir, "tables", table+".ndjson"))
+		if err != nil {
+			return err
+		}
+		file = &backupTableFile{f: f, buf: bufio.NewWriter(f), sum: sha256.New(), times: map[string]bool{}}
+		file.encoder = json.NewEncoder(io.MultiWriter(file.buf, file.sum))
+		w.files[table] = file
+		w.manifest.Tables[table] = &BackupTable{File: "tables/" + table + ".ndjson"}
+	}
+
+	encoded := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		if t, ok := value.(time.Time); ok {
+			file.times[column] = true
+			value = t.UTC().Format(time.RFC3339Nano)
+		}
+		encoded[column] = value
+	}
+	if err := file.encoder.Encode(encoded); err != nil {
+		return fmt.Errorf("failed to write %s backup: %v", table, err)
+	}
+	w.manifest.Tables[table].Rows++
+
+	if table == "documents" {
+		object := &BackupObject{
+			DocumentID:  fmt.Sprint(row["id"]),
+			FilePath:    fmt.Sprint(row["file_path"]),
+			ContentType: fmt.Sprint(row["mime_type"]),
+		}
+		if region, ok := row["storage_region"].(string); ok {
+			object.Region = region
+		}
+		object.File = "objects/" + object.DocumentID
+		w.manifest.Objects = append(w.manifest.Objects, object)
+		if tier, ok := row["storage_tier"].(string); ok {
+			w.tiers[object.DocumentID] = tier
+		}
+	}
+	if table == "case_evidence" {
+		object := &BackupObject{
+			EvidenceID:  fmt.Sprint(row["id"]),
+			FilePath:    fmt.Sprint(row["object_name"]),
+			ContentType: fmt.Sprint(row["mime_type"]),
+		}
+		if region, ok := row["storage_region"].(string); ok {
+			object.Region = region
+		}
+		object.File = "objects/evidence/" + object.EvidenceID
+		w.manifest.Objects = append(w.manifest.Objects, object)
+	}
+	return nil
+}
+
+func (w *backupWriter) close() error {
+	var firstErr error
+	for table, file := range w.files {
+		err := file.buf.Flush()
+		if closeErr := file.f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to write %s backup: %v", table, err)
+		}
+		entry := w.manifest.Tables[table]
+		entry.SHA256 = hex.EncodeToString(file.sum.Sum(nil))
+		for column := range file.times {
+			entry.TimeColumns = append(entry.TimeColumns, column)
+		}
+		sort.Strings(entry.TimeColumns)
+	}
+	return firstErr
+}
+
+// List returns the complete backups, newest first
+func (b *BackupService) List() ([]*BackupManifest, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return []*BackupManifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %v", err)
+	}
+	manifests := []*BackupManifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() || !backupID.MatchString(entry.Name()) {
+			continue
+		}
+		manifest, err := b.Get(entry.Name())
+		if err != nil {
+			continue
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].ID > manifests[j].ID })
+	return manifests, nil
+}
+
+// Get reads the manifest of a backup
+func (b *BackupService) Get(id string) (*BackupManifest, error) {
+	if !backupID.MatchString(id) {
+		return nil, ErrBackupNotFound
+	}
+	data, err := os.ReadFile(filepath.Join(b.dir, id, "manifest.json"))
+	if os.IsNotExist(err) {
+		return nil, ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %v", err)
+	}
+	manifest := &BackupManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, &BackupVerificationError{Problems: []string{fmt.Sprintf("manifest.json is not valid: %v", err)}}
+	}
+	return manifest, nil
+}
+
+// Verify checks every file of a backup against the manifest's hashes, sizes
+// and row counts. It returns a *BackupVerificationError listing what differs.
+func (b *BackupService) Verify(id string) (*BackupManifest, error) {
+	manifest, err := b.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(b.dir, id)
+
+	var problems []string
+	if manifest.FormatVersion != backupFormatVersion {
+		problems = append(problems, fmt.Sprintf("format version %d is not supported (expected %d)", manifest.FormatVersion, backupFormatVersion))
+	}
+	for _, table := range SnapshotTables() {
+		entry, ok := manifest.Tables[table]
+		if !ok {
+			continue
+		}
+		sum, lines, err := hashBackupFile(root, entry.File, true)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", entry.File, err))
+		case sum != entry.SHA256:
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", entry.File))
+		case lines != int64(entry.Rows):
+			problems = append(problems, fmt.Sprintf("%s: has %d rows, manifest lists %d", entry.File, lines, entry.Rows))
+		}
+	}
+	for _, object := range manifest.Objects {
+		sum, size, err := hashBackupFile(root, object.File, false)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", object.File, err))
+		case size != object.Size:
+			problems = append(problems, fmt.Sprintf("%s: is %d bytes, manifest lists %d", object.File, size, object.Size))
+		case sum != object.SHA256:
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", object.File))
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &BackupVerificationError{Problems: problems}
+	}
+	return manifest, nil
+}
+
+// hashBackupFile returns the SHA-256 of a file inside the backup and either
+// its number of lines or its size
+func hashBackupFile(root, name string, countLines bool) (string, int64, error) {
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", 0, errors.New("path leaves the backup directory")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, errors.New("missing")
+	}
+	defer f.Close()
+
+	sum := sha256.New()
+	if !countLines {
+		size, err := io.Copy(sum, f)
+		return hex.EncodeToString(sum.Sum(nil)), size, err
+	}
+	var lines int64
+	scanner := bufio.NewScanner(io.TeeReader(f, sum))
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+	for scanner.Scan() {
+		lines++
+	}
+	return hex.EncodeToString(sum.Sum(nil)), lines, scanner.Err()
+}
+
+// Restore verifies a backup and restores it: files are uploaded to the hot
+// tier of their region, then all rows are inserted in one transaction and
+// the files' references are counted. It
+// fails with ErrSnapshotConflict when one of the backup's tenants exists.
+func (b *BackupService) Restore(ctx context.Context, id string) (*BackupRestore, error) {
+	manifest, err := b.Verify(id)
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(b.dir, id)
+
+	for _, slug := range manifest.Tenants {
+		if _, err := b.store.GetTenantBySlug(slug); err == nil {
+			return nil, fmt.Errorf("%w: tenant %s already exists", ErrSnapshotConflict, slug)
+		}
+	}
+	stores := make([]ObjectStorage, len(manifest.Objects))
+	for i, object := range manifest.Objects {
+		if stores[i], err = b.storage.ForRegion(object.Region); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, object := range manifest.Objects {
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(object.File)))
+		if err != nil {
+			return nil, err
+		}
+		err = stores[i].UploadFile(ctx, object.FilePath, f, object.Size, object.ContentType)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %v", object.describe(), err)
+		}
+	}
+
+	rows, err := b.store.ImportSnapshot(manifest.Snapshot, &backupReader{root: root, manifest: manifest})
+	if err != nil {
+		return nil, err
+	}
+	// Documents sharing a content-addressed file each hold a reference.
+	// Case evidence is stored once per case and not counted.
+	for _, object := range manifest.Objects {
+		if object.EvidenceID != "" {
+			continue
+		}
+		region := object.Region
+		if region == "" {
+			region = b.storage.DefaultRegion()
+		}
+		if _, err := b.store.AcquireStoredObject(region, StorageTierHot, object.FilePath); err != nil {
+			log.Printf("Failed to count reference to restored file of document %s: %v", object.DocumentID, err)
+		}
+	}
+	return &BackupRestore{ID: id, Tenants: manifest.Tenants, Rows: rows, Objects: len(manifest.Objects)}, nil
+}
+
+// backupReader replays the row files of a verified backup
+type backupReader struct {
+	root     string
+	manifest *BackupManifest
+}
+
+func (r *backupReader) ReadRows(table string, fn func(SnapshotRow) error) error {
+	entry, ok := r.manifest.Tables[table]
+	if !ok {
+		return nil
+	}
+	f, err := os.Open(filepath.Join(r.root, filepath.FromSlash(entry.File)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.UseNumber()
+	for {
+		row := SnapshotRow{}
+		err := decoder.Decode(&row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s backup: %v", table, err)
+		}
+		for column, value := range row {
+			if n, ok := value.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					row[column] = i
+				} else {
+					row[column], _ = n.Float64()
+				}
+			}
+		}
+		for _, column := range entry.TimeColumns {
+			if s, ok := row[column].(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					row[column] = t
+				}
+			}
+		}
+		if table == "documents" {
+			// Files are restored to the hot tier
+			row["storage_tier"] = StorageTierHot
+			row["tier_changed_at"] = nil
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// Canary scores a share of documents with a new version of the AI service
+// next to the stable one, without storing its results on the documents
+type Canary struct {
+	analyzer Analyzer
+	cfg      config.CanaryConfig
+	slots    chan struct{}
+}
+
+// NewCanary scores with the canary AI service ai. It fails when the canary
+// has no model version, since comparisons are reported by version.
+func NewCanary(cfg config.CanaryConfig, ai AIClient) (*Canary, error) {
+	if cfg.ModelVersion == "" {
+		return nil, fmt.Errorf("AI_CANARY_MODEL_VERSION is required with AI_CANARY_URL")
+	}
+	concurrency := cfg.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &Canary{
+		analyzer: NewFastAPIAnalyzer(ai, cfg.ModelVersion),
+		cfg:      cfg,
+		slots:    make(chan struct{}, concurrency),
+	}, nil
+}
+
+// Config returns the sampling and readiness thresholds of the canary
+func (c *Canary) Config() config.CanaryConfig {
+	return c.cfg
+}
+
+// ModelVersion is the canary's fraud model version
+func (c *Canary) ModelVersion() string {
+	return c.analyzer.ModelVersion()
+}
+
+// Sampled draws whether an analysis is also scored by the canary
+func (c *Canary) Sampled() bool {
+	return rand.Float64()*100 < c.cfg.Percent
+}
+
+// Acquire takes one of the canary's call slots, reporting false when all
+// are in use. Release returns it.
+func (c *Canary) Acquire() bool {
+	select {
+	case c.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Canary) Release() {
+	<-c.slots
+}
+
+// Analyze scores text with the canary, within the canary timeout, and
+// returns how long the call took
+func (c *Canary) Analyze(ctx context.Context, text string) (*AnalyzeTextResponse, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := c.analyzer.Analyze(ctx, AnalyzeTextRequest{Text: text})
+	return resp, time.Since(start), err
+}
+
+// CanaryComparison is a document scored by both versions. CanaryScore and
+// CanaryRiskLevel are nil when the canary call failed with Error.
+type CanaryComparison struct {
+	DocumentID      DocumentID
+	StableVersion   string
+	CanaryVersion   string
+	StableScore     float64
+	StableRiskLevel string
+	CanaryScore     *float64
+	CanaryRiskLevel *string
+	CanaryLatency   time.Duration
+	Error           *string
+}
+
+// CanaryReport compares a canary version with the stable version it ran
+// next to. The score differences are the canary's score less the stable
+// one's, over the documents the canary scored; the agreements are shares
+// of those documents. Blockers list what keeps the canary from cutover.
+type CanaryReport struct {
+	StableVersion          string               `json:"stable_version"`
+	CanaryVersion          string               `json:"canary_version"`
+	Comparisons            int                  `json:"comparisons"`
+	Errors                 int                  `json:"errors"`
+	ErrorRate              float64              `json:"error_rate"`
+	MeanScoreDifference    *float64             `json:"mean_score_difference"`
+	MeanAbsoluteDifference *float64             `json:"mean_absolute_score_difference"`
+	MaxAbsoluteDifference  *float64             `json:"max_absolute_score_difference"`
+	ScoreAgreement         *float64             `json:"score_agreement"`
+	RiskLevelAgreement     *float64             `json:"risk_level_agreement"`
+	RiskLevelChanges       []*CanaryLevelChange `json:"risk_level_changes"`
+	MeanCanaryLatencyMs    float64              `json:"mean_canary_latency_ms"`
+	Ready                  bool                 `json:"ready"`
+	Blockers               []string             `json:"blockers"`
+
+	scored        int
+	differenceSum float64
+	distanceSum   float64
+	scoreAgreed   int
+	levelAgreed   int
+	latencySum    float64
+}
+
+// CanaryLevelChange counts the documents the canary put in another risk
+// level than the stable version
+type CanaryLevelChange struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Documents int    `json:"documents"`
+}
+
+// RecordCanaryComparison keeps a document's canary comparison
+func (d *DatabaseService) RecordCanaryComparison(c *CanaryComparison) error {
+	_, err := d.db.Exec(`
+		INSERT INTO canary_comparisons (document_id, stable_version, canary_version, stable_score, stable_risk_level,
+		                                canary_score, canary_risk_level, canary_latency_ms, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		c.DocumentID, c.StableVersion, c.CanaryVersion, c.StableScore, c.StableRiskLevel,
+		c.CanaryScore, c.CanaryRiskLevel, c.CanaryLatency.Milliseconds(), c.Error)
+	if err != nil {
+		return fmt.Errorf("failed to record canary comparison: %v", err)
+	}
+	return nil
+}
+
+// GetCanaryReports compares the canary and stable scores of the documents
+// compared since since, by pair of versions, ordered by canary version.
+// Scores within tolerance of each other agree. Readiness is left to Assess.
+func (d *DatabaseService) GetCanaryReports(since time.Time, tolerance float64) ([]*CanaryReport, error) {
+	rows, err := d.db.Query(`
+		SELECT stable_version, canary_version, stable_risk_level, COALESCE(canary_risk_level, ''),
+		       COUNT(*), COUNT(canary_score), SUM(canary_latency_ms),
+		       SUM(canary_score - stable_score), SUM(ABS(canary_score - stable_score)), MAX(ABS(canary_score - stable_score)),
+		       SUM(CASE WHEN ABS(canary_score - stable_score) <= $2 THEN 1 ELSE 0 END)
+		FROM canary_comparisons
+		WHERE compared_at >= $1
+		GROUP BY stable_version, canary_version, stable_risk_level, canary_risk_level`,
+		d.db.dialect.timeArg(since.UTC()), tolerance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare canary scores: %v", err)
+	}
+	defer rows.Close()
+
+	var reports []*CanaryReport
+	byVersions := map[[2]string]*CanaryReport{}
+	for rows.Next() {
+		var stableVersion, canaryVersion, stableLevel, canaryLevel string
+		var comparisons, scored, scoreAgreed int
+		var latencySum float64
+		var differenceSum, distanceSum, maxDistance sql.NullFloat64
+		if err := rows.Scan(&stableVersion, &canaryVersion, &stableLevel, &canaryLevel,
+			&comparisons, &scored, &latencySum, &differenceSum, &distanceSum, &maxDistance, &scoreAgreed); err != nil {
+			return nil, err
+		}
+		key := [2]string{stableVersion, canaryVersion}
+		report, ok := byVersions[key]
+		if !ok {
+			report = &CanaryReport{
+				StableVersion:    stableVersion,
+				CanaryVersion:    canaryVersion,
+				RiskLevelChanges: []*CanaryLevelChange{},
+				Blockers:         []string{},
+			}
+			byVersions[key] = report
+			reports = append(reports, report)
+		}
+		report.Comparisons += comparisons
+		report.Errors += comparisons - scored
+		report.latencySum += latencySum
+		report.scored += scored
+		report.differenceSum += differenceSum.Float64
+		report.distanceSum += distanceSum.Float64
+		report.scoreAgreed += scoreAgreed
+		if maxDistance.Valid && (report.MaxAbsoluteDifference == nil || maxDistance.Float64 > *report.MaxAbsoluteDifference) {
+			distance := maxDistance.Float64
+			report.MaxAbsoluteDifference = &distance
+		}
+		if scored == 0 {
+			continue
+		}
+		if canaryLevel == stableLevel {
+			report.levelAgreed += scored
+		} else {
+			report.RiskLevelChanges = append(report.RiskLevelChanges, &CanaryLevelChange{From: stableLevel, To: canaryLevel, Documents: scored})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, report := range reports {
+		report.finish()
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].CanaryVersion != reports[j].CanaryVersion {
+			return reports[i].CanaryVersion < reports[j].CanaryVersion
+		}
+		return reports[i].StableVersion < reports[j].StableVersion
+	})
+	return reports, nil
+}
+
+// finish computes the rates and means from the sums
+func (r *CanaryReport) finish() {
+	if r.Comparisons > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(r.Comparisons)
+		r.MeanCanaryLatencyMs = r.latencySum / float64(r.Comparisons)
+	}
+	if r.scored > 0 {
+		n := float64(r.scored)
+		difference := r.differenceSum / n
+		distance := r.distanceSum / n
+		scoreAgreement := float64(r.scoreAgreed) / n
+		levelAgreement := float64(r.levelAgreed) / n
+		r.MeanScoreDifference = &difference
+		r.MeanAbsoluteDifference = &distance
+		r.ScoreAgreement = &scoreAgreement
+		r.RiskLevelAgreement = &levelAgreement
+	}
+	sort.Slice(r.RiskLevelChanges, func(i, j int) bool {
+		if r.RiskLevelChanges[i].Documents != r.RiskLevelChanges[j].Documents {
+			return r.RiskLevelChanges[i].Documents > r.RiskLevelChanges[j].Documents
+		}
+		if r.RiskLevelChanges[i].From != r.RiskLevelChanges[j].From {
+			return r.RiskLevelChanges[i].From < r.RiskLevelChanges[j].From
+		}
+		return r.RiskLevelChanges[i].To < r.RiskLevelChanges[j].To
+	})
+}
+
+// Assess decides whether the canary is ready for cutover against the
+// thresholds of cfg, listing the blockers when it is not
+func (r *CanaryReport) Assess(cfg config.CanaryConfig) {
+	r.Blockers = []string{}
+	if r.Comparisons < cfg.MinComparisons {
+		r.Blockers = append(r.Blockers, fmt.Sprintf("%d of the %d comparisons required", r.Comparisons, cfg.MinComparisons))
+	}
+	if r.ErrorRate > cfg.MaxErrorRate {
+		r.Blockers = append(r.Blockers, fmt.Sprintf("error rate %.3f is above %.3f", r.ErrorRate, cfg.MaxErrorRate))
+	}
+	if r.RiskLevelAgreement != nil && *r.RiskLevelAgreement < cfg.MinAgreement {
+		r.Blockers = append(r.Blockers, fmt.Sprintf("risk level agreement %.3f is below %.3f", *r.RiskLevelAgreement, cfg.MinAgreement))
+	}
+	r.Ready = len(r.Blockers) == 0
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrEvidenceExists is returned when the same file is attached to a case twice
+var ErrEvidenceExists = errors.New("file is already attached to the case")
+
+// CaseEvidence is a file an analyst attached to a case that is not a
+// document to analyze, such as a screenshot, a bank's confirmation or an
+// email. Evidence is kept as attached: it cannot be replaced or removed.
+type CaseEvidence struct {
+	ID            string    `json:"id"`
+	TenantID      *string   `json:"tenant_id"`
+	AlertID       string    `json:"case_id"`
+	Filename      string    `json:"filename"`
+	ObjectName    string    `json:"-"`
+	StorageRegion *string   `json:"storage_region"`
+	MimeType      string    `json:"mime_type"`
+	FileSize      int64     `json:"file_size"`
+	SHA256        string    `json:"sha256"`
+	Description   *string   `json:"description"`
+	UploadedBy    *string   `json:"uploaded_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// CaseEvidenceObjectName is where a file attached to the case is stored.
+// Names are per case and content, so a case holds each file once.
+func CaseEvidenceObjectName(alertID, contentSHA256 string) string {
+	return "cases/" + alertID + "/" + contentSHA256
+}
+
+const caseEvidenceColumns = `id, tenant_id, alert_id, filename, object_name, storage_region, mime_type, file_size, sha256, description, uploaded_by, created_at`
+
+func scanCaseEvidence(row rowScanner) (*CaseEvidence, error) {
+	evidence := &CaseEvidence{}
+	err := row.Scan(&evidence.ID, &evidence.TenantID, &evidence.AlertID, &evidence.Filename, &evidence.ObjectName,
+		&evidence.StorageRegion, &evidence.MimeType, &evidence.FileSize, &evidence.SHA256, &evidence.Description,
+		&evidence.UploadedBy, &evidence.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return evidence, nil
+}
+
+// CreateCaseEvidence records a file attached to a case, before it is stored.
+// It returns ErrEvidenceExists when the case already holds the file.
+func (d *DatabaseService) CreateCaseEvidence(evidence *CaseEvidence) error {
+	err := d.db.QueryRow(`
+		INSERT INTO case_evidence (tenant_id, alert_id, filename, object_name, storage_region, mime_type, file_size, sha256, description, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (alert_id, sha256) DO NOTHING
+		RETURNING id, created_at`,
+		evidence.TenantID, evidence.AlertID, evidence.Filename, evidence.ObjectName, evidence.StorageRegion,
+		evidence.MimeType, evidence.FileSize, evidence.SHA256, evidence.Description, evidence.UploadedBy,
+	).Scan(&evidence.ID, &evidence.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrEvidenceExists
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create case evidence: %v", err)
+	}
+	return nil
+}
+
+// DeleteCaseEvidence removes the record of a file that could not be stored
+func (d *DatabaseService) DeleteCaseEvidence(id string) error {
+	_, err := d.db.Exec(`DELETE FROM case_evidence WHERE id = $1`, id)
+	return err
+}
+
+// GetCaseEvidence returns one file attached to the case, or sql.ErrNoRows
+func (d *DatabaseService) GetCaseEvidence(alertID, id string) (*CaseEvidence, error) {
+	return scanCaseEvidence(d.db.QueryRow(`
+		SELECT `+caseEvidenceColumns+` FROM case_evidence WHERE alert_id = $1 AND id = $2`, alertID, id))
+}
+
+// GetCaseEvidenceList returns the files attached to the case, oldest first
+func (d *DatabaseService) GetCaseEvidenceList(alertID string) ([]*CaseEvidence, error) {
+	rows, err := d.db.Query(`
+		SELECT `+caseEvidenceColumns+` FROM case_evidence WHERE alert_id = $1 ORDER BY created_at, id`, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query case evidence: %v", err)
+	}
+	defer rows.Close()
+
+	evidence := []*CaseEvidence{}
+	for rows.Next() {
+		item, err := scanCaseEvidence(rows)
+		if err != nil {
+			return nil, err
+		}
+		evidence = append(evidence, item)
+	}
+	return evidence, rows.Err()
+}
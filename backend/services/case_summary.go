@@ -0,0 +1,295 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Thumbnails are drawn in a square of caseThumbnailSize points from at most
+// caseThumbnailPixels on a side. Larger images are not decoded for them.
+const (
+	caseThumbnailSize      = 84.0
+	caseThumbnailPixels    = 240
+	maxCaseThumbnailPixels = 40 << 20
+)
+
+// CaseSummary is what the print-ready summary of a case is put together
+// from: the sources of its timeline, with the detailed analysis of its
+// documents and the original files of those that are images, to show as
+// thumbnails
+type CaseSummary struct {
+	SARSources
+	Analyses   map[DocumentID]*DocumentAnalysis
+	Thumbnails map[DocumentID][]byte
+}
+
+// CanThumbnail reports whether case summaries show a thumbnail of files of
+// the MIME type
+func CanThumbnail(mimeType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	return mediaType == "image/jpeg" || mediaType == "image/png" || mediaType == "image/gif"
+}
+
+// caseThumbnail decodes an image into a thumbnail, or returns nil when it
+// cannot be read or is too large to decode
+func caseThumbnail(content []byte) *pdfImage {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width == 0 || config.Height == 0 || config.Width*config.Height > maxCaseThumbnailPixels {
+		return nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil
+	}
+	return pdfImageOf(img, caseThumbnailPixels)
+}
+
+// PDF renders the summary managers are handed after an investigation, in
+// the localizer's language: the case, its documents with thumbnails, why
+// they scored as they did, the reviewers' decisions and the timeline
+func (s *CaseSummary) PDF(now time.Time, l Localizer) []byte {
+	alert := s.Alert
+	risks, dispositions := DefaultRiskTaxonomy(), DefaultDispositionTaxonomy()
+	if s.Tenant != nil {
+		risks, dispositions = s.Tenant.Taxonomy(), s.Tenant.Dispositions()
+	}
+	dispositionLabel := func(code *string) string {
+		if code == nil {
+			return ""
+		}
+		if disposition, err := dispositions.Lookup(*code); err == nil {
+			return disposition.Label
+		}
+		return *code
+	}
+	reviewer := func(id *string) string {
+		return sarOr(sarValue(id), l.T("unknown reviewer"))
+	}
+	type caseDocument struct {
+		document *Document
+		role     string
+	}
+	var documents []caseDocument
+	for _, doc := range []caseDocument{{s.Document, SARDocumentSubject}, {s.Exemplar, SARDocumentExemplar}} {
+		if doc.document != nil {
+			documents = append(documents, doc)
+		}
+	}
+
+	w := newPDFWriter(l)
+	w.Heading(l.T("Case Summary"), 16)
+	w.Field(l.T("Case"), alert.ID)
+	w.Field(l.T("Generated"), now.UTC().Format(time.RFC3339))
+	if s.Tenant != nil {
+		w.Field(l.T("Institution"), s.Tenant.Name+" ("+s.Tenant.Slug+")")
+	}
+
+	w.Heading(l.T("Case details"), 12)
+	w.Field(l.T("Kind"), strings.ReplaceAll(alert.Kind, "_", " "))
+	w.Field(l.T("Severity"), alert.Severity)
+	if alert.Score != nil {
+		w.Field(l.T("Alert score"), fmt.Sprintf("%.2f", *alert.Score))
+	}
+	w.Field(l.T("Raised"), alert.CreatedAt.UTC().Format(time.RFC3339))
+	assignee := sarValue(alert.AssignedTo)
+	if alert.OriginalAssignee != nil && assignee != *alert.OriginalAssignee {
+		assignee = l.Sprintf("%s, delegated by %s", assignee, *alert.OriginalAssignee)
+	}
+	w.Field(l.T("Assigned to"), assignee)
+	w.Field(l.T("Escalation level"), fmt.Sprint(alert.EscalationLevel))
+	if alert.AcknowledgedAt == nil {
+		w.Field(l.T("Status"), l.T("Open"))
+	} else {
+		w.Field(l.T("Status"), l.Sprintf("Closed %s by %s", alert.AcknowledgedAt.UTC().Format(time.RFC3339), reviewer(alert.AcknowledgedBy)))
+		disposition := dispositionLabel(alert.Disposition)
+		if alert.DispositionOutcome != nil {
+			disposition += " (" + *alert.DispositionOutcome + ")"
+		}
+		w.Field(l.T("Disposition"), disposition)
+	}
+	w.Field(l.T("Evidence"), l.Sprintf("%d attached file(s)", len(s.Evidence)))
+
+	w.Heading(l.T("Documents"), 12)
+	if len(documents) == 0 {
+		w.Paragraph(l.T("None"))
+	}
+	for _, doc := range documents {
+		var thumbnail *pdfImage
+		if content, ok := s.Thumbnails[doc.document.ID]; ok {
+			thumbnail = caseThumbnail(content)
+		}
+		w.Figure(thumbnail, caseThumbnailSize, func(indent float64) {
+			role := l.T("document the alert was raised on")
+			if doc.role == SARDocumentExemplar {
+				role = l.T("known fraud exemplar")
+			}
+			w.Indented(fmt.Sprintf("%s (%s)", doc.document.OriginalFilename, role), indent)
+			w.Indented(fmt.Sprintf("ID %s", doc.document.ID), indent)
+			w.Indented(l.Sprintf("%s, %d bytes, uploaded %s", doc.document.MimeType, doc.document.FileSize, doc.document.CreatedAt.UTC().Format(time.RFC3339)), indent)
+			if doc.document.DocumentType != nil {
+				w.Indented(l.Sprintf("Type %s", *doc.document.DocumentType), indent)
+			}
+			if doc.document.ContentSHA256 != nil {
+				w.Indented("SHA-256 "+*doc.document.ContentSHA256, indent)
+			}
+			if doc.document.FraudScore != nil {
+				w.Indented(l.Sprintf("Fraud score %.2f, %s risk", *doc.document.FraudScore, risks.LevelForScore(*doc.document.FraudScore).Label), indent)
+			}
+		})
+	}
+
+	w.Heading(l.T("Fraud score explanations"), 12)
+	if len(documents) == 0 {
+		w.Paragraph(l.T("None"))
+	}
+	for _, doc := range documents {
+		w.Paragraph(doc.document.OriginalFilename)
+		if doc.document.FraudScore == nil {
+			w.Indented(l.T("Not scored yet"), 12)
+			continue
+		}
+		w.Indented(riskExplanation(l, risks, *doc.document.FraudScore), 12)
+		if doc.document.AnalysisProvider != nil {
+			provider := l.Sprintf("Scored by the %s analyzer", *doc.document.AnalysisProvider)
+			if doc.document.AnalysisFallback {
+				provider += l.T(", as a fallback")
+			}
+			if doc.document.AnalysisCached {
+				provider += l.T(", from a cached analysis of the same text")
+			}
+			w.Indented(provider, 12)
+		}
+		for _, line := range analysisExplanation(l, s.Analyses[doc.document.ID]) {
+			w.Indented(line, 12)
+		}
+		for _, record := range s.Detections {
+			if record.DocumentID != doc.document.ID {
+				continue
+			}
+			line := l.Sprintf("Detected an unknown pattern with confidence %.2f", record.ConfidenceScore)
+			if record.Pattern != nil {
+				line = l.Sprintf("Detected %s (%s, %s severity) with confidence %.2f", sarOr(record.Pattern.Name, l.T("unknown pattern")),
+					sarOr(record.Pattern.Type, "-"), sarOr(record.Pattern.Severity, "-"), record.ConfidenceScore)
+			}
+			w.Indented(line, 12)
+		}
+	}
+
+	w.Heading(l.T("Reviewer decisions"), 12)
+	decisions := 0
+	for _, record := range s.Detections {
+		if record.ReviewedAt == nil {
+			continue
+		}
+		pattern := l.T("unknown pattern")
+		if record.Pattern != nil {
+			pattern = sarOr(record.Pattern.Name, pattern)
+		}
+		line := l.Sprintf("%s  %s confirmed the %s detection", record.ReviewedAt.UTC().Format("2006-01-02 15:04"), reviewer(record.ReviewedBy), pattern)
+		if record.IsFalsePositive {
+			line = l.Sprintf("%s  %s reviewed the %s detection as a false positive", record.ReviewedAt.UTC().Format("2006-01-02 15:04"), reviewer(record.ReviewedBy), pattern)
+		}
+		if label := dispositionLabel(record.Disposition); label != "" {
+			line += ": " + label
+		}
+		w.Paragraph(line)
+		decisions++
+	}
+	for _, approval := range s.Approvals {
+		line := l.Sprintf("%s  %s asked to %s", approval.CreatedAt.UTC().Format("2006-01-02 15:04"), approval.RequestedBy, l.T(strings.ReplaceAll(approval.Action, "_", " ")))
+		if label := dispositionLabel(approval.Disposition); label != "" {
+			line += l.Sprintf(" as %s", label)
+		}
+		if approval.DecidedAt != nil {
+			line += l.Sprintf("; %s by %s on %s", l.T(approval.Status), reviewer(approval.DecidedBy), approval.DecidedAt.UTC().Format("2006-01-02 15:04"))
+		} else {
+			line += "; " + l.T(approval.Status)
+		}
+		if approval.Reason != nil && *approval.Reason != "" {
+			line += l.Sprintf(". Reason: %s", *approval.Reason)
+		}
+		w.Paragraph(line)
+		decisions++
+	}
+	if alert.AcknowledgedAt != nil {
+		w.Paragraph(l.Sprintf("%s  %s closed the case as %s", alert.AcknowledgedAt.UTC().Format("2006-01-02 15:04"),
+			reviewer(alert.AcknowledgedBy), sarOr(dispositionLabel(alert.Disposition), l.T("no disposition"))))
+		decisions++
+	}
+	if decisions == 0 {
+		w.Paragraph(l.T("None yet"))
+	}
+
+	w.Heading(l.T("Timeline"), 12)
+	for _, event := range CaseTimeline(s.SARSources) {
+		w.Paragraph(fmt.Sprintf("%s  %s  %s", event.At.UTC().Format("2006-01-02 15:04:05"), l.T(strings.ReplaceAll(event.Event, "_", " ")), event.Detail))
+	}
+	return w.Bytes()
+}
+
+// riskExplanation says which of the taxonomy's risk levels a score falls in
+// and how far it is from the next
+func riskExplanation(l Localizer, risks *RiskTaxonomy, score float64) string {
+	level := risks.LevelForScore(score)
+	text := l.Sprintf("Scored %.2f, %s risk: at or above the %.2f threshold", score, level.Label, level.MinScore)
+	for _, next := range risks.Levels {
+		if next.MinScore > score {
+			return text + l.Sprintf(", below %s at %.2f", next.Label, next.MinScore)
+		}
+	}
+	return text + l.T(", the highest level")
+}
+
+// analysisExplanation lists what the analyzer said of a document: the
+// model's reasoning and the patterns it weighed, in the forms the analyzers
+// record them
+func analysisExplanation(l Localizer, analysis *DocumentAnalysis) []string {
+	if analysis == nil || analysis.PatternAnalysis == nil {
+		return nil
+	}
+	var parsed struct {
+		Model     string            `json:"model"`
+		Reasoning string            `json:"reasoning"`
+		Patterns  []json.RawMessage `json:"patterns"`
+	}
+	if json.Unmarshal([]byte(*analysis.PatternAnalysis), &parsed) != nil {
+		return nil
+	}
+
+	var lines []string
+	if parsed.Model != "" {
+		lines = append(lines, l.Sprintf("Model %s", parsed.Model))
+	}
+	if parsed.Reasoning != "" {
+		lines = append(lines, l.Sprintf("Reasoning: %s", parsed.Reasoning))
+	}
+	for _, raw := range parsed.Patterns {
+		var name string
+		if json.Unmarshal(raw, &name) == nil {
+			lines = append(lines, l.Sprintf("Indicator: %s", name))
+			continue
+		}
+		var pattern struct {
+			Pattern     string   `json:"pattern"`
+			Confidence  *float64 `json:"confidence"`
+			Description string   `json:"description"`
+		}
+		if json.Unmarshal(raw, &pattern) != nil || pattern.Pattern == "" {
+			continue
+		}
+		line := l.Sprintf("Indicator: %s", pattern.Pattern)
+		if pattern.Confidence != nil {
+			line += l.Sprintf(" (confidence %.2f)", *pattern.Confidence)
+		}
+		if pattern.Description != "" {
+			line += " - " + pattern.Description
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
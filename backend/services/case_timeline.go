@@ -0,0 +1,211 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CaseEvent is one entry of an investigation's timeline. DocumentID names
+// the document the event is about and Actor who acted, when known.
+type CaseEvent struct {
+	At         time.Time   `json:"at"`
+	Event      string      `json:"event"`
+	DocumentID *DocumentID `json:"document_id,omitempty"`
+	Actor      *string     `json:"actor,omitempty"`
+	Detail     string      `json:"detail"`
+}
+
+// caseDocumentEvents names the timeline entries of a document's stored
+// events. Creation is left out, as the upload is on the timeline already.
+var caseDocumentEvents = map[string]string{
+	EventDocumentAnalyzed: "document_analyzed",
+	EventTextExtracted:    "text_extracted",
+	EventMetadataPatched:  "metadata_changed",
+	EventDocumentErased:   "document_erased",
+	EventDocumentDeleted:  "document_deleted",
+	EventDocumentPurged:   "document_purged",
+}
+
+// CaseTimeline puts the events of a case in chronological order: the upload
+// of its documents and the dates they bear, their analyses, the patterns
+// found and their review, the alert's assignment, escalations, approvals
+// and closing, the evidence attached and the notifications sent about it. Events of the same
+// time keep that order.
+func CaseTimeline(src SARSources) []*CaseEvent {
+	alert := src.Alert
+	timeline := []*CaseEvent{}
+	event := func(at time.Time, name string, document *DocumentID, actor *string, detail string) {
+		timeline = append(timeline, &CaseEvent{At: at, Event: name, DocumentID: document, Actor: actor, Detail: detail})
+	}
+
+	var fields DocumentFields
+	if src.Tenant != nil {
+		fields = src.Tenant.DocumentFields
+	}
+	for _, doc := range []struct {
+		document *Document
+		role     string
+	}{{src.Document, SARDocumentSubject}, {src.Exemplar, SARDocumentExemplar}} {
+		if doc.document == nil {
+			continue
+		}
+		id := doc.document.ID
+		detail := doc.document.OriginalFilename
+		if doc.role == SARDocumentExemplar {
+			detail = "known fraud exemplar " + detail
+		}
+		event(doc.document.CreatedAt, "document_uploaded", &id, nil, detail)
+
+		// Dates the document bears, such as an invoice's date, as declared
+		// by the metadata schema of its type
+		schema := MetadataSchema(doc.document.DocumentType, fields)
+		keys := make([]string, 0, len(schema))
+		for key, field := range schema {
+			if field.Type == FieldDate {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, _ := doc.document.Metadata[key].(string)
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				continue
+			}
+			event(date, "document_dated", &id, nil, fmt.Sprintf("%s of %s", key, doc.document.OriginalFilename))
+		}
+	}
+
+	for _, stored := range src.Events {
+		name, ok := caseDocumentEvents[stored.Type]
+		if !ok {
+			continue
+		}
+		id := stored.DocumentID
+		event(stored.OccurredAt, name, &id, nil, caseEventDetail(stored))
+	}
+
+	for _, record := range src.Detections {
+		pattern := "unknown pattern"
+		if record.Pattern != nil {
+			pattern = sarOr(record.Pattern.Name, pattern)
+		}
+		id := record.DocumentID
+		event(record.CreatedAt, "pattern_detected", &id, nil, fmt.Sprintf("%s (confidence %.2f)", pattern, record.ConfidenceScore))
+		if record.ReviewedAt != nil {
+			event(*record.ReviewedAt, "detection_reviewed", &id, record.ReviewedBy, fmt.Sprintf("%s by %s as %s",
+				pattern, sarOr(sarValue(record.ReviewedBy), "unknown reviewer"), sarOr(sarValue(record.Disposition), "no disposition")))
+		}
+	}
+
+	event(alert.CreatedAt, "alert_raised", alert.DocumentID, nil, fmt.Sprintf("%s alert (%s)", alert.Severity, alert.Kind))
+	// Escalations assign the alert too; only a later assignment is listed
+	assigned := alert.AssignedAt != nil
+	for _, escalation := range src.Escalations {
+		event(escalation.EscalatedAt, "alert_escalated", nil, nil, fmt.Sprintf("level %d (%s) to %s", escalation.Level, escalation.StepName, sarOr(sarValue(escalation.ToUser), "nobody")))
+		if assigned && !alert.AssignedAt.After(escalation.EscalatedAt) {
+			assigned = false
+		}
+	}
+	if assigned {
+		event(*alert.AssignedAt, "alert_assigned", nil, nil, "to "+sarOr(sarValue(alert.AssignedTo), "nobody"))
+	}
+	for _, approval := range src.Approvals {
+		requester := approval.RequestedBy
+		event(approval.CreatedAt, "approval_requested", nil, &requester, fmt.Sprintf("%s by %s", approval.Action, approval.RequestedBy))
+		if approval.DecidedAt != nil {
+			event(*approval.DecidedAt, "approval_"+approval.Status, nil, approval.DecidedBy, fmt.Sprintf("%s by %s", approval.Action, sarOr(sarValue(approval.DecidedBy), "unknown reviewer")))
+		}
+	}
+	if alert.AcknowledgedAt != nil {
+		taxonomy := DefaultDispositionTaxonomy()
+		if src.Tenant != nil {
+			taxonomy = src.Tenant.Dispositions()
+		}
+		disposition := sarValue(alert.Disposition)
+		if found, err := taxonomy.Lookup(disposition); err == nil {
+			disposition = found.Label
+		}
+		event(*alert.AcknowledgedAt, "alert_closed", nil, alert.AcknowledgedBy, fmt.Sprintf("by %s as %s", sarOr(sarValue(alert.AcknowledgedBy), "unknown reviewer"), sarOr(disposition, "no disposition")))
+	}
+
+	for _, evidence := range src.Evidence {
+		detail := evidence.Filename
+		if evidence.Description != nil && *evidence.Description != "" {
+			detail += ": " + *evidence.Description
+		}
+		event(evidence.CreatedAt, "evidence_attached", nil, evidence.UploadedBy, detail)
+	}
+
+	for _, notification := range src.Notifications {
+		var data struct {
+			Notify []string `json:"notify"`
+		}
+		json.Unmarshal(notification.Data, &data)
+		detail := notification.Type
+		if len(data.Notify) > 0 {
+			detail += " to " + strings.Join(data.Notify, ", ")
+		}
+		switch {
+		case notification.DeliveredAt != nil:
+			event(*notification.DeliveredAt, "notification_sent", nil, nil, detail)
+		case notification.FailedAt != nil:
+			event(*notification.FailedAt, "notification_failed", nil, nil, detail)
+		default:
+			event(notification.CreatedAt, "notification_pending", nil, nil, detail)
+		}
+	}
+
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].At.Before(timeline[j].At) })
+	return timeline
+}
+
+// caseEventDetail describes a stored document event. Redacted events keep
+// no data to describe.
+func caseEventDetail(stored *StoredEvent) string {
+	if stored.RedactedAt != nil {
+		return "redacted"
+	}
+	switch stored.Type {
+	case EventDocumentAnalyzed:
+		detail := "no fraud score"
+		if score, ok := stored.Data["fraud_score"].(float64); ok {
+			detail = fmt.Sprintf("fraud score %.2f", score)
+		}
+		if level, ok := stored.Data["fraud_risk_level"].(string); ok && level != "" {
+			detail += fmt.Sprintf(" (%s risk)", level)
+		}
+		if provider, ok := stored.Data["analysis_provider"].(string); ok && provider != "" {
+			detail += " by " + provider
+		}
+		return detail
+	case EventTextExtracted:
+		if length, ok := stored.Data["length"].(float64); ok {
+			return fmt.Sprintf("%d characters", int(length))
+		}
+	case EventMetadataPatched:
+		var keys []string
+		for _, change := range []string{"set", "remove"} {
+			switch values := stored.Data[change].(type) {
+			case map[string]interface{}:
+				for key := range values {
+					keys = append(keys, key)
+				}
+			case []interface{}:
+				for _, key := range values {
+					keys = append(keys, fmt.Sprint(key))
+				}
+			}
+		}
+		sort.Strings(keys)
+		return strings.Join(keys, ", ")
+	case EventDocumentDeleted:
+		if by, ok := stored.Data["deleted_by"].(string); ok {
+			return "by " + by
+		}
+	}
+	return ""
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Change feed entities and operations
+const (
+	ChangeEntityDocument  = "document"
+	ChangeEntityDetection = "detection"
+
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// ErrInvalidChangeCursor is returned when a change feed cursor cannot be
+// decoded
+var ErrInvalidChangeCursor = errors.New("invalid change cursor")
+
+// Change is one entry of the change feed: a document or fraud detection was
+// created, updated or deleted. It names what changed rather than carrying
+// its new state, which consumers read from the API.
+type Change struct {
+	ID         int64       `json:"id"`
+	Entity     string      `json:"entity"`
+	EntityID   string      `json:"entity_id"`
+	DocumentID *DocumentID `json:"document_id"`
+	TenantID   *string     `json:"tenant_id"`
+	Operation  string      `json:"operation"`
+	ChangedAt  time.Time   `json:"changed_at"`
+
+	txid int64
+}
+
+// Cursor is the feed position just after the change
+func (c *Change) Cursor() ChangeCursor {
+	return ChangeCursor{TxID: c.txid, ID: c.ID}
+}
+
+// ChangeCursor is a position in the change feed. The feed is ordered by
+// writing transaction and then by change, as changes may commit in a
+// different order than their IDs were assigned; TxID is always 0 on SQLite.
+type ChangeCursor struct {
+	TxID int64
+	ID   int64
+}
+
+// String encodes the cursor for the since parameter of the feed
+func (c ChangeCursor) String() string {
+	return fmt.Sprintf("%d.%d", c.TxID, c.ID)
+}
+
+// ParseChangeCursor decodes a cursor returned by ChangeCursor.String
+func ParseChangeCursor(value string) (ChangeCursor, error) {
+	txid, id, ok := strings.Cut(value, ".")
+	if !ok {
+		return ChangeCursor{}, ErrInvalidChangeCursor
+	}
+	var cursor ChangeCursor
+	var err error
+	if cursor.TxID, err = strconv.ParseInt(txid, 10, 64); err != nil || cursor.TxID < 0 {
+		return ChangeCursor{}, ErrInvalidChangeCursor
+	}
+	if cursor.ID, err = strconv.ParseInt(id, 10, 64); err != nil || cursor.ID < 0 {
+		return ChangeCursor{}, ErrInvalidChangeCursor
+	}
+	return cursor, nil
+}
+
+// GetChanges returns up to limit changes after the cursor, in feed order.
+// tenantID restricts the feed to one tenant's changes when set. On Postgres
+// the feed stops before the oldest transaction still running, whose
+// changes would otherwise be skipped by a reader that had moved on.
+func (d *DatabaseService) GetChanges(after ChangeCursor, tenantID *string, limit int) ([]*Change, error) {
+	args := []interface{}{after.TxID, after.ID}
+	conditions := []string{"(txid > $1 OR (txid = $1 AND id > $2))"}
+	if d.db.dialect != dialectSQLite {
+		conditions = append(conditions, "txid < pg_snapshot_xmin(pg_current_snapshot())::text::bigint")
+	}
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		conditions = append(conditions, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	args = append(args, limit)
+
+	rows, err := d.db.Query(`
+		SELECT id, txid, entity, entity_id, document_id, tenant_id, operation, changed_at
+		FROM changes
+		WHERE `+strings.Join(conditions, " AND ")+fmt.Sprintf(`
+		ORDER BY txid, id LIMIT $%d`, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query changes: %v", err)
+	}
+	defer rows.Close()
+
+	changes := []*Change{}
+	for rows.Next() {
+		change := &Change{}
+		err := rows.Scan(&change.ID, &change.txid, &change.Entity, &change.EntityID, &change.DocumentID,
+			&change.TenantID, &change.Operation, &change.ChangedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan change: %v", err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// PurgeChanges deletes the changes recorded before the given time and
+// returns how many were deleted
+func (d *DatabaseService) PurgeChanges(before time.Time) (int64, error) {
+	result, err := d.db.Exec(`DELETE FROM changes WHERE changed_at < $1`, d.db.dialect.timeArg(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge changes: %v", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Channels documents are submitted through. Uploads from a browser are web,
+// other clients are api; the SFTP and email gateways name their channel.
+const (
+	ChannelWeb   = "web"
+	ChannelAPI   = "api"
+	ChannelSFTP  = "sftp"
+	ChannelEmail = "email"
+)
+
+// Channels lists the submission channels
+var Channels = []string{ChannelWeb, ChannelAPI, ChannelSFTP, ChannelEmail}
+
+// IsChannel reports whether channel is one of Channels
+func IsChannel(channel string) bool {
+	for _, c := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// maxChannelWeight bounds channel weights so one channel cannot swamp the
+// analyzer's score
+const maxChannelWeight = 5
+
+// ChannelWeights multiply the fraud score of documents submitted through
+// each channel. Channels not listed keep their score.
+type ChannelWeights map[string]float64
+
+// ChannelWeightsError lists the problems found in channel weights
+type ChannelWeightsError struct {
+	Problems []string
+}
+
+func (e *ChannelWeightsError) Error() string {
+	return "invalid channel weights: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that every channel is known and its weight is positive
+// and at most maxChannelWeight
+func (w ChannelWeights) Validate() error {
+	channels := make([]string, 0, len(w))
+	for channel := range w {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+
+	var problems []string
+	for _, channel := range channels {
+		if !IsChannel(channel) {
+			problems = append(problems, fmt.Sprintf("unknown channel %q, expected one of %s", channel, strings.Join(Channels, ", ")))
+			continue
+		}
+		if weight := w[channel]; weight <= 0 || weight > maxChannelWeight || math.IsNaN(weight) {
+			problems = append(problems, fmt.Sprintf("weight of %s must be above 0 and at most %d", channel, maxChannelWeight))
+		}
+	}
+	if len(problems) > 0 {
+		return &ChannelWeightsError{Problems: problems}
+	}
+	return nil
+}
+
+// Weight returns the weight of channel, 1 when it has none
+func (w ChannelWeights) Weight(channel string) float64 {
+	if weight, ok := w[channel]; ok {
+		return weight
+	}
+	return 1
+}
+
+// Apply weights score by channel, capped at 1
+func (w ChannelWeights) Apply(score float64, channel string) float64 {
+	return math.Min(1, score*w.Weight(channel))
+}
+
+func (w ChannelWeights) Value() (driver.Value, error) {
+	if len(w) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(map[string]float64(w))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (w *ChannelWeights) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*w = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, w)
+	case string:
+		return json.Unmarshal([]byte(v), w)
+	default:
+		return fmt.Errorf("unsupported channel weights type %T", src)
+	}
+}
+
+// UpdateTenantChannelWeights replaces the weights the tenant's fraud scores
+// are multiplied by per channel; nil weights every channel 1. Documents
+// already scored keep their score until re-scored. It returns sql.ErrNoRows
+// when there is no such tenant.
+func (d *DatabaseService) UpdateTenantChannelWeights(id string, weights ChannelWeights) error {
+	if err := weights.Validate(); err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET channel_weights = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, weights)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,129 +1,444 @@
 package services
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"frauddocai-backend/config"
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+
+	"github.com/lib/pq"
 )
 
 type DatabaseService struct {
-	db *sql.DB
+	db *conn
+
+	// vectors is set when the document_embeddings table exists
+	vectors bool
+
+	// connector opens Postgres connections; it is nil for SQLite
+	connector *postgresConnector
 }
 
 type Document struct {
-	ID               string    `json:"id"`
-	UserID           *string   `json:"user_id"`
-	Filename         string    `json:"filename"`
-	OriginalFilename string    `json:"original_filename"`
-	FilePath         string    `json:"file_path"`
-	FileSize         int64     `json:"file_size"`
-	MimeType         string    `json:"mime_type"`
-	DocumentType     *string   `json:"document_type"`
-	Status           string    `json:"status"`
-	FraudScore       *float64  `json:"fraud_score"`
-	FraudRiskLevel   string    `json:"fraud_risk_level"`
-	ExtractedText    *string   `json:"extracted_text"`
-	EmotionAnalysis  *string   `json:"emotion_analysis"`
-	PatternAnalysis  *string   `json:"pattern_analysis"`
-	Metadata         *string   `json:"metadata"`
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               DocumentID `json:"id"`
+	TenantID         *string    `json:"tenant_id"`
+	TeamID           *string    `json:"team_id"`
+	UserID           *string    `json:"user_id"`
+	Filename         string     `json:"filename"`
+	OriginalFilename string     `json:"original_filename"`
+	FilePath         string     `json:"file_path"`
+	FileSize         int64      `json:"file_size"`
+	MimeType         string     `json:"mime_type"`
+	DocumentType     *string    `json:"document_type"`
+	Status           string     `json:"status"`
+	FraudScore       *float64   `json:"fraud_score"`
+	FraudRiskLevel   string     `json:"fraud_risk_level"`
+	ExtractedText    *string    `json:"extracted_text"`
+	PatternCount     int        `json:"pattern_count"`
+	DominantEmotion  *string    `json:"dominant_emotion"`
+	AnalysisProvider *string    `json:"analysis_provider"`
+	AnalysisFallback bool       `json:"analysis_fallback"`
+	AnalysisCached   bool       `json:"analysis_cached"`
+	ContentSHA256    *string    `json:"content_sha256"`
+	StorageRegion    *string    `json:"storage_region"`
+	StorageTier      string     `json:"storage_tier"`
+	TierChangedAt    *time.Time `json:"tier_changed_at"`
+	Metadata         Metadata   `json:"metadata"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	// The detailed analysis, kept in document_analyses, the stages of the
+	// latest pipeline run and the amounts converted into the tenant's base
+	// currency are only included when a single document is requested.
+	// CreateDocument stores an analysis set here.
+	EmotionAnalysis *string             `json:"emotion_analysis,omitempty"`
+	PatternAnalysis *string             `json:"pattern_analysis,omitempty"`
+	PipelineStages  []*PipelineStageRun `json:"pipeline_stages,omitempty"`
+	Amounts         DocumentAmounts     `json:"amounts,omitempty"`
 }
 
 type FraudDetection struct {
 	ID               string     `json:"id"`
-	DocumentID       string     `json:"document_id"`
+	DocumentID       DocumentID `json:"document_id"`
 	FraudPatternID   *string    `json:"fraud_pattern_id"`
 	ConfidenceScore  float64    `json:"confidence_score"`
 	DetectionDetails *string    `json:"detection_details"`
 	IsFalsePositive  bool       `json:"is_false_positive"`
 	ReviewedBy       *string    `json:"reviewed_by"`
 	ReviewedAt       *time.Time `json:"reviewed_at"`
-	CreatedAt        time.Time  `json:"created_at"`
+	// Disposition is why the reviewer closed the detection, with the
+	// outcome it had in the tenant's disposition taxonomy at the time
+	Disposition        *string   `json:"disposition"`
+	DispositionOutcome *string   `json:"disposition_outcome"`
+	CreatedAt          time.Time `json:"created_at"`
 }
 
-func NewDatabaseService() (*DatabaseService, error) {
-	// Database connection string
-	connStr := "host=localhost port=5432 user=frauddocai password=frauddocai123 dbname=frauddocai sslmode=disable"
+// NewDatabaseService connects to the database selected by cfg.Driver and
+// applies any pending migrations. The Postgres password may be a secret
+// reference, resolved through secrets for every new connection.
+func NewDatabaseService(cfg config.DatabaseConfig, secrets *Secrets) (*DatabaseService, error) {
+	switch cfg.Driver {
+	case "postgres":
+		return newPostgresDatabaseService(cfg, secrets)
+	case "sqlite":
+		return newSQLiteDatabaseService(cfg)
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q", cfg.Driver)
+	}
+}
 
-	db, err := sql.Open("postgres", connStr)
+func newPostgresDatabaseService(cfg config.DatabaseConfig, secrets *Secrets) (*DatabaseService, error) {
+	connector := &postgresConnector{cfg: cfg, secrets: secrets}
+	db, err := openPostgresPool(context.Background(), connector)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, err
+	}
+
+	logging.DB.Infof("Database connection established successfully")
+
+	checkPoolSettings(db, cfg)
+	metrics.RegisterDBStats(db, cfg.Name)
+
+	c := newConn(db, dialectPostgres)
+	if err := runMigrations(c, postgresMigrations, "migrations/postgres"); err != nil {
+		return nil, err
 	}
 
+	d := &DatabaseService{db: c, connector: connector}
+	d.detectVectorSupport()
+	secrets.Subscribe("database", d.reconnect, cfg.Password)
+	return d, nil
+}
+
+// openPostgresPool opens a connection pool with the configured pool
+// settings and checks that it can connect
+func openPostgresPool(ctx context.Context, connector *postgresConnector) (*sql.DB, error) {
+	db := sql.OpenDB(connector)
+
 	// Test the connection
-	if err := db.Ping(); err != nil {
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	// Set connection pool settings
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(25)
-	db.SetConnMaxLifetime(5 * time.Minute)
+	cfg := connector.cfg
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, nil
+}
+
+// reconnect replaces the connection pool after the password is rotated, so
+// that no connection opened with the old password outlives it. The new pool
+// is only swapped in once it has connected. The old pool closes its
+// connections as queries return them, and is closed after DB_ROTATION_DRAIN.
+func (d *DatabaseService) reconnect(ctx context.Context) error {
+	db, err := openPostgresPool(ctx, d.connector)
+	if err != nil {
+		return err
+	}
+	old := d.db.replace(db)
+	metrics.RegisterDBStats(db, d.connector.cfg.Name)
+
+	old.SetMaxIdleConns(-1)
+	time.AfterFunc(d.connector.cfg.RotationDrain, func() {
+		if err := old.Close(); err != nil {
+			logging.DB.Errorf("Failed to close the previous database connection pool: %v", err)
+		}
+	})
+	logging.DB.Infof("Database connection pool rebuilt with rotated credentials")
+	return nil
+}
+
+// postgresConnector opens each connection with the current password, so
+// that after the password is rotated new connections use the new one
+type postgresConnector struct {
+	cfg     config.DatabaseConfig
+	secrets *Secrets
+}
+
+func (c *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	cfg := c.cfg
+	password, err := c.secrets.Resolve(ctx, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Password = password
+	connector, err := pq.NewConnector(cfg.ConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(ctx)
+}
+
+func (c *postgresConnector) Driver() driver.Driver {
+	return &pq.Driver{}
+}
 
-	log.Println("Database connection established successfully")
+// checkPoolSettings warns when the configured pool could exhaust the
+// connections the server allows. Problems are logged, not fatal.
+func checkPoolSettings(db *sql.DB, cfg config.DatabaseConfig) {
+	if cfg.MaxOpenConns > 0 && cfg.MaxIdleConns > cfg.MaxOpenConns {
+		logging.DB.Warnf("DB_MAX_IDLE_CONNS (%d) exceeds DB_MAX_OPEN_CONNS (%d); idle connections will be capped", cfg.MaxIdleConns, cfg.MaxOpenConns)
+	}
 
-	return &DatabaseService{db: db}, nil
+	var maxConnections, reserved int
+	err := db.QueryRow(`
+		SELECT current_setting('max_connections')::int,
+		       current_setting('superuser_reserved_connections')::int`).Scan(&maxConnections, &reserved)
+	if err != nil {
+		logging.DB.Warnf("Could not read Postgres max_connections: %v", err)
+		return
+	}
+
+	available := maxConnections - reserved
+	switch {
+	case cfg.MaxOpenConns <= 0:
+		logging.DB.Warnf("DB_MAX_OPEN_CONNS is unlimited; Postgres allows %d client connections", available)
+	case cfg.MaxOpenConns > available:
+		logging.DB.Warnf("DB_MAX_OPEN_CONNS (%d) exceeds Postgres max_connections available to clients (%d)", cfg.MaxOpenConns, available)
+	}
 }
 
 func (d *DatabaseService) Close() error {
 	return d.db.Close()
 }
 
+// PoolStats returns the statistics of the connection pool in use
+func (d *DatabaseService) PoolStats() sql.DBStats {
+	return d.db.pool.Load().Stats()
+}
+
 // Document operations
-func (d *DatabaseService) CreateDocument(doc *Document) error {
-	query := `
-		INSERT INTO documents (
-			user_id, filename, original_filename, file_path, file_size,
-			mime_type, document_type, status, fraud_score, fraud_risk_level,
-			extracted_text, emotion_analysis, pattern_analysis, metadata
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
-		RETURNING id, created_at, updated_at`
 
-	err := d.db.QueryRow(
-		query,
-		doc.UserID, doc.Filename, doc.OriginalFilename, doc.FilePath,
-		doc.FileSize, doc.MimeType, doc.DocumentType, doc.Status,
-		doc.FraudScore, doc.FraudRiskLevel, doc.ExtractedText, doc.EmotionAnalysis, doc.PatternAnalysis, doc.Metadata,
-	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+// documentColumns is the column list read by scanDocument
+const documentColumns = `id, tenant_id, team_id, user_id, filename, original_filename, file_path, file_size,
+		       mime_type, document_type, status, fraud_score, fraud_risk_level,
+		       extracted_text, pattern_count, dominant_emotion, analysis_provider, analysis_fallback, analysis_cached,
+		       content_sha256, storage_region, storage_tier, tier_changed_at, metadata, created_at, updated_at`
 
-	return err
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func (d *DatabaseService) GetDocument(id string) (*Document, error) {
-	query := `
-		SELECT id, user_id, filename, original_filename, file_path, file_size,
-		       mime_type, document_type, status, fraud_score, fraud_risk_level,
-		       extracted_text, emotion_analysis, pattern_analysis, metadata, created_at, updated_at
-		FROM documents WHERE id = $1`
-
+// scanDocument reads documentColumns followed by any extra columns
+func scanDocument(row rowScanner, extra ...interface{}) (*Document, error) {
 	doc := &Document{}
-	err := d.db.QueryRow(query, id).Scan(
-		&doc.ID, &doc.UserID, &doc.Filename, &doc.OriginalFilename,
+	dest := []interface{}{
+		&doc.ID, &doc.TenantID, &doc.TeamID, &doc.UserID, &doc.Filename, &doc.OriginalFilename,
 		&doc.FilePath, &doc.FileSize, &doc.MimeType, &doc.DocumentType,
 		&doc.Status, &doc.FraudScore, &doc.FraudRiskLevel,
-		&doc.ExtractedText, &doc.EmotionAnalysis, &doc.PatternAnalysis, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
-	)
-
+		&doc.ExtractedText, &doc.PatternCount, &doc.DominantEmotion, &doc.AnalysisProvider, &doc.AnalysisFallback, &doc.AnalysisCached,
+		&doc.ContentSHA256, &doc.StorageRegion, &doc.StorageTier, &doc.TierChangedAt, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
+	}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
-
 	return doc, nil
 }
 
-func (d *DatabaseService) UpdateDocumentFraudAnalysis(id string, fraudScore float64, riskLevel string, extractedText string, emotionAnalysis, patternAnalysis string) error {
-	query := `
+func (d *DatabaseService) CreateDocument(doc *Document) error {
+	if doc.StorageTier == "" {
+		doc.StorageTier = StorageTierHot
+	}
+	doc.PatternCount, doc.DominantEmotion = analysisSummary(doc.EmotionAnalysis, doc.PatternAnalysis)
+
+	return withRetry("create_document", func() error {
+		return d.createDocument(doc)
+	})
+}
+
+func (d *DatabaseService) createDocument(doc *Document) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO documents (
+			tenant_id, team_id, user_id, filename, original_filename, file_path, file_size,
+			mime_type, document_type, status, fraud_score, fraud_risk_level,
+			extracted_text, pattern_count, dominant_emotion, metadata, content_sha256, storage_region,
+			storage_tier
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		RETURNING id, created_at, updated_at`,
+		doc.TenantID, doc.TeamID, doc.UserID, doc.Filename, doc.OriginalFilename, doc.FilePath,
+		doc.FileSize, doc.MimeType, doc.DocumentType, doc.Status,
+		doc.FraudScore, doc.FraudRiskLevel, doc.ExtractedText, doc.PatternCount, doc.DominantEmotion, doc.Metadata,
+		doc.ContentSHA256, doc.StorageRegion, doc.StorageTier,
+	).Scan(&doc.ID, &doc.CreatedAt, &doc.UpdatedAt)
+	if err != nil {
+		return err
+	}
+
+	if doc.EmotionAnalysis != nil || doc.PatternAnalysis != nil {
+		if err := storeDocumentAnalysis(tx, doc.ID, doc.EmotionAnalysis, doc.PatternAnalysis); err != nil {
+			return err
+		}
+	}
+
+	created := Metadata{
+		"filename":          doc.Filename,
+		"original_filename": doc.OriginalFilename,
+		"file_path":         doc.FilePath,
+		"file_size":         doc.FileSize,
+		"mime_type":         doc.MimeType,
+		"document_type":     doc.DocumentType,
+		"status":            doc.Status,
+		"fraud_score":       doc.FraudScore,
+		"fraud_risk_level":  doc.FraudRiskLevel,
+		"content_sha256":    doc.ContentSHA256,
+		"storage_region":    doc.StorageRegion,
+		"storage_tier":      doc.StorageTier,
+		"team_id":           doc.TeamID,
+		"user_id":           doc.UserID,
+		"metadata":          doc.Metadata,
+	}
+	if err := appendDocumentEvent(tx, doc.ID, doc.TenantID, EventDocumentCreated, created); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DatabaseService) GetDocument(id DocumentID) (*Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE id = $1 AND deleted_at IS NULL`
+
+	return scanDocument(d.db.QueryRow(query, id))
+}
+
+// FraudAnalysis is the result of scoring a document, as stored on it
+type FraudAnalysis struct {
+	FraudScore      float64
+	RiskLevel       string
+	ExtractedText   string
+	EmotionAnalysis string
+	PatternAnalysis string
+	Provider        string
+	ModelVersion    string
+	// ModelScore is the analyzer's score, before channel weights
+	ModelScore float64
+	Fallback   bool
+	Cached     bool
+}
+
+func (d *DatabaseService) UpdateDocumentFraudAnalysis(id DocumentID, analysis *FraudAnalysis) error {
+	return withRetry("update_document_fraud_analysis", func() error {
+		return d.updateDocumentFraudAnalysis(id, analysis)
+	})
+}
+
+func (d *DatabaseService) updateDocumentFraudAnalysis(id DocumentID, analysis *FraudAnalysis) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	patternCount, dominantEmotion := analysisSummary(&analysis.EmotionAnalysis, &analysis.PatternAnalysis)
+	result, err := tx.Exec(`
 		UPDATE documents 
 		SET fraud_score = $2, fraud_risk_level = $3, extracted_text = $4, 
-		    emotion_analysis = $5, pattern_analysis = $6, status = 'processed', updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1`
+		    pattern_count = $5, dominant_emotion = $6, analysis_provider = $7, analysis_fallback = $8,
+		    analysis_cached = $9,
+		    status = 'processed', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL`, id, analysis.FraudScore, analysis.RiskLevel, analysis.ExtractedText,
+		patternCount, dominantEmotion, analysis.Provider, analysis.Fallback, analysis.Cached)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
 
-	_, err := d.db.Exec(query, id, fraudScore, riskLevel, extractedText, emotionAnalysis, patternAnalysis)
-	return err
+	if err := storeDocumentAnalysis(tx, id, &analysis.EmotionAnalysis, &analysis.PatternAnalysis); err != nil {
+		return err
+	}
+	if err := recordAnalysisObservation(tx, id, analysis, patternCount); err != nil {
+		return err
+	}
+	tenantID, err := documentTenant(tx, id)
+	if err != nil {
+		return err
+	}
+	analyzed := Metadata{
+		"fraud_score":           analysis.FraudScore,
+		"fraud_risk_level":      analysis.RiskLevel,
+		"pattern_count":         patternCount,
+		"dominant_emotion":      dominantEmotion,
+		"analysis_provider":     analysis.Provider,
+		"analysis_fallback":     analysis.Fallback,
+		"analysis_cached":       analysis.Cached,
+		"extracted_text_sha256": textDigest(analysis.ExtractedText),
+		"status":                DocumentProcessed,
+	}
+	if err := appendDocumentEvent(tx, id, tenantID, EventDocumentAnalyzed, analyzed); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateDocumentExtractedText replaces the document's extracted text without
+// touching its analysis. It returns sql.ErrNoRows when there is no such
+// document.
+func (d *DatabaseService) UpdateDocumentExtractedText(id DocumentID, text string) error {
+	return withRetry("update_document_extracted_text", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		result, err := tx.Exec(`UPDATE documents SET extracted_text = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL`, id, text)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 0 {
+			return sql.ErrNoRows
+		}
+
+		tenantID, err := documentTenant(tx, id)
+		if err != nil {
+			return err
+		}
+		extracted := Metadata{"extracted_text_sha256": textDigest(text), "length": len(text)}
+		if err := appendDocumentEvent(tx, id, tenantID, EventTextExtracted, extracted); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// GetFallbackAnalyzedDocuments returns documents scored by a fallback
+// analyzer, oldest first, so they can be re-scored by the primary provider
+func (d *DatabaseService) GetFallbackAnalyzedDocuments(limit int) ([]*Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE analysis_fallback AND deleted_at IS NULL ORDER BY updated_at LIMIT $1`
+
+	rows, err := d.db.Query(query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fallback analyzed documents: %v", err)
+	}
+	defer rows.Close()
+
+	var documents []*Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %v", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
 }
 
 func (d *DatabaseService) CreateFraudDetection(detection *FraudDetection) error {
@@ -134,26 +449,45 @@ func (d *DatabaseService) CreateFraudDetection(detection *FraudDetection) error
 		) VALUES ($1, $2, $3, $4, $5, $6, $7)
 		RETURNING id, created_at`
 
-	err := d.db.QueryRow(
-		query,
-		detection.DocumentID, detection.FraudPatternID, detection.ConfidenceScore,
-		detection.DetectionDetails, detection.IsFalsePositive,
-		detection.ReviewedBy, detection.ReviewedAt,
-	).Scan(&detection.ID, &detection.CreatedAt)
-
-	return err
+	return withRetry("create_fraud_detection", func() error {
+		return d.db.QueryRow(
+			query,
+			detection.DocumentID, detection.FraudPatternID, detection.ConfidenceScore,
+			detection.DetectionDetails, detection.IsFalsePositive,
+			detection.ReviewedBy, detection.ReviewedAt,
+		).Scan(&detection.ID, &detection.CreatedAt)
+	})
 }
 
-func (d *DatabaseService) GetDocuments(limit, offset int) ([]*Document, error) {
-	query := `
-		SELECT id, user_id, filename, original_filename, file_path, file_size,
-		       mime_type, document_type, status, fraud_score, fraud_risk_level,
-		       extracted_text, emotion_analysis, pattern_analysis, metadata, created_at, updated_at
-		FROM documents 
-		ORDER BY created_at DESC 
-		LIMIT $1 OFFSET $2`
+func (d *DatabaseService) GetDocuments(limit, offset int, filters []MetadataFilter, source SubmissionFilter, scope DocumentScope) ([]*Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents`
+
+	var args []interface{}
+	conditions := append([]string{"deleted_at IS NULL"}, scope.conditions(&args)...)
+	conditions = append(conditions, source.conditions(&args)...)
+
+	// Each filter becomes a containment check so the GIN index on metadata is used
+	for _, filter := range filters {
+		if d.db.dialect == dialectSQLite {
+			conditions = append(conditions, sqliteMetadataCondition(filter, &args))
+			continue
+		}
+
+		var alternatives []string
+		for _, doc := range filter.containmentDocuments() {
+			args = append(args, doc)
+			alternatives = append(alternatives, fmt.Sprintf("metadata @> $%d::jsonb", len(args)))
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
 
-	rows, err := d.db.Query(query, limit, offset)
+	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -161,13 +495,7 @@ func (d *DatabaseService) GetDocuments(limit, offset int) ([]*Document, error) {
 
 	var documents []*Document
 	for rows.Next() {
-		doc := &Document{}
-		err := rows.Scan(
-			&doc.ID, &doc.UserID, &doc.Filename, &doc.OriginalFilename,
-			&doc.FilePath, &doc.FileSize, &doc.MimeType, &doc.DocumentType,
-			&doc.Status, &doc.FraudScore, &doc.FraudRiskLevel,
-			&doc.ExtractedText, &doc.EmotionAnalysis, &doc.PatternAnalysis, &doc.Metadata, &doc.CreatedAt, &doc.UpdatedAt,
-		)
+		doc, err := scanDocument(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -176,3 +504,88 @@ func (d *DatabaseService) GetDocuments(limit, offset int) ([]*Document, error) {
 
 	return documents, nil
 }
+
+// PatchDocumentMetadata merges set into the document's metadata and removes
+// the listed keys. The merged result is validated against the schema for the
+// document's type before it is written.
+func (d *DatabaseService) PatchDocumentMetadata(id DocumentID, set Metadata, remove []string) (Metadata, error) {
+	if set == nil {
+		set = Metadata{}
+	}
+
+	var merged Metadata
+	err := withRetry("patch_document_metadata", func() error {
+		var err error
+		merged, err = d.patchDocumentMetadata(id, set, remove)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+func (d *DatabaseService) patchDocumentMetadata(id DocumentID, set Metadata, remove []string) (Metadata, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	lockClause := " FOR UPDATE"
+	if d.db.dialect == dialectSQLite {
+		// SQLite serializes writers, so there is no row lock to take
+		lockClause = ""
+	}
+
+	var documentType, tenantID *string
+	var current Metadata
+	err = tx.QueryRow(`SELECT document_type, tenant_id, metadata FROM documents WHERE id = $1 AND deleted_at IS NULL`+lockClause, id).Scan(&documentType, &tenantID, &current)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := Metadata{}
+	for key, value := range current {
+		merged[key] = value
+	}
+	for key, value := range set {
+		merged[key] = value
+	}
+	for _, key := range remove {
+		delete(merged, key)
+	}
+
+	var fields DocumentFields
+	if tenantID != nil {
+		if err := tx.QueryRow(`SELECT document_fields FROM tenants WHERE id = $1`, *tenantID).Scan(&fields); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidateMetadata(documentType, merged, fields); err != nil {
+		return nil, err
+	}
+
+	if d.db.dialect == dialectSQLite {
+		_, err = tx.Exec(`UPDATE documents SET metadata = $2 WHERE id = $1`, id, merged)
+	} else {
+		_, err = tx.Exec(`
+			UPDATE documents
+			SET metadata = (COALESCE(metadata, '{}'::jsonb) || $2::jsonb) - $3::text[]
+			WHERE id = $1`, id, set, pq.Array(remove))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if remove == nil {
+		remove = []string{}
+	}
+	if err := appendDocumentEvent(tx, id, tenantID, EventMetadataPatched, Metadata{"set": set, "remove": remove}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// maxDelegationHops bounds how far ResolveAssignee follows delegates who
+// have delegated their own queue in turn
+const maxDelegationHops = 5
+
+// Delegation hands a reviewer's queue to a colleague while they are away
+type Delegation struct {
+	ID          string    `json:"id"`
+	DelegatorID string    `json:"delegator_id"`
+	DelegateID  string    `json:"delegate_id"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Reason      *string   `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Active reports whether the delegation applies at t
+func (d *Delegation) Active(t time.Time) bool {
+	return !t.Before(d.StartsAt) && t.Before(d.EndsAt)
+}
+
+const delegationColumns = `id, delegator_id, delegate_id, starts_at, ends_at, reason, created_at`
+
+func scanDelegation(row rowScanner) (*Delegation, error) {
+	delegation := &Delegation{}
+	err := row.Scan(
+		&delegation.ID, &delegation.DelegatorID, &delegation.DelegateID,
+		&delegation.StartsAt, &delegation.EndsAt, &delegation.Reason, &delegation.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return delegation, nil
+}
+
+// CreateDelegation records a delegation
+func (d *DatabaseService) CreateDelegation(delegation *Delegation) error {
+	return d.db.QueryRow(`
+		INSERT INTO review_delegations (delegator_id, delegate_id, starts_at, ends_at, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		delegation.DelegatorID, delegation.DelegateID,
+		d.db.dialect.timeArg(delegation.StartsAt), d.db.dialect.timeArg(delegation.EndsAt), delegation.Reason,
+	).Scan(&delegation.ID, &delegation.CreatedAt)
+}
+
+// GetDelegation returns the delegation with the ID. It returns sql.ErrNoRows
+// when there is no such delegation.
+func (d *DatabaseService) GetDelegation(id string) (*Delegation, error) {
+	return scanDelegation(d.db.QueryRow(`SELECT `+delegationColumns+` FROM review_delegations WHERE id = $1`, id))
+}
+
+// GetDelegations returns the delegations a user gave or received that have
+// not ended by since, by start
+func (d *DatabaseService) GetDelegations(userID string, since time.Time) ([]*Delegation, error) {
+	rows, err := d.db.Query(`
+		SELECT `+delegationColumns+` FROM review_delegations
+		WHERE (delegator_id = $1 OR delegate_id = $1) AND ends_at > $2
+		ORDER BY starts_at, id`, userID, d.db.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delegations: %v", err)
+	}
+	defer rows.Close()
+
+	delegations := []*Delegation{}
+	for rows.Next() {
+		delegation, err := scanDelegation(rows)
+		if err != nil {
+			return nil, err
+		}
+		delegations = append(delegations, delegation)
+	}
+	return delegations, rows.Err()
+}
+
+// DeleteDelegation removes a delegation. It returns sql.ErrNoRows when there
+// is no such delegation.
+func (d *DatabaseService) DeleteDelegation(id string) error {
+	result, err := d.db.Exec(`DELETE FROM review_delegations WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ResolveAssignee returns who reviews work meant for userID at t: the
+// delegate of their delegation active at t, followed through delegates who
+// are away themselves. A chain that leads back to someone already on it
+// ends with the last user before the loop. The delegation that applied is
+// nil when userID is not away.
+func (d *DatabaseService) ResolveAssignee(userID string, t time.Time) (string, *Delegation, error) {
+	assignee := userID
+	var applied *Delegation
+	seen := map[string]bool{userID: true}
+	for hop := 0; hop < maxDelegationHops; hop++ {
+		delegation, err := scanDelegation(d.db.QueryRow(`
+			SELECT `+delegationColumns+` FROM review_delegations
+			WHERE delegator_id = $1 AND starts_at <= $2 AND ends_at > $2
+			ORDER BY created_at DESC LIMIT 1`, assignee, d.db.dialect.timeArg(t)))
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to resolve delegation of %s: %v", assignee, err)
+		}
+		if seen[delegation.DelegateID] {
+			break
+		}
+		seen[delegation.DelegateID] = true
+		assignee = delegation.DelegateID
+		if applied == nil {
+			applied = delegation
+		}
+	}
+	return assignee, applied, nil
+}
+
+// AssignAlert assigns an alert to a reviewer. original is who the alert was
+// meant for when a delegation sent it to someone else, and nil otherwise.
+// It returns sql.ErrNoRows when there is no such alert.
+func (d *DatabaseService) AssignAlert(id, assignee string, original *string) (*Alert, error) {
+	result, err := d.db.Exec(`
+		UPDATE alerts SET assigned_to = $2, original_assignee = $3, assigned_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id, assignee, original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign alert: %v", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return d.GetAlert(id)
+}
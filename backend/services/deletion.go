@@ -0,0 +1,137 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeleteDocument hides a document until it is purged: it is marked deleted,
+// its fraud detections are deleted and the deletion is appended to its
+// events. It returns the document so its file can be released,
+// ErrLegalHold when the document must be kept and sql.ErrNoRows when it is
+// not found or deleted already. deletedBy is the user deleting it, if known.
+func (d *DatabaseService) DeleteDocument(id DocumentID, deletedBy *string) (*Document, error) {
+	var doc *Document
+	err := withRetry("delete_document", func() error {
+		var err error
+		doc, err = d.deleteDocument(id, deletedBy)
+		return err
+	})
+	return doc, err
+}
+
+func (d *DatabaseService) deleteDocument(id DocumentID, deletedBy *string) (*Document, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	lockClause := " FOR UPDATE"
+	if d.db.dialect == dialectSQLite {
+		lockClause = ""
+	}
+	doc, err := scanDocument(tx.QueryRow(`SELECT `+documentColumns+` FROM documents
+		WHERE id = $1 AND deleted_at IS NULL`+lockClause, id))
+	if err != nil {
+		return nil, err
+	}
+	reason, err := retentionReason(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return nil, ErrLegalHold
+	}
+
+	if _, err := tx.Exec(`UPDATE documents SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to delete document %s: %w", id, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM document_fraud_detections WHERE document_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to delete fraud detections of document %s: %w", id, err)
+	}
+	data := Metadata{}
+	if deletedBy != nil {
+		data["deleted_by"] = *deletedBy
+	}
+	if err := appendDocumentEvent(tx, id, doc.TenantID, EventDocumentDeleted, data); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// PurgeDeletedDocuments deletes for good up to limit documents deleted
+// before the cutoff, with everything referencing them, and returns their
+// IDs. Their events are kept, with the purge appended, to show the
+// documents existed. Documents that came to need keeping since their
+// deletion, such as by a legal hold, are kept until they no longer do.
+func (d *DatabaseService) PurgeDeletedDocuments(before time.Time, limit int) ([]DocumentID, error) {
+	rows, err := d.db.Query(`
+		SELECT id FROM documents WHERE deleted_at < $1
+		AND NOT EXISTS (SELECT 1 FROM legal_holds WHERE document_id = documents.id AND released_at IS NULL)
+		AND NOT EXISTS (SELECT 1 FROM sar_drafts s JOIN alerts a ON a.id = s.alert_id WHERE a.document_id = documents.id)
+		ORDER BY deleted_at LIMIT $2`, d.db.dialect.timeArg(before), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deleted documents: %v", err)
+	}
+	var ids []DocumentID
+	for rows.Next() {
+		var id DocumentID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	purged := make([]DocumentID, 0, len(ids))
+	for _, id := range ids {
+		err := withRetry("purge_document", func() error {
+			return d.purgeDocument(id)
+		})
+		if errors.Is(err, ErrLegalHold) || errors.Is(err, sql.ErrNoRows) {
+			// Held since it was found, or purged by another run
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge document %s: %w", id, err)
+		}
+		purged = append(purged, id)
+	}
+	return purged, nil
+}
+
+func (d *DatabaseService) purgeDocument(id DocumentID) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	reason, err := retentionReason(tx, id)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return ErrLegalHold
+	}
+	var tenantID *string
+	err = tx.QueryRow(`DELETE FROM documents WHERE id = $1 AND deleted_at IS NOT NULL RETURNING tenant_id`, id).Scan(&tenantID)
+	if err != nil {
+		return err
+	}
+	if err := appendDocumentEvent(tx, id, tenantID, EventDocumentPurged, Metadata{}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
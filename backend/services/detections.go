@@ -0,0 +1,141 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DetectionFilter narrows a fraud detection listing. Zero values do not
+// filter.
+type DetectionFilter struct {
+	DocumentID    DocumentID
+	TenantID      string
+	PatternID     string
+	PatternType   string
+	MinConfidence *float64
+	MaxConfidence *float64
+	Reviewed      *bool
+	Since         *time.Time
+	Until         *time.Time
+	Limit         int
+	Offset        int
+}
+
+// DetectionDocument is the part of a document shown next to its detections
+type DetectionDocument struct {
+	ID               DocumentID `json:"id"`
+	OriginalFilename string     `json:"original_filename"`
+	DocumentType     *string    `json:"document_type"`
+	Status           string     `json:"status"`
+	FraudScore       *float64   `json:"fraud_score"`
+	FraudRiskLevel   string     `json:"fraud_risk_level"`
+	TenantID         *string    `json:"tenant_id"`
+}
+
+// DetectionPattern is the part of a fraud pattern shown with a detection
+type DetectionPattern struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"pattern_type"`
+	Severity string `json:"severity"`
+}
+
+// DetectionRecord is a fraud detection joined with its document and pattern
+type DetectionRecord struct {
+	*FraudDetection
+	Document DetectionDocument `json:"document"`
+	Pattern  *DetectionPattern `json:"pattern"`
+}
+
+// GetFraudDetections lists detections matching filter, newest first
+func (d *DatabaseService) GetFraudDetections(filter DetectionFilter) ([]*DetectionRecord, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.DocumentID != "" {
+		where("fd.document_id = $%d", filter.DocumentID)
+	}
+	if filter.TenantID != "" {
+		where("doc.tenant_id = $%d", filter.TenantID)
+	}
+	if filter.PatternID != "" {
+		where("fd.fraud_pattern_id = $%d", filter.PatternID)
+	}
+	if filter.PatternType != "" {
+		where("fp.pattern_type = $%d", filter.PatternType)
+	}
+	if filter.MinConfidence != nil {
+		where("fd.confidence_score >= $%d", *filter.MinConfidence)
+	}
+	if filter.MaxConfidence != nil {
+		where("fd.confidence_score <= $%d", *filter.MaxConfidence)
+	}
+	if filter.Reviewed != nil {
+		if *filter.Reviewed {
+			conditions = append(conditions, "fd.reviewed_at IS NOT NULL")
+		} else {
+			conditions = append(conditions, "fd.reviewed_at IS NULL")
+		}
+	}
+	if filter.Since != nil {
+		where("fd.created_at >= $%d", d.db.dialect.timeArg(*filter.Since))
+	}
+	if filter.Until != nil {
+		where("fd.created_at < $%d", d.db.dialect.timeArg(*filter.Until))
+	}
+
+	query := `
+		SELECT fd.id, fd.document_id, fd.fraud_pattern_id, fd.confidence_score, fd.detection_details,
+		       fd.is_false_positive, fd.reviewed_by, fd.reviewed_at, fd.disposition, fd.disposition_outcome, fd.created_at,
+		       doc.original_filename, doc.document_type, doc.status, doc.fraud_score, doc.fraud_risk_level, doc.tenant_id,
+		       fp.pattern_name, fp.pattern_type, fp.severity
+		FROM document_fraud_detections fd
+		JOIN documents doc ON doc.id = fd.document_id
+		LEFT JOIN fraud_patterns fp ON fp.id = fd.fraud_pattern_id`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit, filter.Offset)
+	query += fmt.Sprintf(" ORDER BY fd.created_at DESC LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query fraud detections: %v", err)
+	}
+	defer rows.Close()
+
+	var records []*DetectionRecord
+	for rows.Next() {
+		detection := &FraudDetection{}
+		record := &DetectionRecord{FraudDetection: detection}
+		var patternName, patternType, severity *string
+		err := rows.Scan(
+			&detection.ID, &detection.DocumentID, &detection.FraudPatternID, &detection.ConfidenceScore,
+			&detection.DetectionDetails, &detection.IsFalsePositive, &detection.ReviewedBy, &detection.ReviewedAt,
+			&detection.Disposition, &detection.DispositionOutcome, &detection.CreatedAt,
+			&record.Document.OriginalFilename, &record.Document.DocumentType, &record.Document.Status,
+			&record.Document.FraudScore, &record.Document.FraudRiskLevel, &record.Document.TenantID,
+			&patternName, &patternType, &severity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		record.Document.ID = detection.DocumentID
+		if detection.FraudPatternID != nil && patternName != nil {
+			record.Pattern = &DetectionPattern{ID: *detection.FraudPatternID, Name: *patternName}
+			if patternType != nil {
+				record.Pattern.Type = *patternType
+			}
+			if severity != nil {
+				record.Pattern.Severity = *severity
+			}
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
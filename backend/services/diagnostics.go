@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// diagnosticBodyLimit bounds each request and response body kept by
+// Diagnostics; longer bodies are cut and marked truncated
+const diagnosticBodyLimit = 1 << 20
+
+// AIExchange is one call to an AI provider captured during a debug replay.
+// Headers are not kept, so no credentials end up in a bundle, and neither
+// are multipart bodies, which carry the document file itself.
+type AIExchange struct {
+	Provider       string    `json:"provider"`
+	Method         string    `json:"method"`
+	URL            string    `json:"url"`
+	StartedAt      time.Time `json:"started_at"`
+	DurationMS     int64     `json:"duration_ms"`
+	RequestType    string    `json:"request_content_type,omitempty"`
+	RequestBody    string    `json:"request_body,omitempty"`
+	RequestOmitted bool      `json:"request_body_omitted,omitempty"`
+	RequestSize    int64     `json:"request_size"`
+	StatusCode     int       `json:"status_code,omitempty"`
+	ResponseBody   string    `json:"response_body,omitempty"`
+	ResponseSize   int       `json:"response_size"`
+	Truncated      bool      `json:"truncated,omitempty"`
+	Error          string    `json:"error,omitempty"`
+}
+
+// TextChunk is the part of a document's text, in bytes, that was sent in
+// one call to an AI provider. Text longer than a provider takes is cut, so
+// later parts of the document were never seen by it.
+type TextChunk struct {
+	Endpoint   string `json:"endpoint"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	TextLength int    `json:"text_length"`
+}
+
+// Diagnostics collects what a debug replay of a document's pipeline goes
+// through: named artifacts such as the raw extraction output, the calls to
+// AI providers and the chunks of text they were sent. It is carried by the
+// context of the replay; code without one in its context records nothing.
+type Diagnostics struct {
+	mu        sync.Mutex
+	names     []string
+	artifacts map[string]interface{}
+	exchanges []*AIExchange
+	chunks    []TextChunk
+}
+
+type diagnosticsKey struct{}
+
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{artifacts: map[string]interface{}{}}
+}
+
+// WithDiagnostics returns a context whose calls are recorded in d
+func WithDiagnostics(ctx context.Context, d *Diagnostics) context.Context {
+	return context.WithValue(ctx, diagnosticsKey{}, d)
+}
+
+// DiagnosticsFrom returns the Diagnostics of ctx, or nil outside a debug
+// replay
+func DiagnosticsFrom(ctx context.Context) *Diagnostics {
+	d, _ := ctx.Value(diagnosticsKey{}).(*Diagnostics)
+	return d
+}
+
+// SetArtifact keeps value under name, replacing what was kept there before
+func (d *Diagnostics) SetArtifact(name string, value interface{}) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.artifacts[name]; !ok {
+		d.names = append(d.names, name)
+	}
+	d.artifacts[name] = value
+}
+
+// Artifacts calls fn for each artifact in the order they were first set
+func (d *Diagnostics) Artifacts(fn func(name string, value interface{})) {
+	d.mu.Lock()
+	names := append([]string(nil), d.names...)
+	artifacts := make(map[string]interface{}, len(d.artifacts))
+	for name, value := range d.artifacts {
+		artifacts[name] = value
+	}
+	d.mu.Unlock()
+	for _, name := range names {
+		fn(name, artifacts[name])
+	}
+}
+
+// RecordChunk notes that text[start:end] of a text of textLength bytes was
+// sent to endpoint
+func (d *Diagnostics) RecordChunk(endpoint string, start, end, textLength int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.chunks = append(d.chunks, TextChunk{Endpoint: endpoint, Start: start, End: end, TextLength: textLength})
+}
+
+// Chunks returns the chunks recorded so far
+func (d *Diagnostics) Chunks() []TextChunk {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]TextChunk{}, d.chunks...)
+}
+
+// Exchanges returns the AI exchanges recorded so far
+func (d *Diagnostics) Exchanges() []*AIExchange {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]*AIExchange{}, d.exchanges...)
+}
+
+// beginExchange starts recording a call to provider with the body req
+// carries, or returns nil when ctx has no Diagnostics. The body is read from
+// req.GetBody, leaving req's own body for the call.
+func beginExchange(ctx context.Context, provider string, req *http.Request) *AIExchange {
+	d := DiagnosticsFrom(ctx)
+	if d == nil {
+		return nil
+	}
+	exchange := &AIExchange{
+		Provider:    provider,
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		StartedAt:   time.Now().UTC(),
+		RequestType: req.Header.Get("Content-Type"),
+	}
+	if req.ContentLength > 0 {
+		exchange.RequestSize = req.ContentLength
+	}
+	if mediaType, _, _ := mime.ParseMediaType(exchange.RequestType); mediaType == "multipart/form-data" {
+		exchange.RequestOmitted = true
+	} else if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			content, _ := io.ReadAll(io.LimitReader(body, diagnosticBodyLimit+1))
+			body.Close()
+			if len(content) > diagnosticBodyLimit {
+				content, exchange.Truncated = content[:diagnosticBodyLimit], true
+			}
+			exchange.RequestBody = string(content)
+		}
+	}
+	d.mu.Lock()
+	d.exchanges = append(d.exchanges, exchange)
+	d.mu.Unlock()
+	return exchange
+}
+
+// finish completes the exchange with the response, or the error of a call
+// that got none. It does nothing on a nil exchange.
+func (e *AIExchange) finish(statusCode int, body []byte, err error) {
+	if e == nil {
+		return
+	}
+	e.DurationMS = time.Since(e.StartedAt).Milliseconds()
+	e.StatusCode = statusCode
+	e.ResponseSize = len(body)
+	if len(body) > diagnosticBodyLimit {
+		body, e.Truncated = body[:diagnosticBodyLimit], true
+	}
+	e.ResponseBody = string(body)
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"frauddocai-backend/logging"
+)
+
+type dialect string
+
+const (
+	dialectPostgres dialect = "postgres"
+	dialectSQLite   dialect = "sqlite"
+)
+
+var placeholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+// rebind rewrites Postgres $N placeholders into SQLite's equivalent ?N form,
+// so queries can be written once in Postgres syntax
+func (d dialect) rebind(query string) string {
+	if d == dialectSQLite {
+		return placeholderPattern.ReplaceAllString(query, "?$1")
+	}
+	return query
+}
+
+// timeArg formats t for comparison with a TIMESTAMP column. SQLite stores
+// CURRENT_TIMESTAMP as UTC text, so times are compared as strings there.
+func (d dialect) timeArg(t time.Time) interface{} {
+	if d == dialectSQLite {
+		return t.UTC().Format("2006-01-02 15:04:05")
+	}
+	return t
+}
+
+// conn wraps *sql.DB and rebinds every query for the active dialect. The
+// pool can be replaced while queries run, when credentials are rotated.
+type conn struct {
+	pool    atomic.Pointer[sql.DB]
+	dialect dialect
+}
+
+func newConn(db *sql.DB, dialect dialect) *conn {
+	c := &conn{dialect: dialect}
+	c.pool.Store(db)
+	return c
+}
+
+// replace makes db the pool for new queries and returns the previous pool
+func (c *conn) replace(db *sql.DB) *sql.DB {
+	return c.pool.Swap(db)
+}
+
+func (c *conn) Close() error {
+	return c.pool.Load().Close()
+}
+
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	started := time.Now()
+	result, err := c.pool.Load().Exec(c.dialect.rebind(query), args...)
+	logQuery(query, started, err)
+	return result, err
+}
+
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	started := time.Now()
+	rows, err := c.pool.Load().Query(c.dialect.rebind(query), args...)
+	logQuery(query, started, err)
+	return rows, err
+}
+
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	started := time.Now()
+	row := c.pool.Load().QueryRow(c.dialect.rebind(query), args...)
+	logQuery(query, started, row.Err())
+	return row
+}
+
+func (c *conn) Begin() (*tx, error) {
+	t, err := c.pool.Load().Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, dialect: c.dialect}, nil
+}
+
+// beginSnapshot starts a read-only transaction whose queries all see the
+// database as of its first query. SQLite transactions are serializable
+// already.
+func (c *conn) beginSnapshot() (*tx, error) {
+	opts := &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	if c.dialect == dialectSQLite {
+		opts = nil
+	}
+	t, err := c.pool.Load().BeginTx(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, dialect: c.dialect}, nil
+}
+
+// rowQuerier is implemented by conn and tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// execer is implemented by conn and tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// tx wraps *sql.Tx with the same rebinding as conn
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t *tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	started := time.Now()
+	result, err := t.Tx.Exec(t.dialect.rebind(query), args...)
+	logQuery(query, started, err)
+	return result, err
+}
+
+func (t *tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	started := time.Now()
+	rows, err := t.Tx.Query(t.dialect.rebind(query), args...)
+	logQuery(query, started, err)
+	return rows, err
+}
+
+func (t *tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	started := time.Now()
+	row := t.Tx.QueryRow(t.dialect.rebind(query), args...)
+	logQuery(query, started, row.Err())
+	return row
+}
+
+// loggedQueryLength bounds the text of a query in the debug log
+const loggedQueryLength = 300
+
+// logQuery writes a query and how long it took to the db debug log. Its
+// arguments are left out, as they carry document data.
+func logQuery(query string, started time.Time, err error) {
+	if !logging.DB.Enabled(logging.LevelDebug) {
+		return
+	}
+	duration := time.Since(started).Round(time.Microsecond)
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > loggedQueryLength {
+		query = query[:loggedQueryLength] + "..."
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logging.DB.Debugf("%s (%v, failed: %v)", query, duration, err)
+		return
+	}
+	logging.DB.Debugf("%s (%v)", query, duration)
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Disposition outcomes, the labels reviewed decisions carry into reports and
+// the AI feedback loop
+const (
+	OutcomeFraud        = "fraud"
+	OutcomeNotFraud     = "not_fraud"
+	OutcomeInconclusive = "inconclusive"
+)
+
+// ErrDispositionConflict is returned when a reviewer's false positive verdict
+// contradicts the outcome of the disposition they chose
+var ErrDispositionConflict = errors.New("false_positive contradicts the disposition's outcome")
+
+// Disposition is a reason a reviewer gives for closing an alert or a
+// detection
+type Disposition struct {
+	Code    string `json:"code"`
+	Label   string `json:"label"`
+	Outcome string `json:"outcome"`
+}
+
+// FalsePositive returns whether a detection closed with the disposition is a
+// false positive. given is the reviewer's verdict, if they stated one; it is
+// only needed for inconclusive dispositions.
+func (d Disposition) FalsePositive(given *bool) (bool, error) {
+	var derived bool
+	switch d.Outcome {
+	case OutcomeFraud:
+		derived = false
+	case OutcomeNotFraud:
+		derived = true
+	default:
+		if given == nil {
+			return false, nil
+		}
+		return *given, nil
+	}
+	if given != nil && *given != derived {
+		return false, ErrDispositionConflict
+	}
+	return derived, nil
+}
+
+// DispositionTaxonomy lists the dispositions reviewers of a tenant choose from
+type DispositionTaxonomy struct {
+	Codes []Disposition `json:"codes"`
+}
+
+// DefaultDispositionTaxonomy is used by tenants that have not configured
+// their own
+func DefaultDispositionTaxonomy() *DispositionTaxonomy {
+	return &DispositionTaxonomy{Codes: []Disposition{
+		{Code: "confirmed_fraud", Label: "Confirmed fraud", Outcome: OutcomeFraud},
+		{Code: "clerical_error", Label: "Clerical error", Outcome: OutcomeNotFraud},
+		{Code: "duplicate", Label: "Duplicate", Outcome: OutcomeInconclusive},
+		{Code: "insufficient_evidence", Label: "Insufficient evidence", Outcome: OutcomeInconclusive},
+	}}
+}
+
+var dispositionCode = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// DispositionError lists the problems found in a disposition taxonomy or
+// the disposition chosen for a decision
+type DispositionError struct {
+	Problems []string
+}
+
+func (e *DispositionError) Error() string {
+	return "invalid disposition: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that codes are unique identifiers that fit the disposition
+// columns, with a label and a known outcome
+func (t *DispositionTaxonomy) Validate() error {
+	var problems []string
+	if len(t.Codes) == 0 {
+		problems = append(problems, "at least one code is required")
+	}
+
+	seen := map[string]bool{}
+	for i, disposition := range t.Codes {
+		if !dispositionCode.MatchString(disposition.Code) {
+			problems = append(problems, fmt.Sprintf("codes[%d].code %q must be lower case letters, digits or _ (at most 50)", i, disposition.Code))
+		} else if seen[disposition.Code] {
+			problems = append(problems, fmt.Sprintf("codes[%d].code %q is repeated", i, disposition.Code))
+		}
+		seen[disposition.Code] = true
+
+		if strings.TrimSpace(disposition.Label) == "" {
+			problems = append(problems, fmt.Sprintf("codes[%d].label is required", i))
+		}
+		switch disposition.Outcome {
+		case OutcomeFraud, OutcomeNotFraud, OutcomeInconclusive:
+		default:
+			problems = append(problems, fmt.Sprintf("codes[%d].outcome must be %s, %s or %s", i, OutcomeFraud, OutcomeNotFraud, OutcomeInconclusive))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &DispositionError{Problems: problems}
+	}
+	return nil
+}
+
+// Lookup returns the disposition with the code, or a DispositionError when
+// the taxonomy has none
+func (t *DispositionTaxonomy) Lookup(code string) (Disposition, error) {
+	codes := make([]string, len(t.Codes))
+	for i, disposition := range t.Codes {
+		if disposition.Code == code {
+			return disposition, nil
+		}
+		codes[i] = disposition.Code
+	}
+	return Disposition{}, &DispositionError{Problems: []string{
+		fmt.Sprintf("disposition %q is not one of %s", code, strings.Join(codes, ", ")),
+	}}
+}
+
+func (t DispositionTaxonomy) Value() (driver.Value, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (t *DispositionTaxonomy) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return fmt.Errorf("unsupported disposition taxonomy type %T", src)
+	}
+}
+
+// dispositionFor looks up code in the taxonomy of the tenant; documents and
+// alerts without a tenant use the default taxonomy
+func dispositionFor(q rowQuerier, tenantID *string, code string) (Disposition, error) {
+	taxonomy := DefaultDispositionTaxonomy()
+	if tenantID != nil {
+		var configured *DispositionTaxonomy
+		err := q.QueryRow(`SELECT disposition_taxonomy FROM tenants WHERE id = $1`, *tenantID).Scan(&configured)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Disposition{}, err
+		}
+		if configured != nil {
+			taxonomy = configured
+		}
+	}
+	return taxonomy.Lookup(code)
+}
+
+// UpdateTenantDispositionTaxonomy replaces the tenant's dispositions; nil
+// restores the default. Decisions already made keep their code and outcome.
+// It returns sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantDispositionTaxonomy(id string, taxonomy *DispositionTaxonomy) error {
+	if taxonomy != nil {
+		if err := taxonomy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET disposition_taxonomy = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, taxonomy)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DispositionCount is how many alerts and detections were closed with a
+// disposition
+type DispositionCount struct {
+	Code       string `json:"code"`
+	Outcome    string `json:"outcome"`
+	Alerts     int    `json:"alerts"`
+	Detections int    `json:"detections"`
+}
+
+// GetDispositionReport counts the alerts and detections of a tenant closed
+// since since by disposition, most used first. A nil tenant counts those
+// without a tenant.
+func (d *DatabaseService) GetDispositionReport(tenantID *string, since time.Time) ([]*DispositionCount, error) {
+	args := []interface{}{d.db.dialect.timeArg(since)}
+	alertTenant, detectionTenant := `a.tenant_id IS NULL`, `doc.tenant_id IS NULL`
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		alertTenant, detectionTenant = `a.tenant_id = $2`, `doc.tenant_id = $2`
+	}
+
+	rows, err := d.db.Query(`
+		SELECT code, outcome, SUM(alerts) AS alerts, SUM(detections) AS detections FROM (
+			SELECT a.disposition AS code, a.disposition_outcome AS outcome, 1 AS alerts, 0 AS detections
+			FROM alerts a
+			WHERE a.disposition IS NOT NULL AND a.acknowledged_at >= $1 AND `+alertTenant+`
+			UNION ALL
+			SELECT fd.disposition, fd.disposition_outcome, 0, 1
+			FROM document_fraud_detections fd JOIN documents doc ON doc.id = fd.document_id
+			WHERE fd.disposition IS NOT NULL AND fd.reviewed_at >= $1 AND `+detectionTenant+`
+		) decisions
+		GROUP BY code, outcome
+		ORDER BY SUM(alerts) + SUM(detections) DESC, code`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query disposition report: %v", err)
+	}
+	defer rows.Close()
+
+	counts := []*DispositionCount{}
+	for rows.Next() {
+		count := &DispositionCount{}
+		if err := rows.Scan(&count.Code, &count.Outcome, &count.Alerts, &count.Detections); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// FeedbackLabel is a reviewed detection labelled by its disposition's
+// outcome, for retraining the fraud analysis
+type FeedbackLabel struct {
+	DetectionID     string     `json:"detection_id"`
+	DocumentID      DocumentID `json:"document_id"`
+	PatternID       *string    `json:"pattern_id"`
+	PatternType     *string    `json:"pattern_type"`
+	ConfidenceScore float64    `json:"confidence_score"`
+	FraudScore      *float64   `json:"fraud_score"`
+	Disposition     string     `json:"disposition"`
+	Label           string     `json:"label"`
+	ReviewedAt      time.Time  `json:"reviewed_at"`
+}
+
+// GetFeedbackLabels returns up to limit detections of a tenant with a fraud
+// or not_fraud outcome reviewed after since, or at since with an ID after
+// afterID, oldest first. Inconclusive decisions are left out. A nil tenant
+// returns those of every tenant.
+func (d *DatabaseService) GetFeedbackLabels(tenantID *string, since time.Time, afterID string, limit int) ([]*FeedbackLabel, error) {
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+	args := []interface{}{d.db.dialect.timeArg(since), afterID, OutcomeFraud, OutcomeNotFraud}
+	tenant := ""
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		tenant = fmt.Sprintf(` AND doc.tenant_id = $%d`, len(args))
+	}
+	args = append(args, limit)
+
+	rows, err := d.db.Query(`
+		SELECT fd.id, fd.document_id, fd.fraud_pattern_id, fp.pattern_type, fd.confidence_score, doc.fraud_score,
+		       fd.disposition, fd.disposition_outcome, fd.reviewed_at
+		FROM document_fraud_detections fd
+		JOIN documents doc ON doc.id = fd.document_id
+		LEFT JOIN fraud_patterns fp ON fp.id = fd.fraud_pattern_id
+		WHERE (fd.reviewed_at > $1 OR (fd.reviewed_at = $1 AND fd.id > $2))
+		  AND fd.disposition_outcome IN ($3, $4)`+tenant+`
+		ORDER BY fd.reviewed_at, fd.id
+		LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feedback labels: %v", err)
+	}
+	defer rows.Close()
+
+	labels := []*FeedbackLabel{}
+	for rows.Next() {
+		label := &FeedbackLabel{}
+		err := rows.Scan(&label.DetectionID, &label.DocumentID, &label.PatternID, &label.PatternType,
+			&label.ConfidenceScore, &label.FraudScore, &label.Disposition, &label.Label, &label.ReviewedAt)
+		if err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DocumentAnalysis holds the detailed emotion and pattern analysis of a
+// document. It is kept in document_analyses rather than on the document,
+// since it is large and only read when one document is shown; the document
+// carries a summary of it.
+type DocumentAnalysis struct {
+	EmotionAnalysis *string
+	PatternAnalysis *string
+}
+
+// analysisSummary returns the number of patterns found and the emotion the
+// model was most confident of, as kept on the document
+func analysisSummary(emotionAnalysis, patternAnalysis *string) (patternCount int, dominantEmotion *string) {
+	if patternAnalysis != nil {
+		var patterns struct {
+			Patterns []json.RawMessage `json:"patterns"`
+		}
+		if json.Unmarshal([]byte(*patternAnalysis), &patterns) == nil {
+			patternCount = len(patterns.Patterns)
+		}
+	}
+	if emotionAnalysis != nil {
+		var emotions struct {
+			Emotions []struct {
+				Emotion    string  `json:"emotion"`
+				Confidence float64 `json:"confidence"`
+			} `json:"emotions"`
+		}
+		if json.Unmarshal([]byte(*emotionAnalysis), &emotions) == nil {
+			best := -1.0
+			for _, e := range emotions.Emotions {
+				if e.Emotion != "" && e.Confidence > best {
+					emotion := e.Emotion
+					dominantEmotion, best = &emotion, e.Confidence
+				}
+			}
+		}
+	}
+	return patternCount, dominantEmotion
+}
+
+// storeDocumentAnalysis writes the document's detailed analysis, replacing
+// any earlier one
+func storeDocumentAnalysis(tx *tx, id DocumentID, emotionAnalysis, patternAnalysis *string) error {
+	_, err := tx.Exec(`
+		INSERT INTO document_analyses (document_id, emotion_analysis, pattern_analysis) VALUES ($1, $2, $3)
+		ON CONFLICT (document_id) DO UPDATE SET emotion_analysis = excluded.emotion_analysis,
+			pattern_analysis = excluded.pattern_analysis, updated_at = CURRENT_TIMESTAMP`,
+		id, emotionAnalysis, patternAnalysis)
+	if err != nil {
+		return fmt.Errorf("failed to store document analysis: %w", err)
+	}
+	return nil
+}
+
+// GetDocumentAnalysis returns the detailed analysis of the document, or nil
+// when it has not been analyzed
+func (d *DatabaseService) GetDocumentAnalysis(id DocumentID) (*DocumentAnalysis, error) {
+	analysis := &DocumentAnalysis{}
+	err := d.db.QueryRow(`SELECT emotion_analysis, pattern_analysis FROM document_analyses WHERE document_id = $1`, id).
+		Scan(&analysis.EmotionAnalysis, &analysis.PatternAnalysis)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document analysis: %v", err)
+	}
+	return analysis, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits of a tenant's document fields
+const (
+	maxFieldDocumentTypes = 20
+	maxFieldsPerType      = 50
+	maxFieldPattern       = 500
+)
+
+var fieldDocumentType = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// DocumentFields are the metadata fields a tenant adds to document types, by
+// document type and field name, such as an invoice's cost center. They are
+// stored in the document's metadata beside the built-in fields, so they are
+// validated, exported and filtered on like them. A type without built-in
+// fields becomes known once a tenant defines fields for it.
+type DocumentFields map[string]map[string]MetadataField
+
+// DocumentFieldsError lists the problems found in a tenant's document fields
+type DocumentFieldsError struct {
+	Problems []string
+}
+
+func (e *DocumentFieldsError) Error() string {
+	return "invalid document fields: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks field names and types, that no built-in field is
+// redefined, and that patterns compile and extract patterns have one group
+func (f DocumentFields) Validate() error {
+	var problems []string
+	if len(f) > maxFieldDocumentTypes {
+		problems = append(problems, fmt.Sprintf("at most %d document types are allowed", maxFieldDocumentTypes))
+	}
+
+	types := make([]string, 0, len(f))
+	for documentType := range f {
+		types = append(types, documentType)
+	}
+	sort.Strings(types)
+
+	for _, documentType := range types {
+		fields := f[documentType]
+		if !fieldDocumentType.MatchString(documentType) {
+			problems = append(problems, fmt.Sprintf("document type %q must be lower case letters, digits or _ (at most 50)", documentType))
+			continue
+		}
+		if len(fields) == 0 {
+			problems = append(problems, fmt.Sprintf("%s needs at least one field", documentType))
+		} else if len(fields) > maxFieldsPerType {
+			problems = append(problems, fmt.Sprintf("%s has more than %d fields", documentType, maxFieldsPerType))
+		}
+
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			field := fields[name]
+			path := documentType + "." + name
+			if !metadataKeyPattern.MatchString(name) {
+				problems = append(problems, fmt.Sprintf("invalid field name %q", path))
+				continue
+			}
+			if _, ok := MetadataSchemas[documentType][name]; ok {
+				problems = append(problems, fmt.Sprintf("%s is a built-in field", path))
+			}
+			switch field.Type {
+			case FieldString, FieldNumber, FieldBool, FieldDate:
+			default:
+				problems = append(problems, fmt.Sprintf("%s.type must be string, number, boolean or date", path))
+			}
+
+			if field.Pattern != "" {
+				if field.Type != FieldString {
+					problems = append(problems, fmt.Sprintf("%s.pattern is only allowed on string fields", path))
+				} else if len(field.Pattern) > maxFieldPattern {
+					problems = append(problems, fmt.Sprintf("%s.pattern must be at most %d characters", path, maxFieldPattern))
+				} else if _, err := regexp.Compile(field.Pattern); err != nil {
+					problems = append(problems, fmt.Sprintf("%s.pattern is invalid: %v", path, err))
+				}
+			}
+			if field.Extract != "" {
+				if field.Type == FieldBool {
+					problems = append(problems, fmt.Sprintf("%s.extract is not allowed on boolean fields", path))
+				} else if len(field.Extract) > maxFieldPattern {
+					problems = append(problems, fmt.Sprintf("%s.extract must be at most %d characters", path, maxFieldPattern))
+				} else if extract, err := regexp.Compile(field.Extract); err != nil {
+					problems = append(problems, fmt.Sprintf("%s.extract is invalid: %v", path, err))
+				} else if extract.NumSubexp() != 1 {
+					problems = append(problems, fmt.Sprintf("%s.extract must have exactly one group", path))
+				}
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &DocumentFieldsError{Problems: problems}
+	}
+	return nil
+}
+
+// Extract parses the values of the fields with an extract pattern from a
+// document's text, leaving out fields md already has and matches that do
+// not convert to the field's type or match its pattern
+func (f DocumentFields) Extract(documentType *string, text string, md Metadata) Metadata {
+	if documentType == nil {
+		return nil
+	}
+	parsed := Metadata{}
+	for name, field := range f[*documentType] {
+		if field.Extract == "" {
+			continue
+		}
+		if _, ok := md[name]; ok {
+			continue
+		}
+		extract, err := regexp.Compile(field.Extract)
+		if err != nil {
+			continue
+		}
+		match := extract.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		raw := strings.TrimSpace(match[1])
+
+		var value interface{} = raw
+		if field.Type == FieldNumber {
+			n, err := strconv.ParseFloat(strings.ReplaceAll(raw, ",", ""), 64)
+			if err != nil {
+				continue
+			}
+			value = n
+		}
+		if raw != "" && checkFieldType(field, value) == nil {
+			parsed[name] = value
+		}
+	}
+	return parsed
+}
+
+func (f DocumentFields) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (f *DocumentFields) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return fmt.Errorf("unsupported document fields type %T", src)
+	}
+}
+
+// UpdateTenantDocumentFields replaces the fields the tenant adds to document
+// types; nil or empty removes them. Metadata already stored is kept, and is
+// checked against the new fields the next time it changes. It returns
+// sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantDocumentFields(id string, fields DocumentFields) error {
+	if err := fields.Validate(); err != nil {
+		return err
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET document_fields = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, fields)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
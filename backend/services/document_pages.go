@@ -0,0 +1,127 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DocumentPage is the extraction of one page of a stored document, kept so
+// pages read with low OCR confidence can be read again
+type DocumentPage struct {
+	DocumentID DocumentID `json:"document_id"`
+	ExtractedPage
+	ReOCRCount int       `json:"reocr_count"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NewDocumentPages converts the pages of an extraction into those stored
+// on the document
+func NewDocumentPages(documentID DocumentID, pages []ExtractedPage) []*DocumentPage {
+	stored := make([]*DocumentPage, len(pages))
+	for i, page := range pages {
+		stored[i] = &DocumentPage{DocumentID: documentID, ExtractedPage: page}
+	}
+	return stored
+}
+
+// LowConfidencePages returns the numbers of the pages read by OCR with a
+// confidence below threshold, or whose OCR failed
+func LowConfidencePages(pages []*DocumentPage, threshold float64) []int {
+	numbers := []int{}
+	for _, page := range pages {
+		if page.Source == PageSourceOCR && (page.Status != PageStatusOK || page.Confidence < threshold) {
+			numbers = append(numbers, page.Page)
+		}
+	}
+	return numbers
+}
+
+// ReplacePageTexts returns text with the text of the pages in texts, by page
+// number, replaced, and copies of pages with their offsets moved to match.
+// It fails when the offsets of pages do not fit text, as when the text was
+// changed after the pages were stored.
+func ReplacePageTexts(text string, pages []*DocumentPage, texts map[int]string) (string, []*DocumentPage, error) {
+	ordered := make([]*DocumentPage, len(pages))
+	for i, page := range pages {
+		c := *page
+		ordered[i] = &c
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].TextStart < ordered[j].TextStart })
+
+	var b strings.Builder
+	end := 0
+	for _, page := range ordered {
+		if page.TextStart < end || page.TextEnd < page.TextStart || page.TextEnd > len(text) {
+			return "", nil, fmt.Errorf("page %d does not fit the extracted text", page.Page)
+		}
+		b.WriteString(text[end:page.TextStart])
+		start := b.Len()
+		if replacement, ok := texts[page.Page]; ok {
+			b.WriteString(replacement)
+		} else {
+			b.WriteString(text[page.TextStart:page.TextEnd])
+		}
+		end = page.TextEnd
+		page.TextStart, page.TextEnd = start, b.Len()
+	}
+	b.WriteString(text[end:])
+
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].Page < ordered[j].Page })
+	return b.String(), ordered, nil
+}
+
+// ReplaceDocumentPages stores the pages of a document in place of those
+// recorded before
+func (d *DatabaseService) ReplaceDocumentPages(documentID DocumentID, pages []*DocumentPage) error {
+	return withRetry("replace_document_pages", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM document_pages WHERE document_id = $1`, documentID); err != nil {
+			return err
+		}
+		for _, page := range pages {
+			var pageError *string
+			if page.Error != "" {
+				pageError = &page.Error
+			}
+			_, err := tx.Exec(`
+				INSERT INTO document_pages (document_id, page, source, confidence, status, error, text_start, text_end, duration_ms, reocr_count)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+				documentID, page.Page, page.Source, page.Confidence, page.Status, pageError,
+				page.TextStart, page.TextEnd, page.DurationMS, page.ReOCRCount)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetDocumentPages returns a document's pages in order
+func (d *DatabaseService) GetDocumentPages(documentID DocumentID) ([]*DocumentPage, error) {
+	rows, err := d.db.Query(`
+		SELECT document_id, page, source, confidence, status, COALESCE(error, ''), text_start, text_end,
+		       duration_ms, reocr_count, updated_at
+		FROM document_pages WHERE document_id = $1 ORDER BY page`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document pages: %v", err)
+	}
+	defer rows.Close()
+
+	pages := []*DocumentPage{}
+	for rows.Next() {
+		page := &DocumentPage{}
+		if err := rows.Scan(&page.DocumentID, &page.Page, &page.Source, &page.Confidence, &page.Status, &page.Error,
+			&page.TextStart, &page.TextEnd, &page.DurationMS, &page.ReOCRCount, &page.UpdatedAt); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DocumentStats counts documents uploaded on or after Since, read from the
+// counters the database keeps as documents change. Days are those of
+// TimeZone. ByTenant is only filled for stats across tenants; documents
+// without a tenant are listed with a nil TenantID.
+type DocumentStats struct {
+	Since       *time.Time         `json:"since"`
+	TimeZone    string             `json:"time_zone"`
+	Total       int64              `json:"total"`
+	ByStatus    map[string]int64   `json:"by_status"`
+	ByRiskLevel map[string]int64   `json:"by_risk_level"`
+	ByTenant    []*TenantDocuments `json:"by_tenant,omitempty"`
+	ByDay       []*DailyDocuments  `json:"by_day"`
+}
+
+// TenantDocuments is the number of documents of one tenant
+type TenantDocuments struct {
+	TenantID  *string `json:"tenant_id"`
+	Documents int64   `json:"documents"`
+}
+
+// DailyDocuments is the number of documents uploaded on Day (YYYY-MM-DD)
+type DailyDocuments struct {
+	Day       string `json:"day"`
+	Documents int64  `json:"documents"`
+}
+
+// GetDocumentStats counts the documents of tenantID, or of all tenants when
+// tenantID is nil, uploaded on or after the day of since, with days taken
+// in loc. A nil since counts every document. The counters are kept by UTC
+// quarter hour and summed into the days of loc here.
+func (d *DatabaseService) GetDocumentStats(tenantID *string, since *time.Time, loc *time.Location) (*DocumentStats, error) {
+	where, args := "documents > 0", []interface{}{}
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		where += fmt.Sprintf(" AND tenant_key = $%d", len(args))
+	}
+	if since != nil {
+		start := StartOfDay(*since, loc)
+		since = &start
+		args = append(args, d.db.dialect.timeArg(start.UTC()))
+		where += fmt.Sprintf(" AND slot >= $%d", len(args))
+	}
+
+	stats := &DocumentStats{Since: since, TimeZone: loc.String(), ByDay: []*DailyDocuments{}}
+	var err error
+	if stats.ByStatus, err = d.sumDocumentCounts("status", where, args); err != nil {
+		return nil, err
+	}
+	if stats.ByRiskLevel, err = d.sumDocumentCounts("risk_level", where, args); err != nil {
+		return nil, err
+	}
+	for _, documents := range stats.ByStatus {
+		stats.Total += documents
+	}
+
+	slot := "slot"
+	if d.db.dialect != dialectSQLite {
+		slot = "to_char(slot, 'YYYY-MM-DD HH24:MI:SS')"
+	}
+	slots, err := d.sumDocumentCounts(slot, where, args)
+	if err != nil {
+		return nil, err
+	}
+	days := map[string]int64{}
+	for slot, documents := range slots {
+		day, err := periodOf(slot, loc, StatsIntervalDay)
+		if err != nil {
+			return nil, err
+		}
+		days[day] += documents
+	}
+	for day, documents := range days {
+		stats.ByDay = append(stats.ByDay, &DailyDocuments{Day: day, Documents: documents})
+	}
+	sort.Slice(stats.ByDay, func(i, j int) bool { return stats.ByDay[i].Day < stats.ByDay[j].Day })
+
+	if tenantID == nil {
+		tenants, err := d.sumDocumentCounts("tenant_key", where, args)
+		if err != nil {
+			return nil, err
+		}
+		for key, documents := range tenants {
+			count := &TenantDocuments{Documents: documents}
+			if key != "" {
+				id := key
+				count.TenantID = &id
+			}
+			stats.ByTenant = append(stats.ByTenant, count)
+		}
+		sort.Slice(stats.ByTenant, func(i, j int) bool { return stats.ByTenant[i].Documents > stats.ByTenant[j].Documents })
+	}
+	return stats, nil
+}
+
+// sumDocumentCounts sums the document counters matching where, grouped by
+// the column expression group
+func (d *DatabaseService) sumDocumentCounts(group, where string, args []interface{}) (map[string]int64, error) {
+	rows, err := d.db.Query(`
+		SELECT `+group+` AS bucket, SUM(documents)
+		FROM document_counts
+		WHERE `+where+`
+		GROUP BY bucket`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum document counts: %v", err)
+	}
+	defer rows.Close()
+
+	sums := map[string]int64{}
+	for rows.Next() {
+		var key string
+		var documents int64
+		if err := rows.Scan(&key, &documents); err != nil {
+			return nil, err
+		}
+		sums[key] = documents
+	}
+	return sums, rows.Err()
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EmbeddingDimensions is the width of the vectors stored for semantic search,
+// matching the AI service's all-MiniLM-L6-v2 model and the vector(384) column
+const EmbeddingDimensions = 384
+
+// ErrSemanticSearchUnavailable is returned by the embedding operations when the
+// database has no document_embeddings table (Postgres without pgvector)
+var ErrSemanticSearchUnavailable = errors.New("semantic search is not available")
+
+// SimilarDocument is a search hit with its cosine similarity to the query
+type SimilarDocument struct {
+	Document   *Document `json:"document"`
+	Similarity float64   `json:"similarity"`
+}
+
+// CosineSimilarity returns the cosine similarity of two equal length vectors
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// vectorLiteral formats an embedding as '[x,y,...]', which is both the
+// pgvector text format and a JSON array
+func vectorLiteral(embedding []float32) string {
+	b, _ := json.Marshal(embedding)
+	return string(b)
+}
+
+func parseVector(literal string) ([]float32, error) {
+	var embedding []float32
+	if err := json.Unmarshal([]byte(literal), &embedding); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding: %v", err)
+	}
+	return embedding, nil
+}
+
+// detectVectorSupport records whether the embeddings table exists
+func (d *DatabaseService) detectVectorSupport() {
+	if d.db.dialect == dialectSQLite {
+		d.vectors = true
+		return
+	}
+	var exists bool
+	err := d.db.QueryRow(`SELECT to_regclass('document_embeddings') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return
+	}
+	d.vectors = exists
+	if !exists {
+		log.Println("pgvector is not installed; semantic search is disabled")
+	}
+}
+
+// Embedding operations
+func (d *DatabaseService) SaveDocumentEmbedding(documentID DocumentID, model string, embedding []float32) error {
+	if !d.vectors {
+		return ErrSemanticSearchUnavailable
+	}
+	if len(embedding) != EmbeddingDimensions {
+		return fmt.Errorf("embedding has %d dimensions, expected %d", len(embedding), EmbeddingDimensions)
+	}
+
+	value := "$3"
+	if d.db.dialect == dialectPostgres {
+		value = "$3::vector"
+	}
+	query := `
+		INSERT INTO document_embeddings (document_id, model, embedding) VALUES ($1, $2, ` + value + `)
+		ON CONFLICT (document_id) DO UPDATE
+		SET model = EXCLUDED.model, embedding = EXCLUDED.embedding, created_at = CURRENT_TIMESTAMP`
+
+	return withRetry("save_document_embedding", func() error {
+		_, err := d.db.Exec(query, documentID, model, vectorLiteral(embedding))
+		return err
+	})
+}
+
+func (d *DatabaseService) GetDocumentEmbedding(documentID DocumentID) ([]float32, error) {
+	if !d.vectors {
+		return nil, ErrSemanticSearchUnavailable
+	}
+
+	column := "embedding"
+	if d.db.dialect == dialectPostgres {
+		column = "embedding::text"
+	}
+	var literal string
+	err := d.db.QueryRow(`SELECT `+column+` FROM document_embeddings WHERE document_id = $1`, documentID).Scan(&literal)
+	if err != nil {
+		return nil, err
+	}
+	return parseVector(literal)
+}
+
+// FindSimilarDocuments returns the documents closest to embedding by cosine
+// similarity, best first, skipping excludeID
+func (d *DatabaseService) FindSimilarDocuments(embedding []float32, limit int, excludeID DocumentID) ([]*SimilarDocument, error) {
+	if !d.vectors {
+		return nil, ErrSemanticSearchUnavailable
+	}
+	if d.db.dialect == dialectSQLite {
+		return d.findSimilarDocumentsSQLite(embedding, limit, excludeID)
+	}
+
+	query := `
+		SELECT ` + documentColumns + `, e.similarity
+		FROM documents
+		JOIN (
+			SELECT document_id, 1 - (embedding <=> $1::vector) AS similarity
+			FROM document_embeddings
+			WHERE document_id::text <> $3
+			ORDER BY embedding <=> $1::vector
+			LIMIT $2
+		) e ON e.document_id = documents.id
+		WHERE documents.deleted_at IS NULL
+		ORDER BY e.similarity DESC`
+
+	rows, err := d.db.Query(query, vectorLiteral(embedding), limit, excludeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query similar documents: %v", err)
+	}
+	defer rows.Close()
+
+	var results []*SimilarDocument
+	for rows.Next() {
+		var similarity float64
+		doc, err := scanDocument(rows, &similarity)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &SimilarDocument{Document: doc, Similarity: similarity})
+	}
+	return results, rows.Err()
+}
+
+// findSimilarDocumentsSQLite compares against every stored embedding. It is
+// meant for development databases, not large corpora.
+func (d *DatabaseService) findSimilarDocumentsSQLite(embedding []float32, limit int, excludeID DocumentID) ([]*SimilarDocument, error) {
+	rows, err := d.db.Query(`SELECT document_id, embedding FROM document_embeddings WHERE document_id <> $1`, excludeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %v", err)
+	}
+
+	type scored struct {
+		id         DocumentID
+		similarity float64
+	}
+	var candidates []scored
+	for rows.Next() {
+		var id DocumentID
+		var literal string
+		if err := rows.Scan(&id, &literal); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stored, err := parseVector(literal)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		candidates = append(candidates, scored{id: id, similarity: CosineSimilarity(embedding, stored)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].similarity > candidates[j].similarity })
+	if limit < len(candidates) {
+		candidates = candidates[:limit]
+	}
+
+	results := make([]*SimilarDocument, 0, len(candidates))
+	for _, candidate := range candidates {
+		doc, err := d.GetDocument(candidate.id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &SimilarDocument{Document: doc, Similarity: candidate.similarity})
+	}
+	return results, nil
+}
+
+// SearchDocuments finds documents whose filename or extracted text contains
+// query, case-insensitively, newest first among the documents in scope
+func (d *DatabaseService) SearchDocuments(query string, limit int, scope DocumentScope) ([]*Document, error) {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	pattern := "%" + escaper.Replace(strings.ToLower(query)) + "%"
+
+	args := []interface{}{pattern}
+	conditions := []string{`(LOWER(original_filename) LIKE $1 ESCAPE '\'
+		   OR LOWER(COALESCE(extracted_text, '')) LIKE $1 ESCAPE '\')`, `deleted_at IS NULL`}
+	conditions = append(conditions, scope.conditions(&args)...)
+	args = append(args, limit)
+
+	rows, err := d.db.Query(`
+		SELECT `+documentColumns+` FROM documents
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY created_at DESC LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %v", err)
+	}
+	defer rows.Close()
+
+	var documents []*Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
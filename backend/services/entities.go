@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DocumentEntity is an identifying value found in a document's text, such as
+// a URL or IBAN, kept so documents can be looked up by the values they share
+type DocumentEntity struct {
+	DocumentID DocumentID `json:"document_id"`
+	Kind       string     `json:"kind"`
+	Value      string     `json:"value"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ParseEntity splits a "kind:value" string from ExtractEntities
+func ParseEntity(entity string) (kind, value string, ok bool) {
+	return strings.Cut(entity, ":")
+}
+
+// ReplaceDocumentEntities stores the "kind:value" entities of a document in
+// place of those recorded before
+func (d *DatabaseService) ReplaceDocumentEntities(documentID DocumentID, entities []string) error {
+	return withRetry("replace_document_entities", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM document_entities WHERE document_id = $1`, documentID); err != nil {
+			return err
+		}
+		for _, entity := range entities {
+			kind, value, ok := ParseEntity(entity)
+			if !ok {
+				continue
+			}
+			_, err := tx.Exec(`INSERT INTO document_entities (document_id, kind, value) VALUES ($1, $2, $3)`,
+				documentID, kind, value)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetDocumentEntities returns a document's entities ordered by kind and value
+func (d *DatabaseService) GetDocumentEntities(documentID DocumentID) ([]*DocumentEntity, error) {
+	rows, err := d.db.Query(`
+		SELECT document_id, kind, value, created_at FROM document_entities
+		WHERE document_id = $1 ORDER BY kind, value`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document entities: %v", err)
+	}
+	defer rows.Close()
+
+	entities := []*DocumentEntity{}
+	for rows.Next() {
+		entity := &DocumentEntity{}
+		if err := rows.Scan(&entity.DocumentID, &entity.Kind, &entity.Value, &entity.CreatedAt); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	return entities, rows.Err()
+}
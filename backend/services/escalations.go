@@ -0,0 +1,286 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxEscalationSteps bounds the length of an escalation chain
+const maxEscalationSteps = 10
+
+// EscalationStep is one level of an escalation chain. An alert still open
+// AfterMinutes after it reached the previous level is reassigned to UserID.
+type EscalationStep struct {
+	Name         string `json:"name"`
+	UserID       string `json:"user_id"`
+	AfterMinutes int    `json:"after_minutes"`
+}
+
+// After is how long an alert lingers at the previous level before this step
+func (s EscalationStep) After() time.Duration {
+	return time.Duration(s.AfterMinutes) * time.Minute
+}
+
+// EscalationChain lists the steps open alerts of a tenant escalate through,
+// from the first escalation to the last. With BusinessHours the steps' delays
+// only count the business hours of the tenant's holiday calendar.
+type EscalationChain struct {
+	Steps         []EscalationStep `json:"steps"`
+	BusinessHours bool             `json:"business_hours,omitempty"`
+}
+
+// EscalationChainError lists the problems found in an escalation chain
+type EscalationChainError struct {
+	Problems []string
+}
+
+func (e *EscalationChainError) Error() string {
+	return "invalid escalation chain: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that the chain has between one and maxEscalationSteps
+// named steps, each with a user and a positive delay
+func (c *EscalationChain) Validate() error {
+	var problems []string
+	if len(c.Steps) == 0 || len(c.Steps) > maxEscalationSteps {
+		problems = append(problems, fmt.Sprintf("between 1 and %d steps are required", maxEscalationSteps))
+	}
+	for i, step := range c.Steps {
+		if strings.TrimSpace(step.Name) == "" || len(step.Name) > 100 {
+			problems = append(problems, fmt.Sprintf("steps[%d].name is required (at most 100 characters)", i))
+		}
+		if !IsUUID(step.UserID) {
+			problems = append(problems, fmt.Sprintf("steps[%d].user_id must be a user ID", i))
+		}
+		if step.AfterMinutes < 1 {
+			problems = append(problems, fmt.Sprintf("steps[%d].after_minutes must be at least 1", i))
+		}
+	}
+	if len(problems) > 0 {
+		return &EscalationChainError{Problems: problems}
+	}
+	return nil
+}
+
+func (c EscalationChain) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (c *EscalationChain) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("unsupported escalation chain type %T", src)
+	}
+}
+
+// AlertEscalation records one move of an alert up its escalation chain
+type AlertEscalation struct {
+	ID          int64     `json:"id"`
+	AlertID     string    `json:"alert_id"`
+	Level       int       `json:"level"`
+	StepName    string    `json:"step_name"`
+	FromUser    *string   `json:"from_user"`
+	ToUser      *string   `json:"to_user"`
+	EscalatedAt time.Time `json:"escalated_at"`
+}
+
+// EscalationCandidate is an open alert of a tenant with an escalation chain.
+// Clock counts the business hours of the tenant's holiday calendar when the
+// chain asks for them, and every hour otherwise.
+type EscalationCandidate struct {
+	Alert *Alert
+	Chain *EscalationChain
+	Clock SLAClock
+}
+
+// Due returns the step the alert escalates to at now, if it has lingered
+// long enough at its level and the chain goes further
+func (c *EscalationCandidate) Due(now time.Time) (EscalationStep, bool) {
+	if c.Alert.EscalationLevel >= len(c.Chain.Steps) {
+		return EscalationStep{}, false
+	}
+	since := c.Alert.CreatedAt
+	switch {
+	case c.Alert.EscalatedAt != nil:
+		since = *c.Alert.EscalatedAt
+	case c.Alert.AssignedAt != nil:
+		since = *c.Alert.AssignedAt
+	}
+	step := c.Chain.Steps[c.Alert.EscalationLevel]
+	return step, !now.Before(c.Clock.Add(since, step.After()))
+}
+
+// UpdateTenantEscalationChain replaces the tenant's escalation chain; nil
+// turns escalation off. Every step's user must belong to the tenant, and a
+// chain counting business hours needs the tenant to have a holiday calendar.
+// It returns sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantEscalationChain(id string, chain *EscalationChain) error {
+	if chain != nil {
+		if err := chain.Validate(); err != nil {
+			return err
+		}
+		var problems []string
+		for i, step := range chain.Steps {
+			var member bool
+			err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND tenant_id = $2)`, step.UserID, id).Scan(&member)
+			if err != nil {
+				return err
+			}
+			if !member {
+				problems = append(problems, fmt.Sprintf("steps[%d].user_id is not a user of the tenant", i))
+			}
+		}
+		if chain.BusinessHours {
+			var calendar *string
+			if err := d.db.QueryRow(`SELECT holiday_calendar FROM tenants WHERE id = $1`, id).Scan(&calendar); err != nil {
+				return err
+			}
+			if calendar == nil {
+				problems = append(problems, "business_hours needs a holiday calendar for the tenant")
+			}
+		}
+		if len(problems) > 0 {
+			return &EscalationChainError{Problems: problems}
+		}
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET escalation_chain = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, chain)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetEscalationCandidates returns up to limit open alerts of tenants with
+// an escalation chain that have not reached the end of it, longest at their
+// level first, with the calendars of chains counting business hours
+func (d *DatabaseService) GetEscalationCandidates(limit int) ([]*EscalationCandidate, error) {
+	columns := make([]string, 0, 16)
+	for _, column := range strings.Split(alertColumns, ",") {
+		columns = append(columns, "a."+strings.TrimSpace(column))
+	}
+	steps := `jsonb_array_length(t.escalation_chain->'steps')`
+	if d.db.dialect == dialectSQLite {
+		steps = `json_array_length(t.escalation_chain, '$.steps')`
+	}
+	rows, err := d.db.Query(`
+		SELECT `+strings.Join(columns, ", ")+`, t.escalation_chain, t.time_zone, t.holiday_calendar
+		FROM alerts a JOIN tenants t ON t.id = a.tenant_id
+		WHERE a.acknowledged_at IS NULL AND t.escalation_chain IS NOT NULL
+		  AND a.escalation_level < `+steps+`
+		ORDER BY COALESCE(a.escalated_at, a.assigned_at, a.created_at) LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts to escalate: %v", err)
+	}
+	defer rows.Close()
+
+	var candidates []*EscalationCandidate
+	calendarCodes := map[*EscalationCandidate]string{}
+	for rows.Next() {
+		candidate := &EscalationCandidate{Chain: &EscalationChain{}}
+		tenant := &Tenant{}
+		alert, err := scanAlert(rows, candidate.Chain, &tenant.TimeZone, &tenant.HolidayCalendar)
+		if err != nil {
+			return nil, err
+		}
+		candidate.Alert = alert
+		candidate.Clock.Location = tenant.Location()
+		if candidate.Chain.BusinessHours && tenant.HolidayCalendar != nil {
+			calendarCodes[candidate] = *tenant.HolidayCalendar
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// A calendar deleted since leaves the chain counting all hours
+	calendars := map[string]*HolidayCalendar{}
+	for candidate, code := range calendarCodes {
+		calendar, ok := calendars[code]
+		if !ok {
+			calendar, err = d.GetHolidayCalendar(code, 0)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+			calendars[code] = calendar
+		}
+		candidate.Clock.Calendar = calendar
+	}
+	return candidates, nil
+}
+
+// EscalateAlert moves an open alert from level to the next one, assigning it
+// to assignee and recording the escalation. original is who the step named
+// when a delegation sent the alert to someone else. It reports false when
+// the alert was closed or escalated by someone else in the meantime.
+func (d *DatabaseService) EscalateAlert(id string, level int, step EscalationStep, assignee string, original *string) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var from *string
+	if err := tx.QueryRow(`SELECT assigned_to FROM alerts WHERE id = $1`, id).Scan(&from); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(`
+		UPDATE alerts SET escalation_level = $3, escalated_at = CURRENT_TIMESTAMP,
+		       assigned_to = $4, original_assignee = $5, assigned_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND escalation_level = $2 AND acknowledged_at IS NULL`,
+		id, level, level+1, assignee, original)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO alert_escalations (alert_id, level, step_name, from_user, to_user)
+		VALUES ($1, $2, $3, $4, $5)`, id, level+1, step.Name, from, assignee)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// GetAlertEscalations returns an alert's escalations in order
+func (d *DatabaseService) GetAlertEscalations(alertID string) ([]*AlertEscalation, error) {
+	rows, err := d.db.Query(`
+		SELECT id, alert_id, level, step_name, from_user, to_user, escalated_at
+		FROM alert_escalations WHERE alert_id = $1 ORDER BY level, id`, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert escalations: %v", err)
+	}
+	defer rows.Close()
+
+	escalations := []*AlertEscalation{}
+	for rows.Next() {
+		escalation := &AlertEscalation{}
+		err := rows.Scan(&escalation.ID, &escalation.AlertID, &escalation.Level, &escalation.StepName,
+			&escalation.FromUser, &escalation.ToUser, &escalation.EscalatedAt)
+		if err != nil {
+			return nil, err
+		}
+		escalations = append(escalations, escalation)
+	}
+	return escalations, rows.Err()
+}
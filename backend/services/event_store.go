@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Types of the events of a document's lifecycle
+const (
+	EventDocumentCreated    = "document.created"
+	EventDocumentAnalyzed   = "document.analyzed"
+	EventTextExtracted      = "document.text_extracted"
+	EventMetadataPatched    = "document.metadata_patched"
+	EventTeamChanged        = "document.team_changed"
+	EventStorageTierChanged = "document.storage_tier_changed"
+	EventDocumentExpired    = "document.expired"
+	EventDocumentErased     = "document.erased"
+	EventDocumentDeleted    = "document.deleted"
+	EventDocumentPurged     = "document.purged"
+)
+
+// documentEventGenesisHash is the previous hash of a document's first event
+const documentEventGenesisHash = ""
+
+// StoredEvent is one event of a document's lifecycle as appended to the
+// event store. Hash covers the event and PrevHash, the hash of the
+// document's previous event, so the events of a document form a chain that
+// any edit or removal breaks. Data is nil once redacted; DataSHA256 still
+// chains it.
+type StoredEvent struct {
+	ID         int64      `json:"id"`
+	DocumentID DocumentID `json:"document_id"`
+	TenantID   *string    `json:"tenant_id"`
+	Sequence   int        `json:"sequence"`
+	Type       string     `json:"type"`
+	Data       Metadata   `json:"data"`
+	DataSHA256 string     `json:"data_sha256"`
+	OccurredAt time.Time  `json:"occurred_at"`
+	PrevHash   string     `json:"prev_hash"`
+	Hash       string     `json:"hash"`
+	RedactedAt *time.Time `json:"redacted_at,omitempty"`
+}
+
+// computeHash hashes the event's content together with the previous hash.
+// Times are hashed at second precision, which both dialects store exactly.
+func (e *StoredEvent) computeHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%d\n%s\n%s\n%s", e.PrevHash, e.DocumentID, e.Sequence, e.Type,
+		e.OccurredAt.UTC().Format(time.RFC3339), e.DataSHA256)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dataDigest is the SHA-256 of the canonical encoding of data
+func dataDigest(data Metadata) (string, error) {
+	b, err := canonicalJSON(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON encodes data the way it encodes after a round trip through
+// the database, with sorted keys and numbers as float64
+func canonicalJSON(data Metadata) ([]byte, error) {
+	if data == nil {
+		data = Metadata{}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		return nil, err
+	}
+	return json.Marshal(decoded)
+}
+
+// appendDocumentEvent chains an event to the document's previous one and
+// appends it. It is called in the transaction that projects the change onto
+// documents, after the document row is written, so that the row lock
+// orders concurrent appends.
+func appendDocumentEvent(tx *tx, documentID DocumentID, tenantID *string, eventType string, data Metadata) error {
+	event := &StoredEvent{
+		DocumentID: documentID,
+		TenantID:   tenantID,
+		Type:       eventType,
+		Data:       data,
+		OccurredAt: time.Now().UTC().Truncate(time.Second),
+		PrevHash:   documentEventGenesisHash,
+	}
+	if event.Data == nil {
+		event.Data = Metadata{}
+	}
+
+	err := tx.QueryRow(`
+		SELECT sequence, hash FROM document_events
+		WHERE document_id = $1 ORDER BY sequence DESC LIMIT 1`, documentID).Scan(&event.Sequence, &event.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read last event of document %s: %w", documentID, err)
+	}
+	event.Sequence++
+
+	if event.DataSHA256, err = dataDigest(event.Data); err != nil {
+		return fmt.Errorf("failed to hash event of document %s: %w", documentID, err)
+	}
+	event.Hash = event.computeHash()
+	_, err = tx.Exec(`
+		INSERT INTO document_events (document_id, tenant_id, sequence, type, data, data_sha256, occurred_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		event.DocumentID, event.TenantID, event.Sequence, event.Type, event.Data, event.DataSHA256,
+		tx.dialect.timeArg(event.OccurredAt), event.PrevHash, event.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to append event of document %s: %w", documentID, err)
+	}
+	return nil
+}
+
+// textDigest is the SHA-256 of extracted text. Events record the digest
+// rather than the text, which stays on the document alone.
+func textDigest(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// documentTenant returns the tenant of a document written earlier in tx
+func documentTenant(tx *tx, documentID DocumentID) (*string, error) {
+	var tenantID *string
+	err := tx.QueryRow(`SELECT tenant_id FROM documents WHERE id = $1`, documentID).Scan(&tenantID)
+	return tenantID, err
+}
+
+// GetDocumentEvents returns the document's events in order. Events outlive
+// their document, so a deleted document's history is still returned.
+func (d *DatabaseService) GetDocumentEvents(documentID DocumentID) ([]*StoredEvent, error) {
+	rows, err := d.db.Query(`
+		SELECT id, document_id, tenant_id, sequence, type, data, data_sha256, occurred_at, prev_hash, hash, redacted_at
+		FROM document_events WHERE document_id = $1 ORDER BY sequence`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document events: %v", err)
+	}
+	defer rows.Close()
+
+	events := []*StoredEvent{}
+	for rows.Next() {
+		event := &StoredEvent{}
+		err := rows.Scan(&event.ID, &event.DocumentID, &event.TenantID, &event.Sequence, &event.Type,
+			&event.Data, &event.DataSHA256, &event.OccurredAt, &event.PrevHash, &event.Hash, &event.RedactedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// EventChainVerification is the outcome of checking a document's events
+type EventChainVerification struct {
+	Verified bool `json:"verified"`
+	Events   int  `json:"events"`
+	// Head is the hash of the last event, which auditors may record to
+	// detect a later rewrite of the whole chain
+	Head string `json:"head"`
+	// BrokenAt is the sequence of the first event that fails to verify
+	BrokenAt *int   `json:"broken_at,omitempty"`
+	Problem  string `json:"problem,omitempty"`
+}
+
+// VerifyEventChain recomputes the hash of each event, in sequence order,
+// and checks that it is chained to the event before it. The data of events
+// not redacted must match their data_sha256.
+func VerifyEventChain(events []*StoredEvent) *EventChainVerification {
+	verification := &EventChainVerification{Verified: true, Events: len(events)}
+	prevHash := documentEventGenesisHash
+	broken := func(event *StoredEvent, problem string) *EventChainVerification {
+		verification.Verified = false
+		verification.BrokenAt = &event.Sequence
+		verification.Problem = problem
+		return verification
+	}
+
+	for i, event := range events {
+		if event.Sequence != i+1 {
+			return broken(event, fmt.Sprintf("expected event %d, found event %d", i+1, event.Sequence))
+		}
+		if event.PrevHash != prevHash {
+			return broken(event, "previous hash does not match the hash of the event before it")
+		}
+		if event.RedactedAt == nil {
+			digest, err := dataDigest(event.Data)
+			if err != nil {
+				return broken(event, fmt.Sprintf("data cannot be hashed: %v", err))
+			}
+			if digest != event.DataSHA256 {
+				return broken(event, "data does not match its digest")
+			}
+		}
+		if event.computeHash() != event.Hash {
+			return broken(event, "hash does not match the event's content")
+		}
+		prevHash = event.Hash
+	}
+	verification.Head = prevHash
+	return verification
+}
+
+// redactDocumentEvents clears the data of the document's events in tx,
+// keeping the digests that chain them
+func redactDocumentEvents(tx *tx, documentID DocumentID, now time.Time) error {
+	_, err := tx.Exec(`
+		UPDATE document_events SET data = NULL, redacted_at = $2
+		WHERE document_id = $1 AND data IS NOT NULL`, documentID, tx.dialect.timeArg(now))
+	if err != nil {
+		return fmt.Errorf("failed to redact events of document %s: %w", documentID, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package services
+
+import "sync"
+
+// Document statuses
+const (
+	DocumentUploaded  = "uploaded"
+	DocumentProcessed = "processed"
+)
+
+// documentStatusOrder ranks the statuses in the order a document goes
+// through them
+var documentStatusOrder = map[string]int{
+	DocumentUploaded:  1,
+	DocumentProcessed: 2,
+}
+
+// StatusReached reports whether a document in status has reached want or
+// gone past it
+func StatusReached(status, want string) bool {
+	return documentStatusOrder[status] >= documentStatusOrder[want]
+}
+
+// DocumentEvent reports that a document reached a status
+type DocumentEvent struct {
+	DocumentID DocumentID
+	Status     string
+}
+
+// EventBus delivers document events to the subscribers in this process.
+// Publishing never blocks: a subscriber whose buffer is full misses the
+// event, so subscribers treat an event as a hint to re-read the document
+// rather than as its state.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]struct{}
+}
+
+type eventSubscriber struct {
+	filter func(DocumentEvent) bool
+	events chan DocumentEvent
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// Subscribe delivers the events for which filter returns true, or every
+// event when filter is nil, until cancel is called. The channel is not
+// closed by cancel.
+func (b *EventBus) Subscribe(filter func(DocumentEvent) bool, buffer int) (events <-chan DocumentEvent, cancel func()) {
+	subscriber := &eventSubscriber{filter: filter, events: make(chan DocumentEvent, buffer)}
+	b.mu.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+	return subscriber.events, func() {
+		b.mu.Lock()
+		delete(b.subscribers, subscriber)
+		b.mu.Unlock()
+	}
+}
+
+// SubscribeDocument delivers the events of one document
+func (b *EventBus) SubscribeDocument(id DocumentID) (<-chan DocumentEvent, func()) {
+	return b.Subscribe(func(event DocumentEvent) bool {
+		return event.DocumentID == id
+	}, 1)
+}
+
+// Publish delivers event to its subscribers
+func (b *EventBus) Publish(event DocumentEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for subscriber := range b.subscribers {
+		if subscriber.filter != nil && !subscriber.filter(event) {
+			continue
+		}
+		select {
+		case subscriber.events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// Exemplar is a confirmed fraudulent document kept for comparison with new
+// uploads. Exemplars without a tenant are shared by every tenant.
+type Exemplar struct {
+	ID            string      `json:"id"`
+	TenantID      *string     `json:"tenant_id"`
+	DocumentID    *DocumentID `json:"document_id"`
+	Label         string      `json:"label"`
+	Notes         *string     `json:"notes"`
+	ContentSHA256 *string     `json:"content_sha256"`
+	Entities      []string    `json:"entities"`
+	Embedding     []float32   `json:"-"`
+	PromotedBy    *string     `json:"promoted_by"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// Alert kinds and severities
+const (
+	AlertKindExemplarMatch = "exemplar_match"
+	AlertSeverityCritical  = "critical"
+)
+
+// Alert is raised for a document that needs immediate review
+type Alert struct {
+	ID             string      `json:"id"`
+	TenantID       *string     `json:"tenant_id"`
+	DocumentID     *DocumentID `json:"document_id"`
+	ExemplarID     *string     `json:"exemplar_id"`
+	Kind           string      `json:"kind"`
+	Severity       string      `json:"severity"`
+	Score          *float64    `json:"score"`
+	Details        Metadata    `json:"details"`
+	AcknowledgedBy *string     `json:"acknowledged_by"`
+	AcknowledgedAt *time.Time  `json:"acknowledged_at"`
+	// AssignedTo reviews the alert. OriginalAssignee is who it was meant
+	// for when they had delegated their queue.
+	AssignedTo       *string    `json:"assigned_to"`
+	OriginalAssignee *string    `json:"original_assignee"`
+	AssignedAt       *time.Time `json:"assigned_at"`
+	// EscalationLevel is how many steps of the tenant's escalation chain
+	// the alert went up, last at EscalatedAt
+	EscalationLevel int        `json:"escalation_level"`
+	EscalatedAt     *time.Time `json:"escalated_at"`
+	// Disposition is why the alert was closed, with the outcome it had in
+	// the tenant's disposition taxonomy at the time
+	Disposition        *string   `json:"disposition"`
+	DispositionOutcome *string   `json:"disposition_outcome"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+// Entity patterns, applied in order. Each match is blanked out before the
+// next pattern runs so an IBAN is not also counted as an account number,
+// unless the pattern is overlapping: a URL also yields its domain.
+var entityPatterns = []struct {
+	kind        string
+	re          *regexp.Regexp
+	normalize   func(string) string
+	overlapping bool
+}{
+	{"url", regexp.MustCompile(`(?i)\bhttps?://[^\s"'<>()\[\]]+`), normalizeURL, true},
+	{"email", regexp.MustCompile(`(?i)[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}`), strings.ToLower, false},
+	{"domain", regexp.MustCompile(`(?i)\bhttps?://[^\s/?#"'<>]+`), urlHost, false},
+	{"iban", regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`), digitsAndLetters, false},
+	{"phone", regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?\(?\d{3}\)?[\s.\-]\d{3}[\s.\-]\d{4}\b`), digitsAndLetters, false},
+	{"account", regexp.MustCompile(`\b\d{8,17}\b`), digitsAndLetters, false},
+}
+
+// normalizeURL lower-cases the scheme and host and drops the fragment and any
+// punctuation the URL was followed by in the sentence
+func normalizeURL(match string) string {
+	u, err := url.Parse(strings.TrimRight(match, ".,;:!?"))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u.String()
+}
+
+func urlHost(match string) string {
+	host := strings.ToLower(match)
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	return strings.TrimPrefix(host, "www.")
+}
+
+func digitsAndLetters(match string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(match))
+}
+
+// ExtractEntities returns the identifying values in text that fraudsters tend
+// to reuse across documents, as sorted "kind:value" strings
+func ExtractEntities(text string) []string {
+	seen := map[string]bool{}
+	for _, pattern := range entityPatterns {
+		text = pattern.re.ReplaceAllStringFunc(text, func(match string) string {
+			if value := pattern.normalize(match); value != "" {
+				seen[pattern.kind+":"+value] = true
+			}
+			if pattern.overlapping {
+				return match
+			}
+			return strings.Repeat(" ", len(match))
+		})
+	}
+
+	entities := make([]string, 0, len(seen))
+	for entity := range seen {
+		entities = append(entities, entity)
+	}
+	sort.Strings(entities)
+	return entities
+}
+
+// ExemplarMatch explains why a document resembles an exemplar
+type ExemplarMatch struct {
+	Exemplar            *Exemplar `json:"exemplar"`
+	Score               float64   `json:"score"`
+	HashMatch           bool      `json:"hash_match"`
+	SharedEntities      []string  `json:"shared_entities"`
+	EntityScore         float64   `json:"entity_score"`
+	EmbeddingSimilarity float64   `json:"embedding_similarity"`
+	Reasons             []string  `json:"reasons"`
+}
+
+// MatchExemplar compares a document's content hash, entities and embedding
+// with an exemplar. It returns nil unless at least one signal reaches its
+// threshold in cfg. Empty hashes, entities or embeddings are not compared.
+func MatchExemplar(exemplar *Exemplar, contentSHA256 string, entities []string, embedding []float32, cfg config.ExemplarConfig) *ExemplarMatch {
+	match := &ExemplarMatch{Exemplar: exemplar, SharedEntities: []string{}}
+
+	if contentSHA256 != "" && exemplar.ContentSHA256 != nil && *exemplar.ContentSHA256 == contentSHA256 {
+		match.HashMatch = true
+		match.Score = 1
+		match.Reasons = append(match.Reasons, "identical file content")
+	}
+
+	if len(entities) > 0 && len(exemplar.Entities) > 0 {
+		known := make(map[string]bool, len(exemplar.Entities))
+		for _, entity := range exemplar.Entities {
+			known[entity] = true
+		}
+		for _, entity := range entities {
+			if known[entity] {
+				match.SharedEntities = append(match.SharedEntities, entity)
+			}
+		}
+		smaller := len(entities)
+		if len(exemplar.Entities) < smaller {
+			smaller = len(exemplar.Entities)
+		}
+		match.EntityScore = float64(len(match.SharedEntities)) / float64(smaller)
+		if len(match.SharedEntities) >= cfg.MinSharedEntities && match.EntityScore >= cfg.EntityThreshold {
+			match.Reasons = append(match.Reasons, fmt.Sprintf("%d shared entities", len(match.SharedEntities)))
+			if match.EntityScore > match.Score {
+				match.Score = match.EntityScore
+			}
+		}
+	}
+
+	if len(embedding) > 0 && len(exemplar.Embedding) == len(embedding) {
+		match.EmbeddingSimilarity = CosineSimilarity(embedding, exemplar.Embedding)
+		if match.EmbeddingSimilarity >= cfg.EmbeddingThreshold {
+			match.Reasons = append(match.Reasons, fmt.Sprintf("embedding similarity %.3f", match.EmbeddingSimilarity))
+			if match.EmbeddingSimilarity > match.Score {
+				match.Score = match.EmbeddingSimilarity
+			}
+		}
+	}
+
+	if len(match.Reasons) == 0 {
+		return nil
+	}
+	return match
+}
+
+// Exemplar operations
+const exemplarColumns = `id, tenant_id, document_id, label, notes, content_sha256, entities, embedding, promoted_by, created_at`
+
+func scanExemplar(row rowScanner) (*Exemplar, error) {
+	exemplar := &Exemplar{}
+	var entities string
+	var embedding sql.NullString
+	err := row.Scan(
+		&exemplar.ID, &exemplar.TenantID, &exemplar.DocumentID, &exemplar.Label, &exemplar.Notes,
+		&exemplar.ContentSHA256, &entities, &embedding, &exemplar.PromotedBy, &exemplar.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(entities), &exemplar.Entities); err != nil {
+		return nil, fmt.Errorf("failed to parse exemplar entities: %v", err)
+	}
+	if embedding.Valid {
+		if exemplar.Embedding, err = parseVector(embedding.String); err != nil {
+			return nil, err
+		}
+	}
+	return exemplar, nil
+}
+
+func (d *DatabaseService) CreateExemplar(exemplar *Exemplar) error {
+	if exemplar.Entities == nil {
+		exemplar.Entities = []string{}
+	}
+	entities, err := json.Marshal(exemplar.Entities)
+	if err != nil {
+		return err
+	}
+	var embedding *string
+	if len(exemplar.Embedding) > 0 {
+		literal := vectorLiteral(exemplar.Embedding)
+		embedding = &literal
+	}
+
+	query := `
+		INSERT INTO fraud_exemplars (
+			tenant_id, document_id, label, notes, content_sha256, entities, embedding, promoted_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`
+
+	return withRetry("create_exemplar", func() error {
+		return d.db.QueryRow(
+			query,
+			exemplar.TenantID, exemplar.DocumentID, exemplar.Label, exemplar.Notes,
+			exemplar.ContentSHA256, string(entities), embedding, exemplar.PromotedBy,
+		).Scan(&exemplar.ID, &exemplar.CreatedAt)
+	})
+}
+
+func (d *DatabaseService) GetExemplar(id string) (*Exemplar, error) {
+	return scanExemplar(d.db.QueryRow(`SELECT `+exemplarColumns+` FROM fraud_exemplars WHERE id = $1`, id))
+}
+
+// GetExemplars returns the shared exemplars plus those owned by tenantID,
+// newest first. A nil tenantID returns only the shared ones.
+func (d *DatabaseService) GetExemplars(tenantID *string) ([]*Exemplar, error) {
+	rows, err := d.db.Query(`
+		SELECT `+exemplarColumns+` FROM fraud_exemplars
+		WHERE tenant_id IS NULL OR tenant_id = $1
+		ORDER BY created_at DESC`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exemplars: %v", err)
+	}
+	defer rows.Close()
+
+	var exemplars []*Exemplar
+	for rows.Next() {
+		exemplar, err := scanExemplar(rows)
+		if err != nil {
+			return nil, err
+		}
+		exemplars = append(exemplars, exemplar)
+	}
+	return exemplars, rows.Err()
+}
+
+// DeleteExemplar removes an exemplar; alerts it raised keep their details but
+// lose the link. It returns sql.ErrNoRows when there is no such exemplar.
+func (d *DatabaseService) DeleteExemplar(id string) error {
+	result, err := d.db.Exec(`DELETE FROM fraud_exemplars WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete exemplar: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Alert operations
+const alertColumns = `id, tenant_id, document_id, exemplar_id, kind, severity, score, details, acknowledged_by, acknowledged_at,
+	assigned_to, original_assignee, assigned_at, escalation_level, escalated_at, disposition, disposition_outcome, created_at`
+
+// scanAlert reads a row of alertColumns, followed by any extra columns
+func scanAlert(row rowScanner, extra ...interface{}) (*Alert, error) {
+	alert := &Alert{}
+	dest := []interface{}{
+		&alert.ID, &alert.TenantID, &alert.DocumentID, &alert.ExemplarID, &alert.Kind, &alert.Severity,
+		&alert.Score, &alert.Details, &alert.AcknowledgedBy, &alert.AcknowledgedAt,
+		&alert.AssignedTo, &alert.OriginalAssignee, &alert.AssignedAt,
+		&alert.EscalationLevel, &alert.EscalatedAt, &alert.Disposition, &alert.DispositionOutcome, &alert.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+func (d *DatabaseService) CreateAlert(alert *Alert) error {
+	if alert.Details == nil {
+		alert.Details = Metadata{}
+	}
+	query := `
+		INSERT INTO alerts (tenant_id, document_id, exemplar_id, kind, severity, score, details)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	return withRetry("create_alert", func() error {
+		return d.db.QueryRow(
+			query,
+			alert.TenantID, alert.DocumentID, alert.ExemplarID, alert.Kind, alert.Severity, alert.Score, alert.Details,
+		).Scan(&alert.ID, &alert.CreatedAt)
+	})
+}
+
+func (d *DatabaseService) GetAlert(id string) (*Alert, error) {
+	return scanAlert(d.db.QueryRow(`SELECT `+alertColumns+` FROM alerts WHERE id = $1`, id))
+}
+
+// GetAlerts returns alerts newest first, optionally only those nobody has
+// acknowledged yet. A tenantID limits them to that tenant's alerts.
+func (d *DatabaseService) GetAlerts(limit, offset int, unacknowledgedOnly bool, tenantID *string) ([]*Alert, error) {
+	args := []interface{}{limit, offset}
+	var conditions []string
+	if unacknowledgedOnly {
+		conditions = append(conditions, "acknowledged_at IS NULL")
+	}
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		conditions = append(conditions, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	rows, err := d.db.Query(`
+		SELECT `+alertColumns+` FROM alerts `+where+`
+		ORDER BY created_at DESC LIMIT $1 OFFSET $2`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %v", err)
+	}
+	defer rows.Close()
+
+	var alerts []*Alert
+	for rows.Next() {
+		alert, err := scanAlert(rows)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// AcknowledgeAlert records who acknowledged the alert and why, with a code of
+// the tenant's disposition taxonomy. An unknown code returns a
+// DispositionError. Acknowledging it again keeps the first acknowledgement.
+// Critical alerts are only closed through an approved close_alert approval,
+// and return ErrApprovalRequired.
+func (d *DatabaseService) AcknowledgeAlert(id, by, disposition string) (*Alert, error) {
+	tenantID, critical, err := approvalTarget(d.db, ApprovalCloseAlert, id)
+	if err != nil {
+		return nil, err
+	}
+	chosen, err := dispositionFor(d.db, tenantID, disposition)
+	if err != nil {
+		return nil, err
+	}
+	if critical {
+		return nil, ErrApprovalRequired
+	}
+	_, err = d.db.Exec(`
+		UPDATE alerts SET acknowledged_by = $2, acknowledged_at = CURRENT_TIMESTAMP, disposition = $3, disposition_outcome = $4
+		WHERE id = $1 AND acknowledged_at IS NULL`, id, by, chosen.Code, chosen.Outcome)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acknowledge alert: %v", err)
+	}
+	return d.GetAlert(id)
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidExportCursor is returned when an export cursor cannot be decoded
+var ErrInvalidExportCursor = errors.New("invalid export cursor")
+
+// ExportCursor is the position of a document export: the last exported
+// document's updated_at and ID. Documents are exported in that order, so an
+// export resumed from a cursor continues after the last document received,
+// and a finished export's cursor is the watermark for the next one.
+type ExportCursor struct {
+	UpdatedAt time.Time
+	ID        DocumentID
+}
+
+// String encodes the cursor as an opaque token
+func (c ExportCursor) String() string {
+	raw := c.UpdatedAt.UTC().Format(time.RFC3339Nano) + "|" + string(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseExportCursor decodes a token returned by ExportCursor.String
+func ParseExportCursor(token string) (ExportCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ExportCursor{}, ErrInvalidExportCursor
+	}
+	updatedAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return ExportCursor{}, ErrInvalidExportCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, updatedAt)
+	if err != nil {
+		return ExportCursor{}, ErrInvalidExportCursor
+	}
+	return ExportCursor{UpdatedAt: t, ID: DocumentID(id)}, nil
+}
+
+// DocumentExport is one document of an export with its detailed analysis,
+// the entities parsed from its text and its fraud detections
+type DocumentExport struct {
+	Document   *Document         `json:"document"`
+	Entities   []*DocumentEntity `json:"entities"`
+	Detections []*FraudDetection `json:"detections"`
+}
+
+// ExportDocuments returns up to limit documents changed after the cursor,
+// ordered by updated_at and ID. tenantID restricts the export to one
+// tenant's documents when set.
+func (d *DatabaseService) ExportDocuments(after ExportCursor, tenantID *string, limit int) ([]*DocumentExport, error) {
+	if after.ID == "" {
+		// Sorts before every ID, and unlike "" is a valid UUID on Postgres
+		after.ID = "00000000-0000-0000-0000-000000000000"
+	}
+	args := []interface{}{d.db.dialect.timeArg(after.UpdatedAt), after.ID}
+	query := `
+		SELECT ` + documentColumns + `, a.emotion_analysis, a.pattern_analysis
+		FROM documents
+		LEFT JOIN (
+			SELECT document_id, emotion_analysis, pattern_analysis FROM document_analyses
+		) a ON a.document_id = documents.id
+		WHERE (updated_at > $1 OR (updated_at = $1 AND id > $2)) AND deleted_at IS NULL`
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		query += fmt.Sprintf(" AND tenant_id = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY updated_at, id LIMIT $%d", len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents to export: %v", err)
+	}
+	defer rows.Close()
+
+	var exports []*DocumentExport
+	byID := make(map[DocumentID]*DocumentExport)
+	for rows.Next() {
+		var emotion, pattern *string
+		doc, err := scanDocument(rows, &emotion, &pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exported document: %v", err)
+		}
+		doc.EmotionAnalysis, doc.PatternAnalysis = emotion, pattern
+		export := &DocumentExport{Document: doc, Entities: []*DocumentEntity{}, Detections: []*FraudDetection{}}
+		exports = append(exports, export)
+		byID[doc.ID] = export
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return exports, nil
+	}
+
+	placeholders := make([]string, len(exports))
+	ids := make([]interface{}, len(exports))
+	for i, export := range exports {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		ids[i] = export.Document.ID
+	}
+	in := "(" + strings.Join(placeholders, ", ") + ")"
+
+	if err := d.exportEntities(in, ids, byID); err != nil {
+		return nil, err
+	}
+	if err := d.exportDetections(in, ids, byID); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+func (d *DatabaseService) exportEntities(in string, ids []interface{}, byID map[DocumentID]*DocumentExport) error {
+	rows, err := d.db.Query(`
+		SELECT document_id, kind, value, created_at FROM document_entities
+		WHERE document_id IN `+in+` ORDER BY document_id, kind, value`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to query exported entities: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entity := &DocumentEntity{}
+		if err := rows.Scan(&entity.DocumentID, &entity.Kind, &entity.Value, &entity.CreatedAt); err != nil {
+			return fmt.Errorf("failed to scan exported entity: %v", err)
+		}
+		export := byID[entity.DocumentID]
+		export.Entities = append(export.Entities, entity)
+	}
+	return rows.Err()
+}
+
+func (d *DatabaseService) exportDetections(in string, ids []interface{}, byID map[DocumentID]*DocumentExport) error {
+	rows, err := d.db.Query(`
+		SELECT id, document_id, fraud_pattern_id, confidence_score, detection_details,
+		       is_false_positive, reviewed_by, reviewed_at, disposition, disposition_outcome, created_at
+		FROM document_fraud_detections
+		WHERE document_id IN `+in+` ORDER BY document_id, created_at`, ids...)
+	if err != nil {
+		return fmt.Errorf("failed to query exported detections: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		detection := &FraudDetection{}
+		err := rows.Scan(
+			&detection.ID, &detection.DocumentID, &detection.FraudPatternID, &detection.ConfidenceScore,
+			&detection.DetectionDetails, &detection.IsFalsePositive, &detection.ReviewedBy, &detection.ReviewedAt,
+			&detection.Disposition, &detection.DispositionOutcome, &detection.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan exported detection: %v", err)
+		}
+		export := byID[detection.DocumentID]
+		export.Detections = append(export.Detections, detection)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+)
+
+var (
+	// ErrExtractionUnsupported is returned for content types no extractor
+	// handles
+	ErrExtractionUnsupported = errors.New("text extraction not supported")
+
+	// ErrExtractionTimeout is returned when an extractor runs past its timeout
+	ErrExtractionTimeout = errors.New("text extraction timed out")
+)
+
+// Extraction is the text pulled out of a document, with whatever the
+// extractor reports about it such as OCR confidence
+type Extraction struct {
+	Text        string       `json:"text"`
+	Details     Metadata     `json:"details,omitempty"`
+	RiskFactors []RiskFactor `json:"risk_factors,omitempty"`
+	// Pages locate the text of each page in Text, for extractors that read
+	// documents page by page
+	Pages []ExtractedPage `json:"pages,omitempty"`
+}
+
+// RiskFactor is something suspicious about a file's structure found while
+// extracting it. It is recorded as a detection of the active fraud pattern of
+// PatternType.
+type RiskFactor struct {
+	PatternType string   `json:"pattern_type"`
+	Confidence  float64  `json:"confidence"`
+	Details     Metadata `json:"details,omitempty"`
+}
+
+// Extractor pulls the text out of documents of one family of formats.
+// Extract should give up once ctx is done.
+type Extractor interface {
+	Name() string
+	Extract(ctx context.Context, contentType string, r io.Reader) (*Extraction, error)
+}
+
+type registeredExtractor struct {
+	extractor Extractor
+	timeout   time.Duration
+}
+
+// ExtractorRegistry picks the extractor for a document by its media type,
+// enforcing each extractor's timeout and recording its duration
+type ExtractorRegistry struct {
+	mu     sync.RWMutex
+	byType map[string]registeredExtractor
+}
+
+func NewExtractorRegistry() *ExtractorRegistry {
+	return &ExtractorRegistry{byType: map[string]registeredExtractor{}}
+}
+
+// DefaultExtractorRegistry handles plain text, HTML, email and Office files
+// in process and sends PDFs and images to the AI service for parsing and OCR.
+// Office files are copied through spooler.
+func DefaultExtractorRegistry(cfg config.ExtractionConfig, ai AIClient, spooler *Spooler) *ExtractorRegistry {
+	r := NewExtractorRegistry()
+
+	text := TextExtractor{}
+	r.Register(text, cfg.TimeoutFor(text.Name()), "text/plain")
+
+	html := HTMLExtractor{}
+	r.Register(html, cfg.TimeoutFor(html.Name()), "text/html", "application/xhtml+xml")
+
+	email := EmailExtractor{}
+	r.Register(email, cfg.TimeoutFor(email.Name()), "message/rfc822")
+
+	office := OfficeExtractor{Spooler: spooler}
+	r.Register(office, cfg.TimeoutFor(office.Name()), OfficeMediaTypes...)
+
+	if ai != nil {
+		remote := NewAIServiceExtractor(ai)
+		r.Register(remote, cfg.TimeoutFor(remote.Name()),
+			"application/pdf", "image/jpeg", "image/png", "image/tiff")
+	}
+	return r
+}
+
+// Register makes extractor handle the given media types, replacing any
+// extractor registered for them before. A timeout of 0 means no limit.
+func (r *ExtractorRegistry) Register(extractor Extractor, timeout time.Duration, mediaTypes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, mediaType := range mediaTypes {
+		r.byType[strings.ToLower(mediaType)] = registeredExtractor{extractor: extractor, timeout: timeout}
+	}
+}
+
+func (r *ExtractorRegistry) lookup(contentType string) (registeredExtractor, bool) {
+	// Content-Type may carry parameters such as charset
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return registeredExtractor{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.byType[mediaType]
+	return entry, ok
+}
+
+// MediaTypes lists the supported media types with the name of their extractor
+func (r *ExtractorRegistry) MediaTypes() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]string, len(r.byType))
+	for mediaType, entry := range r.byType {
+		out[mediaType] = entry.extractor.Name()
+	}
+	return out
+}
+
+// Extract runs the extractor registered for contentType. It returns
+// ErrExtractionUnsupported when there is none and an error wrapping
+// ErrExtractionTimeout when the extractor is still running at its timeout;
+// r is then abandoned to the extractor, so callers should close it.
+func (r *ExtractorRegistry) Extract(ctx context.Context, contentType string, reader io.Reader) (*Extraction, error) {
+	entry, ok := r.lookup(contentType)
+	if !ok {
+		return nil, ErrExtractionUnsupported
+	}
+	name := entry.extractor.Name()
+
+	if entry.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, entry.timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		extraction *Extraction
+		err        error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	go func() {
+		extraction, err := entry.extractor.Extract(ctx, contentType, reader)
+		done <- result{extraction, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+
+	outcome := "success"
+	switch {
+	case errors.Is(res.err, context.DeadlineExceeded):
+		outcome = "timeout"
+		res.err = fmt.Errorf("%w: %s extractor took longer than %v", ErrExtractionTimeout, name, entry.timeout)
+	case res.err != nil:
+		outcome = "error"
+	}
+	metrics.ExtractionDuration.WithLabelValues(name, outcome).Observe(time.Since(start).Seconds())
+
+	if res.err != nil {
+		return nil, res.err
+	}
+	return res.extraction, nil
+}
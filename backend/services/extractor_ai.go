@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// AIServiceExtractor sends documents to the AI service's /extract-text,
+// which parses PDFs and Word documents and runs OCR on images
+type AIServiceExtractor struct {
+	ai AIClient
+}
+
+func NewAIServiceExtractor(ai AIClient) *AIServiceExtractor {
+	return &AIServiceExtractor{ai: ai}
+}
+
+func (e *AIServiceExtractor) Name() string { return "ai-service" }
+
+func (e *AIServiceExtractor) Extract(ctx context.Context, contentType string, r io.Reader) (*Extraction, error) {
+	resp, err := e.ai.ExtractText(ctx, ExtractTextRequest{
+		Filename:    "document",
+		ContentType: contentType,
+		Content:     r,
+	})
+	var statusErr *AIStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnsupportedMediaType {
+		return nil, fmt.Errorf("%w: %s", ErrExtractionUnsupported, statusErr.Detail)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Extraction{
+		Text: *resp.ExtractedText,
+		Details: Metadata{
+			"file_type":             resp.FileType,
+			"confidence_score":      *resp.ConfidenceScore,
+			"quality_level":         resp.QualityLevel,
+			"preprocessing_applied": resp.PreprocessingApplied,
+			"text_blocks":           resp.TextBlocks,
+			"processing_notes":      resp.ProcessingNotes,
+			"page_count":            resp.PageCount,
+		},
+		Pages: resp.Pages,
+	}, nil
+}
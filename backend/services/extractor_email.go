@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// emailMaxDepth bounds how deeply multipart bodies are followed
+const emailMaxDepth = 10
+
+// emailHeaders are copied into the text ahead of the body. A Reply-To that
+// differs from From is a common sign of a spoofed sender.
+var emailHeaders = []string{"From", "Reply-To", "To", "Cc", "Subject", "Date"}
+
+// EmailExtractor reads RFC 822 messages (.eml files). The text is the main
+// headers followed by the body. When the message has an HTML version it is
+// used, converted like HTMLExtractor does, because it keeps link targets that
+// the plain text version often drops. Attachments are listed in the details
+// but not extracted.
+type EmailExtractor struct{}
+
+func (EmailExtractor) Name() string { return "email" }
+
+func (EmailExtractor) Extract(ctx context.Context, contentType string, r io.Reader) (*Extraction, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("not an email message: %v", err)
+	}
+
+	words := &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+	details := Metadata{}
+	var lines []string
+	for _, name := range emailHeaders {
+		value := msg.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		if decoded, err := words.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+		lines = append(lines, name+": "+value)
+		details[strings.ToLower(strings.ReplaceAll(name, "-", "_"))] = value
+	}
+
+	body := &emailBody{ctx: ctx, words: words, links: map[string]bool{}, attachments: []string{}}
+	err = body.walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, format := body.plain, "plain"
+	if len(body.html) > 0 {
+		parts, format = body.html, "html"
+	}
+	if len(parts) > 0 {
+		lines = append(lines, "", strings.Join(parts, "\n\n"))
+	}
+
+	links := make([]string, 0, len(body.links))
+	for link := range body.links {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+	details["body_format"] = format
+	details["links"] = links
+	details["attachments"] = body.attachments
+
+	return &Extraction{Text: SanitizeText(strings.Join(lines, "\n")), Details: details}, nil
+}
+
+type emailBody struct {
+	ctx         context.Context
+	words       *mime.WordDecoder
+	plain       []string
+	html        []string
+	links       map[string]bool
+	attachments []string
+}
+
+// walk collects the text parts of one MIME entity, descending into multipart
+// entities
+func (b *emailBody) walk(contentType, transferEncoding, disposition string, body io.Reader, depth int) error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	if depth > emailMaxDepth {
+		return errors.New("email nests multipart bodies too deeply")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// RFC 2045 default for a missing or unreadable Content-Type
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(transferEncoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	dispositionType, dispositionParams, _ := mime.ParseMediaType(disposition)
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if dispositionType == "attachment" || (filename != "" && !strings.HasPrefix(mediaType, "multipart/")) {
+		if decoded, err := b.words.DecodeHeader(filename); err == nil {
+			filename = decoded
+		}
+		b.attachments = append(b.attachments, filename)
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		parts := multipart.NewReader(body, params["boundary"])
+		for {
+			// NextRawPart leaves quoted-printable decoding to walk
+			part, err := parts.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read email part: %v", err)
+			}
+			err = b.walk(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"), part, depth+1)
+			if err != nil {
+				return err
+			}
+		}
+
+	case mediaType == "text/html":
+		decoded, err := charset.NewReader(body, contentType)
+		if err != nil {
+			return err
+		}
+		doc, err := htmlToText(b.ctx, decoded)
+		if err != nil {
+			return err
+		}
+		for _, link := range doc.links {
+			b.links[link] = true
+		}
+		if doc.text != "" {
+			b.html = append(b.html, doc.text)
+		}
+
+	case mediaType == "text/plain":
+		decoded, err := decodeCharset(contentType, body)
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(decoded)
+		if err != nil {
+			return fmt.Errorf("failed to read email body: %v", err)
+		}
+		if text := SanitizeText(string(content)); text != "" {
+			b.plain = append(b.plain, text)
+		}
+	}
+	// Other inline parts, such as images, hold no text
+	return nil
+}
@@ -0,0 +1,592 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatternTypeEmbeddedMacros is the fraud pattern recorded for Office
+// documents that carry a VBA project
+const PatternTypeEmbeddedMacros = "embedded_macros"
+
+// officeMaxPartSize caps how much of one archive member is decompressed, so a
+// small zip bomb cannot exhaust memory
+const officeMaxPartSize = 64 << 20
+
+// OfficeMediaTypes are the Office Open XML formats OfficeExtractor reads
+var OfficeMediaTypes = []string{
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.ms-word.document.macroEnabled.12",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.ms-excel.sheet.macroEnabled.12",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"application/vnd.ms-powerpoint.presentation.macroEnabled.12",
+}
+
+// OfficeExtractor reads Word, Excel and PowerPoint files in process. The text
+// keeps the document's structure: Word tables become | separated rows and
+// each sheet or slide starts with a === heading. Files containing macros get
+// an embedded_macros risk factor.
+type OfficeExtractor struct {
+	// Spooler copies files for the random access zip archives need, to disk
+	// when they are large; without one files are read into memory
+	Spooler *Spooler
+}
+
+func (OfficeExtractor) Name() string { return "office" }
+
+func (e OfficeExtractor) Extract(ctx context.Context, contentType string, r io.Reader) (*Extraction, error) {
+	content, size, err := e.randomAccess(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := content.(io.Closer); ok {
+		defer closer.Close()
+	}
+	archive, err := zip.NewReader(content, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an Office Open XML file: %v", err)
+	}
+	doc := &officeDocument{ctx: ctx, files: map[string]*zip.File{}}
+	for _, f := range archive.File {
+		doc.files[f.Name] = f
+	}
+
+	var extraction *Extraction
+	switch {
+	case doc.has("word/document.xml"):
+		extraction, err = doc.extractWord()
+	case doc.has("xl/workbook.xml"):
+		extraction, err = doc.extractWorkbook()
+	case doc.has("ppt/presentation.xml"):
+		extraction, err = doc.extractPresentation()
+	default:
+		return nil, errors.New("not a Word, Excel or PowerPoint file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var macros []string
+	for name := range doc.files {
+		if strings.EqualFold(path.Base(name), "vbaProject.bin") {
+			macros = append(macros, name)
+		}
+	}
+	extraction.Details["macros"] = len(macros) > 0
+	if len(macros) > 0 {
+		sort.Strings(macros)
+		extraction.RiskFactors = append(extraction.RiskFactors, RiskFactor{
+			PatternType: PatternTypeEmbeddedMacros,
+			Confidence:  1,
+			Details:     Metadata{"macro_parts": macros},
+		})
+	}
+	return extraction, nil
+}
+
+// randomAccess returns r as an io.ReaderAt when it is one already, and a
+// copy of it otherwise, which is closed by closing it
+func (e OfficeExtractor) randomAccess(ctx context.Context, r io.Reader) (io.ReaderAt, int64, error) {
+	if sized, ok := r.(interface {
+		io.ReaderAt
+		Size() int64
+	}); ok {
+		return sized, sized.Size(), nil
+	}
+	if e.Spooler != nil {
+		spooled, err := e.Spooler.Spool(ctx, r)
+		if err != nil {
+			return nil, 0, err
+		}
+		return spooled, spooled.Size(), nil
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(content), int64(len(content)), nil
+}
+
+type officeDocument struct {
+	ctx   context.Context
+	files map[string]*zip.File
+}
+
+func (d *officeDocument) has(name string) bool {
+	_, ok := d.files[name]
+	return ok
+}
+
+// decoder opens an archive member for streaming XML decoding
+func (d *officeDocument) decoder(name string) (*xml.Decoder, io.Closer, error) {
+	if err := d.ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	f, ok := d.files[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s is missing", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %v", name, err)
+	}
+	return xml.NewDecoder(io.LimitReader(rc, officeMaxPartSize)), rc, nil
+}
+
+// relationships maps relationship IDs to archive paths for the part whose
+// .rels file is given
+func (d *officeDocument) relationships(relsName, baseDir string) (map[string]string, error) {
+	dec, closer, err := d.decoder(relsName)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := dec.Decode(&rels); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", relsName, err)
+	}
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		if strings.HasPrefix(rel.Target, "/") {
+			targets[rel.ID] = strings.TrimPrefix(rel.Target, "/")
+		} else {
+			targets[rel.ID] = path.Join(baseDir, rel.Target)
+		}
+	}
+	return targets, nil
+}
+
+func attr(start xml.StartElement, local string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// extractWord returns the paragraphs of a Word document, with headings
+// prefixed by # per level and tables as | separated rows
+func (d *officeDocument) extractWord() (*Extraction, error) {
+	dec, closer, err := d.decoder("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var lines []string
+	var para strings.Builder
+	var row, cell []string
+	heading, tableDepth, tables, paragraphs := 0, 0, 0, 0
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse word/document.xml: %v", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				heading = 0
+			case "pStyle":
+				// Built-in heading styles are Heading1 to Heading9
+				if level, err := strconv.Atoi(strings.TrimPrefix(attr(t, "val"), "Heading")); err == nil {
+					heading = level
+				}
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse word/document.xml: %v", err)
+				}
+				para.WriteString(text)
+			case "tab":
+				para.WriteByte('\t')
+			case "br", "cr":
+				para.WriteByte('\n')
+			case "tbl":
+				if tableDepth == 0 {
+					tables++
+					lines = append(lines, "")
+				}
+				tableDepth++
+			case "tr":
+				if tableDepth == 1 {
+					row = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = nil
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if text == "" {
+					continue
+				}
+				paragraphs++
+				if tableDepth > 0 {
+					cell = append(cell, text)
+				} else if heading > 0 {
+					lines = append(lines, "", strings.Repeat("#", heading)+" "+text)
+				} else {
+					lines = append(lines, text)
+				}
+			case "tc":
+				if tableDepth == 1 {
+					row = append(row, strings.Join(cell, " "))
+				}
+			case "tr":
+				if tableDepth == 1 && len(row) > 0 {
+					lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					lines = append(lines, "")
+				}
+			}
+		}
+	}
+
+	return &Extraction{
+		Text: joinLines(lines),
+		Details: Metadata{
+			"format":     "docx",
+			"paragraphs": paragraphs,
+			"tables":     tables,
+		},
+	}, nil
+}
+
+// extractWorkbook returns every sheet's cells, one tab separated line per row
+// under a === Sheet: name === heading. Cells hold their stored values, so
+// dates appear as serial numbers and formulas as their last result.
+func (d *officeDocument) extractWorkbook() (*Extraction, error) {
+	shared, err := d.sharedStrings()
+	if err != nil {
+		return nil, err
+	}
+	rels, err := d.relationships("xl/_rels/workbook.xml.rels", "xl")
+	if err != nil {
+		return nil, err
+	}
+
+	dec, closer, err := d.decoder("xl/workbook.xml")
+	if err != nil {
+		return nil, err
+	}
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	err = dec.Decode(&workbook)
+	closer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse xl/workbook.xml: %v", err)
+	}
+
+	var lines []string
+	var sheetNames []string
+	cells := 0
+	for _, sheet := range workbook.Sheets {
+		target, ok := rels[sheet.RID]
+		if !ok || !d.has(target) {
+			continue
+		}
+		rows, n, err := d.sheetRows(target, shared)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "=== Sheet: "+sheet.Name+" ===")
+		lines = append(lines, rows...)
+		sheetNames = append(sheetNames, sheet.Name)
+		cells += n
+	}
+
+	return &Extraction{
+		Text: joinLines(lines),
+		Details: Metadata{
+			"format": "xlsx",
+			"sheets": sheetNames,
+			"cells":  cells,
+		},
+	}, nil
+}
+
+// sharedStrings reads the workbook's string table; it is optional
+func (d *officeDocument) sharedStrings() ([]string, error) {
+	if !d.has("xl/sharedStrings.xml") {
+		return nil, nil
+	}
+	dec, closer, err := d.decoder("xl/sharedStrings.xml")
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var strs []string
+	var current strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return strs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xl/sharedStrings.xml: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "si":
+				current.Reset()
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse xl/sharedStrings.xml: %v", err)
+				}
+				current.WriteString(text)
+			case "rPh":
+				// Phonetic hints repeat the text in another script
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "si" {
+				strs = append(strs, current.String())
+			}
+		}
+	}
+}
+
+type sheetCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline []struct {
+		Text string `xml:",chardata"`
+	} `xml:"is>r>t"`
+	InlineText string `xml:"is>t"`
+}
+
+// sheetRows renders a worksheet, keeping cells in their columns
+func (d *officeDocument) sheetRows(name string, shared []string) ([]string, int, error) {
+	dec, closer, err := d.decoder(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer closer.Close()
+
+	var rows []string
+	var row []string
+	count := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return rows, count, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse %s: %v", name, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				row = row[:0]
+			case "c":
+				var c sheetCell
+				if err := dec.DecodeElement(&c, &t); err != nil {
+					return nil, 0, fmt.Errorf("failed to parse %s: %v", name, err)
+				}
+				value := c.value(shared)
+				if value == "" {
+					continue
+				}
+				col := columnIndex(c.Ref)
+				if col < len(row) {
+					col = len(row)
+				}
+				for len(row) < col {
+					row = append(row, "")
+				}
+				row = append(row, value)
+				count++
+			}
+		case xml.EndElement:
+			if t.Name.Local == "row" && len(row) > 0 {
+				rows = append(rows, strings.Join(row, "\t"))
+			}
+		}
+	}
+}
+
+func (c sheetCell) value(shared []string) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(c.Value))
+		if err != nil || i < 0 || i >= len(shared) {
+			return ""
+		}
+		return strings.TrimSpace(shared[i])
+	case "inlineStr":
+		text := c.InlineText
+		for _, run := range c.Inline {
+			text += run.Text
+		}
+		return strings.TrimSpace(text)
+	case "b":
+		if c.Value == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return strings.TrimSpace(c.Value)
+	}
+}
+
+// columnIndex converts the letters of a cell reference such as "AB12" to a
+// zero based column, or -1 when there are none
+func columnIndex(ref string) int {
+	col := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A') + 1
+	}
+	return col - 1
+}
+
+// extractPresentation returns the text of each slide in order under a
+// === Slide n === heading
+func (d *officeDocument) extractPresentation() (*Extraction, error) {
+	rels, err := d.relationships("ppt/_rels/presentation.xml.rels", "ppt")
+	if err != nil {
+		return nil, err
+	}
+
+	dec, closer, err := d.decoder("ppt/presentation.xml")
+	if err != nil {
+		return nil, err
+	}
+	var presentation struct {
+		Slides []struct {
+			RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	err = dec.Decode(&presentation)
+	closer.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ppt/presentation.xml: %v", err)
+	}
+
+	var lines []string
+	slides := 0
+	for _, slide := range presentation.Slides {
+		target, ok := rels[slide.RID]
+		if !ok || !d.has(target) {
+			continue
+		}
+		paragraphs, err := d.slideParagraphs(target)
+		if err != nil {
+			return nil, err
+		}
+		slides++
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, fmt.Sprintf("=== Slide %d ===", slides))
+		lines = append(lines, paragraphs...)
+	}
+
+	return &Extraction{
+		Text: joinLines(lines),
+		Details: Metadata{
+			"format": "pptx",
+			"slides": slides,
+		},
+	}, nil
+}
+
+func (d *officeDocument) slideParagraphs(name string) ([]string, error) {
+	dec, closer, err := d.decoder(name)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+
+	var paragraphs []string
+	var para strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return paragraphs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", name, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+			case "t":
+				var text string
+				if err := dec.DecodeElement(&text, &t); err != nil {
+					return nil, fmt.Errorf("failed to parse %s: %v", name, err)
+				}
+				para.WriteString(text)
+			case "br":
+				para.WriteByte('\n')
+			}
+		case xml.EndElement:
+			if t.Name.Local == "p" {
+				if text := strings.TrimSpace(para.String()); text != "" {
+					paragraphs = append(paragraphs, text)
+				}
+			}
+		}
+	}
+}
+
+// joinLines joins lines, collapsing runs of blank lines and trimming the ends
+func joinLines(lines []string) string {
+	var out []string
+	for _, line := range lines {
+		if line == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
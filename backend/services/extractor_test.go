@@ -0,0 +1,165 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/services"
+	"frauddocai-backend/services/servicesmock"
+)
+
+// scannedText is what the AI service reads from the scanned fixtures
+const scannedText = "INVOICE #1042\nAmount due: $1,250.00"
+
+func TestDefaultExtractorRegistry(t *testing.T) {
+	tests := []struct {
+		file        string
+		contentType string
+		want        string
+		macros      bool
+		scanned     bool
+	}{
+		{
+			file:        "invoice.txt",
+			contentType: "text/plain",
+			want:        "INVOICE #1042\nBill to: Acme Corp\nAmount due: $1,250.00\n\nPay within 24 hours.",
+		},
+		{
+			file:        "invoice-latin1.txt",
+			contentType: "text/plain; charset=iso-8859-1",
+			want:        "Facture n° 1042\nMontant dû : 1 250,00 EUR",
+		},
+		{
+			file:        "invoice.html",
+			contentType: "text/html; charset=utf-8",
+			want:        "INVOICE #1042\nBill to: Acme Corp\nAmount due: $1,250.00\nPay now (https://pay.example.com/1042)",
+		},
+		{
+			file:        "invoice.xhtml",
+			contentType: "application/xhtml+xml",
+			want:        "INVOICE #1042\nAmount due: $1,250.00",
+		},
+		{
+			file:        "invoice.eml",
+			contentType: "message/rfc822",
+			want: "From: Billing <billing@example.com>\nReply-To: refunds@example.net\nTo: ap@acme.example\n" +
+				"Subject: Invoice №1042\nDate: Mon, 5 Oct 2026 09:30:00 +0000\n\n" +
+				"Amount due: $1,250.00\nPay now (https://pay.example.com/1042)",
+		},
+		{
+			file:        "invoice.docx",
+			contentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+			want:        "# INVOICE #1042\nBill to: Acme Corp\n\n| Item | Amount |\n| Consulting | $1,250.00 |\n\nPay within 24 hours",
+		},
+		{
+			file:        "invoice.docm",
+			contentType: "application/vnd.ms-word.document.macroEnabled.12",
+			want:        "# INVOICE #1042\nBill to: Acme Corp\n\n| Item | Amount |\n| Consulting | $1,250.00 |\n\nPay within 24 hours",
+			macros:      true,
+		},
+		{
+			file:        "invoice.xlsx",
+			contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+			want:        "=== Sheet: Invoice ===\nItem\tAmount\nConsulting\t1250\nPaid\t\tFALSE",
+		},
+		{
+			file:        "invoice.xlsm",
+			contentType: "application/vnd.ms-excel.sheet.macroEnabled.12",
+			want:        "=== Sheet: Invoice ===\nItem\tAmount\nConsulting\t1250\nPaid\t\tFALSE",
+			macros:      true,
+		},
+		{
+			file:        "invoice.pptx",
+			contentType: "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+			want:        "=== Slide 1 ===\nQ3 invoices\n\n=== Slide 2 ===\nINVOICE #1042\nAmount due: $1,250.00",
+		},
+		{
+			file:        "invoice.pptm",
+			contentType: "application/vnd.ms-powerpoint.presentation.macroEnabled.12",
+			want:        "=== Slide 1 ===\nQ3 invoices\n\n=== Slide 2 ===\nINVOICE #1042\nAmount due: $1,250.00",
+			macros:      true,
+		},
+		{file: "invoice.pdf", contentType: "application/pdf", want: scannedText, scanned: true},
+		{file: "invoice.jpg", contentType: "image/jpeg", want: scannedText, scanned: true},
+		{file: "invoice.png", contentType: "image/png", want: scannedText, scanned: true},
+		{file: "invoice.tiff", contentType: "image/tiff", want: scannedText, scanned: true},
+	}
+
+	// The AI service is only checked to be sent the document as it is
+	ai := servicesmock.NewAIClient()
+	var sent []byte
+	ai.ExtractTextFunc = func(ctx context.Context, req services.ExtractTextRequest) (*services.ExtractTextResponse, error) {
+		content, err := io.ReadAll(req.Content)
+		if err != nil {
+			return nil, err
+		}
+		sent = content
+		text, confidence := scannedText, 0.9
+		return &services.ExtractTextResponse{ExtractedText: &text, ConfidenceScore: &confidence, PageCount: 1}, nil
+	}
+	registry := services.DefaultExtractorRegistry(config.ExtractionConfig{}, ai, nil)
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, err := os.ReadFile(filepath.Join("testdata", "extraction", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			sent = nil
+
+			extraction, err := registry.Extract(context.Background(), tt.contentType, bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if extraction.Text != tt.want {
+				t.Errorf("text = %q, want %q", extraction.Text, tt.want)
+			}
+			if tt.scanned != (sent != nil) {
+				t.Errorf("sent to the AI service %v, want %v", sent != nil, tt.scanned)
+			} else if tt.scanned && !bytes.Equal(sent, content) {
+				t.Errorf("sent %d bytes to the AI service, want the %d of the file", len(sent), len(content))
+			}
+
+			macros := false
+			for _, factor := range extraction.RiskFactors {
+				if factor.PatternType == services.PatternTypeEmbeddedMacros {
+					macros = true
+				}
+			}
+			if macros != tt.macros {
+				t.Errorf("embedded macros flagged %v, want %v", macros, tt.macros)
+			}
+		})
+		covered[mediaType(tt.contentType)] = true
+	}
+
+	for mediaType := range registry.MediaTypes() {
+		if !covered[mediaType] {
+			t.Errorf("no fixture for %s", mediaType)
+		}
+	}
+}
+
+func TestExtractorRegistryUnsupported(t *testing.T) {
+	registry := services.DefaultExtractorRegistry(config.ExtractionConfig{}, nil, nil)
+	for _, contentType := range []string{"application/pdf", "application/zip", "not a media type"} {
+		_, err := registry.Extract(context.Background(), contentType, bytes.NewReader(nil))
+		if !errors.Is(err, services.ErrExtractionUnsupported) {
+			t.Errorf("%s: err = %v, want ErrExtractionUnsupported", contentType, err)
+		}
+	}
+}
+
+// mediaType drops the parameters of contentType, as the registry does
+func mediaType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType
+}
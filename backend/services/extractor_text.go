@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// TextExtractor returns plain text documents decoded from their charset and
+// passed through SanitizeText
+type TextExtractor struct{}
+
+func (TextExtractor) Name() string { return "text" }
+
+func (TextExtractor) Extract(ctx context.Context, contentType string, r io.Reader) (*Extraction, error) {
+	r, err := decodeCharset(contentType, r)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return &Extraction{Text: SanitizeText(string(content)), Details: Metadata{}}, nil
+}
+
+// decodeCharset converts r to UTF-8 from the charset parameter of
+// contentType, if there is one
+func decodeCharset(contentType string, r io.Reader) (io.Reader, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] == "" {
+		return r, nil
+	}
+	return charset.NewReaderLabel(params["charset"], r)
+}
+
+// invisibleRunes are format characters used to hide or reorder text, such
+// as zero-width spaces splitting a keyword past filters and bidi overrides
+// disguising file names
+var invisibleRunes = map[rune]bool{
+	'\u00ad': true, '\u180e': true, '\u200b': true, '\u200c': true, '\u200d': true,
+	'\u200e': true, '\u200f': true, '\u202a': true, '\u202b': true, '\u202c': true,
+	'\u202d': true, '\u202e': true, '\u2060': true, '\u2066': true, '\u2067': true,
+	'\u2068': true, '\u2069': true, '\ufeff': true,
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// SanitizeText prepares extracted text for analysis: invalid UTF-8 is
+// replaced, invisible format and control characters are removed, line endings
+// are normalized and trailing spaces and runs of blank lines are dropped
+func SanitizeText(text string) string {
+	text = strings.ToValidUTF8(text, "\ufffd")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return r
+		case r == '\r' || r == '\u00a0':
+			return ' '
+		case invisibleRunes[r], unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// HTMLExtractor returns the visible text of an HTML document. Scripts, styles
+// and comments are dropped, entities are decoded, each block element starts
+// a new line and link targets are kept after the link text so that URLs
+// reach analysis and entity extraction.
+type HTMLExtractor struct{}
+
+func (HTMLExtractor) Name() string { return "html" }
+
+func (HTMLExtractor) Extract(ctx context.Context, contentType string, r io.Reader) (*Extraction, error) {
+	// Honors the charset parameter, a byte order mark or a <meta charset>
+	r, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := htmlToText(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	details := Metadata{"links": doc.links}
+	if doc.title != "" {
+		details["title"] = doc.title
+	}
+	return &Extraction{Text: doc.text, Details: details}, nil
+}
+
+// htmlSkipped elements hold no visible text
+var htmlSkipped = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+}
+
+// htmlBlocks end a line of text
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "header": true, "footer": true,
+	"blockquote": true, "pre": true, "hr": true, "form": true,
+}
+
+// htmlInline elements do not separate words, as in <b>in</b>voice
+var htmlInline = map[string]bool{
+	"a": true, "abbr": true, "b": true, "em": true, "font": true, "i": true,
+	"small": true, "span": true, "strong": true, "sub": true, "sup": true, "u": true,
+}
+
+type htmlText struct {
+	text  string
+	title string
+	links []string
+}
+
+// htmlToText converts HTML read from r, already UTF-8, to sanitized text
+func htmlToText(ctx context.Context, r io.Reader) (*htmlText, error) {
+	var lines []string
+	var line strings.Builder
+	endLine := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	doc := &htmlText{}
+	links := map[string]bool{}
+	// Targets of the open <a> elements and where their text starts
+	type anchor struct {
+		href  string
+		start int
+	}
+	var anchors []anchor
+
+	tokenizer := html.NewTokenizer(r)
+	skipping := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return nil, err
+			}
+			endLine()
+			doc.text = SanitizeText(strings.Join(lines, "\n"))
+			doc.links = make([]string, 0, len(links))
+			for link := range links {
+				doc.links = append(doc.links, link)
+			}
+			sort.Strings(doc.links)
+			return doc, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			tag := token.Data
+			if skipping != "" {
+				continue
+			}
+			if htmlSkipped[tag] {
+				skipping = tag
+				continue
+			}
+			// The title is reported separately rather than as body text
+			if tag == "title" {
+				if tokenizer.Next() == html.TextToken {
+					doc.title = strings.TrimSpace(string(tokenizer.Text()))
+				}
+				continue
+			}
+			if htmlBlocks[tag] {
+				endLine()
+			} else if !htmlInline[tag] {
+				line.WriteByte(' ')
+			}
+
+			switch tag {
+			case "a":
+				href := linkTarget(htmlAttr(token, "href"))
+				if href != "" {
+					links[href] = true
+				}
+				anchors = append(anchors, anchor{href: href, start: line.Len()})
+			case "form":
+				if action := linkTarget(htmlAttr(token, "action")); action != "" {
+					links[action] = true
+					line.WriteString("[form submits to " + action + "] ")
+				}
+			case "img":
+				if alt := strings.TrimSpace(htmlAttr(token, "alt")); alt != "" {
+					line.WriteString(alt + " ")
+				}
+			}
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			tag := string(name)
+			if skipping != "" {
+				if tag == skipping {
+					skipping = ""
+				}
+				continue
+			}
+			if tag == "a" && len(anchors) > 0 {
+				a := anchors[len(anchors)-1]
+				anchors = anchors[:len(anchors)-1]
+				// Keep the target unless the link text already shows it
+				if a.href != "" && a.start <= line.Len() {
+					text := strings.TrimSpace(line.String()[a.start:])
+					if text != a.href && text != strings.TrimPrefix(a.href, "mailto:") {
+						line.WriteString(" (" + a.href + ")")
+					}
+				}
+			}
+			if htmlBlocks[tag] {
+				endLine()
+			} else if !htmlInline[tag] {
+				line.WriteByte(' ')
+			}
+
+		case html.TextToken:
+			if skipping == "" {
+				// Text tokens have their entities decoded
+				line.Write(tokenizer.Text())
+			}
+		}
+	}
+}
+
+func htmlAttr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// linkTarget returns an absolute http(s) or mailto link, or "" for relative
+// links, fragments and script URLs
+func linkTarget(href string) string {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return ""
+		}
+	case "mailto":
+	default:
+		return ""
+	}
+	return u.String()
+}
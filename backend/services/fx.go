@@ -0,0 +1,405 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// MetadataCurrency is the metadata key holding the ISO 4217 currency of a
+// document's amounts. Documents without one are taken to be in their
+// tenant's base currency.
+const MetadataCurrency = "currency"
+
+// fxErrorDetail bounds the response body kept as the error of a failed
+// request, and maxFXResponse the rates read from one
+const (
+	fxErrorDetail = 200
+	maxFXResponse = 1 << 20
+)
+
+// fxRetryAfter is how long rates the provider failed to give are not asked
+// for again, so a provider outage does not slow down every conversion
+const fxRetryAfter = time.Minute
+
+// currencyCode matches ISO 4217 currency codes
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ErrNoFXRate is returned when no exchange rate between two currencies is
+// known for a day
+var ErrNoFXRate = errors.New("no exchange rate")
+
+// NormalizeCurrency upper-cases an ISO 4217 currency code, or returns "" for
+// one that is not a code
+func NormalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyCode.MatchString(code) {
+		return ""
+	}
+	return code
+}
+
+// FXRate is one day's exchange rate: one unit of Base buys Rate units of
+// Quote. Published is the day the provider published it, before Day on
+// weekends and holidays.
+type FXRate struct {
+	Day       string    `json:"day"`
+	Base      string    `json:"base"`
+	Quote     string    `json:"quote"`
+	Rate      float64   `json:"rate"`
+	Published string    `json:"published"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// DocumentAmount is an amount of a document's metadata in the document's
+// currency and converted into its tenant's base currency, at the rate of
+// RateDay. BaseAmount, Rate and RateDay are nil when no rate was known.
+type DocumentAmount struct {
+	Field        string   `json:"field"`
+	Amount       float64  `json:"amount"`
+	Currency     string   `json:"currency"`
+	BaseAmount   *float64 `json:"base_amount"`
+	BaseCurrency string   `json:"base_currency"`
+	Rate         *float64 `json:"rate"`
+	RateDay      *string  `json:"rate_day"`
+}
+
+// DocumentAmounts are the converted amounts of a document
+type DocumentAmounts []*DocumentAmount
+
+// Base returns the amount of field in the base currency, 0 when the
+// document has none or it could not be converted
+func (amounts DocumentAmounts) Base(field string) float64 {
+	for _, amount := range amounts {
+		if amount.Field == field && amount.BaseAmount != nil {
+			return *amount.BaseAmount
+		}
+	}
+	return 0
+}
+
+// AmountFields are the metadata fields the tenant's amounts are converted
+// from: amount, and those its velocity rules sum
+func (t *Tenant) AmountFields() []string {
+	fields := []string{defaultAmountField}
+	if t == nil {
+		return fields
+	}
+	for _, rule := range t.VelocityRules {
+		field := rule.AmountField
+		if field == "" {
+			field = defaultAmountField
+		}
+		known := false
+		for _, f := range fields {
+			known = known || f == field
+		}
+		if !known {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// FXRates converts amounts at daily exchange rates. Each day's rates from a
+// currency are fetched from the provider once and cached in the database,
+// so conversions can be repeated and audited.
+type FXRates struct {
+	store        Store
+	cfg          config.FXConfig
+	baseCurrency string
+	client       *http.Client
+
+	// mu keeps concurrent conversions from fetching the same rates
+	mu       sync.Mutex
+	failures map[string]time.Time
+}
+
+// NewFXRates returns the rates of the provider of cfg, cached in store
+func NewFXRates(store Store, cfg config.FXConfig) *FXRates {
+	base := NormalizeCurrency(cfg.BaseCurrency)
+	if base == "" {
+		log.Printf("Invalid FX_BASE_CURRENCY %q, using USD", cfg.BaseCurrency)
+		base = "USD"
+	}
+	return &FXRates{store: store, cfg: cfg, baseCurrency: base, client: &http.Client{Timeout: cfg.Timeout}, failures: map[string]time.Time{}}
+}
+
+// BaseCurrency is the currency a tenant's amounts are converted into
+func (f *FXRates) BaseCurrency(tenant *Tenant) string {
+	if tenant != nil && tenant.BaseCurrency != nil {
+		return *tenant.BaseCurrency
+	}
+	return f.baseCurrency
+}
+
+// Rate returns the rate from base to quote on the UTC day of at, or of
+// today for later times. Rates cached for the day are used; otherwise the
+// day's rates are fetched, and when the provider cannot be reached or does
+// not quote the currency, the latest rate cached before the day is used.
+func (f *FXRates) Rate(ctx context.Context, at time.Time, base, quote string) (*FXRate, error) {
+	day := at.UTC().Format("2006-01-02")
+	if today := time.Now().UTC().Format("2006-01-02"); day > today {
+		day = today
+	}
+	if base == quote {
+		return &FXRate{Day: day, Base: base, Quote: quote, Rate: 1, Published: day}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cached, err := f.store.GetFXRate(day, base, quote)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if cached != nil && cached.Day == day {
+		return cached, nil
+	}
+
+	key := day + "/" + base + "/" + quote
+	if f.cfg.RatesURL != "" && time.Since(f.failures[key]) > fxRetryAfter {
+		rates, err := f.fetch(ctx, day, base)
+		if err != nil {
+			log.Printf("Failed to fetch exchange rates from %s for %s: %v", base, day, err)
+		} else {
+			if err := f.store.SaveFXRates(rates); err != nil {
+				return nil, fmt.Errorf("failed to cache exchange rates: %v", err)
+			}
+			for _, rate := range rates {
+				if rate.Quote == quote {
+					delete(f.failures, key)
+					return rate, nil
+				}
+			}
+		}
+		f.failures[key] = time.Now()
+	}
+	if cached != nil {
+		return cached, nil
+	}
+	return nil, fmt.Errorf("%w from %s to %s on %s", ErrNoFXRate, base, quote, day)
+}
+
+// fetch reads one day's rates from base. The provider answers with
+// {"base": "EUR", "date": "2026-10-16", "rates": {"USD": 1.08, ...}}, the
+// date being the day the rates were published.
+func (f *FXRates) fetch(ctx context.Context, day, base string) ([]*FXRate, error) {
+	endpoint := strings.NewReplacer("{date}", day, "{base}", base).Replace(f.cfg.RatesURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, fxErrorDetail))
+		return nil, fmt.Errorf("rates provider returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+
+	var body struct {
+		Base  string             `json:"base"`
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxFXResponse)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode rates: %v", err)
+	}
+	if body.Base != "" && NormalizeCurrency(body.Base) != base {
+		return nil, fmt.Errorf("rates provider returned rates from %s instead of %s", body.Base, base)
+	}
+	published := body.Date
+	if _, err := time.Parse("2006-01-02", published); err != nil {
+		published = day
+	}
+
+	now := time.Now().UTC()
+	var rates []*FXRate
+	for code, rate := range body.Rates {
+		quote := NormalizeCurrency(code)
+		if quote == "" || quote == base || rate <= 0 {
+			continue
+		}
+		rates = append(rates, &FXRate{Day: day, Base: base, Quote: quote, Rate: rate, Published: published, FetchedAt: now})
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Quote < rates[j].Quote })
+	return rates, nil
+}
+
+// ConvertAmounts converts the document's amounts, in the fields the tenant
+// converts, into its base currency at the rate of the document's upload
+// day. Amounts that cannot be converted are kept with no base amount.
+func (f *FXRates) ConvertAmounts(ctx context.Context, document *Document, tenant *Tenant) DocumentAmounts {
+	base := f.BaseCurrency(tenant)
+	currency := base
+	if value, ok := document.Metadata[MetadataCurrency].(string); ok && strings.TrimSpace(value) != "" {
+		currency = strings.ToUpper(strings.TrimSpace(value))
+	}
+
+	var amounts DocumentAmounts
+	var rate *FXRate
+	var rateErr error
+	for _, field := range tenant.AmountFields() {
+		value, ok := document.Metadata[field].(float64)
+		if !ok {
+			continue
+		}
+		amount := &DocumentAmount{Field: field, Amount: value, Currency: currency, BaseCurrency: base}
+		if rate == nil && rateErr == nil {
+			if NormalizeCurrency(currency) == "" {
+				rateErr = fmt.Errorf("%q is not an ISO 4217 currency code", currency)
+			} else {
+				rate, rateErr = f.Rate(ctx, document.CreatedAt, currency, base)
+			}
+			if rateErr != nil {
+				log.Printf("Amounts of document %s not converted into %s: %v", document.ID, base, rateErr)
+			}
+		}
+		if rate != nil {
+			converted := value * rate.Rate
+			amount.BaseAmount, amount.Rate, amount.RateDay = &converted, &rate.Rate, &rate.Day
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts
+}
+
+// GetFXRate returns the latest rate from base to quote cached on or before
+// day, inverting a cached rate from quote to base when that is what was
+// fetched. It returns sql.ErrNoRows when none is cached.
+func (d *DatabaseService) GetFXRate(day, base, quote string) (*FXRate, error) {
+	rate := &FXRate{}
+	err := d.db.QueryRow(`
+		SELECT CAST(day AS TEXT), base, quote, rate, CAST(published AS TEXT), fetched_at
+		FROM fx_rates
+		WHERE ((base = $1 AND quote = $2) OR (base = $2 AND quote = $1)) AND day <= $3
+		ORDER BY day DESC, base = $1 DESC
+		LIMIT 1`, base, quote, day,
+	).Scan(&rate.Day, &rate.Base, &rate.Quote, &rate.Rate, &rate.Published, &rate.FetchedAt)
+	if err != nil {
+		return nil, err
+	}
+	if rate.Base != base {
+		rate.Base, rate.Quote, rate.Rate = base, quote, 1/rate.Rate
+	}
+	return rate, nil
+}
+
+// SaveFXRates caches fetched rates, replacing those cached for the same day
+func (d *DatabaseService) SaveFXRates(rates []*FXRate) error {
+	return withRetry("save_fx_rates", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		for _, rate := range rates {
+			_, err := tx.Exec(`
+				INSERT INTO fx_rates (day, base, quote, rate, published, fetched_at)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				ON CONFLICT (day, base, quote)
+				DO UPDATE SET rate = excluded.rate, published = excluded.published, fetched_at = excluded.fetched_at`,
+				rate.Day, rate.Base, rate.Quote, rate.Rate, rate.Published, d.db.dialect.timeArg(rate.FetchedAt))
+			if err != nil {
+				return fmt.Errorf("failed to cache exchange rate: %w", err)
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// ReplaceDocumentAmounts stores the converted amounts of a document in
+// place of those recorded before
+func (d *DatabaseService) ReplaceDocumentAmounts(documentID DocumentID, amounts DocumentAmounts) error {
+	return withRetry("replace_document_amounts", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec(`DELETE FROM document_amounts WHERE document_id = $1`, documentID); err != nil {
+			return err
+		}
+		for _, amount := range amounts {
+			_, err := tx.Exec(`
+				INSERT INTO document_amounts (document_id, field, amount, currency, base_amount, base_currency, rate, rate_day)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				documentID, amount.Field, amount.Amount, amount.Currency, amount.BaseAmount, amount.BaseCurrency,
+				amount.Rate, amount.RateDay)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetDocumentAmounts returns a document's converted amounts ordered by
+// field
+func (d *DatabaseService) GetDocumentAmounts(documentID DocumentID) (DocumentAmounts, error) {
+	rows, err := d.db.Query(`
+		SELECT field, amount, currency, base_amount, base_currency, rate, CAST(rate_day AS TEXT)
+		FROM document_amounts WHERE document_id = $1 ORDER BY field`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document amounts: %v", err)
+	}
+	defer rows.Close()
+
+	amounts := DocumentAmounts{}
+	for rows.Next() {
+		amount := &DocumentAmount{}
+		if err := rows.Scan(&amount.Field, &amount.Amount, &amount.Currency, &amount.BaseAmount, &amount.BaseCurrency,
+			&amount.Rate, &amount.RateDay); err != nil {
+			return nil, err
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts, rows.Err()
+}
+
+// UpdateTenantBaseCurrency sets the currency the tenant's amounts are
+// converted into; nil uses the server's. The velocity counts of the tenant
+// summed amounts in the previous currency and are dropped, so its rules
+// count from scratch. It returns sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantBaseCurrency(id string, currency *string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE tenants SET base_currency = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, currency)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	if _, err := tx.Exec(`DELETE FROM velocity_counters WHERE tenant_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to drop velocity counters: %v", err)
+	}
+	_, err = tx.Exec(`DELETE FROM velocity_events WHERE document_id IN (SELECT id FROM documents WHERE tenant_id = $1)`, id)
+	if err != nil {
+		return fmt.Errorf("failed to drop velocity events: %v", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GeoIP maps client addresses to the country of the most specific network
+// containing them
+type GeoIP struct {
+	v4, v6 geoNetworks
+}
+
+// geoNetworks holds the countries of the networks of each prefix length,
+// and lengths those lengths, longest first
+type geoNetworks struct {
+	byLength map[int]map[netip.Prefix]string
+	lengths  []int
+}
+
+// NewGeoIP loads the networks of a CSV file of network,country lines. A
+// first line that does not parse is taken for a header, and lines starting
+// with # are comments. An empty path maps every address to no country.
+func NewGeoIP(path string) (*GeoIP, error) {
+	g := &GeoIP{}
+	if path == "" {
+		return g, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP file: %v", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GeoIP file: %v", err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("GeoIP file line %d: expected network,country", line)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(record[0]))
+		if err == nil {
+			err = g.add(prefix, record[1])
+		}
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("GeoIP file line %d: %v", line, err)
+		}
+	}
+	return g, nil
+}
+
+func (g *GeoIP) add(prefix netip.Prefix, country string) error {
+	country = NormalizeCountry(country)
+	if country == "" {
+		return errors.New("country must be a two letter code")
+	}
+	prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()).Masked()
+	if prefix.Addr().Is4() {
+		g.v4.add(prefix, country)
+	} else {
+		g.v6.add(prefix, country)
+	}
+	return nil
+}
+
+func (n *geoNetworks) add(prefix netip.Prefix, country string) {
+	if n.byLength == nil {
+		n.byLength = map[int]map[netip.Prefix]string{}
+	}
+	bits := prefix.Bits()
+	if n.byLength[bits] == nil {
+		n.byLength[bits] = map[netip.Prefix]string{}
+		n.lengths = append(n.lengths, bits)
+		sort.Sort(sort.Reverse(sort.IntSlice(n.lengths)))
+	}
+	n.byLength[bits][prefix] = country
+}
+
+// Networks returns the number of networks loaded
+func (g *GeoIP) Networks() int {
+	n := 0
+	for _, networks := range []geoNetworks{g.v4, g.v6} {
+		for _, prefixes := range networks.byLength {
+			n += len(prefixes)
+		}
+	}
+	return n
+}
+
+// Country returns the country of ip, or "" when it is not in any network
+func (g *GeoIP) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	networks := g.v6
+	if addr.Is4() {
+		networks = g.v4
+	}
+	for _, bits := range networks.lengths {
+		prefix, err := addr.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if country, ok := networks.byLength[bits][prefix]; ok {
+			return country
+		}
+	}
+	return ""
+}
+
+// NormalizeCountry upper cases a two letter country code, returning "" for
+// anything else and for XX, which geolocating proxies send for unknown
+// addresses
+func NormalizeCountry(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if len(country) != 2 || country == "XX" {
+		return ""
+	}
+	for _, r := range country {
+		if r < 'A' || r > 'Z' {
+			return ""
+		}
+	}
+	return country
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Node labels and relationship types of the document graph
+const (
+	GraphDocument = "Document"
+	GraphEntity   = "Entity"
+	GraphVendor   = "Vendor"
+
+	GraphMentions = "MENTIONS"
+	GraphIssuedBy = "ISSUED_BY"
+)
+
+// graphVendorFields are the metadata keys naming who issued a document
+var graphVendorFields = []string{"vendor", "merchant"}
+
+// GraphNode is a document, an entity found in documents or a vendor. Nodes
+// are identified by Key, which is stable across exports: the document ID,
+// kind:value for entities and the normalized name for vendors.
+type GraphNode struct {
+	Label      string
+	Key        string
+	Properties Metadata
+}
+
+// ID returns the node's ID in a graph export, unique across labels
+func (n GraphNode) ID() string {
+	return strings.ToLower(n.Label) + ":" + n.Key
+}
+
+// GraphEdge links a document to an entity it mentions or its vendor
+type GraphEdge struct {
+	Label  string
+	Source GraphNode
+	Target GraphNode
+}
+
+// DocumentGraph is the part of the graph around one document: its node and
+// the edges to the entities and vendor it shares with other documents
+type DocumentGraph struct {
+	Document GraphNode
+	Edges    []GraphEdge
+}
+
+// NewDocumentGraph builds the graph of an exported document. Detections
+// marked false positives are not counted.
+func NewDocumentGraph(export *DocumentExport) *DocumentGraph {
+	doc := export.Document
+	detections := 0
+	for _, detection := range export.Detections {
+		if !detection.IsFalsePositive {
+			detections++
+		}
+	}
+	properties := Metadata{
+		"id":               string(doc.ID),
+		"tenant_id":        doc.TenantID,
+		"filename":         doc.OriginalFilename,
+		"document_type":    doc.DocumentType,
+		"status":           doc.Status,
+		"fraud_score":      doc.FraudScore,
+		"fraud_risk_level": doc.FraudRiskLevel,
+		"detections":       detections,
+		"created_at":       doc.CreatedAt.UTC().Format(time.RFC3339),
+		"updated_at":       doc.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	graph := &DocumentGraph{Document: GraphNode{Label: GraphDocument, Key: string(doc.ID), Properties: properties}}
+
+	for _, entity := range export.Entities {
+		graph.Edges = append(graph.Edges, GraphEdge{
+			Label:  GraphMentions,
+			Source: graph.Document,
+			Target: GraphNode{
+				Label:      GraphEntity,
+				Key:        entity.Kind + ":" + entity.Value,
+				Properties: Metadata{"kind": entity.Kind, "value": entity.Value},
+			},
+		})
+	}
+	for _, field := range graphVendorFields {
+		name, _ := doc.Metadata[field].(string)
+		key := strings.ToLower(strings.Join(strings.Fields(name), " "))
+		if key == "" {
+			continue
+		}
+		graph.Edges = append(graph.Edges, GraphEdge{
+			Label:  GraphIssuedBy,
+			Source: graph.Document,
+			Target: GraphNode{Label: GraphVendor, Key: key, Properties: Metadata{"name": strings.TrimSpace(name)}},
+		})
+		break
+	}
+	return graph
+}
+
+// graphMLKey declares one attribute of GraphML nodes, edges or the graph
+type graphMLKey struct {
+	id, domain, attrType string
+}
+
+// graphMLKeys are every property of the graph's nodes, plus the label of
+// nodes and edges and the export's cursor
+var graphMLKeys = []graphMLKey{
+	{"label", "all", "string"},
+	{"tenant_id", "node", "string"},
+	{"filename", "node", "string"},
+	{"document_type", "node", "string"},
+	{"status", "node", "string"},
+	{"fraud_score", "node", "double"},
+	{"fraud_risk_level", "node", "string"},
+	{"detections", "node", "int"},
+	{"created_at", "node", "string"},
+	{"updated_at", "node", "string"},
+	{"kind", "node", "string"},
+	{"value", "node", "string"},
+	{"name", "node", "string"},
+	{"cursor", "graph", "string"},
+	{"count", "graph", "int"},
+	{"more", "graph", "boolean"},
+}
+
+// GraphMLWriter streams the graph of exported documents as GraphML, for
+// tools such as Gephi, yEd and Neo4j's apoc.import.graphml. Entity and
+// vendor nodes are written once, before the first edge to them.
+type GraphMLWriter struct {
+	w       io.Writer
+	written map[string]bool
+	err     error
+}
+
+// NewGraphMLWriter writes the GraphML header and key declarations to w
+func NewGraphMLWriter(w io.Writer) *GraphMLWriter {
+	g := &GraphMLWriter{w: w, written: map[string]bool{}}
+	g.printf("%s<graphml xmlns=\"http://graphml.graphdrawing.org/xmlns\">\n", xml.Header)
+	for _, key := range graphMLKeys {
+		g.printf("  <key id=%q for=%q attr.name=%q attr.type=%q/>\n", key.id, key.domain, key.id, key.attrType)
+	}
+	g.printf("  <graph id=\"documents\" edgedefault=\"directed\">\n")
+	return g
+}
+
+func (g *GraphMLWriter) printf(format string, args ...interface{}) {
+	if g.err == nil {
+		_, g.err = fmt.Fprintf(g.w, format, args...)
+	}
+}
+
+// WriteDocument writes a document's node, the nodes it links to that were
+// not written before and its edges
+func (g *GraphMLWriter) WriteDocument(graph *DocumentGraph) error {
+	g.writeNode(graph.Document, true)
+	for _, edge := range graph.Edges {
+		g.writeNode(edge.Target, false)
+		g.printf("    <edge source=\"%s\" target=\"%s\">\n", escapeXML(edge.Source.ID()), escapeXML(edge.Target.ID()))
+		g.printf("      <data key=\"label\">%s</data>\n", edge.Label)
+		g.printf("    </edge>\n")
+	}
+	return g.err
+}
+
+// writeNode writes a node once. Documents are written every time, as an
+// export lists each document once.
+func (g *GraphMLWriter) writeNode(node GraphNode, always bool) {
+	id := node.ID()
+	if g.written[id] && !always {
+		return
+	}
+	g.written[id] = true
+
+	g.printf("    <node id=\"%s\">\n", escapeXML(id))
+	g.printf("      <data key=\"label\">%s</data>\n", node.Label)
+	keys := make([]string, 0, len(node.Properties))
+	for key := range node.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "id" {
+			continue
+		}
+		value := graphMLValue(node.Properties[key])
+		if value == "" {
+			continue
+		}
+		g.printf("      <data key=\"%s\">%s</data>\n", key, escapeXML(value))
+	}
+	g.printf("    </node>\n")
+}
+
+// Close ends the graph with the cursor to continue the export from
+func (g *GraphMLWriter) Close(cursor string, count int, more bool) error {
+	g.printf("    <data key=\"cursor\">%s</data>\n", escapeXML(cursor))
+	g.printf("    <data key=\"count\">%d</data>\n", count)
+	g.printf("    <data key=\"more\">%t</data>\n", more)
+	g.printf("  </graph>\n</graphml>\n")
+	return g.err
+}
+
+// graphMLValue formats a property value, "" for missing ones
+func graphMLValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return *v
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// graphSyncTarget names the state row of the Neo4j sync
+const graphSyncTarget = "neo4j"
+
+// GraphSyncState is how far the graph sync got. Cursor is nil until a full
+// sync finished; the next sync then writes every document before following
+// the change feed from its start.
+type GraphSyncState struct {
+	Cursor       *ChangeCursor `json:"-"`
+	FullSyncedAt *time.Time    `json:"full_synced_at"`
+	SyncedAt     *time.Time    `json:"synced_at"`
+	Documents    int64         `json:"documents"`
+	LastError    *string       `json:"last_error"`
+}
+
+// GetGraphSyncState returns the sync's state, empty before its first sync
+func (d *DatabaseService) GetGraphSyncState() (*GraphSyncState, error) {
+	state := &GraphSyncState{}
+	var cursor *string
+	err := d.db.QueryRow(`
+		SELECT cursor, full_synced_at, synced_at, documents, last_error FROM graph_sync_state
+		WHERE target = $1`, graphSyncTarget,
+	).Scan(&cursor, &state.FullSyncedAt, &state.SyncedAt, &state.Documents, &state.LastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get graph sync state: %v", err)
+	}
+	if cursor != nil {
+		parsed, err := ParseChangeCursor(*cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid graph sync cursor %q: %v", *cursor, err)
+		}
+		state.Cursor = &parsed
+	}
+	return state, nil
+}
+
+// SaveGraphSyncState stores the sync's state
+func (d *DatabaseService) SaveGraphSyncState(state *GraphSyncState) error {
+	var cursor *string
+	if state.Cursor != nil {
+		value := state.Cursor.String()
+		cursor = &value
+	}
+	var fullSyncedAt, syncedAt interface{}
+	if state.FullSyncedAt != nil {
+		fullSyncedAt = d.db.dialect.timeArg(*state.FullSyncedAt)
+	}
+	if state.SyncedAt != nil {
+		syncedAt = d.db.dialect.timeArg(*state.SyncedAt)
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO graph_sync_state (target, cursor, full_synced_at, synced_at, documents, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (target) DO UPDATE SET cursor = excluded.cursor, full_synced_at = excluded.full_synced_at,
+			synced_at = excluded.synced_at, documents = excluded.documents, last_error = excluded.last_error`,
+		graphSyncTarget, cursor, fullSyncedAt, syncedAt, state.Documents, state.LastError)
+	if err != nil {
+		return fmt.Errorf("failed to save graph sync state: %v", err)
+	}
+	return nil
+}
+
+// ExportDocumentsByID returns the exports of the documents with the given
+// IDs that still exist and are not deleted, in no particular order
+func (d *DatabaseService) ExportDocumentsByID(ids []DocumentID) ([]*DocumentExport, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+	in := "(" + strings.Join(placeholders, ", ") + ")"
+
+	rows, err := d.db.Query(`SELECT `+documentColumns+` FROM documents WHERE id IN `+in+` AND deleted_at IS NULL`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents to export: %v", err)
+	}
+	defer rows.Close()
+
+	var exports []*DocumentExport
+	byID := make(map[DocumentID]*DocumentExport)
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exported document: %v", err)
+		}
+		export := &DocumentExport{Document: doc, Entities: []*DocumentEntity{}, Detections: []*FraudDetection{}}
+		exports = append(exports, export)
+		byID[doc.ID] = export
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(exports) == 0 {
+		return exports, nil
+	}
+
+	if err := d.exportEntities(in, args, byID); err != nil {
+		return nil, err
+	}
+	if err := d.exportDetections(in, args, byID); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
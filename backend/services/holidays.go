@@ -0,0 +1,462 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PatternTypeNonBusinessDayDate is recorded for documents dated on a weekend
+// or public holiday of their tenant's holiday calendar, when businesses
+// seldom issue invoices or sign applications
+const PatternTypeNonBusinessDayDate = "non_business_day_date"
+
+// Reasons a day is not a business day
+const (
+	NonBusinessHoliday = "holiday"
+	NonBusinessWeekend = "weekend"
+)
+
+// Confidence of non-business-day detections: weekend paperwork happens,
+// paperwork on a public holiday less so
+const (
+	nonBusinessWeekendConfidence = 0.3
+	nonBusinessHolidayConfidence = 0.45
+)
+
+// Limits of a holiday calendar
+const (
+	maxHolidays    = 1000
+	maxHolidayName = 100
+)
+
+// Business hours of calendars that do not set them
+const (
+	defaultBusinessStart = "09:00"
+	defaultBusinessEnd   = "17:00"
+)
+
+var (
+	holidayCalendarCode = regexp.MustCompile(`^[A-Z][A-Z0-9-]{1,31}$`)
+	countryCode         = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// weekdays are the names weekends are given in
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// scheduledDateFields are built-in date fields set by payment terms or
+// statement periods rather than by the day the document was made
+var scheduledDateFields = map[string]bool{"due_date": true, "period_start": true, "period_end": true}
+
+// ErrHolidayCalendarInUse is returned when deleting a calendar tenants use
+var ErrHolidayCalendarInUse = errors.New("holiday calendar is in use")
+
+// ErrUnknownHolidayCalendar is returned when a tenant is given a calendar
+// that does not exist
+var ErrUnknownHolidayCalendar = errors.New("unknown holiday calendar")
+
+// NormalizeHolidayCalendarCode returns code in the upper case calendars are
+// stored in
+func NormalizeHolidayCalendarCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Holiday is a public holiday of a calendar on Date (YYYY-MM-DD)
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// BusinessHours are the opening hours (HH:MM) of a calendar's business days,
+// in the time zone of the tenant using it
+type BusinessHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// HolidayCalendar says which days are business days in a country or region:
+// every day but its Weekend days (sat, sun, ...) and its Holidays. Codes are
+// such as US or DE-BY.
+type HolidayCalendar struct {
+	Code          string        `json:"code"`
+	Name          string        `json:"name"`
+	Country       string        `json:"country"`
+	Weekend       []string      `json:"weekend"`
+	BusinessHours BusinessHours `json:"business_hours"`
+	Holidays      []*Holiday    `json:"holidays,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// HolidayCalendarError lists the problems found in a holiday calendar
+type HolidayCalendarError struct {
+	Problems []string
+}
+
+func (e *HolidayCalendarError) Error() string {
+	return "invalid holiday calendar: " + strings.Join(e.Problems, "; ")
+}
+
+// withDefaults gives a calendar that leaves them out a Saturday and Sunday
+// weekend and 09:00 to 17:00 business hours
+func (c *HolidayCalendar) withDefaults() {
+	c.Code = NormalizeHolidayCalendarCode(c.Code)
+	c.Country = strings.ToUpper(strings.TrimSpace(c.Country))
+	if c.Weekend == nil {
+		c.Weekend = []string{"sat", "sun"}
+	}
+	for i, day := range c.Weekend {
+		c.Weekend[i] = strings.ToLower(strings.TrimSpace(day))
+	}
+	if c.BusinessHours.Start == "" && c.BusinessHours.End == "" {
+		c.BusinessHours = BusinessHours{Start: defaultBusinessStart, End: defaultBusinessEnd}
+	}
+}
+
+// Validate checks the code, name and country, that the weekend leaves a
+// business day, that business hours open before they close and that every
+// holiday has a date and a name
+func (c *HolidayCalendar) Validate() error {
+	var problems []string
+	if !holidayCalendarCode.MatchString(c.Code) {
+		problems = append(problems, "code must be 2 to 32 letters, digits or -, starting with a letter")
+	}
+	if strings.TrimSpace(c.Name) == "" || len(c.Name) > maxHolidayName {
+		problems = append(problems, fmt.Sprintf("name is required (at most %d characters)", maxHolidayName))
+	}
+	if !countryCode.MatchString(c.Country) {
+		problems = append(problems, "country must be an ISO 3166 country code such as DE")
+	}
+
+	seen := map[string]bool{}
+	for i, day := range c.Weekend {
+		if _, ok := weekdays[day]; !ok {
+			problems = append(problems, fmt.Sprintf("weekend[%d] must be one of mon, tue, wed, thu, fri, sat, sun", i))
+		} else if seen[day] {
+			problems = append(problems, fmt.Sprintf("weekend[%d] repeats %s", i, day))
+		}
+		seen[day] = true
+	}
+	if len(seen) >= len(weekdays) {
+		problems = append(problems, "weekend must leave at least one business day")
+	}
+
+	start, startErr := time.Parse("15:04", c.BusinessHours.Start)
+	end, endErr := time.Parse("15:04", c.BusinessHours.End)
+	switch {
+	case startErr != nil || endErr != nil:
+		problems = append(problems, "business_hours start and end must be times such as 09:00")
+	case !start.Before(end):
+		problems = append(problems, "business_hours must start before they end")
+	}
+
+	if len(c.Holidays) > maxHolidays {
+		problems = append(problems, fmt.Sprintf("at most %d holidays are allowed", maxHolidays))
+	}
+	dates := map[string]bool{}
+	for i, holiday := range c.Holidays {
+		if problem := holiday.validate(); problem != "" {
+			problems = append(problems, fmt.Sprintf("holidays[%d].%s", i, problem))
+		} else if dates[holiday.Date] {
+			problems = append(problems, fmt.Sprintf("holidays[%d].date repeats %s", i, holiday.Date))
+		}
+		dates[holiday.Date] = true
+	}
+
+	if len(problems) > 0 {
+		return &HolidayCalendarError{Problems: problems}
+	}
+	return nil
+}
+
+func (h *Holiday) validate() string {
+	if _, err := time.Parse("2006-01-02", h.Date); err != nil {
+		return "date must be a date (YYYY-MM-DD)"
+	}
+	if strings.TrimSpace(h.Name) == "" || len(h.Name) > maxHolidayName {
+		return fmt.Sprintf("name is required (at most %d characters)", maxHolidayName)
+	}
+	return ""
+}
+
+// NonBusinessDay reports why the calendar day of t is not a business day,
+// NonBusinessHoliday or NonBusinessWeekend, with the name of the holiday or
+// the weekday. Both are empty on business days.
+func (c *HolidayCalendar) NonBusinessDay(t time.Time) (reason, name string) {
+	day := t.Format("2006-01-02")
+	for _, holiday := range c.Holidays {
+		if holiday.Date == day {
+			return NonBusinessHoliday, holiday.Name
+		}
+	}
+	for _, weekend := range c.Weekend {
+		if weekdays[weekend] == t.Weekday() {
+			return NonBusinessWeekend, weekend
+		}
+	}
+	return "", ""
+}
+
+// businessHoursOn returns when the calendar's business hours open and close
+// on the day t falls on in loc, and false when that is not a business day
+func (c *HolidayCalendar) businessHoursOn(t time.Time, loc *time.Location) (opens, closes time.Time, ok bool) {
+	t = t.In(loc)
+	if reason, _ := c.NonBusinessDay(t); reason != "" {
+		return time.Time{}, time.Time{}, false
+	}
+	opening, _ := time.Parse("15:04", c.BusinessHours.Start)
+	closing, _ := time.Parse("15:04", c.BusinessHours.End)
+	year, month, day := t.Date()
+	opens = time.Date(year, month, day, opening.Hour(), opening.Minute(), 0, 0, loc)
+	closes = time.Date(year, month, day, closing.Hour(), closing.Minute(), 0, 0, loc)
+	return opens, closes, true
+}
+
+// NonBusinessDayDates returns a non_business_day_date risk factor listing
+// the dates of the document, as declared by the metadata schema of its type,
+// that fall on a weekend or holiday of the calendar. Due dates and statement
+// periods are not checked.
+func NonBusinessDayDates(document *Document, fields DocumentFields, calendar *HolidayCalendar) *RiskFactor {
+	schema := MetadataSchema(document.DocumentType, fields)
+	keys := make([]string, 0, len(schema))
+	for key, field := range schema {
+		if field.Type == FieldDate && !scheduledDateFields[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var dates []Metadata
+	holiday := false
+	for _, key := range keys {
+		value, _ := document.Metadata[key].(string)
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			continue
+		}
+		reason, name := calendar.NonBusinessDay(date)
+		switch reason {
+		case NonBusinessHoliday:
+			holiday = true
+			dates = append(dates, Metadata{"field": key, "date": value, "reason": reason, "holiday": name})
+		case NonBusinessWeekend:
+			dates = append(dates, Metadata{"field": key, "date": value, "reason": reason, "weekday": name})
+		}
+	}
+	if len(dates) == 0 {
+		return nil
+	}
+
+	confidence := nonBusinessWeekendConfidence
+	if holiday {
+		confidence = nonBusinessHolidayConfidence
+	}
+	return &RiskFactor{
+		PatternType: PatternTypeNonBusinessDayDate,
+		Confidence:  confidence,
+		Details: Metadata{
+			"calendar": calendar.Code,
+			"country":  calendar.Country,
+			"dates":    dates,
+		},
+	}
+}
+
+const holidayCalendarColumns = `code, name, country, weekend, business_start, business_end, created_at, updated_at`
+
+func scanHolidayCalendar(row rowScanner) (*HolidayCalendar, error) {
+	calendar := &HolidayCalendar{}
+	var weekend string
+	err := row.Scan(&calendar.Code, &calendar.Name, &calendar.Country, &weekend,
+		&calendar.BusinessHours.Start, &calendar.BusinessHours.End, &calendar.CreatedAt, &calendar.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	calendar.Weekend = []string{}
+	if weekend != "" {
+		calendar.Weekend = strings.Split(weekend, ",")
+	}
+	return calendar, nil
+}
+
+// GetHolidayCalendars returns every holiday calendar, without its holidays,
+// ordered by code
+func (d *DatabaseService) GetHolidayCalendars() ([]*HolidayCalendar, error) {
+	rows, err := d.db.Query(`SELECT ` + holidayCalendarColumns + ` FROM holiday_calendars ORDER BY code`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holiday calendars: %v", err)
+	}
+	defer rows.Close()
+
+	calendars := []*HolidayCalendar{}
+	for rows.Next() {
+		calendar, err := scanHolidayCalendar(rows)
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, calendar)
+	}
+	return calendars, rows.Err()
+}
+
+// GetHolidayCalendar returns a calendar with its holidays in order, only
+// those of year unless it is 0. It returns sql.ErrNoRows when there is no
+// such calendar.
+func (d *DatabaseService) GetHolidayCalendar(code string, year int) (*HolidayCalendar, error) {
+	calendar, err := scanHolidayCalendar(d.db.QueryRow(`SELECT `+holidayCalendarColumns+` FROM holiday_calendars WHERE code = $1`, code))
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := "0001-01-01", "9999-12-31"
+	if year != 0 {
+		from, to = fmt.Sprintf("%04d-01-01", year), fmt.Sprintf("%04d-12-31", year)
+	}
+	rows, err := d.db.Query(`
+		SELECT CAST(day AS TEXT), name FROM holidays
+		WHERE calendar_code = $1 AND day >= $2 AND day <= $3 ORDER BY day`, code, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holidays: %v", err)
+	}
+	defer rows.Close()
+
+	calendar.Holidays = []*Holiday{}
+	for rows.Next() {
+		holiday := &Holiday{}
+		if err := rows.Scan(&holiday.Date, &holiday.Name); err != nil {
+			return nil, err
+		}
+		calendar.Holidays = append(calendar.Holidays, holiday)
+	}
+	return calendar, rows.Err()
+}
+
+// SaveHolidayCalendar creates or replaces a calendar. Its holidays replace
+// the calendar's when they are given; nil Holidays keeps them.
+func (d *DatabaseService) SaveHolidayCalendar(calendar *HolidayCalendar) error {
+	calendar.withDefaults()
+	if err := calendar.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO holiday_calendars (code, name, country, weekend, business_start, business_end)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (code) DO UPDATE SET name = excluded.name, country = excluded.country, weekend = excluded.weekend,
+		       business_start = excluded.business_start, business_end = excluded.business_end, updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`,
+		calendar.Code, strings.TrimSpace(calendar.Name), calendar.Country, strings.Join(calendar.Weekend, ","),
+		calendar.BusinessHours.Start, calendar.BusinessHours.End,
+	).Scan(&calendar.CreatedAt, &calendar.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save holiday calendar: %v", err)
+	}
+
+	if calendar.Holidays != nil {
+		if _, err := tx.Exec(`DELETE FROM holidays WHERE calendar_code = $1`, calendar.Code); err != nil {
+			return err
+		}
+		for _, holiday := range calendar.Holidays {
+			_, err := tx.Exec(`INSERT INTO holidays (calendar_code, day, name) VALUES ($1, $2, $3)`,
+				calendar.Code, holiday.Date, strings.TrimSpace(holiday.Name))
+			if err != nil {
+				return fmt.Errorf("failed to save holiday: %v", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// SaveHoliday adds a holiday to a calendar, or renames the one on its date.
+// It returns sql.ErrNoRows when there is no such calendar.
+func (d *DatabaseService) SaveHoliday(code string, holiday *Holiday) error {
+	if problem := holiday.validate(); problem != "" {
+		return &HolidayCalendarError{Problems: []string{problem}}
+	}
+
+	var exists bool
+	if err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM holiday_calendars WHERE code = $1)`, code).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	_, err := d.db.Exec(`
+		INSERT INTO holidays (calendar_code, day, name) VALUES ($1, $2, $3)
+		ON CONFLICT (calendar_code, day) DO UPDATE SET name = excluded.name`,
+		code, holiday.Date, strings.TrimSpace(holiday.Name))
+	return err
+}
+
+// DeleteHoliday removes the holiday on day from a calendar. It returns
+// sql.ErrNoRows when the calendar has none that day.
+func (d *DatabaseService) DeleteHoliday(code, day string) error {
+	result, err := d.db.Exec(`DELETE FROM holidays WHERE calendar_code = $1 AND day = $2`, code, day)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteHolidayCalendar deletes a calendar and its holidays. It returns
+// ErrHolidayCalendarInUse while tenants use it and sql.ErrNoRows when there
+// is no such calendar.
+func (d *DatabaseService) DeleteHolidayCalendar(code string) error {
+	var tenants int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM tenants WHERE holiday_calendar = $1`, code).Scan(&tenants); err != nil {
+		return err
+	}
+	if tenants > 0 {
+		return ErrHolidayCalendarInUse
+	}
+
+	result, err := d.db.Exec(`DELETE FROM holiday_calendars WHERE code = $1`, code)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateTenantHolidayCalendar sets the calendar of the tenant's business
+// days; nil leaves it without one. It returns ErrUnknownHolidayCalendar for
+// a calendar that does not exist and sql.ErrNoRows when there is no such
+// tenant.
+func (d *DatabaseService) UpdateTenantHolidayCalendar(id string, code *string) error {
+	if code != nil {
+		var exists bool
+		if err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM holiday_calendars WHERE code = $1)`, *code).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ErrUnknownHolidayCalendar
+		}
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET holiday_calendar = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, code)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
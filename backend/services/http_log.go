@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"mime"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// documentTextKeys are the JSON keys holding the text of a document, or
+// text drawn from it. The HTTP log leaves their values out entirely rather
+// than trusting PII detection with them.
+var documentTextKeys = map[string]bool{
+	"extracted_text": true,
+	"document_text":  true,
+	"text":           true,
+	"texts":          true,
+	"answer":         true,
+	"context_used":   true,
+	"narrative":      true,
+}
+
+// documentTextPlaceholder stands in for document text in the HTTP log
+const documentTextPlaceholder = "[DOCUMENT TEXT]"
+
+// secretKeySuffixes end the JSON keys and query parameters holding
+// credentials, such as password, api_key, token, webhook_secret and
+// Authorization, once lower cased and stripped of "_" and "-". The HTTP log
+// leaves their values out.
+var secretKeySuffixes = []string{"password", "passwd", "secret", "token", "apikey", "authorization", "credential", "credentials"}
+
+// secretPlaceholder stands in for credentials in the HTTP log
+const secretPlaceholder = "[SECRET]"
+
+// isSecretKey reports whether key names a credential. A bare key, or one
+// ending in _key or -key, is taken to be one too.
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	if key == "key" || strings.HasSuffix(key, "_key") || strings.HasSuffix(key, "-key") {
+		return true
+	}
+	key = strings.NewReplacer("_", "", "-", "").Replace(key)
+	for _, suffix := range secretKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPLogEntry is a request and its response in the HTTP log. Route is the
+// route pattern, empty when no route matched.
+type HTTPLogEntry struct {
+	Time         time.Time   `json:"time"`
+	Method       string      `json:"method"`
+	Route        string      `json:"route"`
+	Path         string      `json:"path"`
+	Query        url.Values  `json:"query,omitempty"`
+	Tenant       string      `json:"tenant,omitempty"`
+	Status       int         `json:"status"`
+	DurationMS   float64     `json:"duration_ms"`
+	RequestBody  interface{} `json:"request_body,omitempty"`
+	ResponseBody interface{} `json:"response_body,omitempty"`
+}
+
+// HTTPLogger writes sampled requests and responses to the HTTP log, a sink
+// of JSON lines apart from the service log. A nil HTTPLogger logs nothing.
+type HTTPLogger struct {
+	mu         sync.Mutex
+	out        io.Writer
+	file       *os.File
+	sampleRate float64
+	routes     map[string]float64
+	maxBody    int
+}
+
+// NewHTTPLogger opens the log file of cfg. It returns nil when cfg has no
+// file.
+func NewHTTPLogger(cfg config.HTTPLogConfig) (*HTTPLogger, error) {
+	if cfg.File == "" {
+		return nil, nil
+	}
+	l := &HTTPLogger{sampleRate: cfg.SampleRate, routes: cfg.Routes, maxBody: cfg.MaxBodyBytes}
+	if cfg.File == "-" {
+		l.out = os.Stdout
+		return l, nil
+	}
+	f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HTTP log: %v", err)
+	}
+	l.out, l.file = f, f
+	return l, nil
+}
+
+// Sample decides whether a request to route is logged: routes left out of
+// the configured ones never are, the others at their sample rate
+func (l *HTTPLogger) Sample(route string) bool {
+	if l == nil {
+		return false
+	}
+	rate := l.sampleRate
+	if len(l.routes) > 0 {
+		var ok bool
+		if rate, ok = l.routes[route]; !ok {
+			return false
+		}
+	}
+	return rate >= 1 || rate > 0 && rand.Float64() < rate
+}
+
+// MaxBodyBytes is the largest body logged
+func (l *HTTPLogger) MaxBodyBytes() int {
+	return l.maxBody
+}
+
+// Write appends entry to the log
+func (l *HTTPLogger) Write(entry *HTTPLogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.out.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the log file
+func (l *HTTPLogger) Close() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// ScrubQuery returns the query parameters with credentials left out and
+// personal data redacted
+func ScrubQuery(query url.Values) url.Values {
+	if len(query) == 0 {
+		return nil
+	}
+	scrubbed := url.Values{}
+	for key, values := range query {
+		for _, value := range values {
+			if isSecretKey(key) {
+				scrubbed.Add(key, secretPlaceholder)
+				continue
+			}
+			scrubbed.Add(key, RedactPII(value))
+		}
+	}
+	return scrubbed
+}
+
+// ScrubBody returns a body of size bytes, of which body was captured, for
+// the HTTP log. JSON bodies are logged with document text and credentials
+// left out and personal data redacted. Other bodies, such as uploads and
+// downloads, are only noted, as are bodies captured in part.
+func ScrubBody(contentType string, body []byte, size int64) interface{} {
+	if size == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json"):
+		if mediaType == "" {
+			mediaType = "unknown type"
+		}
+		return fmt.Sprintf("[%d bytes of %s]", size, mediaType)
+	case int64(len(body)) < size:
+		return fmt.Sprintf("[%d bytes of JSON, over the logged size]", size)
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Sprintf("[%d bytes of invalid JSON]", size)
+	}
+	return scrubJSON(value)
+}
+
+func scrubJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if documentTextKeys[key] && item != nil {
+				v[key] = documentTextPlaceholder
+				continue
+			}
+			if isSecretKey(key) && item != nil {
+				v[key] = secretPlaceholder
+				continue
+			}
+			v[key] = scrubJSON(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = scrubJSON(item)
+		}
+	case string:
+		return RedactPII(v)
+	}
+	return value
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SourceLanguage is the language messages are written in, and keyed by in
+// translation bundles
+const SourceLanguage = "en"
+
+// languageTag matches the BCP 47 tags bundles are named after, such as es
+// or pt-BR
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// Translations holds the translation bundles of user-facing messages: API
+// errors and generated reports. Bundles are the <language>.json files of a
+// directory, each an object mapping a message in English to its
+// translation, read at startup and on Reload so translations are added and
+// corrected without rebuilding. Messages with formatting verbs are
+// translated as a whole, and translations may reorder the arguments with
+// explicit indexes such as %[2]s. Messages a bundle lacks stay in English.
+type Translations struct {
+	dir             string
+	defaultLanguage string
+
+	mu      sync.RWMutex
+	bundles map[string]map[string]string
+}
+
+// NewTranslations loads the bundles of dir. Without a dir every message
+// stays in English. defaultLanguage is used for requests with no language
+// chosen; it must be English or have a bundle.
+func NewTranslations(dir, defaultLanguage string) (*Translations, error) {
+	t := &Translations{dir: dir, defaultLanguage: NormalizeLanguage(defaultLanguage), bundles: map[string]map[string]string{}}
+	if t.defaultLanguage == "" {
+		t.defaultLanguage = SourceLanguage
+	}
+	if _, err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NormalizeLanguage lower-cases a language tag, or returns "" for one that
+// is not a tag
+func NormalizeLanguage(language string) string {
+	language = strings.TrimSpace(language)
+	if !languageTag.MatchString(language) {
+		return ""
+	}
+	return strings.ToLower(language)
+}
+
+// Reload reads the bundles again and returns the languages they hold. A
+// directory with a bundle that does not parse keeps the bundles it had.
+func (t *Translations) Reload() ([]string, error) {
+	bundles := map[string]map[string]string{}
+	if t.dir != "" {
+		paths, err := filepath.Glob(filepath.Join(t.dir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list translation bundles: %v", err)
+		}
+		for _, path := range paths {
+			name := strings.TrimSuffix(filepath.Base(path), ".json")
+			language := NormalizeLanguage(name)
+			if language == "" {
+				return nil, fmt.Errorf("translation bundle %s is not named after a language tag", filepath.Base(path))
+			}
+			bundle, err := readBundle(path)
+			if err != nil {
+				return nil, err
+			}
+			bundles[language] = bundle
+		}
+	}
+	if t.defaultLanguage != SourceLanguage && bundles[t.defaultLanguage] == nil {
+		return nil, fmt.Errorf("default language %s has no translation bundle", t.defaultLanguage)
+	}
+
+	t.mu.Lock()
+	t.bundles = bundles
+	t.mu.Unlock()
+	return t.Languages(), nil
+}
+
+// readBundle reads a bundle, refusing translations whose formatting verbs
+// do not take the arguments of the message they translate
+func readBundle(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translation bundle: %v", err)
+	}
+	var bundle map[string]string
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("translation bundle %s: %v", filepath.Base(path), err)
+	}
+	for message, translation := range bundle {
+		if formatArguments(message) != formatArguments(translation) {
+			return nil, fmt.Errorf("translation bundle %s: %q does not take the arguments of %q", filepath.Base(path), translation, message)
+		}
+	}
+	return bundle, nil
+}
+
+// formatArguments counts the arguments a format takes, following explicit
+// argument indexes
+func formatArguments(format string) int {
+	count, next := 0, 1
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		// Flags, width and precision come before the verb
+		for i < len(format) && strings.IndexByte("+-# 0123456789.", format[i]) >= 0 {
+			i++
+		}
+		if i < len(format) && format[i] == '[' {
+			end := strings.IndexByte(format[i:], ']')
+			if end < 0 {
+				return -1
+			}
+			if _, err := fmt.Sscanf(format[i+1:i+end], "%d", &next); err != nil {
+				return -1
+			}
+			i += end + 1
+		}
+		count = max(count, next)
+		next++
+	}
+	return count
+}
+
+// Languages are the languages messages can be shown in, sorted
+func (t *Translations) Languages() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	languages := []string{SourceLanguage}
+	for language := range t.bundles {
+		if language != SourceLanguage {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Translating reports whether any bundle is loaded
+func (t *Translations) Translating() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.bundles) > 0
+}
+
+// DefaultLanguage is the language of requests with no language chosen
+func (t *Translations) DefaultLanguage() string {
+	return t.defaultLanguage
+}
+
+// Supported returns the language messages are shown in for a chosen
+// language: itself when it has a bundle, or else its base language, such as
+// pt for pt-BR. It returns "" when neither can be shown.
+func (t *Translations) Supported(language string) string {
+	language = NormalizeLanguage(language)
+	if language == "" {
+		return ""
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for candidate := language; ; {
+		if candidate == SourceLanguage || t.bundles[candidate] != nil {
+			return candidate
+		}
+		i := strings.LastIndexByte(candidate, '-')
+		if i < 0 {
+			return ""
+		}
+		candidate = candidate[:i]
+	}
+}
+
+// Localizer returns the localizer of a language, which should be one
+// Supported returned
+func (t *Translations) Localizer(language string) Localizer {
+	return Localizer{translations: t, Language: language}
+}
+
+// translate returns the translation of a message, or the message itself
+func (t *Translations) translate(language, message string) string {
+	if t == nil {
+		return message
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if translation, ok := t.bundles[language][message]; ok && translation != "" {
+		return translation
+	}
+	return message
+}
+
+// Localizer translates messages into one language. The zero Localizer
+// leaves them in English.
+type Localizer struct {
+	translations *Translations
+	Language     string
+}
+
+// T translates a message
+func (l Localizer) T(message string) string {
+	return l.translations.translate(l.Language, message)
+}
+
+// Sprintf translates a format and formats it
+func (l Localizer) Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(l.T(format), args...)
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+)
+
+// ErrInvalidID is returned for an ID that is not a UUID
+var ErrInvalidID = errors.New("invalid ID: must be a UUID")
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsUUID reports whether s is a UUID in its usual hyphenated form
+func IsUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// DocumentID identifies a document. Document IDs are UUIDs generated by the
+// database; IDs taken from requests are checked with ParseDocumentID before
+// they reach a query, where Postgres would reject a malformed one only when
+// casting it.
+type DocumentID string
+
+// ParseDocumentID checks that s is a UUID
+func ParseDocumentID(s string) (DocumentID, error) {
+	if !IsUUID(s) {
+		return "", ErrInvalidID
+	}
+	return DocumentID(s), nil
+}
+
+func (id DocumentID) String() string {
+	return string(id)
+}
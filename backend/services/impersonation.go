@@ -0,0 +1,248 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ImpersonationTokenPrefix starts every impersonation token, so a leaked one
+// is easy to recognize
+const ImpersonationTokenPrefix = "fda_imp_"
+
+// Audit log actions of impersonation: a session started and ended, and each
+// request made in one
+const (
+	AuditActionImpersonationStarted = "impersonation.started"
+	AuditActionImpersonationEnded   = "impersonation.ended"
+	AuditActionImpersonationRequest = "impersonation.request"
+)
+
+// ErrImpersonationNotAllowed is returned when a session is started at a
+// tenant that has not consented to impersonation
+var ErrImpersonationNotAllowed = errors.New("tenant does not allow impersonation")
+
+// Impersonation is a session in which an admin acts as a tenant's user, to
+// see what the user sees. It lasts until it expires or is ended, and ends
+// when the tenant withdraws its consent. Only the SHA-256 of its token is
+// kept.
+type Impersonation struct {
+	ID         string     `json:"id"`
+	TenantID   string     `json:"tenant_id"`
+	AdminID    string     `json:"admin_id"`
+	AdminEmail string     `json:"admin_email"`
+	UserID     string     `json:"user_id"`
+	UserEmail  string     `json:"user_email"`
+	Reason     string     `json:"reason"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	EndedAt    *time.Time `json:"ended_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active reports whether the session may be used at now
+func (i *Impersonation) Active(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// Banner is the notice a client shows for as long as the session lasts, so
+// nobody mistakes the admin for the user
+func (i *Impersonation) Banner() string {
+	return fmt.Sprintf("%s is signed in as %s", i.AdminEmail, i.UserEmail)
+}
+
+// AuditDetails identify both the admin and the user in the audit log
+func (i *Impersonation) AuditDetails() Metadata {
+	return Metadata{
+		"impersonation_id": i.ID,
+		"tenant_id":        i.TenantID,
+		"admin_id":         i.AdminID,
+		"admin_email":      i.AdminEmail,
+		"user_id":          i.UserID,
+		"user_email":       i.UserEmail,
+	}
+}
+
+// NewImpersonationToken returns a random impersonation token and the
+// digest it is stored as
+func NewImpersonationToken() (token, digest string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate impersonation token: %v", err)
+	}
+	token = ImpersonationTokenPrefix + hex.EncodeToString(b)
+	return token, TokenDigest(token), nil
+}
+
+const impersonationColumns = `i.id, i.tenant_id, i.admin_id, a.email, i.user_id, u.email, i.reason, i.expires_at, i.ended_at, i.created_at`
+
+const impersonationFrom = ` FROM impersonation_sessions i
+	JOIN users a ON a.id = i.admin_id
+	JOIN users u ON u.id = i.user_id`
+
+func scanImpersonation(row rowScanner) (*Impersonation, error) {
+	session := &Impersonation{}
+	err := row.Scan(&session.ID, &session.TenantID, &session.AdminID, &session.AdminEmail, &session.UserID,
+		&session.UserEmail, &session.Reason, &session.ExpiresAt, &session.EndedAt, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// StartImpersonation stores a session under the digest of its token and
+// records its start in the audit log. It returns ErrImpersonationNotAllowed
+// unless the tenant consents to impersonation.
+func (d *DatabaseService) StartImpersonation(session *Impersonation, tokenDigest string, ipAddress *string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var allowed bool
+	if err := tx.QueryRow(`SELECT allow_impersonation FROM tenants WHERE id = $1`, session.TenantID).Scan(&allowed); err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrImpersonationNotAllowed
+	}
+	err = tx.QueryRow(`
+		INSERT INTO impersonation_sessions (tenant_id, admin_id, user_id, reason, token_sha256, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		session.TenantID, session.AdminID, session.UserID, session.Reason, tokenDigest, d.db.dialect.timeArg(session.ExpiresAt),
+	).Scan(&session.ID, &session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to start impersonation: %v", err)
+	}
+
+	details := session.AuditDetails()
+	details["reason"] = session.Reason
+	details["expires_at"] = session.ExpiresAt
+	if err := auditImpersonation(tx, session, AuditActionImpersonationStarted, details, ipAddress); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetImpersonations returns a tenant's impersonation sessions, newest first
+func (d *DatabaseService) GetImpersonations(tenantID string) ([]*Impersonation, error) {
+	rows, err := d.db.Query(`
+		SELECT `+impersonationColumns+impersonationFrom+`
+		WHERE i.tenant_id = $1 ORDER BY i.created_at DESC, i.id`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query impersonation sessions: %v", err)
+	}
+	defer rows.Close()
+
+	sessions := []*Impersonation{}
+	for rows.Next() {
+		session, err := scanImpersonation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan impersonation session: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// GetImpersonationByToken returns the session of a token digest, expired
+// and ended ones included, or sql.ErrNoRows
+func (d *DatabaseService) GetImpersonationByToken(tokenDigest string) (*Impersonation, error) {
+	return scanImpersonation(d.db.QueryRow(`
+		SELECT `+impersonationColumns+impersonationFrom+` WHERE i.token_sha256 = $1`, tokenDigest))
+}
+
+// EndImpersonation ends a session at a time and records its end in the
+// audit log. A session that already ended keeps its time and is not
+// recorded again. It returns sql.ErrNoRows for an unknown session.
+func (d *DatabaseService) EndImpersonation(id string, at time.Time, ipAddress *string) (*Impersonation, error) {
+	var session *Impersonation
+	err := withRetry("end_impersonation", func() error {
+		var err error
+		session, err = d.endImpersonation(id, at, ipAddress)
+		return err
+	})
+	return session, err
+}
+
+func (d *DatabaseService) endImpersonation(id string, at time.Time, ipAddress *string) (*Impersonation, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE impersonation_sessions SET ended_at = $2 WHERE id = $1 AND ended_at IS NULL`,
+		id, d.db.dialect.timeArg(at))
+	if err != nil {
+		return nil, fmt.Errorf("failed to end impersonation %s: %w", id, err)
+	}
+	ended, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	session, err := scanImpersonation(tx.QueryRow(`SELECT `+impersonationColumns+impersonationFrom+` WHERE i.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	if ended > 0 {
+		if err := auditImpersonation(tx, session, AuditActionImpersonationEnded, session.AuditDetails(), ipAddress); err != nil {
+			return nil, err
+		}
+	}
+	return session, tx.Commit()
+}
+
+// RecordImpersonatedRequest adds a request made in an impersonation session
+// to the audit log, under the admin, with details naming both the admin
+// and the user
+func (d *DatabaseService) RecordImpersonatedRequest(session *Impersonation, details Metadata, ipAddress *string) error {
+	return auditImpersonation(d.db, session, AuditActionImpersonationRequest, details, ipAddress)
+}
+
+func auditImpersonation(q execer, session *Impersonation, action string, details Metadata, ipAddress *string) error {
+	_, err := q.Exec(`
+		INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address)
+		VALUES ($1, $2, 'impersonation', $3, $4, $5)`,
+		session.AdminID, action, session.ID, details, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit impersonation %s: %w", session.ID, err)
+	}
+	return nil
+}
+
+// UpdateTenantImpersonationConsent records whether the tenant allows support
+// staff to impersonate its users. Withdrawing consent ends the sessions
+// still open. It returns the number of sessions ended, and sql.ErrNoRows
+// when there is no such tenant.
+func (d *DatabaseService) UpdateTenantImpersonationConsent(id string, allowed bool, at time.Time) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE tenants SET allow_impersonation = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, allowed)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, sql.ErrNoRows
+	}
+	var ended int64
+	if !allowed {
+		result, err := tx.Exec(`UPDATE impersonation_sessions SET ended_at = $2 WHERE tenant_id = $1 AND ended_at IS NULL`,
+			id, d.db.dialect.timeArg(at))
+		if err != nil {
+			return 0, fmt.Errorf("failed to end impersonation sessions: %v", err)
+		}
+		if ended, err = result.RowsAffected(); err != nil {
+			return 0, err
+		}
+	}
+	return ended, tx.Commit()
+}
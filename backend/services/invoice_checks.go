@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pattern types recorded for invoices and receipts that do not add up or
+// repeat or change details seen on the vendor's earlier documents
+const (
+	PatternTypeTotalMismatch          = "total_mismatch"
+	PatternTypeDuplicateInvoiceNumber = "duplicate_invoice_number"
+	PatternTypeBankDetailsChange      = "bank_details_change"
+)
+
+// Confidence of invoice check detections. Arithmetic that does not add up
+// is rarely a typo on generated documents; a resubmitted invoice number may
+// be an honest correction, and vendors do change banks.
+const (
+	totalMismatchConfidence     = 0.85
+	duplicateInvoiceConfidence  = 0.7
+	bankDetailsChangeConfidence = 0.75
+)
+
+// amountTolerance absorbs rounding in stated amounts
+const amountTolerance = 0.01
+
+// Lines of an invoice or receipt that carry amounts. A line item reads
+// "<description> <quantity> x <unit price> <amount>"; labelled lines end with
+// their amount, after an optional rate such as "VAT (20%):".
+var (
+	lineItemPattern = regexp.MustCompile(`(?im)^[ \t]*(\S.*?)[ \t]+(\d+(?:\.\d+)?)[ \t]*[x×][ \t]*[$€£]?[ \t]*([\d,]+\.\d{2})[ \t]+[$€£]?[ \t]*([\d,]+\.\d{2})[ \t]*$`)
+	subtotalPattern = regexp.MustCompile(`(?im)^[ \t]*sub[ \-]?total\b[^\n]*?[$€£]?[ \t]*([\d,]+\.\d{2})[ \t]*$`)
+	chargePattern   = regexp.MustCompile(`(?im)^[ \t]*(?:sales tax|tax|vat|gst|shipping|delivery|freight|tip|service charge)\b[^\n]*?[$€£]?[ \t]*([\d,]+\.\d{2})[ \t]*$`)
+	discountPattern = regexp.MustCompile(`(?im)^[ \t]*discount\b[^\n]*?-?[ \t]*[$€£]?[ \t]*([\d,]+\.\d{2})[ \t]*$`)
+	totalPattern    = regexp.MustCompile(`(?im)^[ \t]*(?:grand total|total due|total|amount due|balance due)\b[^\n]*?[$€£]?[ \t]*([\d,]+\.\d{2})[ \t]*$`)
+)
+
+func parseAmount(s string) float64 {
+	amount, _ := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	return amount
+}
+
+func sumAmounts(re *regexp.Regexp, text string) float64 {
+	sum := 0.0
+	for _, match := range re.FindAllStringSubmatch(text, -1) {
+		sum += parseAmount(match[len(match)-1])
+	}
+	return sum
+}
+
+func round2(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// TotalMismatch returns a total_mismatch risk factor when the arithmetic of
+// an invoice or receipt's text does not add up: a line item whose quantity
+// times unit price is not its amount, line items not summing to the
+// subtotal, or the subtotal plus taxes and charges less discounts not
+// making the total. Text without a total or anything to check it against
+// is not checked.
+func TotalMismatch(text string) *RiskFactor {
+	var problems []string
+	lines := 0.0
+	items := lineItemPattern.FindAllStringSubmatch(text, -1)
+	for _, item := range items {
+		quantity, _ := strconv.ParseFloat(item[2], 64)
+		unit, amount := parseAmount(item[3]), parseAmount(item[4])
+		if math.Abs(quantity*unit-amount) > amountTolerance {
+			problems = append(problems, fmt.Sprintf("%s: %s x %.2f is %.2f, not %.2f",
+				strings.TrimSpace(item[1]), item[2], unit, round2(quantity*unit), amount))
+		}
+		lines += amount
+	}
+
+	base, hasBase := lines, len(items) > 0
+	if match := subtotalPattern.FindStringSubmatch(text); match != nil {
+		subtotal := parseAmount(match[1])
+		if hasBase && math.Abs(lines-subtotal) > amountTolerance {
+			problems = append(problems, fmt.Sprintf("line items sum to %.2f, not the subtotal of %.2f", round2(lines), subtotal))
+		}
+		base, hasBase = subtotal, true
+	}
+
+	details := Metadata{}
+	if match := totalPattern.FindStringSubmatch(text); match != nil && hasBase {
+		charges := sumAmounts(chargePattern, text)
+		discounts := sumAmounts(discountPattern, text)
+		stated := parseAmount(match[1])
+		expected := round2(base + charges - discounts)
+		if math.Abs(expected-stated) > amountTolerance {
+			problems = append(problems, fmt.Sprintf("the total of %.2f should be %.2f", stated, expected))
+			details["stated_total"] = stated
+			details["expected_total"] = expected
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	details["problems"] = problems
+	return &RiskFactor{PatternType: PatternTypeTotalMismatch, Confidence: totalMismatchConfidence, Details: details}
+}
+
+// InvoiceNumberFilters are the metadata filters finding the other invoices
+// of a document's vendor with its invoice number, or nil when the document
+// has no invoice number
+func InvoiceNumberFilters(document *Document) []MetadataFilter {
+	number, _ := document.Metadata["invoice_number"].(string)
+	if number == "" {
+		return nil
+	}
+	filters := []MetadataFilter{{Key: "invoice_number", Value: number}}
+	if vendor, _ := document.Metadata["vendor"].(string); vendor != "" {
+		filters = append(filters, MetadataFilter{Key: "vendor", Value: vendor})
+	}
+	return filters
+}
+
+// DuplicateInvoiceNumber returns a duplicate_invoice_number risk factor
+// when others, found with InvoiceNumberFilters, holds documents received
+// before document
+func DuplicateInvoiceNumber(document *Document, others []*Document) *RiskFactor {
+	var ids []string
+	for _, other := range others {
+		if other.ID != document.ID && !other.CreatedAt.After(document.CreatedAt) {
+			ids = append(ids, string(other.ID))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Strings(ids)
+	details := Metadata{"invoice_number": document.Metadata["invoice_number"], "documents": ids}
+	if vendor, ok := document.Metadata["vendor"]; ok {
+		details["vendor"] = vendor
+	}
+	return &RiskFactor{PatternType: PatternTypeDuplicateInvoiceNumber, Confidence: duplicateInvoiceConfidence, Details: details}
+}
+
+// BankDetailsChange returns a bank_details_change risk factor when a
+// document pays into IBANs none of which the vendor's earlier documents
+// used. Vendors without earlier IBANs are not checked.
+func BankDetailsChange(vendor string, ibans, known []string) *RiskFactor {
+	if len(ibans) == 0 || len(known) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, iban := range known {
+		seen[iban] = true
+	}
+	for _, iban := range ibans {
+		if seen[iban] {
+			return nil
+		}
+	}
+	return &RiskFactor{
+		PatternType: PatternTypeBankDetailsChange,
+		Confidence:  bankDetailsChangeConfidence,
+		Details:     Metadata{"vendor": vendor, "ibans": ibans, "known_ibans": known},
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Pipeline job states. Finished jobs are deleted rather than kept.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobFailed  = "failed"
+)
+
+// PipelineJob is a document's claim on a pipeline run. ReuseText runs it on
+// the document's stored text instead of extracting it again.
+type PipelineJob struct {
+	ID         int64      `json:"id"`
+	DocumentID DocumentID `json:"document_id"`
+	ReuseText  bool       `json:"reuse_text"`
+	State      string     `json:"state"`
+	Attempts   int        `json:"attempts"`
+}
+
+// PipelineBacklog is the pipeline work waiting across all replicas, and the
+// pipelines that finished analysis within the recent window
+type PipelineBacklog struct {
+	Queued   int
+	Running  int
+	Finished int
+	Window   time.Duration
+}
+
+// GetPipelineBacklog counts the queued and running jobs, and the pipelines
+// whose analysis ran within window
+func (d *DatabaseService) GetPipelineBacklog(window time.Duration) (*PipelineBacklog, error) {
+	backlog := &PipelineBacklog{Window: window}
+	err := d.db.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE state = $1), COUNT(*) FILTER (WHERE state = $2)
+		FROM pipeline_jobs`, JobQueued, JobRunning).Scan(&backlog.Queued, &backlog.Running)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pipeline jobs: %v", err)
+	}
+	err = d.db.QueryRow(`
+		SELECT COUNT(*) FROM pipeline_stage_runs
+		WHERE stage = $1 AND outcome <> $2 AND run_started_at >= $3`,
+		StageAIAnalysis, StageSkipped, d.db.dialect.timeArg(time.Now().Add(-window))).Scan(&backlog.Finished)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recent pipelines: %v", err)
+	}
+	return backlog, nil
+}
+
+// GetPipelineQueuePosition returns how many queued jobs are ahead of the
+// document's. queued is false when the document has no queued job, because
+// its pipeline is running, finished or failed.
+func (d *DatabaseService) GetPipelineQueuePosition(documentID DocumentID) (ahead int, queued bool, err error) {
+	var jobID sql.NullInt64
+	err = d.db.QueryRow(`SELECT MIN(id) FROM pipeline_jobs WHERE document_id = $1 AND state = $2`,
+		documentID, JobQueued).Scan(&jobID)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to find pipeline job: %v", err)
+	}
+	if !jobID.Valid {
+		return 0, false, nil
+	}
+	err = d.db.QueryRow(`SELECT COUNT(*) FROM pipeline_jobs WHERE state = $1 AND id < $2`,
+		JobQueued, jobID.Int64).Scan(&ahead)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to count pipeline jobs: %v", err)
+	}
+	return ahead, true, nil
+}
+
+// EnqueuePipelineJob queues a pipeline run of the document
+func (d *DatabaseService) EnqueuePipelineJob(documentID DocumentID, reuseText bool) error {
+	_, err := d.db.Exec(`INSERT INTO pipeline_jobs (document_id, reuse_text) VALUES ($1, $2)`, documentID, reuseText)
+	if err != nil {
+		return fmt.Errorf("failed to queue pipeline job: %v", err)
+	}
+	return nil
+}
+
+// ClaimPipelineJobs leases up to limit jobs to owner until now plus lease,
+// oldest first. Jobs still leased to another worker are skipped; so are
+// jobs locked by a concurrent claim, so replicas claiming at the same time
+// get different jobs instead of waiting for each other. A running job whose
+// lease has expired is claimed again, with its attempts counting the runs
+// that did not finish.
+func (d *DatabaseService) ClaimPipelineJobs(owner string, lease time.Duration, limit int) ([]*PipelineJob, error) {
+	now := time.Now()
+	lock := ` FOR UPDATE SKIP LOCKED`
+	if d.db.dialect == dialectSQLite {
+		// SQLite runs one writer at a time, so claims cannot overlap
+		lock = ``
+	}
+	rows, err := d.db.Query(`
+		UPDATE pipeline_jobs
+		SET state = $1, lease_owner = $2, lease_expires_at = $3, attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM pipeline_jobs
+			WHERE state = $4 OR (state = $1 AND lease_expires_at < $5)
+			ORDER BY id
+			LIMIT $6`+lock+`
+		)
+		RETURNING id, document_id, reuse_text, state, attempts`,
+		JobRunning, owner, d.db.dialect.timeArg(now.Add(lease)), JobQueued, d.db.dialect.timeArg(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pipeline jobs: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []*PipelineJob
+	for rows.Next() {
+		job := &PipelineJob{}
+		if err := rows.Scan(&job.ID, &job.DocumentID, &job.ReuseText, &job.State, &job.Attempts); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// RenewPipelineJobLease extends owner's lease on a running job. It returns
+// false when the lease was lost, because it expired and another worker
+// claimed the job.
+func (d *DatabaseService) RenewPipelineJobLease(id int64, owner string, lease time.Duration) (bool, error) {
+	result, err := d.db.Exec(`
+		UPDATE pipeline_jobs SET lease_expires_at = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND state = $3 AND lease_owner = $4`,
+		d.db.dialect.timeArg(time.Now().Add(lease)), id, JobRunning, owner)
+	if err != nil {
+		return false, fmt.Errorf("failed to renew pipeline job lease: %v", err)
+	}
+	renewed, err := result.RowsAffected()
+	return renewed > 0, err
+}
+
+// CompletePipelineJob deletes a job owner has finished. A job whose lease
+// owner lost is left to its new owner.
+func (d *DatabaseService) CompletePipelineJob(id int64, owner string) error {
+	_, err := d.db.Exec(`DELETE FROM pipeline_jobs WHERE id = $1 AND lease_owner = $2`, id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to complete pipeline job: %v", err)
+	}
+	return nil
+}
+
+// CheckpointPipelineJob records that the job's document text is stored, so
+// a worker claiming the job again resumes from the text instead of
+// extracting it again
+func (d *DatabaseService) CheckpointPipelineJob(id int64, owner string) error {
+	_, err := d.db.Exec(`
+		UPDATE pipeline_jobs SET reuse_text = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND lease_owner = $3`, true, id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint pipeline job: %v", err)
+	}
+	return nil
+}
+
+// ReleasePipelineJob queues a job owner stopped running before it finished,
+// for any worker to claim at once. The interrupted run does not count as an
+// attempt.
+func (d *DatabaseService) ReleasePipelineJob(id int64, owner string) error {
+	_, err := d.db.Exec(`
+		UPDATE pipeline_jobs
+		SET state = $1, lease_owner = NULL, lease_expires_at = NULL, attempts = attempts - 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND state = $3 AND lease_owner = $4`, JobQueued, id, JobRunning, owner)
+	if err != nil {
+		return fmt.Errorf("failed to release pipeline job: %v", err)
+	}
+	return nil
+}
+
+// QueueStalledDocuments queues a pipeline job for each document last
+// changed before staleBefore that is still uploaded but has no job, such as
+// documents whose pipeline ran in a backend that stopped before the job
+// queue existed or that ran outside it. Documents with stored text resume
+// from it. Documents whose job failed are left alone.
+func (d *DatabaseService) QueueStalledDocuments(staleBefore time.Time) ([]*PipelineJob, error) {
+	rows, err := d.db.Query(`
+		INSERT INTO pipeline_jobs (document_id, reuse_text)
+		SELECT id, extracted_text IS NOT NULL FROM documents
+		WHERE status = $1 AND updated_at < $2 AND deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM pipeline_jobs WHERE pipeline_jobs.document_id = documents.id)
+		RETURNING id, document_id, reuse_text, state, attempts`,
+		DocumentUploaded, d.db.dialect.timeArg(staleBefore))
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue stalled documents: %v", err)
+	}
+	defer rows.Close()
+
+	var jobs []*PipelineJob
+	for rows.Next() {
+		job := &PipelineJob{}
+		if err := rows.Scan(&job.ID, &job.DocumentID, &job.ReuseText, &job.State, &job.Attempts); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// FailPipelineJob gives up on a job, keeping it with the reason
+func (d *DatabaseService) FailPipelineJob(id int64, owner, reason string) error {
+	_, err := d.db.Exec(`
+		UPDATE pipeline_jobs SET state = $1, last_error = $2, lease_expires_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND lease_owner = $4`, JobFailed, reason, id, owner)
+	if err != nil {
+		return fmt.Errorf("failed to mark pipeline job failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"frauddocai-backend/metrics"
+)
+
+// AdvisoryLock is a Postgres session-level advisory lock, held for as long
+// as the connection that took it stays open. On SQLite it is only a marker:
+// a SQLite database is not shared between replicas.
+type AdvisoryLock struct {
+	conn *sql.Conn
+}
+
+// TryAdvisoryLock takes the advisory lock named name without waiting. It
+// returns nil when another session holds the lock.
+func (d *DatabaseService) TryAdvisoryLock(ctx context.Context, name string) (*AdvisoryLock, error) {
+	if d.db.dialect == dialectSQLite {
+		return &AdvisoryLock{}, nil
+	}
+
+	conn, err := d.db.pool.Load().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection for advisory lock: %v", err)
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, advisoryLockKey(name)).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to take advisory lock %s: %v", name, err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, nil
+	}
+	return &AdvisoryLock{conn: conn}, nil
+}
+
+// Check returns an error when the lock's connection was lost, and with it
+// the lock
+func (l *AdvisoryLock) Check(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.PingContext(ctx)
+}
+
+// Release unlocks the lock and returns its connection to the pool
+func (l *AdvisoryLock) Release() {
+	if l.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Closing a broken connection ends the session, which releases the lock
+	// too, so the error needs no handling
+	l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock_all()`)
+	l.conn.Close()
+}
+
+// advisoryLockKey maps a lock name to the bigint key Postgres locks on
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("frauddocai/" + name))
+	return int64(h.Sum64())
+}
+
+// Leadership is whether this replica leads a singleton task, and since when
+type Leadership struct {
+	Task   string     `json:"task"`
+	Leader bool       `json:"leader"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// LeaderElector runs each registered singleton task on only one replica at a
+// time. Every replica tries to take a task's advisory lock; the one that
+// holds it is the task's leader and runs the task until it loses the lock,
+// when another replica takes over at its next attempt.
+type LeaderElector struct {
+	db       *DatabaseService
+	interval time.Duration
+	paused   func() bool
+
+	mu    sync.Mutex
+	tasks []*singletonTask
+}
+
+type singletonTask struct {
+	name string
+	run  func(ctx context.Context)
+
+	// lock, since and the task's cancel and done are set while leading
+	lock   *AdvisoryLock
+	since  time.Time
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewLeaderElector creates an elector that tries to take the lead of tasks
+// every interval
+func NewLeaderElector(db *DatabaseService, interval time.Duration) *LeaderElector {
+	return &LeaderElector{db: db, interval: interval}
+}
+
+// Register adds a singleton task. run must return when its context is
+// cancelled, which happens when leadership is lost. Tasks are registered
+// before Run is called.
+func (e *LeaderElector) Register(name string, run func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tasks = append(e.tasks, &singletonTask{name: name, run: run})
+	metrics.Leader.WithLabelValues(name).Set(0)
+}
+
+// PauseWhile makes the elector stop the tasks it leads, and take the lead of
+// none, while paused returns true, as during maintenance. Stopped tasks
+// finish their current pass first. It is set before Run is called.
+func (e *LeaderElector) PauseWhile(paused func() bool) {
+	e.paused = paused
+}
+
+// Run elects until ctx is cancelled, then stops the tasks it leads and
+// releases their locks
+func (e *LeaderElector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	wasPaused := false
+	for {
+		paused := e.paused != nil && e.paused()
+		if paused != wasPaused {
+			if paused {
+				log.Println("Pausing singleton tasks for maintenance")
+			} else {
+				log.Println("Resuming singleton tasks after maintenance")
+			}
+			wasPaused = paused
+		}
+		for _, task := range e.tasks {
+			if paused {
+				e.resign(task)
+				continue
+			}
+			e.elect(ctx, task)
+		}
+		select {
+		case <-ctx.Done():
+			for _, task := range e.tasks {
+				e.resign(task)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// elect checks that a led task still holds its lock, or tries to take the
+// lock of a task led elsewhere
+func (e *LeaderElector) elect(ctx context.Context, task *singletonTask) {
+	checkCtx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+
+	if task.lock != nil {
+		err := task.lock.Check(checkCtx)
+		if err == nil {
+			return
+		}
+		log.Printf("Lost leadership of %s: %v", task.name, err)
+		e.resign(task)
+		return
+	}
+
+	lock, err := e.db.TryAdvisoryLock(checkCtx, task.name)
+	if err != nil {
+		log.Printf("Failed to run leader election for %s: %v", task.name, err)
+		return
+	}
+	if lock == nil {
+		return
+	}
+
+	taskCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	e.mu.Lock()
+	task.lock, task.since, task.cancel, task.done = lock, time.Now(), stop, done
+	e.mu.Unlock()
+	metrics.Leader.WithLabelValues(task.name).Set(1)
+	metrics.LeadershipChanges.WithLabelValues(task.name, "acquired").Inc()
+	log.Printf("Took leadership of %s", task.name)
+
+	go func() {
+		defer close(done)
+		task.run(taskCtx)
+	}()
+}
+
+// resign stops a led task, waits for it to return and releases its lock
+func (e *LeaderElector) resign(task *singletonTask) {
+	if task.lock == nil {
+		return
+	}
+	task.cancel()
+	<-task.done
+	task.lock.Release()
+
+	e.mu.Lock()
+	task.lock, task.since, task.cancel, task.done = nil, time.Time{}, nil, nil
+	e.mu.Unlock()
+	metrics.Leader.WithLabelValues(task.name).Set(0)
+	metrics.LeadershipChanges.WithLabelValues(task.name, "released").Inc()
+}
+
+// Status reports the leadership of every registered task, by task name
+func (e *LeaderElector) Status() []Leadership {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := make([]Leadership, 0, len(e.tasks))
+	for _, task := range e.tasks {
+		leadership := Leadership{Task: task.name, Leader: task.lock != nil}
+		if leadership.Leader {
+			since := task.since
+			leadership.Since = &since
+		}
+		status = append(status, leadership)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Task < status[j].Task })
+	return status
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// Storage tiers of a document's file
+const (
+	// StorageTierHot files are in the region's documents bucket
+	StorageTierHot = "hot"
+	// StorageTierArchived files have been moved to the archive bucket
+	StorageTierArchived = "archived"
+	// StorageTierRestoring files are being copied back to the hot tier and
+	// are still read from the archive bucket
+	StorageTierRestoring = "restoring"
+)
+
+// GetDocumentsToArchive returns hot documents that were uploaded, or last
+// restored, before the cutoff, oldest first
+func (d *DatabaseService) GetDocumentsToArchive(before time.Time, limit int) ([]*Document, error) {
+	query := `SELECT ` + documentColumns + ` FROM documents
+		WHERE storage_tier = $1 AND COALESCE(tier_changed_at, created_at) < $2 AND deleted_at IS NULL
+		ORDER BY created_at LIMIT $3`
+
+	rows, err := d.db.Query(query, StorageTierHot, d.db.dialect.timeArg(before), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents to archive: %v", err)
+	}
+	defer rows.Close()
+
+	var documents []*Document
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %v", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// UpdateDocumentStorageTier moves the document from one tier to another. It
+// reports false, without changing anything, when the document is no longer
+// in the from tier, so that concurrent transitions do not both proceed.
+func (d *DatabaseService) UpdateDocumentStorageTier(id DocumentID, from, to string) (bool, error) {
+	var changed bool
+	err := withRetry("update_document_storage_tier", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		changed = false
+		result, err := tx.Exec(`
+			UPDATE documents SET storage_tier = $3, tier_changed_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND storage_tier = $2 AND deleted_at IS NULL`, id, from, to)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		tenantID, err := documentTenant(tx, id)
+		if err != nil {
+			return err
+		}
+		if err := appendDocumentEvent(tx, id, tenantID, EventStorageTierChanged, Metadata{"from": from, "to": to}); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	return changed, err
+}
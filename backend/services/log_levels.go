@@ -0,0 +1,70 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// LogLevelOverride sets the log level of a component on every replica, over
+// the one the environment configures, until ExpiresAt when set
+type LogLevelOverride struct {
+	Component string     `json:"component"`
+	Level     string     `json:"level"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	ChangedAt time.Time  `json:"changed_at"`
+}
+
+// GetLogLevelOverrides returns the overrides in force at now
+func (d *DatabaseService) GetLogLevelOverrides(now time.Time) ([]*LogLevelOverride, error) {
+	rows, err := d.db.Query(`
+		SELECT component, level, expires_at, changed_at FROM log_level_overrides
+		WHERE expires_at IS NULL OR expires_at > $1
+		ORDER BY component`, d.db.dialect.timeArg(now))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query log level overrides: %v", err)
+	}
+	defer rows.Close()
+
+	overrides := []*LogLevelOverride{}
+	for rows.Next() {
+		override := &LogLevelOverride{}
+		if err := rows.Scan(&override.Component, &override.Level, &override.ExpiresAt, &override.ChangedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan log level override: %v", err)
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, rows.Err()
+}
+
+// SetLogLevelOverride stores the override of its component, replacing any
+// earlier one, and sets ChangedAt
+func (d *DatabaseService) SetLogLevelOverride(override *LogLevelOverride) error {
+	now := time.Now().UTC()
+	var expiresAt interface{}
+	if override.ExpiresAt != nil {
+		expiresAt = d.db.dialect.timeArg(*override.ExpiresAt)
+	}
+	return withRetry("set_log_level_override", func() error {
+		_, err := d.db.Exec(`
+			INSERT INTO log_level_overrides (component, level, expires_at, changed_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (component) DO UPDATE SET level = excluded.level,
+				expires_at = excluded.expires_at, changed_at = excluded.changed_at`,
+			override.Component, override.Level, expiresAt, d.db.dialect.timeArg(now))
+		if err == nil {
+			override.ChangedAt = now
+		}
+		return err
+	})
+}
+
+// DeleteLogLevelOverride returns a component to its configured level. It
+// reports whether the component had an override.
+func (d *DatabaseService) DeleteLogLevelOverride(component string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM log_level_overrides WHERE component = $1`, component)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete log level override: %v", err)
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
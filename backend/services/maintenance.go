@@ -0,0 +1,45 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// Maintenance is the maintenance mode of the whole deployment. While it is
+// enabled the API only serves reads and background work pauses, so that
+// the shared database can be migrated.
+type Maintenance struct {
+	Enabled bool `json:"enabled"`
+	// Message is shown to clients whose writes are refused; nil uses a
+	// default
+	Message *string `json:"message"`
+	// RetryAfter is the Retry-After, in seconds, of refused writes
+	RetryAfter int       `json:"retry_after"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// GetMaintenance returns the current maintenance mode
+func (d *DatabaseService) GetMaintenance() (*Maintenance, error) {
+	maintenance := &Maintenance{}
+	err := d.db.QueryRow(`SELECT enabled, message, retry_after, changed_at FROM maintenance_mode WHERE id = 1`).
+		Scan(&maintenance.Enabled, &maintenance.Message, &maintenance.RetryAfter, &maintenance.ChangedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read maintenance mode: %v", err)
+	}
+	return maintenance, nil
+}
+
+// SetMaintenance enables or disables maintenance mode and sets ChangedAt
+func (d *DatabaseService) SetMaintenance(maintenance *Maintenance) error {
+	now := time.Now().UTC()
+	return withRetry("set_maintenance", func() error {
+		_, err := d.db.Exec(`
+			UPDATE maintenance_mode SET enabled = $1, message = $2, retry_after = $3, changed_at = $4
+			WHERE id = 1`,
+			maintenance.Enabled, maintenance.Message, maintenance.RetryAfter, d.db.dialect.timeArg(now))
+		if err == nil {
+			maintenance.ChangedAt = now
+		}
+		return err
+	})
+}
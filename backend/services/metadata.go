@@ -0,0 +1,276 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata is the JSONB metadata object stored on a document
+type Metadata map[string]interface{}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported metadata type %T", src)
+	}
+	return json.Unmarshal(data, m)
+}
+
+// Metadata field types supported by the per document type schemas
+const (
+	FieldString = "string"
+	FieldNumber = "number"
+	FieldBool   = "boolean"
+	FieldDate   = "date"
+)
+
+type MetadataField struct {
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+
+	// Pattern is a regular expression string values must match
+	Pattern string `json:"pattern,omitempty"`
+
+	// Extract is a regular expression with one group; when a document's
+	// text is parsed, the group's first match becomes the field's value
+	// unless the field already has one
+	Extract string `json:"extract,omitempty"`
+}
+
+// MetadataSchemas lists the allowed metadata keys for each known document type.
+// Documents without a type (or with an unknown type) accept any scalar values.
+var MetadataSchemas = map[string]map[string]MetadataField{
+	"invoice": {
+		"invoice_number": {Type: FieldString},
+		"vendor":         {Type: FieldString},
+		"amount":         {Type: FieldNumber},
+		"currency":       {Type: FieldString},
+		"invoice_date":   {Type: FieldDate},
+		"due_date":       {Type: FieldDate},
+		"po_number":      {Type: FieldString},
+		"approved_by":    {Type: FieldString},
+		"approver_level": {Type: FieldString},
+	},
+	"receipt": {
+		"merchant":       {Type: FieldString},
+		"amount":         {Type: FieldNumber},
+		"currency":       {Type: FieldString},
+		"purchase_date":  {Type: FieldDate},
+		"card_last4":     {Type: FieldString},
+		"approved_by":    {Type: FieldString},
+		"approver_level": {Type: FieldString},
+	},
+	"bank_statement": {
+		"bank_name":      {Type: FieldString},
+		"account_number": {Type: FieldString},
+		"period_start":   {Type: FieldDate},
+		"period_end":     {Type: FieldDate},
+		"opening_amount": {Type: FieldNumber},
+		"closing_amount": {Type: FieldNumber},
+	},
+	"loan_application": {
+		"applicant_name":   {Type: FieldString},
+		"loan_amount":      {Type: FieldNumber},
+		"annual_income":    {Type: FieldNumber},
+		"employer":         {Type: FieldString},
+		"application_date": {Type: FieldDate},
+		"is_joint":         {Type: FieldBool},
+	},
+}
+
+var metadataKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// MetadataValidationError lists every problem found in a metadata object
+type MetadataValidationError struct {
+	Problems []string
+}
+
+func (e *MetadataValidationError) Error() string {
+	return "invalid metadata: " + strings.Join(e.Problems, "; ")
+}
+
+// MetadataSchema returns the metadata keys allowed for a document type: the
+// built-in ones plus the fields its tenant added. It is nil for documents
+// without a type or of a type neither defines.
+func MetadataSchema(documentType *string, fields DocumentFields) map[string]MetadataField {
+	if documentType == nil {
+		return nil
+	}
+	builtIn, extra := MetadataSchemas[*documentType], fields[*documentType]
+	if len(extra) == 0 {
+		return builtIn
+	}
+	schema := make(map[string]MetadataField, len(builtIn)+len(extra))
+	for name, field := range builtIn {
+		schema[name] = field
+	}
+	for name, field := range extra {
+		schema[name] = field
+	}
+	return schema
+}
+
+// ValidateMetadata checks metadata against the schema for the document type,
+// including the fields the document's tenant added
+func ValidateMetadata(documentType *string, md Metadata, fields DocumentFields) error {
+	var problems []string
+
+	schema := MetadataSchema(documentType, fields)
+
+	keys := make([]string, 0, len(md))
+	for key := range md {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := md[key]
+		if !metadataKeyPattern.MatchString(key) {
+			problems = append(problems, fmt.Sprintf("invalid key %q", key))
+			continue
+		}
+
+		if schema == nil {
+			switch value.(type) {
+			case string, float64, bool, nil:
+			default:
+				problems = append(problems, fmt.Sprintf("%s must be a scalar value", key))
+			}
+			continue
+		}
+
+		field, ok := schema[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown key %q for document type %s", key, *documentType))
+			continue
+		}
+		if err := checkFieldType(field, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %v", key, err))
+		}
+	}
+
+	fieldNames := make([]string, 0, len(schema))
+	for name := range schema {
+		fieldNames = append(fieldNames, name)
+	}
+	sort.Strings(fieldNames)
+	for _, name := range fieldNames {
+		if _, ok := md[name]; schema[name].Required && !ok {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &MetadataValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func checkFieldType(field MetadataField, value interface{}) error {
+	switch field.Type {
+	case FieldString:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("must be a string")
+		}
+	case FieldNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("must be a number")
+		}
+	case FieldBool:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+	case FieldDate:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("must be a date string (YYYY-MM-DD)")
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return fmt.Errorf("must be a date string (YYYY-MM-DD)")
+		}
+	}
+	if field.Pattern != "" {
+		// Patterns are checked when the tenant's fields are saved
+		pattern, err := regexp.Compile(field.Pattern)
+		if s, ok := value.(string); ok && err == nil && !pattern.MatchString(s) {
+			return fmt.Errorf("must match %s", field.Pattern)
+		}
+	}
+	return nil
+}
+
+// MetadataFilter matches documents whose metadata contains Key with the given
+// value, as supplied in a ?metadata.key=value query parameter
+type MetadataFilter struct {
+	Key   string
+	Value string
+}
+
+// ParseMetadataFilters extracts metadata.* filters from query parameters
+func ParseMetadataFilters(query map[string][]string) ([]MetadataFilter, error) {
+	var filters []MetadataFilter
+	for param, values := range query {
+		if !strings.HasPrefix(param, "metadata.") {
+			continue
+		}
+		key := strings.TrimPrefix(param, "metadata.")
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("invalid metadata filter key %q", key)
+		}
+		for _, value := range values {
+			filters = append(filters, MetadataFilter{Key: key, Value: value})
+		}
+	}
+	sort.Slice(filters, func(i, j int) bool {
+		if filters[i].Key != filters[j].Key {
+			return filters[i].Key < filters[j].Key
+		}
+		return filters[i].Value < filters[j].Value
+	})
+	return filters, nil
+}
+
+// containmentDocuments returns the JSON objects used with the @> operator.
+// Query values are untyped, so a value that also parses as a number or
+// boolean matches either representation.
+func (f MetadataFilter) containmentDocuments() []string {
+	candidates := []interface{}{f.Value}
+	if n, err := strconv.ParseFloat(f.Value, 64); err == nil {
+		candidates = append(candidates, n)
+	}
+	if f.Value == "true" || f.Value == "false" {
+		candidates = append(candidates, f.Value == "true")
+	}
+
+	docs := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		b, _ := json.Marshal(map[string]interface{}{f.Key: candidate})
+		docs = append(docs, string(b))
+	}
+	return docs
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"frauddocai-backend/logging"
+)
+
+// Schema changes made after database/init.sql are shipped as numbered SQL
+// files and applied in order on startup. Each file runs in its own
+// transaction and is recorded in schema_migrations.
+//
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+func runMigrations(db *conn, migrations fs.FS, dir string) error {
+	lock, err := lockMigrations(db)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".sql") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		version := strings.TrimSuffix(name, ".sql")
+
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`, version).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %v", version, err)
+		}
+		if exists {
+			continue
+		}
+
+		contents, err := fs.ReadFile(migrations, dir+"/"+name)
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %v", version, err)
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(contents)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply migration %s: %v", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to record migration %s: %v", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		logging.DB.Infof("Applied database migration %s", version)
+	}
+
+	return nil
+}
+
+// lockMigrations takes the advisory lock of migrations on Postgres, waiting
+// while another replica holds it, so that replicas starting together apply
+// each migration once: the next to get the lock finds them recorded. The
+// lock is held on a connection of its own, so the pool needs room for one
+// more to run the migrations.
+func lockMigrations(db *conn) (*AdvisoryLock, error) {
+	if db.dialect == dialectSQLite {
+		return &AdvisoryLock{}, nil
+	}
+
+	ctx := context.Background()
+	c, err := db.pool.Load().Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open connection for migration lock: %v", err)
+	}
+	started := time.Now()
+	if _, err := c.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey("migrations")); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to take migration lock: %v", err)
+	}
+	if waited := time.Since(started); waited > time.Second {
+		logging.DB.Infof("Waited %v for another replica to finish migrating", waited.Round(time.Second))
+	}
+	return &AdvisoryLock{conn: c}, nil
+}
@@ -0,0 +1,9 @@
+-- Document metadata is a JSON object validated per document type
+UPDATE documents SET metadata = NULL WHERE metadata IS NOT NULL AND jsonb_typeof(metadata) <> 'object';
+
+ALTER TABLE documents
+    ADD CONSTRAINT documents_metadata_is_object
+    CHECK (metadata IS NULL OR jsonb_typeof(metadata) = 'object');
+
+-- GIN index backing ?metadata.key=value containment filters
+CREATE INDEX IF NOT EXISTS idx_documents_metadata ON documents USING gin (metadata jsonb_path_ops);
@@ -0,0 +1,6 @@
+-- Which analyzer produced a document's fraud score, and whether it was a
+-- fallback used while the primary provider was unavailable
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS analysis_provider VARCHAR(50);
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS analysis_fallback BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_documents_analysis_fallback ON documents(updated_at) WHERE analysis_fallback;
@@ -0,0 +1,22 @@
+-- Document embeddings for semantic search. Needs the pgvector extension; on
+-- servers without it the table is skipped and semantic search reports itself
+-- unavailable. After installing pgvector, delete this migration's row from
+-- schema_migrations and restart to create the table.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+        CREATE EXTENSION IF NOT EXISTS vector;
+
+        CREATE TABLE IF NOT EXISTS document_embeddings (
+            document_id UUID PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+            model VARCHAR(255),
+            embedding vector(384) NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+
+        CREATE INDEX IF NOT EXISTS idx_document_embeddings_cosine
+            ON document_embeddings USING hnsw (embedding vector_cosine_ops);
+    ELSE
+        RAISE NOTICE 'pgvector is not installed, skipping document_embeddings';
+    END IF;
+END $$;
@@ -0,0 +1,38 @@
+-- SHA-256 of the uploaded file, used to spot exact re-submissions
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS content_sha256 VARCHAR(64);
+CREATE INDEX IF NOT EXISTS idx_documents_content_sha256 ON documents(content_sha256);
+
+-- Confirmed fraudulent documents that new uploads are compared against.
+-- Rows without a tenant are shared by every tenant.
+CREATE TABLE IF NOT EXISTS fraud_exemplars (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id UUID REFERENCES documents(id) ON DELETE SET NULL,
+    label VARCHAR(255) NOT NULL,
+    notes TEXT,
+    content_sha256 VARCHAR(64),
+    entities JSONB NOT NULL DEFAULT '[]',
+    embedding TEXT,
+    promoted_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fraud_exemplars_tenant_id ON fraud_exemplars(tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fraud_exemplars_document_id ON fraud_exemplars(document_id);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id UUID REFERENCES documents(id) ON DELETE CASCADE,
+    exemplar_id UUID REFERENCES fraud_exemplars(id) ON DELETE SET NULL,
+    kind VARCHAR(50) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    score DECIMAL(5,4),
+    details JSONB NOT NULL DEFAULT '{}',
+    acknowledged_by VARCHAR(255),
+    acknowledged_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alerts_created_at ON alerts(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_alerts_unacknowledged ON alerts(created_at DESC) WHERE acknowledged_at IS NULL;
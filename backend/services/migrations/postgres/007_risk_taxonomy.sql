@@ -0,0 +1,2 @@
+-- Per tenant risk levels; NULL uses the built-in low/medium/high/critical taxonomy
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS risk_taxonomy JSONB;
@@ -0,0 +1,3 @@
+-- Pattern statistics and listings filter detections by pattern and date
+CREATE INDEX IF NOT EXISTS idx_document_fraud_detections_pattern_created
+    ON document_fraud_detections(fraud_pattern_id, created_at);
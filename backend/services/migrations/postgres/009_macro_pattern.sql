@@ -0,0 +1,4 @@
+-- Recorded by the Office extractor for files carrying a VBA project
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Embedded Macros', 'embedded_macros', 'Office document containing a macro (VBA) project', '{"source": "extraction", "parts": ["vbaProject.bin"]}', 'high'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'embedded_macros');
@@ -0,0 +1,11 @@
+-- Entities found in each document's text, as recorded by ExtractEntities,
+-- indexed by value for watchlist and rule lookups
+CREATE TABLE IF NOT EXISTS document_entities (
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, kind, value)
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_entities_value ON document_entities(kind, value);
@@ -0,0 +1,4 @@
+-- Data residency: the region a tenant's files are stored in, NULL for the
+-- default region, and the region each document's file was uploaded to
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS storage_region VARCHAR(50);
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS storage_region VARCHAR(50);
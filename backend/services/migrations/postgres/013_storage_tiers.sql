@@ -0,0 +1,6 @@
+-- Storage tier of each document's file: hot in the documents bucket, or
+-- archived (or being restored from) the archive bucket
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS storage_tier VARCHAR(20) NOT NULL DEFAULT 'hot';
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS tier_changed_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_documents_storage_tier ON documents(storage_tier, created_at);
@@ -0,0 +1,12 @@
+-- Reference counts of stored objects per region and bucket tier. Uploads are
+-- named after their content hash, so documents with identical files share
+-- one object. Objects stored before that have no row and belong to a single
+-- document.
+CREATE TABLE IF NOT EXISTS stored_objects (
+    region VARCHAR(50) NOT NULL,
+    tier VARCHAR(20) NOT NULL,
+    object_name VARCHAR(500) NOT NULL,
+    ref_count INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (region, tier, object_name)
+);
@@ -0,0 +1,17 @@
+-- Outcome and duration of each stage of each document's pipeline runs,
+-- numbered per document. Skipped stages have no started_at.
+CREATE TABLE IF NOT EXISTS pipeline_stage_runs (
+    id BIGSERIAL PRIMARY KEY,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    run INTEGER NOT NULL,
+    run_started_at TIMESTAMP NOT NULL,
+    stage VARCHAR(50) NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL,
+    started_at TIMESTAMP,
+    duration_ms DOUBLE PRECISION NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_stage_runs_document ON pipeline_stage_runs(document_id, run);
+CREATE INDEX IF NOT EXISTS idx_pipeline_stage_runs_started ON pipeline_stage_runs(run_started_at, stage);
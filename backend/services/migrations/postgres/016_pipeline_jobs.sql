@@ -0,0 +1,19 @@
+-- Documents waiting for, or running, their processing pipeline. Workers on
+-- every replica claim queued jobs, and jobs whose lease has expired because
+-- their worker stopped, with FOR UPDATE SKIP LOCKED. Finished jobs are
+-- deleted; jobs whose worker stopped too often are kept as failed.
+CREATE TABLE IF NOT EXISTS pipeline_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    document_id UUID NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    reuse_text BOOLEAN NOT NULL DEFAULT FALSE,
+    state VARCHAR(20) NOT NULL DEFAULT 'queued',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lease_owner VARCHAR(255),
+    lease_expires_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pipeline_jobs_claimable ON pipeline_jobs(state, lease_expires_at, id);
+CREATE INDEX IF NOT EXISTS idx_pipeline_jobs_document ON pipeline_jobs(document_id);
@@ -0,0 +1,16 @@
+-- Analysis results reused for texts analyzed before. The key hashes the
+-- provider, its model version and the normalized text; the response is the
+-- analyzer's result before the tenant's risk taxonomy is applied.
+CREATE TABLE IF NOT EXISTS analysis_cache (
+    cache_key CHAR(64) PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    model_version VARCHAR(255) NOT NULL,
+    response JSONB NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_analysis_cache_created_at ON analysis_cache(created_at);
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS analysis_cached BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,111 @@
+-- Partition documents by month of created_at, so that old months can be
+-- dropped whole and queries by upload date only read their months. New
+-- months are created, and expired ones dropped, by the partition maintenance
+-- task; the migration creates the months of the existing documents and the
+-- next three. It copies every document, so run it in a maintenance window on
+-- large databases. Requires Postgres 13 or later.
+--
+-- A partitioned table's primary key must include the partition key, so it
+-- becomes (id, created_at), and foreign keys can no longer reference
+-- documents(id). They are replaced by document_references, which the delete
+-- trigger and the maintenance task apply. Later migrations that add a table
+-- referencing documents register it there instead of declaring a foreign key.
+CREATE TABLE IF NOT EXISTS document_references (
+    table_name TEXT NOT NULL,
+    column_name TEXT NOT NULL,
+    on_delete VARCHAR(10) NOT NULL CHECK (on_delete IN ('cascade', 'set null')),
+    PRIMARY KEY (table_name, column_name)
+);
+
+DO $$
+DECLARE
+    fk RECORD;
+    month DATE;
+    last_month DATE;
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'documents'::regclass) THEN
+        RETURN;
+    END IF;
+
+    FOR fk IN
+        SELECT c.conrelid::regclass::text AS table_name, a.attname AS column_name, c.conname, c.confdeltype
+        FROM pg_constraint c
+        JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+        WHERE c.contype = 'f' AND c.confrelid = 'documents'::regclass
+    LOOP
+        INSERT INTO document_references (table_name, column_name, on_delete)
+        VALUES (fk.table_name, fk.column_name, CASE WHEN fk.confdeltype = 'n' THEN 'set null' ELSE 'cascade' END)
+        ON CONFLICT DO NOTHING;
+        EXECUTE format('ALTER TABLE %s DROP CONSTRAINT %I', fk.table_name, fk.conname);
+    END LOOP;
+
+    ALTER TABLE documents RENAME TO documents_unpartitioned;
+    ALTER INDEX documents_pkey RENAME TO documents_unpartitioned_pkey;
+    UPDATE documents_unpartitioned SET created_at = COALESCE(updated_at, CURRENT_TIMESTAMP) WHERE created_at IS NULL;
+
+    CREATE TABLE documents (LIKE documents_unpartitioned INCLUDING DEFAULTS INCLUDING CONSTRAINTS)
+        PARTITION BY RANGE (created_at);
+    ALTER TABLE documents ALTER COLUMN created_at SET NOT NULL;
+    ALTER TABLE documents ADD PRIMARY KEY (id, created_at);
+    ALTER TABLE documents ADD FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+    ALTER TABLE documents ADD FOREIGN KEY (tenant_id) REFERENCES tenants(id) ON DELETE CASCADE;
+
+    month := date_trunc('month', COALESCE((SELECT MIN(created_at) FROM documents_unpartitioned), CURRENT_TIMESTAMP))::date;
+    last_month := (date_trunc('month', CURRENT_TIMESTAMP) + INTERVAL '3 months')::date;
+    WHILE month <= last_month LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF documents FOR VALUES FROM (%L) TO (%L)',
+            'documents_' || to_char(month, 'YYYY_MM'), month, (month + INTERVAL '1 month')::date);
+        month := (month + INTERVAL '1 month')::date;
+    END LOOP;
+    -- Catches documents dated outside the monthly partitions, such as
+    -- restored backups older than the oldest month
+    CREATE TABLE documents_default PARTITION OF documents DEFAULT;
+
+    INSERT INTO documents SELECT * FROM documents_unpartitioned;
+    DROP TABLE documents_unpartitioned;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_documents_user_id ON documents(user_id);
+CREATE INDEX IF NOT EXISTS idx_documents_status ON documents(status);
+CREATE INDEX IF NOT EXISTS idx_documents_fraud_score ON documents(fraud_score);
+CREATE INDEX IF NOT EXISTS idx_documents_created_at ON documents(created_at);
+CREATE INDEX IF NOT EXISTS idx_documents_metadata ON documents USING gin (metadata jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_documents_tenant_id ON documents(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_documents_analysis_fallback ON documents(updated_at) WHERE analysis_fallback;
+CREATE INDEX IF NOT EXISTS idx_documents_content_sha256 ON documents(content_sha256);
+CREATE INDEX IF NOT EXISTS idx_documents_storage_tier ON documents(storage_tier, created_at);
+
+CREATE OR REPLACE FUNCTION delete_document_references()
+RETURNS TRIGGER AS $$
+DECLARE
+    ref RECORD;
+BEGIN
+    FOR ref IN SELECT table_name, column_name, on_delete FROM document_references LOOP
+        IF ref.on_delete = 'set null' THEN
+            EXECUTE format('UPDATE %s SET %I = NULL WHERE %I = $1', ref.table_name, ref.column_name, ref.column_name) USING OLD.id;
+        ELSE
+            EXECUTE format('DELETE FROM %s WHERE %I = $1', ref.table_name, ref.column_name) USING OLD.id;
+        END IF;
+    END LOOP;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS delete_document_references ON documents;
+CREATE TRIGGER delete_document_references AFTER DELETE ON documents
+FOR EACH ROW EXECUTE FUNCTION delete_document_references();
+
+DROP TRIGGER IF EXISTS update_documents_updated_at ON documents;
+CREATE TRIGGER update_documents_updated_at BEFORE UPDATE ON documents
+FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+DROP TRIGGER IF EXISTS count_documents ON documents;
+CREATE TRIGGER count_documents AFTER INSERT OR DELETE ON documents
+FOR EACH ROW EXECUTE FUNCTION count_document_change();
+
+DROP TRIGGER IF EXISTS count_document_updates ON documents;
+CREATE TRIGGER count_document_updates AFTER UPDATE OF tenant_id, created_at, status, fraud_risk_level ON documents
+FOR EACH ROW
+WHEN (OLD.tenant_id IS DISTINCT FROM NEW.tenant_id OR OLD.created_at IS DISTINCT FROM NEW.created_at
+      OR OLD.status IS DISTINCT FROM NEW.status OR OLD.fraud_risk_level IS DISTINCT FROM NEW.fraud_risk_level)
+EXECUTE FUNCTION count_document_change();
@@ -0,0 +1,44 @@
+-- The emotion and pattern analysis JSON made document rows large, slowing
+-- every query that lists documents. It moves to document_analyses, read only
+-- when a single document is requested; documents keep the number of patterns
+-- found and the dominant emotion.
+CREATE TABLE IF NOT EXISTS document_analyses (
+    document_id UUID PRIMARY KEY,
+    emotion_analysis JSONB,
+    pattern_analysis JSONB,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('document_analyses', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS pattern_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS dominant_emotion VARCHAR(50);
+
+INSERT INTO document_analyses (document_id, emotion_analysis, pattern_analysis, updated_at)
+SELECT id, emotion_analysis, pattern_analysis, updated_at FROM documents
+WHERE emotion_analysis IS NOT NULL OR pattern_analysis IS NOT NULL
+ON CONFLICT (document_id) DO NOTHING;
+
+-- Filling in the summaries is not an update of the documents, so it must not
+-- move their updated_at
+DROP TRIGGER IF EXISTS update_documents_updated_at ON documents;
+
+UPDATE documents SET
+    pattern_count = CASE WHEN jsonb_typeof(pattern_analysis->'patterns') = 'array'
+                         THEN jsonb_array_length(pattern_analysis->'patterns') ELSE 0 END,
+    dominant_emotion = (
+        SELECT e->>'emotion'
+        FROM jsonb_array_elements(CASE WHEN jsonb_typeof(emotion_analysis->'emotions') = 'array'
+                                       THEN emotion_analysis->'emotions' ELSE '[]'::jsonb END) e
+        WHERE jsonb_typeof(e->'confidence') = 'number'
+        ORDER BY (e->>'confidence')::float DESC
+        LIMIT 1)
+WHERE emotion_analysis IS NOT NULL OR pattern_analysis IS NOT NULL;
+
+CREATE TRIGGER update_documents_updated_at BEFORE UPDATE ON documents
+FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+ALTER TABLE documents DROP COLUMN IF EXISTS emotion_analysis;
+ALTER TABLE documents DROP COLUMN IF EXISTS pattern_analysis;
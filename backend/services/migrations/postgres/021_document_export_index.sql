@@ -0,0 +1,2 @@
+-- Document exports page through documents in (updated_at, id) order
+CREATE INDEX IF NOT EXISTS idx_documents_updated_at_id ON documents(updated_at, id);
@@ -0,0 +1,61 @@
+-- Change feed: one row per create, update or delete of a document or fraud
+-- detection, written by triggers in the transaction that made the change.
+-- Rows are kept for auditing until CHANGE_FEED_RETENTION has passed. txid is
+-- the writing transaction: the feed is read in (txid, id) order and only up
+-- to the oldest transaction still running, so a reader never moves past a
+-- change that has yet to commit.
+CREATE TABLE IF NOT EXISTS changes (
+    id BIGSERIAL PRIMARY KEY,
+    txid BIGINT NOT NULL DEFAULT pg_current_xact_id()::text::bigint,
+    entity VARCHAR(20) NOT NULL,
+    entity_id UUID NOT NULL,
+    document_id UUID,
+    tenant_id UUID,
+    operation VARCHAR(10) NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_changes_txid ON changes(txid, id);
+CREATE INDEX IF NOT EXISTS idx_changes_tenant ON changes(tenant_id, txid, id);
+CREATE INDEX IF NOT EXISTS idx_changes_changed_at ON changes(changed_at);
+
+CREATE OR REPLACE FUNCTION record_document_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+        VALUES ('document', OLD.id, OLD.id, OLD.tenant_id, 'delete');
+    ELSE
+        INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+        VALUES ('document', NEW.id, NEW.id, NEW.tenant_id, CASE TG_OP WHEN 'INSERT' THEN 'create' ELSE 'update' END);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+-- A detection deleted with its document no longer finds the document's
+-- tenant, so it is recorded without one
+CREATE OR REPLACE FUNCTION record_detection_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+        VALUES ('detection', OLD.id, OLD.document_id,
+                (SELECT tenant_id FROM documents WHERE id = OLD.document_id), 'delete');
+    ELSE
+        INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+        VALUES ('detection', NEW.id, NEW.document_id,
+                (SELECT tenant_id FROM documents WHERE id = NEW.document_id),
+                CASE TG_OP WHEN 'INSERT' THEN 'create' ELSE 'update' END);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS record_document_changes ON documents;
+CREATE TRIGGER record_document_changes AFTER INSERT OR UPDATE OR DELETE ON documents
+FOR EACH ROW EXECUTE FUNCTION record_document_change();
+
+DROP TRIGGER IF EXISTS record_detection_changes ON document_fraud_detections;
+CREATE TRIGGER record_detection_changes AFTER INSERT OR UPDATE OR DELETE ON document_fraud_detections
+FOR EACH ROW EXECUTE FUNCTION record_detection_change();
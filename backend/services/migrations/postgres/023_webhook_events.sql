@@ -0,0 +1,19 @@
+-- Outbox of webhook events. Events are written when they happen and sent by
+-- the webhook_delivery singleton task, which retries failed deliveries with
+-- backoff. Delivered and abandoned events are kept as a record of what was
+-- sent.
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(100) NOT NULL,
+    tenant_id UUID,
+    data JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+    failed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_pending ON webhook_events(next_attempt_at, id)
+WHERE delivered_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,22 @@
+-- Reviewers away from work delegate their review queue to a colleague for a
+-- period. Alerts assigned to them in that period go to the delegate, and the
+-- alert keeps who it was meant for.
+CREATE TABLE IF NOT EXISTS review_delegations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    delegator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    delegate_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at),
+    CHECK (delegate_id <> delegator_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_delegations_delegator ON review_delegations(delegator_id, ends_at);
+CREATE INDEX IF NOT EXISTS idx_review_delegations_delegate ON review_delegations(delegate_id, ends_at);
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS assigned_to UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS original_assignee UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_alerts_assigned_to ON alerts(assigned_to) WHERE acknowledged_at IS NULL;
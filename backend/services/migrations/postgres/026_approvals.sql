@@ -0,0 +1,19 @@
+-- Four-eyes control: closing a critical alert or overriding a detection of a
+-- critical pattern waits here until a second reviewer approves it. Only one
+-- request per target can be pending.
+CREATE TABLE IF NOT EXISTS approvals (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    action VARCHAR(50) NOT NULL,
+    target_id UUID NOT NULL,
+    requested_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    approver_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_approvals_pending_target ON approvals(action, target_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_approvals_status ON approvals(status, created_at);
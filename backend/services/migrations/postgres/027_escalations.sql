@@ -0,0 +1,21 @@
+-- Escalation chains move alerts nobody closed up a tenant's chain of
+-- reviewers, such as analyst, senior analyst and fraud manager. The chain is
+-- kept on the tenant; each alert records the level it reached and its
+-- escalations.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS escalation_chain JSONB;
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalation_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS alert_escalations (
+    id BIGSERIAL PRIMARY KEY,
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    step_name VARCHAR(100) NOT NULL,
+    from_user UUID REFERENCES users(id) ON DELETE SET NULL,
+    to_user UUID REFERENCES users(id) ON DELETE SET NULL,
+    escalated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_escalations_alert_id ON alert_escalations(alert_id, level);
+CREATE INDEX IF NOT EXISTS idx_alerts_open ON alerts(created_at) WHERE acknowledged_at IS NULL;
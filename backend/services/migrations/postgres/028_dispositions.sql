@@ -0,0 +1,17 @@
+-- Dispositions record why a reviewer closed an alert or a detection, such
+-- as confirmed fraud or a clerical error. Each tenant may configure its own
+-- codes; the outcome of the code (fraud, not_fraud or inconclusive) is kept
+-- with the decision so reports and training labels survive later changes
+-- to the taxonomy.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS disposition_taxonomy JSONB;
+
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS disposition VARCHAR(50);
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS disposition_outcome VARCHAR(20);
+
+ALTER TABLE document_fraud_detections ADD COLUMN IF NOT EXISTS disposition VARCHAR(50);
+ALTER TABLE document_fraud_detections ADD COLUMN IF NOT EXISTS disposition_outcome VARCHAR(20);
+
+ALTER TABLE approvals ADD COLUMN IF NOT EXISTS disposition VARCHAR(50);
+ALTER TABLE approvals ADD COLUMN IF NOT EXISTS disposition_outcome VARCHAR(20);
+
+CREATE INDEX IF NOT EXISTS idx_document_fraud_detections_reviewed_at ON document_fraud_detections(reviewed_at) WHERE reviewed_at IS NOT NULL;
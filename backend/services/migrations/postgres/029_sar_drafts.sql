@@ -0,0 +1,15 @@
+-- Suspicious Activity Report drafts of confirmed fraud alerts. Each draft is
+-- a snapshot of the alert, its documents, entities and timeline when it was
+-- generated; generating again adds a version instead of replacing it.
+CREATE TABLE IF NOT EXISTS sar_drafts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    report JSONB NOT NULL,
+    generated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (alert_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_sar_drafts_tenant_id ON sar_drafts(tenant_id);
@@ -0,0 +1,42 @@
+-- Document lifecycle events: every change to a document is appended here in
+-- the transaction that writes it to documents, which holds the current state
+-- projected from them. Each event is chained to the document's previous one
+-- by hash, so an edited or removed event breaks the chain. The hash covers
+-- data_sha256 rather than data, so erasing a data subject can redact data
+-- without breaking the chain; that is the only update allowed. Events have
+-- no foreign keys: they outlive the documents and tenants they describe.
+CREATE TABLE IF NOT EXISTS document_events (
+    id BIGSERIAL PRIMARY KEY,
+    document_id UUID NOT NULL,
+    tenant_id UUID,
+    sequence INTEGER NOT NULL,
+    type VARCHAR(50) NOT NULL,
+    data JSONB,
+    data_sha256 VARCHAR(64) NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL,
+    redacted_at TIMESTAMP,
+    UNIQUE (document_id, sequence)
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_events_tenant ON document_events(tenant_id, id);
+
+CREATE OR REPLACE FUNCTION forbid_document_event_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.data IS NOT NULL AND NEW.data IS NULL AND NEW.redacted_at IS NOT NULL
+       AND (NEW.id, NEW.document_id, NEW.tenant_id, NEW.sequence, NEW.type, NEW.data_sha256,
+            NEW.occurred_at, NEW.prev_hash, NEW.hash)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.document_id, OLD.tenant_id, OLD.sequence, OLD.type, OLD.data_sha256,
+            OLD.occurred_at, OLD.prev_hash, OLD.hash) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION 'document_events is append-only';
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS document_events_append_only ON document_events;
+CREATE TRIGGER document_events_append_only BEFORE UPDATE OR DELETE ON document_events
+FOR EACH ROW EXECUTE FUNCTION forbid_document_event_change();
@@ -0,0 +1,36 @@
+-- Legal holds keep documents from being erased or expired while litigation
+-- or an investigation needs them. Releasing a hold keeps its row as a record.
+-- Holds do not reference documents by foreign key, since documents is
+-- partitioned, and are not cleared when a document goes.
+CREATE TABLE IF NOT EXISTS legal_holds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    placed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    placed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_legal_holds_active ON legal_holds(document_id) WHERE released_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_legal_holds_tenant_id ON legal_holds(tenant_id, placed_at);
+
+-- Data subject export and erasure requests. The subject is kept only as a
+-- digest, so the record of an erasure does not itself identify the person.
+CREATE TABLE IF NOT EXISTS privacy_requests (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL,
+    subject_sha256 VARCHAR(64) NOT NULL,
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    documents INTEGER NOT NULL DEFAULT 0,
+    erased INTEGER NOT NULL DEFAULT 0,
+    held INTEGER NOT NULL DEFAULT 0,
+    verified BOOLEAN,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_privacy_requests_tenant_id ON privacy_requests(tenant_id, created_at);
@@ -0,0 +1,11 @@
+-- The pseudonym vault maps the tokens in anonymized exports back to the
+-- values they replace. It is kept apart from the exports, which are shared
+-- outside the fraud team, and from tenant snapshots.
+CREATE TABLE IF NOT EXISTS pseudonym_vault (
+    token TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_pseudonym_vault_value ON pseudonym_vault(kind, value);
@@ -0,0 +1,10 @@
+-- Maintenance mode, shared by every replica. The table holds a single row.
+CREATE TABLE IF NOT EXISTS maintenance_mode (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    message TEXT,
+    retry_after INTEGER NOT NULL DEFAULT 300,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO maintenance_mode (id) VALUES (1) ON CONFLICT (id) DO NOTHING;
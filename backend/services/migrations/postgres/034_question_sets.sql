@@ -0,0 +1,35 @@
+-- Tenants' own fraud questions and prompt templates for the AI service's
+-- question answering. Saving a set adds a version rather than replacing one,
+-- and every analysis records the version it asked, so that it can be
+-- reproduced after the set changes.
+CREATE TABLE IF NOT EXISTS question_sets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    questions JSONB NOT NULL,
+    prompt_template TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS fraud_qa_analyses (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id UUID,
+    question_set_id UUID REFERENCES question_sets(id) ON DELETE SET NULL,
+    question_set_version INTEGER,
+    text_sha256 VARCHAR(64) NOT NULL,
+    overall_risk VARCHAR(20) NOT NULL,
+    total_risk_score DECIMAL(6,4) NOT NULL,
+    model_used VARCHAR(255),
+    fraud_analysis JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_fraud_qa_analyses_tenant_id ON fraud_qa_analyses(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_fraud_qa_analyses_document_id ON fraud_qa_analyses(document_id);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('fraud_qa_analyses', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
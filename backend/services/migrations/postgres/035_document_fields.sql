@@ -0,0 +1,4 @@
+-- Metadata fields tenants add to document types, such as an invoice's cost
+-- center, by document type and field name. Values are kept in the
+-- documents' metadata with the built-in fields.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS document_fields JSONB;
@@ -0,0 +1,8 @@
+-- Customers' approval hierarchies: the levels of their approvers and the
+-- level each amount needs. Documents approved below the required level, as
+-- reported in their metadata by the ERP connector, are detected.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS approval_policy JSONB;
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Approval Outside Policy', 'approval_outside_policy', 'Approved by someone below the level the customer''s approval policy requires for the amount, or by an approver the policy does not know', '{"source": "approval_policy", "metadata": ["approved_by", "approver_level"]}', 'high'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'approval_outside_policy');
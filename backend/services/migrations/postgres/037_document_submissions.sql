@@ -0,0 +1,23 @@
+-- Where each document was submitted from: the client address of the upload
+-- and the country it geolocates to. The velocity rules compare a user's
+-- recent submissions, and the audit log keeps the address with the upload.
+CREATE TABLE IF NOT EXISTS document_submissions (
+    document_id UUID PRIMARY KEY,
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    country VARCHAR(2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_submissions_user_id ON document_submissions(user_id, created_at);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('document_submissions', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs(resource_type, resource_id);
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Multi-Country Submissions', 'multi_country_submission', 'Submitted by a user who submitted documents from other countries within hours', '{"source": "submission_velocity", "data": ["ip_address", "country"]}', 'medium'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'multi_country_submission');
@@ -0,0 +1,11 @@
+-- The channel each document came in through and a fingerprint of the
+-- client that sent it. Fraud skews by channel, so tenants may weight the
+-- fraud scores of each channel.
+ALTER TABLE document_submissions ADD COLUMN IF NOT EXISTS channel VARCHAR(20) NOT NULL DEFAULT 'api';
+ALTER TABLE document_submissions ADD COLUMN IF NOT EXISTS fingerprint VARCHAR(64);
+ALTER TABLE document_submissions ADD COLUMN IF NOT EXISTS user_agent TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_document_submissions_channel ON document_submissions(channel);
+CREATE INDEX IF NOT EXISTS idx_document_submissions_fingerprint ON document_submissions(fingerprint);
+
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS channel_weights JSONB;
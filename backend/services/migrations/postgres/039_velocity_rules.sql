@@ -0,0 +1,34 @@
+-- Tenants' velocity rules: how many documents, or how large an amount, a
+-- user, a vendor or the whole tenant may submit within a window. Counts are
+-- kept per bucket of the window and updated as documents are analyzed, so a
+-- rule never re-reads the documents it counted. velocity_events records the
+-- documents each rule counted, so re-analysis does not count them again.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS velocity_rules JSONB;
+
+CREATE TABLE IF NOT EXISTS velocity_events (
+    document_id UUID NOT NULL,
+    rule_name VARCHAR(100) NOT NULL,
+    group_key TEXT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    amount DOUBLE PRECISION NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, rule_name)
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('velocity_events', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS velocity_counters (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    rule_name VARCHAR(100) NOT NULL,
+    group_key TEXT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    documents INTEGER NOT NULL DEFAULT 0,
+    amount DOUBLE PRECISION NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, rule_name, group_key, bucket_start)
+);
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Velocity Spike', 'velocity_spike', 'Took a user, a vendor or the tenant over the documents or amount its velocity rules allow within a window', '{"source": "velocity_rules"}', 'medium'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'velocity_spike');
@@ -0,0 +1,10 @@
+-- How far the sync of the document graph to Neo4j got: the change feed
+-- cursor after the last change written, and when the last full sync ended
+CREATE TABLE IF NOT EXISTS graph_sync_state (
+    target VARCHAR(50) PRIMARY KEY,
+    cursor VARCHAR(50),
+    full_synced_at TIMESTAMP,
+    synced_at TIMESTAMP,
+    documents BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
@@ -0,0 +1,5 @@
+-- The alert a webhook event notifies about, so that an investigation's
+-- timeline lists the notifications sent about its case.
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS alert_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_alert ON webhook_events(alert_id) WHERE alert_id IS NOT NULL;
@@ -0,0 +1,21 @@
+-- Files analysts attach to a case that are not documents to analyze, such
+-- as screenshots, bank confirmations and emails. Each is stored once per
+-- case under cases/<alert id>/ in the tenant's storage region.
+CREATE TABLE IF NOT EXISTS case_evidence (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    alert_id UUID NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    object_name VARCHAR(500) NOT NULL,
+    storage_region VARCHAR(50),
+    mime_type VARCHAR(100) NOT NULL,
+    file_size BIGINT NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    description TEXT,
+    uploaded_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (alert_id, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS idx_case_evidence_tenant_id ON case_evidence(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_case_evidence_object_name ON case_evidence(object_name);
@@ -0,0 +1,16 @@
+-- Time-boxed, read-only access of external auditors to some of a tenant's
+-- cases and team collections. The token is shown once, when the grant is
+-- made; only its SHA-256 is kept. Every access is recorded in audit_logs.
+CREATE TABLE IF NOT EXISTS auditor_grants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    auditor VARCHAR(255) NOT NULL,
+    token_sha256 VARCHAR(64) NOT NULL UNIQUE,
+    scope JSONB NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auditor_grants_tenant_id ON auditor_grants(tenant_id);
@@ -0,0 +1,4 @@
+-- The language users, or else their tenant, read API errors and generated
+-- reports in. Translations are loaded from bundles on disk.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS language VARCHAR(35);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language VARCHAR(35);
@@ -0,0 +1,51 @@
+-- Tenants report in their own time zone. Document counters are re-keyed
+-- from the day of the database's time zone to the UTC quarter hour a
+-- document was uploaded in, so stats can be summed into the days of any
+-- zone, including those offset from UTC by half or quarter hours.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS time_zone VARCHAR(64);
+
+-- The start of the UTC quarter hour of a timestamp stored in the
+-- database's time zone
+CREATE OR REPLACE FUNCTION utc_quarter_hour(t TIMESTAMP)
+RETURNS TIMESTAMP AS $$
+    SELECT date_trunc('hour', utc) + floor(extract(minute FROM utc) / 15) * INTERVAL '15 minutes'
+    FROM (SELECT t::timestamptz AT TIME ZONE 'UTC' AS utc) AS converted
+$$ LANGUAGE sql STABLE;
+
+-- Writes to documents wait until the counters are rebuilt, so none is
+-- missed or counted twice
+LOCK TABLE documents IN SHARE MODE;
+
+DROP TABLE IF EXISTS document_counts;
+CREATE TABLE document_counts (
+    tenant_key TEXT NOT NULL,
+    slot TIMESTAMP NOT NULL,
+    status VARCHAR(50) NOT NULL,
+    risk_level VARCHAR(20) NOT NULL,
+    documents BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_key, slot, status, risk_level)
+);
+
+CREATE INDEX IF NOT EXISTS idx_document_counts_slot ON document_counts(slot);
+
+CREATE OR REPLACE FUNCTION count_document_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE document_counts SET documents = documents - 1
+        WHERE tenant_key = COALESCE(OLD.tenant_id::text, '') AND slot = utc_quarter_hour(OLD.created_at)
+          AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+        VALUES (COALESCE(NEW.tenant_id::text, ''), utc_quarter_hour(NEW.created_at), COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+        ON CONFLICT (tenant_key, slot, status, risk_level) DO UPDATE SET documents = document_counts.documents + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+SELECT COALESCE(tenant_id::text, ''), utc_quarter_hour(created_at), COALESCE(status, ''), COALESCE(fraud_risk_level, ''), COUNT(*)
+FROM documents
+GROUP BY 1, 2, 3, 4;
@@ -0,0 +1,32 @@
+-- Document amounts are converted into their tenant's base currency for
+-- reports and velocity rules. fx_rates caches each day's exchange rates as
+-- fetched from the provider; document_amounts keeps the amounts of each
+-- document as submitted and as converted, with the rate used.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS base_currency VARCHAR(3);
+
+CREATE TABLE IF NOT EXISTS fx_rates (
+    day DATE NOT NULL,
+    base VARCHAR(3) NOT NULL,
+    quote VARCHAR(3) NOT NULL,
+    rate DOUBLE PRECISION NOT NULL,
+    published DATE NOT NULL,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (day, base, quote)
+);
+
+CREATE TABLE IF NOT EXISTS document_amounts (
+    document_id UUID NOT NULL,
+    field VARCHAR(64) NOT NULL,
+    amount DOUBLE PRECISION NOT NULL,
+    currency TEXT NOT NULL,
+    base_amount DOUBLE PRECISION,
+    base_currency VARCHAR(3) NOT NULL,
+    rate DOUBLE PRECISION,
+    rate_day DATE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, field)
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('document_amounts', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,19 @@
+-- Support staff impersonate a tenant's user to see what the user sees, only
+-- at tenants that consented to it. The session token is shown once, when
+-- the session starts; only its SHA-256 is kept. Every request made with it
+-- is recorded in audit_logs under both the admin and the user.
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS allow_impersonation BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS impersonation_sessions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    admin_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(500) NOT NULL,
+    token_sha256 VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_impersonation_sessions_tenant_id ON impersonation_sessions(tenant_id);
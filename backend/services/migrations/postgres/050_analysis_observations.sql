@@ -0,0 +1,21 @@
+-- Every fraud analysis stored on a document, with the provider and model
+-- version that scored it, for the model drift monitor and performance
+-- trends. The score is the analyzer's, before channel weights. Rows outlive
+-- their documents; they hold no document content.
+CREATE TABLE IF NOT EXISTS analysis_observations (
+    id BIGSERIAL PRIMARY KEY,
+    document_id UUID,
+    provider VARCHAR(50) NOT NULL,
+    model_version VARCHAR(255) NOT NULL DEFAULT '',
+    fallback BOOLEAN NOT NULL DEFAULT FALSE,
+    score DOUBLE PRECISION NOT NULL,
+    confidence DOUBLE PRECISION,
+    patterns INTEGER NOT NULL,
+    analyzed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('analysis_observations', 'document_id', 'set null')
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_analysis_observations_analyzed_at ON analysis_observations(analyzed_at);
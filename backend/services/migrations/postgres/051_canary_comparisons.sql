@@ -0,0 +1,23 @@
+-- Documents scored by both the stable and the canary version of the AI
+-- service. Scores and risk levels are after the tenant's channel weights;
+-- the canary's are null when its call failed. Stored analyses are the
+-- stable version's.
+CREATE TABLE IF NOT EXISTS canary_comparisons (
+    id BIGSERIAL PRIMARY KEY,
+    document_id UUID,
+    stable_version VARCHAR(255) NOT NULL DEFAULT '',
+    canary_version VARCHAR(255) NOT NULL,
+    stable_score DOUBLE PRECISION NOT NULL,
+    stable_risk_level VARCHAR(50) NOT NULL,
+    canary_score DOUBLE PRECISION,
+    canary_risk_level VARCHAR(50),
+    canary_latency_ms INTEGER NOT NULL,
+    error TEXT,
+    compared_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('canary_comparisons', 'document_id', 'set null')
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_canary_comparisons_compared_at ON canary_comparisons(compared_at);
@@ -0,0 +1,9 @@
+-- Log levels set through the API for a component on every replica, over
+-- the one LOG_LEVEL or LOG_LEVELS configures. An override past its
+-- expires_at no longer applies.
+CREATE TABLE IF NOT EXISTS log_level_overrides (
+    component VARCHAR(50) PRIMARY KEY,
+    level VARCHAR(10) NOT NULL,
+    expires_at TIMESTAMP,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,21 @@
+-- The pages of a document's extracted text, with the confidence of the OCR
+-- that read each, for low-confidence pages to be read again. text_start and
+-- text_end locate a page's text in the document's extracted_text, in bytes.
+CREATE TABLE IF NOT EXISTS document_pages (
+    document_id UUID NOT NULL,
+    page INTEGER NOT NULL,
+    source VARCHAR(10) NOT NULL,
+    confidence DOUBLE PRECISION NOT NULL,
+    status VARCHAR(10) NOT NULL,
+    error TEXT,
+    text_start INTEGER NOT NULL,
+    text_end INTEGER NOT NULL,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    reocr_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, page)
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('document_pages', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
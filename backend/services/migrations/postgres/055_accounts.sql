@@ -0,0 +1,60 @@
+-- Bank accounts known from the statements uploaded for them. A statement is
+-- analyzed only where its content is new to its account, and the findings
+-- of an account's statements are rolled up into the account. A tenant's
+-- accounts are identified by kind and normalized identifier.
+CREATE TABLE IF NOT EXISTS accounts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id UUID REFERENCES tenants(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    identifier VARCHAR(64) NOT NULL,
+    statements INTEGER NOT NULL DEFAULT 0,
+    last_document_id UUID,
+    risk_score DOUBLE PRECISION,
+    findings INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, kind, identifier)
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('accounts', 'last_document_id', 'set null')
+ON CONFLICT DO NOTHING;
+
+-- Each statement of an account, with how it continues the statement before
+-- it and how much of it was new and analyzed
+CREATE TABLE IF NOT EXISTS account_statements (
+    document_id UUID PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    previous_document_id UUID,
+    continuity VARCHAR(20) NOT NULL,
+    segments INTEGER NOT NULL,
+    new_segments INTEGER NOT NULL,
+    analyzed_bytes INTEGER NOT NULL,
+    period_start DATE,
+    period_end DATE,
+    opening_amount DOUBLE PRECISION,
+    closing_amount DOUBLE PRECISION,
+    fraud_score DOUBLE PRECISION,
+    pattern_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('account_statements', 'document_id', 'cascade'),
+       ('account_statements', 'previous_document_id', 'set null')
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_account_statements_account_id ON account_statements(account_id, created_at);
+
+-- Digests of the pages or paragraphs of an account's statements, with the
+-- statement each was first seen in
+CREATE TABLE IF NOT EXISTS account_segments (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    digest CHAR(64) NOT NULL,
+    document_id UUID NOT NULL,
+    PRIMARY KEY (account_id, digest)
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('account_segments', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
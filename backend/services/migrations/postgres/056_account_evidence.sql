@@ -0,0 +1,22 @@
+-- Accounts gather the findings of every document related to them, not only
+-- their statements: a document of a bank or customer account is evidence of
+-- its risk, weighted down as it ages. risk_score is the decayed score as of
+-- updated_at.
+ALTER TABLE accounts ADD COLUMN IF NOT EXISTS documents INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS account_documents (
+    account_id UUID NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    document_id UUID NOT NULL,
+    fraud_score DOUBLE PRECISION NOT NULL,
+    risk_level VARCHAR(20) NOT NULL,
+    pattern_count INTEGER NOT NULL DEFAULT 0,
+    observed_at TIMESTAMP NOT NULL,
+    analyzed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, document_id)
+);
+
+INSERT INTO document_references (table_name, column_name, on_delete)
+VALUES ('account_documents', 'document_id', 'cascade')
+ON CONFLICT DO NOTHING;
+
+CREATE INDEX IF NOT EXISTS idx_account_documents_document_id ON account_documents(document_id);
@@ -0,0 +1,5 @@
+-- Deleted documents are hidden at once and kept until the purge task deletes
+-- them for good after the retention period
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_documents_deleted_at ON documents(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,59 @@
+-- Deleted documents leave the counters and the change feed when they are
+-- deleted rather than when they are purged: deleting one is counted and
+-- recorded as its deletion, and purging it later as nothing
+
+-- Writes to documents wait until the counters are rebuilt, so none is
+-- missed or counted twice
+LOCK TABLE documents IN SHARE MODE;
+
+CREATE OR REPLACE FUNCTION count_document_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.deleted_at IS NULL THEN
+        UPDATE document_counts SET documents = documents - 1
+        WHERE tenant_key = COALESCE(OLD.tenant_id::text, '') AND slot = utc_quarter_hour(OLD.created_at)
+          AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.deleted_at IS NULL THEN
+        INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+        VALUES (COALESCE(NEW.tenant_id::text, ''), utc_quarter_hour(NEW.created_at), COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+        ON CONFLICT (tenant_key, slot, status, risk_level) DO UPDATE SET documents = document_counts.documents + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS count_document_updates ON documents;
+CREATE TRIGGER count_document_updates AFTER UPDATE OF tenant_id, created_at, status, fraud_risk_level, deleted_at ON documents
+FOR EACH ROW
+WHEN (OLD.tenant_id IS DISTINCT FROM NEW.tenant_id OR OLD.created_at IS DISTINCT FROM NEW.created_at
+      OR OLD.status IS DISTINCT FROM NEW.status OR OLD.fraud_risk_level IS DISTINCT FROM NEW.fraud_risk_level
+      OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+EXECUTE FUNCTION count_document_change();
+
+DELETE FROM document_counts;
+INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+SELECT COALESCE(tenant_id::text, ''), utc_quarter_hour(created_at), COALESCE(status, ''), COALESCE(fraud_risk_level, ''), COUNT(*)
+FROM documents
+WHERE deleted_at IS NULL
+GROUP BY 1, 2, 3, 4;
+
+CREATE OR REPLACE FUNCTION record_document_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        IF OLD.deleted_at IS NULL THEN
+            INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+            VALUES ('document', OLD.id, OLD.id, OLD.tenant_id, 'delete');
+        END IF;
+    ELSIF TG_OP = 'INSERT' THEN
+        INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+        VALUES ('document', NEW.id, NEW.id, NEW.tenant_id, 'create');
+    ELSIF OLD.deleted_at IS NULL THEN
+        INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+        VALUES ('document', NEW.id, NEW.id, NEW.tenant_id,
+                CASE WHEN NEW.deleted_at IS NULL THEN 'update' ELSE 'delete' END);
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
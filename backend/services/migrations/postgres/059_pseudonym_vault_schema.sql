@@ -0,0 +1,11 @@
+-- The pseudonym vault moves out of the schema of the data it pseudonymizes
+-- into a schema of its own, so access to it is granted separately. Roles
+-- given the tables of the public schema, such as those reporting on or
+-- exporting documents, cannot read the vault; only the backend's role,
+-- which owns it, can until USAGE on the schema and rights on the table are
+-- granted to another.
+CREATE SCHEMA IF NOT EXISTS vault;
+REVOKE ALL ON SCHEMA vault FROM PUBLIC;
+
+ALTER TABLE IF EXISTS pseudonym_vault SET SCHEMA vault;
+REVOKE ALL ON vault.pseudonym_vault FROM PUBLIC;
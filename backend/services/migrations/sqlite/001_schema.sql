@@ -0,0 +1,89 @@
+-- FraudDocAI schema for SQLite (local development and tests)
+-- Mirrors database/init.sql plus the Postgres migrations; JSONB columns are TEXT
+
+CREATE TABLE users (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    email VARCHAR(255) UNIQUE NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    first_name VARCHAR(100) NOT NULL,
+    last_name VARCHAR(100) NOT NULL,
+    role VARCHAR(50) DEFAULT 'user',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE documents (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+    filename VARCHAR(255) NOT NULL,
+    original_filename VARCHAR(255) NOT NULL,
+    file_path VARCHAR(500) NOT NULL,
+    file_size BIGINT NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    document_type VARCHAR(50),
+    status VARCHAR(50) DEFAULT 'uploaded',
+    fraud_score REAL DEFAULT 0.00,
+    fraud_risk_level VARCHAR(20) DEFAULT 'low',
+    extracted_text TEXT,
+    emotion_analysis TEXT,
+    pattern_analysis TEXT,
+    metadata TEXT CHECK (metadata IS NULL OR json_type(metadata) = 'object'),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE fraud_patterns (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    pattern_name VARCHAR(255) NOT NULL,
+    pattern_type VARCHAR(100) NOT NULL,
+    description TEXT,
+    detection_rules TEXT,
+    severity VARCHAR(20) DEFAULT 'medium',
+    is_active BOOLEAN DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE document_fraud_detections (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    document_id TEXT REFERENCES documents(id) ON DELETE CASCADE,
+    fraud_pattern_id TEXT REFERENCES fraud_patterns(id),
+    confidence_score REAL NOT NULL,
+    detection_details TEXT,
+    is_false_positive BOOLEAN DEFAULT 0,
+    reviewed_by TEXT REFERENCES users(id),
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE audit_logs (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    user_id TEXT REFERENCES users(id),
+    action VARCHAR(100) NOT NULL,
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id TEXT,
+    details TEXT,
+    ip_address TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_documents_user_id ON documents(user_id);
+CREATE INDEX idx_documents_status ON documents(status);
+CREATE INDEX idx_documents_fraud_score ON documents(fraud_score);
+CREATE INDEX idx_documents_created_at ON documents(created_at);
+CREATE INDEX idx_document_fraud_detections_document_id ON document_fraud_detections(document_id);
+CREATE INDEX idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity) VALUES
+('Signature Forgery', 'signature_forgery', 'Detects potentially forged signatures on documents', '{"ml_model": "signature_verification", "threshold": 0.8}', 'high'),
+('Amount Tampering', 'amount_tampering', 'Detects altered monetary amounts in documents', '{"pattern_matching": true, "ocr_confidence_threshold": 0.9}', 'critical'),
+('Duplicate Invoice', 'duplicate_invoice', 'Identifies duplicate or near-duplicate invoices', '{"similarity_threshold": 0.95, "check_fields": ["vendor", "amount", "date"]}', 'medium'),
+('Fake Vendor', 'fake_vendor', 'Detects potentially fake vendor information', '{"vendor_verification": true, "domain_check": true}', 'high'),
+('Inconsistent Data', 'inconsistent_data', 'Flags documents with inconsistent information', '{"cross_field_validation": true, "date_consistency": true}', 'medium');
+
+CREATE TRIGGER update_documents_updated_at AFTER UPDATE ON documents FOR EACH ROW
+WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE documents SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
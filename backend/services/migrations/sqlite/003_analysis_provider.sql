@@ -0,0 +1,4 @@
+ALTER TABLE documents ADD COLUMN analysis_provider VARCHAR(50);
+ALTER TABLE documents ADD COLUMN analysis_fallback BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_documents_analysis_fallback ON documents(updated_at) WHERE analysis_fallback;
@@ -0,0 +1,7 @@
+-- Embeddings are stored as JSON arrays; similarity is computed in Go
+CREATE TABLE document_embeddings (
+    document_id TEXT PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    model VARCHAR(255),
+    embedding TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,34 @@
+ALTER TABLE documents ADD COLUMN content_sha256 VARCHAR(64);
+CREATE INDEX idx_documents_content_sha256 ON documents(content_sha256);
+
+CREATE TABLE fraud_exemplars (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id TEXT REFERENCES documents(id) ON DELETE SET NULL,
+    label VARCHAR(255) NOT NULL,
+    notes TEXT,
+    content_sha256 VARCHAR(64),
+    entities TEXT NOT NULL DEFAULT '[]',
+    embedding TEXT,
+    promoted_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_fraud_exemplars_tenant_id ON fraud_exemplars(tenant_id);
+CREATE UNIQUE INDEX idx_fraud_exemplars_document_id ON fraud_exemplars(document_id);
+
+CREATE TABLE alerts (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id TEXT REFERENCES documents(id) ON DELETE CASCADE,
+    exemplar_id TEXT REFERENCES fraud_exemplars(id) ON DELETE SET NULL,
+    kind VARCHAR(50) NOT NULL,
+    severity VARCHAR(20) NOT NULL,
+    score DECIMAL(5,4),
+    details TEXT NOT NULL DEFAULT '{}',
+    acknowledged_by VARCHAR(255),
+    acknowledged_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_alerts_created_at ON alerts(created_at DESC);
@@ -0,0 +1 @@
+ALTER TABLE tenants ADD COLUMN risk_taxonomy TEXT;
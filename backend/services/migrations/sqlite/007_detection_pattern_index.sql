@@ -0,0 +1,2 @@
+CREATE INDEX idx_document_fraud_detections_pattern_created
+    ON document_fraud_detections(fraud_pattern_id, created_at);
@@ -0,0 +1,9 @@
+CREATE TABLE document_entities (
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, kind, value)
+);
+
+CREATE INDEX idx_document_entities_value ON document_entities(kind, value);
@@ -0,0 +1,8 @@
+-- Recorded for links and sender domains found in document text
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Blocklisted Link', 'blocklisted_link', 'Links to or mail from a domain on the URL blocklist', '{"source": "url_reputation", "config": ["URL_BLOCKLIST", "URL_BLOCKLIST_FILE"]}', 'critical'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'blocklisted_link');
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Suspicious Link', 'suspicious_link', 'Links to or mail from a domain imitating a payment, banking or signing site, an internationalized lookalike or a bare IP address', '{"source": "url_reputation", "config": ["URL_PROTECTED_DOMAINS", "URL_LOOKALIKE_DISTANCE"]}', 'high'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'suspicious_link');
@@ -0,0 +1,2 @@
+ALTER TABLE tenants ADD COLUMN storage_region TEXT;
+ALTER TABLE documents ADD COLUMN storage_region TEXT;
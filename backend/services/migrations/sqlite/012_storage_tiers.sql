@@ -0,0 +1,4 @@
+ALTER TABLE documents ADD COLUMN storage_tier TEXT NOT NULL DEFAULT 'hot';
+ALTER TABLE documents ADD COLUMN tier_changed_at TIMESTAMP;
+
+CREATE INDEX idx_documents_storage_tier ON documents(storage_tier, created_at);
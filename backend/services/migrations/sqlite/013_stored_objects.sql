@@ -0,0 +1,8 @@
+CREATE TABLE stored_objects (
+    region TEXT NOT NULL,
+    tier TEXT NOT NULL,
+    object_name TEXT NOT NULL,
+    ref_count INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (region, tier, object_name)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE pipeline_stage_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    run INTEGER NOT NULL,
+    run_started_at TIMESTAMP NOT NULL,
+    stage TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    started_at TIMESTAMP,
+    duration_ms REAL NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX idx_pipeline_stage_runs_document ON pipeline_stage_runs(document_id, run);
+CREATE INDEX idx_pipeline_stage_runs_started ON pipeline_stage_runs(run_started_at, stage);
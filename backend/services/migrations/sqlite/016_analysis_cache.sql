@@ -0,0 +1,13 @@
+CREATE TABLE analysis_cache (
+    cache_key TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    model_version TEXT NOT NULL,
+    response TEXT NOT NULL,
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_analysis_cache_created_at ON analysis_cache(created_at);
+
+ALTER TABLE documents ADD COLUMN analysis_cached BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,41 @@
+CREATE TABLE document_counts (
+    tenant_key TEXT NOT NULL,
+    day TEXT NOT NULL,
+    status TEXT NOT NULL,
+    risk_level TEXT NOT NULL,
+    documents INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_key, day, status, risk_level)
+);
+
+CREATE INDEX idx_document_counts_day ON document_counts(day);
+
+CREATE TRIGGER count_documents_insert AFTER INSERT ON documents FOR EACH ROW
+BEGIN
+    INSERT INTO document_counts (tenant_key, day, status, risk_level, documents)
+    VALUES (COALESCE(NEW.tenant_id, ''), date(NEW.created_at), COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+    ON CONFLICT (tenant_key, day, status, risk_level) DO UPDATE SET documents = documents + 1;
+END;
+
+CREATE TRIGGER count_documents_delete AFTER DELETE ON documents FOR EACH ROW
+BEGIN
+    UPDATE document_counts SET documents = documents - 1
+    WHERE tenant_key = COALESCE(OLD.tenant_id, '') AND day = date(OLD.created_at)
+      AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+END;
+
+CREATE TRIGGER count_documents_update AFTER UPDATE OF tenant_id, created_at, status, fraud_risk_level ON documents FOR EACH ROW
+WHEN OLD.tenant_id IS NOT NEW.tenant_id OR OLD.created_at IS NOT NEW.created_at
+  OR OLD.status IS NOT NEW.status OR OLD.fraud_risk_level IS NOT NEW.fraud_risk_level
+BEGIN
+    UPDATE document_counts SET documents = documents - 1
+    WHERE tenant_key = COALESCE(OLD.tenant_id, '') AND day = date(OLD.created_at)
+      AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+    INSERT INTO document_counts (tenant_key, day, status, risk_level, documents)
+    VALUES (COALESCE(NEW.tenant_id, ''), date(NEW.created_at), COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+    ON CONFLICT (tenant_key, day, status, risk_level) DO UPDATE SET documents = documents + 1;
+END;
+
+INSERT INTO document_counts (tenant_key, day, status, risk_level, documents)
+SELECT COALESCE(tenant_id, ''), date(created_at), COALESCE(status, ''), COALESCE(fraud_risk_level, ''), COUNT(*)
+FROM documents
+GROUP BY 1, 2, 3, 4;
@@ -0,0 +1,34 @@
+CREATE TABLE document_analyses (
+    document_id TEXT PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    emotion_analysis TEXT,
+    pattern_analysis TEXT,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE documents ADD COLUMN pattern_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN dominant_emotion TEXT;
+
+INSERT INTO document_analyses (document_id, emotion_analysis, pattern_analysis, updated_at)
+SELECT id, emotion_analysis, pattern_analysis, updated_at FROM documents
+WHERE emotion_analysis IS NOT NULL OR pattern_analysis IS NOT NULL;
+
+DROP TRIGGER update_documents_updated_at;
+
+UPDATE documents SET
+    pattern_count = COALESCE(json_array_length(pattern_analysis, '$.patterns'), 0),
+    dominant_emotion = (
+        SELECT json_extract(e.value, '$.emotion')
+        FROM json_each(emotion_analysis, '$.emotions') e
+        WHERE json_type(e.value, '$.confidence') IN ('integer', 'real')
+        ORDER BY json_extract(e.value, '$.confidence') DESC
+        LIMIT 1)
+WHERE emotion_analysis IS NOT NULL OR pattern_analysis IS NOT NULL;
+
+CREATE TRIGGER update_documents_updated_at AFTER UPDATE ON documents FOR EACH ROW
+WHEN NEW.updated_at = OLD.updated_at
+BEGIN
+    UPDATE documents SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+END;
+
+ALTER TABLE documents DROP COLUMN emotion_analysis;
+ALTER TABLE documents DROP COLUMN pattern_analysis;
@@ -0,0 +1 @@
+CREATE INDEX idx_documents_updated_at_id ON documents(updated_at, id);
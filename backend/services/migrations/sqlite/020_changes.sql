@@ -0,0 +1,53 @@
+-- Writes are serialized on SQLite, so the feed is read in id order alone and
+-- txid stays 0
+CREATE TABLE changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    txid INTEGER NOT NULL DEFAULT 0,
+    entity TEXT NOT NULL,
+    entity_id TEXT NOT NULL,
+    document_id TEXT,
+    tenant_id TEXT,
+    operation TEXT NOT NULL,
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_changes_tenant ON changes(tenant_id, id);
+CREATE INDEX idx_changes_changed_at ON changes(changed_at);
+
+CREATE TRIGGER record_document_insert AFTER INSERT ON documents FOR EACH ROW
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('document', NEW.id, NEW.id, NEW.tenant_id, 'create');
+END;
+
+-- Updates that leave updated_at alone are followed by the update that sets
+-- it, so they may be recorded twice
+CREATE TRIGGER record_document_update AFTER UPDATE ON documents FOR EACH ROW
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('document', NEW.id, NEW.id, NEW.tenant_id, 'update');
+END;
+
+CREATE TRIGGER record_document_delete AFTER DELETE ON documents FOR EACH ROW
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('document', OLD.id, OLD.id, OLD.tenant_id, 'delete');
+END;
+
+CREATE TRIGGER record_detection_insert AFTER INSERT ON document_fraud_detections FOR EACH ROW
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('detection', NEW.id, NEW.document_id, (SELECT tenant_id FROM documents WHERE id = NEW.document_id), 'create');
+END;
+
+CREATE TRIGGER record_detection_update AFTER UPDATE ON document_fraud_detections FOR EACH ROW
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('detection', NEW.id, NEW.document_id, (SELECT tenant_id FROM documents WHERE id = NEW.document_id), 'update');
+END;
+
+CREATE TRIGGER record_detection_delete AFTER DELETE ON document_fraud_detections FOR EACH ROW
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('detection', OLD.id, OLD.document_id, (SELECT tenant_id FROM documents WHERE id = OLD.document_id), 'delete');
+END;
@@ -0,0 +1,19 @@
+CREATE TABLE review_delegations (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    delegator_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    delegate_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at),
+    CHECK (delegate_id <> delegator_id)
+);
+
+CREATE INDEX idx_review_delegations_delegator ON review_delegations(delegator_id, ends_at);
+CREATE INDEX idx_review_delegations_delegate ON review_delegations(delegate_id, ends_at);
+
+ALTER TABLE alerts ADD COLUMN assigned_to TEXT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN original_assignee TEXT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE alerts ADD COLUMN assigned_at TIMESTAMP;
+CREATE INDEX idx_alerts_assigned_to ON alerts(assigned_to) WHERE acknowledged_at IS NULL;
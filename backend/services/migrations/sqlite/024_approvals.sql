@@ -0,0 +1,16 @@
+CREATE TABLE approvals (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    action TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    requested_by TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    approver_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    decided_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_approvals_pending_target ON approvals(action, target_id) WHERE status = 'pending';
+CREATE INDEX idx_approvals_status ON approvals(status, created_at);
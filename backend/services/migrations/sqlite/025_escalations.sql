@@ -0,0 +1,17 @@
+ALTER TABLE tenants ADD COLUMN escalation_chain TEXT;
+
+ALTER TABLE alerts ADD COLUMN escalation_level INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alerts ADD COLUMN escalated_at TIMESTAMP;
+
+CREATE TABLE alert_escalations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    alert_id TEXT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    level INTEGER NOT NULL,
+    step_name TEXT NOT NULL,
+    from_user TEXT REFERENCES users(id) ON DELETE SET NULL,
+    to_user TEXT REFERENCES users(id) ON DELETE SET NULL,
+    escalated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_alert_escalations_alert_id ON alert_escalations(alert_id, level);
+CREATE INDEX idx_alerts_open ON alerts(created_at) WHERE acknowledged_at IS NULL;
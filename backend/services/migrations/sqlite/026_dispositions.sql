@@ -0,0 +1,12 @@
+ALTER TABLE tenants ADD COLUMN disposition_taxonomy TEXT;
+
+ALTER TABLE alerts ADD COLUMN disposition TEXT;
+ALTER TABLE alerts ADD COLUMN disposition_outcome TEXT;
+
+ALTER TABLE document_fraud_detections ADD COLUMN disposition TEXT;
+ALTER TABLE document_fraud_detections ADD COLUMN disposition_outcome TEXT;
+
+ALTER TABLE approvals ADD COLUMN disposition TEXT;
+ALTER TABLE approvals ADD COLUMN disposition_outcome TEXT;
+
+CREATE INDEX idx_document_fraud_detections_reviewed_at ON document_fraud_detections(reviewed_at) WHERE reviewed_at IS NOT NULL;
@@ -0,0 +1,12 @@
+CREATE TABLE sar_drafts (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    alert_id TEXT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    report TEXT NOT NULL,
+    generated_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (alert_id, version)
+);
+
+CREATE INDEX idx_sar_drafts_tenant_id ON sar_drafts(tenant_id);
@@ -0,0 +1,31 @@
+CREATE TABLE document_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id TEXT NOT NULL,
+    tenant_id TEXT,
+    sequence INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    data TEXT,
+    data_sha256 TEXT NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    prev_hash TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    redacted_at TIMESTAMP,
+    UNIQUE (document_id, sequence)
+);
+
+CREATE INDEX idx_document_events_tenant ON document_events(tenant_id, id);
+
+-- Redacting data is the only update allowed
+CREATE TRIGGER document_events_no_update BEFORE UPDATE ON document_events
+WHEN NOT (OLD.data IS NOT NULL AND NEW.data IS NULL AND NEW.redacted_at IS NOT NULL
+          AND NEW.id IS OLD.id AND NEW.document_id IS OLD.document_id AND NEW.tenant_id IS OLD.tenant_id
+          AND NEW.sequence IS OLD.sequence AND NEW.type IS OLD.type AND NEW.data_sha256 IS OLD.data_sha256
+          AND NEW.occurred_at IS OLD.occurred_at AND NEW.prev_hash IS OLD.prev_hash AND NEW.hash IS OLD.hash)
+BEGIN
+    SELECT RAISE(ABORT, 'document_events is append-only');
+END;
+
+CREATE TRIGGER document_events_no_delete BEFORE DELETE ON document_events
+BEGIN
+    SELECT RAISE(ABORT, 'document_events is append-only');
+END;
@@ -0,0 +1,30 @@
+CREATE TABLE legal_holds (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    placed_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    placed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    released_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    released_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_legal_holds_active ON legal_holds(document_id) WHERE released_at IS NULL;
+CREATE INDEX idx_legal_holds_tenant_id ON legal_holds(tenant_id, placed_at);
+
+CREATE TABLE privacy_requests (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    subject_sha256 TEXT NOT NULL,
+    requested_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    documents INTEGER NOT NULL DEFAULT 0,
+    erased INTEGER NOT NULL DEFAULT 0,
+    held INTEGER NOT NULL DEFAULT 0,
+    verified BOOLEAN,
+    details TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX idx_privacy_requests_tenant_id ON privacy_requests(tenant_id, created_at);
@@ -0,0 +1,8 @@
+CREATE TABLE pseudonym_vault (
+    token TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_pseudonym_vault_value ON pseudonym_vault(kind, value);
@@ -0,0 +1,27 @@
+CREATE TABLE question_sets (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    questions TEXT NOT NULL,
+    prompt_template TEXT,
+    created_by VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, version)
+);
+
+CREATE TABLE fraud_qa_analyses (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    document_id TEXT REFERENCES documents(id) ON DELETE CASCADE,
+    question_set_id TEXT REFERENCES question_sets(id) ON DELETE SET NULL,
+    question_set_version INTEGER,
+    text_sha256 VARCHAR(64) NOT NULL,
+    overall_risk VARCHAR(20) NOT NULL,
+    total_risk_score DECIMAL(6,4) NOT NULL,
+    model_used VARCHAR(255),
+    fraud_analysis TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_fraud_qa_analyses_tenant_id ON fraud_qa_analyses(tenant_id);
+CREATE INDEX idx_fraud_qa_analyses_document_id ON fraud_qa_analyses(document_id);
@@ -0,0 +1 @@
+ALTER TABLE tenants ADD COLUMN document_fields TEXT;
@@ -0,0 +1,5 @@
+ALTER TABLE tenants ADD COLUMN approval_policy TEXT;
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Approval Outside Policy', 'approval_outside_policy', 'Approved by someone below the level the customer''s approval policy requires for the amount, or by an approver the policy does not know', '{"source": "approval_policy", "metadata": ["approved_by", "approver_level"]}', 'high'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'approval_outside_policy');
@@ -0,0 +1,15 @@
+CREATE TABLE document_submissions (
+    document_id TEXT PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    user_id TEXT REFERENCES users(id) ON DELETE SET NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    country VARCHAR(2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_document_submissions_user_id ON document_submissions(user_id, created_at);
+CREATE INDEX idx_audit_logs_resource ON audit_logs(resource_type, resource_id);
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Multi-Country Submissions', 'multi_country_submission', 'Submitted by a user who submitted documents from other countries within hours', '{"source": "submission_velocity", "data": ["ip_address", "country"]}', 'medium'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'multi_country_submission');
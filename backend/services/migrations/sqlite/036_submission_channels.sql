@@ -0,0 +1,8 @@
+ALTER TABLE document_submissions ADD COLUMN channel VARCHAR(20) NOT NULL DEFAULT 'api';
+ALTER TABLE document_submissions ADD COLUMN fingerprint VARCHAR(64);
+ALTER TABLE document_submissions ADD COLUMN user_agent TEXT;
+
+CREATE INDEX idx_document_submissions_channel ON document_submissions(channel);
+CREATE INDEX idx_document_submissions_fingerprint ON document_submissions(fingerprint);
+
+ALTER TABLE tenants ADD COLUMN channel_weights TEXT;
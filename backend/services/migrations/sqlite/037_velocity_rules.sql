@@ -0,0 +1,25 @@
+ALTER TABLE tenants ADD COLUMN velocity_rules TEXT;
+
+CREATE TABLE velocity_events (
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    rule_name VARCHAR(100) NOT NULL,
+    group_key TEXT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    amount REAL NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, rule_name)
+);
+
+CREATE TABLE velocity_counters (
+    tenant_id TEXT NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    rule_name VARCHAR(100) NOT NULL,
+    group_key TEXT NOT NULL,
+    bucket_start TIMESTAMP NOT NULL,
+    documents INTEGER NOT NULL DEFAULT 0,
+    amount REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, rule_name, group_key, bucket_start)
+);
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Velocity Spike', 'velocity_spike', 'Took a user, a vendor or the tenant over the documents or amount its velocity rules allow within a window', '{"source": "velocity_rules"}', 'medium'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'velocity_spike');
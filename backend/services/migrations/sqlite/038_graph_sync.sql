@@ -0,0 +1,8 @@
+CREATE TABLE graph_sync_state (
+    target VARCHAR(50) PRIMARY KEY,
+    cursor VARCHAR(50),
+    full_synced_at TIMESTAMP,
+    synced_at TIMESTAMP,
+    documents INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT
+);
@@ -0,0 +1,3 @@
+ALTER TABLE webhook_events ADD COLUMN alert_id TEXT;
+
+CREATE INDEX idx_webhook_events_alert ON webhook_events(alert_id) WHERE alert_id IS NOT NULL;
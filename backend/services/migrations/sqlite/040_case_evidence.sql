@@ -0,0 +1,18 @@
+CREATE TABLE case_evidence (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    alert_id TEXT NOT NULL REFERENCES alerts(id) ON DELETE CASCADE,
+    filename TEXT NOT NULL,
+    object_name TEXT NOT NULL,
+    storage_region TEXT,
+    mime_type TEXT NOT NULL,
+    file_size INTEGER NOT NULL,
+    sha256 TEXT NOT NULL,
+    description TEXT,
+    uploaded_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (alert_id, sha256)
+);
+
+CREATE INDEX idx_case_evidence_tenant_id ON case_evidence(tenant_id);
+CREATE INDEX idx_case_evidence_object_name ON case_evidence(object_name);
@@ -0,0 +1,2 @@
+ALTER TABLE tenants ADD COLUMN language VARCHAR(35);
+ALTER TABLE users ADD COLUMN language VARCHAR(35);
@@ -0,0 +1,53 @@
+ALTER TABLE tenants ADD COLUMN time_zone VARCHAR(64);
+
+DROP TRIGGER count_documents_insert;
+DROP TRIGGER count_documents_delete;
+DROP TRIGGER count_documents_update;
+DROP TABLE document_counts;
+
+CREATE TABLE document_counts (
+    tenant_key TEXT NOT NULL,
+    slot TEXT NOT NULL,
+    status TEXT NOT NULL,
+    risk_level TEXT NOT NULL,
+    documents INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_key, slot, status, risk_level)
+);
+
+CREATE INDEX idx_document_counts_slot ON document_counts(slot);
+
+CREATE TRIGGER count_documents_insert AFTER INSERT ON documents FOR EACH ROW
+BEGIN
+    INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+    VALUES (COALESCE(NEW.tenant_id, ''), strftime('%Y-%m-%d %H:', NEW.created_at) || printf('%02d', CAST(strftime('%M', NEW.created_at) AS INTEGER) / 15 * 15) || ':00',
+            COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+    ON CONFLICT (tenant_key, slot, status, risk_level) DO UPDATE SET documents = documents + 1;
+END;
+
+CREATE TRIGGER count_documents_delete AFTER DELETE ON documents FOR EACH ROW
+BEGIN
+    UPDATE document_counts SET documents = documents - 1
+    WHERE tenant_key = COALESCE(OLD.tenant_id, '')
+      AND slot = strftime('%Y-%m-%d %H:', OLD.created_at) || printf('%02d', CAST(strftime('%M', OLD.created_at) AS INTEGER) / 15 * 15) || ':00'
+      AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+END;
+
+CREATE TRIGGER count_documents_update AFTER UPDATE OF tenant_id, created_at, status, fraud_risk_level ON documents FOR EACH ROW
+WHEN OLD.tenant_id IS NOT NEW.tenant_id OR OLD.created_at IS NOT NEW.created_at
+  OR OLD.status IS NOT NEW.status OR OLD.fraud_risk_level IS NOT NEW.fraud_risk_level
+BEGIN
+    UPDATE document_counts SET documents = documents - 1
+    WHERE tenant_key = COALESCE(OLD.tenant_id, '')
+      AND slot = strftime('%Y-%m-%d %H:', OLD.created_at) || printf('%02d', CAST(strftime('%M', OLD.created_at) AS INTEGER) / 15 * 15) || ':00'
+      AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+    INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+    VALUES (COALESCE(NEW.tenant_id, ''), strftime('%Y-%m-%d %H:', NEW.created_at) || printf('%02d', CAST(strftime('%M', NEW.created_at) AS INTEGER) / 15 * 15) || ':00',
+            COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+    ON CONFLICT (tenant_key, slot, status, risk_level) DO UPDATE SET documents = documents + 1;
+END;
+
+INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+SELECT COALESCE(tenant_id, ''), strftime('%Y-%m-%d %H:', created_at) || printf('%02d', CAST(strftime('%M', created_at) AS INTEGER) / 15 * 15) || ':00',
+       COALESCE(status, ''), COALESCE(fraud_risk_level, ''), COUNT(*)
+FROM documents
+GROUP BY 1, 2, 3, 4;
@@ -0,0 +1,24 @@
+ALTER TABLE tenants ADD COLUMN base_currency VARCHAR(3);
+
+CREATE TABLE fx_rates (
+    day TEXT NOT NULL,
+    base VARCHAR(3) NOT NULL,
+    quote VARCHAR(3) NOT NULL,
+    rate REAL NOT NULL,
+    published TEXT NOT NULL,
+    fetched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (day, base, quote)
+);
+
+CREATE TABLE document_amounts (
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    field VARCHAR(64) NOT NULL,
+    amount REAL NOT NULL,
+    currency TEXT NOT NULL,
+    base_amount REAL,
+    base_currency VARCHAR(3) NOT NULL,
+    rate REAL,
+    rate_day TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, field)
+);
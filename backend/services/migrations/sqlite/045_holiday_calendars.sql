@@ -0,0 +1,91 @@
+ALTER TABLE tenants ADD COLUMN holiday_calendar VARCHAR(32);
+
+CREATE TABLE holiday_calendars (
+    code VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    country VARCHAR(2) NOT NULL,
+    weekend VARCHAR(32) NOT NULL DEFAULT 'sat,sun',
+    business_start VARCHAR(5) NOT NULL DEFAULT '09:00',
+    business_end VARCHAR(5) NOT NULL DEFAULT '17:00',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE holidays (
+    calendar_code VARCHAR(32) NOT NULL REFERENCES holiday_calendars(code) ON DELETE CASCADE,
+    day TEXT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    PRIMARY KEY (calendar_code, day)
+);
+
+INSERT INTO holiday_calendars (code, name, country) VALUES
+    ('US', 'United States (federal)', 'US'),
+    ('GB-EAW', 'United Kingdom (England and Wales)', 'GB'),
+    ('DE', 'Germany (nationwide)', 'DE');
+
+INSERT INTO holidays (calendar_code, day, name) VALUES
+    ('US', '2026-01-01', 'New Year''s Day'),
+    ('US', '2026-01-19', 'Martin Luther King Jr. Day'),
+    ('US', '2026-02-16', 'Washington''s Birthday'),
+    ('US', '2026-05-25', 'Memorial Day'),
+    ('US', '2026-06-19', 'Juneteenth'),
+    ('US', '2026-07-03', 'Independence Day (observed)'),
+    ('US', '2026-09-07', 'Labor Day'),
+    ('US', '2026-10-12', 'Columbus Day'),
+    ('US', '2026-11-11', 'Veterans Day'),
+    ('US', '2026-11-26', 'Thanksgiving Day'),
+    ('US', '2026-12-25', 'Christmas Day'),
+    ('US', '2027-01-01', 'New Year''s Day'),
+    ('US', '2027-01-18', 'Martin Luther King Jr. Day'),
+    ('US', '2027-02-15', 'Washington''s Birthday'),
+    ('US', '2027-05-31', 'Memorial Day'),
+    ('US', '2027-06-18', 'Juneteenth (observed)'),
+    ('US', '2027-07-05', 'Independence Day (observed)'),
+    ('US', '2027-09-06', 'Labor Day'),
+    ('US', '2027-10-11', 'Columbus Day'),
+    ('US', '2027-11-11', 'Veterans Day'),
+    ('US', '2027-11-25', 'Thanksgiving Day'),
+    ('US', '2027-12-24', 'Christmas Day (observed)'),
+    ('US', '2027-12-31', 'New Year''s Day (observed)');
+
+INSERT INTO holidays (calendar_code, day, name) VALUES
+    ('GB-EAW', '2026-01-01', 'New Year''s Day'),
+    ('GB-EAW', '2026-04-03', 'Good Friday'),
+    ('GB-EAW', '2026-04-06', 'Easter Monday'),
+    ('GB-EAW', '2026-05-04', 'Early May bank holiday'),
+    ('GB-EAW', '2026-05-25', 'Spring bank holiday'),
+    ('GB-EAW', '2026-08-31', 'Summer bank holiday'),
+    ('GB-EAW', '2026-12-25', 'Christmas Day'),
+    ('GB-EAW', '2026-12-28', 'Boxing Day (substitute day)'),
+    ('GB-EAW', '2027-01-01', 'New Year''s Day'),
+    ('GB-EAW', '2027-03-26', 'Good Friday'),
+    ('GB-EAW', '2027-03-29', 'Easter Monday'),
+    ('GB-EAW', '2027-05-03', 'Early May bank holiday'),
+    ('GB-EAW', '2027-05-31', 'Spring bank holiday'),
+    ('GB-EAW', '2027-08-30', 'Summer bank holiday'),
+    ('GB-EAW', '2027-12-27', 'Christmas Day (substitute day)'),
+    ('GB-EAW', '2027-12-28', 'Boxing Day (substitute day)');
+
+INSERT INTO holidays (calendar_code, day, name) VALUES
+    ('DE', '2026-01-01', 'Neujahr'),
+    ('DE', '2026-04-03', 'Karfreitag'),
+    ('DE', '2026-04-06', 'Ostermontag'),
+    ('DE', '2026-05-01', 'Tag der Arbeit'),
+    ('DE', '2026-05-14', 'Christi Himmelfahrt'),
+    ('DE', '2026-05-25', 'Pfingstmontag'),
+    ('DE', '2026-10-03', 'Tag der Deutschen Einheit'),
+    ('DE', '2026-12-25', '1. Weihnachtstag'),
+    ('DE', '2026-12-26', '2. Weihnachtstag'),
+    ('DE', '2027-01-01', 'Neujahr'),
+    ('DE', '2027-03-26', 'Karfreitag'),
+    ('DE', '2027-03-29', 'Ostermontag'),
+    ('DE', '2027-05-01', 'Tag der Arbeit'),
+    ('DE', '2027-05-06', 'Christi Himmelfahrt'),
+    ('DE', '2027-05-17', 'Pfingstmontag'),
+    ('DE', '2027-10-03', 'Tag der Deutschen Einheit'),
+    ('DE', '2027-12-25', '1. Weihnachtstag'),
+    ('DE', '2027-12-26', '2. Weihnachtstag');
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Non-Business Day Date', 'non_business_day_date', 'Dated on a weekend or public holiday of the customer''s holiday calendar, when businesses seldom issue documents', '{"source": "holiday_calendar"}', 'low'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'non_business_day_date');
@@ -0,0 +1,13 @@
+CREATE TABLE analysis_observations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id TEXT REFERENCES documents(id) ON DELETE SET NULL,
+    provider TEXT NOT NULL,
+    model_version TEXT NOT NULL DEFAULT '',
+    fallback BOOLEAN NOT NULL DEFAULT 0,
+    score REAL NOT NULL,
+    confidence REAL,
+    patterns INTEGER NOT NULL,
+    analyzed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_analysis_observations_analyzed_at ON analysis_observations(analyzed_at);
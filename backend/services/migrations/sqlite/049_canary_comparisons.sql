@@ -0,0 +1,15 @@
+CREATE TABLE canary_comparisons (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    document_id TEXT REFERENCES documents(id) ON DELETE SET NULL,
+    stable_version TEXT NOT NULL DEFAULT '',
+    canary_version TEXT NOT NULL,
+    stable_score REAL NOT NULL,
+    stable_risk_level TEXT NOT NULL,
+    canary_score REAL,
+    canary_risk_level TEXT,
+    canary_latency_ms INTEGER NOT NULL,
+    error TEXT,
+    compared_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_canary_comparisons_compared_at ON canary_comparisons(compared_at);
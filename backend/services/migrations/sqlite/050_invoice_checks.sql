@@ -0,0 +1,12 @@
+-- Patterns recorded by the invoice checks of the rules stage
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Total Mismatch', 'total_mismatch', 'Line items, subtotal, taxes and total of an invoice or receipt that do not add up, as when a total is tampered with', '{"source": "invoice_checks"}', 'high'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'total_mismatch');
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Duplicate Invoice Number', 'duplicate_invoice_number', 'An invoice number already received from the same vendor, as when an invoice is submitted twice for payment', '{"source": "invoice_checks"}', 'medium'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'duplicate_invoice_number');
+
+INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity)
+SELECT 'Bank Details Change', 'bank_details_change', 'Payment to an IBAN the vendor''s earlier documents did not use, as when a fraudster impersonates a supplier', '{"source": "invoice_checks"}', 'high'
+WHERE NOT EXISTS (SELECT 1 FROM fraud_patterns WHERE pattern_type = 'bank_details_change');
@@ -0,0 +1,6 @@
+CREATE TABLE log_level_overrides (
+    component TEXT PRIMARY KEY,
+    level TEXT NOT NULL,
+    expires_at TIMESTAMP,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,14 @@
+CREATE TABLE document_pages (
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    page INTEGER NOT NULL,
+    source TEXT NOT NULL,
+    confidence REAL NOT NULL,
+    status TEXT NOT NULL,
+    error TEXT,
+    text_start INTEGER NOT NULL,
+    text_end INTEGER NOT NULL,
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    reocr_count INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (document_id, page)
+);
@@ -0,0 +1,39 @@
+CREATE TABLE accounts (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))),
+    tenant_id TEXT REFERENCES tenants(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL,
+    identifier TEXT NOT NULL,
+    statements INTEGER NOT NULL DEFAULT 0,
+    last_document_id TEXT REFERENCES documents(id) ON DELETE SET NULL,
+    risk_score REAL,
+    findings INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (tenant_id, kind, identifier)
+);
+
+CREATE TABLE account_statements (
+    document_id TEXT PRIMARY KEY REFERENCES documents(id) ON DELETE CASCADE,
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    previous_document_id TEXT REFERENCES documents(id) ON DELETE SET NULL,
+    continuity TEXT NOT NULL,
+    segments INTEGER NOT NULL,
+    new_segments INTEGER NOT NULL,
+    analyzed_bytes INTEGER NOT NULL,
+    period_start TEXT,
+    period_end TEXT,
+    opening_amount REAL,
+    closing_amount REAL,
+    fraud_score REAL,
+    pattern_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_account_statements_account_id ON account_statements(account_id, created_at);
+
+CREATE TABLE account_segments (
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    digest TEXT NOT NULL,
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    PRIMARY KEY (account_id, digest)
+);
@@ -0,0 +1,14 @@
+ALTER TABLE accounts ADD COLUMN documents INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE account_documents (
+    account_id TEXT NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+    document_id TEXT NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    fraud_score REAL NOT NULL,
+    risk_level TEXT NOT NULL,
+    pattern_count INTEGER NOT NULL DEFAULT 0,
+    observed_at TIMESTAMP NOT NULL,
+    analyzed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (account_id, document_id)
+);
+
+CREATE INDEX idx_account_documents_document_id ON account_documents(document_id);
@@ -0,0 +1,3 @@
+ALTER TABLE documents ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_documents_deleted_at ON documents(deleted_at) WHERE deleted_at IS NOT NULL;
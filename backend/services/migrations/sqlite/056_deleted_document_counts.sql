@@ -0,0 +1,67 @@
+-- Deleted documents leave the counters and the change feed when they are
+-- deleted rather than when they are purged: deleting one is counted and
+-- recorded as its deletion, and purging it later as nothing
+DROP TRIGGER count_documents_insert;
+DROP TRIGGER count_documents_delete;
+DROP TRIGGER count_documents_update;
+DROP TRIGGER record_document_update;
+DROP TRIGGER record_document_delete;
+
+CREATE TRIGGER count_documents_insert AFTER INSERT ON documents FOR EACH ROW
+WHEN NEW.deleted_at IS NULL
+BEGIN
+    INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+    VALUES (COALESCE(NEW.tenant_id, ''), strftime('%Y-%m-%d %H:', NEW.created_at) || printf('%02d', CAST(strftime('%M', NEW.created_at) AS INTEGER) / 15 * 15) || ':00',
+            COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1)
+    ON CONFLICT (tenant_key, slot, status, risk_level) DO UPDATE SET documents = documents + 1;
+END;
+
+CREATE TRIGGER count_documents_delete AFTER DELETE ON documents FOR EACH ROW
+WHEN OLD.deleted_at IS NULL
+BEGIN
+    UPDATE document_counts SET documents = documents - 1
+    WHERE tenant_key = COALESCE(OLD.tenant_id, '')
+      AND slot = strftime('%Y-%m-%d %H:', OLD.created_at) || printf('%02d', CAST(strftime('%M', OLD.created_at) AS INTEGER) / 15 * 15) || ':00'
+      AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+END;
+
+-- Each half only runs for a document that is not deleted on that side
+CREATE TRIGGER count_documents_update AFTER UPDATE OF tenant_id, created_at, status, fraud_risk_level, deleted_at ON documents FOR EACH ROW
+WHEN OLD.tenant_id IS NOT NEW.tenant_id OR OLD.created_at IS NOT NEW.created_at
+  OR OLD.status IS NOT NEW.status OR OLD.fraud_risk_level IS NOT NEW.fraud_risk_level
+  OR OLD.deleted_at IS NOT NEW.deleted_at
+BEGIN
+    UPDATE document_counts SET documents = documents - 1
+    WHERE OLD.deleted_at IS NULL AND tenant_key = COALESCE(OLD.tenant_id, '')
+      AND slot = strftime('%Y-%m-%d %H:', OLD.created_at) || printf('%02d', CAST(strftime('%M', OLD.created_at) AS INTEGER) / 15 * 15) || ':00'
+      AND status = COALESCE(OLD.status, '') AND risk_level = COALESCE(OLD.fraud_risk_level, '');
+    INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+    SELECT COALESCE(NEW.tenant_id, ''), strftime('%Y-%m-%d %H:', NEW.created_at) || printf('%02d', CAST(strftime('%M', NEW.created_at) AS INTEGER) / 15 * 15) || ':00',
+           COALESCE(NEW.status, ''), COALESCE(NEW.fraud_risk_level, ''), 1
+    WHERE NEW.deleted_at IS NULL
+    ON CONFLICT (tenant_key, slot, status, risk_level) DO UPDATE SET documents = documents + 1;
+END;
+
+DELETE FROM document_counts;
+INSERT INTO document_counts (tenant_key, slot, status, risk_level, documents)
+SELECT COALESCE(tenant_id, ''), strftime('%Y-%m-%d %H:', created_at) || printf('%02d', CAST(strftime('%M', created_at) AS INTEGER) / 15 * 15) || ':00',
+       COALESCE(status, ''), COALESCE(fraud_risk_level, ''), COUNT(*)
+FROM documents
+WHERE deleted_at IS NULL
+GROUP BY 1, 2, 3, 4;
+
+-- Updates that leave updated_at alone are followed by the update that sets
+-- it, so they may be recorded twice
+CREATE TRIGGER record_document_update AFTER UPDATE ON documents FOR EACH ROW
+WHEN OLD.deleted_at IS NULL
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('document', NEW.id, NEW.id, NEW.tenant_id, CASE WHEN NEW.deleted_at IS NULL THEN 'update' ELSE 'delete' END);
+END;
+
+CREATE TRIGGER record_document_delete AFTER DELETE ON documents FOR EACH ROW
+WHEN OLD.deleted_at IS NULL
+BEGIN
+    INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+    VALUES ('document', OLD.id, OLD.id, OLD.tenant_id, 'delete');
+END;
@@ -4,32 +4,51 @@ import (
     "context"
     "fmt"
     "io"
-    "log"
+    "strings"
+    "time"
 
     "frauddocai-backend/config"
+    "frauddocai-backend/logging"
     "github.com/minio/minio-go/v7"
     "github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 type MinIOService struct {
-    client *minio.Client
-    bucket string
+    client    *minio.Client
+    bucket    string
+    publicURL string
 }
 
-func NewMinIOService() (*MinIOService, error) {
-    cfg := config.GetMinIOConfig()
-    
+func NewMinIOService(cfg config.MinIOConfig, secrets *Secrets) (*MinIOService, error) {
+    creds := credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, "")
+    if secrets.IsReference(cfg.AccessKeyID) || secrets.IsReference(cfg.SecretAccessKey) {
+        creds = credentials.New(&secretCredentials{
+            secrets:   secrets,
+            accessKey: cfg.AccessKeyID,
+            secretKey: cfg.SecretAccessKey,
+        })
+    }
+
     client, err := minio.New(cfg.Endpoint, &minio.Options{
-        Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+        Creds:  creds,
         Secure: cfg.UseSSL,
     })
     if err != nil {
         return nil, err
     }
 
+    publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+    if publicURL == "" {
+        publicURL = "http://" + cfg.Endpoint
+        if cfg.UseSSL {
+            publicURL = "https://" + cfg.Endpoint
+        }
+    }
+
     service := &MinIOService{
-        client: client,
-        bucket: cfg.BucketName,
+        client:    client,
+        bucket:    cfg.BucketName,
+        publicURL: publicURL,
     }
 
     // Create bucket if it doesn't exist
@@ -44,27 +63,118 @@ func NewMinIOService() (*MinIOService, error) {
         if err != nil {
             return nil, err
         }
-        log.Printf("Created bucket: %s", cfg.BucketName)
+        logging.Storage.Infof("Created bucket: %s", cfg.BucketName)
     }
 
+    secrets.Subscribe("storage:"+cfg.BucketName, service.reloadCredentials(creds), cfg.AccessKeyID, cfg.SecretAccessKey)
     return service, nil
 }
 
+// reloadCredentials makes the client sign requests with rotated keys at once
+// instead of when the cached keys expire, and checks that the new keys are
+// accepted. Connections are not tied to the keys and are kept.
+func (m *MinIOService) reloadCredentials(creds *credentials.Credentials) func(ctx context.Context) error {
+    return func(ctx context.Context) error {
+        creds.Expire()
+        if _, err := m.client.BucketExists(ctx, m.bucket); err != nil {
+            return fmt.Errorf("rotated keys were rejected: %v", err)
+        }
+        logging.Storage.Infof("Storage bucket %s switched to rotated credentials", m.bucket)
+        return nil
+    }
+}
+
+// secretCredentials resolves the access keys through the secrets cache and
+// retrieves them again once the cache TTL has passed, so rotated keys are
+// picked up without a restart
+type secretCredentials struct {
+    secrets   *Secrets
+    accessKey string
+    secretKey string
+    expiry    time.Time
+}
+
+func (p *secretCredentials) Retrieve() (credentials.Value, error) {
+    return p.RetrieveWithCredContext(nil)
+}
+
+func (p *secretCredentials) RetrieveWithCredContext(_ *credentials.CredContext) (credentials.Value, error) {
+    ctx := context.Background()
+    accessKey, err := p.secrets.Resolve(ctx, p.accessKey)
+    if err != nil {
+        return credentials.Value{}, err
+    }
+    secretKey, err := p.secrets.Resolve(ctx, p.secretKey)
+    if err != nil {
+        return credentials.Value{}, err
+    }
+    p.expiry = time.Now().Add(p.secrets.ttl)
+    return credentials.Value{
+        AccessKeyID:     accessKey,
+        SecretAccessKey: secretKey,
+        SignerType:      credentials.SignatureV4,
+    }, nil
+}
+
+func (p *secretCredentials) IsExpired() bool {
+    return time.Now().After(p.expiry)
+}
+
 func (m *MinIOService) UploadFile(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error {
+    started := time.Now()
     _, err := m.client.PutObject(ctx, m.bucket, objectName, reader, size, minio.PutObjectOptions{
         ContentType: contentType,
     })
+    m.logOperation("put", objectName, started, err)
     return err
 }
 
-func (m *MinIOService) GetFile(ctx context.Context, objectName string) (*minio.Object, error) {
-    return m.client.GetObject(ctx, m.bucket, objectName, minio.GetObjectOptions{})
+func (m *MinIOService) GetFile(ctx context.Context, objectName string) (io.ReadCloser, error) {
+    started := time.Now()
+    object, err := m.client.GetObject(ctx, m.bucket, objectName, minio.GetObjectOptions{})
+    m.logOperation("get", objectName, started, err)
+    return object, err
 }
 
 func (m *MinIOService) DeleteFile(ctx context.Context, objectName string) error {
-    return m.client.RemoveObject(ctx, m.bucket, objectName, minio.RemoveObjectOptions{})
+    started := time.Now()
+    err := m.client.RemoveObject(ctx, m.bucket, objectName, minio.RemoveObjectOptions{})
+    m.logOperation("delete", objectName, started, err)
+    return err
+}
+
+// logOperation writes an object operation to the storage debug log
+func (m *MinIOService) logOperation(operation, objectName string, started time.Time, err error) {
+    if err != nil {
+        logging.Storage.Debugf("%s %s/%s failed after %v: %v", operation, m.bucket, objectName, time.Since(started).Round(time.Millisecond), err)
+        return
+    }
+    logging.Storage.Debugf("%s %s/%s in %v", operation, m.bucket, objectName, time.Since(started).Round(time.Millisecond))
+}
+
+func (m *MinIOService) ListFiles(ctx context.Context, fn func(StoredObject) error) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    for object := range m.client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Recursive: true}) {
+        if object.Err != nil {
+            return object.Err
+        }
+        err := fn(StoredObject{
+            Name:         object.Key,
+            Size:         object.Size,
+            ContentType:  object.ContentType,
+            LastModified: object.LastModified,
+        })
+        if err != nil {
+            return err
+        }
+    }
+    return nil
 }
 
+// GetFileURL links to an object through the store's public URL, so links
+// work for clients outside the network the backend reaches the store on
 func (m *MinIOService) GetFileURL(objectName string) string {
-    return fmt.Sprintf("http://localhost:9000/%s/%s", m.bucket, objectName)
+    return fmt.Sprintf("%s/%s/%s", m.publicURL, m.bucket, objectName)
 }
\ No newline at end of file
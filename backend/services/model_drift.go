@@ -0,0 +1,334 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// scoreBuckets is the number of equal-width fraud score ranges a score
+// distribution is counted in
+const scoreBuckets = 10
+
+// Measures of a model version that can drift
+const (
+	DriftScore         = "score_distribution"
+	DriftConfidence    = "confidence"
+	DriftDetectionRate = "detection_rate"
+)
+
+// ModelKey is a model version of an analyzer provider. Fallback analyses
+// carry the fallback analyzer's provider and version.
+type ModelKey struct {
+	Provider     string `json:"provider"`
+	ModelVersion string `json:"model_version"`
+}
+
+// ModelStats summarizes a model version's analyses in a period: the
+// distribution of its fraud scores, before channel weights, in ranges of
+// 0.1, the mean confidence of the patterns it found, and the share of
+// documents it found patterns in. MeanConfidence is nil when no patterns
+// were found.
+type ModelStats struct {
+	Documents      int      `json:"documents"`
+	MeanScore      float64  `json:"mean_score"`
+	ScoreHistogram []int    `json:"score_histogram"`
+	MeanConfidence *float64 `json:"mean_confidence"`
+	DetectionRate  float64  `json:"detection_rate"`
+
+	scoreSum      float64
+	confidenceSum float64
+	confidences   int
+	detected      int
+}
+
+// ModelPerformance is a model version's analyses by UTC day
+type ModelPerformance struct {
+	ModelKey
+	Trend []*ModelTrendPoint `json:"trend"`
+}
+
+// ModelTrendPoint covers the day starting on Period (YYYY-MM-DD)
+type ModelTrendPoint struct {
+	Period string `json:"period"`
+	ModelStats
+}
+
+// ModelDrift compares a model version's recent analyses with its baseline.
+// ScorePSI is the population stability index of the score distribution;
+// the changes are the recent value less the baseline's. Drifted lists the
+// measures beyond their threshold.
+type ModelDrift struct {
+	ModelKey
+	Recent              *ModelStats `json:"recent"`
+	Baseline            *ModelStats `json:"baseline"`
+	ScorePSI            float64     `json:"score_psi"`
+	ConfidenceChange    *float64    `json:"confidence_change"`
+	DetectionRateChange float64     `json:"detection_rate_change"`
+	Drifted             []string    `json:"drifted"`
+}
+
+func newModelStats() *ModelStats {
+	return &ModelStats{ScoreHistogram: make([]int, scoreBuckets)}
+}
+
+// finish computes the means from the sums
+func (s *ModelStats) finish() {
+	if s.Documents == 0 {
+		return
+	}
+	s.MeanScore = s.scoreSum / float64(s.Documents)
+	s.DetectionRate = float64(s.detected) / float64(s.Documents)
+	if s.confidences > 0 {
+		mean := s.confidenceSum / float64(s.confidences)
+		s.MeanConfidence = &mean
+	}
+}
+
+// analysisConfidence is the mean confidence of the patterns in a pattern
+// analysis, or nil when it lists none
+func analysisConfidence(patternAnalysis string) *float64 {
+	var analysis struct {
+		Patterns []struct {
+			Confidence *float64 `json:"confidence"`
+		} `json:"patterns"`
+	}
+	if json.Unmarshal([]byte(patternAnalysis), &analysis) != nil {
+		return nil
+	}
+	sum, n := 0.0, 0
+	for _, pattern := range analysis.Patterns {
+		if pattern.Confidence != nil {
+			sum += *pattern.Confidence
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	mean := sum / float64(n)
+	return &mean
+}
+
+// recordAnalysisObservation keeps the analysis stored on a document for the
+// model drift monitor
+func recordAnalysisObservation(tx *tx, id DocumentID, analysis *FraudAnalysis, patterns int) error {
+	_, err := tx.Exec(`
+		INSERT INTO analysis_observations (document_id, provider, model_version, fallback, score, confidence, patterns)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		id, analysis.Provider, analysis.ModelVersion, analysis.Fallback, analysis.ModelScore,
+		analysisConfidence(analysis.PatternAnalysis), patterns)
+	if err != nil {
+		return fmt.Errorf("failed to record analysis observation: %w", err)
+	}
+	return nil
+}
+
+// scoreBucket is the SQL expression of the score range a score column
+// falls in, from 0 to scoreBuckets-1
+func scoreBucket(column string) string {
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i := 1; i < scoreBuckets; i++ {
+		fmt.Fprintf(&b, " WHEN %s < %.1f THEN %d", column, float64(i)/scoreBuckets, i-1)
+	}
+	fmt.Fprintf(&b, " ELSE %d END", scoreBuckets-1)
+	return b.String()
+}
+
+// GetModelStats summarizes the analyses made since since and before until,
+// by model version
+func (d *DatabaseService) GetModelStats(since, until time.Time) (map[ModelKey]*ModelStats, error) {
+	rows, err := d.db.Query(`
+		SELECT provider, model_version, `+scoreBucket("score")+` AS bucket, COUNT(*), SUM(score),
+		       SUM(confidence), COUNT(confidence), SUM(CASE WHEN patterns > 0 THEN 1 ELSE 0 END)
+		FROM analysis_observations
+		WHERE analyzed_at >= $1 AND analyzed_at < $2
+		GROUP BY provider, model_version, bucket`,
+		d.db.dialect.timeArg(since.UTC()), d.db.dialect.timeArg(until.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate analyses: %v", err)
+	}
+	defer rows.Close()
+
+	stats := map[ModelKey]*ModelStats{}
+	for rows.Next() {
+		var key ModelKey
+		var bucket int
+		var row ModelStats
+		var confidenceSum sql.NullFloat64
+		if err := rows.Scan(&key.Provider, &key.ModelVersion, &bucket, &row.Documents, &row.scoreSum,
+			&confidenceSum, &row.confidences, &row.detected); err != nil {
+			return nil, err
+		}
+		s, ok := stats[key]
+		if !ok {
+			s = newModelStats()
+			stats[key] = s
+		}
+		s.add(bucket, &row, confidenceSum.Float64)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, s := range stats {
+		s.finish()
+	}
+	return stats, nil
+}
+
+// add counts a row of analyses in a score range
+func (s *ModelStats) add(bucket int, row *ModelStats, confidenceSum float64) {
+	s.Documents += row.Documents
+	s.ScoreHistogram[bucket] += row.Documents
+	s.scoreSum += row.scoreSum
+	s.confidenceSum += confidenceSum
+	s.confidences += row.confidences
+	s.detected += row.detected
+}
+
+// GetModelPerformance returns each model version's analyses since since by
+// UTC day, the days in order. The analyses are counted by UTC quarter hour
+// and summed into days here.
+func (d *DatabaseService) GetModelPerformance(since time.Time) ([]*ModelPerformance, error) {
+	rows, err := d.db.Query(`
+		SELECT provider, model_version, `+d.db.dialect.utcQuarterHour("analyzed_at")+` AS slot,
+		       `+scoreBucket("score")+` AS bucket, COUNT(*), SUM(score),
+		       SUM(confidence), COUNT(confidence), SUM(CASE WHEN patterns > 0 THEN 1 ELSE 0 END)
+		FROM analysis_observations
+		WHERE analyzed_at >= $1
+		GROUP BY provider, model_version, slot, bucket`, d.db.dialect.timeArg(since.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query model performance: %v", err)
+	}
+	defer rows.Close()
+
+	var performance []*ModelPerformance
+	models := map[ModelKey]*ModelPerformance{}
+	points := map[ModelKey]map[string]*ModelTrendPoint{}
+	for rows.Next() {
+		var key ModelKey
+		var slot string
+		var bucket int
+		var row ModelStats
+		var confidenceSum sql.NullFloat64
+		if err := rows.Scan(&key.Provider, &key.ModelVersion, &slot, &bucket, &row.Documents, &row.scoreSum,
+			&confidenceSum, &row.confidences, &row.detected); err != nil {
+			return nil, err
+		}
+		period, err := periodOf(slot, time.UTC, StatsIntervalDay)
+		if err != nil {
+			return nil, err
+		}
+		model, ok := models[key]
+		if !ok {
+			model = &ModelPerformance{ModelKey: key, Trend: []*ModelTrendPoint{}}
+			models[key] = model
+			points[key] = map[string]*ModelTrendPoint{}
+			performance = append(performance, model)
+		}
+		point, ok := points[key][period]
+		if !ok {
+			point = &ModelTrendPoint{Period: period, ModelStats: *newModelStats()}
+			points[key][period] = point
+			model.Trend = append(model.Trend, point)
+		}
+		point.add(bucket, &row, confidenceSum.Float64)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, model := range performance {
+		for _, point := range model.Trend {
+			point.finish()
+		}
+		sort.Slice(model.Trend, func(i, j int) bool { return model.Trend[i].Period < model.Trend[j].Period })
+	}
+	sort.Slice(performance, func(i, j int) bool {
+		if performance[i].Provider != performance[j].Provider {
+			return performance[i].Provider < performance[j].Provider
+		}
+		return performance[i].ModelVersion < performance[j].ModelVersion
+	})
+	return performance, nil
+}
+
+// PurgeAnalysisObservations deletes the analyses made before before and
+// returns how many were deleted
+func (d *DatabaseService) PurgeAnalysisObservations(before time.Time) (int64, error) {
+	result, err := d.db.Exec(`DELETE FROM analysis_observations WHERE analyzed_at < $1`, d.db.dialect.timeArg(before.UTC()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge analysis observations: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// CompareModelStats compares every model version with enough analyses in
+// both periods against its baseline, flagging the measures that moved
+// beyond the thresholds of cfg. The comparisons are ordered by provider and
+// model version.
+func CompareModelStats(recent, baseline map[ModelKey]*ModelStats, cfg config.DriftConfig) []*ModelDrift {
+	drifts := []*ModelDrift{}
+	for key, r := range recent {
+		b, ok := baseline[key]
+		if !ok || r.Documents < cfg.MinDocuments || b.Documents < cfg.MinDocuments {
+			continue
+		}
+		drift := &ModelDrift{
+			ModelKey:            key,
+			Recent:              r,
+			Baseline:            b,
+			ScorePSI:            populationStability(r.ScoreHistogram, b.ScoreHistogram),
+			DetectionRateChange: r.DetectionRate - b.DetectionRate,
+			Drifted:             []string{},
+		}
+		if r.MeanConfidence != nil && b.MeanConfidence != nil {
+			change := *r.MeanConfidence - *b.MeanConfidence
+			drift.ConfidenceChange = &change
+		}
+
+		if drift.ScorePSI > cfg.ScorePSI {
+			drift.Drifted = append(drift.Drifted, DriftScore)
+		}
+		if drift.ConfidenceChange != nil && math.Abs(*drift.ConfidenceChange) > cfg.Confidence {
+			drift.Drifted = append(drift.Drifted, DriftConfidence)
+		}
+		if math.Abs(drift.DetectionRateChange) > cfg.DetectionRate {
+			drift.Drifted = append(drift.Drifted, DriftDetectionRate)
+		}
+		drifts = append(drifts, drift)
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Provider != drifts[j].Provider {
+			return drifts[i].Provider < drifts[j].Provider
+		}
+		return drifts[i].ModelVersion < drifts[j].ModelVersion
+	})
+	return drifts
+}
+
+// populationStability is the population stability index of a distribution
+// against a baseline, counted in the same ranges. Empty ranges count as a
+// tiny share so that the index stays finite.
+func populationStability(actual, expected []int) float64 {
+	const empty = 0.0001
+	actualTotal, expectedTotal := 0, 0
+	for i := range actual {
+		actualTotal += actual[i]
+		expectedTotal += expected[i]
+	}
+	psi := 0.0
+	for i := range actual {
+		a := math.Max(float64(actual[i])/float64(actualTotal), empty)
+		e := math.Max(float64(expected[i])/float64(expectedTotal), empty)
+		psi += (a - e) * math.Log(a/e)
+	}
+	return psi
+}
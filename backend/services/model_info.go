@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ModelInfoCache keeps the AI service's QA model info. Info younger than
+// ttl is served as is. Older info is still served while a background
+// refresh replaces it, and keeps being served while the AI service fails,
+// until it is maxStale old; only then, or when nothing is cached, does a
+// request wait for the AI service.
+type ModelInfoCache struct {
+	ai       AIClient
+	ttl      time.Duration
+	maxStale time.Duration
+
+	mu         sync.Mutex
+	info       *QAModelInfoResponse
+	fetchedAt  time.Time
+	refreshing bool
+	// generation changes on Invalidate, so a refresh started before it
+	// does not store what it fetched
+	generation int
+}
+
+func NewModelInfoCache(ai AIClient, ttl, maxStale time.Duration) *ModelInfoCache {
+	return &ModelInfoCache{ai: ai, ttl: ttl, maxStale: max(maxStale, ttl)}
+}
+
+// Get returns the model info and how long ago it was fetched
+func (c *ModelInfoCache) Get(ctx context.Context) (*QAModelInfoResponse, time.Duration, error) {
+	c.mu.Lock()
+	if c.info != nil {
+		age := time.Since(c.fetchedAt)
+		if age < c.maxStale {
+			if age >= c.ttl && !c.refreshing {
+				c.refreshing = true
+				go c.refresh(c.generation)
+			}
+			info := c.info
+			c.mu.Unlock()
+			return info, age, nil
+		}
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	info, err := c.ai.GetQAModelInfo(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	c.store(info, generation)
+	return info, 0, nil
+}
+
+func (c *ModelInfoCache) refresh(generation int) {
+	info, err := c.ai.GetQAModelInfo(context.Background())
+
+	c.mu.Lock()
+	c.refreshing = false
+	c.mu.Unlock()
+	if err != nil {
+		log.Printf("Serving cached QA model info; refreshing it failed: %v", err)
+		return
+	}
+	c.store(info, generation)
+}
+
+func (c *ModelInfoCache) store(info *QAModelInfoResponse, generation int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation == c.generation {
+		c.info, c.fetchedAt = info, time.Now()
+	}
+}
+
+// Invalidate drops the cached info, for example after a model deploy, so
+// the next Get fetches it from the AI service
+func (c *ModelInfoCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info = nil
+	c.generation++
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// neo4jErrorDetail bounds the response body kept as the error of a failed
+// request
+const neo4jErrorDetail = 200
+
+// Cypher statements of the sync. Documents are merged by ID and their edges
+// replaced, so writing a document again is harmless. Entities and vendors
+// are merged by key and removed once no document links to them.
+const (
+	neo4jConstraints = `CREATE CONSTRAINT %s IF NOT EXISTS FOR (n:%s) REQUIRE n.key IS UNIQUE`
+
+	neo4jUpsertDocuments = `
+UNWIND $documents AS d
+MERGE (doc:Document {key: d.key})
+SET doc = d.properties, doc.key = d.key
+WITH doc
+OPTIONAL MATCH (doc)-[r:MENTIONS|ISSUED_BY]->()
+DELETE r`
+
+	neo4jLinkEntities = `
+UNWIND $edges AS e
+MATCH (doc:Document {key: e.source})
+MERGE (n:Entity {key: e.target})
+SET n += e.properties
+MERGE (doc)-[:MENTIONS]->(n)`
+
+	neo4jLinkVendors = `
+UNWIND $edges AS e
+MATCH (doc:Document {key: e.source})
+MERGE (n:Vendor {key: e.target})
+SET n += e.properties
+MERGE (doc)-[:ISSUED_BY]->(n)`
+
+	neo4jDeleteDocuments = `
+UNWIND $keys AS key
+MATCH (doc:Document {key: key})
+DETACH DELETE doc`
+
+	neo4jDeleteOrphans = `
+MATCH (n)
+WHERE (n:Entity OR n:Vendor) AND NOT (n)--()
+DELETE n`
+)
+
+// Neo4j writes the document graph to a Neo4j instance through its HTTP
+// transaction API, one transaction per call
+type Neo4j struct {
+	cfg      config.GraphConfig
+	password string
+	client   *http.Client
+}
+
+// NewNeo4j returns the sync's Neo4j client. password is the resolved
+// NEO4J_PASSWORD.
+func NewNeo4j(cfg config.GraphConfig, password string) *Neo4j {
+	return &Neo4j{cfg: cfg, password: password, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Enabled reports whether a Neo4j URL is configured
+func (n *Neo4j) Enabled() bool {
+	return n.cfg.Neo4jURL != ""
+}
+
+// Interval is how often documents changed since the last sync are written
+func (n *Neo4j) Interval() time.Duration {
+	return n.cfg.Interval
+}
+
+// BatchSize is how many documents are written per transaction
+func (n *Neo4j) BatchSize() int {
+	if n.cfg.BatchSize < 1 {
+		return 1
+	}
+	return n.cfg.BatchSize
+}
+
+type neo4jStatement struct {
+	Statement  string                 `json:"statement"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// EnsureSchema creates the uniqueness constraints the sync merges on
+func (n *Neo4j) EnsureSchema(ctx context.Context) error {
+	var statements []neo4jStatement
+	for _, label := range []string{GraphDocument, GraphEntity, GraphVendor} {
+		name := "frauddocai_" + strings.ToLower(label) + "_key"
+		statements = append(statements, neo4jStatement{Statement: fmt.Sprintf(neo4jConstraints, name, label)})
+	}
+	return n.commit(ctx, statements)
+}
+
+// WriteDocuments replaces the nodes and edges of the documents and removes
+// the documents deleted since, in one transaction
+func (n *Neo4j) WriteDocuments(ctx context.Context, graphs []*DocumentGraph, deleted []DocumentID) error {
+	documents := make([]map[string]interface{}, 0, len(graphs))
+	edges := map[string][]map[string]interface{}{}
+	for _, graph := range graphs {
+		documents = append(documents, map[string]interface{}{
+			"key":        graph.Document.Key,
+			"properties": neo4jProperties(graph.Document.Properties),
+		})
+		for _, edge := range graph.Edges {
+			edges[edge.Label] = append(edges[edge.Label], map[string]interface{}{
+				"source":     edge.Source.Key,
+				"target":     edge.Target.Key,
+				"properties": neo4jProperties(edge.Target.Properties),
+			})
+		}
+	}
+
+	var statements []neo4jStatement
+	if len(deleted) > 0 {
+		keys := make([]string, len(deleted))
+		for i, id := range deleted {
+			keys[i] = string(id)
+		}
+		statements = append(statements, neo4jStatement{Statement: neo4jDeleteDocuments, Parameters: map[string]interface{}{"keys": keys}})
+	}
+	if len(documents) > 0 {
+		statements = append(statements, neo4jStatement{Statement: neo4jUpsertDocuments, Parameters: map[string]interface{}{"documents": documents}})
+	}
+	if len(edges[GraphMentions]) > 0 {
+		statements = append(statements, neo4jStatement{Statement: neo4jLinkEntities, Parameters: map[string]interface{}{"edges": edges[GraphMentions]}})
+	}
+	if len(edges[GraphIssuedBy]) > 0 {
+		statements = append(statements, neo4jStatement{Statement: neo4jLinkVendors, Parameters: map[string]interface{}{"edges": edges[GraphIssuedBy]}})
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+	statements = append(statements, neo4jStatement{Statement: neo4jDeleteOrphans})
+	return n.commit(ctx, statements)
+}
+
+// neo4jProperties drops missing values, which Neo4j does not store, and
+// dereferences the rest
+func neo4jProperties(properties Metadata) map[string]interface{} {
+	result := make(map[string]interface{}, len(properties))
+	for key, value := range properties {
+		switch v := value.(type) {
+		case nil:
+		case *string:
+			if v != nil {
+				result[key] = *v
+			}
+		case *float64:
+			if v != nil {
+				result[key] = *v
+			}
+		default:
+			result[key] = v
+		}
+	}
+	return result
+}
+
+// commit runs the statements in one transaction. Neo4j reports failed
+// statements in the body of a 200 response, so those are errors too.
+func (n *Neo4j) commit(ctx context.Context, statements []neo4jStatement) error {
+	body, err := json.Marshal(map[string]interface{}{"statements": statements})
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(n.cfg.Neo4jURL, "/") + "/db/" + url.PathEscape(n.cfg.Neo4jDatabase) + "/tx/commit"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if n.cfg.Neo4jUser != "" {
+		req.SetBasicAuth(n.cfg.Neo4jUser, n.password)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, neo4jErrorDetail))
+		return fmt.Errorf("neo4j returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	var result struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode neo4j response: %v", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("neo4j statement failed: %s: %s", result.Errors[0].Code, result.Errors[0].Message)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// expiredPartitionSuffix marks partitions detached from documents whose
+// documents' files are still being released
+const expiredPartitionSuffix = "_expired"
+
+// documentPartitionName is the partition of documents holding the month
+// starting at month
+func documentPartitionName(month time.Time) string {
+	return "documents_" + month.Format("2006_01")
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// documentsPartitioned reports whether documents is partitioned, which it is
+// on Postgres from migration 019 on
+func (d *DatabaseService) documentsPartitioned() (bool, error) {
+	if d.db.dialect == dialectSQLite {
+		return false, nil
+	}
+	var partitioned bool
+	err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'documents'::regclass)`).Scan(&partitioned)
+	if err != nil {
+		return false, fmt.Errorf("failed to check documents partitioning: %v", err)
+	}
+	return partitioned, nil
+}
+
+// CreateDocumentPartitions creates the missing monthly partitions of
+// documents from the month of now through ahead months later, and returns
+// their names. With tenantPartitions above zero each new month is split
+// into that many partitions by hash of tenant_id. Nothing is done where
+// documents is not partitioned, as on SQLite.
+func (d *DatabaseService) CreateDocumentPartitions(now time.Time, ahead, tenantPartitions int) ([]string, error) {
+	partitioned, err := d.documentsPartitioned()
+	if err != nil || !partitioned {
+		return nil, err
+	}
+
+	var created []string
+	for i := 0; i <= ahead; i++ {
+		month := monthStart(now).AddDate(0, i, 0)
+		name := documentPartitionName(month)
+		var exists bool
+		if err := d.db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+			return created, fmt.Errorf("failed to look up partition %s: %v", name, err)
+		}
+		if exists {
+			continue
+		}
+		if err := d.createDocumentPartition(name, month, tenantPartitions); err != nil {
+			return created, fmt.Errorf("failed to create partition %s: %v", name, err)
+		}
+		created = append(created, name)
+	}
+	return created, nil
+}
+
+func (d *DatabaseService) createDocumentPartition(name string, month time.Time, tenantPartitions int) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bounds := fmt.Sprintf(`FOR VALUES FROM ('%s') TO ('%s')`, month.Format("2006-01-02"), month.AddDate(0, 1, 0).Format("2006-01-02"))
+	if tenantPartitions <= 0 {
+		if _, err := tx.Exec(`CREATE TABLE ` + name + ` PARTITION OF documents ` + bounds); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if _, err := tx.Exec(`CREATE TABLE ` + name + ` PARTITION OF documents ` + bounds + ` PARTITION BY HASH (tenant_id)`); err != nil {
+		return err
+	}
+	for i := 0; i < tenantPartitions; i++ {
+		_, err := tx.Exec(fmt.Sprintf(`CREATE TABLE %s_t%d PARTITION OF %s FOR VALUES WITH (MODULUS %d, REMAINDER %d)`,
+			name, i, name, tenantPartitions, i))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ExpireDocumentPartitions detaches the monthly partitions of documents
+// for months before the month of before, and returns their names. In the
+// same transaction as each detach, the rows referencing its documents are
+// deleted or cleared and its document counters deleted, so the documents
+// disappear at once. The partition is kept, renamed with an _expired suffix,
+// until DeleteExpiredDocuments has handed out its documents. Months with a
+// document under legal hold are kept until the hold is released.
+func (d *DatabaseService) ExpireDocumentPartitions(before time.Time) ([]string, error) {
+	partitioned, err := d.documentsPartitioned()
+	if err != nil || !partitioned {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`
+		SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'documents'::regclass AND c.relname ~ '^documents_[0-9]{4}_[0-9]{2}$'
+		ORDER BY c.relname`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list document partitions: %v", err)
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var expired []string
+	for _, name := range names {
+		month, err := time.Parse("documents_2006_01", name)
+		if err != nil || !month.Before(monthStart(before)) {
+			continue
+		}
+		var held bool
+		err = d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM legal_holds WHERE released_at IS NULL AND document_id IN (SELECT id FROM ` + name + `))`).Scan(&held)
+		if err != nil {
+			return expired, fmt.Errorf("failed to check legal holds on partition %s: %v", name, err)
+		}
+		if held {
+			// The whole month waits for its holds to be released
+			log.Printf("Keeping expired partition %s: it holds documents under legal hold", name)
+			continue
+		}
+		if err := d.expireDocumentPartition(name, month); err != nil {
+			return expired, fmt.Errorf("failed to expire partition %s: %v", name, err)
+		}
+		expired = append(expired, name)
+	}
+	return expired, nil
+}
+
+func (d *DatabaseService) expireDocumentPartition(name string, month time.Time) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	expired := name + expiredPartitionSuffix
+	if _, err := tx.Exec(`ALTER TABLE documents DETACH PARTITION ` + name); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`ALTER TABLE ` + name + ` RENAME TO ` + expired); err != nil {
+		return err
+	}
+
+	type reference struct{ table, column, onDelete string }
+	rows, err := tx.Query(`SELECT table_name, column_name, on_delete FROM document_references`)
+	if err != nil {
+		return err
+	}
+	var references []reference
+	for rows.Next() {
+		var ref reference
+		if err := rows.Scan(&ref.table, &ref.column, &ref.onDelete); err != nil {
+			rows.Close()
+			return err
+		}
+		references = append(references, ref)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ref := range references {
+		query := `DELETE FROM ` + ref.table + ` WHERE ` + ref.column + ` IN (SELECT id FROM ` + expired + `)`
+		if ref.onDelete == "set null" {
+			query = `UPDATE ` + ref.table + ` SET ` + ref.column + ` = NULL WHERE ` + ref.column + ` IN (SELECT id FROM ` + expired + `)`
+		}
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to clear %s.%s: %v", ref.table, ref.column, err)
+		}
+	}
+
+	_, err = tx.Exec(`DELETE FROM document_counts WHERE slot >= utc_quarter_hour($1) AND slot < utc_quarter_hour($2)`,
+		month.Format("2006-01-02"), month.AddDate(0, 1, 0).Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("failed to clear document counts: %v", err)
+	}
+
+	// Detaching fires no delete triggers, so the change feed is told here of
+	// the documents it was not told of when they were deleted
+	_, err = tx.Exec(`
+		INSERT INTO changes (entity, entity_id, document_id, tenant_id, operation)
+		SELECT $1, id, id, tenant_id, $2 FROM `+expired+` WHERE deleted_at IS NULL`, ChangeEntityDocument, ChangeDelete)
+	if err != nil {
+		return fmt.Errorf("failed to record expired documents as changes: %v", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteExpiredDocuments deletes up to limit documents of expired
+// partitions and returns them, with their ID and file, so that their files
+// can be released. Expired partitions left empty are dropped. It returns
+// no documents once every expired partition is gone.
+func (d *DatabaseService) DeleteExpiredDocuments(limit int) ([]*Document, error) {
+	partitioned, err := d.documentsPartitioned()
+	if err != nil || !partitioned {
+		return nil, err
+	}
+
+	for {
+		var name string
+		err := d.db.QueryRow(`
+			SELECT relname FROM pg_class
+			WHERE relkind IN ('r', 'p') AND relname ~ '^documents_[0-9]{4}_[0-9]{2}` + expiredPartitionSuffix + `$'
+			ORDER BY relname LIMIT 1`).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find expired partitions: %v", err)
+		}
+
+		documents, err := d.deleteExpiredDocuments(name, limit)
+		if err != nil {
+			return nil, err
+		}
+		if len(documents) > 0 {
+			return documents, nil
+		}
+
+		if _, err := d.db.Exec(`DROP TABLE ` + name); err != nil {
+			return nil, fmt.Errorf("failed to drop partition %s: %v", name, err)
+		}
+	}
+}
+
+// deleteExpiredDocuments deletes up to limit documents of the expired
+// partition name, appending the expiry to each document's events
+func (d *DatabaseService) deleteExpiredDocuments(name string, limit int) ([]*Document, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		DELETE FROM `+name+` WHERE id IN (SELECT id FROM `+name+` LIMIT $1)
+		RETURNING id, tenant_id, file_path, storage_region, storage_tier`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete expired documents: %v", err)
+	}
+	var documents []*Document
+	for rows.Next() {
+		doc := &Document{}
+		if err := rows.Scan(&doc.ID, &doc.TenantID, &doc.FilePath, &doc.StorageRegion, &doc.StorageTier); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, doc := range documents {
+		if err := appendDocumentEvent(tx, doc.ID, doc.TenantID, EventDocumentExpired, Metadata{"partition": name}); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
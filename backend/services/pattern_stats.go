@@ -0,0 +1,145 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Trend bucket sizes accepted by GetFraudPatternStats
+const (
+	StatsIntervalDay  = "day"
+	StatsIntervalWeek = "week"
+)
+
+// PatternStats summarizes how a fraud pattern has performed since a point in
+// time. The false positive rate only counts detections a reviewer has looked
+// at and is nil until at least one has been reviewed.
+type PatternStats struct {
+	PatternID         string               `json:"pattern_id"`
+	Since             time.Time            `json:"since"`
+	TimeZone          string               `json:"time_zone"`
+	Interval          string               `json:"interval"`
+	Detections        int                  `json:"detections"`
+	Documents         int                  `json:"documents"`
+	Reviewed          int                  `json:"reviewed"`
+	FalsePositives    int                  `json:"false_positives"`
+	FalsePositiveRate *float64             `json:"false_positive_rate"`
+	AverageConfidence *float64             `json:"average_confidence"`
+	Trend             []*PatternTrendPoint `json:"trend"`
+}
+
+// PatternTrendPoint covers one day or week of the stats' time zone, starting
+// on Period (YYYY-MM-DD; weeks start on Monday)
+type PatternTrendPoint struct {
+	Period            string   `json:"period"`
+	Detections        int      `json:"detections"`
+	FalsePositives    int      `json:"false_positives"`
+	Reviewed          int      `json:"reviewed"`
+	FalsePositiveRate *float64 `json:"false_positive_rate"`
+	AverageConfidence float64  `json:"average_confidence"`
+}
+
+func falsePositiveRate(falsePositives, reviewed int) *float64 {
+	if reviewed == 0 {
+		return nil
+	}
+	rate := float64(falsePositives) / float64(reviewed)
+	return &rate
+}
+
+func (d *DatabaseService) GetFraudPattern(id string) (*FraudPattern, error) {
+	query := `
+		SELECT id, pattern_name, pattern_type, description, detection_rules,
+		       severity, is_active, created_at, updated_at
+		FROM fraud_patterns WHERE id = $1`
+
+	pattern := &FraudPattern{}
+	err := d.db.QueryRow(query, id).Scan(
+		&pattern.ID, &pattern.PatternName, &pattern.PatternType, &pattern.Description,
+		&pattern.DetectionRules, &pattern.Severity, &pattern.IsActive,
+		&pattern.CreatedAt, &pattern.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pattern, nil
+}
+
+// GetFraudPatternStats aggregates the pattern's detections created since
+// since, with a trend bucketed by interval in loc. The trend is counted by
+// UTC quarter hour and summed into the days or weeks of loc here.
+func (d *DatabaseService) GetFraudPatternStats(patternID string, since time.Time, interval string, loc *time.Location) (*PatternStats, error) {
+	if interval != StatsIntervalDay && interval != StatsIntervalWeek {
+		return nil, fmt.Errorf("unknown stats interval %q", interval)
+	}
+
+	stats := &PatternStats{PatternID: patternID, Since: since, TimeZone: loc.String(), Interval: interval, Trend: []*PatternTrendPoint{}}
+	sinceArg := d.db.dialect.timeArg(since.UTC())
+
+	var average sql.NullFloat64
+	err := d.db.QueryRow(`
+		SELECT COUNT(*), COUNT(DISTINCT document_id),
+		       COALESCE(SUM(CASE WHEN reviewed_at IS NOT NULL THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN reviewed_at IS NOT NULL AND is_false_positive THEN 1 ELSE 0 END), 0),
+		       AVG(confidence_score)
+		FROM document_fraud_detections
+		WHERE fraud_pattern_id = $1 AND created_at >= $2`, patternID, sinceArg,
+	).Scan(&stats.Detections, &stats.Documents, &stats.Reviewed, &stats.FalsePositives, &average)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate pattern detections: %v", err)
+	}
+	stats.FalsePositiveRate = falsePositiveRate(stats.FalsePositives, stats.Reviewed)
+	if average.Valid {
+		stats.AverageConfidence = &average.Float64
+	}
+
+	rows, err := d.db.Query(`
+		SELECT `+d.db.dialect.utcQuarterHour("created_at")+` AS slot, COUNT(*),
+		       COALESCE(SUM(CASE WHEN reviewed_at IS NOT NULL THEN 1 ELSE 0 END), 0),
+		       COALESCE(SUM(CASE WHEN reviewed_at IS NOT NULL AND is_false_positive THEN 1 ELSE 0 END), 0),
+		       SUM(confidence_score)
+		FROM document_fraud_detections
+		WHERE fraud_pattern_id = $1 AND created_at >= $2
+		GROUP BY slot`, patternID, sinceArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pattern trend: %v", err)
+	}
+	defer rows.Close()
+
+	points := map[string]*PatternTrendPoint{}
+	for rows.Next() {
+		var slot string
+		var detections, reviewed, falsePositives int
+		var confidence float64
+		if err := rows.Scan(&slot, &detections, &reviewed, &falsePositives, &confidence); err != nil {
+			return nil, err
+		}
+		period, err := periodOf(slot, loc, interval)
+		if err != nil {
+			return nil, err
+		}
+		point, ok := points[period]
+		if !ok {
+			point = &PatternTrendPoint{Period: period}
+			points[period] = point
+			stats.Trend = append(stats.Trend, point)
+		}
+		point.Detections += detections
+		point.Reviewed += reviewed
+		point.FalsePositives += falsePositives
+		// Summed here and averaged below
+		point.AverageConfidence += confidence
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, point := range stats.Trend {
+		point.AverageConfidence /= float64(point.Detections)
+		point.FalsePositiveRate = falsePositiveRate(point.FalsePositives, point.Reviewed)
+	}
+	sort.Slice(stats.Trend, func(i, j int) bool { return stats.Trend[i].Period < stats.Trend[j].Period })
+	return stats, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import "time"
+
+type FraudPattern struct {
+	ID             string    `json:"id"`
+	PatternName    string    `json:"pattern_name"`
+	PatternType    string    `json:"pattern_type"`
+	Description    *string   `json:"description"`
+	DetectionRules Metadata  `json:"detection_rules"`
+	Severity       string    `json:"severity"`
+	IsActive       bool      `json:"is_active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Fraud pattern operations
+func (d *DatabaseService) CreateFraudPattern(pattern *FraudPattern) error {
+	query := `
+		INSERT INTO fraud_patterns (pattern_name, pattern_type, description, detection_rules, severity, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`
+
+	return d.db.QueryRow(
+		query,
+		pattern.PatternName, pattern.PatternType, pattern.Description,
+		pattern.DetectionRules, pattern.Severity, pattern.IsActive,
+	).Scan(&pattern.ID, &pattern.CreatedAt, &pattern.UpdatedAt)
+}
+
+// GetFraudPatterns returns all active fraud patterns
+func (d *DatabaseService) GetFraudPatterns() ([]*FraudPattern, error) {
+	query := `
+		SELECT id, pattern_name, pattern_type, description, detection_rules,
+		       severity, is_active, created_at, updated_at
+		FROM fraud_patterns
+		WHERE is_active = true
+		ORDER BY pattern_name`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []*FraudPattern
+	for rows.Next() {
+		pattern := &FraudPattern{}
+		err := rows.Scan(
+			&pattern.ID, &pattern.PatternName, &pattern.PatternType, &pattern.Description,
+			&pattern.DetectionRules, &pattern.Severity, &pattern.IsActive,
+			&pattern.CreatedAt, &pattern.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, rows.Err()
+}
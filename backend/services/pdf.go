@@ -0,0 +1,277 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"unicode/utf8"
+)
+
+// A4 pages with 2cm margins, in points
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 56.0
+)
+
+// pdfWriter lays out plain text reports on A4 pages in the standard
+// Helvetica fonts, so reports render without embedding fonts. Text outside
+// Latin-1 is replaced with '?', so reports are translated into Western
+// European languages only.
+type pdfWriter struct {
+	pages  []*bytes.Buffer
+	images [][]*pdfImage
+	y      float64
+	l      Localizer
+}
+
+// pdfImage is an image XObject: 8-bit samples in colorSpace, encoded with
+// filter
+type pdfImage struct {
+	width, height int
+	colorSpace    string
+	filter        string
+	data          []byte
+}
+
+func newPDFWriter(l Localizer) *pdfWriter {
+	w := &pdfWriter{l: l}
+	w.newPage()
+	return w
+}
+
+func (w *pdfWriter) newPage() {
+	w.pages = append(w.pages, &bytes.Buffer{})
+	w.images = append(w.images, nil)
+	w.y = pdfPageHeight - pdfMargin
+}
+
+func (w *pdfWriter) page() *bytes.Buffer {
+	return w.pages[len(w.pages)-1]
+}
+
+// line writes one line of text at the current position, starting a new page
+// when it does not fit
+func (w *pdfWriter) line(text string, size float64, bold bool, indent float64) {
+	leading := size * 1.4
+	if w.y-leading < pdfMargin {
+		w.newPage()
+	}
+	w.y -= leading
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, pdfMargin+indent, w.y, pdfEscape(text))
+}
+
+// Heading writes a bold title
+func (w *pdfWriter) Heading(text string, size float64) {
+	w.Space(size * 0.4)
+	for _, line := range pdfWrap(text, size, pdfPageWidth-2*pdfMargin) {
+		w.line(line, size, true, 0)
+	}
+}
+
+// Paragraph writes text wrapped to the page width
+func (w *pdfWriter) Paragraph(text string) {
+	w.Indented(text, 0)
+}
+
+// Indented writes text wrapped to the page width, indented by indent points
+func (w *pdfWriter) Indented(text string, indent float64) {
+	for _, paragraph := range strings.Split(text, "\n") {
+		for _, line := range pdfWrap(paragraph, 10, pdfPageWidth-2*pdfMargin-indent) {
+			w.line(line, 10, false, indent)
+		}
+	}
+}
+
+// Field writes a "label: value" line
+func (w *pdfWriter) Field(label, value string) {
+	if value == "" {
+		value = "-"
+	}
+	w.Paragraph(label + ": " + value)
+}
+
+// Figure draws an image scaled to fit a square of size points at the left
+// margin, or a "No preview" frame when img is nil, and lets beside write
+// next to it at the indent it is given. It moves below both.
+func (w *pdfWriter) Figure(img *pdfImage, size float64, beside func(indent float64)) {
+	w.Space(size * 0.2)
+	if w.y-size < pdfMargin {
+		w.newPage()
+	}
+	page, top := len(w.pages), w.y
+	if img == nil {
+		fmt.Fprintf(w.page(), "q 0.6 G 0.5 w %.2f %.2f %.2f %.2f re S Q\n", pdfMargin, top-size, size, size)
+		text := w.l.T("No preview")
+		fmt.Fprintf(w.page(), "q 0.5 g BT /F1 8.0 Tf %.2f %.2f Td (%s) Tj ET Q\n", pdfMargin+size/2-2*float64(len(text)), top-size/2-3, pdfEscape(text))
+	} else {
+		width, height := size, size
+		if img.width > img.height {
+			height = size * float64(img.height) / float64(img.width)
+		} else {
+			width = size * float64(img.width) / float64(img.height)
+		}
+		w.images[page-1] = append(w.images[page-1], img)
+		fmt.Fprintf(w.page(), "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n",
+			width, height, pdfMargin+(size-width)/2, top-size+(size-height)/2, len(w.images[page-1]))
+	}
+	beside(size + 12)
+	if len(w.pages) == page && w.y > top-size {
+		w.y = top - size
+	}
+}
+
+// Space moves down by height points
+func (w *pdfWriter) Space(height float64) {
+	w.y -= height
+}
+
+// Bytes assembles the document, numbering each page at its foot
+func (w *pdfWriter) Bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// Objects 1 to 4 are the catalog, the page tree and the two fonts; each
+	// page is followed by its content stream and its images
+	kids := make([]string, len(w.pages))
+	numbers := make([]int, len(w.pages))
+	next := 5
+	for i := range w.pages {
+		numbers[i] = next
+		kids[i] = fmt.Sprintf("%d 0 R", next)
+		next += 2 + len(w.images[i])
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(w.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range w.pages {
+		fmt.Fprintf(page, "BT /F1 8.0 Tf %.2f %.2f Td (%s) Tj ET\n",
+			pdfPageWidth-pdfMargin-40, pdfMargin/2, pdfEscape(w.l.Sprintf("Page %d of %d", i+1, len(w.pages))))
+		var xobjects strings.Builder
+		for j := range w.images[i] {
+			fmt.Fprintf(&xobjects, " /Im%d %d 0 R", j+1, numbers[i]+2+j)
+		}
+		resources := "/Font << /F1 3 0 R /F2 4 0 R >>"
+		if xobjects.Len() > 0 {
+			resources += " /XObject <<" + xobjects.String() + " >>"
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << %s >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, resources, numbers[i]+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+		for _, img := range w.images[i] {
+			object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s /Length %d >>\nstream\n%s\nendstream",
+				img.width, img.height, img.colorSpace, img.filter, len(img.data), img.data))
+		}
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfImageOf encodes an image in RGB, blended onto white, scaled down by
+// averaging so neither side exceeds maxSide pixels unless maxSide is zero
+func pdfImageOf(img image.Image, maxSide int) *pdfImage {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := srcWidth, srcHeight
+	if maxSide > 0 && max(width, height) > maxSide {
+		if width > height {
+			width, height = maxSide, max(1, height*maxSide/width)
+		} else {
+			width, height = max(1, width*maxSide/height), maxSide
+		}
+	}
+
+	pixels := make([]byte, 0, 3*width*height)
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(img.At(bounds.Min.X+sx, bounds.Min.Y+sy)).(color.NRGBA)
+					blend := func(v uint8) int {
+						return (int(v)*int(c.A) + 255*(255-int(c.A))) / 255
+					}
+					r, g, b, n = r+blend(c.R), g+blend(c.G), b+blend(c.B), n+1
+				}
+			}
+			pixels = append(pixels, byte(r/n), byte(g/n), byte(b/n))
+		}
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(pixels)
+	zw.Close()
+	return &pdfImage{width: width, height: height, colorSpace: "/DeviceRGB", filter: "/FlateDecode", data: compressed.Bytes()}
+}
+
+// pdfWrap breaks text into lines that fit width at size, estimating
+// Helvetica's average character width
+func pdfWrap(text string, size, width float64) []string {
+	limit := int(width / (size * 0.5))
+	var lines []string
+	var current []rune
+	for _, word := range strings.Fields(text) {
+		runes := []rune(word)
+		for len(runes) > limit {
+			if len(current) > 0 {
+				lines = append(lines, string(current))
+				current = nil
+			}
+			lines = append(lines, string(runes[:limit]))
+			runes = runes[limit:]
+		}
+		switch {
+		case len(current) == 0:
+			current = runes
+		case len(current)+1+len(runes) <= limit:
+			current = append(append(current, ' '), runes...)
+		default:
+			lines = append(lines, string(current))
+			current = runes
+		}
+	}
+	if len(current) > 0 || len(lines) == 0 {
+		lines = append(lines, string(current))
+	}
+	return lines
+}
+
+// pdfEscape encodes text as the body of a PDF literal string in Latin-1
+func pdfEscape(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20 || (r >= 0x7f && r < 0xa0) || r == utf8.RuneError || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,1036 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedPDF is returned for PDFs that cannot be stamped: encrypted
+// ones and those whose structure cannot be read
+var ErrUnsupportedPDF = errors.New("unsupported PDF")
+
+// The objects of a PDF are read into these values. Numbers, strings,
+// booleans and null are kept as written, so they are written back unchanged.
+type (
+	pdfValue interface{}
+	pdfName  string
+	pdfRaw   string
+	pdfArray []pdfValue
+	pdfRef   struct{ num, gen int }
+)
+
+// pdfDict keeps its keys in the order they were read
+type pdfDict struct {
+	keys   []pdfName
+	values map[pdfName]pdfValue
+}
+
+func newPDFDict() *pdfDict {
+	return &pdfDict{values: map[pdfName]pdfValue{}}
+}
+
+func (d *pdfDict) get(key pdfName) pdfValue {
+	return d.values[key]
+}
+
+func (d *pdfDict) set(key pdfName, value pdfValue) {
+	if _, ok := d.values[key]; !ok {
+		d.keys = append(d.keys, key)
+	}
+	d.values[key] = value
+}
+
+func (d *pdfDict) copy() *pdfDict {
+	c := &pdfDict{keys: append([]pdfName(nil), d.keys...), values: make(map[pdfName]pdfValue, len(d.values))}
+	for key, value := range d.values {
+		c.values[key] = value
+	}
+	return c
+}
+
+func writePDFValue(b *bytes.Buffer, value pdfValue) {
+	switch v := value.(type) {
+	case pdfName:
+		b.WriteString("/" + string(v))
+	case pdfRaw:
+		b.WriteString(string(v))
+	case pdfRef:
+		fmt.Fprintf(b, "%d %d R", v.num, v.gen)
+	case pdfArray:
+		b.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writePDFValue(b, item)
+		}
+		b.WriteByte(']')
+	case *pdfDict:
+		b.WriteString("<<")
+		for _, key := range v.keys {
+			b.WriteString(" /" + string(key) + " ")
+			writePDFValue(b, v.values[key])
+		}
+		b.WriteString(" >>")
+	default:
+		b.WriteString("null")
+	}
+}
+
+func pdfNumber(value pdfValue) (float64, bool) {
+	raw, ok := value.(pdfRaw)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(string(raw), 64)
+	return n, err == nil
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isPDFInteger(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfLexer reads PDF values from data at pos
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFSyntax = fmt.Errorf("%w: syntax error", ErrUnsupportedPDF)
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *pdfLexer) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(prefix))
+}
+
+// word reads a run of regular characters, such as a number or keyword
+func (l *pdfLexer) word() string {
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) integer() (int, error) {
+	word := l.word()
+	if !isPDFInteger(word) {
+		return 0, errPDFSyntax
+	}
+	return strconv.Atoi(word)
+}
+
+func (l *pdfLexer) value() (pdfValue, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFSyntax
+	}
+	switch c := l.data[l.pos]; {
+	case l.hasPrefix("<<"):
+		l.pos += 2
+		dict := newPDFDict()
+		for {
+			l.skipSpace()
+			if l.hasPrefix(">>") {
+				l.pos += 2
+				return dict, nil
+			}
+			key, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, errPDFSyntax
+			}
+			value, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			dict.set(name, value)
+		}
+	case c == '[':
+		l.pos++
+		array := pdfArray{}
+		for {
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == ']' {
+				l.pos++
+				return array, nil
+			}
+			value, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(l.data[start:l.pos]), nil
+	case c == '(':
+		start := l.pos
+		depth := 0
+		for ; l.pos < len(l.data); l.pos++ {
+			switch l.data[l.pos] {
+			case '\\':
+				l.pos++
+			case '(':
+				depth++
+			case ')':
+				depth--
+				if depth == 0 {
+					l.pos++
+					return pdfRaw(l.data[start:l.pos]), nil
+				}
+			}
+		}
+		return nil, errPDFSyntax
+	case c == '<':
+		end := bytes.IndexByte(l.data[l.pos:], '>')
+		if end < 0 {
+			return nil, errPDFSyntax
+		}
+		start := l.pos
+		l.pos += end + 1
+		return pdfRaw(l.data[start:l.pos]), nil
+	}
+
+	word := l.word()
+	if word == "" {
+		return nil, errPDFSyntax
+	}
+	if isPDFInteger(word) {
+		// An object number is followed by its generation and R
+		save := l.pos
+		gen := l.word()
+		if isPDFInteger(gen) && l.word() == "R" {
+			num, _ := strconv.Atoi(word)
+			g, _ := strconv.Atoi(gen)
+			return pdfRef{num, g}, nil
+		}
+		l.pos = save
+	}
+	return pdfRaw(word), nil
+}
+
+// pdfXrefEntry locates an object: at an offset of the file, or at an index
+// of an object stream
+type pdfXrefEntry struct {
+	inUse    bool
+	offset   int
+	gen      int
+	inStream bool
+	stream   int
+	index    int
+}
+
+// pdfFile is a parsed PDF, read lazily through its cross-reference sections
+type pdfFile struct {
+	data      []byte
+	startxref int
+	xref      map[int]pdfXrefEntry
+	// trailer is the newest trailer, or the dictionary of the newest
+	// cross-reference stream when xrefStream is set
+	trailer    *pdfDict
+	xrefStream bool
+	objStreams map[int]map[int]pdfValue
+	depth      int
+}
+
+func parsePDF(data []byte) (*pdfFile, error) {
+	at := bytes.LastIndex(data, []byte("startxref"))
+	if at < 0 {
+		return nil, fmt.Errorf("%w: no startxref", ErrUnsupportedPDF)
+	}
+	l := &pdfLexer{data: data, pos: at + len("startxref")}
+	startxref, err := l.integer()
+	if err != nil {
+		return nil, err
+	}
+	f := &pdfFile{data: data, startxref: startxref, xref: map[int]pdfXrefEntry{}, objStreams: map[int]map[int]pdfValue{}}
+	if err := f.loadXref(startxref, map[int]bool{}); err != nil {
+		return nil, err
+	}
+	if f.trailer == nil {
+		return nil, fmt.Errorf("%w: no trailer", ErrUnsupportedPDF)
+	}
+	if f.trailer.get("Encrypt") != nil {
+		return nil, fmt.Errorf("%w: encrypted", ErrUnsupportedPDF)
+	}
+	return f, nil
+}
+
+// loadXref reads the cross-reference section at offset and those before
+// it. Entries already read, from newer sections, take precedence.
+func (f *pdfFile) loadXref(offset int, seen map[int]bool) error {
+	if offset < 0 || offset >= len(f.data) || seen[offset] {
+		return fmt.Errorf("%w: bad cross-reference offset", ErrUnsupportedPDF)
+	}
+	seen[offset] = true
+	first := f.trailer == nil
+
+	l := &pdfLexer{data: f.data, pos: offset}
+	l.skipSpace()
+	var trailer *pdfDict
+	if l.hasPrefix("xref") {
+		l.pos += len("xref")
+		for {
+			l.skipSpace()
+			if l.hasPrefix("trailer") {
+				l.pos += len("trailer")
+				value, err := l.value()
+				if err != nil {
+					return err
+				}
+				dict, ok := value.(*pdfDict)
+				if !ok {
+					return errPDFSyntax
+				}
+				trailer = dict
+				break
+			}
+			start, err := l.integer()
+			if err != nil {
+				return err
+			}
+			count, err := l.integer()
+			if err != nil {
+				return err
+			}
+			for i := 0; i < count; i++ {
+				entryOffset, err := l.integer()
+				if err != nil {
+					return err
+				}
+				gen, err := l.integer()
+				if err != nil {
+					return err
+				}
+				kind := l.word()
+				if _, ok := f.xref[start+i]; !ok {
+					f.xref[start+i] = pdfXrefEntry{inUse: kind == "n", offset: entryOffset, gen: gen}
+				}
+			}
+		}
+		if first {
+			f.trailer = trailer
+		}
+		// Hybrid files list objects in streams in a cross-reference stream
+		if stm, ok := pdfNumber(trailer.get("XRefStm")); ok {
+			if _, err := f.loadXrefStream(int(stm), false); err != nil {
+				return err
+			}
+		}
+	} else {
+		var err error
+		if trailer, err = f.loadXrefStream(offset, first); err != nil {
+			return err
+		}
+	}
+
+	if prev, ok := pdfNumber(trailer.get("Prev")); ok {
+		return f.loadXref(int(prev), seen)
+	}
+	return nil
+}
+
+// loadXrefStream reads the cross-reference stream at offset and returns its
+// dictionary
+func (f *pdfFile) loadXrefStream(offset int, first bool) (*pdfDict, error) {
+	value, stream, err := f.objectAt(offset)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(*pdfDict)
+	if !ok || dict.get("Type") != pdfName("XRef") || stream == nil {
+		return nil, fmt.Errorf("%w: no cross-reference table", ErrUnsupportedPDF)
+	}
+	data, err := f.decodeStream(dict, stream)
+	if err != nil {
+		return nil, err
+	}
+
+	var widths []int
+	if w, ok := dict.get("W").(pdfArray); ok {
+		for _, item := range w {
+			n, _ := pdfNumber(item)
+			widths = append(widths, int(n))
+		}
+	}
+	if len(widths) != 3 {
+		return nil, errPDFSyntax
+	}
+	size, _ := pdfNumber(dict.get("Size"))
+	index := pdfArray{pdfRaw("0"), pdfRaw(strconv.Itoa(int(size)))}
+	if i, ok := dict.get("Index").(pdfArray); ok {
+		index = i
+	}
+	field := func(row []byte, width int, fallback int) int {
+		if width == 0 {
+			return fallback
+		}
+		n := 0
+		for _, b := range row[:width] {
+			n = n<<8 | int(b)
+		}
+		return n
+	}
+
+	rowSize := widths[0] + widths[1] + widths[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := pdfNumber(index[i])
+		count, _ := pdfNumber(index[i+1])
+		for j := 0; j < int(count); j++ {
+			if pos+rowSize > len(data) {
+				return nil, errPDFSyntax
+			}
+			row := data[pos : pos+rowSize]
+			pos += rowSize
+			kind := field(row, widths[0], 1)
+			second := field(row[widths[0]:], widths[1], 0)
+			third := field(row[widths[0]+widths[1]:], widths[2], 0)
+			num := int(start) + j
+			if _, ok := f.xref[num]; ok {
+				continue
+			}
+			switch kind {
+			case 1:
+				f.xref[num] = pdfXrefEntry{inUse: true, offset: second, gen: third}
+			case 2:
+				f.xref[num] = pdfXrefEntry{inUse: true, inStream: true, stream: second, index: third}
+			default:
+				f.xref[num] = pdfXrefEntry{}
+			}
+		}
+	}
+	if first {
+		f.trailer = dict
+		f.xrefStream = true
+	}
+	return dict, nil
+}
+
+// objectAt reads the indirect object at offset, with the raw data of its
+// stream when it has one
+func (f *pdfFile) objectAt(offset int) (pdfValue, []byte, error) {
+	if offset < 0 || offset >= len(f.data) {
+		return nil, nil, errPDFSyntax
+	}
+	l := &pdfLexer{data: f.data, pos: offset}
+	if _, err := l.integer(); err != nil {
+		return nil, nil, err
+	}
+	if _, err := l.integer(); err != nil {
+		return nil, nil, err
+	}
+	if l.word() != "obj" {
+		return nil, nil, errPDFSyntax
+	}
+	value, err := l.value()
+	if err != nil {
+		return nil, nil, err
+	}
+	l.skipSpace()
+	dict, ok := value.(*pdfDict)
+	if !ok || !l.hasPrefix("stream") {
+		return value, nil, nil
+	}
+
+	l.pos += len("stream")
+	if l.hasPrefix("\r") {
+		l.pos++
+	}
+	if l.hasPrefix("\n") {
+		l.pos++
+	}
+	start := l.pos
+	length := -1
+	if v, err := f.resolve(dict.get("Length")); err == nil {
+		if n, ok := pdfNumber(v); ok {
+			length = int(n)
+		}
+	}
+	if length >= 0 && start+length <= len(f.data) {
+		end := &pdfLexer{data: f.data, pos: start + length}
+		end.skipSpace()
+		if end.hasPrefix("endstream") {
+			return dict, f.data[start : start+length], nil
+		}
+	}
+	// A wrong /Length is common; the stream ends before endstream
+	end := bytes.Index(f.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, nil, errPDFSyntax
+	}
+	return dict, bytes.TrimRight(f.data[start:start+end], "\r\n"), nil
+}
+
+// decodeStream undoes the Flate compression and PNG predictors that
+// cross-reference and object streams use
+func (f *pdfFile) decodeStream(dict *pdfDict, data []byte) ([]byte, error) {
+	filter, err := f.resolve(dict.get("Filter"))
+	if err != nil {
+		return nil, err
+	}
+	params, _ := f.resolve(dict.get("DecodeParms"))
+	if array, ok := filter.(pdfArray); ok {
+		if len(array) > 1 {
+			return nil, fmt.Errorf("%w: chained stream filters", ErrUnsupportedPDF)
+		}
+		filter = nil
+		if len(array) == 1 {
+			filter = array[0]
+		}
+		if paramsArray, ok := params.(pdfArray); ok && len(paramsArray) == 1 {
+			params, _ = f.resolve(paramsArray[0])
+		}
+	}
+	switch filter {
+	case nil:
+		return data, nil
+	case pdfName("FlateDecode"):
+	default:
+		return nil, fmt.Errorf("%w: stream filter %v", ErrUnsupportedPDF, filter)
+	}
+
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPDF, err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedPDF, err)
+	}
+
+	paramsDict, _ := params.(*pdfDict)
+	if paramsDict == nil {
+		return decoded, nil
+	}
+	predictor, _ := pdfNumber(paramsDict.get("Predictor"))
+	if predictor < 10 {
+		if predictor > 1 {
+			return nil, fmt.Errorf("%w: TIFF predictor", ErrUnsupportedPDF)
+		}
+		return decoded, nil
+	}
+	columns, colors, bits := 1.0, 1.0, 8.0
+	if n, ok := pdfNumber(paramsDict.get("Columns")); ok {
+		columns = n
+	}
+	if n, ok := pdfNumber(paramsDict.get("Colors")); ok {
+		colors = n
+	}
+	if n, ok := pdfNumber(paramsDict.get("BitsPerComponent")); ok {
+		bits = n
+	}
+	return pngUnfilter(decoded, int(math.Ceil(colors*bits*columns/8)), int(math.Max(1, colors*bits/8)))
+}
+
+// pngUnfilter undoes the PNG filter of each row
+func pngUnfilter(data []byte, rowSize, pixelSize int) ([]byte, error) {
+	var out []byte
+	prev := make([]byte, rowSize)
+	for pos := 0; pos+1+rowSize <= len(data); pos += rowSize + 1 {
+		filter := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowSize]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= pixelSize {
+				left, upLeft = row[i-pixelSize], prev[i-pixelSize]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				p := int(left) + int(up) - int(upLeft)
+				pa, pb, pc := pdfAbs(p-int(left)), pdfAbs(p-int(up)), pdfAbs(p-int(upLeft))
+				switch {
+				case pa <= pb && pa <= pc:
+					row[i] += left
+				case pb <= pc:
+					row[i] += up
+				default:
+					row[i] += upLeft
+				}
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func pdfAbs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// resolve follows a reference to the object it names
+func (f *pdfFile) resolve(value pdfValue) (pdfValue, error) {
+	ref, ok := value.(pdfRef)
+	if !ok {
+		return value, nil
+	}
+	if f.depth > 32 {
+		return nil, fmt.Errorf("%w: references nested too deep", ErrUnsupportedPDF)
+	}
+	f.depth++
+	defer func() { f.depth-- }()
+	return f.object(ref.num)
+}
+
+// object reads an indirect object by number. Free and missing objects are
+// null.
+func (f *pdfFile) object(num int) (pdfValue, error) {
+	entry, ok := f.xref[num]
+	if !ok || !entry.inUse {
+		return pdfRaw("null"), nil
+	}
+	if !entry.inStream {
+		value, _, err := f.objectAt(entry.offset)
+		return value, err
+	}
+
+	objects, ok := f.objStreams[entry.stream]
+	if !ok {
+		var err error
+		if objects, err = f.loadObjectStream(entry.stream); err != nil {
+			return nil, err
+		}
+		f.objStreams[entry.stream] = objects
+	}
+	value, ok := objects[num]
+	if !ok {
+		return pdfRaw("null"), nil
+	}
+	return value, nil
+}
+
+// loadObjectStream reads the objects compressed in an object stream
+func (f *pdfFile) loadObjectStream(num int) (map[int]pdfValue, error) {
+	entry, ok := f.xref[num]
+	if !ok || !entry.inUse || entry.inStream {
+		return nil, fmt.Errorf("%w: missing object stream %d", ErrUnsupportedPDF, num)
+	}
+	value, stream, err := f.objectAt(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(*pdfDict)
+	if !ok || stream == nil {
+		return nil, fmt.Errorf("%w: bad object stream %d", ErrUnsupportedPDF, num)
+	}
+	data, err := f.decodeStream(dict, stream)
+	if err != nil {
+		return nil, err
+	}
+	count, _ := pdfNumber(dict.get("N"))
+	first, _ := pdfNumber(dict.get("First"))
+
+	l := &pdfLexer{data: data}
+	numbers := make([]int, int(count))
+	offsets := make([]int, int(count))
+	for i := range numbers {
+		if numbers[i], err = l.integer(); err != nil {
+			return nil, err
+		}
+		if offsets[i], err = l.integer(); err != nil {
+			return nil, err
+		}
+	}
+	objects := make(map[int]pdfValue, len(numbers))
+	for i, n := range numbers {
+		l.pos = int(first) + offsets[i]
+		if objects[n], err = l.value(); err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// pdfPage is a leaf of the page tree with the attributes it inherits
+type pdfPage struct {
+	ref       pdfRef
+	dict      *pdfDict
+	resources pdfValue
+	mediaBox  [4]float64
+}
+
+// pages lists the pages in order
+func (f *pdfFile) pages() ([]*pdfPage, error) {
+	root, err := f.resolve(f.trailer.get("Root"))
+	if err != nil {
+		return nil, err
+	}
+	catalog, ok := root.(*pdfDict)
+	if !ok {
+		return nil, fmt.Errorf("%w: no catalog", ErrUnsupportedPDF)
+	}
+	tree, ok := catalog.get("Pages").(pdfRef)
+	if !ok {
+		return nil, fmt.Errorf("%w: no page tree", ErrUnsupportedPDF)
+	}
+
+	var pages []*pdfPage
+	seen := map[pdfRef]bool{}
+	var walk func(ref pdfRef, resources pdfValue, mediaBox pdfValue, depth int) error
+	walk = func(ref pdfRef, resources pdfValue, mediaBox pdfValue, depth int) error {
+		if seen[ref] || depth > 64 {
+			return fmt.Errorf("%w: page tree loops", ErrUnsupportedPDF)
+		}
+		seen[ref] = true
+		value, err := f.object(ref.num)
+		if err != nil {
+			return err
+		}
+		node, ok := value.(*pdfDict)
+		if !ok {
+			return fmt.Errorf("%w: bad page tree node", ErrUnsupportedPDF)
+		}
+		if v := node.get("Resources"); v != nil {
+			resources = v
+		}
+		if v := node.get("MediaBox"); v != nil {
+			mediaBox = v
+		}
+
+		kids, err := f.resolve(node.get("Kids"))
+		if err != nil {
+			return err
+		}
+		if node.get("Type") == pdfName("Page") || kids == nil {
+			page := &pdfPage{ref: ref, dict: node, resources: resources, mediaBox: [4]float64{0, 0, 612, 792}}
+			if box, err := f.resolve(mediaBox); err == nil {
+				if array, ok := box.(pdfArray); ok && len(array) == 4 {
+					for i, item := range array {
+						item, _ = f.resolve(item)
+						if n, ok := pdfNumber(item); ok {
+							page.mediaBox[i] = n
+						}
+					}
+				}
+			}
+			pages = append(pages, page)
+			return nil
+		}
+		array, ok := kids.(pdfArray)
+		if !ok {
+			return fmt.Errorf("%w: bad page tree kids", ErrUnsupportedPDF)
+		}
+		for _, kid := range array {
+			kidRef, ok := kid.(pdfRef)
+			if !ok {
+				return fmt.Errorf("%w: bad page tree kid", ErrUnsupportedPDF)
+			}
+			if err := walk(kidRef, resources, mediaBox, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(tree, nil, nil, 0); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// pdfStampName names the watermark in the document information, and with
+// a number, in the resources of stamped pages
+const pdfStampName = pdfName("FraudDocAIWatermark")
+
+// StampPDF returns the PDF with text stamped across and at the foot of every
+// page, and kept in its document information as /FraudDocAIWatermark. The
+// stamp is an incremental update: the original bytes are kept as they were.
+// Encrypted PDFs and those whose structure cannot be read are refused with
+// ErrUnsupportedPDF.
+func StampPDF(content []byte, text string) ([]byte, error) {
+	f, err := parsePDF(content)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := f.pages()
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("%w: no pages", ErrUnsupportedPDF)
+	}
+	size, ok := pdfNumber(f.trailer.get("Size"))
+	if !ok {
+		return nil, fmt.Errorf("%w: no trailer size", ErrUnsupportedPDF)
+	}
+
+	var out bytes.Buffer
+	out.Write(content)
+	if content[len(content)-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	next := int(size)
+	written := map[int]pdfXrefEntry{}
+	object := func(num, gen int, value pdfValue, stream string) {
+		written[num] = pdfXrefEntry{inUse: true, offset: out.Len(), gen: gen}
+		fmt.Fprintf(&out, "%d %d obj\n", num, gen)
+		writePDFValue(&out, value)
+		if stream != "" {
+			out.WriteString("\nstream\n" + stream + "\nendstream")
+		}
+		out.WriteString("\nendobj\n")
+	}
+	stream := func(content string, entries ...pdfValue) int {
+		num := next
+		next++
+		dict := newPDFDict()
+		for i := 0; i+1 < len(entries); i += 2 {
+			dict.set(entries[i].(pdfName), entries[i+1])
+		}
+		dict.set("Length", pdfRaw(strconv.Itoa(len(content))))
+		object(num, 0, dict, content)
+		return num
+	}
+
+	// Each page's contents are wrapped in q and Q so the stamp is drawn in
+	// the page's initial graphics state. Each stamp gets its own name, so a
+	// copy stamped again keeps its earlier stamps.
+	save := stream("q")
+	name := pdfStampName + pdfName(strconv.Itoa(save))
+	restore := stream("Q q /" + string(name) + " Do Q")
+	forms := map[[4]float64]int{}
+	for _, page := range pages {
+		form, ok := forms[page.mediaBox]
+		if !ok {
+			form = stream(pdfStampContent(page.mediaBox, text),
+				pdfName("Type"), pdfName("XObject"), pdfName("Subtype"), pdfName("Form"),
+				pdfName("BBox"), pdfBox(page.mediaBox), pdfName("Resources"), pdfStampResources())
+			forms[page.mediaBox] = form
+		}
+
+		dict := page.dict.copy()
+		resources := newPDFDict()
+		if value, err := f.resolve(page.resources); err == nil {
+			if d, ok := value.(*pdfDict); ok {
+				resources = d.copy()
+			}
+		}
+		xobjects := newPDFDict()
+		if value, err := f.resolve(resources.get("XObject")); err == nil {
+			if d, ok := value.(*pdfDict); ok {
+				xobjects = d.copy()
+			}
+		}
+		xobjects.set(name, pdfRef{form, 0})
+		resources.set("XObject", xobjects)
+		dict.set("Resources", resources)
+
+		contents := pdfArray{pdfRef{save, 0}}
+		switch value := dict.get("Contents").(type) {
+		case pdfArray:
+			contents = append(contents, value...)
+		case pdfRef:
+			if resolved, err := f.resolve(value); err == nil {
+				if array, ok := resolved.(pdfArray); ok {
+					contents = append(contents, array...)
+					break
+				}
+			}
+			contents = append(contents, value)
+		}
+		dict.set("Contents", append(contents, pdfRef{restore, 0}))
+		object(page.ref.num, page.ref.gen, dict, "")
+	}
+
+	info := newPDFDict()
+	infoRef, ok := f.trailer.get("Info").(pdfRef)
+	if ok {
+		if value, err := f.resolve(infoRef); err == nil {
+			if d, ok := value.(*pdfDict); ok {
+				info = d.copy()
+			}
+		}
+	} else {
+		infoRef = pdfRef{next, 0}
+		next++
+	}
+	info.set(pdfStampName, pdfRaw("("+pdfEscape(text)+")"))
+	object(infoRef.num, infoRef.gen, info, "")
+
+	trailer := newPDFDict()
+	trailer.set("Size", pdfRaw(strconv.Itoa(next)))
+	trailer.set("Root", f.trailer.get("Root"))
+	trailer.set("Info", infoRef)
+	if id := f.trailer.get("ID"); id != nil {
+		trailer.set("ID", id)
+	}
+	trailer.set("Prev", pdfRaw(strconv.Itoa(f.startxref)))
+
+	if f.xrefStream {
+		// Files indexed by cross-reference streams are updated with one
+		// too, which lists itself
+		num := next
+		next++
+		trailer.set("Size", pdfRaw(strconv.Itoa(next)))
+		if int64(out.Len()) > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: too large", ErrUnsupportedPDF)
+		}
+		written[num] = pdfXrefEntry{inUse: true, offset: out.Len()}
+		var rows bytes.Buffer
+		var index pdfArray
+		for _, run := range pdfXrefRuns(written) {
+			index = append(index, pdfRaw(strconv.Itoa(run[0])), pdfRaw(strconv.Itoa(run[1])))
+			for n := run[0]; n < run[0]+run[1]; n++ {
+				entry := written[n]
+				rows.Write([]byte{1, byte(entry.offset >> 24), byte(entry.offset >> 16), byte(entry.offset >> 8), byte(entry.offset), byte(entry.gen >> 8), byte(entry.gen)})
+			}
+		}
+		xref := out.Len()
+		trailer.set("Type", pdfName("XRef"))
+		trailer.set("W", pdfArray{pdfRaw("1"), pdfRaw("4"), pdfRaw("2")})
+		trailer.set("Index", index)
+		trailer.set("Length", pdfRaw(strconv.Itoa(rows.Len())))
+		fmt.Fprintf(&out, "%d 0 obj\n", num)
+		writePDFValue(&out, trailer)
+		out.WriteString("\nstream\n")
+		out.Write(rows.Bytes())
+		fmt.Fprintf(&out, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xref)
+		return out.Bytes(), nil
+	}
+
+	xref := out.Len()
+	out.WriteString("xref\n")
+	for _, run := range pdfXrefRuns(written) {
+		fmt.Fprintf(&out, "%d %d\n", run[0], run[1])
+		for n := run[0]; n < run[0]+run[1]; n++ {
+			fmt.Fprintf(&out, "%010d %05d n \n", written[n].offset, written[n].gen)
+		}
+	}
+	out.WriteString("trailer\n")
+	writePDFValue(&out, trailer)
+	fmt.Fprintf(&out, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	return out.Bytes(), nil
+}
+
+// pdfXrefRuns groups object numbers into runs of consecutive numbers, as
+// start and count
+func pdfXrefRuns(entries map[int]pdfXrefEntry) [][2]int {
+	nums := make([]int, 0, len(entries))
+	for num := range entries {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	var runs [][2]int
+	for _, num := range nums {
+		if len(runs) > 0 && runs[len(runs)-1][0]+runs[len(runs)-1][1] == num {
+			runs[len(runs)-1][1]++
+			continue
+		}
+		runs = append(runs, [2]int{num, 1})
+	}
+	return runs
+}
+
+func pdfBox(box [4]float64) pdfArray {
+	array := make(pdfArray, len(box))
+	for i, n := range box {
+		array[i] = pdfRaw(strconv.FormatFloat(n, 'f', -1, 64))
+	}
+	return array
+}
+
+// pdfStampResources are the font and transparency the stamp is drawn with
+func pdfStampResources() *pdfDict {
+	font := newPDFDict()
+	font.set("Type", pdfName("Font"))
+	font.set("Subtype", pdfName("Type1"))
+	font.set("BaseFont", pdfName("Helvetica"))
+	font.set("Encoding", pdfName("WinAnsiEncoding"))
+	fonts := newPDFDict()
+	fonts.set("F1", font)
+
+	state := newPDFDict()
+	state.set("Type", pdfName("ExtGState"))
+	state.set("ca", pdfRaw("0.18"))
+	states := newPDFDict()
+	states.set("GS1", state)
+
+	resources := newPDFDict()
+	resources.set("Font", fonts)
+	resources.set("ExtGState", states)
+	return resources
+}
+
+// pdfStampContent draws text faintly across the diagonal of box and in
+// small print at its foot
+func pdfStampContent(box [4]float64, text string) string {
+	width, height := box[2]-box[0], box[3]-box[1]
+	escaped := pdfEscape(text)
+	var b strings.Builder
+
+	// Helvetica averages half its size per character
+	chars := float64(len([]rune(text)))
+	diagonal := math.Hypot(width, height)
+	size := math.Min(40, math.Max(8, 0.8*diagonal/(0.5*chars)))
+	angle := math.Atan2(height, width)
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	half := 0.25 * size * chars
+	x := box[0] + width/2 - cos*half + sin*size/3
+	y := box[1] + height/2 - sin*half - cos*size/3
+	fmt.Fprintf(&b, "q /GS1 gs 0.8 0 0 rg BT /F1 %.1f Tf %.4f %.4f %.4f %.4f %.2f %.2f Tm (%s) Tj ET Q\n",
+		size, cos, sin, -sin, cos, x, y, escaped)
+
+	const footer = 7.0
+	lines := pdfWrap(text, footer, width-24)
+	for i, line := range lines {
+		fmt.Fprintf(&b, "q 0.6 0 0 rg BT /F1 %.1f Tf %.2f %.2f Td (%s) Tj ET Q\n",
+			footer, box[0]+12, box[1]+8+float64(len(lines)-1-i)*footer*1.3, pdfEscape(line))
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of personal data found by DetectPII besides the entity kinds
+const (
+	PIIName    = "name"
+	PIIAddress = "address"
+)
+
+// piiEntityKinds are the entity kinds that identify a person. URLs and
+// domains are kept: they identify the sites fraud is run from.
+var piiEntityKinds = map[string]bool{"email": true, "phone": true, "iban": true, "account": true}
+
+// piiPatterns find names and street addresses. Names are only recognized
+// after a title or a label such as "Customer:", since a capitalized word
+// alone is too often something else. The value is the submatch group.
+var piiPatterns = []struct {
+	kind  string
+	re    *regexp.Regexp
+	group int
+}{
+	{PIIName, regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Mx|Dr|Prof)\.?[ \t]+([A-Z][a-z'\-]+(?:[ \t]+[A-Z][a-z'\-]+){0,2})`), 1},
+	{PIIName, regexp.MustCompile(`(?i:\b(?:name|customer|account holder|payee|payer|beneficiary|applicant|employee|dear))[ \t]*[:,]?[ \t]+([A-Z][a-z'\-]+(?:[ \t]+[A-Z][a-z'\-]+){1,2})`), 1},
+	{PIIAddress, regexp.MustCompile(`\b\d{1,5}[ \t]+(?:[A-Z][a-z]+[ \t]+){1,3}(?:Street|St|Avenue|Ave|Road|Rd|Lane|Ln|Drive|Dr|Boulevard|Blvd|Court|Ct|Way|Place|Pl|Terrace|Close)\b`), 0},
+}
+
+// PIIMatch is personal data found in text, at text[Start:End]
+type PIIMatch struct {
+	Kind  string
+	Value string
+	Start int
+	End   int
+}
+
+// DetectPII finds the names, street addresses, email addresses, phone
+// numbers, IBANs and account numbers in text, in order. Entity values are
+// normalized as ExtractEntities does. Where matches overlap the first, then
+// the longest, is kept.
+func DetectPII(text string) []PIIMatch {
+	var matches []PIIMatch
+	for _, pattern := range entityPatterns {
+		if !piiEntityKinds[pattern.kind] {
+			continue
+		}
+		for _, loc := range pattern.re.FindAllStringIndex(text, -1) {
+			if value := pattern.normalize(text[loc[0]:loc[1]]); value != "" {
+				matches = append(matches, PIIMatch{Kind: pattern.kind, Value: value, Start: loc[0], End: loc[1]})
+			}
+		}
+	}
+	for _, pattern := range piiPatterns {
+		for _, loc := range pattern.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[2*pattern.group], loc[2*pattern.group+1]
+			value := strings.Join(strings.Fields(text[start:end]), " ")
+			matches = append(matches, PIIMatch{Kind: pattern.kind, Value: value, Start: start, End: end})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Start != matches[j].Start {
+			return matches[i].Start < matches[j].Start
+		}
+		return matches[i].End > matches[j].End
+	})
+	kept := matches[:0]
+	for _, match := range matches {
+		if len(kept) > 0 && match.Start < kept[len(kept)-1].End {
+			continue
+		}
+		kept = append(kept, match)
+	}
+	return kept
+}
+
+// RedactPII replaces the personal data in text with its kind, such as
+// "[EMAIL]", for logs where not even a pseudonym is wanted
+func RedactPII(text string) string {
+	matches := DetectPII(text)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		b.WriteString(text[last:match.Start])
+		b.WriteString("[" + strings.ToUpper(match.Kind) + "]")
+		last = match.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Pseudonym is a token standing in for a value in anonymized exports. The
+// values are kept in the pseudonym vault, apart from the exports.
+type Pseudonym struct {
+	Token string `json:"token"`
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Pseudonymizer replaces personal data with tokens keyed by a secret, so the
+// same value gets the same token in every export while the token reveals
+// nothing without the key or the vault
+type Pseudonymizer struct {
+	key []byte
+}
+
+// NewPseudonymizer returns nil when key is empty
+func NewPseudonymizer(key string) *Pseudonymizer {
+	if key == "" {
+		return nil
+	}
+	return &Pseudonymizer{key: []byte(key)}
+}
+
+// Pseudonym returns the token for a value of a kind. Names compare without
+// regard to case.
+func (p *Pseudonymizer) Pseudonym(kind, value string) Pseudonym {
+	normalized := value
+	if kind == PIIName || kind == PIIAddress {
+		normalized = strings.ToLower(value)
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(kind + ":" + normalized))
+	token := strings.ToUpper(kind) + "_" + hex.EncodeToString(mac.Sum(nil))[:16]
+	return Pseudonym{Token: token, Kind: kind, Value: value}
+}
+
+// Anonymize replaces the personal data in text with "[TOKEN]" and adds the
+// pseudonyms used to seen, by token
+func (p *Pseudonymizer) Anonymize(text string, seen map[string]Pseudonym) string {
+	matches := DetectPII(text)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		pseudonym := p.Pseudonym(match.Kind, match.Value)
+		seen[pseudonym.Token] = pseudonym
+		b.WriteString(text[last:match.Start])
+		b.WriteString("[" + pseudonym.Token + "]")
+		last = match.End
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
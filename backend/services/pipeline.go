@@ -0,0 +1,404 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// Pipeline stages. Every pipeline extracts text and analyzes it: AI
+// analysis is what moves a document to the processed status, so tenants
+// cannot skip it either.
+const (
+	// StageExtraction reads the text of the stored file
+	StageExtraction = "extraction"
+	// StageFieldParsing extracts the entities (amounts, accounts, links)
+	// of the text
+	StageFieldParsing = "field_parsing"
+	// StageRules records the risk factors found during extraction and links
+	// to blocklisted or lookalike domains
+	StageRules = "rules"
+	// StageAIAnalysis scores the text with the tenant's analyzer and stores
+	// the result
+	StageAIAnalysis = "ai_analysis"
+	// StageEmbedding stores the text's embedding for semantic search
+	StageEmbedding = "embedding"
+	// StageExemplarMatching raises alerts for documents resembling known
+	// fraud
+	StageExemplarMatching = "exemplar_matching"
+)
+
+var pipelineStages = []string{
+	StageExtraction, StageFieldParsing, StageRules, StageAIAnalysis, StageEmbedding, StageExemplarMatching,
+}
+
+// stageInputs are the stages whose output a stage reads. A stage must depend,
+// directly or not, on those of its inputs that are in the pipeline, so it
+// does not run before they finish.
+var stageInputs = map[string][]string{
+	StageFieldParsing:     {StageExtraction},
+	StageRules:            {StageExtraction, StageFieldParsing},
+	StageAIAnalysis:       {StageExtraction},
+	StageEmbedding:        {StageExtraction},
+	StageExemplarMatching: {StageExtraction, StageFieldParsing, StageEmbedding},
+}
+
+// Stage outcomes
+const (
+	StageSucceeded = "succeeded"
+	StageFailed    = "failed"
+	// StageSkipped stages were not run, because the tenant skips them or a
+	// stage they depend on failed
+	StageSkipped = "skipped"
+)
+
+// StageSpec is one stage of a pipeline definition
+type StageSpec struct {
+	Name      string   `json:"name"`
+	DependsOn []string `json:"depends_on,omitempty"`
+	// Retries is how many more times the stage is attempted after failing
+	Retries int `json:"retries,omitempty"`
+	// Timeout bounds each attempt, e.g. "2m"; empty leaves it to the stage
+	Timeout string `json:"timeout,omitempty"`
+	// ContinueOnFailure runs the dependents even when the stage fails, for
+	// stages whose output they can do without
+	ContinueOnFailure bool `json:"continue_on_failure,omitempty"`
+}
+
+// PipelineDefinition lists the stages of a pipeline. Stages run as soon as
+// the stages they depend on have finished, so independent stages run
+// concurrently.
+type PipelineDefinition struct {
+	Stages []StageSpec `json:"stages"`
+}
+
+// PipelinesFile is the format of PIPELINE_CONFIG_FILE. Pipelines maps a
+// document type to its pipeline; "default" is used for other types.
+// Tenants lists the stages each tenant, by slug, skips.
+type PipelinesFile struct {
+	Pipelines map[string]PipelineDefinition `json:"pipelines"`
+	Tenants   map[string]struct {
+		Skip []string `json:"skip"`
+	} `json:"tenants"`
+}
+
+// DefaultPipeline analyzes text as soon as it is extracted, alongside entity
+// extraction and embedding. Extraction, entities and embeddings are all
+// optional to their dependents: without text a placeholder is analyzed so
+// the document still leaves the uploaded status.
+func DefaultPipeline() PipelineDefinition {
+	return PipelineDefinition{Stages: []StageSpec{
+		{Name: StageExtraction, Retries: 1, ContinueOnFailure: true},
+		{Name: StageAIAnalysis, DependsOn: []string{StageExtraction}, Retries: 2},
+		{Name: StageFieldParsing, DependsOn: []string{StageExtraction}, ContinueOnFailure: true},
+		{Name: StageRules, DependsOn: []string{StageFieldParsing}},
+		{Name: StageEmbedding, DependsOn: []string{StageExtraction}, Retries: 1, ContinueOnFailure: true},
+		{Name: StageExemplarMatching, DependsOn: []string{StageFieldParsing, StageEmbedding}},
+	}}
+}
+
+// Pipeline is a validated pipeline definition
+type Pipeline struct {
+	// stages are in dependency order
+	stages []*pipelineStage
+}
+
+type pipelineStage struct {
+	StageSpec
+	timeout time.Duration
+}
+
+// NewPipeline checks that definition names known stages, includes
+// extraction and AI analysis, and orders every stage after its inputs without
+// dependency cycles
+func NewPipeline(definition PipelineDefinition) (*Pipeline, error) {
+	specs := map[string]StageSpec{}
+	for _, spec := range definition.Stages {
+		if !isPipelineStage(spec.Name) {
+			return nil, fmt.Errorf("unknown stage %q (available: %s)", spec.Name, strings.Join(pipelineStages, ", "))
+		}
+		if _, ok := specs[spec.Name]; ok {
+			return nil, fmt.Errorf("stage %s is listed twice", spec.Name)
+		}
+		if spec.Retries < 0 {
+			return nil, fmt.Errorf("stage %s has negative retries", spec.Name)
+		}
+		specs[spec.Name] = spec
+	}
+	for _, required := range []string{StageExtraction, StageAIAnalysis} {
+		if _, ok := specs[required]; !ok {
+			return nil, fmt.Errorf("pipeline has no %s stage", required)
+		}
+	}
+
+	p := &Pipeline{}
+	// Order the stages depth first, failing on a dependency that is missing
+	// or leads back to the stage
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("stage %s is part of a dependency cycle", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		spec := specs[name]
+		for _, dependency := range spec.DependsOn {
+			if _, ok := specs[dependency]; !ok {
+				return fmt.Errorf("stage %s depends on %q, which is not in the pipeline", name, dependency)
+			}
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+
+		stage := &pipelineStage{StageSpec: spec}
+		if spec.Timeout != "" {
+			timeout, err := time.ParseDuration(spec.Timeout)
+			if err != nil || timeout <= 0 {
+				return fmt.Errorf("stage %s has invalid timeout %q", name, spec.Timeout)
+			}
+			stage.timeout = timeout
+		}
+		p.stages = append(p.stages, stage)
+		return nil
+	}
+	for _, spec := range definition.Stages {
+		if err := visit(spec.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	// Stages come after their dependencies, so each one's ancestors are
+	// known when it is reached
+	ancestors := map[string]map[string]bool{}
+	for _, stage := range p.stages {
+		own := map[string]bool{}
+		for _, dependency := range stage.DependsOn {
+			own[dependency] = true
+			for ancestor := range ancestors[dependency] {
+				own[ancestor] = true
+			}
+		}
+		ancestors[stage.Name] = own
+		for _, input := range stageInputs[stage.Name] {
+			if _, ok := specs[input]; ok && !own[input] {
+				return nil, fmt.Errorf("stage %s uses the output of %s and must depend on it", stage.Name, input)
+			}
+		}
+	}
+	return p, nil
+}
+
+func isPipelineStage(name string) bool {
+	for _, stage := range pipelineStages {
+		if stage == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Stages returns the names of the pipeline's stages in dependency order
+func (p *Pipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// StageFunc runs one attempt of a stage
+type StageFunc func(ctx context.Context) error
+
+// StageResult is how one stage of a pipeline run went
+type StageResult struct {
+	Stage     string
+	Outcome   string
+	Attempts  int
+	StartedAt time.Time
+	Duration  time.Duration
+	Error     string
+}
+
+// Run runs the stages, each with its StageFunc, and returns their results in
+// dependency order. A failed attempt is retried after retryDelay, doubling
+// for each further attempt. Stages in skip are not run and count as done for
+// their dependents.
+func (p *Pipeline) Run(ctx context.Context, funcs map[string]StageFunc, skip map[string]bool, retryDelay time.Duration) []StageResult {
+	results := make([]StageResult, len(p.stages))
+	done := make(map[string]chan struct{}, len(p.stages))
+	index := make(map[string]int, len(p.stages))
+	for i, stage := range p.stages {
+		done[stage.Name] = make(chan struct{})
+		index[stage.Name] = i
+	}
+
+	var wg sync.WaitGroup
+	for i, stage := range p.stages {
+		wg.Add(1)
+		go func(i int, stage *pipelineStage) {
+			defer wg.Done()
+			defer close(done[stage.Name])
+			result := &results[i]
+			result.Stage = stage.Name
+
+			for _, dependency := range stage.DependsOn {
+				<-done[dependency]
+				// Dependencies are finished, so their results are final
+				dependencyResult := results[index[dependency]]
+				if dependencyResult.Outcome == StageFailed && !p.stages[index[dependency]].ContinueOnFailure ||
+					dependencyResult.Outcome == StageSkipped && dependencyResult.Error != "" {
+					result.Outcome = StageSkipped
+					result.Error = "depends on " + dependency + ", which did not complete"
+					return
+				}
+			}
+			if skip[stage.Name] {
+				result.Outcome = StageSkipped
+				return
+			}
+			run := funcs[stage.Name]
+			if run == nil {
+				result.Outcome = StageSkipped
+				return
+			}
+
+			result.StartedAt = time.Now()
+			delay := retryDelay
+			for {
+				result.Attempts++
+				err := runStage(ctx, stage, run)
+				if err == nil {
+					result.Outcome = StageSucceeded
+					result.Error = ""
+					break
+				}
+				result.Outcome = StageFailed
+				result.Error = err.Error()
+				if result.Attempts > stage.Retries || ctx.Err() != nil {
+					break
+				}
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+				}
+				delay *= 2
+			}
+			result.Duration = time.Since(result.StartedAt)
+		}(i, stage)
+	}
+	wg.Wait()
+	return results
+}
+
+func runStage(ctx context.Context, stage *pipelineStage, run StageFunc) error {
+	if stage.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, stage.timeout)
+		defer cancel()
+	}
+	return run(ctx)
+}
+
+// PipelineSet holds the pipeline of each document type and the stages each
+// tenant skips
+type PipelineSet struct {
+	defaultPipeline *Pipeline
+	byType          map[string]*Pipeline
+	tenantSkips     map[string]map[string]bool
+	retryDelay      time.Duration
+}
+
+// NewPipelineSet reads the pipelines from cfg.File, a PipelinesFile.
+// Document types without a pipeline, and all of them when the file gives no
+// "default" or there is no file, run DefaultPipeline.
+func NewPipelineSet(cfg config.PipelineConfig) (*PipelineSet, error) {
+	pipeline, err := NewPipeline(DefaultPipeline())
+	if err != nil {
+		return nil, err
+	}
+	set := &PipelineSet{
+		defaultPipeline: pipeline,
+		byType:          map[string]*Pipeline{},
+		tenantSkips:     map[string]map[string]bool{},
+		retryDelay:      cfg.RetryDelay,
+	}
+	if cfg.File == "" {
+		return set, nil
+	}
+
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline config: %v", err)
+	}
+	var file PipelinesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse pipeline config %s: %v", cfg.File, err)
+	}
+	for documentType, definition := range file.Pipelines {
+		pipeline, err := NewPipeline(definition)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pipeline %s in %s: %v", documentType, cfg.File, err)
+		}
+		if documentType == "default" {
+			set.defaultPipeline = pipeline
+		} else {
+			set.byType[documentType] = pipeline
+		}
+	}
+	for tenant, settings := range file.Tenants {
+		skips := map[string]bool{}
+		for _, stage := range settings.Skip {
+			if !isPipelineStage(stage) {
+				return nil, fmt.Errorf("tenant %s skips unknown stage %q in %s", tenant, stage, cfg.File)
+			}
+			if stage == StageExtraction || stage == StageAIAnalysis {
+				return nil, fmt.Errorf("tenant %s cannot skip %s in %s", tenant, stage, cfg.File)
+			}
+			skips[stage] = true
+		}
+		set.tenantSkips[tenant] = skips
+	}
+	return set, nil
+}
+
+// For returns the pipeline of a document type
+func (s *PipelineSet) For(documentType *string) *Pipeline {
+	if documentType != nil {
+		if pipeline, ok := s.byType[*documentType]; ok {
+			return pipeline
+		}
+	}
+	return s.defaultPipeline
+}
+
+// Run runs the pipeline of a document type, without the stages the tenant
+// (by slug) skips
+func (s *PipelineSet) Run(ctx context.Context, documentType *string, tenant string, funcs map[string]StageFunc) []StageResult {
+	return s.For(documentType).Run(ctx, funcs, s.tenantSkips[tenant], s.retryDelay)
+}
+
+// DocumentTypes lists the document types with their own pipeline
+func (s *PipelineSet) DocumentTypes() []string {
+	types := make([]string, 0, len(s.byType))
+	for documentType := range s.byType {
+		types = append(types, documentType)
+	}
+	sort.Strings(types)
+	return types
+}
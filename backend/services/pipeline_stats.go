@@ -0,0 +1,278 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// PipelineStageRun is a stored StageResult
+type PipelineStageRun struct {
+	Run          int        `json:"run"`
+	RunStartedAt time.Time  `json:"run_started_at"`
+	Stage        string     `json:"stage"`
+	Outcome      string     `json:"outcome"`
+	Attempts     int        `json:"attempts"`
+	StartedAt    *time.Time `json:"started_at"`
+	DurationMs   float64    `json:"duration_ms"`
+	Error        *string    `json:"error,omitempty"`
+}
+
+// PipelineStats summarizes the stage runs of pipelines started since a point
+// in time. Bottleneck is the stage with the highest p95 duration.
+type PipelineStats struct {
+	Since      time.Time     `json:"since"`
+	Stages     []*StageStats `json:"stages"`
+	Bottleneck *string       `json:"bottleneck"`
+}
+
+// StageStats aggregates one stage. Runs counts the stage's runs that were
+// not skipped; the failure rate and percentiles are of those and nil when
+// there were none.
+type StageStats struct {
+	Stage       string   `json:"stage"`
+	Runs        int      `json:"runs"`
+	Failures    int      `json:"failures"`
+	Skipped     int      `json:"skipped"`
+	Retries     int      `json:"retries"`
+	FailureRate *float64 `json:"failure_rate"`
+	P50Ms       *float64 `json:"p50_ms"`
+	P95Ms       *float64 `json:"p95_ms"`
+}
+
+// NewPipelineStageRuns converts the results of a pipeline run started at
+// runStartedAt for storage
+func NewPipelineStageRuns(runStartedAt time.Time, results []StageResult) []*PipelineStageRun {
+	runs := make([]*PipelineStageRun, len(results))
+	for i, result := range results {
+		run := &PipelineStageRun{
+			RunStartedAt: runStartedAt,
+			Stage:        result.Stage,
+			Outcome:      result.Outcome,
+			Attempts:     result.Attempts,
+			DurationMs:   float64(result.Duration) / float64(time.Millisecond),
+		}
+		if !result.StartedAt.IsZero() {
+			startedAt := result.StartedAt
+			run.StartedAt = &startedAt
+		}
+		if result.Error != "" {
+			err := result.Error
+			run.Error = &err
+		}
+		runs[i] = run
+	}
+	return runs
+}
+
+// RecordPipelineRun stores the stages of one pipeline run of the document,
+// numbering the run after the document's previous ones
+func (d *DatabaseService) RecordPipelineRun(documentID DocumentID, stages []*PipelineStageRun) error {
+	return withRetry("record_pipeline_run", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		// Runs of the document recorded at the same time take turns on its
+		// row, so none takes the number of another. SQLite serializes
+		// writers, so there is no row lock to take.
+		if d.db.dialect != dialectSQLite {
+			var locked DocumentID
+			err = tx.QueryRow(`SELECT id FROM documents WHERE id = $1 FOR UPDATE`, documentID).Scan(&locked)
+			if err != nil {
+				return fmt.Errorf("failed to lock document for pipeline run: %w", err)
+			}
+		}
+		var run int
+		err = tx.QueryRow(`SELECT COALESCE(MAX(run), 0) + 1 FROM pipeline_stage_runs WHERE document_id = $1`, documentID).Scan(&run)
+		if err != nil {
+			return fmt.Errorf("failed to number pipeline run: %w", err)
+		}
+		for _, stage := range stages {
+			var startedAt interface{}
+			if stage.StartedAt != nil {
+				startedAt = d.db.dialect.timeArg(*stage.StartedAt)
+			}
+			_, err := tx.Exec(`
+				INSERT INTO pipeline_stage_runs
+					(document_id, run, run_started_at, stage, outcome, attempts, started_at, duration_ms, error)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				documentID, run, d.db.dialect.timeArg(stage.RunStartedAt), stage.Stage, stage.Outcome,
+				stage.Attempts, startedAt, stage.DurationMs, stage.Error)
+			if err != nil {
+				return fmt.Errorf("failed to record pipeline stage %s: %w", stage.Stage, err)
+			}
+			stage.Run = run
+		}
+		return tx.Commit()
+	})
+}
+
+// GetPipelineStageRuns returns the stages of the document's latest pipeline
+// run, in the order they were recorded
+func (d *DatabaseService) GetPipelineStageRuns(documentID DocumentID) ([]*PipelineStageRun, error) {
+	rows, err := d.db.Query(`
+		SELECT run, run_started_at, stage, outcome, attempts, started_at, duration_ms, error
+		FROM pipeline_stage_runs
+		WHERE document_id = $1
+		  AND run = (SELECT MAX(run) FROM pipeline_stage_runs WHERE document_id = $1)
+		ORDER BY id`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pipeline stages: %v", err)
+	}
+	defer rows.Close()
+
+	stages := []*PipelineStageRun{}
+	for rows.Next() {
+		stage := &PipelineStageRun{}
+		var startedAt sql.NullTime
+		var stageErr sql.NullString
+		if err := rows.Scan(&stage.Run, &stage.RunStartedAt, &stage.Stage, &stage.Outcome, &stage.Attempts,
+			&startedAt, &stage.DurationMs, &stageErr); err != nil {
+			return nil, err
+		}
+		if startedAt.Valid {
+			stage.StartedAt = &startedAt.Time
+		}
+		if stageErr.Valid {
+			stage.Error = &stageErr.String
+		}
+		stages = append(stages, stage)
+	}
+	return stages, rows.Err()
+}
+
+// GetPipelineStats aggregates the stages of pipeline runs started since
+// since. Postgres computes the percentiles; SQLite has no percentile
+// functions, so there the durations are read and summarized here.
+func (d *DatabaseService) GetPipelineStats(since time.Time) (*PipelineStats, error) {
+	sinceArg := d.db.dialect.timeArg(since)
+	if d.db.dialect == dialectSQLite {
+		rows, err := d.db.Query(`
+			SELECT stage, outcome, attempts, duration_ms
+			FROM pipeline_stage_runs WHERE run_started_at >= $1`, sinceArg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query pipeline stages: %v", err)
+		}
+		defer rows.Close()
+		var stages []*PipelineStageRun
+		for rows.Next() {
+			stage := &PipelineStageRun{}
+			if err := rows.Scan(&stage.Stage, &stage.Outcome, &stage.Attempts, &stage.DurationMs); err != nil {
+				return nil, err
+			}
+			stages = append(stages, stage)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return SummarizePipelineStages(since, stages), nil
+	}
+
+	rows, err := d.db.Query(`
+		SELECT stage,
+		       COUNT(*) FILTER (WHERE outcome <> 'skipped'),
+		       COUNT(*) FILTER (WHERE outcome = 'failed'),
+		       COUNT(*) FILTER (WHERE outcome = 'skipped'),
+		       COALESCE(SUM(attempts - 1) FILTER (WHERE outcome <> 'skipped'), 0),
+		       percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_ms) FILTER (WHERE outcome <> 'skipped'),
+		       percentile_cont(0.95) WITHIN GROUP (ORDER BY duration_ms) FILTER (WHERE outcome <> 'skipped')
+		FROM pipeline_stage_runs
+		WHERE run_started_at >= $1
+		GROUP BY stage
+		ORDER BY stage`, sinceArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate pipeline stages: %v", err)
+	}
+	defer rows.Close()
+
+	stats := &PipelineStats{Since: since, Stages: []*StageStats{}}
+	for rows.Next() {
+		stage := &StageStats{}
+		var p50, p95 sql.NullFloat64
+		if err := rows.Scan(&stage.Stage, &stage.Runs, &stage.Failures, &stage.Skipped, &stage.Retries, &p50, &p95); err != nil {
+			return nil, err
+		}
+		if p50.Valid {
+			stage.P50Ms, stage.P95Ms = &p50.Float64, &p95.Float64
+		}
+		stage.FailureRate = failureRate(stage.Failures, stage.Runs)
+		stats.Stages = append(stats.Stages, stage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	stats.Bottleneck = bottleneck(stats.Stages)
+	return stats, nil
+}
+
+// SummarizePipelineStages aggregates stage runs into PipelineStats, with
+// percentiles interpolated like Postgres' percentile_cont
+func SummarizePipelineStages(since time.Time, runs []*PipelineStageRun) *PipelineStats {
+	byStage := map[string]*StageStats{}
+	durations := map[string][]float64{}
+	for _, run := range runs {
+		stage := byStage[run.Stage]
+		if stage == nil {
+			stage = &StageStats{Stage: run.Stage}
+			byStage[run.Stage] = stage
+		}
+		if run.Outcome == StageSkipped {
+			stage.Skipped++
+			continue
+		}
+		stage.Runs++
+		stage.Retries += run.Attempts - 1
+		if run.Outcome == StageFailed {
+			stage.Failures++
+		}
+		durations[run.Stage] = append(durations[run.Stage], run.DurationMs)
+	}
+
+	stats := &PipelineStats{Since: since, Stages: []*StageStats{}}
+	for name, stage := range byStage {
+		if values := durations[name]; len(values) > 0 {
+			sort.Float64s(values)
+			p50, p95 := percentile(values, 0.5), percentile(values, 0.95)
+			stage.P50Ms, stage.P95Ms = &p50, &p95
+		}
+		stage.FailureRate = failureRate(stage.Failures, stage.Runs)
+		stats.Stages = append(stats.Stages, stage)
+	}
+	sort.Slice(stats.Stages, func(i, j int) bool { return stats.Stages[i].Stage < stats.Stages[j].Stage })
+	stats.Bottleneck = bottleneck(stats.Stages)
+	return stats
+}
+
+// percentile interpolates between the closest ranks of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	position := p * float64(len(sorted)-1)
+	lower := int(math.Floor(position))
+	upper := int(math.Ceil(position))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(position-float64(lower))
+}
+
+func failureRate(failures, runs int) *float64 {
+	if runs == 0 {
+		return nil
+	}
+	rate := float64(failures) / float64(runs)
+	return &rate
+}
+
+func bottleneck(stages []*StageStats) *string {
+	var slowest *StageStats
+	for _, stage := range stages {
+		if stage.P95Ms != nil && (slowest == nil || *stage.P95Ms > *slowest.P95Ms) {
+			slowest = stage
+		}
+	}
+	if slowest == nil {
+		return nil
+	}
+	return &slowest.Stage
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Kinds of data subject requests
+const (
+	PrivacyExport = "export"
+	PrivacyErase  = "erase"
+)
+
+var (
+	// ErrLegalHold is returned when erasing a document that must be kept
+	ErrLegalHold = errors.New("document is under legal hold")
+	// ErrHoldExists is returned when placing a hold on a document that is
+	// already held
+	ErrHoldExists = errors.New("document is already under legal hold")
+)
+
+// DataSubject identifies the person a privacy request is about by an entity
+// value found in documents, such as an email address or IBAN. Without a kind
+// the value is matched against every kind of entity.
+type DataSubject struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Validate checks that the subject has a value and, if given, a known kind
+func (s DataSubject) Validate() error {
+	if strings.TrimSpace(s.Value) == "" {
+		return errors.New("value is required")
+	}
+	if s.Kind == "" {
+		return nil
+	}
+	for _, pattern := range entityPatterns {
+		if pattern.kind == s.Kind {
+			return nil
+		}
+	}
+	kinds := make([]string, len(entityPatterns))
+	for i, pattern := range entityPatterns {
+		kinds[i] = pattern.kind
+	}
+	return fmt.Errorf("kind must be one of %s", strings.Join(kinds, ", "))
+}
+
+// entities normalizes the value the way ExtractEntities does for each kind
+// it may be, so it matches the stored entities
+func (s DataSubject) entities() [][2]string {
+	var entities [][2]string
+	for _, pattern := range entityPatterns {
+		if s.Kind != "" && pattern.kind != s.Kind {
+			continue
+		}
+		if value := pattern.normalize(strings.TrimSpace(s.Value)); value != "" {
+			entities = append(entities, [2]string{pattern.kind, value})
+		}
+	}
+	return entities
+}
+
+// Digest identifies the subject in privacy request records without
+// revealing it
+func (s DataSubject) Digest() string {
+	sum := sha256.Sum256([]byte(s.Kind + ":" + strings.ToLower(strings.TrimSpace(s.Value))))
+	return hex.EncodeToString(sum[:])
+}
+
+// FindSubjectDocuments returns the documents in scope with an entity
+// matching the subject, oldest first
+func (d *DatabaseService) FindSubjectDocuments(subject DataSubject, scope DocumentScope) ([]*Document, error) {
+	entities := subject.entities()
+	if len(entities) == 0 {
+		return []*Document{}, nil
+	}
+
+	var args []interface{}
+	var matches []string
+	for _, entity := range entities {
+		args = append(args, entity[0], entity[1])
+		matches = append(matches, fmt.Sprintf("(kind = $%d AND value = $%d)", len(args)-1, len(args)))
+	}
+	conditions := append(scope.conditions(&args),
+		"id IN (SELECT document_id FROM document_entities WHERE "+strings.Join(matches, " OR ")+")")
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY created_at, id`
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subject documents: %v", err)
+	}
+	defer rows.Close()
+
+	documents := []*Document{}
+	for rows.Next() {
+		doc, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// LegalHold keeps a document from being erased or expired until released
+type LegalHold struct {
+	ID         string     `json:"id"`
+	TenantID   *string    `json:"tenant_id"`
+	DocumentID DocumentID `json:"document_id"`
+	Reason     string     `json:"reason"`
+	PlacedBy   *string    `json:"placed_by"`
+	PlacedAt   time.Time  `json:"placed_at"`
+	ReleasedBy *string    `json:"released_by"`
+	ReleasedAt *time.Time `json:"released_at"`
+}
+
+const legalHoldColumns = `id, tenant_id, document_id, reason, placed_by, placed_at, released_by, released_at`
+
+func scanLegalHold(row rowScanner) (*LegalHold, error) {
+	hold := &LegalHold{}
+	err := row.Scan(&hold.ID, &hold.TenantID, &hold.DocumentID, &hold.Reason, &hold.PlacedBy,
+		&hold.PlacedAt, &hold.ReleasedBy, &hold.ReleasedAt)
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// PlaceLegalHold holds a document, taking the tenant from the document. It
+// returns sql.ErrNoRows when there is no such document and ErrHoldExists
+// when it is held already.
+func (d *DatabaseService) PlaceLegalHold(hold *LegalHold) error {
+	return withRetry("place_legal_hold", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if hold.TenantID, err = documentTenant(tx, hold.DocumentID); err != nil {
+			return err
+		}
+		var held bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM legal_holds WHERE document_id = $1 AND released_at IS NULL)`,
+			hold.DocumentID).Scan(&held)
+		if err != nil {
+			return err
+		}
+		if held {
+			return ErrHoldExists
+		}
+
+		err = tx.QueryRow(`
+			INSERT INTO legal_holds (tenant_id, document_id, reason, placed_by)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id, placed_at`, hold.TenantID, hold.DocumentID, hold.Reason, hold.PlacedBy,
+		).Scan(&hold.ID, &hold.PlacedAt)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// ReleaseLegalHold releases an active hold. It returns sql.ErrNoRows when
+// there is no such hold or it was released already.
+func (d *DatabaseService) ReleaseLegalHold(id, releasedBy string) (*LegalHold, error) {
+	var hold *LegalHold
+	err := withRetry("release_legal_hold", func() error {
+		var err error
+		hold, err = scanLegalHold(d.db.QueryRow(`
+			UPDATE legal_holds SET released_by = $2, released_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND released_at IS NULL
+			RETURNING `+legalHoldColumns, id, releasedBy))
+		return err
+	})
+	return hold, err
+}
+
+// GetLegalHolds returns the holds of a tenant, or of every tenant when
+// tenantID is nil, newest first. Released holds are left out unless all is
+// set.
+func (d *DatabaseService) GetLegalHolds(tenantID *string, all bool, limit int) ([]*LegalHold, error) {
+	query := `SELECT ` + legalHoldColumns + ` FROM legal_holds`
+	var args []interface{}
+	var conditions []string
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		conditions = append(conditions, fmt.Sprintf("tenant_id = $%d", len(args)))
+	}
+	if !all {
+		conditions = append(conditions, "released_at IS NULL")
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY placed_at DESC, id LIMIT $%d", len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query legal holds: %v", err)
+	}
+	defer rows.Close()
+
+	holds := []*LegalHold{}
+	for rows.Next() {
+		hold, err := scanLegalHold(rows)
+		if err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// retentionReason reports why a document must be kept: an active legal
+// hold, or a SAR draft of an alert raised on it, which would go with it. It
+// returns "" when the document may be erased.
+func retentionReason(q rowQuerier, documentID DocumentID) (string, error) {
+	var reason string
+	err := q.QueryRow(`
+		SELECT 'legal_hold' FROM legal_holds WHERE document_id = $1 AND released_at IS NULL
+		UNION ALL
+		SELECT 'sar_draft' FROM sar_drafts s JOIN alerts a ON a.id = s.alert_id WHERE a.document_id = $1
+		LIMIT 1`, documentID).Scan(&reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return reason, err
+}
+
+// GetRetentionReasons returns why each of the documents that must be kept
+// is kept, by document
+func (d *DatabaseService) GetRetentionReasons(ids []DocumentID) (map[DocumentID]string, error) {
+	reasons := map[DocumentID]string{}
+	for _, id := range ids {
+		reason, err := retentionReason(d.db, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check retention of document %s: %w", id, err)
+		}
+		if reason != "" {
+			reasons[id] = reason
+		}
+	}
+	return reasons, nil
+}
+
+// EraseDocument deletes a document with everything referencing it and
+// redacts the data of its events, which are kept to show the document
+// existed and was erased. It returns the deleted document so its file can
+// be released, ErrLegalHold when the document must be kept and
+// sql.ErrNoRows when it is gone already.
+func (d *DatabaseService) EraseDocument(id DocumentID, requestID string) (*Document, error) {
+	var doc *Document
+	err := withRetry("erase_document", func() error {
+		var err error
+		doc, err = d.eraseDocument(id, requestID)
+		return err
+	})
+	return doc, err
+}
+
+func (d *DatabaseService) eraseDocument(id DocumentID, requestID string) (*Document, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	lockClause := " FOR UPDATE"
+	if d.db.dialect == dialectSQLite {
+		lockClause = ""
+	}
+	doc, err := scanDocument(tx.QueryRow(`SELECT `+documentColumns+` FROM documents WHERE id = $1`+lockClause, id))
+	if err != nil {
+		return nil, err
+	}
+	reason, err := retentionReason(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return nil, ErrLegalHold
+	}
+
+	if _, err := tx.Exec(`DELETE FROM documents WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to delete document %s: %w", id, err)
+	}
+	if err := redactDocumentEvents(tx, id, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err := appendDocumentEvent(tx, id, doc.TenantID, EventDocumentErased, Metadata{"privacy_request_id": requestID}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// PrivacyRequest records a data subject export or erasure
+type PrivacyRequest struct {
+	ID            string     `json:"id"`
+	TenantID      *string    `json:"tenant_id"`
+	Kind          string     `json:"kind"`
+	SubjectSHA256 string     `json:"subject_sha256"`
+	RequestedBy   *string    `json:"requested_by"`
+	Documents     int        `json:"documents"`
+	Erased        int        `json:"erased"`
+	Held          int        `json:"held"`
+	Verified      *bool      `json:"verified"`
+	Details       Metadata   `json:"details"`
+	CreatedAt     time.Time  `json:"created_at"`
+	CompletedAt   *time.Time `json:"completed_at"`
+}
+
+const privacyRequestColumns = `id, tenant_id, kind, subject_sha256, requested_by, documents, erased, held,
+	verified, details, created_at, completed_at`
+
+// CreatePrivacyRequest records a request as it starts
+func (d *DatabaseService) CreatePrivacyRequest(request *PrivacyRequest) error {
+	if request.Details == nil {
+		request.Details = Metadata{}
+	}
+	return withRetry("create_privacy_request", func() error {
+		return d.db.QueryRow(`
+			INSERT INTO privacy_requests (tenant_id, kind, subject_sha256, requested_by, details)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`,
+			request.TenantID, request.Kind, request.SubjectSHA256, request.RequestedBy, request.Details,
+		).Scan(&request.ID, &request.CreatedAt)
+	})
+}
+
+// CompletePrivacyRequest records the outcome of a request
+func (d *DatabaseService) CompletePrivacyRequest(request *PrivacyRequest) error {
+	now := time.Now().UTC()
+	return withRetry("complete_privacy_request", func() error {
+		_, err := d.db.Exec(`
+			UPDATE privacy_requests
+			SET documents = $2, erased = $3, held = $4, verified = $5, details = $6, completed_at = $7
+			WHERE id = $1`,
+			request.ID, request.Documents, request.Erased, request.Held, request.Verified, request.Details,
+			d.db.dialect.timeArg(now))
+		if err == nil {
+			request.CompletedAt = &now
+		}
+		return err
+	})
+}
+
+// GetPrivacyRequests returns the requests of a tenant, or of every tenant
+// when tenantID is nil, newest first
+func (d *DatabaseService) GetPrivacyRequests(tenantID *string, limit int) ([]*PrivacyRequest, error) {
+	query := `SELECT ` + privacyRequestColumns + ` FROM privacy_requests`
+	var args []interface{}
+	if tenantID != nil {
+		args = append(args, *tenantID)
+		query += " WHERE tenant_id = $1"
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id LIMIT $%d", len(args))
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query privacy requests: %v", err)
+	}
+	defer rows.Close()
+
+	requests := []*PrivacyRequest{}
+	for rows.Next() {
+		request := &PrivacyRequest{}
+		err := rows.Scan(&request.ID, &request.TenantID, &request.Kind, &request.SubjectSHA256, &request.RequestedBy,
+			&request.Documents, &request.Erased, &request.Held, &request.Verified, &request.Details,
+			&request.CreatedAt, &request.CompletedAt)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
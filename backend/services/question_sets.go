@@ -0,0 +1,247 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxFraudQuestions bounds a question set, since every question is a model
+// call per analysis
+const maxFraudQuestions = 25
+
+// FraudQuestion is one question the AI service asks of a document. The
+// weight scales the risk found in its answer.
+type FraudQuestion struct {
+	Question   string  `json:"question"`
+	Category   string  `json:"category"`
+	RiskWeight float64 `json:"risk_weight"`
+}
+
+// FraudQuestions is stored as a JSON list
+type FraudQuestions []FraudQuestion
+
+// QuestionSet is one version of a tenant's fraud questions. PromptTemplate,
+// when set, contains {question} and rewords every question before it is
+// asked. Versions are never changed; saving a set adds the next one, which
+// the tenant's analyses use from then on.
+type QuestionSet struct {
+	ID             string         `json:"id"`
+	TenantID       string         `json:"tenant_id"`
+	Version        int            `json:"version"`
+	Questions      FraudQuestions `json:"questions"`
+	PromptTemplate *string        `json:"prompt_template"`
+	CreatedBy      *string        `json:"created_by"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// QuestionSetError lists the problems found in a question set
+type QuestionSetError struct {
+	Problems []string
+}
+
+func (e *QuestionSetError) Error() string {
+	return "invalid question set: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that there are between 1 and maxFraudQuestions questions
+// with categories and weights between 0 and 1, and that a prompt template
+// has the {question} placeholder
+func (q *QuestionSet) Validate() error {
+	var problems []string
+	if len(q.Questions) == 0 {
+		problems = append(problems, "at least one question is required")
+	} else if len(q.Questions) > maxFraudQuestions {
+		problems = append(problems, fmt.Sprintf("at most %d questions are allowed", maxFraudQuestions))
+	}
+
+	seen := map[string]bool{}
+	for i, question := range q.Questions {
+		text := strings.TrimSpace(question.Question)
+		switch {
+		case text == "":
+			problems = append(problems, fmt.Sprintf("questions[%d].question is required", i))
+		case len(text) > 1000:
+			problems = append(problems, fmt.Sprintf("questions[%d].question must be at most 1000 characters", i))
+		case seen[text]:
+			problems = append(problems, fmt.Sprintf("questions[%d].question is repeated", i))
+		}
+		seen[text] = true
+
+		if strings.TrimSpace(question.Category) == "" {
+			problems = append(problems, fmt.Sprintf("questions[%d].category is required", i))
+		} else if len(question.Category) > 50 {
+			problems = append(problems, fmt.Sprintf("questions[%d].category must be at most 50 characters", i))
+		}
+		if question.RiskWeight < 0 || question.RiskWeight > 1 {
+			problems = append(problems, fmt.Sprintf("questions[%d].risk_weight must be between 0 and 1", i))
+		}
+	}
+
+	if q.PromptTemplate != nil {
+		switch {
+		case !strings.Contains(*q.PromptTemplate, "{question}"):
+			problems = append(problems, "prompt_template must contain {question}")
+		case len(*q.PromptTemplate) > 2000:
+			problems = append(problems, "prompt_template must be at most 2000 characters")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &QuestionSetError{Problems: problems}
+	}
+	return nil
+}
+
+func (q FraudQuestions) Value() (driver.Value, error) {
+	b, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (q *FraudQuestions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, q)
+	case string:
+		return json.Unmarshal([]byte(v), q)
+	default:
+		return fmt.Errorf("unsupported fraud questions type %T", src)
+	}
+}
+
+const questionSetColumns = `id, tenant_id, version, questions, prompt_template, created_by, created_at`
+
+func scanQuestionSet(row rowScanner) (*QuestionSet, error) {
+	set := &QuestionSet{}
+	err := row.Scan(&set.ID, &set.TenantID, &set.Version, &set.Questions, &set.PromptTemplate, &set.CreatedBy, &set.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// CreateQuestionSet validates a tenant's question set and stores it as the
+// tenant's next version
+func (d *DatabaseService) CreateQuestionSet(set *QuestionSet) error {
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	return withRetry("create_question_set", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM question_sets WHERE tenant_id = $1`, set.TenantID).Scan(&set.Version)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(`
+			INSERT INTO question_sets (tenant_id, version, questions, prompt_template, created_by)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`,
+			set.TenantID, set.Version, set.Questions, set.PromptTemplate, set.CreatedBy,
+		).Scan(&set.ID, &set.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// GetQuestionSet returns a version of the tenant's question set, the latest
+// when version is 0. It returns sql.ErrNoRows when there is no such version,
+// which for version 0 means the tenant uses the AI service's questions.
+func (d *DatabaseService) GetQuestionSet(tenantID string, version int) (*QuestionSet, error) {
+	if version == 0 {
+		return scanQuestionSet(d.db.QueryRow(`
+			SELECT `+questionSetColumns+` FROM question_sets WHERE tenant_id = $1
+			ORDER BY version DESC LIMIT 1`, tenantID))
+	}
+	return scanQuestionSet(d.db.QueryRow(`
+		SELECT `+questionSetColumns+` FROM question_sets WHERE tenant_id = $1 AND version = $2`, tenantID, version))
+}
+
+// GetQuestionSets returns every version of the tenant's question set, newest
+// first
+func (d *DatabaseService) GetQuestionSets(tenantID string) ([]*QuestionSet, error) {
+	rows, err := d.db.Query(`
+		SELECT `+questionSetColumns+` FROM question_sets WHERE tenant_id = $1
+		ORDER BY version DESC`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []*QuestionSet
+	for rows.Next() {
+		set, err := scanQuestionSet(rows)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return sets, rows.Err()
+}
+
+// FraudQAAnalysis records one question answering fraud analysis with the
+// question set version it asked, so that it can be reproduced. The text is
+// kept only as its hash. QuestionSetVersion is nil when the AI service's
+// default questions were asked.
+type FraudQAAnalysis struct {
+	ID                 string          `json:"id"`
+	TenantID           *string         `json:"tenant_id"`
+	DocumentID         *DocumentID     `json:"document_id"`
+	QuestionSetID      *string         `json:"question_set_id"`
+	QuestionSetVersion *int            `json:"question_set_version"`
+	TextSHA256         string          `json:"text_sha256"`
+	OverallRisk        string          `json:"overall_risk"`
+	TotalRiskScore     float64         `json:"total_risk_score"`
+	ModelUsed          string          `json:"model_used"`
+	FraudAnalysis      json.RawMessage `json:"fraud_analysis"`
+	CreatedAt          time.Time       `json:"created_at"`
+}
+
+// CreateFraudQAAnalysis records a question answering fraud analysis
+func (d *DatabaseService) CreateFraudQAAnalysis(analysis *FraudQAAnalysis) error {
+	query := `
+		INSERT INTO fraud_qa_analyses (
+			tenant_id, document_id, question_set_id, question_set_version, text_sha256,
+			overall_risk, total_risk_score, model_used, fraud_analysis
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`
+
+	return withRetry("create_fraud_qa_analysis", func() error {
+		return d.db.QueryRow(
+			query,
+			analysis.TenantID, analysis.DocumentID, analysis.QuestionSetID, analysis.QuestionSetVersion,
+			analysis.TextSHA256, analysis.OverallRisk, analysis.TotalRiskScore, analysis.ModelUsed,
+			string(analysis.FraudAnalysis),
+		).Scan(&analysis.ID, &analysis.CreatedAt)
+	})
+}
+
+// GetFraudQAAnalysis returns a recorded question answering fraud analysis. It
+// returns sql.ErrNoRows when there is no such analysis.
+func (d *DatabaseService) GetFraudQAAnalysis(id string) (*FraudQAAnalysis, error) {
+	analysis := &FraudQAAnalysis{}
+	var fraudAnalysis []byte
+	err := d.db.QueryRow(`
+		SELECT id, tenant_id, document_id, question_set_id, question_set_version, text_sha256,
+			overall_risk, total_risk_score, model_used, fraud_analysis, created_at
+		FROM fraud_qa_analyses WHERE id = $1`, id).Scan(
+		&analysis.ID, &analysis.TenantID, &analysis.DocumentID, &analysis.QuestionSetID, &analysis.QuestionSetVersion,
+		&analysis.TextSHA256, &analysis.OverallRisk, &analysis.TotalRiskScore, &analysis.ModelUsed,
+		&fraudAnalysis, &analysis.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	analysis.FraudAnalysis = fraudAnalysis
+	return analysis, nil
+}
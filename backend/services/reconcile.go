@@ -0,0 +1,39 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GetKnownFilePaths reports which of the given object names are the file of
+// a document, in any tier, or evidence attached to a case
+func (d *DatabaseService) GetKnownFilePaths(paths []string) (map[string]bool, error) {
+	known := make(map[string]bool, len(paths))
+	if len(paths) == 0 {
+		return known, nil
+	}
+
+	placeholders := make([]string, len(paths))
+	args := make([]interface{}, len(paths))
+	for i, path := range paths {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = path
+	}
+	in := strings.Join(placeholders, ", ")
+	rows, err := d.db.Query(`
+		SELECT file_path FROM documents WHERE file_path IN (`+in+`)
+		UNION SELECT object_name FROM case_evidence WHERE object_name IN (`+in+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document file paths: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan document file path: %v", err)
+		}
+		known[path] = true
+	}
+	return known, rows.Err()
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"frauddocai-backend/config"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Fraud pattern types recorded for links found in documents
+const (
+	PatternTypeBlocklistedLink = "blocklisted_link"
+	PatternTypeSuspiciousLink  = "suspicious_link"
+)
+
+// Reasons a domain is flagged
+const (
+	ReputationBlocklisted = "blocklisted"
+	ReputationHomoglyph   = "homoglyph"
+	ReputationTyposquat   = "typosquat"
+	ReputationBrandInName = "brand_in_name"
+	ReputationTLDSwap     = "tld_swap"
+	ReputationPunycode    = "punycode"
+	ReputationIPAddress   = "ip_address"
+)
+
+// ReputationHit is a domain, taken from a link or email address, that is
+// blocklisted or imitates a protected domain
+type ReputationHit struct {
+	Domain     string  `json:"domain"`
+	Reason     string  `json:"reason"`
+	Imitates   string  `json:"imitates,omitempty"`
+	Confidence float64 `json:"confidence"`
+}
+
+// URLReputation checks the domains found in documents against a blocklist
+// and lookalike heuristics for a set of protected domains
+type URLReputation struct {
+	blocklist map[string]bool
+	protected []protectedDomain
+	distance  int
+}
+
+type protectedDomain struct {
+	domain string
+	brand  string
+}
+
+// NewURLReputation builds a checker from cfg, reading its blocklist file
+func NewURLReputation(cfg config.URLReputationConfig) (*URLReputation, error) {
+	r := &URLReputation{
+		blocklist: map[string]bool{},
+		distance:  cfg.LookalikeDistance,
+	}
+	for _, domain := range cfg.Blocklist {
+		r.blocklist[normalizeDomain(domain)] = true
+	}
+	if cfg.BlocklistFile != "" {
+		if err := r.loadBlocklist(cfg.BlocklistFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, domain := range cfg.ProtectedDomains {
+		domain = normalizeDomain(domain)
+		r.protected = append(r.protected, protectedDomain{domain: domain, brand: domainLabel(domain)})
+	}
+	return r, nil
+}
+
+func (r *URLReputation) loadBlocklist(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open URL blocklist: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if domain := normalizeDomain(line); domain != "" {
+			r.blocklist[domain] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read URL blocklist: %v", err)
+	}
+	return nil
+}
+
+// BlocklistSize is the number of blocklisted domains
+func (r *URLReputation) BlocklistSize() int {
+	return len(r.blocklist)
+}
+
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(domain, "www."), ".")
+}
+
+// domainLabel is the name a domain is registered under, such as "paypal" for
+// www.paypal.co.uk
+func domainLabel(domain string) string {
+	registered, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		registered = domain
+	}
+	label, _, _ := strings.Cut(registered, ".")
+	return label
+}
+
+// CheckDomain returns why domain is suspicious, or nil
+func (r *URLReputation) CheckDomain(domain string) *ReputationHit {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return nil
+	}
+	for d := domain; d != ""; {
+		if r.blocklist[d] {
+			return &ReputationHit{Domain: domain, Reason: ReputationBlocklisted, Confidence: 1}
+		}
+		_, d, _ = strings.Cut(d, ".")
+	}
+
+	if net.ParseIP(domain) != nil {
+		return &ReputationHit{Domain: domain, Reason: ReputationIPAddress, Confidence: 0.6}
+	}
+	for _, p := range r.protected {
+		if domain == p.domain || strings.HasSuffix(domain, "."+p.domain) {
+			return nil
+		}
+	}
+
+	label := domainLabel(domain)
+	var best *ReputationHit
+	consider := func(reason, imitates string, confidence float64) {
+		if best == nil || confidence > best.Confidence {
+			best = &ReputationHit{Domain: domain, Reason: reason, Imitates: imitates, Confidence: confidence}
+		}
+	}
+	for _, p := range r.protected {
+		switch {
+		case label == p.brand:
+			// paypal.co instead of paypal.com
+			consider(ReputationTLDSwap, p.domain, 0.8)
+		case unconfuse(label) == unconfuse(p.brand):
+			consider(ReputationHomoglyph, p.domain, 0.95)
+		case len(p.brand) >= 6 && editDistance(label, p.brand) <= r.distance:
+			// Shorter names are a single edit away from too many real words
+			consider(ReputationTyposquat, p.domain, 0.85)
+		case len(p.brand) >= 5 && containsToken(domain, p.brand):
+			// paypal-billing.net or paypal.com.secure-login.xyz
+			consider(ReputationBrandInName, p.domain, 0.75)
+		}
+	}
+	if best == nil {
+		for _, part := range strings.Split(domain, ".") {
+			if strings.HasPrefix(part, "xn--") {
+				// Internationalized names can mix scripts to look like ASCII ones
+				consider(ReputationPunycode, "", 0.7)
+				break
+			}
+		}
+	}
+	return best
+}
+
+// confusables are replaced before comparing names, so that paypa1 and
+// rnicrosoft read as paypal and microsoft
+var confusables = strings.NewReplacer("0", "o", "1", "l", "3", "e", "5", "s", "rn", "m", "vv", "w", "-", "")
+
+func unconfuse(label string) string {
+	return confusables.Replace(label)
+}
+
+// containsToken reports whether brand appears in domain as a whole word
+// between dots and hyphens
+func containsToken(domain, brand string) bool {
+	for _, token := range strings.FieldsFunc(domain, func(r rune) bool { return r == '.' || r == '-' }) {
+		if token == brand {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Check looks up the domains of the url, domain and email entities from
+// ExtractEntities. Hits are grouped into one risk factor per fraud pattern.
+func (r *URLReputation) Check(entities []string) []RiskFactor {
+	domains := map[string]bool{}
+	for _, entity := range entities {
+		kind, value, ok := ParseEntity(entity)
+		if !ok {
+			continue
+		}
+		switch kind {
+		case "domain":
+			domains[value] = true
+		case "email":
+			if _, domain, ok := strings.Cut(value, "@"); ok {
+				domains[domain] = true
+			}
+		}
+	}
+
+	byPattern := map[string][]*ReputationHit{}
+	for domain := range domains {
+		hit := r.CheckDomain(domain)
+		if hit == nil {
+			continue
+		}
+		pattern := PatternTypeSuspiciousLink
+		if hit.Reason == ReputationBlocklisted {
+			pattern = PatternTypeBlocklistedLink
+		}
+		byPattern[pattern] = append(byPattern[pattern], hit)
+	}
+
+	var factors []RiskFactor
+	for _, pattern := range []string{PatternTypeBlocklistedLink, PatternTypeSuspiciousLink} {
+		hits := byPattern[pattern]
+		if len(hits) == 0 {
+			continue
+		}
+		sort.Slice(hits, func(i, j int) bool { return hits[i].Domain < hits[j].Domain })
+		confidence := 0.0
+		for _, hit := range hits {
+			confidence = max(confidence, hit.Confidence)
+		}
+		factors = append(factors, RiskFactor{
+			PatternType: pattern,
+			Confidence:  confidence,
+			Details:     Metadata{"domains": hits},
+		})
+	}
+	return factors
+}
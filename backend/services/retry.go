@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"frauddocai-backend/logging"
+	"frauddocai-backend/metrics"
+
+	"github.com/lib/pq"
+)
+
+const (
+	maxRetryAttempts = 5
+	retryBaseDelay   = 20 * time.Millisecond
+	retryMaxDelay    = 1 * time.Second
+)
+
+// Postgres error codes that are safe to retry: the transaction was rolled
+// back by the server and re-running it may succeed
+var retryableCodes = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+}
+
+func retryableCode(err error) (pq.ErrorCode, bool) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && retryableCodes[pqErr.Code] {
+		return pqErr.Code, true
+	}
+	return "", false
+}
+
+// withRetry runs fn, retrying with jittered exponential backoff when it fails
+// with a retryable Postgres error. fn must be safe to run more than once, so
+// anything done in a transaction has to begin and commit inside fn.
+func withRetry(operation string, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		code, retryable := retryableCode(err)
+		if !retryable {
+			return err
+		}
+
+		if attempt == maxRetryAttempts {
+			metrics.DBRetriesExhausted.WithLabelValues(operation).Inc()
+			return err
+		}
+
+		metrics.DBRetries.WithLabelValues(operation, string(code)).Inc()
+		sleep := delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		logging.DB.Warnf("Retrying %s after Postgres error %s (attempt %d, waiting %v)", operation, code, attempt, sleep)
+		time.Sleep(sleep)
+
+		delay *= 2
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RiskLevel is one band of a risk taxonomy. Documents scoring at least
+// MinScore, and below the next level's MinScore, get this level.
+type RiskLevel struct {
+	Name     string  `json:"name"`
+	Label    string  `json:"label"`
+	MinScore float64 `json:"min_score"`
+	Color    string  `json:"color"`
+}
+
+// RiskTaxonomy lists a tenant's risk levels from least to most severe
+type RiskTaxonomy struct {
+	Levels []RiskLevel `json:"levels"`
+}
+
+// DefaultRiskTaxonomy is used by tenants that have not configured their own.
+// The low, medium and high thresholds match the AI service's.
+func DefaultRiskTaxonomy() *RiskTaxonomy {
+	return &RiskTaxonomy{Levels: []RiskLevel{
+		{Name: "low", Label: "Low", MinScore: 0, Color: "#16a34a"},
+		{Name: "medium", Label: "Medium", MinScore: 0.4, Color: "#ca8a04"},
+		{Name: "high", Label: "High", MinScore: 0.7, Color: "#dc2626"},
+		{Name: "critical", Label: "Critical", MinScore: 0.9, Color: "#991b1b"},
+	}}
+}
+
+var (
+	riskLevelName  = regexp.MustCompile(`^[a-z][a-z0-9_]{0,19}$`)
+	riskLevelColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// RiskTaxonomyError lists the problems found in a taxonomy or risk level
+type RiskTaxonomyError struct {
+	Problems []string
+}
+
+func (e *RiskTaxonomyError) Error() string {
+	return "invalid risk taxonomy: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that level names are unique identifiers that fit the
+// fraud_risk_level column and that the score ranges start at 0 and increase
+func (t *RiskTaxonomy) Validate() error {
+	var problems []string
+	if len(t.Levels) == 0 {
+		problems = append(problems, "at least one level is required")
+	}
+
+	seen := map[string]bool{}
+	for i, level := range t.Levels {
+		if !riskLevelName.MatchString(level.Name) {
+			problems = append(problems, fmt.Sprintf("levels[%d].name %q must be lower case letters, digits or _ (at most 20)", i, level.Name))
+		} else if seen[level.Name] {
+			problems = append(problems, fmt.Sprintf("levels[%d].name %q is repeated", i, level.Name))
+		}
+		seen[level.Name] = true
+
+		if strings.TrimSpace(level.Label) == "" {
+			problems = append(problems, fmt.Sprintf("levels[%d].label is required", i))
+		}
+		if !riskLevelColor.MatchString(level.Color) {
+			problems = append(problems, fmt.Sprintf("levels[%d].color %q must be a #rrggbb color", i, level.Color))
+		}
+
+		switch {
+		case i == 0 && level.MinScore != 0:
+			problems = append(problems, "levels[0].min_score must be 0")
+		case i > 0 && level.MinScore <= t.Levels[i-1].MinScore:
+			problems = append(problems, fmt.Sprintf("levels[%d].min_score must be greater than the previous level's", i))
+		case level.MinScore > 1:
+			problems = append(problems, fmt.Sprintf("levels[%d].min_score must be at most 1", i))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &RiskTaxonomyError{Problems: problems}
+	}
+	return nil
+}
+
+// LevelForScore returns the most severe level whose MinScore the score reaches
+func (t *RiskTaxonomy) LevelForScore(score float64) RiskLevel {
+	level := t.Levels[0]
+	for _, l := range t.Levels[1:] {
+		if score >= l.MinScore {
+			level = l
+		}
+	}
+	return level
+}
+
+// Lowest is the level given to documents that have not been scored yet
+func (t *RiskTaxonomy) Lowest() RiskLevel {
+	return t.Levels[0]
+}
+
+// CheckLevel returns an error unless name is one of the taxonomy's levels
+func (t *RiskTaxonomy) CheckLevel(name string) error {
+	for _, level := range t.Levels {
+		if level.Name == name {
+			return nil
+		}
+	}
+	names := make([]string, len(t.Levels))
+	for i, level := range t.Levels {
+		names[i] = level.Name
+	}
+	return &RiskTaxonomyError{Problems: []string{
+		fmt.Sprintf("risk level %q is not one of %s", name, strings.Join(names, ", ")),
+	}}
+}
+
+func (t RiskTaxonomy) Value() (driver.Value, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (t *RiskTaxonomy) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	default:
+		return fmt.Errorf("unsupported risk taxonomy type %T", src)
+	}
+}
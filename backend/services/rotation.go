@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"frauddocai-backend/metrics"
+)
+
+// credentialRotationAction is the audit_logs action of rotation records
+const credentialRotationAction = "credential_rotation"
+
+// Outcomes of a credential rotation for one consumer
+const (
+	RotationCompleted = "completed"
+	RotationFailed    = "failed"
+)
+
+// CredentialRotation records one consumer of a secret switching to its
+// rotated value. Secret is the provider and name of the secret, never its
+// value.
+type CredentialRotation struct {
+	ID        string    `json:"id"`
+	Secret    string    `json:"secret"`
+	Consumer  string    `json:"consumer"`
+	Outcome   string    `json:"outcome"`
+	Error     *string   `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RotationRecorder keeps the audit trail of credential rotations
+type RotationRecorder interface {
+	RecordCredentialRotation(rotation *CredentialRotation) error
+}
+
+type rotationSubscriber struct {
+	consumer string
+	reload   func(ctx context.Context) error
+}
+
+// Subscribe registers consumer to be told when the secret behind any of
+// values is rotated. reload rebuilds whatever still holds connections made
+// with the old credentials; it is nil for consumers that resolve the secret
+// on every use. Values that are not references are ignored.
+func (s *Secrets) Subscribe(consumer string, reload func(ctx context.Context) error, values ...string) {
+	subscribed := map[string]bool{}
+	for _, value := range values {
+		if !s.IsReference(value) {
+			continue
+		}
+		scheme, name, _ := splitReference(value)
+		secret := scheme + ":" + name
+		if subscribed[secret] {
+			continue
+		}
+		subscribed[secret] = true
+
+		s.mu.Lock()
+		s.subscribers[secret] = append(s.subscribers[secret], rotationSubscriber{consumer: consumer, reload: reload})
+		s.mu.Unlock()
+	}
+}
+
+// RecordRotations sets where rotations found by Watch are recorded
+func (s *Secrets) RecordRotations(recorder RotationRecorder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recorder = recorder
+}
+
+// Watch fetches every secret in use each interval, regardless of the cache
+// TTL, and has the subscribers of a secret whose value changed rebuild
+// their connections. It returns when ctx is cancelled.
+func (s *Secrets) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, secret := range s.refreshCached(ctx) {
+				s.rotate(ctx, secret)
+			}
+		}
+	}
+}
+
+// refreshCached fetches the cached secrets again and returns the ones whose
+// value changed. A secret that cannot be fetched keeps its cached value.
+func (s *Secrets) refreshCached(ctx context.Context) []string {
+	s.mu.Lock()
+	secrets := make([]string, 0, len(s.cache))
+	for secret := range s.cache {
+		secrets = append(secrets, secret)
+	}
+	s.mu.Unlock()
+	sort.Strings(secrets)
+
+	var changed []string
+	for _, secret := range secrets {
+		scheme, name, _ := splitReference(secret)
+		s.mu.Lock()
+		provider := s.providers[scheme]
+		s.mu.Unlock()
+		if provider == nil {
+			continue
+		}
+
+		value, err := provider.GetSecret(ctx, name)
+		if err != nil {
+			log.Printf("Failed to check secret %s for rotation: %v", secret, err)
+			continue
+		}
+		s.mu.Lock()
+		previous := s.cache[secret]
+		s.cache[secret] = cachedSecret{value: value, fetchedAt: time.Now()}
+		s.mu.Unlock()
+		if previous.value != value {
+			changed = append(changed, secret)
+		}
+	}
+	return changed
+}
+
+// rotate reloads the subscribers of a rotated secret one after another and
+// records the outcome for each
+func (s *Secrets) rotate(ctx context.Context, secret string) {
+	s.mu.Lock()
+	subscribers := append([]rotationSubscriber(nil), s.subscribers[secret]...)
+	recorder := s.recorder
+	s.mu.Unlock()
+	log.Printf("Secret %s was rotated; updating %d consumers", secret, len(subscribers))
+
+	for _, subscriber := range subscribers {
+		rotation := &CredentialRotation{
+			Secret:   secret,
+			Consumer: subscriber.consumer,
+			Outcome:  RotationCompleted,
+		}
+		if subscriber.reload != nil {
+			if err := subscriber.reload(ctx); err != nil {
+				log.Printf("Failed to apply rotated secret %s to %s: %v", secret, subscriber.consumer, err)
+				message := err.Error()
+				rotation.Outcome = RotationFailed
+				rotation.Error = &message
+			}
+		}
+		metrics.CredentialRotations.WithLabelValues(subscriber.consumer, rotation.Outcome).Inc()
+
+		if recorder == nil {
+			continue
+		}
+		if err := recorder.RecordCredentialRotation(rotation); err != nil {
+			log.Printf("Failed to record rotation of secret %s for %s: %v", secret, subscriber.consumer, err)
+		}
+	}
+}
+
+// rotationDetails is the audit_logs details of a rotation record
+type rotationDetails struct {
+	Secret   string  `json:"secret"`
+	Consumer string  `json:"consumer"`
+	Outcome  string  `json:"outcome"`
+	Error    *string `json:"error,omitempty"`
+}
+
+// RecordCredentialRotation adds a rotation to the audit log and sets its ID
+// and creation time
+func (d *DatabaseService) RecordCredentialRotation(rotation *CredentialRotation) error {
+	details, err := json.Marshal(rotationDetails{
+		Secret:   rotation.Secret,
+		Consumer: rotation.Consumer,
+		Outcome:  rotation.Outcome,
+		Error:    rotation.Error,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode credential rotation: %v", err)
+	}
+
+	err = d.db.QueryRow(`
+		INSERT INTO audit_logs (action, resource_type, details) VALUES ($1, 'secret', $2)
+		RETURNING id, created_at`, credentialRotationAction, string(details)).Scan(&rotation.ID, &rotation.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record credential rotation: %v", err)
+	}
+	return nil
+}
+
+// GetCredentialRotations returns the most recent rotation records, newest
+// first
+func (d *DatabaseService) GetCredentialRotations(limit int) ([]CredentialRotation, error) {
+	rows, err := d.db.Query(`
+		SELECT id, details, created_at FROM audit_logs
+		WHERE action = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, credentialRotationAction, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credential rotations: %v", err)
+	}
+	defer rows.Close()
+
+	rotations := []CredentialRotation{}
+	for rows.Next() {
+		var rotation CredentialRotation
+		var details []byte
+		if err := rows.Scan(&rotation.ID, &details, &rotation.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan credential rotation: %v", err)
+		}
+		var parsed rotationDetails
+		if err := json.Unmarshal(details, &parsed); err != nil {
+			return nil, fmt.Errorf("failed to decode credential rotation %s: %v", rotation.ID, err)
+		}
+		rotation.Secret = parsed.Secret
+		rotation.Consumer = parsed.Consumer
+		rotation.Outcome = parsed.Outcome
+		rotation.Error = parsed.Error
+		rotations = append(rotations, rotation)
+	}
+	return rotations, rows.Err()
+}
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotConfirmedFraud is returned when drafting a Suspicious Activity Report
+// for an alert that was not closed with a fraud disposition
+var ErrNotConfirmedFraud = errors.New("alert was not closed as confirmed fraud")
+
+// SARReport is a draft Suspicious Activity Report of a confirmed fraud alert,
+// put together from the alert, its documents, their entities and the
+// alert's history. Compliance reviews and completes it before filing.
+type SARReport struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Institution *SARInstitution `json:"institution"`
+	Case        SARCase         `json:"case"`
+	Documents   []*SARDocument  `json:"documents"`
+	Detections  []*SARDetection `json:"detections"`
+	Entities    []*SAREntity    `json:"entities"`
+	Timeline    []*SAREvent     `json:"timeline"`
+	Narrative   string          `json:"narrative"`
+}
+
+// SARInstitution is the tenant the report is filed for
+type SARInstitution struct {
+	TenantID string `json:"tenant_id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+}
+
+// SARCase summarizes the alert
+type SARCase struct {
+	AlertID          string     `json:"alert_id"`
+	Kind             string     `json:"kind"`
+	Severity         string     `json:"severity"`
+	Score            *float64   `json:"score"`
+	RaisedAt         time.Time  `json:"raised_at"`
+	AssignedTo       *string    `json:"assigned_to"`
+	EscalationLevel  int        `json:"escalation_level"`
+	ClosedBy         *string    `json:"closed_by"`
+	ClosedAt         *time.Time `json:"closed_at"`
+	Disposition      string     `json:"disposition"`
+	DispositionLabel string     `json:"disposition_label"`
+}
+
+// SAR document roles
+const (
+	SARDocumentSubject  = "subject"
+	SARDocumentExemplar = "exemplar"
+)
+
+// SARDocument is a document of the case: the one the alert was raised on, or
+// the known-fraud exemplar it matched
+type SARDocument struct {
+	ID           DocumentID `json:"id"`
+	Role         string     `json:"role"`
+	Filename     string     `json:"filename"`
+	DocumentType *string    `json:"document_type"`
+	MimeType     string     `json:"mime_type"`
+	FileSize     int64      `json:"file_size"`
+	SHA256       *string    `json:"sha256"`
+	FraudScore   *float64   `json:"fraud_score"`
+	RiskLevel    string     `json:"risk_level"`
+	UploadedAt   time.Time  `json:"uploaded_at"`
+}
+
+// SARDetection is a fraud pattern found in a document of the case
+type SARDetection struct {
+	DocumentID  DocumentID `json:"document_id"`
+	Pattern     string     `json:"pattern"`
+	PatternType string     `json:"pattern_type"`
+	Severity    string     `json:"severity"`
+	Confidence  float64    `json:"confidence"`
+	Disposition *string    `json:"disposition"`
+}
+
+// SAREntity is an account number, IBAN, email, phone number, URL or domain
+// found in the case's documents
+type SAREntity struct {
+	Kind      string       `json:"kind"`
+	Value     string       `json:"value"`
+	Documents []DocumentID `json:"documents"`
+}
+
+// SAREvent is one entry of the case timeline
+type SAREvent struct {
+	At     time.Time `json:"at"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail"`
+}
+
+func (r SARReport) Value() (driver.Value, error) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (r *SARReport) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	default:
+		return fmt.Errorf("unsupported SAR report type %T", src)
+	}
+}
+
+// SARSources is what a report, and the timeline of the alert's case, is
+// drafted from. Tenant is nil for alerts without a tenant; Exemplar is nil
+// when the alert did not match one. Events are the stored events of the
+// documents, Evidence the files attached to the case and Notifications the
+// webhook events about the alert.
+type SARSources struct {
+	Alert         *Alert
+	Tenant        *Tenant
+	Document      *Document
+	Exemplar      *Document
+	Detections    []*DetectionRecord
+	Entities      []*DocumentEntity
+	Escalations   []*AlertEscalation
+	Approvals     []*Approval
+	Events        []*StoredEvent
+	Evidence      []*CaseEvidence
+	Notifications []*WebhookEvent
+}
+
+// DraftSAR puts a report together from its sources. It returns
+// ErrNotConfirmedFraud unless the alert was closed with a fraud outcome.
+func DraftSAR(src SARSources, now time.Time) (*SARReport, error) {
+	alert := src.Alert
+	if alert.Disposition == nil || alert.DispositionOutcome == nil || *alert.DispositionOutcome != OutcomeFraud {
+		return nil, ErrNotConfirmedFraud
+	}
+
+	taxonomy := DefaultDispositionTaxonomy()
+	report := &SARReport{
+		GeneratedAt: now.UTC(),
+		Documents:   []*SARDocument{},
+		Detections:  []*SARDetection{},
+		Entities:    []*SAREntity{},
+		Timeline:    []*SAREvent{},
+	}
+	if src.Tenant != nil {
+		taxonomy = src.Tenant.Dispositions()
+		report.Institution = &SARInstitution{TenantID: src.Tenant.ID, Name: src.Tenant.Name, Slug: src.Tenant.Slug}
+	}
+	report.Case = SARCase{
+		AlertID:          alert.ID,
+		Kind:             alert.Kind,
+		Severity:         alert.Severity,
+		Score:            alert.Score,
+		RaisedAt:         alert.CreatedAt,
+		AssignedTo:       alert.AssignedTo,
+		EscalationLevel:  alert.EscalationLevel,
+		ClosedBy:         alert.AcknowledgedBy,
+		ClosedAt:         alert.AcknowledgedAt,
+		Disposition:      *alert.Disposition,
+		DispositionLabel: *alert.Disposition,
+	}
+	if disposition, err := taxonomy.Lookup(*alert.Disposition); err == nil {
+		report.Case.DispositionLabel = disposition.Label
+	}
+
+	for _, doc := range []struct {
+		document *Document
+		role     string
+	}{{src.Document, SARDocumentSubject}, {src.Exemplar, SARDocumentExemplar}} {
+		if doc.document == nil {
+			continue
+		}
+		report.Documents = append(report.Documents, &SARDocument{
+			ID:           doc.document.ID,
+			Role:         doc.role,
+			Filename:     doc.document.OriginalFilename,
+			DocumentType: doc.document.DocumentType,
+			MimeType:     doc.document.MimeType,
+			FileSize:     doc.document.FileSize,
+			SHA256:       doc.document.ContentSHA256,
+			FraudScore:   doc.document.FraudScore,
+			RiskLevel:    doc.document.FraudRiskLevel,
+			UploadedAt:   doc.document.CreatedAt,
+		})
+	}
+
+	for _, record := range src.Detections {
+		detection := &SARDetection{
+			DocumentID:  record.DocumentID,
+			Confidence:  record.ConfidenceScore,
+			Disposition: record.Disposition,
+		}
+		if record.Pattern != nil {
+			detection.Pattern = record.Pattern.Name
+			detection.PatternType = record.Pattern.Type
+			detection.Severity = record.Pattern.Severity
+		}
+		report.Detections = append(report.Detections, detection)
+	}
+
+	byValue := map[string]*SAREntity{}
+	for _, entity := range src.Entities {
+		key := entity.Kind + ":" + entity.Value
+		if existing, ok := byValue[key]; ok {
+			existing.Documents = append(existing.Documents, entity.DocumentID)
+			continue
+		}
+		byValue[key] = &SAREntity{Kind: entity.Kind, Value: entity.Value, Documents: []DocumentID{entity.DocumentID}}
+		report.Entities = append(report.Entities, byValue[key])
+	}
+	sort.SliceStable(report.Entities, func(i, j int) bool {
+		if report.Entities[i].Kind != report.Entities[j].Kind {
+			return report.Entities[i].Kind < report.Entities[j].Kind
+		}
+		return report.Entities[i].Value < report.Entities[j].Value
+	})
+
+	for _, event := range CaseTimeline(src) {
+		report.Timeline = append(report.Timeline, &SAREvent{At: event.At, Event: event.Event, Detail: event.Detail})
+	}
+
+	report.Narrative = sarNarrative(report)
+	return report, nil
+}
+
+// sarNarrative drafts the report's narrative for compliance to edit
+func sarNarrative(report *SARReport) string {
+	var b strings.Builder
+	institution := "The institution"
+	if report.Institution != nil {
+		institution = report.Institution.Name
+	}
+	fmt.Fprintf(&b, "On %s, %s raised a %s %s alert", report.Case.RaisedAt.UTC().Format("2 January 2006"), institution, report.Case.Severity, strings.ReplaceAll(report.Case.Kind, "_", " "))
+	for _, doc := range report.Documents {
+		if doc.Role != SARDocumentSubject {
+			continue
+		}
+		fmt.Fprintf(&b, " on the document %q", doc.Filename)
+		if doc.FraudScore != nil {
+			fmt.Fprintf(&b, ", which scored %.2f (%s risk)", *doc.FraudScore, doc.RiskLevel)
+		}
+	}
+	b.WriteString(".")
+	for _, doc := range report.Documents {
+		if doc.Role == SARDocumentExemplar {
+			fmt.Fprintf(&b, " The document matched the known fraudulent document %q.", doc.Filename)
+		}
+	}
+
+	if len(report.Detections) > 0 {
+		patterns := make([]string, 0, len(report.Detections))
+		seen := map[string]bool{}
+		for _, detection := range report.Detections {
+			name := sarOr(detection.Pattern, "unknown pattern")
+			if !seen[name] {
+				seen[name] = true
+				patterns = append(patterns, name)
+			}
+		}
+		fmt.Fprintf(&b, " Fraud analysis found %d indicator(s): %s.", len(report.Detections), strings.Join(patterns, ", "))
+	}
+	if len(report.Entities) > 0 {
+		counts := map[string]int{}
+		var kinds []string
+		for _, entity := range report.Entities {
+			if counts[entity.Kind] == 0 {
+				kinds = append(kinds, entity.Kind)
+			}
+			counts[entity.Kind]++
+		}
+		parts := make([]string, len(kinds))
+		for i, kind := range kinds {
+			parts[i] = fmt.Sprintf("%d %s", counts[kind], kind)
+		}
+		fmt.Fprintf(&b, " The documents name %s.", strings.Join(parts, ", "))
+	}
+	if report.Case.ClosedAt != nil {
+		fmt.Fprintf(&b, " After review the alert was closed on %s as %s.", report.Case.ClosedAt.UTC().Format("2 January 2006"), strings.ToLower(report.Case.DispositionLabel))
+	}
+	b.WriteString("\n\nThis draft was generated automatically and must be reviewed and completed before filing.")
+	return b.String()
+}
+
+func sarValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func sarOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// PDF renders the report as a PDF document in the localizer's language.
+// The narrative stays as drafted.
+func (r *SARReport) PDF(l Localizer) []byte {
+	w := newPDFWriter(l)
+	w.Heading(l.T("Suspicious Activity Report - DRAFT"), 16)
+	w.Field(l.T("Generated"), r.GeneratedAt.Format(time.RFC3339))
+	if r.Institution != nil {
+		w.Field(l.T("Institution"), r.Institution.Name+" ("+r.Institution.Slug+")")
+	}
+
+	w.Heading(l.T("Case"), 12)
+	w.Field(l.T("Alert"), r.Case.AlertID)
+	w.Field(l.T("Kind"), r.Case.Kind)
+	w.Field(l.T("Severity"), r.Case.Severity)
+	if r.Case.Score != nil {
+		w.Field(l.T("Score"), fmt.Sprintf("%.2f", *r.Case.Score))
+	}
+	w.Field(l.T("Raised"), r.Case.RaisedAt.UTC().Format(time.RFC3339))
+	w.Field(l.T("Assigned to"), sarValue(r.Case.AssignedTo))
+	w.Field(l.T("Escalation level"), fmt.Sprint(r.Case.EscalationLevel))
+	w.Field(l.T("Closed by"), sarValue(r.Case.ClosedBy))
+	if r.Case.ClosedAt != nil {
+		w.Field(l.T("Closed"), r.Case.ClosedAt.UTC().Format(time.RFC3339))
+	}
+	w.Field(l.T("Disposition"), r.Case.DispositionLabel+" ("+r.Case.Disposition+")")
+
+	w.Heading(l.T("Narrative"), 12)
+	w.Paragraph(r.Narrative)
+
+	w.Heading(l.T("Documents"), 12)
+	if len(r.Documents) == 0 {
+		w.Paragraph(l.T("None"))
+	}
+	for _, doc := range r.Documents {
+		w.Paragraph(fmt.Sprintf("%s (%s)", doc.Filename, l.T(doc.Role)))
+		w.Indented(l.Sprintf("ID %s, %s, %d bytes, uploaded %s", doc.ID, doc.MimeType, doc.FileSize, doc.UploadedAt.UTC().Format(time.RFC3339)), 12)
+		if doc.SHA256 != nil {
+			w.Indented("SHA-256 "+*doc.SHA256, 12)
+		}
+		if doc.FraudScore != nil {
+			w.Indented(l.Sprintf("Fraud score %.2f, %s risk", *doc.FraudScore, doc.RiskLevel), 12)
+		}
+	}
+
+	w.Heading(l.T("Fraud indicators"), 12)
+	if len(r.Detections) == 0 {
+		w.Paragraph(l.T("None"))
+	}
+	for _, detection := range r.Detections {
+		line := l.Sprintf("%s (%s, %s) - confidence %.2f", sarOr(detection.Pattern, l.T("unknown pattern")),
+			sarOr(detection.PatternType, "-"), sarOr(detection.Severity, "-"), detection.Confidence)
+		if detection.Disposition != nil {
+			line += l.Sprintf(", reviewed as %s", *detection.Disposition)
+		}
+		w.Paragraph(line)
+	}
+
+	w.Heading(l.T("Entities"), 12)
+	if len(r.Entities) == 0 {
+		w.Paragraph(l.T("None"))
+	}
+	for _, entity := range r.Entities {
+		w.Paragraph(fmt.Sprintf("%s: %s", entity.Kind, entity.Value))
+	}
+
+	w.Heading(l.T("Timeline"), 12)
+	for _, event := range r.Timeline {
+		w.Paragraph(fmt.Sprintf("%s  %s  %s", event.At.UTC().Format("2006-01-02 15:04:05"), l.T(strings.ReplaceAll(event.Event, "_", " ")), event.Detail))
+	}
+	return w.Bytes()
+}
+
+// SARDraft is a stored version of an alert's report
+type SARDraft struct {
+	ID          string     `json:"id"`
+	TenantID    *string    `json:"tenant_id"`
+	AlertID     string     `json:"alert_id"`
+	Version     int        `json:"version"`
+	Report      *SARReport `json:"report"`
+	GeneratedBy *string    `json:"generated_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const sarDraftColumns = `id, tenant_id, alert_id, version, report, generated_by, created_at`
+
+func scanSARDraft(row rowScanner) (*SARDraft, error) {
+	draft := &SARDraft{Report: &SARReport{}}
+	err := row.Scan(&draft.ID, &draft.TenantID, &draft.AlertID, &draft.Version, draft.Report, &draft.GeneratedBy, &draft.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return draft, nil
+}
+
+// CreateSARDraft stores a report as the alert's next draft version
+func (d *DatabaseService) CreateSARDraft(draft *SARDraft) error {
+	return withRetry("create_sar_draft", func() error {
+		tx, err := d.db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM sar_drafts WHERE alert_id = $1`, draft.AlertID).Scan(&draft.Version)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow(`
+			INSERT INTO sar_drafts (tenant_id, alert_id, version, report, generated_by)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at`,
+			draft.TenantID, draft.AlertID, draft.Version, draft.Report, draft.GeneratedBy,
+		).Scan(&draft.ID, &draft.CreatedAt)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// GetSARDraft returns a version of the alert's report, the latest when
+// version is 0. It returns sql.ErrNoRows when there is no such draft.
+func (d *DatabaseService) GetSARDraft(alertID string, version int) (*SARDraft, error) {
+	if version == 0 {
+		return scanSARDraft(d.db.QueryRow(`
+			SELECT `+sarDraftColumns+` FROM sar_drafts WHERE alert_id = $1
+			ORDER BY version DESC LIMIT 1`, alertID))
+	}
+	return scanSARDraft(d.db.QueryRow(`
+		SELECT `+sarDraftColumns+` FROM sar_drafts WHERE alert_id = $1 AND version = $2`, alertID, version))
+}
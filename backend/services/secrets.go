@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// ErrUnknownSecretProvider is returned for a secret reference whose provider
+// is not configured
+var ErrUnknownSecretProvider = errors.New("secret provider not configured")
+
+// SecretProvider fetches a secret from a secrets manager by name. The value
+// is the secret's raw payload; secrets holding several values are returned
+// as a JSON object.
+type SecretProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// Secrets resolves setting values that are secret references. A reference
+// is <provider>:<name>, optionally followed by #<key> to select one field of
+// a secret holding a JSON object, for example vault:frauddocai/db#password.
+// Other values are returned unchanged, so plain environment variables keep
+// working.
+//
+// Secrets are fetched on first use and cached for the configured TTL.
+// Callers resolve a reference each time they need the value rather than
+// keeping it, so a rotated secret is picked up without a restart.
+type Secrets struct {
+	providers map[string]SecretProvider
+	ttl       time.Duration
+
+	mu          sync.Mutex
+	cache       map[string]cachedSecret
+	subscribers map[string][]rotationSubscriber
+	recorder    RotationRecorder
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// NewSecrets sets up the vault and aws-sm providers. Neither contacts its
+// secrets manager until a reference to it is resolved.
+func NewSecrets(cfg config.SecretsConfig) *Secrets {
+	return &Secrets{
+		providers: map[string]SecretProvider{
+			"vault":  NewVaultSecrets(cfg),
+			"aws-sm": NewAWSSecrets(cfg.AWSRegion),
+		},
+		ttl:         cfg.CacheTTL,
+		cache:       map[string]cachedSecret{},
+		subscribers: map[string][]rotationSubscriber{},
+	}
+}
+
+// AddProvider registers a provider under the scheme used in references
+func (s *Secrets) AddProvider(scheme string, provider SecretProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.providers[scheme] = provider
+}
+
+// IsReference reports whether value names a secret of a registered
+// provider rather than being the value itself
+func (s *Secrets) IsReference(value string) bool {
+	if s == nil {
+		return false
+	}
+	scheme, _, ok := strings.Cut(value, ":")
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok = s.providers[scheme]
+	return ok
+}
+
+// Resolve returns the value of a secret reference, or value itself when it
+// is not a reference. A nil Secrets resolves nothing. When a secret cannot
+// be fetched again after its TTL, the previous value is used and the error
+// is logged, so that an outage of the secrets manager does not take the
+// backend down with it.
+func (s *Secrets) Resolve(ctx context.Context, value string) (string, error) {
+	if !s.IsReference(value) {
+		return value, nil
+	}
+	scheme, name, key := splitReference(value)
+
+	payload, err := s.fetch(ctx, scheme, name)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return payload, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(payload), &fields); err != nil {
+		return "", fmt.Errorf("secret %s:%s is not a JSON object", scheme, name)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s:%s has no key %s", scheme, name, key)
+	}
+	if str, ok := field.(string); ok {
+		return str, nil
+	}
+	return fmt.Sprint(field), nil
+}
+
+// splitReference splits a secret reference into its provider scheme, secret
+// name and optional key
+func splitReference(value string) (scheme, name, key string) {
+	scheme, rest, _ := strings.Cut(value, ":")
+	name, key, _ = strings.Cut(rest, "#")
+	return scheme, name, key
+}
+
+func (s *Secrets) fetch(ctx context.Context, scheme, name string) (string, error) {
+	cacheKey := scheme + ":" + name
+	s.mu.Lock()
+	cached, ok := s.cache[cacheKey]
+	provider := s.providers[scheme]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < s.ttl {
+		return cached.value, nil
+	}
+	if provider == nil {
+		return "", fmt.Errorf("%w: %s", ErrUnknownSecretProvider, scheme)
+	}
+
+	value, err := provider.GetSecret(ctx, name)
+	if err != nil {
+		if ok {
+			// Retry after another TTL rather than on every use
+			log.Printf("Failed to refresh secret %s, using the cached value: %v", cacheKey, err)
+			s.mu.Lock()
+			s.cache[cacheKey] = cachedSecret{value: cached.value, fetchedAt: time.Now()}
+			s.mu.Unlock()
+			return cached.value, nil
+		}
+		return "", fmt.Errorf("failed to fetch secret %s: %v", cacheKey, err)
+	}
+
+	s.mu.Lock()
+	s.cache[cacheKey] = cachedSecret{value: value, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return value, nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// AWSSecrets reads secrets from AWS Secrets Manager. The client, and with it
+// the credentials from the SDK's default chain, is set up on first use so
+// that deployments without AWS references never touch it.
+type AWSSecrets struct {
+	region string
+
+	once    sync.Once
+	client  *secretsmanager.Client
+	initErr error
+}
+
+func NewAWSSecrets(region string) *AWSSecrets {
+	return &AWSSecrets{region: region}
+}
+
+func (a *AWSSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	a.once.Do(func() {
+		var opts []func(*awsconfig.LoadOptions) error
+		if a.region != "" {
+			opts = append(opts, awsconfig.WithRegion(a.region))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+		if err != nil {
+			a.initErr = fmt.Errorf("failed to load AWS configuration: %v", err)
+			return
+		}
+		a.client = secretsmanager.NewFromConfig(cfg)
+	})
+	if a.initErr != nil {
+		return "", a.initErr
+	}
+
+	out, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if err != nil {
+		return "", err
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", name)
+	}
+	return *out.SecretString, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// VaultSecrets reads secrets from a HashiCorp Vault KV version 2 engine.
+// The secret's data is returned as a JSON object.
+type VaultSecrets struct {
+	addr      string
+	token     string
+	mount     string
+	namespace string
+	client    *http.Client
+}
+
+func NewVaultSecrets(cfg config.SecretsConfig) *VaultSecrets {
+	return &VaultSecrets{
+		addr:      strings.TrimRight(cfg.VaultAddr, "/"),
+		token:     cfg.VaultToken,
+		mount:     strings.Trim(cfg.VaultMount, "/"),
+		namespace: cfg.VaultNamespace,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (v *VaultSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	if v.addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	endpoint := v.addr + "/v1/" + v.mount + "/data/" + strings.Trim(name, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var secret struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %v", err)
+	}
+	if len(secret.Data.Data) == 0 || string(secret.Data.Data) == "null" {
+		return "", fmt.Errorf("vault secret %s has no data", name)
+	}
+	return string(secret.Data.Data), nil
+}
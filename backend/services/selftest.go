@@ -0,0 +1,26 @@
+package services
+
+// SelfTestMarker is the invoice number of the self-test document, which its
+// extracted text has to contain
+const SelfTestMarker = "SELFTEST-0001"
+
+// SelfTestDocument is the canned invoice the end-to-end self test sends
+// through storage, extraction, analysis and scoring: a one-page PDF, so that
+// extraction goes through the extractor real uploads of PDFs use
+func SelfTestDocument() []byte {
+	w := newPDFWriter(Localizer{})
+	w.Heading("INVOICE", 16)
+	w.Field("Invoice number", SelfTestMarker)
+	w.Field("Vendor", "FraudDocAI Self Test Supplies Ltd")
+	w.Field("Date", "2024-01-15")
+	w.Space(12)
+	w.Paragraph("Printer paper 10 x 4.50 45.00")
+	w.Paragraph("Toner cartridge 2 x 60.00 120.00")
+	w.Space(12)
+	w.Field("Subtotal", "165.00")
+	w.Field("VAT (20%)", "33.00")
+	w.Field("Total", "198.00")
+	w.Space(12)
+	w.Paragraph("This document is generated by the FraudDocAI self test and is never stored.")
+	return w.Bytes()
+}
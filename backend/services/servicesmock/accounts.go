@@ -0,0 +1,206 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Account operations. The roll-ups are recomputed from the statements and
+// evidence on every record, as the database does.
+func (s *Store) GetOrCreateAccount(tenantID *string, kind, identifier string) (*services.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		if sameTenant(account.TenantID, tenantID) && account.Kind == kind && account.Identifier == identifier {
+			c := *account
+			return &c, nil
+		}
+	}
+	now := time.Now()
+	account := &services.Account{ID: s.newID(), TenantID: tenantID, Kind: kind, Identifier: identifier, CreatedAt: now, UpdatedAt: now}
+	s.accounts = append(s.accounts, account)
+	c := *account
+	return &c, nil
+}
+
+func sameTenant(a, b *string) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func (s *Store) GetAccount(id string) (*services.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, account := range s.accounts {
+		if account.ID == id {
+			c := *account
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetAccountStatement(documentID services.DocumentID) (*services.AccountStatement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, statement := range s.statements {
+		if statement.DocumentID == documentID {
+			c := *statement
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetPreviousAccountStatement(accountID string, documentID services.DocumentID) (*services.AccountStatement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Statements are kept in the order they were recorded
+	for i := len(s.statements) - 1; i >= 0; i-- {
+		if statement := s.statements[i]; statement.AccountID == accountID && statement.DocumentID != documentID {
+			c := *statement
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) GetSeenAccountSegments(accountID string, documentID services.DocumentID, digests []string) (map[string]services.DocumentID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := map[string]services.DocumentID{}
+	for _, digest := range digests {
+		if first, ok := s.segments[accountID][digest]; ok && first != documentID {
+			seen[digest] = first
+		}
+	}
+	return seen, nil
+}
+
+func (s *Store) RecordAccountStatement(statement *services.AccountStatement, digests []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *statement
+	c.CreatedAt = time.Now()
+	replaced := false
+	for i, existing := range s.statements {
+		if existing.DocumentID == statement.DocumentID {
+			c.CreatedAt = existing.CreatedAt
+			s.statements[i] = &c
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.statements = append(s.statements, &c)
+	}
+
+	if s.segments[statement.AccountID] == nil {
+		s.segments[statement.AccountID] = map[string]services.DocumentID{}
+	}
+	for _, digest := range digests {
+		if _, ok := s.segments[statement.AccountID][digest]; !ok {
+			s.segments[statement.AccountID][digest] = statement.DocumentID
+		}
+	}
+
+	for _, account := range s.accounts {
+		if account.ID != statement.AccountID {
+			continue
+		}
+		account.Statements = 0
+		for _, st := range s.statements {
+			if st.AccountID == account.ID {
+				documentID := st.DocumentID
+				account.Statements++
+				account.LastDocumentID = &documentID
+			}
+		}
+		account.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *Store) RecordAccountEvidence(evidence *services.AccountEvidence, halfLife time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *evidence
+	c.AnalyzedAt = time.Now()
+	replaced := false
+	for i, existing := range s.evidence {
+		if existing.AccountID == evidence.AccountID && existing.DocumentID == evidence.DocumentID {
+			s.evidence[i] = &c
+			replaced = true
+		}
+	}
+	if !replaced {
+		s.evidence = append(s.evidence, &c)
+	}
+
+	var all []*services.AccountEvidence
+	findings := 0
+	for _, e := range s.evidence {
+		if e.AccountID == evidence.AccountID {
+			e := *e
+			all = append(all, &e)
+			findings += e.PatternCount
+		}
+	}
+	risk := services.AccountRisk(all, halfLife, time.Now())
+	for _, account := range s.accounts {
+		if account.ID == evidence.AccountID {
+			account.Documents, account.RiskScore, account.Findings = len(all), &risk, findings
+			account.UpdatedAt = time.Now()
+		}
+	}
+	return nil
+}
+
+func (s *Store) ListAccountEvidence(accountID string) ([]*services.AccountEvidence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evidence := []*services.AccountEvidence{}
+	for i := len(s.evidence) - 1; i >= 0; i-- {
+		if e := s.evidence[i]; e.AccountID == accountID {
+			c := *e
+			if doc, ok := s.documents[e.DocumentID]; ok {
+				c.Filename, c.DocumentType = doc.OriginalFilename, doc.DocumentType
+			}
+			evidence = append(evidence, &c)
+		}
+	}
+	sort.SliceStable(evidence, func(i, j int) bool { return evidence[i].ObservedAt.After(evidence[j].ObservedAt) })
+	return evidence, nil
+}
+
+func (s *Store) ListDocumentAccounts(documentID services.DocumentID) ([]*services.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := []*services.Account{}
+	for _, account := range s.accounts {
+		for _, e := range s.evidence {
+			if e.AccountID == account.ID && e.DocumentID == documentID {
+				c := *account
+				accounts = append(accounts, &c)
+				break
+			}
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Kind != accounts[j].Kind {
+			return accounts[i].Kind < accounts[j].Kind
+		}
+		return accounts[i].Identifier < accounts[j].Identifier
+	})
+	return accounts, nil
+}
@@ -0,0 +1,189 @@
+package servicesmock
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// AIClient is a services.AIClient returning canned responses. Set the Func
+// fields to control a response or simulate failures such as
+// services.ErrAIServiceUnavailable.
+type AIClient struct {
+	AnalyzeTextFunc          func(ctx context.Context, req services.AnalyzeTextRequest) (*services.AnalyzeTextResponse, error)
+	AskDocumentFunc          func(ctx context.Context, req services.AskDocumentRequest) (*services.AskDocumentResponse, error)
+	AnalyzeDocumentFraudFunc func(ctx context.Context, req services.DocumentFraudRequest) (*services.DocumentFraudResponse, error)
+	GetQAModelInfoFunc       func(ctx context.Context) (*services.QAModelInfoResponse, error)
+	AnalyzeBatchFunc         func(ctx context.Context, req services.AnalyzeBatchRequest) (*services.AnalyzeBatchResponse, error)
+	GenerateEmbeddingFunc    func(ctx context.Context, req services.EmbeddingRequest) (*services.EmbeddingResponse, error)
+	ExtractTextFunc          func(ctx context.Context, req services.ExtractTextRequest) (*services.ExtractTextResponse, error)
+	CheckContractFunc        func(ctx context.Context) (*services.AIContractReport, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+var _ services.AIClient = (*AIClient)(nil)
+
+func NewAIClient() *AIClient {
+	return &AIClient{}
+}
+
+func (a *AIClient) record(call string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls = append(a.calls, call)
+}
+
+// Calls lists the methods invoked so far, in order
+func (a *AIClient) Calls() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]string, len(a.calls))
+	copy(out, a.calls)
+	return out
+}
+
+func score(v float64) *float64 {
+	return &v
+}
+
+func (a *AIClient) AnalyzeText(ctx context.Context, req services.AnalyzeTextRequest) (*services.AnalyzeTextResponse, error) {
+	a.record("AnalyzeText")
+	return a.analyzeText(ctx, req)
+}
+
+func (a *AIClient) analyzeText(ctx context.Context, req services.AnalyzeTextRequest) (*services.AnalyzeTextResponse, error) {
+	if a.AnalyzeTextFunc != nil {
+		return a.AnalyzeTextFunc(ctx, req)
+	}
+	return &services.AnalyzeTextResponse{
+		TextLength:      len(req.Text),
+		FraudScore:      score(0.1),
+		RiskLevel:       "LOW",
+		Patterns:        []string{},
+		EmotionAnalysis: json.RawMessage(`{"emotions":[]}`),
+		PatternAnalysis: json.RawMessage(`{"patterns":[]}`),
+	}, nil
+}
+
+// AnalyzeBatch answers each text as AnalyzeText would unless AnalyzeBatchFunc
+// is set
+func (a *AIClient) AnalyzeBatch(ctx context.Context, req services.AnalyzeBatchRequest) (*services.AnalyzeBatchResponse, error) {
+	a.record("AnalyzeBatch")
+	if a.AnalyzeBatchFunc != nil {
+		return a.AnalyzeBatchFunc(ctx, req)
+	}
+	resp := &services.AnalyzeBatchResponse{Count: len(req.Texts)}
+	for _, text := range req.Texts {
+		result, err := a.analyzeText(ctx, services.AnalyzeTextRequest{Text: text})
+		if err != nil {
+			return nil, err
+		}
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, nil
+}
+
+// GenerateEmbedding returns a deterministic vector derived from the words of
+// the text, so texts sharing words are similar
+func (a *AIClient) GenerateEmbedding(ctx context.Context, req services.EmbeddingRequest) (*services.EmbeddingResponse, error) {
+	a.record("GenerateEmbedding")
+	if a.GenerateEmbeddingFunc != nil {
+		return a.GenerateEmbeddingFunc(ctx, req)
+	}
+	embedding := make([]float32, services.EmbeddingDimensions)
+	for _, word := range strings.Fields(strings.ToLower(req.Text)) {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		embedding[h.Sum32()%services.EmbeddingDimensions]++
+	}
+	return &services.EmbeddingResponse{
+		Embeddings:         embedding,
+		EmbeddingDimension: len(embedding),
+		Model:              "mock",
+	}, nil
+}
+
+// ExtractText returns the content itself as the text, as if every document
+// were a cleanly scanned page
+func (a *AIClient) ExtractText(ctx context.Context, req services.ExtractTextRequest) (*services.ExtractTextResponse, error) {
+	a.record("ExtractText")
+	if a.ExtractTextFunc != nil {
+		return a.ExtractTextFunc(ctx, req)
+	}
+	content, err := io.ReadAll(req.Content)
+	if err != nil {
+		return nil, err
+	}
+	text := string(content)
+	return &services.ExtractTextResponse{
+		Filename:        req.Filename,
+		FileType:        "mock",
+		ExtractedText:   &text,
+		ConfidenceScore: score(99),
+		QualityLevel:    "excellent",
+		TextBlocks:      1,
+	}, nil
+}
+
+func (a *AIClient) AskDocument(ctx context.Context, req services.AskDocumentRequest) (*services.AskDocumentResponse, error) {
+	a.record("AskDocument")
+	if a.AskDocumentFunc != nil {
+		return a.AskDocumentFunc(ctx, req)
+	}
+	answer := "mock answer"
+	return &services.AskDocumentResponse{
+		Question:   req.Question,
+		Answer:     &answer,
+		Confidence: score(0.9),
+		ModelUsed:  "mock",
+	}, nil
+}
+
+func (a *AIClient) AnalyzeDocumentFraud(ctx context.Context, req services.DocumentFraudRequest) (*services.DocumentFraudResponse, error) {
+	a.record("AnalyzeDocumentFraud")
+	if a.AnalyzeDocumentFraudFunc != nil {
+		return a.AnalyzeDocumentFraudFunc(ctx, req)
+	}
+	return &services.DocumentFraudResponse{
+		DocumentLength: len(req.DocumentText),
+		FraudAnalysis:  json.RawMessage(`[]`),
+		OverallRisk:    "low",
+		TotalRiskScore: score(0.1),
+		ModelUsed:      "mock",
+	}, nil
+}
+
+func (a *AIClient) GetQAModelInfo(ctx context.Context) (*services.QAModelInfoResponse, error) {
+	a.record("GetQAModelInfo")
+	if a.GetQAModelInfoFunc != nil {
+		return a.GetQAModelInfoFunc(ctx)
+	}
+	available := true
+	return &services.QAModelInfoResponse{
+		ModelAvailable: &available,
+		ModelInfo:      json.RawMessage(`{"model_name":"mock"}`),
+	}, nil
+}
+
+func (a *AIClient) CheckContract(ctx context.Context) (*services.AIContractReport, error) {
+	a.record("CheckContract")
+	if a.CheckContractFunc != nil {
+		return a.CheckContractFunc(ctx)
+	}
+	return &services.AIContractReport{
+		ExpectedSchemaVersion: services.AISchemaVersion,
+		ServiceSchemaVersion:  services.AISchemaVersion,
+		ServiceVersion:        "mock",
+		Compatible:            true,
+		Checks:                []services.AIContractCheck{{Endpoint: "/", Passed: true}},
+		CheckedAt:             time.Now().UTC(),
+	}, nil
+}
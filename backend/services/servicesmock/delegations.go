@@ -0,0 +1,105 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Delegation operations
+func (s *Store) CreateDelegation(delegation *services.Delegation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delegation.ID = s.newID()
+	delegation.CreatedAt = time.Now()
+	c := *delegation
+	s.delegations = append(s.delegations, &c)
+	return nil
+}
+
+func (s *Store) GetDelegation(id string) (*services.Delegation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, delegation := range s.delegations {
+		if delegation.ID == id {
+			c := *delegation
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetDelegations(userID string, since time.Time) ([]*services.Delegation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delegations := []*services.Delegation{}
+	for _, delegation := range s.delegations {
+		if (delegation.DelegatorID == userID || delegation.DelegateID == userID) && delegation.EndsAt.After(since) {
+			c := *delegation
+			delegations = append(delegations, &c)
+		}
+	}
+	sort.SliceStable(delegations, func(i, j int) bool { return delegations[i].StartsAt.Before(delegations[j].StartsAt) })
+	return delegations, nil
+}
+
+func (s *Store) DeleteDelegation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, delegation := range s.delegations {
+		if delegation.ID == id {
+			s.delegations = append(s.delegations[:i], s.delegations[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) ResolveAssignee(userID string, t time.Time) (string, *services.Delegation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	assignee := userID
+	var applied *services.Delegation
+	seen := map[string]bool{userID: true}
+	for {
+		var active *services.Delegation
+		for _, delegation := range s.delegations {
+			if delegation.DelegatorID == assignee && delegation.Active(t) &&
+				(active == nil || delegation.CreatedAt.After(active.CreatedAt)) {
+				active = delegation
+			}
+		}
+		if active == nil || seen[active.DelegateID] {
+			return assignee, applied, nil
+		}
+		seen[active.DelegateID] = true
+		assignee = active.DelegateID
+		if applied == nil {
+			c := *active
+			applied = &c
+		}
+	}
+}
+
+func (s *Store) AssignAlert(id, assignee string, original *string) (*services.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, alert := range s.alerts {
+		if alert.ID == id {
+			now := time.Now()
+			alert.AssignedTo = &assignee
+			alert.OriginalAssignee = original
+			alert.AssignedAt = &now
+			return copyAlert(alert), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
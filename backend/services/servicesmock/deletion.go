@@ -0,0 +1,57 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// deletedDocument is a document deleted but not yet purged, kept apart so
+// that every other method no longer finds it
+type deletedDocument struct {
+	document  *services.Document
+	deletedAt time.Time
+}
+
+func (s *Store) DeleteDocument(id services.DocumentID, deletedBy *string) (*services.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(s.documents, id)
+	s.deleted[id] = &deletedDocument{document: doc, deletedAt: time.Now()}
+
+	detections := s.detections[:0]
+	for _, detection := range s.detections {
+		if detection.DocumentID != id {
+			detections = append(detections, detection)
+		}
+	}
+	s.detections = detections
+	return copyDocument(doc), nil
+}
+
+func (s *Store) PurgeDeletedDocuments(before time.Time, limit int) ([]services.DocumentID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := []services.DocumentID{}
+	for id, deleted := range s.deleted {
+		if deleted.deletedAt.Before(before) {
+			purged = append(purged, id)
+		}
+	}
+	sort.Slice(purged, func(i, j int) bool { return s.deleted[purged[i]].deletedAt.Before(s.deleted[purged[j]].deletedAt) })
+	if len(purged) > limit {
+		purged = purged[:limit]
+	}
+	for _, id := range purged {
+		delete(s.deleted, id)
+	}
+	return purged, nil
+}
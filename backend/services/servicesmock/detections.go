@@ -0,0 +1,170 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+func (s *Store) GetFraudDetections(filter services.DetectionFilter) ([]*services.DetectionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	patterns := map[string]*services.FraudPattern{}
+	for _, pattern := range s.patterns {
+		patterns[pattern.ID] = pattern
+	}
+
+	var records []*services.DetectionRecord
+	for _, detection := range s.detections {
+		doc, ok := s.documents[detection.DocumentID]
+		if !ok {
+			continue
+		}
+		var pattern *services.FraudPattern
+		if detection.FraudPatternID != nil {
+			pattern = patterns[*detection.FraudPatternID]
+		}
+		if !matchesDetectionFilter(filter, detection, doc, pattern) {
+			continue
+		}
+
+		c := *detection
+		record := &services.DetectionRecord{
+			FraudDetection: &c,
+			Document: services.DetectionDocument{
+				ID:               doc.ID,
+				OriginalFilename: doc.OriginalFilename,
+				DocumentType:     doc.DocumentType,
+				Status:           doc.Status,
+				FraudScore:       doc.FraudScore,
+				FraudRiskLevel:   doc.FraudRiskLevel,
+				TenantID:         doc.TenantID,
+			},
+		}
+		if pattern != nil {
+			record.Pattern = &services.DetectionPattern{
+				ID:       pattern.ID,
+				Name:     pattern.PatternName,
+				Type:     pattern.PatternType,
+				Severity: pattern.Severity,
+			}
+		}
+		records = append(records, record)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].CreatedAt.After(records[j].CreatedAt) })
+
+	if filter.Offset >= len(records) {
+		return nil, nil
+	}
+	records = records[filter.Offset:]
+	if filter.Limit < len(records) {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+func matchesDetectionFilter(filter services.DetectionFilter, detection *services.FraudDetection, doc *services.Document, pattern *services.FraudPattern) bool {
+	switch {
+	case filter.DocumentID != "" && detection.DocumentID != filter.DocumentID:
+		return false
+	case filter.TenantID != "" && (doc.TenantID == nil || *doc.TenantID != filter.TenantID):
+		return false
+	case filter.PatternID != "" && (detection.FraudPatternID == nil || *detection.FraudPatternID != filter.PatternID):
+		return false
+	case filter.PatternType != "" && (pattern == nil || pattern.PatternType != filter.PatternType):
+		return false
+	case filter.MinConfidence != nil && detection.ConfidenceScore < *filter.MinConfidence:
+		return false
+	case filter.MaxConfidence != nil && detection.ConfidenceScore > *filter.MaxConfidence:
+		return false
+	case filter.Reviewed != nil && (detection.ReviewedAt != nil) != *filter.Reviewed:
+		return false
+	case filter.Since != nil && detection.CreatedAt.Before(*filter.Since):
+		return false
+	case filter.Until != nil && !detection.CreatedAt.Before(*filter.Until):
+		return false
+	}
+	return true
+}
+
+func (s *Store) GetFraudPattern(id string) (*services.FraudPattern, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, pattern := range s.patterns {
+		if pattern.ID == id {
+			c := *pattern
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetFraudPatternStats(patternID string, since time.Time, interval string, loc *time.Location) (*services.PatternStats, error) {
+	if interval != services.StatsIntervalDay && interval != services.StatsIntervalWeek {
+		return nil, fmt.Errorf("unknown stats interval %q", interval)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := &services.PatternStats{PatternID: patternID, Since: since, TimeZone: loc.String(), Interval: interval, Trend: []*services.PatternTrendPoint{}}
+	documents := map[services.DocumentID]bool{}
+	points := map[string]*services.PatternTrendPoint{}
+	var confidence float64
+	pointConfidence := map[string]float64{}
+	for _, detection := range s.detections {
+		if detection.FraudPatternID == nil || *detection.FraudPatternID != patternID || detection.CreatedAt.Before(since) {
+			continue
+		}
+
+		day := services.StartOfDay(detection.CreatedAt, loc)
+		if interval == services.StatsIntervalWeek {
+			day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		}
+		period := day.Format("2006-01-02")
+		point, ok := points[period]
+		if !ok {
+			point = &services.PatternTrendPoint{Period: period}
+			points[period] = point
+			stats.Trend = append(stats.Trend, point)
+		}
+
+		stats.Detections++
+		point.Detections++
+		documents[detection.DocumentID] = true
+		confidence += detection.ConfidenceScore
+		pointConfidence[period] += detection.ConfidenceScore
+		if detection.ReviewedAt != nil {
+			stats.Reviewed++
+			point.Reviewed++
+			if detection.IsFalsePositive {
+				stats.FalsePositives++
+				point.FalsePositives++
+			}
+		}
+	}
+
+	stats.Documents = len(documents)
+	if stats.Detections > 0 {
+		average := confidence / float64(stats.Detections)
+		stats.AverageConfidence = &average
+	}
+	if stats.Reviewed > 0 {
+		rate := float64(stats.FalsePositives) / float64(stats.Reviewed)
+		stats.FalsePositiveRate = &rate
+	}
+	for _, point := range stats.Trend {
+		point.AverageConfidence = pointConfidence[point.Period] / float64(point.Detections)
+		if point.Reviewed > 0 {
+			rate := float64(point.FalsePositives) / float64(point.Reviewed)
+			point.FalsePositiveRate = &rate
+		}
+	}
+	sort.Slice(stats.Trend, func(i, j int) bool { return stats.Trend[i].Period < stats.Trend[j].Period })
+	return stats, nil
+}
@@ -0,0 +1,73 @@
+package servicesmock
+
+import (
+	"sort"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Entity operations
+func (s *Store) ReplaceDocumentEntities(documentID services.DocumentID, entities []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored []*services.DocumentEntity
+	now := time.Now()
+	for _, entity := range entities {
+		kind, value, ok := services.ParseEntity(entity)
+		if !ok {
+			continue
+		}
+		stored = append(stored, &services.DocumentEntity{DocumentID: documentID, Kind: kind, Value: value, CreatedAt: now})
+	}
+	s.entities[documentID] = stored
+	return nil
+}
+
+func (s *Store) GetDocumentEntities(documentID services.DocumentID) ([]*services.DocumentEntity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entities := []*services.DocumentEntity{}
+	for _, entity := range s.entities[documentID] {
+		c := *entity
+		entities = append(entities, &c)
+	}
+	sort.Slice(entities, func(i, j int) bool {
+		if entities[i].Kind != entities[j].Kind {
+			return entities[i].Kind < entities[j].Kind
+		}
+		return entities[i].Value < entities[j].Value
+	})
+	return entities, nil
+}
+
+// Page operations
+func (s *Store) ReplaceDocumentPages(documentID services.DocumentID, pages []*services.DocumentPage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stored []*services.DocumentPage
+	now := time.Now()
+	for _, page := range pages {
+		c := *page
+		c.DocumentID, c.UpdatedAt = documentID, now
+		stored = append(stored, &c)
+	}
+	s.pages[documentID] = stored
+	return nil
+}
+
+func (s *Store) GetDocumentPages(documentID services.DocumentID) ([]*services.DocumentPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pages := []*services.DocumentPage{}
+	for _, page := range s.pages[documentID] {
+		c := *page
+		pages = append(pages, &c)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Page < pages[j].Page })
+	return pages, nil
+}
@@ -0,0 +1,165 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+func copyExemplar(exemplar *services.Exemplar) *services.Exemplar {
+	c := *exemplar
+	c.Entities = append([]string(nil), exemplar.Entities...)
+	c.Embedding = append([]float32(nil), exemplar.Embedding...)
+	return &c
+}
+
+func copyAlert(alert *services.Alert) *services.Alert {
+	c := *alert
+	if alert.Details != nil {
+		c.Details = services.Metadata{}
+		for k, v := range alert.Details {
+			c.Details[k] = v
+		}
+	}
+	return &c
+}
+
+// Exemplar operations
+func (s *Store) CreateExemplar(exemplar *services.Exemplar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if exemplar.Entities == nil {
+		exemplar.Entities = []string{}
+	}
+	exemplar.ID = s.newID()
+	exemplar.CreatedAt = time.Now()
+	s.exemplars = append(s.exemplars, copyExemplar(exemplar))
+	return nil
+}
+
+func (s *Store) GetExemplar(id string) (*services.Exemplar, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, exemplar := range s.exemplars {
+		if exemplar.ID == id {
+			return copyExemplar(exemplar), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetExemplars(tenantID *string) ([]*services.Exemplar, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var exemplars []*services.Exemplar
+	for i := len(s.exemplars) - 1; i >= 0; i-- {
+		exemplar := s.exemplars[i]
+		if exemplar.TenantID == nil || (tenantID != nil && *exemplar.TenantID == *tenantID) {
+			exemplars = append(exemplars, copyExemplar(exemplar))
+		}
+	}
+	return exemplars, nil
+}
+
+func (s *Store) DeleteExemplar(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, exemplar := range s.exemplars {
+		if exemplar.ID == id {
+			s.exemplars = append(s.exemplars[:i], s.exemplars[i+1:]...)
+			for _, alert := range s.alerts {
+				if alert.ExemplarID != nil && *alert.ExemplarID == id {
+					alert.ExemplarID = nil
+				}
+			}
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// Alert operations
+func (s *Store) CreateAlert(alert *services.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if alert.Details == nil {
+		alert.Details = services.Metadata{}
+	}
+	alert.ID = s.newID()
+	alert.CreatedAt = time.Now()
+	s.alerts = append(s.alerts, copyAlert(alert))
+	return nil
+}
+
+func (s *Store) GetAlert(id string) (*services.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, alert := range s.alerts {
+		if alert.ID == id {
+			return copyAlert(alert), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetAlerts(limit, offset int, unacknowledgedOnly bool, tenantID *string) ([]*services.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var alerts []*services.Alert
+	for _, alert := range s.alerts {
+		if unacknowledgedOnly && alert.AcknowledgedAt != nil {
+			continue
+		}
+		if tenantID == nil || (alert.TenantID != nil && *alert.TenantID == *tenantID) {
+			alerts = append(alerts, copyAlert(alert))
+		}
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].CreatedAt.After(alerts[j].CreatedAt) })
+
+	if offset >= len(alerts) {
+		return nil, nil
+	}
+	alerts = alerts[offset:]
+	if limit < len(alerts) {
+		alerts = alerts[:limit]
+	}
+	return alerts, nil
+}
+
+func (s *Store) AcknowledgeAlert(id, by, disposition string) (*services.Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, alert := range s.alerts {
+		if alert.ID == id {
+			taxonomy := services.DefaultDispositionTaxonomy()
+			for _, tenant := range s.tenants {
+				if alert.TenantID != nil && tenant.ID == *alert.TenantID {
+					taxonomy = tenant.Dispositions()
+				}
+			}
+			chosen, err := taxonomy.Lookup(disposition)
+			if err != nil {
+				return nil, err
+			}
+			if alert.AcknowledgedAt == nil {
+				now := time.Now()
+				alert.AcknowledgedBy = &by
+				alert.AcknowledgedAt = &now
+				alert.Disposition = &chosen.Code
+				alert.DispositionOutcome = &chosen.Outcome
+			}
+			return copyAlert(alert), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
@@ -0,0 +1,34 @@
+package servicesmock
+
+import (
+	"sort"
+
+	"frauddocai-backend/services"
+)
+
+// Amount operations
+func (s *Store) ReplaceDocumentAmounts(documentID services.DocumentID, amounts services.DocumentAmounts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := services.DocumentAmounts{}
+	for _, amount := range amounts {
+		c := *amount
+		stored = append(stored, &c)
+	}
+	s.amounts[documentID] = stored
+	return nil
+}
+
+func (s *Store) GetDocumentAmounts(documentID services.DocumentID) (services.DocumentAmounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	amounts := services.DocumentAmounts{}
+	for _, amount := range s.amounts[documentID] {
+		c := *amount
+		amounts = append(amounts, &c)
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i].Field < amounts[j].Field })
+	return amounts, nil
+}
@@ -0,0 +1,187 @@
+package servicesmock
+
+import (
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+type pipelineJob struct {
+	services.PipelineJob
+	owner     string
+	expiresAt time.Time
+	err       string
+}
+
+// Pipeline job operations
+func (s *Store) GetPipelineBacklog(window time.Duration) (*services.PipelineBacklog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := &services.PipelineBacklog{Window: window}
+	for _, job := range s.jobs {
+		switch job.State {
+		case services.JobQueued:
+			backlog.Queued++
+		case services.JobRunning:
+			backlog.Running++
+		}
+	}
+	since := time.Now().Add(-window)
+	for _, runs := range s.pipelineRuns {
+		for _, run := range runs {
+			for _, stage := range run {
+				if stage.Stage == services.StageAIAnalysis && stage.Outcome != services.StageSkipped && !stage.RunStartedAt.Before(since) {
+					backlog.Finished++
+				}
+			}
+		}
+	}
+	return backlog, nil
+}
+
+func (s *Store) GetPipelineQueuePosition(documentID services.DocumentID) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ahead := 0
+	for _, job := range s.jobs {
+		if job.State != services.JobQueued {
+			continue
+		}
+		if job.DocumentID == documentID {
+			return ahead, true, nil
+		}
+		ahead++
+	}
+	return 0, false, nil
+}
+
+func (s *Store) EnqueuePipelineJob(documentID services.DocumentID, reuseText bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextJobID++
+	s.jobs = append(s.jobs, &pipelineJob{PipelineJob: services.PipelineJob{
+		ID:         s.nextJobID,
+		DocumentID: documentID,
+		ReuseText:  reuseText,
+		State:      services.JobQueued,
+	}})
+	return nil
+}
+
+func (s *Store) ClaimPipelineJobs(owner string, lease time.Duration, limit int) ([]*services.PipelineJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var claimed []*services.PipelineJob
+	for _, job := range s.jobs {
+		if len(claimed) == limit {
+			break
+		}
+		if job.State != services.JobQueued && !(job.State == services.JobRunning && job.expiresAt.Before(now)) {
+			continue
+		}
+		job.State = services.JobRunning
+		job.owner = owner
+		job.expiresAt = now.Add(lease)
+		job.Attempts++
+		c := job.PipelineJob
+		claimed = append(claimed, &c)
+	}
+	return claimed, nil
+}
+
+func (s *Store) RenewPipelineJobLease(id int64, owner string, lease time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ID == id && job.State == services.JobRunning && job.owner == owner {
+			job.expiresAt = time.Now().Add(lease)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) CompletePipelineJob(id int64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, job := range s.jobs {
+		if job.ID == id && job.owner == owner {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *Store) CheckpointPipelineJob(id int64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ID == id && job.owner == owner {
+			job.ReuseText = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) ReleasePipelineJob(id int64, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ID == id && job.State == services.JobRunning && job.owner == owner {
+			job.State = services.JobQueued
+			job.owner = ""
+			job.Attempts--
+		}
+	}
+	return nil
+}
+
+func (s *Store) QueueStalledDocuments(staleBefore time.Time) ([]*services.PipelineJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queued := map[services.DocumentID]bool{}
+	for _, job := range s.jobs {
+		queued[job.DocumentID] = true
+	}
+	var jobs []*services.PipelineJob
+	for _, doc := range s.documents {
+		if doc.Status != services.DocumentUploaded || !doc.UpdatedAt.Before(staleBefore) || queued[doc.ID] {
+			continue
+		}
+		s.nextJobID++
+		job := &pipelineJob{PipelineJob: services.PipelineJob{
+			ID:         s.nextJobID,
+			DocumentID: doc.ID,
+			ReuseText:  doc.ExtractedText != nil,
+			State:      services.JobQueued,
+		}}
+		s.jobs = append(s.jobs, job)
+		c := job.PipelineJob
+		jobs = append(jobs, &c)
+	}
+	return jobs, nil
+}
+
+func (s *Store) FailPipelineJob(id int64, owner, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, job := range s.jobs {
+		if job.ID == id && job.owner == owner {
+			job.State = services.JobFailed
+			job.err = reason
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package servicesmock
+
+import (
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Maintenance mode operations
+func (s *Store) GetMaintenance() (*services.Maintenance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.maintenance
+	return &c, nil
+}
+
+func (s *Store) SetMaintenance(maintenance *services.Maintenance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maintenance.ChangedAt = time.Now()
+	s.maintenance = *maintenance
+	return nil
+}
@@ -0,0 +1,56 @@
+package servicesmock
+
+import (
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Pipeline run operations
+func (s *Store) RecordPipelineRun(documentID services.DocumentID, stages []*services.PipelineStageRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := len(s.pipelineRuns[documentID]) + 1
+	stored := make([]*services.PipelineStageRun, len(stages))
+	for i, stage := range stages {
+		stage.Run = run
+		c := *stage
+		stored[i] = &c
+	}
+	s.pipelineRuns[documentID] = append(s.pipelineRuns[documentID], stored)
+	return nil
+}
+
+func (s *Store) GetPipelineStageRuns(documentID services.DocumentID) ([]*services.PipelineStageRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stages := []*services.PipelineStageRun{}
+	runs := s.pipelineRuns[documentID]
+	if len(runs) == 0 {
+		return stages, nil
+	}
+	for _, stage := range runs[len(runs)-1] {
+		c := *stage
+		stages = append(stages, &c)
+	}
+	return stages, nil
+}
+
+func (s *Store) GetPipelineStats(since time.Time) (*services.PipelineStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stages []*services.PipelineStageRun
+	for _, runs := range s.pipelineRuns {
+		for _, run := range runs {
+			for _, stage := range run {
+				if !stage.RunStartedAt.Before(since) {
+					stages = append(stages, stage)
+				}
+			}
+		}
+	}
+	return services.SummarizePipelineStages(since, stages), nil
+}
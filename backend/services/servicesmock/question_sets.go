@@ -0,0 +1,87 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Question set operations
+func (s *Store) CreateQuestionSet(set *services.QuestionSet) error {
+	if err := set.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	set.Version = 1
+	for _, existing := range s.questionSets {
+		if existing.TenantID == set.TenantID && existing.Version >= set.Version {
+			set.Version = existing.Version + 1
+		}
+	}
+	set.ID = s.newID()
+	set.CreatedAt = time.Now()
+	c := *set
+	s.questionSets = append(s.questionSets, &c)
+	return nil
+}
+
+func (s *Store) GetQuestionSet(tenantID string, version int) (*services.QuestionSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *services.QuestionSet
+	for _, set := range s.questionSets {
+		if set.TenantID != tenantID {
+			continue
+		}
+		if set.Version == version || (version == 0 && (found == nil || set.Version > found.Version)) {
+			found = set
+		}
+	}
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	c := *found
+	return &c, nil
+}
+
+func (s *Store) GetQuestionSets(tenantID string) ([]*services.QuestionSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sets []*services.QuestionSet
+	for i := len(s.questionSets) - 1; i >= 0; i-- {
+		if s.questionSets[i].TenantID == tenantID {
+			c := *s.questionSets[i]
+			sets = append(sets, &c)
+		}
+	}
+	return sets, nil
+}
+
+func (s *Store) CreateFraudQAAnalysis(analysis *services.FraudQAAnalysis) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	analysis.ID = s.newID()
+	analysis.CreatedAt = time.Now()
+	c := *analysis
+	s.qaAnalyses = append(s.qaAnalyses, &c)
+	return nil
+}
+
+func (s *Store) GetFraudQAAnalysis(id string) (*services.FraudQAAnalysis, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, analysis := range s.qaAnalyses {
+		if analysis.ID == id {
+			c := *analysis
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
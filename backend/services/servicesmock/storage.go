@@ -0,0 +1,106 @@
+package servicesmock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Storage is an in-memory services.ObjectStorage
+type Storage struct {
+	mu      sync.Mutex
+	objects map[string]Object
+}
+
+// Object is a stored file, its content type and when it was written
+type Object struct {
+	Data        []byte
+	ContentType string
+	Modified    time.Time
+}
+
+var _ services.ObjectStorage = (*Storage)(nil)
+
+func NewStorage() *Storage {
+	return &Storage{objects: map[string]Object{}}
+}
+
+func (s *Storage) UploadFile(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return fmt.Errorf("short upload: got %d bytes, expected %d", len(data), size)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[objectName] = Object{Data: data, ContentType: contentType, Modified: time.Now()}
+	return nil
+}
+
+func (s *Storage) GetFile(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", objectName)
+	}
+	return io.NopCloser(bytes.NewReader(obj.Data)), nil
+}
+
+func (s *Storage) DeleteFile(ctx context.Context, objectName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectName)
+	return nil
+}
+
+func (s *Storage) GetFileURL(objectName string) string {
+	return "memory://documents/" + objectName
+}
+
+func (s *Storage) ListFiles(ctx context.Context, fn func(services.StoredObject) error) error {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		s.mu.Lock()
+		obj, ok := s.objects[name]
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+		err := fn(services.StoredObject{
+			Name:         name,
+			Size:         int64(len(obj.Data)),
+			ContentType:  obj.ContentType,
+			LastModified: obj.Modified,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Object returns a stored object for assertions
+func (s *Storage) Object(objectName string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[objectName]
+	return obj, ok
+}
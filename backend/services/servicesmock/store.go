@@ -0,0 +1,789 @@
+// Package servicesmock provides in-memory implementations of the service
+// interfaces for handler-level tests and local experiments.
+package servicesmock
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Store is an in-memory services.Store. Methods it does not implement fall
+// through to the embedded nil interface and panic, so a test that reaches
+// one fails loudly instead of passing by accident.
+type Store struct {
+	services.Store
+
+	mu           sync.Mutex
+	nextID       int
+	documents    map[services.DocumentID]*services.Document
+	deleted      map[services.DocumentID]*deletedDocument
+	detections   []*services.FraudDetection
+	tenants      map[string]*services.Tenant
+	users        map[string]*services.User
+	teams        map[string]*services.Team
+	patterns     []*services.FraudPattern
+	embeddings   map[services.DocumentID][]float32
+	analyses     map[services.DocumentID]*services.DocumentAnalysis
+	entities     map[services.DocumentID][]*services.DocumentEntity
+	pages        map[services.DocumentID][]*services.DocumentPage
+	exemplars    []*services.Exemplar
+	alerts       []*services.Alert
+	delegations  []*services.Delegation
+	objectRefs   map[string]int
+	rotations    []services.CredentialRotation
+	maintenance  services.Maintenance
+	questionSets []*services.QuestionSet
+	qaAnalyses   []*services.FraudQAAnalysis
+	submissions  []*services.Submission
+	auditLog     []*services.AuditLogEntry
+	velocity     []*services.VelocityCount
+	accounts     []*services.Account
+	statements   []*services.AccountStatement
+	segments     map[string]map[string]services.DocumentID
+	evidence     []*services.AccountEvidence
+	amounts      map[services.DocumentID]services.DocumentAmounts
+
+	pipelineRuns map[services.DocumentID][][]*services.PipelineStageRun
+	jobs         []*pipelineJob
+	nextJobID    int64
+}
+
+var _ services.Store = (*Store)(nil)
+
+func NewStore() *Store {
+	return &Store{
+		documents:  map[services.DocumentID]*services.Document{},
+		deleted:    map[services.DocumentID]*deletedDocument{},
+		tenants:    map[string]*services.Tenant{},
+		users:      map[string]*services.User{},
+		teams:      map[string]*services.Team{},
+		embeddings: map[services.DocumentID][]float32{},
+		analyses:   map[services.DocumentID]*services.DocumentAnalysis{},
+		entities:   map[services.DocumentID][]*services.DocumentEntity{},
+		pages:      map[services.DocumentID][]*services.DocumentPage{},
+		segments:   map[string]map[string]services.DocumentID{},
+		amounts:    map[services.DocumentID]services.DocumentAmounts{},
+		objectRefs: map[string]int{},
+
+		pipelineRuns: map[services.DocumentID][][]*services.PipelineStageRun{},
+	}
+}
+
+func (s *Store) newID() string {
+	s.nextID++
+	return fmt.Sprintf("00000000-0000-4000-8000-%012d", s.nextID)
+}
+
+func copyDocument(doc *services.Document) *services.Document {
+	c := *doc
+	if doc.Metadata != nil {
+		c.Metadata = services.Metadata{}
+		for k, v := range doc.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return &c
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) PoolStats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+// Document operations
+func (s *Store) CreateDocument(doc *services.Document) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	doc.ID = services.DocumentID(s.newID())
+	if doc.StorageTier == "" {
+		doc.StorageTier = services.StorageTierHot
+	}
+	doc.CreatedAt = now
+	doc.UpdatedAt = now
+	s.documents[doc.ID] = copyDocument(doc)
+	return nil
+}
+
+func (s *Store) GetDocument(id services.DocumentID) (*services.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyDocument(doc), nil
+}
+
+func (s *Store) GetDocuments(limit, offset int, filters []services.MetadataFilter, source services.SubmissionFilter, scope services.DocumentScope) ([]*services.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*services.Document
+	for _, doc := range s.documents {
+		if matchesFilters(doc, filters) && source.Matches(s.submission(doc.ID)) && scope.Allows(doc) {
+			matched = append(matched, copyDocument(doc))
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt.Equal(matched[j].CreatedAt) {
+			return matched[i].ID > matched[j].ID
+		}
+		return matched[i].CreatedAt.After(matched[j].CreatedAt)
+	})
+
+	if offset >= len(matched) {
+		return nil, nil
+	}
+	matched = matched[offset:]
+	if limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+func matchesFilters(doc *services.Document, filters []services.MetadataFilter) bool {
+	for _, filter := range filters {
+		value, ok := doc.Metadata[filter.Key]
+		if !ok || fmt.Sprint(value) != filter.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Store) UpdateDocumentFraudAnalysis(id services.DocumentID, analysis *services.FraudAnalysis) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok {
+		return nil
+	}
+	a := *analysis
+	doc.FraudScore = &a.FraudScore
+	doc.FraudRiskLevel = a.RiskLevel
+	doc.ExtractedText = &a.ExtractedText
+	s.analyses[id] = &services.DocumentAnalysis{EmotionAnalysis: &a.EmotionAnalysis, PatternAnalysis: &a.PatternAnalysis}
+	doc.AnalysisProvider = &a.Provider
+	doc.AnalysisFallback = a.Fallback
+	doc.AnalysisCached = a.Cached
+	doc.Status = services.DocumentProcessed
+	doc.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *Store) GetDocumentAnalysis(id services.DocumentID) (*services.DocumentAnalysis, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.analyses[id], nil
+}
+
+func (s *Store) UpdateDocumentExtractedText(id services.DocumentID, text string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	doc.ExtractedText = &text
+	doc.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *Store) PatchDocumentMetadata(id services.DocumentID, set services.Metadata, remove []string) (services.Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	merged := services.Metadata{}
+	for k, v := range doc.Metadata {
+		merged[k] = v
+	}
+	for k, v := range set {
+		merged[k] = v
+	}
+	for _, k := range remove {
+		delete(merged, k)
+	}
+	var fields services.DocumentFields
+	if doc.TenantID != nil {
+		for _, tenant := range s.tenants {
+			if tenant.ID == *doc.TenantID {
+				fields = tenant.DocumentFields
+			}
+		}
+	}
+	if err := services.ValidateMetadata(doc.DocumentType, merged, fields); err != nil {
+		return nil, err
+	}
+
+	doc.Metadata = merged
+	return merged, nil
+}
+
+func (s *Store) GetFallbackAnalyzedDocuments(limit int) ([]*services.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*services.Document
+	for _, doc := range s.documents {
+		if doc.AnalysisFallback {
+			matched = append(matched, copyDocument(doc))
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].UpdatedAt.Before(matched[j].UpdatedAt)
+	})
+	if limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+func (s *Store) GetDocumentsToArchive(before time.Time, limit int) ([]*services.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []*services.Document
+	for _, doc := range s.documents {
+		since := doc.CreatedAt
+		if doc.TierChangedAt != nil {
+			since = *doc.TierChangedAt
+		}
+		if doc.StorageTier == services.StorageTierHot && since.Before(before) {
+			matched = append(matched, copyDocument(doc))
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].CreatedAt.Before(matched[j].CreatedAt)
+	})
+	if limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+func (s *Store) GetKnownFilePaths(paths []string) (map[string]bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := map[string]bool{}
+	for _, path := range paths {
+		wanted[path] = true
+	}
+	known := map[string]bool{}
+	for _, doc := range s.documents {
+		if wanted[doc.FilePath] {
+			known[doc.FilePath] = true
+		}
+	}
+	return known, nil
+}
+
+func (s *Store) AcquireStoredObject(region, tier, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := region + "/" + tier + "/" + name
+	s.objectRefs[key]++
+	return s.objectRefs[key], nil
+}
+
+func (s *Store) ReleaseStoredObject(region, tier, name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := region + "/" + tier + "/" + name
+	if s.objectRefs[key] <= 1 {
+		delete(s.objectRefs, key)
+		return 0, nil
+	}
+	s.objectRefs[key]--
+	return s.objectRefs[key], nil
+}
+
+func (s *Store) UpdateDocumentStorageTier(id services.DocumentID, from, to string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok || doc.StorageTier != from {
+		return false, nil
+	}
+	now := time.Now()
+	doc.StorageTier = to
+	doc.TierChangedAt = &now
+	return true, nil
+}
+
+func (s *Store) SearchDocuments(query string, limit int, scope services.DocumentScope) ([]*services.Document, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query = strings.ToLower(query)
+	var matched []*services.Document
+	for _, doc := range s.documents {
+		text := ""
+		if doc.ExtractedText != nil {
+			text = *doc.ExtractedText
+		}
+		if !scope.Allows(doc) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(doc.OriginalFilename), query) || strings.Contains(strings.ToLower(text), query) {
+			matched = append(matched, copyDocument(doc))
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].CreatedAt.After(matched[j].CreatedAt) })
+	if limit < len(matched) {
+		matched = matched[:limit]
+	}
+	return matched, nil
+}
+
+// Embedding operations
+func (s *Store) SaveDocumentEmbedding(documentID services.DocumentID, model string, embedding []float32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.embeddings[documentID] = append([]float32(nil), embedding...)
+	return nil
+}
+
+func (s *Store) GetDocumentEmbedding(documentID services.DocumentID) ([]float32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	embedding, ok := s.embeddings[documentID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return append([]float32(nil), embedding...), nil
+}
+
+func (s *Store) FindSimilarDocuments(embedding []float32, limit int, excludeID services.DocumentID) ([]*services.SimilarDocument, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var results []*services.SimilarDocument
+	for id, stored := range s.embeddings {
+		doc, ok := s.documents[id]
+		if !ok || id == excludeID {
+			continue
+		}
+		results = append(results, &services.SimilarDocument{
+			Document:   copyDocument(doc),
+			Similarity: services.CosineSimilarity(embedding, stored),
+		})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Similarity > results[j].Similarity })
+	if limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (s *Store) CreateFraudDetection(detection *services.FraudDetection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	detection.ID = s.newID()
+	detection.CreatedAt = time.Now()
+	c := *detection
+	s.detections = append(s.detections, &c)
+	return nil
+}
+
+// Detections returns every fraud detection recorded so far
+func (s *Store) Detections() []*services.FraudDetection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*services.FraudDetection, len(s.detections))
+	copy(out, s.detections)
+	return out
+}
+
+// Tenant operations
+func (s *Store) CreateTenant(tenant *services.Tenant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[tenant.Slug]; ok {
+		return fmt.Errorf("tenant %s already exists", tenant.Slug)
+	}
+	tenant.ID = s.newID()
+	tenant.CreatedAt = time.Now()
+	tenant.UpdatedAt = tenant.CreatedAt
+	c := *tenant
+	s.tenants[tenant.Slug] = &c
+	return nil
+}
+
+func (s *Store) GetTenant(id string) (*services.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			c := *tenant
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) GetTenantBySlug(slug string) (*services.Tenant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenant, ok := s.tenants[slug]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *tenant
+	return &c, nil
+}
+
+func (s *Store) UpdateTenantRiskTaxonomy(id string, taxonomy *services.RiskTaxonomy) error {
+	if taxonomy != nil {
+		if err := taxonomy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			tenant.RiskTaxonomy = taxonomy
+			tenant.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) UpdateTenantDispositionTaxonomy(id string, taxonomy *services.DispositionTaxonomy) error {
+	if taxonomy != nil {
+		if err := taxonomy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			tenant.DispositionTaxonomy = taxonomy
+			tenant.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) UpdateTenantDocumentFields(id string, fields services.DocumentFields) error {
+	if err := fields.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			tenant.DocumentFields = fields
+			if len(fields) == 0 {
+				tenant.DocumentFields = nil
+			}
+			tenant.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) UpdateTenantApprovalPolicy(id string, policy *services.ApprovalPolicy) error {
+	if policy != nil {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			tenant.ApprovalPolicy = policy
+			tenant.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) UpdateTenantChannelWeights(id string, weights services.ChannelWeights) error {
+	if err := weights.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			tenant.ChannelWeights = weights
+			tenant.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *Store) UpdateTenantStorageRegion(id string, region *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID == id {
+			tenant.StorageRegion = region
+			tenant.UpdatedAt = time.Now()
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+// User operations
+func (s *Store) CreateUser(user *services.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.Email]; ok {
+		return fmt.Errorf("user %s already exists", user.Email)
+	}
+	user.ID = s.newID()
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	c := *user
+	s.users[user.Email] = &c
+	return nil
+}
+
+func (s *Store) GetUserByEmail(email string) (*services.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[email]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *user
+	return &c, nil
+}
+
+func (s *Store) GetUser(id string) (*services.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			c := *user
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) UpdateUserRole(id, role string) (*services.User, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.ID == id {
+			previous := user.Role
+			user.Role = role
+			user.UpdatedAt = time.Now()
+			c := *user
+			return &c, previous, nil
+		}
+	}
+	return nil, "", sql.ErrNoRows
+}
+
+// Team operations
+func copyTeam(team *services.Team) *services.Team {
+	c := *team
+	c.Members = append([]string{}, team.Members...)
+	return &c
+}
+
+func (s *Store) CreateTeam(team *services.Team) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.teams {
+		if existing.TenantID == team.TenantID && existing.Name == team.Name {
+			return fmt.Errorf("team %s already exists", team.Name)
+		}
+	}
+	team.ID = s.newID()
+	team.Members = []string{}
+	team.CreatedAt = time.Now()
+	s.teams[team.ID] = copyTeam(team)
+	return nil
+}
+
+func (s *Store) GetTeam(id string) (*services.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.teams[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyTeam(team), nil
+}
+
+func (s *Store) GetTeams(tenantID string) ([]*services.Team, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	teams := []*services.Team{}
+	for _, team := range s.teams {
+		if team.TenantID == tenantID {
+			teams = append(teams, copyTeam(team))
+		}
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+	return teams, nil
+}
+
+func (s *Store) AddTeamMember(teamID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.teams[teamID]
+	if !ok {
+		return fmt.Errorf("team %s does not exist", teamID)
+	}
+	for _, member := range team.Members {
+		if member == userID {
+			return nil
+		}
+	}
+	team.Members = append(team.Members, userID)
+	return nil
+}
+
+func (s *Store) RemoveTeamMember(teamID, userID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, ok := s.teams[teamID]
+	if !ok {
+		return false, nil
+	}
+	for i, member := range team.Members {
+		if member == userID {
+			team.Members = append(team.Members[:i], team.Members[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *Store) GetUserTeamIDs(userID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for _, team := range s.teams {
+		for _, member := range team.Members {
+			if member == userID {
+				ids = append(ids, team.ID)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *Store) UpdateDocumentTeam(id services.DocumentID, teamID *string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.documents[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	doc.TeamID = teamID
+	return nil
+}
+
+// Fraud pattern operations
+func (s *Store) CreateFraudPattern(pattern *services.FraudPattern) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pattern.ID = s.newID()
+	pattern.CreatedAt = time.Now()
+	pattern.UpdatedAt = pattern.CreatedAt
+	c := *pattern
+	s.patterns = append(s.patterns, &c)
+	return nil
+}
+
+func (s *Store) GetFraudPatterns() ([]*services.FraudPattern, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var patterns []*services.FraudPattern
+	for _, p := range s.patterns {
+		if p.IsActive {
+			c := *p
+			patterns = append(patterns, &c)
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].PatternName < patterns[j].PatternName })
+	return patterns, nil
+}
+
+func (s *Store) RecordCredentialRotation(rotation *services.CredentialRotation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotation.ID = s.newID()
+	rotation.CreatedAt = time.Now()
+	s.rotations = append(s.rotations, *rotation)
+	return nil
+}
+
+func (s *Store) GetCredentialRotations(limit int) ([]services.CredentialRotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotations := []services.CredentialRotation{}
+	for i := len(s.rotations) - 1; i >= 0 && len(rotations) < limit; i-- {
+		rotations = append(rotations, s.rotations[i])
+	}
+	return rotations, nil
+}
@@ -0,0 +1,86 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Submission and audit log operations
+func (s *Store) RecordSubmission(submission *services.Submission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	submission.CreatedAt = time.Now()
+	c := *submission
+	s.submissions = append(s.submissions, &c)
+
+	resourceID, address := string(submission.DocumentID), submission.IPAddress
+	s.auditLog = append(s.auditLog, &services.AuditLogEntry{
+		ID:           s.newID(),
+		UserID:       submission.UserID,
+		Action:       services.AuditActionDocumentSubmitted,
+		ResourceType: "document",
+		ResourceID:   &resourceID,
+		Details:      submission.AuditDetails(),
+		IPAddress:    &address,
+		CreatedAt:    submission.CreatedAt,
+	})
+	return nil
+}
+
+func (s *Store) GetSubmission(documentID services.DocumentID) (*services.Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if submission := s.submission(documentID); submission != nil {
+		c := *submission
+		return &c, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// submission returns the document's submission, or nil; s.mu must be held
+func (s *Store) submission(documentID services.DocumentID) *services.Submission {
+	for _, submission := range s.submissions {
+		if submission.DocumentID == documentID {
+			return submission
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetUserSubmissions(userID string, since time.Time) ([]*services.Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submissions := []*services.Submission{}
+	for _, submission := range s.submissions {
+		if submission.UserID != nil && *submission.UserID == userID && !submission.CreatedAt.Before(since) {
+			c := *submission
+			submissions = append(submissions, &c)
+		}
+	}
+	return submissions, nil
+}
+
+func (s *Store) GetAuditLog(filter services.AuditLogFilter) ([]*services.AuditLogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := func(want string, got *string) bool {
+		return want == "" || (got != nil && *got == want)
+	}
+	entries := []*services.AuditLogEntry{}
+	for i := len(s.auditLog) - 1; i >= 0 && len(entries) < filter.Limit; i-- {
+		entry := s.auditLog[i]
+		if (filter.Action != "" && entry.Action != filter.Action) ||
+			(filter.ResourceType != "" && entry.ResourceType != filter.ResourceType) ||
+			!matches(filter.ResourceID, entry.ResourceID) || !matches(filter.UserID, entry.UserID) ||
+			!matches(filter.IPAddress, entry.IPAddress) ||
+			(filter.Since != nil && entry.CreatedAt.Before(*filter.Since)) {
+			continue
+		}
+		c := *entry
+		entries = append(entries, &c)
+	}
+	return entries, nil
+}
@@ -0,0 +1,68 @@
+package servicesmock
+
+import (
+	"database/sql"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Velocity rule operations. Windows are summed from the counted documents
+// rather than from per-bucket counters.
+func (s *Store) CountVelocity(rule services.VelocityRule, count *services.VelocityCount) (*services.VelocityWindow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counted := false
+	for _, c := range s.velocity {
+		if c.DocumentID == count.DocumentID && c.Rule == count.Rule {
+			counted = true
+			break
+		}
+	}
+	if !counted {
+		c := *count
+		s.velocity = append(s.velocity, &c)
+	}
+
+	start := count.WindowStart(rule)
+	window := &services.VelocityWindow{Start: start, End: count.Bucket.Add(rule.BucketWidth())}
+	for _, c := range s.velocity {
+		if c.TenantID == count.TenantID && c.Rule == count.Rule && c.Group == count.Group &&
+			!c.Bucket.Before(start) && !c.Bucket.After(count.Bucket) {
+			window.Documents++
+			window.Amount += c.Amount
+		}
+	}
+	return window, nil
+}
+
+func (s *Store) UpdateTenantVelocityRules(id string, rules services.VelocityRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, tenant := range s.tenants {
+		if tenant.ID != id {
+			continue
+		}
+		stale := map[string]bool{}
+		for _, name := range services.StaleVelocityRules(tenant.VelocityRules, rules) {
+			stale[name] = true
+		}
+		kept := s.velocity[:0]
+		for _, c := range s.velocity {
+			if c.TenantID != id || !stale[c.Rule] {
+				kept = append(kept, c)
+			}
+		}
+		s.velocity = kept
+		tenant.VelocityRules = rules
+		tenant.UpdatedAt = time.Now()
+		return nil
+	}
+	return sql.ErrNoRows
+}
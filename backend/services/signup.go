@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Audit log actions of self-service signup: a tenant provisioned, and a
+// signup retried for a new welcome key
+const (
+	AuditActionTenantSignedUp    = "tenant.signed_up"
+	AuditActionTenantSignupRetry = "tenant.signup_retried"
+)
+
+// Errors of SignUpTenant and ReplaceWelcomeAPIKey
+var (
+	ErrTenantExists = errors.New("tenant already exists")
+	ErrEmailTaken   = errors.New("email is already in use")
+)
+
+// TenantSignup is what signing up a tenant provisioned
+type TenantSignup struct {
+	Tenant *Tenant
+	Admin  *User
+	APIKey *APIKey
+}
+
+// SignUpTenant provisions a tenant in one transaction: the tenant, with its
+// own copy of the default risk taxonomy unless it brings one, its first
+// admin and its welcome API key, stored under keyDigest. The signup is
+// added to the audit log. It returns ErrTenantExists when the slug is
+// taken and ErrEmailTaken when the admin's email is.
+func (d *DatabaseService) SignUpTenant(tenant *Tenant, admin *User, keyDigest string, ipAddress *string) (*TenantSignup, error) {
+	if tenant.RiskTaxonomy == nil {
+		tenant.RiskTaxonomy = DefaultRiskTaxonomy()
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM tenants WHERE slug = $1)`, tenant.Slug).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrTenantExists
+	}
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, admin.Email).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrEmailTaken
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO tenants (slug, name, risk_taxonomy, storage_region, language, time_zone)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`,
+		tenant.Slug, tenant.Name, tenant.RiskTaxonomy, tenant.StorageRegion, tenant.Language, tenant.TimeZone,
+	).Scan(&tenant.ID, &tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tenant %s: %v", tenant.Slug, err)
+	}
+
+	admin.TenantID = &tenant.ID
+	admin.Role = RoleAdmin
+	err = tx.QueryRow(`
+		INSERT INTO users (tenant_id, email, password_hash, first_name, last_name, role)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`,
+		admin.TenantID, admin.Email, admin.PasswordHash, admin.FirstName, admin.LastName, admin.Role,
+	).Scan(&admin.ID, &admin.CreatedAt, &admin.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin %s: %v", admin.Email, err)
+	}
+
+	key := &APIKey{TenantID: tenant.ID, Name: WelcomeAPIKeyName}
+	if err := createAPIKey(tx, key, keyDigest); err != nil {
+		return nil, err
+	}
+
+	details := Metadata{
+		"slug":           tenant.Slug,
+		"admin_id":       admin.ID,
+		"admin_email":    admin.Email,
+		"api_key_id":     key.ID,
+		"storage_region": tenant.StorageRegion,
+	}
+	if err := auditSignup(tx, tenant, admin, AuditActionTenantSignedUp, details, ipAddress); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &TenantSignup{Tenant: tenant, Admin: admin, APIKey: key}, nil
+}
+
+// ReplaceWelcomeAPIKey revokes the tenant's welcome key and gives it a new
+// one, stored under keyDigest, for a client retrying a signup whose
+// response it lost. It returns ErrTenantExists once any of the tenant's
+// keys has been used, since the signup then clearly went through.
+func (d *DatabaseService) ReplaceWelcomeAPIKey(tenant *Tenant, admin *User, keyDigest string, ipAddress *string) (*APIKey, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var used bool
+	err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_keys WHERE tenant_id = $1 AND last_used_at IS NOT NULL)`, tenant.ID).Scan(&used)
+	if err != nil {
+		return nil, err
+	}
+	if used {
+		return nil, ErrTenantExists
+	}
+	_, err = tx.Exec(`UPDATE api_keys SET revoked_at = $3 WHERE tenant_id = $1 AND name = $2 AND revoked_at IS NULL`,
+		tenant.ID, WelcomeAPIKeyName, d.db.dialect.timeArg(time.Now()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke welcome key: %v", err)
+	}
+	key := &APIKey{TenantID: tenant.ID, Name: WelcomeAPIKeyName}
+	if err := createAPIKey(tx, key, keyDigest); err != nil {
+		return nil, err
+	}
+
+	details := Metadata{"slug": tenant.Slug, "admin_id": admin.ID, "api_key_id": key.ID}
+	if err := auditSignup(tx, tenant, admin, AuditActionTenantSignupRetry, details, ipAddress); err != nil {
+		return nil, err
+	}
+	return key, tx.Commit()
+}
+
+func auditSignup(q execer, tenant *Tenant, admin *User, action string, details Metadata, ipAddress *string) error {
+	_, err := q.Exec(`
+		INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address)
+		VALUES ($1, $2, 'tenant', $3, $4, $5)`,
+		admin.ID, action, tenant.ID, details, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit signup of tenant %s: %v", tenant.Slug, err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxSLADays bounds the days an SLA clock walks through, ten years of them
+const maxSLADays = 3660
+
+// SLAClock measures how long alerts wait, both for escalation chains and
+// for the SLA report. With a Calendar only its business hours in Location
+// count, so a clock started on Friday evening runs from Monday morning;
+// without one every hour counts.
+type SLAClock struct {
+	Calendar *HolidayCalendar
+	Location *time.Location
+}
+
+// BusinessHours reports whether the clock only counts business hours
+func (c SLAClock) BusinessHours() bool {
+	return c.Calendar != nil
+}
+
+// Add returns the moment the clock has run d after start
+func (c SLAClock) Add(start time.Time, d time.Duration) time.Time {
+	if c.Calendar == nil {
+		return start.Add(d)
+	}
+	loc := c.location()
+	t := start.In(loc)
+	for i := 0; i < maxSLADays; i++ {
+		opens, closes, ok := c.Calendar.businessHoursOn(t, loc)
+		if ok && t.Before(closes) {
+			if t.Before(opens) {
+				t = opens
+			}
+			left := closes.Sub(t)
+			if d <= left {
+				return t.Add(d)
+			}
+			d -= left
+		}
+		t = nextDay(t, loc)
+	}
+	// A calendar of holidays without end never gets there
+	return t
+}
+
+// Elapsed returns how long the clock ran from start to end
+func (c SLAClock) Elapsed(start, end time.Time) time.Duration {
+	if !end.After(start) {
+		return 0
+	}
+	if c.Calendar == nil {
+		return end.Sub(start)
+	}
+	loc := c.location()
+	var elapsed time.Duration
+	t := start.In(loc)
+	for i := 0; i < maxSLADays && t.Before(end); i++ {
+		if opens, closes, ok := c.Calendar.businessHoursOn(t, loc); ok {
+			from, to := opens, closes
+			if t.After(from) {
+				from = t
+			}
+			if end.Before(to) {
+				to = end
+			}
+			if to.After(from) {
+				elapsed += to.Sub(from)
+			}
+		}
+		t = nextDay(t, loc)
+	}
+	return elapsed
+}
+
+func (c SLAClock) location() *time.Location {
+	if c.Location == nil {
+		return time.UTC
+	}
+	return c.Location
+}
+
+// nextDay returns midnight in loc after the day t falls on there
+func nextDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// AlertSLARecord is when an alert was raised and acknowledged
+type AlertSLARecord struct {
+	Severity        string
+	EscalationLevel int
+	CreatedAt       time.Time
+	AcknowledgedAt  *time.Time
+}
+
+// SLADurations summarizes how long alerts waited, in hours by the clock of
+// the report
+type SLADurations struct {
+	Alerts    int      `json:"alerts"`
+	MeanHours *float64 `json:"mean_hours"`
+	P50Hours  *float64 `json:"p50_hours"`
+	P95Hours  *float64 `json:"p95_hours"`
+	MaxHours  *float64 `json:"max_hours"`
+}
+
+// AlertSLAReport measures how quickly a tenant's alerts raised since Since
+// were acknowledged, and how long those still open have waited, by the
+// tenant's SLA clock: business hours of its holiday calendar in its time
+// zone, or wall-clock hours. Escalated counts the alerts that went up their
+// escalation chain.
+type AlertSLAReport struct {
+	Since             time.Time                `json:"since"`
+	TimeZone          string                   `json:"time_zone"`
+	HolidayCalendar   *string                  `json:"holiday_calendar"`
+	BusinessHours     bool                     `json:"business_hours"`
+	Alerts            int                      `json:"alerts"`
+	Escalated         int                      `json:"escalated"`
+	TimeToAcknowledge *SLADurations            `json:"time_to_acknowledge"`
+	BySeverity        map[string]*SLADurations `json:"time_to_acknowledge_by_severity"`
+	OpenAge           *SLADurations            `json:"open_age"`
+}
+
+// NewAlertSLAReport measures the alerts with clock, the open ones up to now
+func NewAlertSLAReport(records []*AlertSLARecord, clock SLAClock, since, now time.Time) *AlertSLAReport {
+	report := &AlertSLAReport{
+		Since:         since,
+		TimeZone:      clock.location().String(),
+		BusinessHours: clock.BusinessHours(),
+		Alerts:        len(records),
+		BySeverity:    map[string]*SLADurations{},
+	}
+	if clock.Calendar != nil {
+		report.HolidayCalendar = &clock.Calendar.Code
+	}
+
+	var acknowledged, open []float64
+	severities := map[string][]float64{}
+	for _, record := range records {
+		if record.EscalationLevel > 0 {
+			report.Escalated++
+		}
+		if record.AcknowledgedAt == nil {
+			open = append(open, clock.Elapsed(record.CreatedAt, now).Hours())
+			continue
+		}
+		hours := clock.Elapsed(record.CreatedAt, *record.AcknowledgedAt).Hours()
+		acknowledged = append(acknowledged, hours)
+		severities[record.Severity] = append(severities[record.Severity], hours)
+	}
+
+	report.TimeToAcknowledge = summarizeSLA(acknowledged)
+	report.OpenAge = summarizeSLA(open)
+	for severity, hours := range severities {
+		report.BySeverity[severity] = summarizeSLA(hours)
+	}
+	return report
+}
+
+func summarizeSLA(hours []float64) *SLADurations {
+	durations := &SLADurations{Alerts: len(hours)}
+	if len(hours) == 0 {
+		return durations
+	}
+	sort.Float64s(hours)
+	var sum float64
+	for _, h := range hours {
+		sum += h
+	}
+	mean, p50, p95, longest := sum/float64(len(hours)), percentile(hours, 0.5), percentile(hours, 0.95), hours[len(hours)-1]
+	durations.MeanHours, durations.P50Hours, durations.P95Hours, durations.MaxHours = &mean, &p50, &p95, &longest
+	return durations
+}
+
+// GetAlertSLARecords returns when the tenant's alerts raised since since
+// were raised and acknowledged, oldest first
+func (d *DatabaseService) GetAlertSLARecords(tenantID string, since time.Time) ([]*AlertSLARecord, error) {
+	rows, err := d.db.Query(`
+		SELECT severity, escalation_level, created_at, acknowledged_at
+		FROM alerts WHERE tenant_id = $1 AND created_at >= $2
+		ORDER BY created_at`, tenantID, d.db.dialect.timeArg(since.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alert SLA records: %v", err)
+	}
+	defer rows.Close()
+
+	records := []*AlertSLARecord{}
+	for rows.Next() {
+		record := &AlertSLARecord{}
+		if err := rows.Scan(&record.Severity, &record.EscalationLevel, &record.CreatedAt, &record.AcknowledgedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrSnapshotConflict is returned when a snapshot cannot be imported because
+// its tenants already exist or it was taken from another schema
+var ErrSnapshotConflict = errors.New("snapshot conflicts with this database")
+
+// SnapshotRow is one table row keyed by column name. Timestamps are
+// time.Time values.
+type SnapshotRow map[string]interface{}
+
+// SnapshotWriter receives the rows of a snapshot, one table after another in
+// SnapshotTables order
+type SnapshotWriter interface {
+	WriteRow(table string, row SnapshotRow) error
+}
+
+// SnapshotReader replays the rows of one table of a snapshot
+type SnapshotReader interface {
+	ReadRows(table string, fn func(SnapshotRow) error) error
+}
+
+// SnapshotInfo identifies the database a snapshot was taken from. Snapshots
+// are only imported into a database of the same dialect and schema version.
+type SnapshotInfo struct {
+	Dialect       string `json:"dialect"`
+	SchemaVersion string `json:"schema_version"`
+}
+
+// snapshotTable selects the rows of one tenant-owned table. $TENANTS is
+// replaced by the placeholders of the exported tenant IDs.
+type snapshotTable struct {
+	name  string
+	where string
+}
+
+// snapshotTables are listed parents first, so that importing them in order
+// satisfies foreign keys. Fraud patterns are shared by all tenants and are
+// exported whole because detections reference them.
+var snapshotTables = []snapshotTable{
+	{"tenants", `id IN ($TENANTS)`},
+	{"users", `tenant_id IN ($TENANTS)`},
+	{"teams", `tenant_id IN ($TENANTS)`},
+	{"team_members", `team_id IN (SELECT id FROM teams WHERE tenant_id IN ($TENANTS))`},
+	{"review_delegations", `delegator_id IN (SELECT id FROM users WHERE tenant_id IN ($TENANTS))`},
+	{"fraud_patterns", `1 = 1`},
+	{"documents", `tenant_id IN ($TENANTS)`},
+	{"document_fraud_detections", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"document_entities", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"document_pages", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"document_embeddings", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"document_analyses", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"document_submissions", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"velocity_events", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"velocity_counters", `tenant_id IN ($TENANTS)`},
+	{"document_amounts", `document_id IN (SELECT id FROM documents WHERE tenant_id IN ($TENANTS))`},
+	{"accounts", `tenant_id IN ($TENANTS)`},
+	{"account_statements", `account_id IN (SELECT id FROM accounts WHERE tenant_id IN ($TENANTS))`},
+	{"account_segments", `account_id IN (SELECT id FROM accounts WHERE tenant_id IN ($TENANTS))`},
+	{"account_documents", `account_id IN (SELECT id FROM accounts WHERE tenant_id IN ($TENANTS))`},
+	{"question_sets", `tenant_id IN ($TENANTS)`},
+	{"fraud_qa_analyses", `tenant_id IN ($TENANTS)`},
+	{"fraud_exemplars", `tenant_id IN ($TENANTS)`},
+	{"alerts", `tenant_id IN ($TENANTS)`},
+	{"approvals", `tenant_id IN ($TENANTS)`},
+	{"sar_drafts", `tenant_id IN ($TENANTS)`},
+	{"case_evidence", `tenant_id IN ($TENANTS)`},
+	{"auditor_grants", `tenant_id IN ($TENANTS)`},
+	{"api_keys", `tenant_id IN ($TENANTS)`},
+	{"legal_holds", `tenant_id IN ($TENANTS)`},
+	{"privacy_requests", `tenant_id IN ($TENANTS)`},
+}
+
+// SnapshotTables lists the tables a snapshot holds, in import order
+func SnapshotTables() []string {
+	names := make([]string, len(snapshotTables))
+	for i, table := range snapshotTables {
+		names[i] = table.name
+	}
+	return names
+}
+
+var snapshotColumn = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+func (d *DatabaseService) snapshotInfo(q rowQuerier) (*SnapshotInfo, error) {
+	info := &SnapshotInfo{Dialect: string(d.db.dialect)}
+	if err := q.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&info.SchemaVersion); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %v", err)
+	}
+	return info, nil
+}
+
+// ExportTenants writes every row belonging to the tenants with the given
+// slugs to w. All tables are read in one transaction so the snapshot is
+// consistent even while documents are being uploaded.
+func (d *DatabaseService) ExportTenants(slugs []string, w SnapshotWriter) (*SnapshotInfo, error) {
+	tx, err := d.db.beginSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start snapshot: %v", err)
+	}
+	defer tx.Rollback()
+
+	info, err := d.snapshotInfo(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenantIDs []interface{}
+	for _, slug := range slugs {
+		var id string
+		err := tx.QueryRow(`SELECT id FROM tenants WHERE slug = $1`, slug).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("tenant %s not found", slug)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up tenant %s: %v", slug, err)
+		}
+		tenantIDs = append(tenantIDs, id)
+	}
+	if len(tenantIDs) == 0 {
+		return nil, errors.New("no tenants to export")
+	}
+	placeholders := make([]string, len(tenantIDs))
+	for i := range tenantIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+
+	for _, table := range snapshotTables {
+		if table.name == "document_embeddings" && !d.vectors {
+			continue
+		}
+		where := strings.ReplaceAll(table.where, "$TENANTS", strings.Join(placeholders, ", "))
+		args := tenantIDs
+		if !strings.Contains(table.where, "$TENANTS") {
+			args = nil
+		}
+		if err := exportTable(tx, table.name, where, args, w); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func exportTable(tx *tx, table, where string, args []interface{}, w SnapshotWriter) error {
+	rows, err := tx.Query(`SELECT * FROM `+table+` WHERE `+where, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to export %s: %v", table, err)
+		}
+		row := SnapshotRow{}
+		for i, column := range columns {
+			// Postgres returns UUID, JSONB and NUMERIC values as text bytes
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		if err := w.WriteRow(table, row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ImportSnapshot inserts the rows of a snapshot taken with ExportTenants, in
+// one transaction, and returns the number of rows inserted per table. It
+// fails with ErrSnapshotConflict if one of the snapshot's tenants exists.
+// Fraud patterns that already exist, by ID or by type and name, are reused.
+func (d *DatabaseService) ImportSnapshot(info SnapshotInfo, r SnapshotReader) (map[string]int, error) {
+	current, err := d.snapshotInfo(d.db)
+	if err != nil {
+		return nil, err
+	}
+	if *current != info {
+		return nil, fmt.Errorf("%w: snapshot is from %s schema %s, this database is %s schema %s",
+			ErrSnapshotConflict, info.Dialect, info.SchemaVersion, current.Dialect, current.SchemaVersion)
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	counts := map[string]int{}
+	// Pattern IDs in the snapshot mapped to the matching pattern here
+	patternIDs := map[string]interface{}{}
+	for _, table := range snapshotTables {
+		if table.name == "document_embeddings" && !d.vectors {
+			log.Println("Skipping document embeddings in snapshot; semantic search is disabled")
+			continue
+		}
+		err := r.ReadRows(table.name, func(row SnapshotRow) error {
+			switch table.name {
+			case "tenants":
+				var exists bool
+				err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM tenants WHERE id = $1 OR slug = $2)`, row["id"], row["slug"]).Scan(&exists)
+				if err != nil {
+					return err
+				}
+				if exists {
+					return fmt.Errorf("%w: tenant %v already exists", ErrSnapshotConflict, row["slug"])
+				}
+			case "fraud_patterns":
+				var id string
+				err := tx.QueryRow(`
+					SELECT id FROM fraud_patterns WHERE id = $1 OR (pattern_type = $2 AND pattern_name = $3)
+					ORDER BY CASE WHEN id = $1 THEN 0 ELSE 1 END LIMIT 1`,
+					row["id"], row["pattern_type"], row["pattern_name"]).Scan(&id)
+				if err == nil {
+					patternIDs[fmt.Sprint(row["id"])] = id
+					return nil
+				}
+				if !errors.Is(err, sql.ErrNoRows) {
+					return err
+				}
+			case "document_fraud_detections":
+				if id, ok := patternIDs[fmt.Sprint(row["fraud_pattern_id"])]; ok {
+					row["fraud_pattern_id"] = id
+				}
+			}
+			counts[table.name]++
+			return d.insertSnapshotRow(tx, table.name, row)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (d *DatabaseService) insertSnapshotRow(tx *tx, table string, row SnapshotRow) error {
+	columns := make([]string, 0, len(row))
+	placeholders := make([]string, 0, len(row))
+	args := make([]interface{}, 0, len(row))
+	for column, value := range row {
+		if !snapshotColumn.MatchString(column) {
+			return fmt.Errorf("invalid column name %q in %s", column, table)
+		}
+		if t, ok := value.(time.Time); ok {
+			value = d.db.dialect.timeArg(t)
+		}
+		columns = append(columns, column)
+		args = append(args, value)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+	query := `INSERT INTO ` + table + ` (` + strings.Join(columns, ", ") + `) VALUES (` + strings.Join(placeholders, ", ") + `)`
+	if _, err := tx.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to restore %s row: %v", table, err)
+	}
+	return nil
+}
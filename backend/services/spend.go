@@ -0,0 +1,109 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SpendReport sums the amounts of a tenant's documents uploaded on or after
+// Since in its base currency: by upload day in TimeZone, by the currency
+// they were submitted in, and by risk level, so spend on risky documents
+// stands out. Unconverted counts the documents whose amount could not be
+// converted, or was converted into a previous base currency; they are left
+// out of the sums.
+type SpendReport struct {
+	Since        time.Time          `json:"since"`
+	TimeZone     string             `json:"time_zone"`
+	BaseCurrency string             `json:"base_currency"`
+	Documents    int64              `json:"documents"`
+	Total        float64            `json:"total"`
+	Unconverted  int64              `json:"unconverted"`
+	ByCurrency   []*CurrencySpend   `json:"by_currency"`
+	ByRiskLevel  map[string]float64 `json:"by_risk_level"`
+	ByDay        []*DailySpend      `json:"by_day"`
+}
+
+// CurrencySpend is the spend submitted in one currency, in that currency
+// and in the base currency
+type CurrencySpend struct {
+	Currency   string  `json:"currency"`
+	Documents  int64   `json:"documents"`
+	Amount     float64 `json:"amount"`
+	BaseAmount float64 `json:"base_amount"`
+}
+
+// DailySpend is the spend, in the base currency, of the documents uploaded
+// on Day (YYYY-MM-DD)
+type DailySpend struct {
+	Day       string  `json:"day"`
+	Documents int64   `json:"documents"`
+	Amount    float64 `json:"amount"`
+}
+
+// GetSpendReport sums the amount field of the tenant's documents uploaded
+// since since, as converted into baseCurrency, with days taken in loc
+func (d *DatabaseService) GetSpendReport(tenantID, baseCurrency string, since time.Time, loc *time.Location) (*SpendReport, error) {
+	rows, err := d.db.Query(`
+		SELECT `+d.db.dialect.utcQuarterHour("d.created_at")+` AS slot, a.currency, COALESCE(d.fraud_risk_level, '') AS risk_level,
+		       COUNT(*), SUM(a.amount),
+		       COALESCE(SUM(CASE WHEN a.base_currency = $2 THEN a.base_amount END), 0),
+		       SUM(CASE WHEN a.base_currency = $2 AND a.base_amount IS NOT NULL THEN 0 ELSE 1 END)
+		FROM document_amounts a
+		JOIN documents d ON d.id = a.document_id
+		WHERE d.tenant_id = $1 AND a.field = $3 AND d.created_at >= $4 AND d.deleted_at IS NULL
+		GROUP BY slot, a.currency, risk_level`,
+		tenantID, baseCurrency, defaultAmountField, d.db.dialect.timeArg(since.UTC()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum document amounts: %v", err)
+	}
+	defer rows.Close()
+
+	report := &SpendReport{
+		Since:        since,
+		TimeZone:     loc.String(),
+		BaseCurrency: baseCurrency,
+		ByCurrency:   []*CurrencySpend{},
+		ByRiskLevel:  map[string]float64{},
+		ByDay:        []*DailySpend{},
+	}
+	currencies := map[string]*CurrencySpend{}
+	days := map[string]*DailySpend{}
+	for rows.Next() {
+		var slot, currency, riskLevel string
+		var documents, unconverted int64
+		var amount, baseAmount float64
+		if err := rows.Scan(&slot, &currency, &riskLevel, &documents, &amount, &baseAmount, &unconverted); err != nil {
+			return nil, err
+		}
+		day, err := periodOf(slot, loc, StatsIntervalDay)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Documents += documents
+		report.Total += baseAmount
+		report.Unconverted += unconverted
+		report.ByRiskLevel[riskLevel] += baseAmount
+		if currencies[currency] == nil {
+			currencies[currency] = &CurrencySpend{Currency: currency}
+			report.ByCurrency = append(report.ByCurrency, currencies[currency])
+		}
+		currencies[currency].Documents += documents
+		currencies[currency].Amount += amount
+		currencies[currency].BaseAmount += baseAmount
+		if days[day] == nil {
+			days[day] = &DailySpend{Day: day}
+			report.ByDay = append(report.ByDay, days[day])
+		}
+		days[day].Documents += documents
+		days[day].Amount += baseAmount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.ByCurrency, func(i, j int) bool { return report.ByCurrency[i].BaseAmount > report.ByCurrency[j].BaseAmount })
+	sort.Slice(report.ByDay, func(i, j int) bool { return report.ByDay[i].Day < report.ByDay[j].Day })
+	return report, nil
+}
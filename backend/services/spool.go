@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/metrics"
+)
+
+// MemoryBudget bounds the payload bytes held in memory across the process.
+// Reservations never wait: one that does not fit is refused, and the caller
+// writes its payload to disk instead.
+type MemoryBudget struct {
+	limit int64
+	mu    sync.Mutex
+	used  int64
+}
+
+// NewMemoryBudget returns a budget of limit bytes; zero means no limit
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	return &MemoryBudget{limit: limit}
+}
+
+// Reserve takes n bytes from the budget and reports whether it could. The
+// bytes are counted against the MemoryTracker of ctx, if any, until they are
+// released.
+func (b *MemoryBudget) Reserve(ctx context.Context, n int64) bool {
+	if n <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	if b.limit > 0 && b.used+n > b.limit {
+		b.mu.Unlock()
+		return false
+	}
+	b.used += n
+	metrics.PayloadMemoryBytes.Set(float64(b.used))
+	b.mu.Unlock()
+
+	if tracker := MemoryTrackerFrom(ctx); tracker != nil {
+		tracker.add(n)
+	}
+	return true
+}
+
+// Release returns n reserved bytes to the budget
+func (b *MemoryBudget) Release(ctx context.Context, n int64) {
+	if n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	metrics.PayloadMemoryBytes.Set(float64(b.used))
+	b.mu.Unlock()
+
+	if tracker := MemoryTrackerFrom(ctx); tracker != nil {
+		tracker.add(-n)
+	}
+}
+
+// Used is the number of bytes reserved
+func (b *MemoryBudget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// MemoryTracker follows the payload bytes one request or pipeline run holds
+// in memory, for the peak to be reported when it ends. It is carried by the
+// context; reservations made without one are not tracked.
+type MemoryTracker struct {
+	current atomic.Int64
+	peak    atomic.Int64
+}
+
+type memoryTrackerKey struct{}
+
+// WithMemoryTracker returns a context whose reservations are tracked by a
+// new MemoryTracker
+func WithMemoryTracker(ctx context.Context) (context.Context, *MemoryTracker) {
+	tracker := &MemoryTracker{}
+	return context.WithValue(ctx, memoryTrackerKey{}, tracker), tracker
+}
+
+// MemoryTrackerFrom returns the MemoryTracker of ctx, or nil
+func MemoryTrackerFrom(ctx context.Context) *MemoryTracker {
+	tracker, _ := ctx.Value(memoryTrackerKey{}).(*MemoryTracker)
+	return tracker
+}
+
+func (t *MemoryTracker) add(n int64) {
+	current := t.current.Add(n)
+	for {
+		peak := t.peak.Load()
+		if current <= peak || t.peak.CompareAndSwap(peak, current) {
+			return
+		}
+	}
+}
+
+// Peak is the most bytes held at once
+func (t *MemoryTracker) Peak() int64 {
+	return t.peak.Load()
+}
+
+// Spooler copies payloads that need to be read more than once, or out of
+// order, keeping small ones in memory within its budget and writing the
+// others to temporary files
+type Spooler struct {
+	budget     *MemoryBudget
+	spillBytes int64
+}
+
+func NewSpooler(cfg config.PayloadConfig) *Spooler {
+	return &Spooler{budget: NewMemoryBudget(cfg.MemoryBudget), spillBytes: cfg.SpillBytes}
+}
+
+// Budget is the memory budget of the payloads held by the spooler, which
+// other holders of payloads reserve from as well
+func (s *Spooler) Budget() *MemoryBudget {
+	return s.budget
+}
+
+// SpillBytes is the largest payload kept in memory
+func (s *Spooler) SpillBytes() int64 {
+	return s.spillBytes
+}
+
+// Spool reads r to the end into a SpooledFile, which the caller must close.
+// The payload is kept in memory when it is at most SpillBytes long and the
+// budget has room for it, and written to a temporary file otherwise.
+func (s *Spooler) Spool(ctx context.Context, r io.Reader) (*SpooledFile, error) {
+	reserved := s.spillBytes
+	if !s.budget.Reserve(ctx, reserved) {
+		metrics.PayloadSpills.WithLabelValues("budget").Inc()
+		return s.spill(ctx, nil, r)
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(io.LimitReader(r, s.spillBytes+1)); err != nil {
+		s.budget.Release(ctx, reserved)
+		return nil, err
+	}
+	if int64(buf.Len()) > s.spillBytes {
+		s.budget.Release(ctx, reserved)
+		metrics.PayloadSpills.WithLabelValues("size").Inc()
+		return s.spill(ctx, buf.Bytes(), r)
+	}
+
+	// Keep only what the payload takes of the reservation
+	size := int64(buf.Len())
+	s.budget.Release(ctx, reserved-size)
+	return &SpooledFile{
+		data: buf.Bytes(),
+		size: size,
+		release: func() {
+			s.budget.Release(ctx, size)
+		},
+	}, nil
+}
+
+// spill writes head, then the rest of r, to a temporary file
+func (s *Spooler) spill(ctx context.Context, head []byte, r io.Reader) (*SpooledFile, error) {
+	file, err := os.CreateTemp("", "frauddocai-payload-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temporary file: %v", err)
+	}
+	spooled := &SpooledFile{file: file}
+	n, err := file.Write(head)
+	if err == nil {
+		var rest int64
+		rest, err = io.Copy(file, r)
+		spooled.size = int64(n) + rest
+	}
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		spooled.Close()
+		return nil, err
+	}
+	return spooled, nil
+}
+
+// SpooledFile is a payload copied by a Spooler, in memory or in a temporary
+// file. It can be read at any offset and any number of times until it is
+// closed.
+type SpooledFile struct {
+	data    []byte
+	file    *os.File
+	size    int64
+	release func()
+	once    sync.Once
+}
+
+// Size is the length of the payload
+func (f *SpooledFile) Size() int64 {
+	return f.size
+}
+
+// OnDisk reports whether the payload was written to a temporary file
+func (f *SpooledFile) OnDisk() bool {
+	return f.file != nil
+}
+
+func (f *SpooledFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.file != nil {
+		return f.file.ReadAt(p, off)
+	}
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+// Reader returns a reader of the payload from its start
+func (f *SpooledFile) Reader() *io.SectionReader {
+	return io.NewSectionReader(f, 0, f.size)
+}
+
+// Close removes the temporary file, or returns the memory to the budget
+func (f *SpooledFile) Close() error {
+	var err error
+	f.once.Do(func() {
+		if f.file != nil {
+			err = f.file.Close()
+			if removeErr := os.Remove(f.file.Name()); err == nil {
+				err = removeErr
+			}
+		}
+		f.data = nil
+		if f.release != nil {
+			f.release()
+		}
+	})
+	return err
+}
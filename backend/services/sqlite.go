@@ -0,0 +1,66 @@
+package services
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+
+	"frauddocai-backend/config"
+	"frauddocai-backend/logging"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite has no equivalent of database/init.sql, so its first migration
+// creates the full schema
+//
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// newSQLiteDatabaseService opens a SQLite database for local development and
+// tests. It needs no running infrastructure; use DB_SQLITE_PATH=:memory: for a
+// throwaway database.
+func newSQLiteDatabaseService(cfg config.DatabaseConfig) (*DatabaseService, error) {
+	dsn := cfg.SQLitePath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+
+	// A single connection avoids "database is locked" errors and keeps an
+	// in-memory database alive for the life of the process
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping database: %v", err)
+	}
+	logging.DB.Infof("SQLite database opened at %s", cfg.SQLitePath)
+
+	c := newConn(db, dialectSQLite)
+	if err := runMigrations(c, sqliteMigrations, "migrations/sqlite"); err != nil {
+		return nil, err
+	}
+
+	d := &DatabaseService{db: c}
+	d.detectVectorSupport()
+	return d, nil
+}
+
+// sqliteMetadataCondition is the SQLite counterpart of the JSONB containment
+// filter. json_extract returns typed SQL values, so numeric-looking query
+// values are compared both as text and as numbers.
+func sqliteMetadataCondition(filter MetadataFilter, args *[]interface{}) string {
+	*args = append(*args, "$."+filter.Key, filter.Value)
+	path, value := len(*args)-1, len(*args)
+	condition := fmt.Sprintf("(json_extract(metadata, $%d) = $%d", path, value)
+
+	switch filter.Value {
+	case "true":
+		condition += fmt.Sprintf(" OR json_extract(metadata, $%d) = 1", path)
+	case "false":
+		condition += fmt.Sprintf(" OR json_extract(metadata, $%d) = 0", path)
+	default:
+		condition += fmt.Sprintf(" OR (json_type(metadata, $%d) IN ('integer', 'real') AND json_extract(metadata, $%d) = CAST($%d AS REAL))", path, path, value)
+	}
+	return condition + ")"
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// StoredObject describes an object found when listing a bucket
+type StoredObject struct {
+	Name         string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// ObjectStorage stores the original uploaded files. MinIOService is the
+// production implementation.
+type ObjectStorage interface {
+	UploadFile(ctx context.Context, objectName string, reader io.Reader, size int64, contentType string) error
+	GetFile(ctx context.Context, objectName string) (io.ReadCloser, error)
+	DeleteFile(ctx context.Context, objectName string) error
+	GetFileURL(objectName string) string
+	// ListFiles calls fn for every stored object until fn returns an error
+	ListFiles(ctx context.Context, fn func(StoredObject) error) error
+}
+
+var _ ObjectStorage = (*MinIOService)(nil)
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"frauddocai-backend/config"
+)
+
+var (
+	ErrUnknownStorageRegion = errors.New("unknown storage region")
+	ErrNoArchiveTier        = errors.New("no archive tier configured")
+)
+
+// RegionalStorage holds one object store per data residency region. Files of
+// a tenant pinned to a region are uploaded to that region's store; other
+// files go to the default region. Each region may also have an archive store
+// that old documents are moved to.
+type RegionalStorage struct {
+	defaultRegion string
+	stores        map[string]ObjectStorage
+	archives      map[string]ObjectStorage
+}
+
+// NewRegionalStorage connects to the default store and to the store of each
+// configured region, and to their archive buckets when archival is enabled.
+// Access keys may be secret references resolved through secrets.
+func NewRegionalStorage(cfg config.StorageConfig, secrets *Secrets) (*RegionalStorage, error) {
+	primary, err := NewMinIOService(cfg.Default, secrets)
+	if err != nil {
+		return nil, err
+	}
+	s := NewSingleRegionStorage(cfg.DefaultRegion, primary)
+	if err := s.connectArchive(cfg.DefaultRegion, cfg.Default, cfg.ArchiveBucket, secrets); err != nil {
+		return nil, err
+	}
+	for region, minioConfig := range cfg.Regions {
+		if region == cfg.DefaultRegion {
+			return nil, fmt.Errorf("storage region %s is already the default region", region)
+		}
+		if minioConfig.Endpoint == "" {
+			return nil, fmt.Errorf("storage region %s has no endpoint", region)
+		}
+		store, err := NewMinIOService(minioConfig, secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to storage region %s: %v", region, err)
+		}
+		s.Add(region, store)
+		if err := s.connectArchive(region, minioConfig, cfg.ArchiveBucket, secrets); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *RegionalStorage) connectArchive(region string, cfg config.MinIOConfig, bucket string, secrets *Secrets) error {
+	if bucket == "" {
+		return nil
+	}
+	cfg.BucketName = bucket
+	archive, err := NewMinIOService(cfg, secrets)
+	if err != nil {
+		return fmt.Errorf("failed to connect to archive bucket of storage region %s: %v", region, err)
+	}
+	s.AddArchive(region, archive)
+	return nil
+}
+
+// NewSingleRegionStorage keeps every file in storage
+func NewSingleRegionStorage(region string, storage ObjectStorage) *RegionalStorage {
+	return &RegionalStorage{
+		defaultRegion: region,
+		stores:        map[string]ObjectStorage{region: storage},
+		archives:      map[string]ObjectStorage{},
+	}
+}
+
+// Add registers the store of another region
+func (s *RegionalStorage) Add(region string, storage ObjectStorage) {
+	s.stores[region] = storage
+}
+
+// AddArchive registers the archive store of a region
+func (s *RegionalStorage) AddArchive(region string, storage ObjectStorage) {
+	s.archives[region] = storage
+}
+
+// HasArchive reports whether any region has an archive store
+func (s *RegionalStorage) HasArchive() bool {
+	return len(s.archives) > 0
+}
+
+// DefaultRegion is the region of tenants that are not pinned to one
+func (s *RegionalStorage) DefaultRegion() string {
+	return s.defaultRegion
+}
+
+// Default is the store of the default region
+func (s *RegionalStorage) Default() ObjectStorage {
+	return s.stores[s.defaultRegion]
+}
+
+// Regions lists the configured region names
+func (s *RegionalStorage) Regions() []string {
+	regions := make([]string, 0, len(s.stores))
+	for region := range s.stores {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// ForRegion returns the store of region; "" is the default region
+func (s *RegionalStorage) ForRegion(region string) (ObjectStorage, error) {
+	if region == "" {
+		region = s.defaultRegion
+	}
+	store, ok := s.stores[region]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownStorageRegion, region)
+	}
+	return store, nil
+}
+
+// ForTier returns the store holding files of the region in the given storage
+// tier. Restoring files are read from the archive until the copy completes.
+func (s *RegionalStorage) ForTier(region, tier string) (ObjectStorage, error) {
+	if tier == "" || tier == StorageTierHot {
+		return s.ForRegion(region)
+	}
+	if region == "" {
+		region = s.defaultRegion
+	}
+	if _, ok := s.stores[region]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownStorageRegion, region)
+	}
+	archive, ok := s.archives[region]
+	if !ok {
+		return nil, fmt.Errorf("%w for storage region %q", ErrNoArchiveTier, region)
+	}
+	return archive, nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Store is the persistence layer used by the API. DatabaseService implements
+// it on top of Postgres in production or SQLite for local development and
+// tests, selected with DB_DRIVER.
+type Store interface {
+	CreateDocument(doc *Document) error
+	GetDocument(id DocumentID) (*Document, error)
+	GetDocumentAnalysis(id DocumentID) (*DocumentAnalysis, error)
+	GetDocuments(limit, offset int, filters []MetadataFilter, source SubmissionFilter, scope DocumentScope) ([]*Document, error)
+	GetDocumentStats(tenantID *string, since *time.Time, loc *time.Location) (*DocumentStats, error)
+	ExportDocuments(after ExportCursor, tenantID *string, limit int) ([]*DocumentExport, error)
+	GetChanges(after ChangeCursor, tenantID *string, limit int) ([]*Change, error)
+	PurgeChanges(before time.Time) (int64, error)
+	UpdateDocumentFraudAnalysis(id DocumentID, analysis *FraudAnalysis) error
+	GetCachedAnalysis(key string, notBefore time.Time) (*AnalyzeTextResponse, error)
+	CacheAnalysis(key string, analyzer Analyzer, analysis *AnalyzeTextResponse) error
+	PurgeAnalysisCache(before time.Time) (int64, error)
+	GetModelStats(since, until time.Time) (map[ModelKey]*ModelStats, error)
+	GetModelPerformance(since time.Time) ([]*ModelPerformance, error)
+	PurgeAnalysisObservations(before time.Time) (int64, error)
+	RecordCanaryComparison(c *CanaryComparison) error
+	GetCanaryReports(since time.Time, tolerance float64) ([]*CanaryReport, error)
+	UpdateDocumentExtractedText(id DocumentID, text string) error
+	GetFallbackAnalyzedDocuments(limit int) ([]*Document, error)
+	GetDocumentsToArchive(before time.Time, limit int) ([]*Document, error)
+	UpdateDocumentStorageTier(id DocumentID, from, to string) (bool, error)
+	CreateDocumentPartitions(now time.Time, ahead, tenantPartitions int) ([]string, error)
+	ExpireDocumentPartitions(before time.Time) ([]string, error)
+	DeleteExpiredDocuments(limit int) ([]*Document, error)
+	GetKnownFilePaths(paths []string) (map[string]bool, error)
+	AcquireStoredObject(region, tier, name string) (int, error)
+	ReleaseStoredObject(region, tier, name string) (int, error)
+	PatchDocumentMetadata(id DocumentID, set Metadata, remove []string) (Metadata, error)
+	CreateFraudDetection(detection *FraudDetection) error
+	GetFraudDetections(filter DetectionFilter) ([]*DetectionRecord, error)
+	SearchDocuments(query string, limit int, scope DocumentScope) ([]*Document, error)
+	ReplaceDocumentEntities(documentID DocumentID, entities []string) error
+	GetDocumentEntities(documentID DocumentID) ([]*DocumentEntity, error)
+	ReplaceDocumentPages(documentID DocumentID, pages []*DocumentPage) error
+	GetDocumentPages(documentID DocumentID) ([]*DocumentPage, error)
+	GetOrCreateAccount(tenantID *string, kind, identifier string) (*Account, error)
+	GetAccount(id string) (*Account, error)
+	GetAccountStatement(documentID DocumentID) (*AccountStatement, error)
+	GetPreviousAccountStatement(accountID string, documentID DocumentID) (*AccountStatement, error)
+	GetSeenAccountSegments(accountID string, documentID DocumentID, digests []string) (map[string]DocumentID, error)
+	RecordAccountStatement(statement *AccountStatement, digests []string) error
+	RecordAccountEvidence(evidence *AccountEvidence, halfLife time.Duration) error
+	ListAccountEvidence(accountID string) ([]*AccountEvidence, error)
+	ListDocumentAccounts(documentID DocumentID) ([]*Account, error)
+	ReplaceDocumentAmounts(documentID DocumentID, amounts DocumentAmounts) error
+	GetDocumentAmounts(documentID DocumentID) (DocumentAmounts, error)
+	GetSpendReport(tenantID, baseCurrency string, since time.Time, loc *time.Location) (*SpendReport, error)
+	GetFXRate(day, base, quote string) (*FXRate, error)
+	SaveFXRates(rates []*FXRate) error
+	GetDocumentEvents(documentID DocumentID) ([]*StoredEvent, error)
+	RecordPipelineRun(documentID DocumentID, stages []*PipelineStageRun) error
+	GetPipelineStageRuns(documentID DocumentID) ([]*PipelineStageRun, error)
+	GetPipelineStats(since time.Time) (*PipelineStats, error)
+	GetPipelineBacklog(window time.Duration) (*PipelineBacklog, error)
+	GetPipelineQueuePosition(documentID DocumentID) (ahead int, queued bool, err error)
+	EnqueuePipelineJob(documentID DocumentID, reuseText bool) error
+	ClaimPipelineJobs(owner string, lease time.Duration, limit int) ([]*PipelineJob, error)
+	RenewPipelineJobLease(id int64, owner string, lease time.Duration) (bool, error)
+	CompletePipelineJob(id int64, owner string) error
+	CheckpointPipelineJob(id int64, owner string) error
+	ReleasePipelineJob(id int64, owner string) error
+	QueueStalledDocuments(staleBefore time.Time) ([]*PipelineJob, error)
+	FailPipelineJob(id int64, owner, reason string) error
+
+	SaveDocumentEmbedding(documentID DocumentID, model string, embedding []float32) error
+	GetDocumentEmbedding(documentID DocumentID) ([]float32, error)
+	FindSimilarDocuments(embedding []float32, limit int, excludeID DocumentID) ([]*SimilarDocument, error)
+
+	CreateExemplar(exemplar *Exemplar) error
+	GetExemplar(id string) (*Exemplar, error)
+	GetExemplars(tenantID *string) ([]*Exemplar, error)
+	DeleteExemplar(id string) error
+	CreateAlert(alert *Alert) error
+	GetAlert(id string) (*Alert, error)
+	GetAlerts(limit, offset int, unacknowledgedOnly bool, tenantID *string) ([]*Alert, error)
+	AcknowledgeAlert(id, by, disposition string) (*Alert, error)
+	AssignAlert(id, assignee string, original *string) (*Alert, error)
+	GetEscalationCandidates(limit int) ([]*EscalationCandidate, error)
+	EscalateAlert(id string, level int, step EscalationStep, assignee string, original *string) (bool, error)
+	GetAlertEscalations(alertID string) ([]*AlertEscalation, error)
+	GetAlertSLARecords(tenantID string, since time.Time) ([]*AlertSLARecord, error)
+	ReviewDetection(id, reviewerID string, falsePositive *bool, disposition string) (*FraudDetection, error)
+	GetDispositionReport(tenantID *string, since time.Time) ([]*DispositionCount, error)
+	GetFeedbackLabels(tenantID *string, since time.Time, afterID string, limit int) ([]*FeedbackLabel, error)
+	RequestApproval(approval *Approval) error
+	GetApproval(id string) (*Approval, error)
+	GetApprovals(filter ApprovalFilter) ([]*Approval, error)
+	DecideApproval(id string, decider *User, approve bool) (*Approval, error)
+	CreateSARDraft(draft *SARDraft) error
+	GetSARDraft(alertID string, version int) (*SARDraft, error)
+	FindSubjectDocuments(subject DataSubject, scope DocumentScope) ([]*Document, error)
+	PlaceLegalHold(hold *LegalHold) error
+	ReleaseLegalHold(id, releasedBy string) (*LegalHold, error)
+	GetLegalHolds(tenantID *string, all bool, limit int) ([]*LegalHold, error)
+	GetRetentionReasons(ids []DocumentID) (map[DocumentID]string, error)
+	EraseDocument(id DocumentID, requestID string) (*Document, error)
+	DeleteDocument(id DocumentID, deletedBy *string) (*Document, error)
+	PurgeDeletedDocuments(before time.Time, limit int) ([]DocumentID, error)
+	CreatePrivacyRequest(request *PrivacyRequest) error
+	CompletePrivacyRequest(request *PrivacyRequest) error
+	GetPrivacyRequests(tenantID *string, limit int) ([]*PrivacyRequest, error)
+	SavePseudonyms(pseudonyms []Pseudonym) error
+	GetPseudonym(token string) (*Pseudonym, error)
+	DeleteSubjectPseudonyms(subject DataSubject) (int64, error)
+	GetMaintenance() (*Maintenance, error)
+	SetMaintenance(maintenance *Maintenance) error
+	GetLogLevelOverrides(now time.Time) ([]*LogLevelOverride, error)
+	SetLogLevelOverride(override *LogLevelOverride) error
+	DeleteLogLevelOverride(component string) (bool, error)
+	CreateDelegation(delegation *Delegation) error
+	GetDelegation(id string) (*Delegation, error)
+	GetDelegations(userID string, since time.Time) ([]*Delegation, error)
+	DeleteDelegation(id string) error
+	ResolveAssignee(userID string, t time.Time) (string, *Delegation, error)
+
+	CreateTenant(tenant *Tenant) error
+	GetTenant(id string) (*Tenant, error)
+	GetTenantBySlug(slug string) (*Tenant, error)
+	UpdateTenantRiskTaxonomy(id string, taxonomy *RiskTaxonomy) error
+	UpdateTenantStorageRegion(id string, region *string) error
+	UpdateTenantLanguage(id string, language *string) error
+	UpdateTenantTimeZone(id string, timeZone *string) error
+	UpdateTenantBaseCurrency(id string, currency *string) error
+	UpdateTenantHolidayCalendar(id string, code *string) error
+	UpdateTenantImpersonationConsent(id string, allowed bool, at time.Time) (int64, error)
+	UpdateTenantEscalationChain(id string, chain *EscalationChain) error
+	UpdateTenantDispositionTaxonomy(id string, taxonomy *DispositionTaxonomy) error
+	UpdateTenantDocumentFields(id string, fields DocumentFields) error
+	UpdateTenantApprovalPolicy(id string, policy *ApprovalPolicy) error
+	UpdateTenantChannelWeights(id string, weights ChannelWeights) error
+	UpdateTenantVelocityRules(id string, rules VelocityRules) error
+	ExportTenantConfig(tenant *Tenant) (*TenantConfig, error)
+	PlanTenantConfig(tenant *Tenant, config *TenantConfig) (*TenantConfigPlan, error)
+	ApplyTenantConfig(plan *TenantConfigPlan, ipAddress *string) error
+	GetReplayDocuments(tenantID string, since time.Time, limit int) ([]*ReplayDocument, error)
+	GetBacktestCorpus(tenantID string, since time.Time, size int, seed int64) (*BacktestCorpus, error)
+	GetHolidayCalendars() ([]*HolidayCalendar, error)
+	GetHolidayCalendar(code string, year int) (*HolidayCalendar, error)
+	SaveHolidayCalendar(calendar *HolidayCalendar) error
+	SaveHoliday(code string, holiday *Holiday) error
+	DeleteHoliday(code, day string) error
+	DeleteHolidayCalendar(code string) error
+	CreateQuestionSet(set *QuestionSet) error
+	GetQuestionSet(tenantID string, version int) (*QuestionSet, error)
+	GetQuestionSets(tenantID string) ([]*QuestionSet, error)
+	CreateFraudQAAnalysis(analysis *FraudQAAnalysis) error
+	GetFraudQAAnalysis(id string) (*FraudQAAnalysis, error)
+	CreateUser(user *User) error
+	GetUser(id string) (*User, error)
+	GetUserByEmail(email string) (*User, error)
+	UpdateUserRole(id, role string) (*User, string, error)
+	UpdateUserLanguage(id string, language *string) (*User, error)
+	CreateTeam(team *Team) error
+	GetTeam(id string) (*Team, error)
+	GetTeams(tenantID string) ([]*Team, error)
+	AddTeamMember(teamID, userID string) error
+	RemoveTeamMember(teamID, userID string) (bool, error)
+	GetUserTeamIDs(userID string) ([]string, error)
+	UpdateDocumentTeam(id DocumentID, teamID *string) error
+	CreateFraudPattern(pattern *FraudPattern) error
+	GetFraudPatterns() ([]*FraudPattern, error)
+	GetFraudPattern(id string) (*FraudPattern, error)
+	GetFraudPatternStats(patternID string, since time.Time, interval string, loc *time.Location) (*PatternStats, error)
+
+	ExportTenants(slugs []string, w SnapshotWriter) (*SnapshotInfo, error)
+	ImportSnapshot(info SnapshotInfo, r SnapshotReader) (map[string]int, error)
+
+	CreateWebhookEvent(event *WebhookEvent) error
+	GetPendingWebhookEvents(now time.Time, limit int) ([]*WebhookEvent, error)
+	MarkWebhookEventDelivered(id int64) error
+	RetryWebhookEvent(id int64, next time.Time, lastError string) error
+	FailWebhookEvent(id int64, lastError string) error
+	GetAlertWebhookEvents(alertID string) ([]*WebhookEvent, error)
+
+	CreateCaseEvidence(evidence *CaseEvidence) error
+	DeleteCaseEvidence(id string) error
+	GetCaseEvidence(alertID, id string) (*CaseEvidence, error)
+	GetCaseEvidenceList(alertID string) ([]*CaseEvidence, error)
+
+	CreateAuditorGrant(grant *AuditorGrant, tokenDigest string) error
+	GetAuditorGrants(tenantID string) ([]*AuditorGrant, error)
+	GetAuditorGrantByToken(tokenDigest string) (*AuditorGrant, error)
+	RevokeAuditorGrant(id string, at time.Time) (*AuditorGrant, error)
+	RecordAuditorAccess(access *AuditorAccess) error
+	StartImpersonation(session *Impersonation, tokenDigest string, ipAddress *string) error
+	GetImpersonations(tenantID string) ([]*Impersonation, error)
+	GetImpersonationByToken(tokenDigest string) (*Impersonation, error)
+	EndImpersonation(id string, at time.Time, ipAddress *string) (*Impersonation, error)
+	RecordImpersonatedRequest(session *Impersonation, details Metadata, ipAddress *string) error
+	SignUpTenant(tenant *Tenant, admin *User, keyDigest string, ipAddress *string) (*TenantSignup, error)
+	ReplaceWelcomeAPIKey(tenant *Tenant, admin *User, keyDigest string, ipAddress *string) (*APIKey, error)
+	GetAPIKeys(tenantID string) ([]*APIKey, error)
+	GetAPIKeyByDigest(keyDigest string) (*APIKey, error)
+	MarkAPIKeyUsed(id string, at time.Time) error
+	RevokeAPIKey(id string, at time.Time) (*APIKey, error)
+
+	RecordCredentialRotation(rotation *CredentialRotation) error
+	GetCredentialRotations(limit int) ([]CredentialRotation, error)
+
+	RecordSubmission(submission *Submission) error
+	GetSubmission(documentID DocumentID) (*Submission, error)
+	GetUserSubmissions(userID string, since time.Time) ([]*Submission, error)
+	GetAuditLog(filter AuditLogFilter) ([]*AuditLogEntry, error)
+	CountVelocity(rule VelocityRule, count *VelocityCount) (*VelocityWindow, error)
+
+	ExportDocumentsByID(ids []DocumentID) ([]*DocumentExport, error)
+	GetGraphSyncState() (*GraphSyncState, error)
+	SaveGraphSyncState(state *GraphSyncState) error
+
+	PoolStats() sql.DBStats
+	Close() error
+}
+
+var _ Store = (*DatabaseService)(nil)
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ContentObjectName is the object name of a file with the given SHA-256
+// digest. Files uploaded before content addressing keep their original
+// timestamped names.
+func ContentObjectName(contentSHA256 string) string {
+	return "sha256/" + contentSHA256[:2] + "/" + contentSHA256
+}
+
+// AcquireStoredObject records one more document referencing the object in
+// the region's bucket of the given tier and returns the new reference
+// count. A count of one means the object is not stored yet.
+func (d *DatabaseService) AcquireStoredObject(region, tier, name string) (int, error) {
+	var refs int
+	err := d.db.QueryRow(`
+		INSERT INTO stored_objects (region, tier, object_name, ref_count) VALUES ($1, $2, $3, 1)
+		ON CONFLICT (region, tier, object_name) DO UPDATE SET ref_count = stored_objects.ref_count + 1
+		RETURNING ref_count`, region, tier, name).Scan(&refs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire stored object: %v", err)
+	}
+	return refs, nil
+}
+
+// ReleaseStoredObject drops one reference to the object and returns the
+// references left. The object can be deleted once none are left. Objects
+// stored before reference counting have no references to drop and report
+// zero.
+func (d *DatabaseService) ReleaseStoredObject(region, tier, name string) (int, error) {
+	var refs int
+	err := d.db.QueryRow(`
+		UPDATE stored_objects SET ref_count = ref_count - 1
+		WHERE region = $1 AND tier = $2 AND object_name = $3
+		RETURNING ref_count`, region, tier, name).Scan(&refs)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to release stored object: %v", err)
+	}
+	if refs <= 0 {
+		_, err := d.db.Exec(`DELETE FROM stored_objects WHERE region = $1 AND tier = $2 AND object_name = $3 AND ref_count <= 0`,
+			region, tier, name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to release stored object: %v", err)
+		}
+		refs = 0
+	}
+	return refs, nil
+}
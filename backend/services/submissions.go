@@ -0,0 +1,203 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// PatternTypeMultiCountrySubmission is recorded for documents submitted by a
+// user who submitted from more countries than allowed within the velocity
+// window, as happens when an account's credentials are shared or stolen
+const PatternTypeMultiCountrySubmission = "multi_country_submission"
+
+// AuditActionDocumentSubmitted is the audit_logs action of submissions
+const AuditActionDocumentSubmitted = "document.submitted"
+
+// Confidence of multi-country detections: the first country over the limit
+// may be travel, each further one makes it less likely
+const (
+	multiCountryBaseConfidence = 0.6
+	multiCountryStepConfidence = 0.1
+	multiCountryMaxConfidence  = 0.95
+)
+
+// Submission is where a document was submitted from: the client address of
+// the request that uploaded it, the country the address geolocates to, the
+// channel it came in through and a fingerprint of the client
+type Submission struct {
+	DocumentID  DocumentID `json:"document_id"`
+	TenantID    *string    `json:"tenant_id"`
+	UserID      *string    `json:"user_id"`
+	IPAddress   string     `json:"ip_address"`
+	Country     *string    `json:"country"`
+	Channel     string     `json:"channel"`
+	Fingerprint *string    `json:"fingerprint"`
+	UserAgent   *string    `json:"user_agent"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SubmissionFilter selects documents by how they were submitted; empty
+// fields match all
+type SubmissionFilter struct {
+	Channel     string
+	Fingerprint string
+}
+
+// conditions returns the filter as SQL conditions on the documents table,
+// appending their arguments to args
+func (f SubmissionFilter) conditions(args *[]interface{}) []string {
+	var conditions []string
+	if f.Channel != "" {
+		*args = append(*args, f.Channel)
+		conditions = append(conditions, fmt.Sprintf("id IN (SELECT document_id FROM document_submissions WHERE channel = $%d)", len(*args)))
+	}
+	if f.Fingerprint != "" {
+		*args = append(*args, f.Fingerprint)
+		conditions = append(conditions, fmt.Sprintf("id IN (SELECT document_id FROM document_submissions WHERE fingerprint = $%d)", len(*args)))
+	}
+	return conditions
+}
+
+// Matches reports whether submission, which is nil for documents without
+// one, passes the filter
+func (f SubmissionFilter) Matches(submission *Submission) bool {
+	if f.Channel == "" && f.Fingerprint == "" {
+		return true
+	}
+	if submission == nil {
+		return false
+	}
+	if f.Channel != "" && submission.Channel != f.Channel {
+		return false
+	}
+	return f.Fingerprint == "" || (submission.Fingerprint != nil && *submission.Fingerprint == f.Fingerprint)
+}
+
+// CountryVelocity compares the countries of a user's recent submissions,
+// including current, with the number they may submit from within window.
+// It returns nil while they are within it, or when current has no country.
+func CountryVelocity(current *Submission, recent []*Submission, maxCountries int, window time.Duration) *RiskFactor {
+	if current.Country == nil || maxCountries <= 0 {
+		return nil
+	}
+
+	counts := map[string]int{*current.Country: 1}
+	for _, submission := range recent {
+		if submission.DocumentID == current.DocumentID || submission.Country == nil {
+			continue
+		}
+		counts[*submission.Country]++
+	}
+	if len(counts) <= maxCountries {
+		return nil
+	}
+
+	countries := make([]string, 0, len(counts))
+	for country := range counts {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+	submissions := Metadata{}
+	for _, country := range countries {
+		submissions[country] = counts[country]
+	}
+
+	over := len(counts) - maxCountries - 1
+	confidence := math.Min(multiCountryMaxConfidence, multiCountryBaseConfidence+float64(over)*multiCountryStepConfidence)
+	return &RiskFactor{
+		PatternType: PatternTypeMultiCountrySubmission,
+		Confidence:  confidence,
+		Details: Metadata{
+			"country":       *current.Country,
+			"ip_address":    current.IPAddress,
+			"countries":     countries,
+			"submissions":   submissions,
+			"max_countries": maxCountries,
+			"window_hours":  window.Hours(),
+		},
+	}
+}
+
+// RecordSubmission stores where a document was submitted from and adds the
+// submission to the audit log, with its address
+func (d *DatabaseService) RecordSubmission(submission *Submission) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`
+		INSERT INTO document_submissions (document_id, tenant_id, user_id, ip_address, country, channel, fingerprint, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`,
+		submission.DocumentID, submission.TenantID, submission.UserID, submission.IPAddress, submission.Country,
+		submission.Channel, submission.Fingerprint, submission.UserAgent,
+	).Scan(&submission.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record submission of document %s: %v", submission.DocumentID, err)
+	}
+
+	details := submission.AuditDetails()
+	_, err = tx.Exec(`
+		INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address)
+		VALUES ($1, $2, 'document', $3, $4, $5)`,
+		submission.UserID, AuditActionDocumentSubmitted, submission.DocumentID, details, submission.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit submission of document %s: %v", submission.DocumentID, err)
+	}
+	return tx.Commit()
+}
+
+// AuditDetails are the details of the submission's audit log entry
+func (s *Submission) AuditDetails() Metadata {
+	return Metadata{
+		"country":     s.Country,
+		"tenant_id":   s.TenantID,
+		"channel":     s.Channel,
+		"fingerprint": s.Fingerprint,
+	}
+}
+
+const submissionColumns = `document_id, tenant_id, user_id, ip_address, country, channel, fingerprint, user_agent, created_at`
+
+func scanSubmission(row rowScanner) (*Submission, error) {
+	var submission Submission
+	err := row.Scan(&submission.DocumentID, &submission.TenantID, &submission.UserID,
+		&submission.IPAddress, &submission.Country, &submission.Channel, &submission.Fingerprint,
+		&submission.UserAgent, &submission.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
+
+// GetSubmission returns where a document was submitted from, or
+// sql.ErrNoRows for documents not uploaded through the API
+func (d *DatabaseService) GetSubmission(documentID DocumentID) (*Submission, error) {
+	return scanSubmission(d.db.QueryRow(`SELECT `+submissionColumns+` FROM document_submissions WHERE document_id = $1`, documentID))
+}
+
+// GetUserSubmissions returns a user's submissions since a time, oldest first
+func (d *DatabaseService) GetUserSubmissions(userID string, since time.Time) ([]*Submission, error) {
+	rows, err := d.db.Query(`
+		SELECT `+submissionColumns+` FROM document_submissions
+		WHERE user_id = $1 AND created_at >= $2
+		ORDER BY created_at, document_id`, userID, d.db.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get submissions of user %s: %v", userID, err)
+	}
+	defer rows.Close()
+
+	submissions := []*Submission{}
+	for rows.Next() {
+		submission, err := scanSubmission(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan submission: %v", err)
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, rows.Err()
+}
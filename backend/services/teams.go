@@ -0,0 +1,229 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Team is a group of a tenant's users who share a stream of documents
+type Team struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id"`
+	Name      string    `json:"name"`
+	Members   []string  `json:"members"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DocumentScope limits the documents a request may see. The zero value
+// sees every document.
+type DocumentScope struct {
+	// TenantID restricts the scope to one tenant's documents when set
+	TenantID *string
+	// TeamRestricted hides documents of teams not listed in TeamIDs.
+	// Documents without a team stay visible unless TeamsOnly is set.
+	TeamRestricted bool
+	TeamsOnly      bool
+	TeamIDs        []string
+}
+
+// Allows reports whether doc is in the scope
+func (s DocumentScope) Allows(doc *Document) bool {
+	if !s.AllowsTenant(doc.TenantID) {
+		return false
+	}
+	if !s.TeamRestricted {
+		return true
+	}
+	if doc.TeamID == nil {
+		return !s.TeamsOnly
+	}
+	for _, id := range s.TeamIDs {
+		if id == *doc.TeamID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsTenant reports whether records of tenantID, such as alerts, are in
+// the scope's tenant
+func (s DocumentScope) AllowsTenant(tenantID *string) bool {
+	return s.TenantID == nil || (tenantID != nil && *tenantID == *s.TenantID)
+}
+
+// conditions returns the scope as SQL conditions on the documents table,
+// appending their arguments to args
+func (s DocumentScope) conditions(args *[]interface{}) []string {
+	var conditions []string
+	if s.TenantID != nil {
+		*args = append(*args, *s.TenantID)
+		conditions = append(conditions, fmt.Sprintf("tenant_id = $%d", len(*args)))
+	}
+	if s.TeamRestricted {
+		alternatives := []string{"team_id IS NULL"}
+		if s.TeamsOnly {
+			alternatives = []string{"1 = 0"}
+		}
+		for _, id := range s.TeamIDs {
+			*args = append(*args, id)
+			alternatives = append(alternatives, fmt.Sprintf("team_id = $%d", len(*args)))
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	return conditions
+}
+
+// CreateTeam adds a team to a tenant
+func (d *DatabaseService) CreateTeam(team *Team) error {
+	err := d.db.QueryRow(`
+		INSERT INTO teams (tenant_id, name) VALUES ($1, $2)
+		RETURNING id, created_at`,
+		team.TenantID, team.Name,
+	).Scan(&team.ID, &team.CreatedAt)
+	if err != nil {
+		return err
+	}
+	team.Members = []string{}
+	return nil
+}
+
+// GetTeam returns a team with the IDs of its members
+func (d *DatabaseService) GetTeam(id string) (*Team, error) {
+	team := &Team{}
+	err := d.db.QueryRow(`SELECT id, tenant_id, name, created_at FROM teams WHERE id = $1`, id).
+		Scan(&team.ID, &team.TenantID, &team.Name, &team.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.loadTeamMembers([]*Team{team}); err != nil {
+		return nil, err
+	}
+	return team, nil
+}
+
+// GetTeams returns a tenant's teams, with the IDs of their members, by name
+func (d *DatabaseService) GetTeams(tenantID string) ([]*Team, error) {
+	rows, err := d.db.Query(`
+		SELECT id, tenant_id, name, created_at FROM teams WHERE tenant_id = $1 ORDER BY name`, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query teams: %v", err)
+	}
+	defer rows.Close()
+
+	teams := []*Team{}
+	for rows.Next() {
+		team := &Team{}
+		if err := rows.Scan(&team.ID, &team.TenantID, &team.Name, &team.CreatedAt); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := d.loadTeamMembers(teams); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+func (d *DatabaseService) loadTeamMembers(teams []*Team) error {
+	if len(teams) == 0 {
+		return nil
+	}
+	byID := make(map[string]*Team, len(teams))
+	placeholders := make([]string, len(teams))
+	args := make([]interface{}, len(teams))
+	for i, team := range teams {
+		team.Members = []string{}
+		byID[team.ID] = team
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = team.ID
+	}
+
+	rows, err := d.db.Query(`
+		SELECT team_id, user_id FROM team_members
+		WHERE team_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY created_at, user_id`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query team members: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teamID, userID string
+		if err := rows.Scan(&teamID, &userID); err != nil {
+			return err
+		}
+		byID[teamID].Members = append(byID[teamID].Members, userID)
+	}
+	return rows.Err()
+}
+
+// AddTeamMember adds a user to a team. Adding a member again does nothing.
+func (d *DatabaseService) AddTeamMember(teamID, userID string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO team_members (team_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (team_id, user_id) DO NOTHING`, teamID, userID)
+	return err
+}
+
+// RemoveTeamMember removes a user from a team and reports whether they were
+// a member
+func (d *DatabaseService) RemoveTeamMember(teamID, userID string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// GetUserTeamIDs returns the IDs of the teams a user is a member of
+func (d *DatabaseService) GetUserTeamIDs(userID string) ([]string, error) {
+	rows, err := d.db.Query(`SELECT team_id FROM team_members WHERE user_id = $1 ORDER BY team_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user teams: %v", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// UpdateDocumentTeam moves a document to a team, or out of any team when
+// teamID is nil. It returns sql.ErrNoRows when there is no such document.
+func (d *DatabaseService) UpdateDocumentTeam(id DocumentID, teamID *string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE documents SET team_id = $2 WHERE id = $1 AND deleted_at IS NULL`, id, teamID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	tenantID, err := documentTenant(tx, id)
+	if err != nil {
+		return err
+	}
+	if err := appendDocumentEvent(tx, id, tenantID, EventTeamChanged, Metadata{"team_id": teamID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,478 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TenantConfigFormat is the version of the tenant configuration bundle;
+// bundles of other versions are refused
+const TenantConfigFormat = 1
+
+// AuditActionTenantConfigImported is logged when a configuration bundle is
+// applied to a tenant
+const AuditActionTenantConfigImported = "tenant.config_imported"
+
+// TenantConfig is a tenant's configuration as a portable bundle, to copy it
+// between environments such as staging and production. Users are named by
+// email, since their IDs differ between environments. Fraud patterns are
+// shared by every tenant and are in the bundle for comparison only.
+type TenantConfig struct {
+	Format     int       `json:"format"`
+	Tenant     string    `json:"tenant"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	RiskTaxonomy        *RiskTaxonomy           `json:"risk_taxonomy"`
+	EscalationChain     *TenantConfigEscalation `json:"escalation_chain"`
+	DispositionTaxonomy *DispositionTaxonomy    `json:"disposition_taxonomy"`
+	DocumentFields      DocumentFields          `json:"document_fields"`
+	ApprovalPolicy      *ApprovalPolicy         `json:"approval_policy"`
+	ChannelWeights      ChannelWeights          `json:"channel_weights"`
+	VelocityRules       VelocityRules           `json:"velocity_rules"`
+	QuestionSet         *TenantConfigQuestions  `json:"question_set"`
+	Language            *string                 `json:"language"`
+	TimeZone            *string                 `json:"time_zone"`
+	BaseCurrency        *string                 `json:"base_currency"`
+	HolidayCalendar     *string                 `json:"holiday_calendar"`
+
+	FraudPatterns []TenantConfigPattern `json:"fraud_patterns"`
+}
+
+// TenantConfigEscalation is an escalation chain with its users named by
+// email
+type TenantConfigEscalation struct {
+	Steps         []TenantConfigEscalationStep `json:"steps"`
+	BusinessHours bool                         `json:"business_hours,omitempty"`
+}
+
+// TenantConfigEscalationStep is an escalation step with its user named by
+// email
+type TenantConfigEscalationStep struct {
+	Name         string `json:"name"`
+	UserEmail    string `json:"user_email"`
+	AfterMinutes int    `json:"after_minutes"`
+}
+
+// TenantConfigQuestions is the latest version of a tenant's question set
+type TenantConfigQuestions struct {
+	Questions      FraudQuestions `json:"questions"`
+	PromptTemplate *string        `json:"prompt_template"`
+}
+
+// TenantConfigPattern is a fraud pattern as it is compared between
+// environments
+type TenantConfigPattern struct {
+	Name           string   `json:"pattern_name"`
+	Type           string   `json:"pattern_type"`
+	Severity       string   `json:"severity"`
+	DetectionRules Metadata `json:"detection_rules"`
+	IsActive       bool     `json:"is_active"`
+}
+
+// TenantConfigChange is a section of a tenant's configuration a bundle
+// changes, with its value before and after
+type TenantConfigChange struct {
+	Section string          `json:"section"`
+	Before  json.RawMessage `json:"before"`
+	After   json.RawMessage `json:"after"`
+}
+
+// TenantConfigPlan is what applying a bundle to a tenant would change. Base
+// fingerprints the tenant's configuration the plan was made against.
+type TenantConfigPlan struct {
+	Tenant   *Tenant              `json:"-"`
+	Config   *TenantConfig        `json:"-"`
+	Base     string               `json:"base"`
+	Changes  []TenantConfigChange `json:"changes"`
+	Warnings []string             `json:"warnings"`
+
+	escalationChain *EscalationChain
+}
+
+// Changed reports whether the plan changes a section
+func (p *TenantConfigPlan) Changed(section string) bool {
+	for _, change := range p.Changes {
+		if change.Section == section {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantConfigError lists the problems found in a bundle, each prefixed
+// with its section
+type TenantConfigError struct {
+	Problems []string
+}
+
+func (e *TenantConfigError) Error() string {
+	return "invalid tenant configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// sections lists the parts of the bundle a tenant applies, in order
+func (c *TenantConfig) sections() []struct {
+	name  string
+	value interface{}
+} {
+	return []struct {
+		name  string
+		value interface{}
+	}{
+		{"risk_taxonomy", c.RiskTaxonomy},
+		{"disposition_taxonomy", c.DispositionTaxonomy},
+		{"document_fields", c.DocumentFields},
+		{"approval_policy", c.ApprovalPolicy},
+		{"channel_weights", c.ChannelWeights},
+		{"velocity_rules", c.VelocityRules},
+		{"question_set", c.QuestionSet},
+		{"language", c.Language},
+		{"time_zone", c.TimeZone},
+		{"base_currency", c.BaseCurrency},
+		{"holiday_calendar", c.HolidayCalendar},
+		{"escalation_chain", c.EscalationChain},
+	}
+}
+
+// normalize makes empty sections nil, so that a bundle written by hand
+// compares equal to an export
+func (c *TenantConfig) normalize() {
+	if len(c.DocumentFields) == 0 {
+		c.DocumentFields = nil
+	}
+	if len(c.ChannelWeights) == 0 {
+		c.ChannelWeights = nil
+	}
+	if len(c.VelocityRules) == 0 {
+		c.VelocityRules = nil
+	}
+	if c.BaseCurrency != nil {
+		currency := NormalizeCurrency(*c.BaseCurrency)
+		if currency != "" {
+			c.BaseCurrency = &currency
+		}
+	}
+	if c.HolidayCalendar != nil {
+		code := NormalizeHolidayCalendarCode(*c.HolidayCalendar)
+		c.HolidayCalendar = &code
+	}
+	if c.Language != nil {
+		language := NormalizeLanguage(*c.Language)
+		c.Language = &language
+	}
+}
+
+// sectionProblems lists the problems of a validation error, prefixed with
+// the section of the bundle they were found in
+func sectionProblems(section string, err error) []string {
+	var problems []string
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *RiskTaxonomyError:
+		problems = e.Problems
+	case *DispositionError:
+		problems = e.Problems
+	case *DocumentFieldsError:
+		problems = e.Problems
+	case *ApprovalPolicyError:
+		problems = e.Problems
+	case *ChannelWeightsError:
+		problems = e.Problems
+	case *VelocityRulesError:
+		problems = e.Problems
+	case *QuestionSetError:
+		problems = e.Problems
+	case *EscalationChainError:
+		problems = e.Problems
+	default:
+		problems = []string{err.Error()}
+	}
+	for i, problem := range problems {
+		problems[i] = section + ": " + problem
+	}
+	return problems
+}
+
+// ExportTenantConfig returns the tenant's configuration as a bundle
+func (d *DatabaseService) ExportTenantConfig(tenant *Tenant) (*TenantConfig, error) {
+	config := &TenantConfig{
+		Format:              TenantConfigFormat,
+		Tenant:              tenant.Slug,
+		ExportedAt:          time.Now().UTC(),
+		RiskTaxonomy:        tenant.RiskTaxonomy,
+		DispositionTaxonomy: tenant.DispositionTaxonomy,
+		DocumentFields:      tenant.DocumentFields,
+		ApprovalPolicy:      tenant.ApprovalPolicy,
+		ChannelWeights:      tenant.ChannelWeights,
+		VelocityRules:       tenant.VelocityRules,
+		Language:            tenant.Language,
+		TimeZone:            tenant.TimeZone,
+		BaseCurrency:        tenant.BaseCurrency,
+		HolidayCalendar:     tenant.HolidayCalendar,
+	}
+
+	if chain := tenant.EscalationChain; chain != nil {
+		escalation := &TenantConfigEscalation{BusinessHours: chain.BusinessHours}
+		for _, step := range chain.Steps {
+			// A step whose user is gone is exported without an email, and
+			// refused on import like it would be refused here
+			var email string
+			if user, err := d.GetUser(step.UserID); err == nil {
+				email = user.Email
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("failed to look up escalation user %s: %v", step.UserID, err)
+			}
+			escalation.Steps = append(escalation.Steps, TenantConfigEscalationStep{
+				Name:         step.Name,
+				UserEmail:    email,
+				AfterMinutes: step.AfterMinutes,
+			})
+		}
+		config.EscalationChain = escalation
+	}
+
+	set, err := d.GetQuestionSet(tenant.ID, 0)
+	switch {
+	case err == nil:
+		config.QuestionSet = &TenantConfigQuestions{Questions: set.Questions, PromptTemplate: set.PromptTemplate}
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, fmt.Errorf("failed to load question set: %v", err)
+	}
+
+	patterns, err := d.GetFraudPatterns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load fraud patterns: %v", err)
+	}
+	for _, pattern := range patterns {
+		config.FraudPatterns = append(config.FraudPatterns, TenantConfigPattern{
+			Name:           pattern.PatternName,
+			Type:           pattern.PatternType,
+			Severity:       pattern.Severity,
+			DetectionRules: pattern.DetectionRules,
+			IsActive:       pattern.IsActive,
+		})
+	}
+	config.normalize()
+	return config, nil
+}
+
+// PlanTenantConfig validates a bundle for a tenant and compares it with the
+// tenant's configuration. Every problem found is returned at once, as a
+// *TenantConfigError. The bundle's language is left to the caller to check
+// against the languages it has messages in.
+func (d *DatabaseService) PlanTenantConfig(tenant *Tenant, config *TenantConfig) (*TenantConfigPlan, error) {
+	config.normalize()
+
+	var problems []string
+	add := func(section string, err error) {
+		problems = append(problems, sectionProblems(section, err)...)
+	}
+
+	if config.Format != TenantConfigFormat {
+		add("format", fmt.Errorf("must be %d", TenantConfigFormat))
+	}
+	if config.RiskTaxonomy != nil {
+		add("risk_taxonomy", config.RiskTaxonomy.Validate())
+	}
+	if config.DispositionTaxonomy != nil {
+		add("disposition_taxonomy", config.DispositionTaxonomy.Validate())
+	}
+	add("document_fields", config.DocumentFields.Validate())
+	if config.ApprovalPolicy != nil {
+		add("approval_policy", config.ApprovalPolicy.Validate())
+	}
+	add("channel_weights", config.ChannelWeights.Validate())
+	add("velocity_rules", config.VelocityRules.Validate())
+	if config.QuestionSet != nil {
+		set := &QuestionSet{Questions: config.QuestionSet.Questions, PromptTemplate: config.QuestionSet.PromptTemplate}
+		add("question_set", set.Validate())
+	}
+	if config.TimeZone != nil {
+		if _, err := LoadTimeZone(*config.TimeZone); err != nil {
+			add("time_zone", errors.New("must be an IANA time zone"))
+		}
+	}
+	if config.BaseCurrency != nil && NormalizeCurrency(*config.BaseCurrency) == "" {
+		add("base_currency", errors.New("must be an ISO 4217 currency code"))
+	}
+	if config.HolidayCalendar != nil {
+		var exists bool
+		err := d.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM holiday_calendars WHERE code = $1)`, *config.HolidayCalendar).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			add("holiday_calendar", fmt.Errorf("%s is not a holiday calendar of this environment", *config.HolidayCalendar))
+		}
+	}
+
+	plan := &TenantConfigPlan{Tenant: tenant, Config: config, Changes: []TenantConfigChange{}, Warnings: []string{}}
+	if escalation := config.EscalationChain; escalation != nil {
+		chain := &EscalationChain{BusinessHours: escalation.BusinessHours}
+		var chainProblems []string
+		resolved := true
+		for i, step := range escalation.Steps {
+			user, err := d.GetUserByEmail(step.UserEmail)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return nil, err
+			}
+			if user == nil || user.TenantID == nil || *user.TenantID != tenant.ID {
+				chainProblems = append(chainProblems, fmt.Sprintf("steps[%d].user_email %q is not a user of the tenant", i, step.UserEmail))
+				resolved = false
+				user = &User{ID: "00000000-0000-0000-0000-000000000000"}
+			}
+			chain.Steps = append(chain.Steps, EscalationStep{Name: step.Name, UserID: user.ID, AfterMinutes: step.AfterMinutes})
+		}
+		var chainErr *EscalationChainError
+		if errors.As(chain.Validate(), &chainErr) {
+			chainProblems = append(chainProblems, chainErr.Problems...)
+		}
+		if chain.BusinessHours && config.HolidayCalendar == nil {
+			chainProblems = append(chainProblems, "business_hours needs a holiday calendar for the tenant")
+		}
+		if len(chainProblems) > 0 {
+			add("escalation_chain", &EscalationChainError{Problems: chainProblems})
+		}
+		if resolved {
+			plan.escalationChain = chain
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &TenantConfigError{Problems: problems}
+	}
+
+	current, err := d.ExportTenantConfig(tenant)
+	if err != nil {
+		return nil, err
+	}
+	base := sha256.New()
+	incoming := config.sections()
+	for i, section := range current.sections() {
+		before, err := json.Marshal(section.value)
+		if err != nil {
+			return nil, err
+		}
+		after, err := json.Marshal(incoming[i].value)
+		if err != nil {
+			return nil, err
+		}
+		base.Write(before)
+		if section.name == "question_set" && config.QuestionSet == nil && current.QuestionSet != nil {
+			// Question set versions are kept for the analyses that asked them
+			plan.Warnings = append(plan.Warnings, "question_set is not in the bundle; the tenant keeps its question set")
+			continue
+		}
+		if !bytes.Equal(before, after) {
+			plan.Changes = append(plan.Changes, TenantConfigChange{Section: section.name, Before: before, After: after})
+		}
+	}
+	plan.Base = hex.EncodeToString(base.Sum(nil))
+
+	// Patterns are shared, so a bundle cannot change them; differences are
+	// reported for the operator to reconcile
+	patterns := map[string]TenantConfigPattern{}
+	for _, pattern := range current.FraudPatterns {
+		patterns[pattern.Name] = pattern
+	}
+	for _, pattern := range config.FraudPatterns {
+		existing, ok := patterns[pattern.Name]
+		if !ok {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("fraud pattern %q is not in this environment", pattern.Name))
+			continue
+		}
+		want, _ := json.Marshal(pattern)
+		have, _ := json.Marshal(existing)
+		if !bytes.Equal(want, have) {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("fraud pattern %q differs in this environment", pattern.Name))
+		}
+	}
+	return plan, nil
+}
+
+// ApplyTenantConfig applies a plan in one transaction and adds it to the
+// audit log. Like the individual updates, a changed base currency drops the
+// tenant's velocity counts and changed velocity rules drop theirs; a
+// changed question set is saved as the tenant's next version, created by
+// the bundle's tenant.
+func (d *DatabaseService) ApplyTenantConfig(plan *TenantConfigPlan, ipAddress *string) error {
+	if len(plan.Changes) == 0 {
+		return nil
+	}
+	tenant, config := plan.Tenant, plan.Config
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldRules VelocityRules
+	if err := tx.QueryRow(`SELECT velocity_rules FROM tenants WHERE id = $1`, tenant.ID).Scan(&oldRules); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE tenants SET
+			risk_taxonomy = $2, escalation_chain = $3, disposition_taxonomy = $4, document_fields = $5,
+			approval_policy = $6, channel_weights = $7, velocity_rules = $8, language = $9, time_zone = $10,
+			base_currency = $11, holiday_calendar = $12, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		tenant.ID, config.RiskTaxonomy, plan.escalationChain, config.DispositionTaxonomy, config.DocumentFields,
+		config.ApprovalPolicy, config.ChannelWeights, config.VelocityRules, config.Language, config.TimeZone,
+		config.BaseCurrency, config.HolidayCalendar)
+	if err != nil {
+		return fmt.Errorf("failed to update tenant %s: %v", tenant.Slug, err)
+	}
+
+	if plan.Changed("base_currency") {
+		if _, err := tx.Exec(`DELETE FROM velocity_counters WHERE tenant_id = $1`, tenant.ID); err != nil {
+			return fmt.Errorf("failed to drop velocity counters: %v", err)
+		}
+		_, err = tx.Exec(`DELETE FROM velocity_events WHERE document_id IN (SELECT id FROM documents WHERE tenant_id = $1)`, tenant.ID)
+		if err != nil {
+			return fmt.Errorf("failed to drop velocity events: %v", err)
+		}
+	} else {
+		for _, name := range StaleVelocityRules(oldRules, config.VelocityRules) {
+			if _, err := tx.Exec(`DELETE FROM velocity_counters WHERE tenant_id = $1 AND rule_name = $2`, tenant.ID, name); err != nil {
+				return fmt.Errorf("failed to drop velocity counters: %v", err)
+			}
+		}
+	}
+
+	if plan.Changed("question_set") && config.QuestionSet != nil {
+		var version int
+		err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM question_sets WHERE tenant_id = $1`, tenant.ID).Scan(&version)
+		if err != nil {
+			return err
+		}
+		createdBy := "import of " + config.Tenant
+		_, err = tx.Exec(`
+			INSERT INTO question_sets (tenant_id, version, questions, prompt_template, created_by)
+			VALUES ($1, $2, $3, $4, $5)`,
+			tenant.ID, version, config.QuestionSet.Questions, config.QuestionSet.PromptTemplate, createdBy)
+		if err != nil {
+			return fmt.Errorf("failed to save question set: %v", err)
+		}
+	}
+
+	sections := make([]string, len(plan.Changes))
+	for i, change := range plan.Changes {
+		sections[i] = change.Section
+	}
+	details := Metadata{"slug": tenant.Slug, "source": config.Tenant, "sections": sections}
+	_, err = tx.Exec(`
+		INSERT INTO audit_logs (action, resource_type, resource_id, details, ip_address)
+		VALUES ($1, 'tenant', $2, $3, $4)`,
+		AuditActionTenantConfigImported, tenant.ID, details, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to audit configuration import of tenant %s: %v", tenant.Slug, err)
+	}
+	return tx.Commit()
+}
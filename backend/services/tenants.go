@@ -0,0 +1,172 @@
+package services
+
+import (
+	"database/sql"
+	"time"
+)
+
+type Tenant struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+
+	// RiskTaxonomy is nil for tenants using DefaultRiskTaxonomy
+	RiskTaxonomy *RiskTaxonomy `json:"risk_taxonomy"`
+
+	// StorageRegion pins the tenant's files to a data residency region; nil
+	// uses the default region
+	StorageRegion *string `json:"storage_region"`
+
+	// EscalationChain moves alerts nobody closed up to other reviewers; nil
+	// turns escalation off
+	EscalationChain *EscalationChain `json:"escalation_chain"`
+
+	// DispositionTaxonomy is nil for tenants using DefaultDispositionTaxonomy
+	DispositionTaxonomy *DispositionTaxonomy `json:"disposition_taxonomy"`
+
+	// DocumentFields are the metadata fields the tenant adds to document
+	// types; nil when it uses the built-in ones only
+	DocumentFields DocumentFields `json:"document_fields"`
+
+	// ApprovalPolicy says who may approve what amount; nil does not check
+	// approvals
+	ApprovalPolicy *ApprovalPolicy `json:"approval_policy"`
+
+	// ChannelWeights multiply fraud scores by submission channel; nil
+	// leaves scores as the analyzer gave them
+	ChannelWeights ChannelWeights `json:"channel_weights"`
+
+	// VelocityRules limit the documents and amounts submitted within a
+	// window; nil does not count them
+	VelocityRules VelocityRules `json:"velocity_rules"`
+
+	// Language is the language the tenant's users read messages in unless
+	// they chose their own; nil uses the server's default
+	Language *string `json:"language"`
+
+	// TimeZone is the IANA time zone the tenant's reports are bucketed in;
+	// nil reports in UTC
+	TimeZone *string `json:"time_zone"`
+
+	// BaseCurrency is the ISO 4217 currency the tenant's amounts are
+	// converted into for reports and velocity rules; nil uses the server's
+	BaseCurrency *string `json:"base_currency"`
+
+	// HolidayCalendar is the code of the calendar of the tenant's business
+	// days, used to date-check documents and run business-hours escalation;
+	// nil does neither
+	HolidayCalendar *string `json:"holiday_calendar"`
+
+	// AllowImpersonation is the tenant's consent to support staff signing
+	// in as its users
+	AllowImpersonation bool `json:"allow_impersonation"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Taxonomy returns the tenant's risk taxonomy or the default one
+func (t *Tenant) Taxonomy() *RiskTaxonomy {
+	if t.RiskTaxonomy == nil {
+		return DefaultRiskTaxonomy()
+	}
+	return t.RiskTaxonomy
+}
+
+// Dispositions returns the tenant's disposition taxonomy or the default one
+func (t *Tenant) Dispositions() *DispositionTaxonomy {
+	if t.DispositionTaxonomy == nil {
+		return DefaultDispositionTaxonomy()
+	}
+	return t.DispositionTaxonomy
+}
+
+const tenantColumns = `id, slug, name, risk_taxonomy, storage_region, escalation_chain, disposition_taxonomy, document_fields, approval_policy, channel_weights, velocity_rules, language, time_zone, base_currency, holiday_calendar, allow_impersonation, created_at, updated_at`
+
+func scanTenant(row rowScanner) (*Tenant, error) {
+	tenant := &Tenant{}
+	err := row.Scan(&tenant.ID, &tenant.Slug, &tenant.Name, &tenant.RiskTaxonomy, &tenant.StorageRegion, &tenant.EscalationChain,
+		&tenant.DispositionTaxonomy, &tenant.DocumentFields, &tenant.ApprovalPolicy, &tenant.ChannelWeights, &tenant.VelocityRules, &tenant.Language, &tenant.TimeZone, &tenant.BaseCurrency, &tenant.HolidayCalendar, &tenant.AllowImpersonation, &tenant.CreatedAt, &tenant.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return tenant, nil
+}
+
+// Tenant operations
+func (d *DatabaseService) CreateTenant(tenant *Tenant) error {
+	query := `
+		INSERT INTO tenants (slug, name, risk_taxonomy, storage_region) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at`
+
+	return d.db.QueryRow(query, tenant.Slug, tenant.Name, tenant.RiskTaxonomy, tenant.StorageRegion).Scan(&tenant.ID, &tenant.CreatedAt, &tenant.UpdatedAt)
+}
+
+func (d *DatabaseService) GetTenant(id string) (*Tenant, error) {
+	return scanTenant(d.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE id = $1`, id))
+}
+
+func (d *DatabaseService) GetTenantBySlug(slug string) (*Tenant, error) {
+	return scanTenant(d.db.QueryRow(`SELECT `+tenantColumns+` FROM tenants WHERE slug = $1`, slug))
+}
+
+// UpdateTenantRiskTaxonomy replaces the tenant's taxonomy; nil restores the
+// default. It returns sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantRiskTaxonomy(id string, taxonomy *RiskTaxonomy) error {
+	if taxonomy != nil {
+		if err := taxonomy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	result, err := d.db.Exec(`UPDATE tenants SET risk_taxonomy = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, taxonomy)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateTenantLanguage sets the language the tenant's users read messages
+// in; nil restores the server's default. It returns sql.ErrNoRows when
+// there is no such tenant.
+func (d *DatabaseService) UpdateTenantLanguage(id string, language *string) error {
+	result, err := d.db.Exec(`UPDATE tenants SET language = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, language)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateTenantTimeZone sets the time zone the tenant's reports are bucketed
+// in; nil reports in UTC. It returns sql.ErrNoRows when there is no such
+// tenant.
+func (d *DatabaseService) UpdateTenantTimeZone(id string, timeZone *string) error {
+	result, err := d.db.Exec(`UPDATE tenants SET time_zone = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, timeZone)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateTenantStorageRegion pins the tenant's future uploads to region; nil
+// restores the default region. Files already uploaded stay where they are.
+// It returns sql.ErrNoRows when there is no such tenant.
+func (d *DatabaseService) UpdateTenantStorageRegion(id string, region *string) error {
+	result, err := d.db.Exec(`UPDATE tenants SET storage_region = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, region)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
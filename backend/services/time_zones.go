@@ -0,0 +1,62 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// quarterHourLayout is how the UTC quarter hours stats are grouped by are
+// written, in both dialects
+const quarterHourLayout = "2006-01-02 15:04:05"
+
+// LoadTimeZone returns the IANA time zone, such as Europe/Berlin, reports
+// are bucketed in. Local is refused, so no report depends on the server's
+// own zone.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
+// Location returns the time zone the tenant reports in, or UTC
+func (t *Tenant) Location() *time.Location {
+	if t.TimeZone != nil {
+		if loc, err := LoadTimeZone(*t.TimeZone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// StartOfDay returns midnight in loc of the day t falls on there
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// periodOf returns the day or week, in loc, a UTC quarter hour falls in, as
+// YYYY-MM-DD; weeks start on Monday
+func periodOf(quarterHour string, loc *time.Location, interval string) (string, error) {
+	t, err := time.ParseInLocation(quarterHourLayout, quarterHour, time.UTC)
+	if err != nil {
+		return "", fmt.Errorf("failed to read quarter hour %q: %v", quarterHour, err)
+	}
+	day := StartOfDay(t, loc)
+	if interval == StatsIntervalWeek {
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day.Format("2006-01-02"), nil
+}
+
+// utcQuarterHour is the SQL expression of the UTC quarter hour a TIMESTAMP
+// column falls in, written in quarterHourLayout. Time zones are offset from
+// UTC by whole quarter hours, so counts grouped by it are bucketed exactly
+// into the days of any zone. Postgres reads timestamps in the database's
+// time zone; SQLite stores them in UTC.
+func (d dialect) utcQuarterHour(column string) string {
+	if d == dialectSQLite {
+		return `strftime('%Y-%m-%d %H:', ` + column + `) || printf('%02d', CAST(strftime('%M', ` + column + `) AS INTEGER) / 15 * 15) || ':00'`
+	}
+	return `to_char(utc_quarter_hour(` + column + `), 'YYYY-MM-DD HH24:MI:SS')`
+}
@@ -0,0 +1,14 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// TokenDigest is the SHA-256 a secret token is stored and looked up by, so
+// the database never holds the token itself. Auditor tokens, impersonation
+// tokens and API keys are all kept this way.
+func TokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package services
+
+import "time"
+
+// User roles
+const (
+	RoleUser    = "user"
+	RoleAnalyst = "analyst"
+	RoleAdmin   = "admin"
+)
+
+type User struct {
+	ID           string  `json:"id"`
+	TenantID     *string `json:"tenant_id"`
+	Email        string  `json:"email"`
+	PasswordHash string  `json:"-"`
+	FirstName    string  `json:"first_name"`
+	LastName     string  `json:"last_name"`
+	Role         string  `json:"role"`
+	// Language is the language the user reads messages in; nil uses their
+	// tenant's
+	Language  *string   `json:"language"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const userColumns = `id, tenant_id, email, password_hash, first_name, last_name, role, language, created_at, updated_at`
+
+func scanUser(row rowScanner) (*User, error) {
+	user := &User{}
+	err := row.Scan(&user.ID, &user.TenantID, &user.Email, &user.PasswordHash,
+		&user.FirstName, &user.LastName, &user.Role, &user.Language, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// User operations
+func (d *DatabaseService) CreateUser(user *User) error {
+	query := `
+		INSERT INTO users (tenant_id, email, password_hash, first_name, last_name, role)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at`
+
+	return d.db.QueryRow(
+		query,
+		user.TenantID, user.Email, user.PasswordHash, user.FirstName, user.LastName, user.Role,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+}
+
+func (d *DatabaseService) GetUserByEmail(email string) (*User, error) {
+	return scanUser(d.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = $1`, email))
+}
+
+// GetUser returns the user with the ID. It returns sql.ErrNoRows when there
+// is no such user.
+func (d *DatabaseService) GetUser(id string) (*User, error) {
+	return scanUser(d.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = $1`, id))
+}
+
+// UpdateUserRole changes a user's role and returns the user with the role
+// they had before. It returns sql.ErrNoRows when there is no such user.
+func (d *DatabaseService) UpdateUserRole(id, role string) (*User, string, error) {
+	var user *User
+	var previous string
+	err := withRetry("update_user_role", func() error {
+		var err error
+		user, previous, err = d.updateUserRole(id, role)
+		return err
+	})
+	return user, previous, err
+}
+
+func (d *DatabaseService) updateUserRole(id, role string) (*User, string, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	query := `SELECT role FROM users WHERE id = $1`
+	if d.db.dialect != dialectSQLite {
+		query += ` FOR UPDATE`
+	}
+	if err := tx.QueryRow(query, id).Scan(&previous); err != nil {
+		return nil, "", err
+	}
+
+	user, err := scanUser(tx.QueryRow(`
+		UPDATE users SET role = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+		RETURNING `+userColumns, id, role))
+	if err != nil {
+		return nil, "", err
+	}
+	return user, previous, tx.Commit()
+}
+
+// UpdateUserLanguage sets the language a user reads messages in; nil
+// leaves it to their tenant. It returns sql.ErrNoRows when there is no such
+// user.
+func (d *DatabaseService) UpdateUserLanguage(id string, language *string) (*User, error) {
+	return scanUser(d.db.QueryRow(`
+		UPDATE users SET language = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1
+		RETURNING `+userColumns, id, language))
+}
@@ -0,0 +1,395 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PatternTypeVelocitySpike is recorded for documents that took a user, a
+// vendor or the tenant over one of its tenant's velocity rules
+const PatternTypeVelocitySpike = "velocity_spike"
+
+// Groups a velocity rule may count by. Any other group_by names a metadata
+// field, such as vendor.
+const (
+	VelocityGroupUser   = "user"
+	VelocityGroupTenant = "tenant"
+)
+
+// velocityBuckets is the number of buckets a rule's window is counted in.
+// Documents are counted in the bucket of their upload time, so windows are
+// accurate to a bucket.
+const velocityBuckets = 24
+
+// maxVelocityRules bounds the rules of a tenant, each of which costs a
+// counter update per document
+const maxVelocityRules = 20
+
+// Confidence of velocity detections: just over a limit is a spike worth a
+// look, twice the limit is rarely innocent
+const (
+	velocityBaseConfidence = 0.5
+	velocityMaxConfidence  = 0.95
+)
+
+// VelocityRule flags documents once the documents, or the total amount, of
+// their group within the window exceed the rule's limits. Documents of
+// DocumentType, or of every type when it is empty, are counted.
+type VelocityRule struct {
+	Name          string  `json:"name"`
+	GroupBy       string  `json:"group_by"`
+	DocumentType  string  `json:"document_type,omitempty"`
+	WindowMinutes int     `json:"window_minutes"`
+	MaxDocuments  int     `json:"max_documents,omitempty"`
+	MaxAmount     float64 `json:"max_amount,omitempty"`
+	AmountField   string  `json:"amount_field,omitempty"`
+}
+
+// Window returns how far back the rule counts
+func (r VelocityRule) Window() time.Duration {
+	return time.Duration(r.WindowMinutes) * time.Minute
+}
+
+// BucketWidth returns the width of the buckets the rule counts in, at least
+// a minute
+func (r VelocityRule) BucketWidth() time.Duration {
+	width := (r.Window() / velocityBuckets).Truncate(time.Minute)
+	if width < time.Minute {
+		width = time.Minute
+	}
+	return width
+}
+
+// Group returns the value documents are grouped by, or "" when the document
+// is not counted by the rule
+func (r VelocityRule) Group(document *Document) string {
+	if r.DocumentType != "" && (document.DocumentType == nil || *document.DocumentType != r.DocumentType) {
+		return ""
+	}
+	switch r.GroupBy {
+	case VelocityGroupUser:
+		if document.UserID == nil {
+			return ""
+		}
+		return *document.UserID
+	case VelocityGroupTenant:
+		if document.TenantID == nil {
+			return ""
+		}
+		return *document.TenantID
+	}
+	switch value := document.Metadata[r.GroupBy].(type) {
+	case string:
+		return strings.ToLower(strings.TrimSpace(value))
+	case float64, bool:
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+// Amount returns the document's amount in its tenant's base currency, 0
+// when it has none or it could not be converted
+func (r VelocityRule) Amount(amounts DocumentAmounts) float64 {
+	field := r.AmountField
+	if field == "" {
+		field = defaultAmountField
+	}
+	return amounts.Base(field)
+}
+
+// VelocityRules are a tenant's velocity rules
+type VelocityRules []VelocityRule
+
+// VelocityRulesError lists the problems found in velocity rules
+type VelocityRulesError struct {
+	Problems []string
+}
+
+func (e *VelocityRulesError) Error() string {
+	return "invalid velocity rules: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks that rules are uniquely named, count by a known group or
+// a metadata field, and have a window and at least one limit
+func (rules VelocityRules) Validate() error {
+	var problems []string
+	if len(rules) > maxVelocityRules {
+		problems = append(problems, fmt.Sprintf("at most %d rules are allowed", maxVelocityRules))
+	}
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		switch {
+		case strings.TrimSpace(rule.Name) == "":
+			problems = append(problems, fmt.Sprintf("rules[%d].name is required", i))
+		case len(rule.Name) > 100:
+			problems = append(problems, fmt.Sprintf("rules[%d].name must be at most 100 characters", i))
+		case seen[rule.Name]:
+			problems = append(problems, fmt.Sprintf("rules[%d].name %q is repeated", i, rule.Name))
+		}
+		seen[rule.Name] = true
+
+		if rule.GroupBy != VelocityGroupUser && rule.GroupBy != VelocityGroupTenant && !metadataKeyPattern.MatchString(rule.GroupBy) {
+			problems = append(problems, fmt.Sprintf("rules[%d].group_by must be user, tenant or a metadata key", i))
+		}
+		if rule.WindowMinutes <= 0 {
+			problems = append(problems, fmt.Sprintf("rules[%d].window_minutes must be positive", i))
+		}
+		if rule.MaxDocuments < 0 || rule.MaxAmount < 0 {
+			problems = append(problems, fmt.Sprintf("rules[%d] limits must not be negative", i))
+		}
+		if rule.MaxDocuments == 0 && rule.MaxAmount == 0 {
+			problems = append(problems, fmt.Sprintf("rules[%d] needs max_documents or max_amount", i))
+		}
+		if rule.AmountField != "" && !metadataKeyPattern.MatchString(rule.AmountField) {
+			problems = append(problems, fmt.Sprintf("rules[%d].amount_field %q is not a metadata key", i, rule.AmountField))
+		}
+	}
+	if len(problems) > 0 {
+		return &VelocityRulesError{Problems: problems}
+	}
+	return nil
+}
+
+func (rules VelocityRules) Value() (driver.Value, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal([]VelocityRule(rules))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (rules *VelocityRules) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*rules = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, rules)
+	case string:
+		return json.Unmarshal([]byte(v), rules)
+	default:
+		return fmt.Errorf("unsupported velocity rules type %T", src)
+	}
+}
+
+// VelocityCount is one document counted by a velocity rule, in the bucket
+// of its upload time
+type VelocityCount struct {
+	DocumentID DocumentID
+	TenantID   string
+	Rule       string
+	Group      string
+	Bucket     time.Time
+	Amount     float64
+}
+
+// VelocityWindow is what a rule counted for a group within the window
+// ending with a document's bucket
+type VelocityWindow struct {
+	Start     time.Time
+	End       time.Time
+	Documents int
+	Amount    float64
+}
+
+// NewVelocityCount places a document, with its amounts converted into its
+// tenant's base currency, in the rule's bucket of its upload time. It
+// returns nil when the rule does not count the document.
+func NewVelocityCount(rule VelocityRule, document *Document, amounts DocumentAmounts) *VelocityCount {
+	group := rule.Group(document)
+	if group == "" || document.TenantID == nil {
+		return nil
+	}
+	return &VelocityCount{
+		DocumentID: document.ID,
+		TenantID:   *document.TenantID,
+		Rule:       rule.Name,
+		Group:      group,
+		Bucket:     document.CreatedAt.UTC().Truncate(rule.BucketWidth()),
+		Amount:     rule.Amount(amounts),
+	}
+}
+
+// WindowStart returns the first bucket of the window ending with count's
+func (c *VelocityCount) WindowStart(rule VelocityRule) time.Time {
+	return c.Bucket.Add(rule.BucketWidth() - rule.Window())
+}
+
+// Check compares what the rule counted within a window with its limits. It
+// returns nil while the window is within them.
+func (r VelocityRule) Check(window *VelocityWindow, group string) *RiskFactor {
+	ratio := 0.0
+	var exceeded []string
+	if r.MaxDocuments > 0 && window.Documents > r.MaxDocuments {
+		exceeded = append(exceeded, "max_documents")
+		ratio = math.Max(ratio, float64(window.Documents)/float64(r.MaxDocuments))
+	}
+	if r.MaxAmount > 0 && window.Amount > r.MaxAmount {
+		exceeded = append(exceeded, "max_amount")
+		ratio = math.Max(ratio, window.Amount/r.MaxAmount)
+	}
+	if len(exceeded) == 0 {
+		return nil
+	}
+
+	details := Metadata{
+		"rule":         r.Name,
+		"group_by":     r.GroupBy,
+		"group":        group,
+		"exceeded":     exceeded,
+		"window_start": window.Start,
+		"window_end":   window.End,
+		"documents":    window.Documents,
+		"amount":       window.Amount,
+	}
+	if r.MaxDocuments > 0 {
+		details["max_documents"] = r.MaxDocuments
+	}
+	if r.MaxAmount > 0 {
+		details["max_amount"] = r.MaxAmount
+	}
+	return &RiskFactor{
+		PatternType: PatternTypeVelocitySpike,
+		Confidence:  math.Min(velocityMaxConfidence, velocityBaseConfidence+(ratio-1)*velocityBaseConfidence),
+		Details:     details,
+	}
+}
+
+// CountVelocity adds the document to its bucket, unless the rule counted it
+// before, and returns the rule's window for the group ending with the
+// document's bucket. Buckets older than the previous window are dropped, so
+// counters stay as small as the windows while late documents still count.
+func (d *DatabaseService) CountVelocity(rule VelocityRule, count *VelocityCount) (*VelocityWindow, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO velocity_events (document_id, rule_name, group_key, bucket_start, amount)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING`,
+		count.DocumentID, count.Rule, count.Group, d.db.dialect.timeArg(count.Bucket), count.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record velocity event: %v", err)
+	}
+	start := count.WindowStart(rule)
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		_, err = tx.Exec(`
+			INSERT INTO velocity_counters (tenant_id, rule_name, group_key, bucket_start, documents, amount)
+			VALUES ($1, $2, $3, $4, 1, $5)
+			ON CONFLICT (tenant_id, rule_name, group_key, bucket_start)
+			DO UPDATE SET documents = velocity_counters.documents + 1, amount = velocity_counters.amount + excluded.amount`,
+			count.TenantID, count.Rule, count.Group, d.db.dialect.timeArg(count.Bucket), count.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count velocity: %v", err)
+		}
+		_, err = tx.Exec(`
+			DELETE FROM velocity_counters
+			WHERE tenant_id = $1 AND rule_name = $2 AND group_key = $3 AND bucket_start < $4`,
+			count.TenantID, count.Rule, count.Group, d.db.dialect.timeArg(start.Add(-rule.Window())))
+		if err != nil {
+			return nil, fmt.Errorf("failed to prune velocity counters: %v", err)
+		}
+	}
+
+	window := &VelocityWindow{Start: start, End: count.Bucket.Add(rule.BucketWidth())}
+	var amount sql.NullFloat64
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(documents), 0), SUM(amount) FROM velocity_counters
+		WHERE tenant_id = $1 AND rule_name = $2 AND group_key = $3 AND bucket_start >= $4 AND bucket_start <= $5`,
+		count.TenantID, count.Rule, count.Group, d.db.dialect.timeArg(start), d.db.dialect.timeArg(count.Bucket),
+	).Scan(&window.Documents, &amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum velocity window: %v", err)
+	}
+	window.Amount = amount.Float64
+	return window, tx.Commit()
+}
+
+// StaleVelocityRules returns the names of the rules of old that are not in
+// rules unchanged, whose counts no longer apply
+func StaleVelocityRules(old, rules VelocityRules) []string {
+	var stale []string
+	for _, before := range old {
+		kept := false
+		for _, rule := range rules {
+			if rule == before {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			stale = append(stale, before.Name)
+		}
+	}
+	return stale
+}
+
+// UpdateTenantVelocityRules replaces the tenant's velocity rules; nil stops
+// counting its documents. The counts of rules removed or changed are
+// dropped, so a changed rule counts from scratch. It returns sql.ErrNoRows
+// when there is no such tenant.
+func (d *DatabaseService) UpdateTenantVelocityRules(id string, rules VelocityRules) error {
+	if err := rules.Validate(); err != nil {
+		return err
+	}
+
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var old VelocityRules
+	if err := tx.QueryRow(`SELECT velocity_rules FROM tenants WHERE id = $1`, id).Scan(&old); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE tenants SET velocity_rules = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`, id, rules); err != nil {
+		return err
+	}
+
+	for _, name := range StaleVelocityRules(old, rules) {
+		if _, err := tx.Exec(`DELETE FROM velocity_counters WHERE tenant_id = $1 AND rule_name = $2`, id, name); err != nil {
+			return fmt.Errorf("failed to drop velocity counters: %v", err)
+		}
+		_, err := tx.Exec(`
+			DELETE FROM velocity_events
+			WHERE rule_name = $2 AND document_id IN (SELECT id FROM documents WHERE tenant_id = $1)`, id, name)
+		if err != nil {
+			return fmt.Errorf("failed to drop velocity events: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// CombineVelocityFactors merges the factors of the rules a document broke
+// into one, as a document holds one detection per pattern. It takes the
+// highest confidence and lists every rule's window, the highest first.
+func CombineVelocityFactors(factors []*RiskFactor) *RiskFactor {
+	if len(factors) == 0 {
+		return nil
+	}
+	sort.SliceStable(factors, func(i, j int) bool {
+		return factors[i].Confidence > factors[j].Confidence
+	})
+	windows := make([]Metadata, len(factors))
+	for i, factor := range factors {
+		windows[i] = factor.Details
+	}
+	return &RiskFactor{
+		PatternType: PatternTypeVelocitySpike,
+		Confidence:  factors[0].Confidence,
+		Details:     Metadata{"windows": windows},
+	}
+}
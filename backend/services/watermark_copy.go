@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCannotWatermark is returned for files no watermarked copy can be made
+// of
+var ErrCannotWatermark = errors.New("no watermarked copy can be made of the file")
+
+// DownloadWatermarkText is the stamp of a reviewer's download, naming the
+// case it was downloaded for when there is one. Copies made the same day
+// for the same reviewer and case carry the same stamp.
+func DownloadWatermarkText(user *User, at time.Time, caseID string) string {
+	name := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if name == "" {
+		name = user.Email
+	} else if user.Email != "" {
+		name += " <" + user.Email + ">"
+	}
+	text := fmt.Sprintf("Downloaded by %s on %s", name, at.UTC().Format("2006-01-02"))
+	if caseID != "" {
+		text += " for case " + caseID
+	}
+	return text
+}
+
+// WatermarkSource is a file to make a watermarked copy of
+type WatermarkSource struct {
+	Filename string
+	MimeType string
+	Content  []byte
+	// ExtractedText is typeset for files that are neither PDFs, images nor
+	// plain text
+	ExtractedText string
+}
+
+// WatermarkedPDF returns a PDF copy of a file with text stamped on every
+// page. PDFs are stamped as they are, JPEG, PNG and GIF images are put on a
+// page and plain text is typeset. Other files are typeset from their
+// extracted text, and without one are refused with ErrCannotWatermark.
+func WatermarkedPDF(src WatermarkSource, text string) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(src.MimeType)
+	var pdf []byte
+	switch {
+	case mediaType == "application/pdf":
+		pdf = src.Content
+	case mediaType == "image/jpeg" || mediaType == "image/png" || mediaType == "image/gif":
+		var err error
+		if pdf, err = imagePDF(src.Content); err != nil {
+			return nil, err
+		}
+	case mediaType == "text/plain":
+		w := newPDFWriter(Localizer{})
+		w.Heading(src.Filename, 12)
+		w.Paragraph(string(src.Content))
+		pdf = w.Bytes()
+	case strings.TrimSpace(src.ExtractedText) != "":
+		w := newPDFWriter(Localizer{})
+		w.Heading("Text extracted from "+src.Filename, 12)
+		w.Paragraph(src.ExtractedText)
+		pdf = w.Bytes()
+	default:
+		return nil, ErrCannotWatermark
+	}
+	return StampPDF(pdf, text)
+}
+
+// imagePDF puts an image on an A4 page, turned to the image's orientation
+// and scaled down to fit the margins. JPEGs are embedded as they are;
+// other images are decoded onto white.
+func imagePDF(content []byte) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return nil, fmt.Errorf("%w: unreadable image", ErrCannotWatermark)
+	}
+
+	var img *pdfImage
+	switch {
+	case format == "jpeg" && config.ColorModel == color.YCbCrModel:
+		img = &pdfImage{width: config.Width, height: config.Height, colorSpace: "/DeviceRGB", filter: "/DCTDecode", data: content}
+	case format == "jpeg" && config.ColorModel == color.GrayModel:
+		img = &pdfImage{width: config.Width, height: config.Height, colorSpace: "/DeviceGray", filter: "/DCTDecode", data: content}
+	default:
+		decoded, _, err := image.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%w: unreadable image", ErrCannotWatermark)
+		}
+		img = pdfImageOf(decoded, 0)
+	}
+
+	pageWidth, pageHeight := pdfPageWidth, pdfPageHeight
+	if config.Width > config.Height {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+	width, height := float64(config.Width), float64(config.Height)
+	scale := min(1, (pageWidth-2*pdfMargin)/width, (pageHeight-2*pdfMargin)/height)
+	width, height = width*scale, height*scale
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [3 0 R] /Count 1 >>")
+	object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /XObject << /Im1 5 0 R >> >> /Contents 4 0 R >>",
+		pageWidth, pageHeight))
+	draw := fmt.Sprintf("q %.2f 0 0 %.2f %.2f %.2f cm /Im1 Do Q\n", width, height, (pageWidth-width)/2, (pageHeight-height)/2)
+	object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(draw), draw))
+	object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s /Length %d >>\nstream\n%s\nendstream",
+		img.width, img.height, img.colorSpace, img.filter, len(img.data), img.data))
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// WatermarkCacheKey identifies the copy of a file's content made with a
+// stamp
+func WatermarkCacheKey(contentKey, text string) string {
+	sum := sha256.Sum256([]byte(contentKey + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// WatermarkCache keeps the watermarked copies made lately in memory, up to
+// maxBytes, so downloading a document again the same day for the same case
+// does not stamp it again. Copies older than ttl are made anew, and the
+// least recently used go first when the cache is full. A cache without
+// room or ttl keeps nothing.
+type WatermarkCache struct {
+	maxBytes int64
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	size    int64
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type watermarkCacheEntry struct {
+	key      string
+	content  []byte
+	storedAt time.Time
+}
+
+func NewWatermarkCache(maxBytes int64, ttl time.Duration) *WatermarkCache {
+	return &WatermarkCache{maxBytes: maxBytes, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// Get returns the copy cached under key
+func (c *WatermarkCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*watermarkCacheEntry)
+	if time.Since(entry.storedAt) >= c.ttl {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.content, true
+}
+
+// Put caches a copy under key, unless it is larger than the whole cache
+func (c *WatermarkCache) Put(key string, content []byte) {
+	size := int64(len(content))
+	if c.ttl <= 0 || size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	for c.size+size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	c.entries[key] = c.order.PushFront(&watermarkCacheEntry{key: key, content: content, storedAt: time.Now()})
+	c.size += size
+}
+
+func (c *WatermarkCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*watermarkCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.content))
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"frauddocai-backend/config"
+)
+
+// Administrative webhook event types
+const (
+	WebhookUserCreated     = "user.created"
+	WebhookUserRoleChanged = "user.role_changed"
+	WebhookRetentionPurged = "retention.purge_completed"
+	WebhookReviewDelegated = "review.delegated"
+	WebhookAlertAssigned   = "alert.assigned"
+	WebhookApprovalNeeded  = "approval.requested"
+	WebhookApprovalDecided = "approval.decided"
+	WebhookAlertEscalated  = "alert.escalated"
+	WebhookTenantSignedUp  = "tenant.signed_up"
+	WebhookModelDrifted    = "model.drift_detected"
+)
+
+const (
+	webhookEventHeader     = "X-FraudDocAI-Event"
+	webhookDeliveryHeader  = "X-FraudDocAI-Delivery"
+	webhookSignatureHeader = "X-FraudDocAI-Signature"
+
+	// webhookErrorDetail bounds the response body kept as the error
+	webhookErrorDetail = 200
+)
+
+// WebhookEvent is an event waiting in, or delivered from, the webhook outbox
+type WebhookEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	TenantID  *string         `json:"tenant_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	Attempts  int             `json:"-"`
+	// AlertID is the alert the event notifies about, if any. It is not part
+	// of the delivered event, whose data names the alert.
+	AlertID     *string    `json:"-"`
+	DeliveredAt *time.Time `json:"-"`
+	FailedAt    *time.Time `json:"-"`
+}
+
+// CreateWebhookEvent adds an event to the outbox for delivery
+func (d *DatabaseService) CreateWebhookEvent(event *WebhookEvent) error {
+	return d.db.QueryRow(`
+		INSERT INTO webhook_events (event_type, tenant_id, data, alert_id) VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		event.Type, event.TenantID, string(event.Data), event.AlertID,
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+// GetPendingWebhookEvents returns up to limit undelivered events due for an
+// attempt at now, oldest first
+func (d *DatabaseService) GetPendingWebhookEvents(now time.Time, limit int) ([]*WebhookEvent, error) {
+	rows, err := d.db.Query(`
+		SELECT id, event_type, tenant_id, data, attempts, created_at FROM webhook_events
+		WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= $1
+		ORDER BY next_attempt_at, id LIMIT $2`, d.db.dialect.timeArg(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []*WebhookEvent
+	for rows.Next() {
+		event := &WebhookEvent{}
+		var data string
+		if err := rows.Scan(&event.ID, &event.Type, &event.TenantID, &data, &event.Attempts, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook event: %v", err)
+		}
+		event.Data = json.RawMessage(data)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// MarkWebhookEventDelivered records a successful delivery
+func (d *DatabaseService) MarkWebhookEventDelivered(id int64) error {
+	_, err := d.db.Exec(`
+		UPDATE webhook_events SET attempts = attempts + 1, last_error = NULL, delivered_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id)
+	return err
+}
+
+// RetryWebhookEvent records a failed delivery to be tried again at next
+func (d *DatabaseService) RetryWebhookEvent(id int64, next time.Time, lastError string) error {
+	_, err := d.db.Exec(`
+		UPDATE webhook_events SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+		WHERE id = $1`, id, lastError, d.db.dialect.timeArg(next))
+	return err
+}
+
+// FailWebhookEvent records the last failed delivery of an event given up on
+func (d *DatabaseService) FailWebhookEvent(id int64, lastError string) error {
+	_, err := d.db.Exec(`
+		UPDATE webhook_events SET attempts = attempts + 1, last_error = $2, failed_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id, lastError)
+	return err
+}
+
+// GetAlertWebhookEvents returns the events about an alert, oldest first,
+// whether delivered, pending or given up on
+func (d *DatabaseService) GetAlertWebhookEvents(alertID string) ([]*WebhookEvent, error) {
+	rows, err := d.db.Query(`
+		SELECT id, event_type, tenant_id, data, attempts, alert_id, delivered_at, failed_at, created_at
+		FROM webhook_events WHERE alert_id = $1 ORDER BY created_at, id`, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook events: %v", err)
+	}
+	defer rows.Close()
+
+	var events []*WebhookEvent
+	for rows.Next() {
+		event := &WebhookEvent{}
+		var data string
+		if err := rows.Scan(&event.ID, &event.Type, &event.TenantID, &data, &event.Attempts, &event.AlertID,
+			&event.DeliveredAt, &event.FailedAt, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook event: %v", err)
+		}
+		event.Data = json.RawMessage(data)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// Webhooks delivers events to the configured endpoint. The body is the
+// event as JSON, signed with HMAC-SHA256 of the secret in
+// X-FraudDocAI-Signature as sha256=<hex> when a secret is set.
+type Webhooks struct {
+	cfg    config.WebhookConfig
+	events map[string]bool
+	client *http.Client
+}
+
+func NewWebhooks(cfg config.WebhookConfig) *Webhooks {
+	events := make(map[string]bool, len(cfg.Events))
+	for _, event := range cfg.Events {
+		events[event] = true
+	}
+	return &Webhooks{cfg: cfg, events: events, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Enabled reports whether a webhook URL is configured
+func (w *Webhooks) Enabled() bool {
+	return w.cfg.URL != ""
+}
+
+// Wants reports whether events of the type are delivered
+func (w *Webhooks) Wants(eventType string) bool {
+	return w.Enabled() && (len(w.events) == 0 || w.events[eventType])
+}
+
+// Interval is how often the outbox is scanned for events to deliver
+func (w *Webhooks) Interval() time.Duration {
+	return w.cfg.Interval
+}
+
+// MaxAttempts is how often an event is tried before it is given up
+func (w *Webhooks) MaxAttempts() int {
+	return w.cfg.MaxAttempts
+}
+
+// Deliver posts the event to the webhook URL. Any response other than 2xx
+// is an error.
+func (w *Webhooks) Deliver(ctx context.Context, event *WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event.Type)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(event.ID, 10))
+	if w.cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.cfg.Secret))
+		mac.Write(body)
+		req.Header.Set(webhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, webhookErrorDetail))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,327 @@
+package services
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxReplayDocuments bounds the documents a what-if replays
+const MaxReplayDocuments = 10000
+
+// maxReplayChanges bounds the document IDs a what-if lists as newly or no
+// longer flagged
+const maxReplayChanges = 100
+
+// ReplayDocument is a document as a what-if replays it: the document with
+// its converted amounts, the channel it was submitted through and the
+// pattern types detected on it
+type ReplayDocument struct {
+	Document   *Document
+	Amounts    DocumentAmounts
+	Channel    string
+	Detections []string
+}
+
+// RuleSet is what decides a tenant's detections and risk levels. Active
+// maps the pattern types whose detections are recorded.
+type RuleSet struct {
+	RiskTaxonomy   *RiskTaxonomy
+	ApprovalPolicy *ApprovalPolicy
+	ChannelWeights ChannelWeights
+	VelocityRules  VelocityRules
+	Active         map[string]bool
+}
+
+// ReplayOutcome counts what a rule set produced over the replayed
+// documents
+type ReplayOutcome struct {
+	Detections       map[string]int `json:"detections"`
+	TotalDetections  int            `json:"total_detections"`
+	FlaggedDocuments int            `json:"flagged_documents"`
+	RiskLevels       map[string]int `json:"risk_levels"`
+
+	flagged map[DocumentID]bool
+}
+
+// ReplayReport compares the current rule set with a candidate over the
+// same documents
+type ReplayReport struct {
+	Documents       int               `json:"documents"`
+	Current         *ReplayOutcome    `json:"current"`
+	Candidate       *ReplayOutcome    `json:"candidate"`
+	Difference      *ReplayDifference `json:"difference"`
+	NewlyFlagged    []DocumentID      `json:"newly_flagged"`
+	NoLongerFlagged []DocumentID      `json:"no_longer_flagged"`
+}
+
+// ReplayDifference is what the candidate rule set produced over the current
+// one; negative counts are fewer
+type ReplayDifference struct {
+	Detections       map[string]int `json:"detections"`
+	TotalDetections  int            `json:"total_detections"`
+	FlaggedDocuments int            `json:"flagged_documents"`
+}
+
+// Rules returns the tenant's rule set, with active the pattern types of the
+// active fraud patterns
+func (t *Tenant) Rules(active map[string]bool) *RuleSet {
+	return &RuleSet{
+		RiskTaxonomy:   t.Taxonomy(),
+		ApprovalPolicy: t.ApprovalPolicy,
+		ChannelWeights: t.ChannelWeights,
+		VelocityRules:  t.VelocityRules,
+		Active:         active,
+	}
+}
+
+// GetReplayDocuments returns the tenant's documents uploaded since a time,
+// oldest first and at most limit of them
+func (d *DatabaseService) GetReplayDocuments(tenantID string, since time.Time, limit int) ([]*ReplayDocument, error) {
+	rows, err := d.db.Query(`
+		SELECT `+documentColumns+`,
+			(SELECT channel FROM document_submissions s WHERE s.document_id = documents.id)
+		FROM documents
+		WHERE tenant_id = $1 AND created_at >= $2 AND deleted_at IS NULL
+		ORDER BY created_at, id
+		LIMIT $3`, tenantID, d.db.dialect.timeArg(since), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query documents: %v", err)
+	}
+	defer rows.Close()
+
+	var documents []*ReplayDocument
+	byID := map[DocumentID]*ReplayDocument{}
+	for rows.Next() {
+		var channel *string
+		document, err := scanDocument(rows, &channel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan document: %v", err)
+		}
+		replay := &ReplayDocument{Document: document}
+		if channel != nil {
+			replay.Channel = *channel
+		}
+		documents = append(documents, replay)
+		byID[document.ID] = replay
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.db.Query(`
+		SELECT f.document_id, p.pattern_type
+		FROM document_fraud_detections f
+		JOIN fraud_patterns p ON p.id = f.fraud_pattern_id
+		JOIN documents ON documents.id = f.document_id
+		WHERE documents.tenant_id = $1 AND documents.created_at >= $2 AND documents.deleted_at IS NULL`, tenantID, d.db.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query detections: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id DocumentID
+		var patternType string
+		if err := rows.Scan(&id, &patternType); err != nil {
+			return nil, err
+		}
+		if replay := byID[id]; replay != nil {
+			replay.Detections = append(replay.Detections, patternType)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = d.db.Query(`
+		SELECT a.document_id, a.field, a.amount, a.currency, a.base_amount, a.base_currency, a.rate, CAST(a.rate_day AS TEXT)
+		FROM document_amounts a
+		JOIN documents ON documents.id = a.document_id
+		WHERE documents.tenant_id = $1 AND documents.created_at >= $2 AND documents.deleted_at IS NULL`, tenantID, d.db.dialect.timeArg(since))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document amounts: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id DocumentID
+		amount := &DocumentAmount{}
+		if err := rows.Scan(&id, &amount.Field, &amount.Amount, &amount.Currency, &amount.BaseAmount, &amount.BaseCurrency,
+			&amount.Rate, &amount.RateDay); err != nil {
+			return nil, err
+		}
+		if replay := byID[id]; replay != nil {
+			replay.Amounts = append(replay.Amounts, amount)
+		}
+	}
+	return documents, rows.Err()
+}
+
+// ReplayRules replays documents, oldest first, against the current rule set
+// and a candidate. The approval policy and velocity rules are evaluated
+// again; velocity windows start empty at the first document. Other
+// detections are taken as recorded, for the pattern types each set keeps
+// active. Risk levels come from the documents' scores, reweighted from the
+// current channel weights to the candidate's.
+func ReplayRules(documents []*ReplayDocument, current, candidate *RuleSet) *ReplayReport {
+	report := &ReplayReport{
+		Documents:       len(documents),
+		Current:         replayRuleSet(documents, current, current),
+		Candidate:       replayRuleSet(documents, current, candidate),
+		NewlyFlagged:    []DocumentID{},
+		NoLongerFlagged: []DocumentID{},
+	}
+
+	report.Difference = &ReplayDifference{
+		Detections:       map[string]int{},
+		TotalDetections:  report.Candidate.TotalDetections - report.Current.TotalDetections,
+		FlaggedDocuments: report.Candidate.FlaggedDocuments - report.Current.FlaggedDocuments,
+	}
+	for patternType, n := range report.Candidate.Detections {
+		report.Difference.Detections[patternType] = n - report.Current.Detections[patternType]
+	}
+	for patternType, n := range report.Current.Detections {
+		if _, ok := report.Candidate.Detections[patternType]; !ok {
+			report.Difference.Detections[patternType] = -n
+		}
+	}
+	for _, replay := range documents {
+		id := replay.Document.ID
+		before, after := report.Current.flagged[id], report.Candidate.flagged[id]
+		switch {
+		case after && !before && len(report.NewlyFlagged) < maxReplayChanges:
+			report.NewlyFlagged = append(report.NewlyFlagged, id)
+		case before && !after && len(report.NoLongerFlagged) < maxReplayChanges:
+			report.NoLongerFlagged = append(report.NoLongerFlagged, id)
+		}
+	}
+	return report
+}
+
+// replayRuleSet counts what rules produce over documents, whose scores were
+// weighted by the current rule set's channel weights
+func replayRuleSet(documents []*ReplayDocument, current, rules *RuleSet) *ReplayOutcome {
+	outcome := &ReplayOutcome{
+		Detections: map[string]int{},
+		RiskLevels: map[string]int{},
+		flagged:    map[DocumentID]bool{},
+	}
+	for _, level := range rules.RiskTaxonomy.Levels {
+		outcome.RiskLevels[level.Name] = 0
+	}
+
+	// Each rule's counts by group, in upload order
+	counts := make([]map[string][]*VelocityCount, len(rules.VelocityRules))
+	for i := range counts {
+		counts[i] = map[string][]*VelocityCount{}
+	}
+
+	for _, replay := range documents {
+		document := replay.Document
+		detected := map[string]bool{}
+		for _, patternType := range replay.Detections {
+			if patternType != PatternTypeApprovalOutsidePolicy && patternType != PatternTypeVelocitySpike && rules.Active[patternType] {
+				detected[patternType] = true
+			}
+		}
+		if rules.ApprovalPolicy != nil && rules.Active[PatternTypeApprovalOutsidePolicy] &&
+			rules.ApprovalPolicy.Check(document.DocumentType, document.Metadata) != nil {
+			detected[PatternTypeApprovalOutsidePolicy] = true
+		}
+
+		var factors []*RiskFactor
+		for i, rule := range rules.VelocityRules {
+			count := NewVelocityCount(rule, document, replay.Amounts)
+			if count == nil {
+				continue
+			}
+			group := append(counts[i][count.Group], count)
+			counts[i][count.Group] = group
+			start := count.WindowStart(rule)
+			window := &VelocityWindow{Start: start, End: count.Bucket.Add(rule.BucketWidth())}
+			for _, counted := range group {
+				if !counted.Bucket.Before(start) {
+					window.Documents++
+					window.Amount += counted.Amount
+				}
+			}
+			if factor := rule.Check(window, count.Group); factor != nil {
+				factors = append(factors, factor)
+			}
+		}
+		if len(factors) > 0 && rules.Active[PatternTypeVelocitySpike] {
+			detected[PatternTypeVelocitySpike] = true
+		}
+
+		for patternType := range detected {
+			outcome.Detections[patternType]++
+			outcome.TotalDetections++
+		}
+		if len(detected) > 0 {
+			outcome.FlaggedDocuments++
+			outcome.flagged[document.ID] = true
+		}
+
+		if document.FraudScore != nil {
+			score := *document.FraudScore
+			if weight := current.ChannelWeights.Weight(replay.Channel); replay.Channel != "" && weight > 0 {
+				score = rules.ChannelWeights.Apply(score/weight, replay.Channel)
+			}
+			outcome.RiskLevels[rules.RiskTaxonomy.LevelForScore(score).Name]++
+		}
+	}
+	return outcome
+}
+
+// ActivePatternTypes returns the pattern types of the active patterns
+func ActivePatternTypes(patterns []*FraudPattern) map[string]bool {
+	active := map[string]bool{}
+	for _, pattern := range patterns {
+		if pattern.IsActive {
+			active[pattern.PatternType] = true
+		}
+	}
+	return active
+}
+
+// Rules returns the rule set of a bundle, for a what-if before it is
+// imported. The bundle's fraud patterns turn pattern types on and off;
+// types it does not list keep their state in active. Only the sections that
+// decide detections and risk levels are validated, as a *TenantConfigError.
+// The warnings name pattern types the bundle turns on whose detections
+// were never recorded, and so cannot be counted.
+func (c *TenantConfig) Rules(active map[string]bool) (*RuleSet, []string, error) {
+	var problems []string
+	if c.RiskTaxonomy != nil {
+		problems = append(problems, sectionProblems("risk_taxonomy", c.RiskTaxonomy.Validate())...)
+	}
+	if c.ApprovalPolicy != nil {
+		problems = append(problems, sectionProblems("approval_policy", c.ApprovalPolicy.Validate())...)
+	}
+	problems = append(problems, sectionProblems("channel_weights", c.ChannelWeights.Validate())...)
+	problems = append(problems, sectionProblems("velocity_rules", c.VelocityRules.Validate())...)
+	if len(problems) > 0 {
+		return nil, nil, &TenantConfigError{Problems: problems}
+	}
+
+	rules := &RuleSet{
+		RiskTaxonomy:   c.RiskTaxonomy,
+		ApprovalPolicy: c.ApprovalPolicy,
+		ChannelWeights: c.ChannelWeights,
+		VelocityRules:  c.VelocityRules,
+		Active:         map[string]bool{},
+	}
+	if rules.RiskTaxonomy == nil {
+		rules.RiskTaxonomy = DefaultRiskTaxonomy()
+	}
+	for patternType, on := range active {
+		rules.Active[patternType] = on
+	}
+	warnings := []string{}
+	for _, pattern := range c.FraudPatterns {
+		rules.Active[pattern.Type] = pattern.IsActive
+		replayed := pattern.Type == PatternTypeApprovalOutsidePolicy || pattern.Type == PatternTypeVelocitySpike
+		if pattern.IsActive && !active[pattern.Type] && !replayed {
+			warnings = append(warnings, fmt.Sprintf("fraud pattern %q is turned on; its detections were not recorded while it was off and are not counted", pattern.Name))
+		}
+	}
+	return rules, warnings, nil
+}
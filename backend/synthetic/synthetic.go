@@ -0,0 +1,318 @@
+// Package synthetic generates invoices and receipts with known fraud
+// patterns planted in them: tampered totals, invoice numbers submitted twice
+// and changed bank details. Run through the pipeline, they check that the
+// detection logic still finds what was planted, and nothing on the clean
+// documents beside them.
+package synthetic
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"frauddocai-backend/services"
+)
+
+// Checked are the pattern types planted in fixtures. A fixture must be
+// detected with exactly the checked types it was planted with.
+var Checked = []string{
+	services.PatternTypeTotalMismatch,
+	services.PatternTypeDuplicateInvoiceNumber,
+	services.PatternTypeBankDetailsChange,
+}
+
+// Fixture is a synthetic text document. Fixtures are generated in the order
+// they must be submitted: a duplicate or a change of bank details follows
+// the original it is compared with.
+type Fixture struct {
+	Name         string            `json:"name"`
+	File         string            `json:"file"`
+	DocumentType string            `json:"document_type"`
+	Metadata     services.Metadata `json:"metadata"`
+	Injected     []string          `json:"injected"`
+	Text         string            `json:"-"`
+}
+
+// Manifest describes the fixtures written by Write
+type Manifest struct {
+	Seed     int64      `json:"seed"`
+	Sets     int        `json:"sets"`
+	Checked  []string   `json:"checked"`
+	Fixtures []*Fixture `json:"fixtures"`
+}
+
+var (
+	vendorWords  = []string{"Acme", "Blue Harbor", "Crestline", "Dunmore", "Evergreen", "Fairway", "Granite", "Highgate", "Ironbridge", "Juniper", "Kestrel", "Lakeside"}
+	vendorKinds  = []string{"Supplies", "Logistics", "Consulting", "Office Solutions", "Facilities", "Print Works", "Engineering", "Catering"}
+	customers    = []string{"Northwind Traders", "Contoso Ltd", "Fabrikam Inc", "Tailspin Toys", "Wide World Importers"}
+	invoiceItems = []catalogItem{
+		{"Office chairs", 120}, {"Standing desks", 349.99}, {"Consulting hours", 150}, {"Printer toner", 64.5},
+		{"Network switches", 289}, {"Cleaning service", 420}, {"Courier deliveries", 18.75}, {"Catering platters", 95},
+	}
+	merchants    = []string{"Corner Cafe", "Station Deli", "Metro Taxis", "Harbour Hotel", "City Stationers"}
+	receiptItems = []catalogItem{
+		{"Flat white", 3.4}, {"Club sandwich", 7.95}, {"Taxi fare", 23.6}, {"Room night", 139}, {"Notebooks", 4.25}, {"Lunch menu", 14.5},
+	}
+)
+
+// Generate returns sets of fixtures drawn from seed; the same seed gives
+// the same fixtures. Each set holds a clean and a tampered invoice and
+// receipt, an invoice followed by its duplicate, and an invoice followed by
+// one from the same vendor paying into another account. Every invoice of a
+// set has its own vendor, so sets do not interfere.
+func Generate(seed int64, sets int) []*Fixture {
+	g := &generator{rnd: rand.New(rand.NewSource(seed)), vendors: map[string]bool{}}
+	var fixtures []*Fixture
+	for set := 1; set <= sets; set++ {
+		clean := g.invoice()
+		fixtures = append(fixtures, clean.fixture(fmt.Sprintf("set%d-clean-invoice", set)))
+
+		tampered := g.invoice()
+		g.tamper(&tampered.document)
+		fixtures = append(fixtures, tampered.fixture(fmt.Sprintf("set%d-tampered-invoice", set), services.PatternTypeTotalMismatch))
+
+		fixtures = append(fixtures, g.receipt().fixture(fmt.Sprintf("set%d-clean-receipt", set)))
+		tamperedReceipt := g.receipt()
+		g.tamper(&tamperedReceipt.document)
+		fixtures = append(fixtures, tamperedReceipt.fixture(fmt.Sprintf("set%d-tampered-receipt", set), services.PatternTypeTotalMismatch))
+
+		original := g.invoice()
+		duplicate := g.invoice()
+		duplicate.vendor, duplicate.iban, duplicate.number = original.vendor, original.iban, original.number
+		fixtures = append(fixtures,
+			original.fixture(fmt.Sprintf("set%d-duplicate-original", set)),
+			duplicate.fixture(fmt.Sprintf("set%d-duplicate", set), services.PatternTypeDuplicateInvoiceNumber))
+
+		earlier := g.invoice()
+		changed := g.invoice()
+		changed.vendor = earlier.vendor
+		if changed.number == earlier.number {
+			changed.number += "A"
+		}
+		fixtures = append(fixtures,
+			earlier.fixture(fmt.Sprintf("set%d-bank-original", set)),
+			changed.fixture(fmt.Sprintf("set%d-bank-change", set), services.PatternTypeBankDetailsChange))
+	}
+	return fixtures
+}
+
+// Write saves fixtures as text files in dir, with a manifest.json listing
+// them
+func Write(dir string, seed int64, sets int, fixtures []*Fixture) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	for _, fixture := range fixtures {
+		if err := os.WriteFile(filepath.Join(dir, fixture.File), []byte(fixture.Text), 0o644); err != nil {
+			return err
+		}
+	}
+	manifest, err := json.MarshalIndent(Manifest{Seed: seed, Sets: sets, Checked: Checked, Fixtures: fixtures}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), append(manifest, '\n'), 0o644)
+}
+
+type generator struct {
+	rnd     *rand.Rand
+	vendors map[string]bool
+}
+
+type catalogItem struct {
+	name  string
+	price float64
+}
+
+type lineItem struct {
+	name     string
+	quantity int
+	price    float64
+	amount   float64
+}
+
+// document is what invoices and receipts share: line items and the
+// amounts stated beneath them
+type document struct {
+	date     string
+	items    []lineItem
+	subtotal float64
+	taxLabel string
+	tax      float64
+	total    float64
+}
+
+type invoice struct {
+	document
+	vendor   string
+	customer string
+	number   string
+	iban     string
+}
+
+type receipt struct {
+	document
+	merchant string
+}
+
+// vendor names a vendor not used before in the run
+func (g *generator) vendor() string {
+	name := fmt.Sprintf("%s %s Ltd", vendorWords[g.rnd.Intn(len(vendorWords))], vendorKinds[g.rnd.Intn(len(vendorKinds))])
+	for n := 2; g.vendors[name]; n++ {
+		name = fmt.Sprintf("%s %s %d Ltd", vendorWords[g.rnd.Intn(len(vendorWords))], vendorKinds[g.rnd.Intn(len(vendorKinds))], n)
+	}
+	g.vendors[name] = true
+	return name
+}
+
+// date is a weekday of 2024, so that fixtures are not flagged for
+// non-business days
+func (g *generator) date() string {
+	for {
+		day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, g.rnd.Intn(366))
+		if day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			return day.Format("2006-01-02")
+		}
+	}
+}
+
+func (g *generator) document(catalog []catalogItem, taxLabel string, taxRate float64) document {
+	d := document{date: g.date(), taxLabel: taxLabel}
+	for _, i := range g.rnd.Perm(len(catalog))[:2+g.rnd.Intn(3)] {
+		item := lineItem{name: catalog[i].name, quantity: 1 + g.rnd.Intn(5), price: catalog[i].price}
+		item.amount = round2(float64(item.quantity) * item.price)
+		d.items = append(d.items, item)
+		d.subtotal += item.amount
+	}
+	d.subtotal = round2(d.subtotal)
+	d.tax = round2(d.subtotal * taxRate)
+	d.total = round2(d.subtotal + d.tax)
+	return d
+}
+
+func (g *generator) invoice() *invoice {
+	return &invoice{
+		document: g.document(invoiceItems, "VAT (20%)", 0.2),
+		vendor:   g.vendor(),
+		customer: customers[g.rnd.Intn(len(customers))],
+		number:   fmt.Sprintf("INV-2024-%04d", 1+g.rnd.Intn(9999)),
+		iban:     g.iban(),
+	}
+}
+
+func (g *generator) receipt() *receipt {
+	return &receipt{
+		document: g.document(receiptItems, "Sales tax (8%)", 0.08),
+		merchant: merchants[g.rnd.Intn(len(merchants))],
+	}
+}
+
+// tamper inflates either the total or one line item's amount, as when a
+// figure is edited without the arithmetic around it
+func (g *generator) tamper(d *document) {
+	inflate := round2(float64(10+g.rnd.Intn(490)) + float64(g.rnd.Intn(100))/100)
+	if g.rnd.Intn(2) == 0 {
+		d.total = round2(d.total + inflate)
+		return
+	}
+	i := g.rnd.Intn(len(d.items))
+	d.items[i].amount = round2(d.items[i].amount + inflate)
+}
+
+// iban is a UK IBAN with valid check digits
+func (g *generator) iban() string {
+	bban := fmt.Sprintf("NWBK%06d%08d", g.rnd.Intn(1000000), g.rnd.Intn(100000000))
+	var digits strings.Builder
+	for _, r := range bban + "GB00" {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	check := 98 - new(big.Int).Mod(n, big.NewInt(97)).Int64()
+	iban := fmt.Sprintf("GB%02d%s", check, bban)
+
+	var grouped []string
+	for i := 0; i < len(iban); i += 4 {
+		grouped = append(grouped, iban[i:min(i+4, len(iban))])
+	}
+	return strings.Join(grouped, " ")
+}
+
+// lines renders the line items and the amounts beneath them. The amounts
+// are stated as they are, tampered or not.
+func (d *document) lines(b *strings.Builder) {
+	fmt.Fprintf(b, "%-24s %-18s %s\n", "Description", "Qty x Unit price", "Amount")
+	for _, item := range d.items {
+		fmt.Fprintf(b, "%-24s %-18s %s\n", item.name, fmt.Sprintf("%d x %s", item.quantity, formatAmount(item.price)), formatAmount(item.amount))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(b, "Subtotal: %s\n", formatAmount(d.subtotal))
+	fmt.Fprintf(b, "%s: %s\n", d.taxLabel, formatAmount(d.tax))
+}
+
+func (inv *invoice) fixture(name string, injected ...string) *Fixture {
+	var b strings.Builder
+	b.WriteString("INVOICE\n\n")
+	fmt.Fprintf(&b, "%s\nInvoice Number: %s\nInvoice Date: %s\nBill To: %s\nCurrency: GBP\n\n", inv.vendor, inv.number, inv.date, inv.customer)
+	inv.lines(&b)
+	fmt.Fprintf(&b, "Total Due: %s\n\n", formatAmount(inv.total))
+	fmt.Fprintf(&b, "Please pay within 30 days by bank transfer to IBAN %s, quoting %s.\n", inv.iban, inv.number)
+
+	return newFixture(name, "invoice", b.String(), injected, services.Metadata{
+		"invoice_number": inv.number,
+		"vendor":         inv.vendor,
+		"amount":         inv.total,
+		"currency":       "GBP",
+		"invoice_date":   inv.date,
+	})
+}
+
+func (r *receipt) fixture(name string, injected ...string) *Fixture {
+	var b strings.Builder
+	fmt.Fprintf(&b, "RECEIPT\n\n%s\nDate: %s\n\n", r.merchant, r.date)
+	r.lines(&b)
+	fmt.Fprintf(&b, "Total: %s\n\nPaid by card. Thank you!\n", formatAmount(r.total))
+
+	return newFixture(name, "receipt", b.String(), injected, services.Metadata{
+		"merchant":      r.merchant,
+		"amount":        r.total,
+		"currency":      "USD",
+		"purchase_date": r.date,
+	})
+}
+
+func newFixture(name, documentType, text string, injected []string, metadata services.Metadata) *Fixture {
+	if injected == nil {
+		injected = []string{}
+	}
+	return &Fixture{
+		Name:         name,
+		File:         name + ".txt",
+		DocumentType: documentType,
+		Metadata:     metadata,
+		Injected:     injected,
+		Text:         text,
+	}
+}
+
+func round2(amount float64) float64 {
+	return float64(int64(amount*100+0.5)) / 100
+}
+
+// formatAmount writes an amount with two decimals and thousands separators
+func formatAmount(amount float64) string {
+	s := fmt.Sprintf("%.2f", amount)
+	whole, cents := s[:len(s)-3], s[len(s)-3:]
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	return whole + cents
+}
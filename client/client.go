@@ -0,0 +1,308 @@
+package frauddocai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Document statuses
+const (
+	// StatusUploaded is the status of a document whose analysis has not
+	// finished
+	StatusUploaded  = "uploaded"
+	StatusProcessed = "processed"
+)
+
+// Client calls the FraudDocAI API. Its methods are safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	header     http.Header
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sends requests through httpClient instead of
+// http.DefaultClient, for timeouts, TLS settings or tracing
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHeader adds a header to every request, such as the Authorization
+// header of a gateway in front of the backend
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// New returns a client of the backend at baseURL, such as
+// http://frauddocai-backend:8080. Requests go to its /api/v2 endpoints.
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/") + "/api/v2",
+		httpClient: http.DefaultClient,
+		header:     http.Header{},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// APIError is returned for a response with an error status. Body holds the
+// backend's explanation, including the fields that failed validation.
+type APIError struct {
+	StatusCode int
+	Body       Error
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("frauddocai: %d %s", e.StatusCode, e.Body.Error)
+	for _, field := range e.Body.Fields {
+		message += "; " + field.Message
+	}
+	return message
+}
+
+// IsNotFound reports whether err is a 404 from the backend
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// UploadOptions are the optional fields of an upload
+type UploadOptions struct {
+	// ContentType of the file. By default it is derived from the file name's
+	// extension.
+	ContentType  string
+	DocumentType string
+	Metadata     map[string]interface{}
+	// SHA256 is the hex digest of the file. The backend rejects the upload
+	// when the bytes it receives or stores do not match it.
+	SHA256 string
+}
+
+// Upload uploads a document read from r under filename. The file is
+// streamed, not buffered. Analysis runs in the background; use
+// WaitForAnalysis for its result.
+func (c *Client) Upload(ctx context.Context, filename string, r io.Reader, options *UploadOptions) (*UploadResponse, error) {
+	if options == nil {
+		options = &UploadOptions{}
+	}
+	fields := map[string]string{
+		"document_type": options.DocumentType,
+		"sha256":        options.SHA256,
+	}
+	if options.Metadata != nil {
+		metadata, err := json.Marshal(options.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("frauddocai: failed to encode metadata: %v", err)
+		}
+		fields["metadata"] = string(metadata)
+	}
+	contentType := options.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeUploadForm(form, filename, contentType, r, fields))
+	}()
+
+	var resp UploadResponse
+	err := c.do(ctx, http.MethodPost, "/documents/upload", form.FormDataContentType(), body, &resp)
+	// Stop the form writer if the request ended before reading all of it
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func writeUploadForm(form *multipart.Writer, filename, contentType string, r io.Reader, fields map[string]string) error {
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(filename)))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// UploadFile uploads the file at path. Unless options give a digest, the
+// file is hashed first so the backend can verify the upload.
+func (c *Client) UploadFile(ctx context.Context, path string, options *UploadOptions) (*UploadResponse, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	opts := UploadOptions{}
+	if options != nil {
+		opts = *options
+	}
+	if opts.SHA256 == "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return nil, err
+		}
+		opts.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return c.Upload(ctx, filepath.Base(path), file, &opts)
+}
+
+// GetDocument returns a document and, once it has finished, its analysis
+func (c *Client) GetDocument(ctx context.Context, id string) (*Document, error) {
+	var resp DocumentResponse
+	if err := c.do(ctx, http.MethodGet, "/documents/"+id, "", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Document, nil
+}
+
+// longPollTimeout is how long each request of WaitForAnalysis asks the
+// backend to hold it
+const longPollTimeout = 30 * time.Second
+
+// WaitForAnalysis waits until a document's analysis has finished and
+// returns it. The backend holds each request until then or for up to 30
+// seconds, unless the document is queued for longer, when the wait it
+// announces is slept instead; bound the total wait with ctx.
+func (c *Client) WaitForAnalysis(ctx context.Context, id string) (*Document, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		timeout := longPollTimeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+			timeout = time.Until(deadline)
+		}
+		query := url.Values{
+			"wait_for": {StatusProcessed},
+			"timeout":  {timeout.Round(time.Millisecond).String()},
+		}
+		var resp DocumentResponse
+		if err := c.do(ctx, http.MethodGet, "/documents/"+id+"?"+query.Encode(), "", nil, &resp); err != nil {
+			return nil, err
+		}
+		if resp.Document.Status == StatusProcessed {
+			return &resp.Document, nil
+		}
+		// With a long analysis queue the backend answers at once; sleep
+		// until the last long poll before the expected finish
+		if resp.EtaSeconds != nil {
+			if wait := time.Duration(*resp.EtaSeconds)*time.Second - longPollTimeout; wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// Ask answers a question about a document's text
+func (c *Client) Ask(ctx context.Context, question, documentText string) (*AskResponse, error) {
+	body, err := json.Marshal(AskRequest{Question: question, DocumentText: documentText})
+	if err != nil {
+		return nil, err
+	}
+	var resp AskResponse
+	if err := c.do(ctx, http.MethodPost, "/qa/ask", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// AnalyzeFraud asks the fraud questions about a document's text
+func (c *Client) AnalyzeFraud(ctx context.Context, documentText string) (*AnalyzeFraudResponse, error) {
+	body, err := json.Marshal(AnalyzeFraudRequest{DocumentText: documentText})
+	if err != nil {
+		return nil, err
+	}
+	var resp AnalyzeFraudResponse
+	if err := c.do(ctx, http.MethodPost, "/qa/analyze-fraud", "application/json", bytes.NewReader(body), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("frauddocai: %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr.Body); err != nil {
+			apiErr.Body.Error = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("frauddocai: invalid response to %s %s: %v", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,6 @@
+// Package frauddocai is a Go client for the FraudDocAI backend API. Its
+// request and response types are generated from the backend's OpenAPI spec,
+// backend/api/openapi.yaml; run go generate after changing the spec.
+package frauddocai
+
+//go:generate go run ./internal/modelgen -spec ../backend/api/openapi.yaml -out models.gen.go
@@ -0,0 +1,124 @@
+// Code generated by modelgen from ../backend/api/openapi.yaml. DO NOT EDIT.
+
+package frauddocai
+
+import "time"
+
+type AnalyzeFraudRequest struct {
+	DocumentText string `json:"document_text"`
+}
+
+type AnalyzeFraudResponse struct {
+	FraudAnalysis     []FraudQuestionAnswer `json:"fraud_analysis"`
+	ModelUsed         *string               `json:"model_used,omitempty"`
+	OverallRisk       string                `json:"overall_risk"`
+	QuestionsAnalyzed *int                  `json:"questions_analyzed,omitempty"`
+	Status            string                `json:"status"`
+	Timestamp         *string               `json:"timestamp,omitempty"`
+	TotalRiskScore    float64               `json:"total_risk_score"`
+}
+
+type AskRequest struct {
+	DocumentText string `json:"document_text"`
+	Question     string `json:"question"`
+}
+
+type AskResponse struct {
+	Answer     string  `json:"answer"`
+	Confidence float64 `json:"confidence"`
+	ModelUsed  *string `json:"model_used,omitempty"`
+	Question   string  `json:"question"`
+	Status     string  `json:"status"`
+	Timestamp  *string `json:"timestamp,omitempty"`
+}
+
+type Document struct {
+	// The analysis was reused from an earlier document with the same text
+	AnalysisCached   *bool     `json:"analysis_cached,omitempty"`
+	AnalysisFallback *bool     `json:"analysis_fallback,omitempty"`
+	AnalysisProvider *string   `json:"analysis_provider,omitempty"`
+	ContentSHA256    *string   `json:"content_sha256,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	DocumentType     *string   `json:"document_type,omitempty"`
+	// Most confident emotion the analysis detected
+	DominantEmotion *string `json:"dominant_emotion,omitempty"`
+	// Detailed emotion analysis, only included by getDocument
+	EmotionAnalysis  map[string]interface{} `json:"emotion_analysis,omitempty"`
+	ExtractedText    *string                `json:"extracted_text,omitempty"`
+	FileSize         int64                  `json:"file_size"`
+	Filename         string                 `json:"filename"`
+	FraudRiskLevel   string                 `json:"fraud_risk_level"`
+	FraudScore       *float64               `json:"fraud_score,omitempty"`
+	ID               string                 `json:"id"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	MIMEType         string                 `json:"mime_type"`
+	OriginalFilename string                 `json:"original_filename"`
+	// Detailed pattern analysis, only included by getDocument
+	PatternAnalysis map[string]interface{} `json:"pattern_analysis,omitempty"`
+	// Number of fraud patterns the analysis matched
+	PatternCount *int `json:"pattern_count,omitempty"`
+	// The stages of the document's latest processing pipeline run
+	PipelineStages []PipelineStageRun `json:"pipeline_stages,omitempty"`
+	// uploaded until the analysis has finished, then processed
+	Status      string  `json:"status"`
+	StorageTier *string `json:"storage_tier,omitempty"`
+	// Team of the tenant the document belongs to
+	TeamID    *string   `json:"team_id,omitempty"`
+	TenantID  *string   `json:"tenant_id,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type DocumentResponse struct {
+	Document Document `json:"document"`
+	// Expected seconds until the analysis has finished, on pending responses for queued documents
+	EtaSeconds *int   `json:"eta_seconds,omitempty"`
+	Status     string `json:"status"`
+}
+
+type Error struct {
+	Error    string       `json:"error"`
+	Fields   []FieldError `json:"fields,omitempty"`
+	MaxBytes *int64       `json:"max_bytes,omitempty"`
+	Problems []string     `json:"problems,omitempty"`
+	Status   string       `json:"status"`
+}
+
+type FieldError struct {
+	Field   string  `json:"field"`
+	Message string  `json:"message"`
+	Param   *string `json:"param,omitempty"`
+	Rule    string  `json:"rule"`
+}
+
+type FraudQuestionAnswer struct {
+	Answer     string  `json:"answer"`
+	Category   *string `json:"category,omitempty"`
+	Confidence float64 `json:"confidence"`
+	// Set when the question could not be answered
+	Error           *string                `json:"error,omitempty"`
+	FraudIndicators map[string]interface{} `json:"fraud_indicators,omitempty"`
+	Question        string                 `json:"question"`
+	RiskScore       float64                `json:"risk_score"`
+}
+
+type PipelineStageRun struct {
+	Attempts     int        `json:"attempts"`
+	DurationMs   float64    `json:"duration_ms"`
+	Error        *string    `json:"error,omitempty"`
+	Outcome      string     `json:"outcome"`
+	Run          int        `json:"run"`
+	RunStartedAt time.Time  `json:"run_started_at"`
+	Stage        string     `json:"stage"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+}
+
+type UploadResponse struct {
+	// Expected seconds until the analysis has finished
+	EtaSeconds *int    `json:"eta_seconds,omitempty"`
+	FileID     string  `json:"file_id"`
+	FileName   string  `json:"file_name"`
+	FileSize   int64   `json:"file_size"`
+	FileURL    *string `json:"file_url,omitempty"`
+	Message    *string `json:"message,omitempty"`
+	Status     string  `json:"status"`
+}
@@ -60,7 +60,16 @@ const DocumentUpload: React.FC = () => {
     const pollDocuments = async () => {
       try {
         const response = await api.getDocuments();
-        setDocuments(response.documents);
+        // The list omits the detailed analysis, so fetch it for this session's uploads
+        const uploadedIds = new Set(uploadedFiles.map(f => f.fileId));
+        const documents = await Promise.all(
+          response.documents.map(doc =>
+            doc.status === 'processed' && uploadedIds.has(doc.id)
+              ? api.getDocument(doc.id).then(details => details.document).catch(() => doc)
+              : doc
+          )
+        );
+        setDocuments(documents);
         
         // Update uploaded files with fraud analysis results
         setUploadedFiles(prev => 
@@ -338,6 +347,20 @@ const DocumentUpload: React.FC = () => {
                     </div>
                   )}
 
+                  {/* Analysis summary when the details were not fetched */}
+                  {!doc.emotion_analysis && !doc.pattern_analysis && (doc.dominant_emotion || doc.pattern_count > 0) && (
+                    <div className="mt-4 border-t pt-4 text-sm text-gray-600">
+                      {doc.dominant_emotion && (
+                        <span className="mr-4">
+                          <span className="font-medium">Dominant Emotion:</span> {doc.dominant_emotion}
+                        </span>
+                      )}
+                      <span>
+                        <span className="font-medium">Patterns Detected:</span> {doc.pattern_count}
+                      </span>
+                    </div>
+                  )}
+
                   {/* Emotion Analysis Results */}
                   {doc.emotion_analysis && (() => {
                     try {
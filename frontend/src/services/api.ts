@@ -62,6 +62,9 @@ export interface Document {
   fraud_score: number | null;
   fraud_risk_level: string;
   extracted_text: string | null;
+  pattern_count: number;
+  dominant_emotion: string | null;
+  // Only included when a single document is fetched
   emotion_analysis?: EmotionAnalysis;
   pattern_analysis?: PatternAnalysis;
   ocr_quality?: OCRQuality;
@@ -176,8 +179,8 @@ export const api = {
     return response.json();
   },
 
-  // Get document details
-  async getDocument(fileId: string) {
+  // Get document details, including the emotion and pattern analysis
+  async getDocument(fileId: string): Promise<{ document: Document; status: string }> {
     const response = await fetch(`${API_BASE_URL}/documents/${fileId}`);
     
     if (!response.ok) {